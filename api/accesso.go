@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"officina/database"
+)
+
+// chiaveSessione indica nel contesto della richiesta la sessione del database
+type chiaveSessione struct{}
+
+// sessioneRichiesta restituisce la sessione del database della richiesta,
+// con origine "api" e l'operatore autenticato; nil senza database (test)
+func sessioneRichiesta(req *http.Request) *database.DB {
+	db, _ := req.Context().Value(chiaveSessione{}).(*database.DB)
+	return db
+}
+
+// operatoreRichiesta identifica l'operatore della richiesta con HTTP Basic
+// (matricola e password o PIN). Restituisce nil se l'accesso operatori non
+// è configurato, nel qual caso accetta solo richieste dalla stessa macchina;
+// false se ha già scritto la risposta di errore.
+func (s *Server) operatoreRichiesta(w http.ResponseWriter, req *http.Request) (*database.Operatore, bool) {
+	if s.accessoRichiesto == nil {
+		return nil, true
+	}
+	richiesto, err := s.accessoRichiesto()
+	if err != nil {
+		scriviErrore(w, http.StatusInternalServerError, "errore verifica accesso: "+err.Error())
+		return nil, false
+	}
+	if !richiesto {
+		if !locale(req) {
+			scriviErrore(w, http.StatusForbidden, "accesso dalla rete non consentito: impostare la password di almeno un operatore")
+			return nil, false
+		}
+		return nil, true
+	}
+
+	matricola, credenziale, ok := req.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="officina"`)
+		scriviErrore(w, http.StatusUnauthorized, "autenticazione richiesta: matricola e password dell'operatore")
+		return nil, false
+	}
+
+	o, err := s.autentica(matricola, credenziale)
+	if err != nil {
+		if errors.Is(err, database.ErrCredenzialiNonValide) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="officina"`)
+			scriviErrore(w, http.StatusUnauthorized, err.Error())
+		} else {
+			scriviErrore(w, http.StatusInternalServerError, "errore verifica accesso: "+err.Error())
+		}
+		return nil, false
+	}
+	return o, true
+}
+
+// locale indica se la richiesta arriva dalla stessa macchina (loopback)
+func locale(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// consenti autentica la richiesta e verifica che il ruolo dell'operatore
+// abbia il permesso dell'operazione, con le stesse regole della TUI. Ogni
+// richiesta lavora su una propria sessione del database con l'operatore
+// autenticato: le scritture gli sono attribuite nel registro attività e i
+// controlli dei permessi del database usano il suo ruolo.
+func (s *Server) consenti(op operazione, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		o, ok := s.operatoreRichiesta(w, req)
+		if !ok {
+			return
+		}
+		if o != nil && op.risorsa != "" && !database.Consentito(o.Ruolo, op.risorsa, op.permesso) {
+			scriviErrore(w, http.StatusForbidden, fmt.Sprintf("%s: il ruolo %s non può eseguire %s %s",
+				database.ErrPermessoNegato, o.Ruolo, op.metodo, Prefisso+op.path))
+			return
+		}
+		db := s.db
+		if db != nil {
+			db = db.NuovaSessione(database.OrigineAPI)
+			db.ImpostaOperatore(o)
+		}
+		h(w, req.WithContext(context.WithValue(req.Context(), chiaveSessione{}, db)))
+	}
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"officina/database"
+)
+
+// StatsCommesse è la risposta di GET /stats/commesse
+type StatsCommesse struct {
+	Aperte int `json:"aperte"`
+	Chiuse int `json:"chiuse"`
+}
+
+// StatsPrimaNota è la risposta di GET /stats/primanota
+type StatsPrimaNota struct {
+	Anno    int     `json:"anno"`
+	Entrate float64 `json:"entrate"`
+	Uscite  float64 `json:"uscite"`
+	Saldo   float64 `json:"saldo"`
+}
+
+// registraAggregati aggiunge gli elenchi collegati, le statistiche, il
+// profilo aziendale e il controllo di integrità
+func (s *Server) registraAggregati() {
+	registraCollegati(s, "/clienti/{id}/veicoli", "clienti", "Veicoli del cliente", database.RisorsaVeicoli,
+		"cliente", (*database.DB).GetCliente, (*database.DB).ListVeicoli,
+		func(v *database.Veicolo) int { return v.ClienteID }, func(v *database.Veicolo) *int { return &v.ID })
+
+	registraCollegati(s, "/veicoli/{id}/commesse", "veicoli", "Commesse del veicolo", database.RisorsaCommesse,
+		"veicolo", (*database.DB).GetVeicolo, (*database.DB).ListCommesse,
+		func(c *database.Commessa) int { return c.VeicoloID }, func(c *database.Commessa) *int { return &c.ID })
+
+	registraCollegati(s, "/commesse/{id}/movimenti", "commesse", "Movimenti di prima nota della commessa", database.RisorsaMovimenti,
+		"commessa", (*database.DB).GetCommessa, func(db *database.DB) ([]database.MovimentoPrimaNota, error) { return db.ListMovimentiPrimaNota(nil) },
+		func(m *database.MovimentoPrimaNota) int { return m.CommessaID }, func(m *database.MovimentoPrimaNota) *int { return &m.ID })
+
+	registraCollegati(s, "/fatture/{id}/movimenti", "fatture", "Incassi assegnati alla fattura", database.RisorsaMovimenti,
+		"fattura", (*database.DB).GetFattura, func(db *database.DB) ([]database.MovimentoPrimaNota, error) { return db.ListMovimentiPrimaNota(nil) },
+		func(m *database.MovimentoPrimaNota) int { return m.FatturaID }, func(m *database.MovimentoPrimaNota) *int { return &m.ID })
+
+	s.route(operazione{
+		metodo: http.MethodGet, path: "/stats/commesse", tag: "statistiche",
+		sommario: "Numero di commesse aperte e chiuse", risposta: reflect.TypeOf(StatsCommesse{}),
+		risorsa: database.RisorsaCommesse, permesso: database.PermessoVedi,
+	}, s.handleStatsCommesse)
+
+	s.route(operazione{
+		metodo: http.MethodGet, path: "/stats/primanota", tag: "statistiche",
+		sommario:  "Totale entrate e uscite di prima nota nell'anno",
+		parametri: []parametro{{nome: "anno", tipo: "integer", descrizione: "Anno (predefinito: anno corrente)"}},
+		risposta:  reflect.TypeOf(StatsPrimaNota{}),
+		risorsa:   database.RisorsaSaldo, permesso: database.PermessoVedi,
+	}, s.handleStatsPrimaNota)
+
+	s.route(operazione{
+		metodo: http.MethodGet, path: "/stats/crediti", tag: "statistiche",
+		sommario:  "Scadenzario dei crediti verso i clienti per fascia di ritardo",
+		parametri: []parametro{{nome: "data", tipo: "string", formato: "date", descrizione: "Data di riferimento AAAA-MM-GG (predefinita: oggi)"}},
+		risposta:  reflect.TypeOf(database.ScadenzarioCrediti{}),
+		risorsa:   database.RisorsaFatture, permesso: database.PermessoVedi,
+	}, s.handleStatsCrediti)
+
+	s.route(operazione{
+		metodo: http.MethodGet, path: "/profilo", tag: "profilo",
+		sommario: "Profilo dell'azienda", risposta: reflect.TypeOf(database.ProfiloAzienda{}),
+		risorsa: database.RisorsaProfilo, permesso: database.PermessoVedi,
+	}, s.handleGetProfilo)
+
+	s.route(operazione{
+		metodo: http.MethodPut, path: "/profilo", tag: "profilo",
+		sommario: "Aggiorna il profilo dell'azienda", corpo: reflect.TypeOf(database.ProfiloAzienda{}),
+		risposta: reflect.TypeOf(database.ProfiloAzienda{}),
+		risorsa:  database.RisorsaProfilo, permesso: database.PermessoModifica,
+	}, s.handlePutProfilo)
+
+	s.route(operazione{
+		metodo: http.MethodGet, path: "/integrita", tag: "statistiche",
+		sommario: "Controllo di integrità dei dati (sola lettura)", risposta: reflect.TypeOf(database.IntegrityReport{}),
+		risorsa: database.RisorsaBackup, permesso: database.PermessoVedi,
+	}, s.handleIntegrita)
+}
+
+// registraCollegati espone l'elenco paginato dei record collegati a un
+// record padre, restituendo 404 se il padre non esiste
+func registraCollegati[P, T any](s *Server, path, tag, sommario, ambito, padre string,
+	get func(*database.DB, int) (*P, error), list func(*database.DB) ([]T, error), collegato func(*T) int, id func(*T) *int) {
+
+	s.route(operazione{
+		metodo: http.MethodGet, path: path, tag: tag, sommario: sommario,
+		parametri: parametriPaginazione(), risposta: reflect.TypeOf((*T)(nil)).Elem(), lista: true,
+		risorsa: ambito, permesso: database.PermessoVedi,
+	}, func(w http.ResponseWriter, req *http.Request) {
+		padreID, ok := leggiID(w, req)
+		if !ok {
+			return
+		}
+		pagina, perPagina, err := leggiPaginazione(req.URL.Query())
+		if err != nil {
+			scriviErrore(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		db := sessioneRichiesta(req)
+		if _, err := get(db, padreID); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				scriviErrore(w, http.StatusNotFound, fmt.Sprintf("%s #%d non trovato", padre, padreID))
+			} else {
+				scriviErrore(w, http.StatusInternalServerError, fmt.Sprintf("errore lettura %s #%d: %v", padre, padreID, err))
+			}
+			return
+		}
+
+		tutti, err := list(db)
+		if err != nil {
+			scriviErrore(w, http.StatusInternalServerError, "errore lettura: "+err.Error())
+			return
+		}
+
+		p := impagina(filtra(tutti, []func(*T) bool{func(v *T) bool { return collegato(v) == padreID }}), id, pagina, perPagina)
+		w.Header().Set("X-Total-Count", strconv.Itoa(p.Totale))
+		scriviJSON(w, http.StatusOK, p)
+	})
+}
+
+func (s *Server) handleStatsCommesse(w http.ResponseWriter, req *http.Request) {
+	aperte, chiuse, err := sessioneRichiesta(req).GetCommesseStats()
+	if err != nil {
+		scriviErrore(w, http.StatusInternalServerError, "errore statistiche commesse: "+err.Error())
+		return
+	}
+	scriviJSON(w, http.StatusOK, StatsCommesse{Aperte: aperte, Chiuse: chiuse})
+}
+
+func (s *Server) handleStatsPrimaNota(w http.ResponseWriter, req *http.Request) {
+	anno := time.Now().Year()
+	if v := strings.TrimSpace(req.URL.Query().Get("anno")); v != "" {
+		a, err := strconv.Atoi(v)
+		if err != nil || a < 1900 || a > 9999 {
+			scriviErroreCampi(w, http.StatusBadRequest, "parametri di query non validi",
+				[]ErroreCampo{{Campo: "anno", Messaggio: "anno non valido"}})
+			return
+		}
+		anno = a
+	}
+
+	entrate, uscite, err := sessioneRichiesta(req).GetPrimaNotaStats(anno)
+	if err != nil {
+		scriviErrore(w, http.StatusInternalServerError, "errore statistiche prima nota: "+err.Error())
+		return
+	}
+	scriviJSON(w, http.StatusOK, StatsPrimaNota{Anno: anno, Entrate: entrate, Uscite: uscite, Saldo: entrate - uscite})
+}
+
+func (s *Server) handleStatsCrediti(w http.ResponseWriter, req *http.Request) {
+	oggi := time.Now()
+	if v := strings.TrimSpace(req.URL.Query().Get("data")); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			scriviErroreCampi(w, http.StatusBadRequest, "parametri di query non validi",
+				[]ErroreCampo{{Campo: "data", Messaggio: "data non valida (formato AAAA-MM-GG)"}})
+			return
+		}
+		oggi = d
+	}
+
+	r, err := sessioneRichiesta(req).ScadenzarioCrediti(oggi)
+	if err != nil {
+		scriviErrore(w, http.StatusInternalServerError, "errore scadenzario crediti: "+err.Error())
+		return
+	}
+	scriviJSON(w, http.StatusOK, r)
+}
+
+func (s *Server) handleGetProfilo(w http.ResponseWriter, req *http.Request) {
+	p, err := sessioneRichiesta(req).GetProfiloAzienda()
+	if err != nil {
+		scriviErrore(w, http.StatusInternalServerError, "errore lettura profilo: "+err.Error())
+		return
+	}
+	scriviJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handlePutProfilo(w http.ResponseWriter, req *http.Request) {
+	var p database.ProfiloAzienda
+	if !leggiCorpo(w, req, &p) {
+		return
+	}
+	if err := p.Validate(); err != nil {
+		scriviErroreCampi(w, http.StatusUnprocessableEntity, "profilo non valido", []ErroreCampo{{Messaggio: err.Error()}})
+		return
+	}
+	if err := sessioneRichiesta(req).SaveProfiloAzienda(&p); err != nil {
+		scriviErrore(w, http.StatusInternalServerError, "errore salvataggio profilo: "+err.Error())
+		return
+	}
+	scriviJSON(w, http.StatusOK, &p)
+}
+
+func (s *Server) handleIntegrita(w http.ResponseWriter, req *http.Request) {
+	report, err := sessioneRichiesta(req).CheckIntegrity()
+	if err != nil {
+		scriviErrore(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	scriviJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"officina/database"
+	"officina/utils"
+)
+
+// memoria simula una collection del database; autori registra l'operatore
+// della sessione di ogni scrittura
+type memoria struct {
+	dati   map[int]database.Veicolo
+	next   int
+	autori []string
+}
+
+// scrittura registra l'operatore della sessione che scrive
+func (m *memoria) scrittura(db *database.DB) {
+	autore := ""
+	if db != nil && db.OperatoreCorrente() != nil {
+		autore = db.OperatoreCorrente().Matricola
+	}
+	m.autori = append(m.autori, autore)
+}
+
+func (m *memoria) list(db *database.DB) ([]database.Veicolo, error) {
+	var out []database.Veicolo
+	for _, v := range m.dati {
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (m *memoria) get(db *database.DB, id int) (*database.Veicolo, error) {
+	v, ok := m.dati[id]
+	if !ok {
+		return nil, fmt.Errorf("veicolo non trovato: %w", mongo.ErrNoDocuments)
+	}
+	return &v, nil
+}
+
+func (m *memoria) create(db *database.DB, v *database.Veicolo) error {
+	m.scrittura(db)
+	m.next++
+	v.ID = m.next
+	m.dati[v.ID] = *v
+	return nil
+}
+
+func (m *memoria) update(db *database.DB, v *database.Veicolo) error {
+	m.scrittura(db)
+	m.dati[v.ID] = *v
+	return nil
+}
+
+func (m *memoria) delete(db *database.DB, id int) error {
+	m.scrittura(db)
+	delete(m.dati, id)
+	return nil
+}
+
+// serverDiProva espone i veicoli di una memoria; configura, se presente,
+// imposta il server prima dell'avvio
+func serverDiProva(t *testing.T, configura ...func(*Server)) (*httptest.Server, *memoria) {
+	t.Helper()
+
+	m := &memoria{dati: make(map[int]database.Veicolo)}
+	for i := 1; i <= 5; i++ {
+		m.create(nil, &database.Veicolo{Targa: fmt.Sprintf("AB%03dCD", i), Marca: "Fiat", Modello: "Panda", ClienteID: i % 2, Anno: 2020})
+	}
+	m.dati[3] = database.Veicolo{ID: 3, Targa: "ZZ999ZZ", Marca: "Alfa", Modello: "Giulia", ClienteID: 1, Anno: 2020,
+		UltimaRev: time.Date(2026, 3, 5, 10, 0, 0, 0, time.Local)}
+	m.autori = nil
+
+	s := &Server{mux: http.NewServeMux(), version: "test"}
+	registraRisorsa(s, risorsa[database.Veicolo]{
+		nome: "veicoli", ambito: database.RisorsaVeicoli, singolare: "veicolo",
+		list: m.list, get: m.get, create: m.create, update: m.update, delete: m.delete,
+		id: func(v *database.Veicolo) *int { return &v.ID },
+		valida: func(db *database.DB, ve *database.Veicolo) []ErroreCampo {
+			var v validazione
+			v.controlla("targa", utils.ValidateTarga(ve.Targa))
+			v.controlla("marca", utils.ValidateNotEmpty(ve.Marca, "marca"))
+			return v
+		},
+		filtri: append([]filtro[database.Veicolo]{
+			filtroTesto("q", "", func(v *database.Veicolo) string { return v.Targa + " " + v.Marca }),
+			filtroID("cliente_id", "", func(v *database.Veicolo) int { return v.ClienteID }),
+		}, filtriPeriodo(func(v *database.Veicolo) time.Time { return v.UltimaRev })...),
+	})
+
+	for _, c := range configura {
+		c(s)
+	}
+
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return ts, m
+}
+
+func TestRisorsa(t *testing.T) {
+	ts, m := serverDiProva(t)
+
+	tests := []struct {
+		name   string
+		metodo string
+		path   string
+		corpo  string
+		stato  int
+		totale int    // per gli elenchi
+		targhe string // targhe restituite dall'elenco, separate da virgola
+		campi  string // campi con errori di validazione, separati da virgola
+	}{
+		{name: "elenco", metodo: "GET", path: "/veicoli", stato: 200, totale: 5, targhe: "AB001CD,AB002CD,ZZ999ZZ,AB004CD,AB005CD"},
+		{name: "pagina 2", metodo: "GET", path: "/veicoli?pagina=2&per_pagina=2", stato: 200, totale: 5, targhe: "ZZ999ZZ,AB004CD"},
+		{name: "oltre l'ultima pagina", metodo: "GET", path: "/veicoli?pagina=9", stato: 200, totale: 5},
+		{name: "filtri combinati", metodo: "GET", path: "/veicoli?cliente_id=1&q=fiat", stato: 200, totale: 2, targhe: "AB001CD,AB005CD"},
+		{name: "periodo", metodo: "GET", path: "/veicoli?dal=2026-03-05&al=2026-03-05", stato: 200, totale: 1, targhe: "ZZ999ZZ"},
+		{name: "filtro sconosciuto", metodo: "GET", path: "/veicoli?colore=rosso", stato: 400, campi: "colore"},
+		{name: "filtro non valido", metodo: "GET", path: "/veicoli?cliente_id=x&dal=5/3/2026", stato: 400, campi: "cliente_id,dal"},
+		{name: "per_pagina eccessivo", metodo: "GET", path: "/veicoli?per_pagina=1000", stato: 400},
+		{name: "dettaglio", metodo: "GET", path: "/veicoli/3", stato: 200},
+		{name: "dettaglio inesistente", metodo: "GET", path: "/veicoli/99", stato: 404},
+		{name: "id non numerico", metodo: "GET", path: "/veicoli/abc", stato: 400},
+		{name: "crea", metodo: "POST", path: "/veicoli", corpo: `{"id": 77, "targa": "CC123DD", "marca": "Opel"}`, stato: 201},
+		{name: "crea non valido", metodo: "POST", path: "/veicoli", corpo: `{"targa": "X"}`, stato: 422, campi: "targa,marca"},
+		{name: "campo sconosciuto", metodo: "POST", path: "/veicoli", corpo: `{"targa": "CC123DD", "colore": "rosso"}`, stato: 400},
+		{name: "corpo vuoto", metodo: "POST", path: "/veicoli", stato: 400},
+		{name: "modifica", metodo: "PUT", path: "/veicoli/2", corpo: `{"targa": "AB002CD", "marca": "Lancia"}`, stato: 200},
+		{name: "modifica id diverso", metodo: "PUT", path: "/veicoli/2", corpo: `{"id": 4, "targa": "AB002CD", "marca": "Lancia"}`, stato: 422, campi: "id"},
+		{name: "modifica inesistente", metodo: "PUT", path: "/veicoli/99", corpo: `{"targa": "AB002CD", "marca": "Lancia"}`, stato: 404},
+		{name: "elimina", metodo: "DELETE", path: "/veicoli/5", stato: 204},
+		{name: "elimina inesistente", metodo: "DELETE", path: "/veicoli/5", stato: 404},
+		{name: "metodo non consentito", metodo: "PATCH", path: "/veicoli/1", stato: 405},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.metodo, ts.URL+Prefisso+tt.path, strings.NewReader(tt.corpo))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.stato {
+				t.Fatalf("stato = %d, atteso %d", resp.StatusCode, tt.stato)
+			}
+
+			switch {
+			case tt.stato >= 400 && tt.stato != 405:
+				var e Errore
+				if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Errore == "" {
+					t.Fatalf("errore non in formato JSON: %v", err)
+				}
+				var campi []string
+				for _, c := range e.Campi {
+					campi = append(campi, c.Campo)
+				}
+				if got := strings.Join(campi, ","); got != tt.campi {
+					t.Errorf("campi = %q, attesi %q", got, tt.campi)
+				}
+			case tt.metodo == "GET" && !strings.Contains(tt.path, "/veicoli/"):
+				var p Pagina[database.Veicolo]
+				if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+					t.Fatal(err)
+				}
+				var targhe []string
+				for _, v := range p.Dati {
+					targhe = append(targhe, v.Targa)
+				}
+				if p.Totale != tt.totale || strings.Join(targhe, ",") != tt.targhe {
+					t.Errorf("totale %d %v, atteso %d %s", p.Totale, targhe, tt.totale, tt.targhe)
+				}
+				if resp.Header.Get("X-Total-Count") != fmt.Sprint(tt.totale) {
+					t.Errorf("X-Total-Count = %q", resp.Header.Get("X-Total-Count"))
+				}
+			}
+		})
+	}
+
+	if v := m.dati[6]; v.Targa != "CC123DD" {
+		t.Errorf("veicolo creato con id %v, atteso 6 (id del corpo ignorato)", m.dati)
+	}
+	if m.dati[2].Marca != "Lancia" {
+		t.Errorf("modifica non salvata: %+v", m.dati[2])
+	}
+}
+
+func TestAccesso(t *testing.T) {
+	operatori := map[string]*database.Operatore{
+		"APP01": {Matricola: "APP01", Ruolo: database.RuoloApprendista},
+		"ACC01": {Matricola: "ACC01", Ruolo: database.RuoloAccettazione},
+	}
+	ts, m := serverDiProva(t, func(s *Server) {
+		// Database senza connessione: basta per aprire le sessioni
+		s.db = &database.DB{}
+		s.accessoRichiesto = func() (bool, error) { return true, nil }
+		s.autentica = func(matricola, credenziale string) (*database.Operatore, error) {
+			if o := operatori[matricola]; o != nil && credenziale == "1234" {
+				return o, nil
+			}
+			return nil, database.ErrCredenzialiNonValide
+		}
+	})
+
+	tests := []struct {
+		name      string
+		metodo    string
+		path      string
+		matricola string
+		password  string
+		stato     int
+	}{
+		{name: "senza credenziali", metodo: "GET", path: "/veicoli", stato: 401},
+		{name: "password errata", metodo: "GET", path: "/veicoli", matricola: "APP01", password: "0000", stato: 401},
+		{name: "apprendista legge", metodo: "GET", path: "/veicoli/1", matricola: "APP01", password: "1234", stato: 200},
+		{name: "apprendista non elimina", metodo: "DELETE", path: "/veicoli/1", matricola: "APP01", password: "1234", stato: 403},
+		{name: "accettazione elimina", metodo: "DELETE", path: "/veicoli/1", matricola: "ACC01", password: "1234", stato: 204},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.metodo, ts.URL+Prefisso+tt.path, nil)
+			if tt.matricola != "" {
+				req.SetBasicAuth(tt.matricola, tt.password)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.stato {
+				t.Fatalf("stato = %d, atteso %d", resp.StatusCode, tt.stato)
+			}
+			if tt.stato == 401 && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("manca WWW-Authenticate")
+			}
+		})
+	}
+
+	// L'unica scrittura riuscita è attribuita all'operatore autenticato
+	if strings.Join(m.autori, ",") != "ACC01" {
+		t.Errorf("scritture attribuite a %q, atteso ACC01", m.autori)
+	}
+}
+
+func TestAccessoNonConfigurato(t *testing.T) {
+	var srv *Server
+	serverDiProva(t, func(s *Server) {
+		s.accessoRichiesto = func() (bool, error) { return false, nil }
+		srv = s
+	})
+
+	tests := []struct {
+		name   string
+		remoto string
+		stato  int
+	}{
+		{"stessa macchina", "127.0.0.1:50000", 200},
+		{"stessa macchina IPv6", "[::1]:50000", 200},
+		{"rete locale", "192.168.1.20:50000", 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", Prefisso+"/veicoli", nil)
+			req.RemoteAddr = tt.remoto
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+			if rec.Code != tt.stato {
+				t.Errorf("stato = %d, atteso %d", rec.Code, tt.stato)
+			}
+		})
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	data, err := OpenAPI("1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != "3.0.3" || doc.Info.Version != "1.2.3" {
+		t.Errorf("intestazione errata: %s %s", doc.OpenAPI, doc.Info.Version)
+	}
+	for _, atteso := range []struct{ path, metodo string }{
+		{"/api/v1/clienti", "get"},
+		{"/api/v1/clienti", "post"},
+		{"/api/v1/clienti/{id}", "put"},
+		{"/api/v1/movimenti/{id}", "delete"},
+		{"/api/v1/clienti/{id}/veicoli", "get"},
+		{"/api/v1/stats/primanota", "get"},
+		{"/api/v1/profilo", "put"},
+		{"/api/v1/openapi.json", "get"},
+	} {
+		if _, ok := doc.Paths[atteso.path][atteso.metodo]; !ok {
+			t.Errorf("manca %s %s", atteso.metodo, atteso.path)
+		}
+	}
+	for _, nome := range []string{"Cliente", "Veicolo", "Commessa", "MovimentoPrimaNota", "ProfiloAzienda", "Errore"} {
+		if _, ok := doc.Components.Schemas[nome]; !ok {
+			t.Errorf("manca lo schema %s", nome)
+		}
+	}
+	if !strings.Contains(string(doc.Components.Schemas["Veicolo"]), `"ultima_rev": {`) {
+		t.Errorf("schema Veicolo senza ultima_rev: %s", doc.Components.Schemas["Veicolo"])
+	}
+}
+
+func TestOperationID(t *testing.T) {
+	for _, tt := range []struct{ metodo, path, want string }{
+		{"GET", "/clienti", "getClienti"},
+		{"PUT", "/clienti/{id}", "putClientiId"},
+		{"GET", "/openapi.json", "getOpenapiJson"},
+	} {
+		if got := operationID(tt.metodo, tt.path); got != tt.want {
+			t.Errorf("operationID(%s %s) = %s, atteso %s", tt.metodo, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"officina/database"
+	"officina/utils"
+)
+
+// validazione raccoglie gli errori di tutti i campi, così che il client
+// possa correggerli in una sola volta
+type validazione []ErroreCampo
+
+func (v *validazione) controlla(campo string, err error) {
+	if err != nil {
+		*v = append(*v, ErroreCampo{Campo: campo, Messaggio: err.Error()})
+	}
+}
+
+// modello aggiunge l'errore del Validate() del modello quando i controlli sui
+// singoli campi sono passati, per non segnalare due volte lo stesso problema
+func (v *validazione) modello(err error) {
+	if err != nil && len(*v) == 0 {
+		*v = append(*v, ErroreCampo{Messaggio: err.Error()})
+	}
+}
+
+// riferimento verifica che l'id collegato esista; id <= 0 indica nessun
+// collegamento ed è controllato altrove se obbligatorio
+func riferimento[T any](v *validazione, campo, nome string, id int, get func(int) (*T, error)) {
+	if id <= 0 {
+		return
+	}
+	if _, err := get(id); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			v.controlla(campo, fmt.Errorf("%s #%d inesistente", nome, id))
+		} else {
+			v.controlla(campo, fmt.Errorf("impossibile verificare %s #%d: %v", nome, id, err))
+		}
+	}
+}
+
+func obbligatorio(id int, nome string) error {
+	if id <= 0 {
+		return fmt.Errorf("%s obbligatorio", nome)
+	}
+	return nil
+}
+
+func dataObbligatoria(t time.Time, nome string) error {
+	if t.IsZero() {
+		return fmt.Errorf("%s obbligatoria", nome)
+	}
+	return nil
+}
+
+// registraEntita espone tutte le collection del database
+func (s *Server) registraEntita() {
+	registraRisorsa(s, risorsa[database.Cliente]{
+		nome: "clienti", ambito: database.RisorsaClienti, singolare: "cliente",
+		list: (*database.DB).ListClienti, get: (*database.DB).GetCliente, create: (*database.DB).CreateCliente,
+		update: (*database.DB).UpdateCliente, delete: (*database.DB).DeleteCliente,
+		id: func(c *database.Cliente) *int { return &c.ID },
+		valida: func(db *database.DB, c *database.Cliente) []ErroreCampo {
+			var v validazione
+			v.controlla("ragione_sociale", utils.ValidateNotEmpty(c.RagioneSociale, "ragione sociale"))
+			validaAnagrafica(&v, c.Email, c.PEC, c.CodiceFiscale, c.PartitaIVA, c.CAP)
+			v.modello(c.Validate())
+			return v
+		},
+		filtri: []filtro[database.Cliente]{
+			filtroTesto("q", "Cerca in ragione sociale, telefono, email e città", func(c *database.Cliente) string {
+				return strings.Join([]string{c.RagioneSociale, c.Telefono, c.Email, c.Citta}, " ")
+			}),
+			filtroUguale("partita_iva", "Partita IVA esatta", func(c *database.Cliente) string { return c.PartitaIVA }),
+			filtroUguale("codice_fiscale", "Codice fiscale esatto", func(c *database.Cliente) string { return c.CodiceFiscale }),
+			filtroUguale("provincia", "Sigla provincia", func(c *database.Cliente) string { return c.Provincia }),
+		},
+	})
+
+	registraRisorsa(s, risorsa[database.Fornitore]{
+		nome: "fornitori", ambito: database.RisorsaFornitori, singolare: "fornitore",
+		list: (*database.DB).ListFornitori, get: (*database.DB).GetFornitore, create: (*database.DB).CreateFornitore,
+		update: (*database.DB).UpdateFornitore, delete: (*database.DB).DeleteFornitore,
+		id: func(f *database.Fornitore) *int { return &f.ID },
+		valida: func(db *database.DB, f *database.Fornitore) []ErroreCampo {
+			var v validazione
+			v.controlla("ragione_sociale", utils.ValidateNotEmpty(f.RagioneSociale, "ragione sociale"))
+			validaAnagrafica(&v, f.Email, f.PEC, f.CodiceFiscale, f.PartitaIVA, f.CAP)
+			v.modello(f.Validate())
+			return v
+		},
+		filtri: []filtro[database.Fornitore]{
+			filtroTesto("q", "Cerca in ragione sociale, telefono, email e città", func(f *database.Fornitore) string {
+				return strings.Join([]string{f.RagioneSociale, f.Telefono, f.Email, f.Citta}, " ")
+			}),
+			filtroUguale("partita_iva", "Partita IVA esatta", func(f *database.Fornitore) string { return f.PartitaIVA }),
+		},
+	})
+
+	registraRisorsa(s, risorsa[database.Veicolo]{
+		nome: "veicoli", ambito: database.RisorsaVeicoli, singolare: "veicolo",
+		list: (*database.DB).ListVeicoli, get: (*database.DB).GetVeicolo, create: (*database.DB).CreateVeicolo,
+		update: (*database.DB).UpdateVeicolo, delete: (*database.DB).DeleteVeicolo,
+		id: func(v *database.Veicolo) *int { return &v.ID },
+		valida: func(db *database.DB, ve *database.Veicolo) []ErroreCampo {
+			var v validazione
+			v.controlla("targa", utils.ValidateTarga(ve.Targa))
+			v.controlla("marca", utils.ValidateNotEmpty(ve.Marca, "marca"))
+			v.controlla("modello", utils.ValidateNotEmpty(ve.Modello, "modello"))
+			v.controlla("cliente_id", obbligatorio(ve.ClienteID, "cliente"))
+			riferimento(&v, "cliente_id", "cliente", ve.ClienteID, db.GetCliente)
+			v.modello(ve.Validate())
+			return v
+		},
+		filtri: []filtro[database.Veicolo]{
+			filtroTesto("q", "Cerca in targa, marca e modello", func(v *database.Veicolo) string {
+				return strings.Join([]string{v.Targa, v.Marca, v.Modello}, " ")
+			}),
+			filtroUguale("targa", "Targa esatta", func(v *database.Veicolo) string { return v.Targa }),
+			filtroID("cliente_id", "Veicoli del cliente", func(v *database.Veicolo) int { return v.ClienteID }),
+		},
+	})
+
+	registraRisorsa(s, risorsa[database.Commessa]{
+		nome: "commesse", ambito: database.RisorsaCommesse, singolare: "commessa",
+		list: (*database.DB).ListCommesse, get: (*database.DB).GetCommessa, create: (*database.DB).CreateCommessa,
+		update: (*database.DB).UpdateCommessa, delete: (*database.DB).DeleteCommessa,
+		id: func(c *database.Commessa) *int { return &c.ID },
+		valida: func(db *database.DB, c *database.Commessa) []ErroreCampo {
+			var v validazione
+			v.controlla("veicolo_id", obbligatorio(c.VeicoloID, "veicolo"))
+			riferimento(&v, "veicolo_id", "veicolo", c.VeicoloID, db.GetVeicolo)
+			if c.Stato == database.StatoCommessaChiusa {
+				v.controlla("data_chiusura", dataObbligatoria(c.DataChiusura, "data di chiusura"))
+			}
+			v.modello(c.Validate())
+			return v
+		},
+		filtri: append([]filtro[database.Commessa]{
+			filtroTesto("q", "Cerca in numero, lavori eseguiti e note", func(c *database.Commessa) string {
+				return strings.Join([]string{c.Numero, c.LavoriEseguiti, c.Note}, " ")
+			}),
+			filtroUguale("stato", "Aperta o Chiusa", func(c *database.Commessa) string { return c.Stato }),
+			filtroID("veicolo_id", "Commesse del veicolo", func(c *database.Commessa) int { return c.VeicoloID }),
+		}, filtriPeriodo(func(c *database.Commessa) time.Time { return c.DataApertura })...),
+	})
+
+	registraRisorsa(s, risorsa[database.Appuntamento]{
+		nome: "appuntamenti", ambito: database.RisorsaAppuntamenti, singolare: "appuntamento",
+		list: (*database.DB).ListAppuntamenti, get: (*database.DB).GetAppuntamento, create: (*database.DB).CreateAppuntamento,
+		update: (*database.DB).UpdateAppuntamento, delete: (*database.DB).DeleteAppuntamento,
+		id: func(a *database.Appuntamento) *int { return &a.ID },
+		valida: func(db *database.DB, a *database.Appuntamento) []ErroreCampo {
+			var v validazione
+			v.controlla("data_ora", dataObbligatoria(a.DataOra, "data e ora"))
+			riferimento(&v, "veicolo_id", "veicolo", a.VeicoloID, db.GetVeicolo)
+			return v
+		},
+		filtri: append([]filtro[database.Appuntamento]{
+			filtroID("veicolo_id", "Appuntamenti del veicolo", func(a *database.Appuntamento) int { return a.VeicoloID }),
+		}, filtriPeriodo(func(a *database.Appuntamento) time.Time { return a.DataOra })...),
+	})
+
+	registraRisorsa(s, risorsa[database.Operatore]{
+		nome: "operatori", ambito: database.RisorsaOperatori, singolare: "operatore",
+		list: (*database.DB).ListOperatori, get: (*database.DB).GetOperatore, create: (*database.DB).CreateOperatore,
+		update: (*database.DB).UpdateOperatore, delete: (*database.DB).DeleteOperatore,
+		id: func(o *database.Operatore) *int { return &o.ID },
+		valida: func(db *database.DB, o *database.Operatore) []ErroreCampo {
+			var v validazione
+			v.controlla("matricola", utils.ValidateNotEmpty(o.Matricola, "matricola"))
+			v.controlla("nome", utils.ValidateNotEmpty(o.Nome, "nome"))
+			v.controlla("cognome", utils.ValidateNotEmpty(o.Cognome, "cognome"))
+			v.controlla("ruolo", utils.ValidateNotEmpty(o.Ruolo, "ruolo"))
+			return v
+		},
+		filtri: []filtro[database.Operatore]{
+			filtroTesto("q", "Cerca in matricola, nome e cognome", func(o *database.Operatore) string {
+				return strings.Join([]string{o.Matricola, o.Nome, o.Cognome}, " ")
+			}),
+			filtroUguale("ruolo", "Ruolo esatto", func(o *database.Operatore) string { return o.Ruolo }),
+		},
+	})
+
+	registraRisorsa(s, risorsa[database.Preventivo]{
+		nome: "preventivi", ambito: database.RisorsaPreventivi, singolare: "preventivo",
+		list: (*database.DB).ListPreventivi, get: (*database.DB).GetPreventivo, create: (*database.DB).CreatePreventivo,
+		update: (*database.DB).UpdatePreventivo, delete: (*database.DB).DeletePreventivo,
+		id: func(p *database.Preventivo) *int { return &p.ID },
+		valida: func(db *database.DB, p *database.Preventivo) []ErroreCampo {
+			var v validazione
+			v.controlla("numero", utils.ValidateNotEmpty(p.Numero, "numero"))
+			v.controlla("cliente", utils.ValidateNotEmpty(p.Cliente, "cliente"))
+			v.controlla("totale", utils.ValidateImportoPositivo(p.Totale))
+			return v
+		},
+		filtri: append([]filtro[database.Preventivo]{
+			filtroTesto("q", "Cerca in numero, cliente e descrizione", func(p *database.Preventivo) string {
+				return strings.Join([]string{p.Numero, p.Cliente, p.Descrizione}, " ")
+			}),
+			filtroBool("accettato", "Solo preventivi accettati (true) o in attesa (false)", func(p *database.Preventivo) bool { return p.Accettato }),
+		}, filtriPeriodo(func(p *database.Preventivo) time.Time { return p.Data })...),
+	})
+
+	registraRisorsa(s, risorsa[database.Fattura]{
+		nome: "fatture", ambito: database.RisorsaFatture, singolare: "fattura",
+		list: (*database.DB).ListFatture, get: (*database.DB).GetFattura, create: (*database.DB).CreateFattura,
+		update: (*database.DB).UpdateFattura, delete: (*database.DB).DeleteFattura,
+		id: func(f *database.Fattura) *int { return &f.ID },
+		valida: func(db *database.DB, f *database.Fattura) []ErroreCampo {
+			var v validazione
+			// Il numero è assegnato dalla numerazione alla creazione
+			v.controlla("data", dataObbligatoria(f.Data, "data"))
+			v.controlla("cliente_id", obbligatorio(f.ClienteID, "cliente"))
+			riferimento(&v, "cliente_id", "cliente", f.ClienteID, db.GetCliente)
+			if f.RiferimentoID > 0 {
+				riferimento(&v, "riferimento_id", "fattura", f.RiferimentoID, db.GetFattura)
+			}
+			for i, id := range f.Commesse {
+				riferimento(&v, fmt.Sprintf("commesse[%d]", i), "commessa", id, db.GetCommessa)
+			}
+			for i, r := range f.Righe {
+				v.controlla(fmt.Sprintf("righe[%d]", i), r.Validate())
+			}
+			if len(f.Righe) == 0 {
+				v.controlla("importo", utils.ValidateImportoPositivo(f.Importo))
+			}
+			// I totali sono ricalcolati dalle righe al salvataggio
+			calcolata := *f
+			calcolata.Calcola()
+			v.modello(calcolata.Validate())
+			return v
+		},
+		filtri: append([]filtro[database.Fattura]{
+			filtroUguale("numero", "Numero fattura esatto", func(f *database.Fattura) string { return f.Numero }),
+			filtroUguale("sezionale", "Fatture del sezionale", func(f *database.Fattura) string { return f.Sezionale }),
+			filtroUguale("tipo", "Tipo documento (TD01, TD04, TD24, PROFORMA)", func(f *database.Fattura) string { return f.TipoDocumento() }),
+			filtroID("riferimento_id", "Note di credito della fattura", func(f *database.Fattura) int { return f.RiferimentoID }),
+			filtroID("cliente_id", "Fatture del cliente", func(f *database.Fattura) int { return f.ClienteID }),
+			filtroIDs("commessa_id", "Documenti che fatturano la commessa", func(f *database.Fattura) []int { return f.Commesse }),
+		}, filtriPeriodo(func(f *database.Fattura) time.Time { return f.Data })...),
+	})
+
+	registraRisorsa(s, risorsa[database.MovimentoPrimaNota]{
+		nome: "movimenti", ambito: database.RisorsaMovimenti, singolare: "movimento",
+		list: func(db *database.DB) ([]database.MovimentoPrimaNota, error) { return db.ListMovimentiPrimaNota(nil) },
+		get:  (*database.DB).GetMovimentoPrimaNota, create: (*database.DB).CreateMovimentoPrimaNota,
+		update: (*database.DB).UpdateMovimentoPrimaNota, delete: (*database.DB).DeleteMovimentoPrimaNota,
+		id: func(m *database.MovimentoPrimaNota) *int { return &m.ID },
+		valida: func(db *database.DB, m *database.MovimentoPrimaNota) []ErroreCampo {
+			var v validazione
+			v.controlla("data", dataObbligatoria(m.Data, "data"))
+			v.controlla("descrizione", utils.ValidateNotEmpty(m.Descrizione, "descrizione"))
+			v.controlla("importo", utils.ValidateImportoPositivo(m.Importo))
+			riferimento(&v, "commessa_id", "commessa", m.CommessaID, db.GetCommessa)
+			riferimento(&v, "fornitore_id", "fornitore", m.FornitoreID, db.GetFornitore)
+			riferimento(&v, "fattura_id", "fattura", m.FatturaID, db.GetFattura)
+			v.modello(m.Validate())
+			return v
+		},
+		filtri: append([]filtro[database.MovimentoPrimaNota]{
+			filtroTesto("q", "Cerca in descrizione e numero fattura", func(m *database.MovimentoPrimaNota) string {
+				return m.Descrizione + " " + m.NumeroFattura
+			}),
+			filtroUguale("tipo", "Entrata o Uscita", func(m *database.MovimentoPrimaNota) string { return m.Tipo }),
+			filtroUguale("metodo", "Metodo di pagamento", func(m *database.MovimentoPrimaNota) string { return m.Metodo }),
+			filtroID("commessa_id", "Movimenti della commessa", func(m *database.MovimentoPrimaNota) int { return m.CommessaID }),
+			filtroID("fornitore_id", "Movimenti del fornitore", func(m *database.MovimentoPrimaNota) int { return m.FornitoreID }),
+			filtroID("fattura_id", "Incassi della fattura", func(m *database.MovimentoPrimaNota) int { return m.FatturaID }),
+		}, filtriPeriodo(func(m *database.MovimentoPrimaNota) time.Time { return m.Data })...),
+	})
+}
+
+// validaAnagrafica controlla i campi comuni a clienti e fornitori
+func validaAnagrafica(v *validazione, email, pec, cf, piva, cap string) {
+	v.controlla("email", utils.ValidateEmail(email))
+	v.controlla("pec", utils.ValidateEmail(pec))
+	v.controlla("codice_fiscale", utils.ValidateCodiceFiscale(cf))
+	v.controlla("partita_iva", utils.ValidatePartitaIVA(piva))
+	v.controlla("cap", utils.ValidateCAP(cap))
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"officina/database"
+)
+
+// operazione descrive una rotta per il documento OpenAPI
+type operazione struct {
+	metodo    string
+	path      string // relativo a Prefisso, con parametri {nome}
+	tag       string
+	sommario  string
+	parametri []parametro  // parametri di query
+	corpo     reflect.Type // schema del corpo della richiesta, se presente
+	risposta  reflect.Type // schema della risposta, nil se senza corpo
+	lista     bool         // risposta paginata (Pagina di risposta)
+	successo  int          // stato HTTP di successo, 200 se zero
+
+	risorsa  string            // risorsa dei permessi (database.Risorsa*)
+	permesso database.Permesso // permesso richiesto sulla risorsa
+	pubblica bool              // accessibile senza autenticazione
+}
+
+// parametro è un parametro di query di un'operazione
+type parametro struct {
+	nome        string
+	tipo        string
+	formato     string
+	descrizione string
+}
+
+// tipoLibero indica una risposta JSON senza schema fisso
+var tipoLibero = reflect.TypeOf(map[string]any{})
+
+var (
+	tipoTime          = reflect.TypeOf(time.Time{})
+	parametroPercorso = regexp.MustCompile(`\{(\w+)\}`)
+)
+
+// OpenAPI genera il documento OpenAPI 3 dell'API senza bisogno del database
+func OpenAPI(version string) ([]byte, error) {
+	return json.MarshalIndent(NewServer(nil, version).documento(), "", "  ")
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, req *http.Request) {
+	scriviJSON(w, http.StatusOK, s.documento())
+}
+
+// documento costruisce il documento OpenAPI dalle rotte registrate
+func (s *Server) documento() map[string]any {
+	schemi := map[string]any{
+		"Errore": schemaErrore(),
+	}
+	paths := make(map[string]map[string]any)
+
+	for _, op := range s.operazioni {
+		path := Prefisso + op.path
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(op.metodo)] = op.openapi(schemi)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Officina API",
+			"version":     s.version,
+			"description": "API REST del gestionale officina. Gli elenchi sono paginati con pagina/per_pagina; gli errori hanno sempre la forma {errore, campi}.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemi,
+			"securitySchemes": map[string]any{
+				"operatore": map[string]any{
+					"type": "http", "scheme": "basic",
+					"description": "Matricola e password o PIN dell'operatore; richiesto solo se almeno un operatore ha una credenziale",
+				},
+			},
+		},
+		"security": []any{map[string]any{"operatore": []string{}}},
+	}
+}
+
+func (op operazione) openapi(schemi map[string]any) map[string]any {
+	o := map[string]any{
+		"summary":     op.sommario,
+		"operationId": operationID(op.metodo, op.path),
+		"tags":        []string{op.tag},
+	}
+
+	var params []any
+	for _, m := range parametroPercorso.FindAllStringSubmatch(op.path, -1) {
+		params = append(params, map[string]any{
+			"name": m[1], "in": "path", "required": true,
+			"schema": map[string]any{"type": "integer", "minimum": 1},
+		})
+	}
+	for _, p := range op.parametri {
+		schema := map[string]any{"type": p.tipo}
+		if p.formato != "" {
+			schema["format"] = p.formato
+		}
+		params = append(params, map[string]any{
+			"name": p.nome, "in": "query", "description": p.descrizione, "schema": schema,
+		})
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+
+	if op.corpo != nil {
+		o["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": schemaTipo(op.corpo, schemi)}},
+		}
+	}
+
+	risposte := map[string]any{}
+	successo := op.successo
+	if successo == 0 {
+		successo = http.StatusOK
+	}
+	ok := map[string]any{"description": http.StatusText(successo)}
+	if op.risposta != nil {
+		schema := schemaTipo(op.risposta, schemi)
+		if op.lista {
+			schema = schemaPagina(schema)
+		}
+		ok["content"] = map[string]any{"application/json": map[string]any{"schema": schema}}
+	}
+	risposte[fmt.Sprint(successo)] = ok
+
+	errore := func(stato int, descrizione string) {
+		risposte[fmt.Sprint(stato)] = map[string]any{
+			"description": descrizione,
+			"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Errore"}}},
+		}
+	}
+	if len(params) > 0 || op.corpo != nil {
+		errore(http.StatusBadRequest, "Richiesta non valida")
+	}
+	if strings.Contains(op.path, "{") {
+		errore(http.StatusNotFound, "Record non trovato")
+	}
+	if op.corpo != nil {
+		errore(http.StatusUnprocessableEntity, "Errori di validazione")
+	}
+	if op.pubblica {
+		o["security"] = []any{}
+	} else {
+		errore(http.StatusUnauthorized, "Autenticazione richiesta o credenziali non valide")
+		errore(http.StatusForbidden, "Operazione non consentita al ruolo dell'operatore")
+	}
+	errore(http.StatusInternalServerError, "Errore interno")
+	o["responses"] = risposte
+
+	return o
+}
+
+// operationID deriva un identificativo univoco da metodo e percorso:
+// GET /clienti/{id} → getClientiId
+func operationID(metodo, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(metodo))
+	for _, parte := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '{' || r == '}' || r == '.' }) {
+		b.WriteString(strings.ToUpper(parte[:1]) + parte[1:])
+	}
+	return b.String()
+}
+
+// schemaTipo converte un tipo Go nello schema OpenAPI corrispondente; gli
+// struct sono aggiunti a schemi e referenziati per nome
+func schemaTipo(t reflect.Type, schemi map[string]any) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == tipoTime {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaTipo(t.Elem(), schemi)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaTipo(t.Elem(), schemi)}
+	case reflect.Struct:
+		nome := t.Name()
+		if _, ok := schemi[nome]; !ok {
+			schemi[nome] = nil // evita la ricorsione sui tipi che si riferiscono a sé stessi
+			schemi[nome] = schemaStruct(t, schemi)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + nome}
+	default:
+		return map[string]any{}
+	}
+}
+
+func schemaStruct(t reflect.Type, schemi map[string]any) map[string]any {
+	proprieta := make(map[string]any)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		nome := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			nome, _, _ = strings.Cut(tag, ",")
+			if nome == "-" {
+				continue
+			}
+			if nome == "" {
+				nome = f.Name
+			}
+		}
+		schema := schemaTipo(f.Type, schemi)
+		if nome == "id" {
+			schema = map[string]any{"type": "integer", "readOnly": true, "description": "Assegnato dal database"}
+		}
+		proprieta[nome] = schema
+	}
+	return map[string]any{"type": "object", "properties": proprieta}
+}
+
+func schemaPagina(dati map[string]any) map[string]any {
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"dati", "pagina", "per_pagina", "totale"},
+		"properties": map[string]any{
+			"dati":       map[string]any{"type": "array", "items": dati},
+			"pagina":     map[string]any{"type": "integer"},
+			"per_pagina": map[string]any{"type": "integer"},
+			"totale":     map[string]any{"type": "integer", "description": "Numero di record dopo i filtri (anche nell'header X-Total-Count)"},
+		},
+	}
+}
+
+func schemaErrore() map[string]any {
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"errore"},
+		"properties": map[string]any{
+			"errore": map[string]any{"type": "string"},
+			"campi": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"campo":     map[string]any{"type": "string"},
+						"messaggio": map[string]any{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+}
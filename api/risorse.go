@@ -0,0 +1,488 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"officina/database"
+)
+
+// Paginazione predefinita degli elenchi
+const (
+	perPaginaDefault = 50
+	perPaginaMax     = 500
+)
+
+// ErroreCampo descrive un problema di validazione su un singolo campo
+type ErroreCampo struct {
+	Campo     string `json:"campo,omitempty"`
+	Messaggio string `json:"messaggio"`
+}
+
+// Errore è il corpo delle risposte di errore
+type Errore struct {
+	Errore string        `json:"errore"`
+	Campi  []ErroreCampo `json:"campi,omitempty"`
+}
+
+// Pagina è il corpo delle risposte di elenco
+type Pagina[T any] struct {
+	Dati      []T `json:"dati"`
+	Pagina    int `json:"pagina"`
+	PerPagina int `json:"per_pagina"`
+	Totale    int `json:"totale"`
+}
+
+// filtro è un parametro di query accettato da un elenco. crea interpreta
+// il valore una sola volta e restituisce il predicato da applicare ai record.
+type filtro[T any] struct {
+	nome        string
+	tipo        string // tipo OpenAPI del parametro: string, integer, boolean
+	formato     string // formato OpenAPI, es. date
+	descrizione string
+	crea        func(valore string) (func(*T) bool, error)
+}
+
+// risorsa collega una collection del database alle rotte REST standard; le
+// operazioni ricevono la sessione della richiesta (sessioneRichiesta)
+type risorsa[T any] struct {
+	nome      string // segmento di percorso, es. "clienti"
+	singolare string // usato nei messaggi, es. "cliente"
+	list      func(db *database.DB) ([]T, error)
+	get       func(db *database.DB, id int) (*T, error)
+	create    func(db *database.DB, v *T) error
+	update    func(db *database.DB, v *T) error
+	delete    func(db *database.DB, id int) error
+	id        func(*T) *int
+	valida    func(db *database.DB, v *T) []ErroreCampo
+	filtri    []filtro[T]
+	ambito    string // risorsa dei permessi (database.Risorsa*)
+}
+
+// registraRisorsa aggiunge al server le rotte elenco, dettaglio, creazione,
+// modifica ed eliminazione di r
+func registraRisorsa[T any](s *Server, r risorsa[T]) {
+	tipo := reflect.TypeOf((*T)(nil)).Elem()
+	base := "/" + r.nome
+	dettaglio := base + "/{id}"
+
+	parametri := parametriPaginazione()
+	for _, f := range r.filtri {
+		parametri = append(parametri, parametro{nome: f.nome, tipo: f.tipo, formato: f.formato, descrizione: f.descrizione})
+	}
+
+	s.route(operazione{
+		metodo: http.MethodGet, path: base, tag: r.nome,
+		sommario: "Elenco " + r.nome, parametri: parametri, risposta: tipo, lista: true,
+		risorsa: r.ambito, permesso: database.PermessoVedi,
+	}, r.handleList)
+	s.route(operazione{
+		metodo: http.MethodGet, path: dettaglio, tag: r.nome,
+		sommario: "Dettaglio " + r.singolare, risposta: tipo,
+		risorsa: r.ambito, permesso: database.PermessoVedi,
+	}, r.handleGet)
+	s.route(operazione{
+		metodo: http.MethodPost, path: base, tag: r.nome,
+		sommario: "Crea " + r.singolare, corpo: tipo, risposta: tipo, successo: http.StatusCreated,
+		risorsa: r.ambito, permesso: database.PermessoCrea,
+	}, r.handleCreate)
+	s.route(operazione{
+		metodo: http.MethodPut, path: dettaglio, tag: r.nome,
+		sommario: "Modifica " + r.singolare, corpo: tipo, risposta: tipo,
+		risorsa: r.ambito, permesso: database.PermessoModifica,
+	}, r.handleUpdate)
+	s.route(operazione{
+		metodo: http.MethodDelete, path: dettaglio, tag: r.nome,
+		sommario: "Elimina " + r.singolare, successo: http.StatusNoContent,
+		risorsa: r.ambito, permesso: database.PermessoElimina,
+	}, r.handleDelete)
+}
+
+func (r risorsa[T]) handleList(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+
+	pagina, perPagina, err := leggiPaginazione(q)
+	if err != nil {
+		scriviErrore(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	predicati, campi := r.leggiFiltri(q)
+	if len(campi) > 0 {
+		scriviErroreCampi(w, http.StatusBadRequest, "parametri di query non validi", campi)
+		return
+	}
+
+	tutti, err := r.list(sessioneRichiesta(req))
+	if err != nil {
+		scriviErrore(w, http.StatusInternalServerError, fmt.Sprintf("errore lettura %s: %v", r.nome, err))
+		return
+	}
+
+	p := impagina(filtra(tutti, predicati), r.id, pagina, perPagina)
+	w.Header().Set("X-Total-Count", strconv.Itoa(p.Totale))
+	scriviJSON(w, http.StatusOK, p)
+}
+
+// leggiFiltri interpreta i filtri della query; i parametri sconosciuti sono
+// segnalati come errore per evitare elenchi silenziosamente non filtrati
+func (r risorsa[T]) leggiFiltri(q map[string][]string) ([]func(*T) bool, []ErroreCampo) {
+	var predicati []func(*T) bool
+	var campi []ErroreCampo
+
+	nomi := make([]string, 0, len(q))
+	for nome := range q {
+		nomi = append(nomi, nome)
+	}
+	sort.Strings(nomi)
+
+	for _, nome := range nomi {
+		if nome == "pagina" || nome == "per_pagina" {
+			continue
+		}
+		f, ok := r.filtro(nome)
+		if !ok {
+			campi = append(campi, ErroreCampo{Campo: nome, Messaggio: "filtro sconosciuto"})
+			continue
+		}
+		p, err := f.crea(q[nome][0])
+		if err != nil {
+			campi = append(campi, ErroreCampo{Campo: nome, Messaggio: err.Error()})
+			continue
+		}
+		predicati = append(predicati, p)
+	}
+	return predicati, campi
+}
+
+func (r risorsa[T]) filtro(nome string) (filtro[T], bool) {
+	for _, f := range r.filtri {
+		if f.nome == nome {
+			return f, true
+		}
+	}
+	return filtro[T]{}, false
+}
+
+func (r risorsa[T]) handleGet(w http.ResponseWriter, req *http.Request) {
+	id, ok := leggiID(w, req)
+	if !ok {
+		return
+	}
+
+	v, err := r.get(sessioneRichiesta(req), id)
+	if err != nil {
+		r.scriviErroreLettura(w, id, err)
+		return
+	}
+	scriviJSON(w, http.StatusOK, v)
+}
+
+func (r risorsa[T]) handleCreate(w http.ResponseWriter, req *http.Request) {
+	var v T
+	if !leggiCorpo(w, req, &v) {
+		return
+	}
+	*r.id(&v) = 0 // l'id è assegnato dal database
+
+	db := sessioneRichiesta(req)
+	if campi := r.valida(db, &v); len(campi) > 0 {
+		scriviErroreCampi(w, http.StatusUnprocessableEntity, r.singolare+" non valido", campi)
+		return
+	}
+	if err := r.create(db, &v); err != nil {
+		scriviErrore(w, http.StatusInternalServerError, fmt.Sprintf("errore creazione %s: %v", r.singolare, err))
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%s/%d", Prefisso, r.nome, *r.id(&v)))
+	scriviJSON(w, http.StatusCreated, &v)
+}
+
+func (r risorsa[T]) handleUpdate(w http.ResponseWriter, req *http.Request) {
+	id, ok := leggiID(w, req)
+	if !ok {
+		return
+	}
+
+	var v T
+	if !leggiCorpo(w, req, &v) {
+		return
+	}
+	if corpoID := *r.id(&v); corpoID != 0 && corpoID != id {
+		scriviErroreCampi(w, http.StatusUnprocessableEntity, r.singolare+" non valido",
+			[]ErroreCampo{{Campo: "id", Messaggio: fmt.Sprintf("diverso dall'id nel percorso (%d)", id)}})
+		return
+	}
+	*r.id(&v) = id
+
+	db := sessioneRichiesta(req)
+	if _, err := r.get(db, id); err != nil {
+		r.scriviErroreLettura(w, id, err)
+		return
+	}
+	if campi := r.valida(db, &v); len(campi) > 0 {
+		scriviErroreCampi(w, http.StatusUnprocessableEntity, r.singolare+" non valido", campi)
+		return
+	}
+	if err := r.update(db, &v); err != nil {
+		scriviErrore(w, http.StatusInternalServerError, fmt.Sprintf("errore aggiornamento %s: %v", r.singolare, err))
+		return
+	}
+
+	// Rilegge il record per restituire i campi calcolati dal database
+	if aggiornato, err := r.get(db, id); err == nil {
+		v = *aggiornato
+	}
+	scriviJSON(w, http.StatusOK, &v)
+}
+
+func (r risorsa[T]) handleDelete(w http.ResponseWriter, req *http.Request) {
+	id, ok := leggiID(w, req)
+	if !ok {
+		return
+	}
+
+	db := sessioneRichiesta(req)
+	if _, err := r.get(db, id); err != nil {
+		r.scriviErroreLettura(w, id, err)
+		return
+	}
+	if err := r.delete(db, id); err != nil {
+		scriviErrore(w, http.StatusInternalServerError, fmt.Sprintf("errore eliminazione %s: %v", r.singolare, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scriviErroreLettura distingue un record inesistente (404) da un errore
+// del database (500)
+func (r risorsa[T]) scriviErroreLettura(w http.ResponseWriter, id int, err error) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		scriviErrore(w, http.StatusNotFound, fmt.Sprintf("%s #%d non trovato", r.singolare, id))
+		return
+	}
+	scriviErrore(w, http.StatusInternalServerError, fmt.Sprintf("errore lettura %s #%d: %v", r.singolare, id, err))
+}
+
+// ==================== FILTRI ====================
+
+// filtroTesto seleziona i record in cui il campo contiene il valore
+// (senza distinzione tra maiuscole e minuscole)
+func filtroTesto[T any](nome, descrizione string, campo func(*T) string) filtro[T] {
+	return filtro[T]{
+		nome: nome, tipo: "string", descrizione: descrizione,
+		crea: func(valore string) (func(*T) bool, error) {
+			valore = strings.ToLower(strings.TrimSpace(valore))
+			return func(v *T) bool { return strings.Contains(strings.ToLower(campo(v)), valore) }, nil
+		},
+	}
+}
+
+// filtroUguale seleziona i record in cui il campo coincide con il valore
+// (senza distinzione tra maiuscole e minuscole)
+func filtroUguale[T any](nome, descrizione string, campo func(*T) string) filtro[T] {
+	return filtro[T]{
+		nome: nome, tipo: "string", descrizione: descrizione,
+		crea: func(valore string) (func(*T) bool, error) {
+			valore = strings.TrimSpace(valore)
+			return func(v *T) bool { return strings.EqualFold(campo(v), valore) }, nil
+		},
+	}
+}
+
+// filtroID seleziona i record collegati all'id indicato
+func filtroID[T any](nome, descrizione string, campo func(*T) int) filtro[T] {
+	return filtro[T]{
+		nome: nome, tipo: "integer", descrizione: descrizione,
+		crea: func(valore string) (func(*T) bool, error) {
+			id, err := strconv.Atoi(strings.TrimSpace(valore))
+			if err != nil {
+				return nil, fmt.Errorf("deve essere un numero intero")
+			}
+			return func(v *T) bool { return campo(v) == id }, nil
+		},
+	}
+}
+
+// filtroIDs seleziona i record che fanno riferimento all'id indicato in un
+// elenco di id
+func filtroIDs[T any](nome, descrizione string, campo func(*T) []int) filtro[T] {
+	return filtro[T]{
+		nome: nome, tipo: "integer", descrizione: descrizione,
+		crea: func(valore string) (func(*T) bool, error) {
+			id, err := strconv.Atoi(strings.TrimSpace(valore))
+			if err != nil {
+				return nil, fmt.Errorf("deve essere un numero intero")
+			}
+			return func(v *T) bool { return slices.Contains(campo(v), id) }, nil
+		},
+	}
+}
+
+// filtroBool seleziona i record con il flag indicato (true/false)
+func filtroBool[T any](nome, descrizione string, campo func(*T) bool) filtro[T] {
+	return filtro[T]{
+		nome: nome, tipo: "boolean", descrizione: descrizione,
+		crea: func(valore string) (func(*T) bool, error) {
+			b, err := strconv.ParseBool(strings.TrimSpace(valore))
+			if err != nil {
+				return nil, fmt.Errorf("deve essere true o false")
+			}
+			return func(v *T) bool { return campo(v) == b }, nil
+		},
+	}
+}
+
+// filtriPeriodo restituisce i filtri dal/al (AAAA-MM-GG, estremi inclusi)
+// sulla data del record
+func filtriPeriodo[T any](campo func(*T) time.Time) []filtro[T] {
+	crea := func(dal bool) func(string) (func(*T) bool, error) {
+		return func(valore string) (func(*T) bool, error) {
+			giorno, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(valore), time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("data non valida (formato AAAA-MM-GG)")
+			}
+			if dal {
+				return func(v *T) bool { return !campo(v).Before(giorno) }, nil
+			}
+			fine := giorno.AddDate(0, 0, 1)
+			return func(v *T) bool { return campo(v).Before(fine) }, nil
+		}
+	}
+	return []filtro[T]{
+		{nome: "dal", tipo: "string", formato: "date", descrizione: "Data iniziale inclusa (AAAA-MM-GG)", crea: crea(true)},
+		{nome: "al", tipo: "string", formato: "date", descrizione: "Data finale inclusa (AAAA-MM-GG)", crea: crea(false)},
+	}
+}
+
+func filtra[T any](tutti []T, predicati []func(*T) bool) []T {
+	if len(predicati) == 0 {
+		return tutti
+	}
+	out := make([]T, 0, len(tutti))
+	for i := range tutti {
+		ok := true
+		for _, p := range predicati {
+			if !p(&tutti[i]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			out = append(out, tutti[i])
+		}
+	}
+	return out
+}
+
+// ==================== PAGINAZIONE ====================
+
+func parametriPaginazione() []parametro {
+	return []parametro{
+		{nome: "pagina", tipo: "integer", descrizione: "Numero di pagina, da 1"},
+		{nome: "per_pagina", tipo: "integer", descrizione: fmt.Sprintf("Elementi per pagina (predefinito %d, massimo %d)", perPaginaDefault, perPaginaMax)},
+	}
+}
+
+func leggiPaginazione(q map[string][]string) (pagina, perPagina int, err error) {
+	pagina, perPagina = 1, perPaginaDefault
+
+	if v := first(q["pagina"]); v != "" {
+		if pagina, err = strconv.Atoi(v); err != nil || pagina < 1 {
+			return 0, 0, fmt.Errorf("pagina deve essere un numero maggiore di zero")
+		}
+	}
+	if v := first(q["per_pagina"]); v != "" {
+		if perPagina, err = strconv.Atoi(v); err != nil || perPagina < 1 || perPagina > perPaginaMax {
+			return 0, 0, fmt.Errorf("per_pagina deve essere compreso tra 1 e %d", perPaginaMax)
+		}
+	}
+	return pagina, perPagina, nil
+}
+
+// impagina ordina per id, così che le pagine siano stabili tra una richiesta
+// e l'altra, e restituisce la pagina richiesta
+func impagina[T any](tutti []T, id func(*T) *int, pagina, perPagina int) Pagina[T] {
+	sort.SliceStable(tutti, func(i, j int) bool { return *id(&tutti[i]) < *id(&tutti[j]) })
+
+	inizio := (pagina - 1) * perPagina
+	if inizio > len(tutti) {
+		inizio = len(tutti)
+	}
+	fine := inizio + perPagina
+	if fine > len(tutti) {
+		fine = len(tutti)
+	}
+
+	dati := tutti[inizio:fine]
+	if dati == nil {
+		dati = []T{}
+	}
+	return Pagina[T]{Dati: dati, Pagina: pagina, PerPagina: perPagina, Totale: len(tutti)}
+}
+
+func first(v []string) string {
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// ==================== RICHIESTE E RISPOSTE ====================
+
+func leggiID(w http.ResponseWriter, req *http.Request) (int, bool) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil || id <= 0 {
+		scriviErrore(w, http.StatusBadRequest, fmt.Sprintf("id non valido: %q", req.PathValue("id")))
+		return 0, false
+	}
+	return id, true
+}
+
+// leggiCorpo decodifica il JSON della richiesta rifiutando campi sconosciuti
+func leggiCorpo(w http.ResponseWriter, req *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxCorpo))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		msg := "JSON non valido: " + err.Error()
+		if errors.Is(err, io.EOF) {
+			msg = "corpo della richiesta vuoto"
+		}
+		scriviErrore(w, http.StatusBadRequest, msg)
+		return false
+	}
+	if dec.More() {
+		scriviErrore(w, http.StatusBadRequest, "JSON non valido: contenuto dopo l'oggetto")
+		return false
+	}
+	return true
+}
+
+func scriviJSON(w http.ResponseWriter, stato int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(stato)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func scriviErrore(w http.ResponseWriter, stato int, msg string) {
+	scriviJSON(w, stato, Errore{Errore: msg})
+}
+
+func scriviErroreCampi(w http.ResponseWriter, stato int, msg string, campi []ErroreCampo) {
+	scriviJSON(w, stato, Errore{Errore: msg, Campi: campi})
+}
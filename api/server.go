@@ -0,0 +1,142 @@
+// Package api espone i dati dell'officina come API REST JSON versionata
+// (/api/v1), per front-end web e dispositivi dei meccanici. Il server può
+// girare in un processo separato (officina serve) o accanto alla TUI sullo
+// stesso database.
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"officina/database"
+	"officina/logger"
+)
+
+// Prefisso è il percorso base della versione corrente dell'API
+const Prefisso = "/api/v1"
+
+// maxCorpo limita la dimensione delle richieste JSON
+const maxCorpo = 1 << 20
+
+// Server gestisce le richieste dell'API
+type Server struct {
+	db         *database.DB // connessione condivisa; ogni richiesta ha la propria sessione
+	mux        *http.ServeMux
+	version    string
+	operazioni []operazione // rotte registrate, descritte nel documento OpenAPI
+
+	// Accesso operatori; nil se non si usa il database (documento OpenAPI, test)
+	accessoRichiesto func() (bool, error)
+	autentica        func(matricola, credenziale string) (*database.Operatore, error)
+}
+
+// NewServer crea il server e registra tutte le rotte
+func NewServer(db *database.DB, version string) *Server {
+	s := &Server{db: db, mux: http.NewServeMux(), version: version}
+	if db != nil {
+		s.accessoRichiesto = db.AccessoRichiesto
+		s.autentica = db.Autentica
+	}
+
+	s.registraEntita()
+	s.registraAggregati()
+
+	s.route(operazione{
+		metodo: http.MethodGet, path: "/openapi.json", tag: "meta",
+		sommario: "Documento OpenAPI di questa API", risposta: tipoLibero, pubblica: true,
+	}, s.handleOpenAPI)
+
+	return s
+}
+
+// Handler restituisce l'handler HTTP con logging e recupero dai panic
+func (s *Server) Handler() http.Handler {
+	return s.recupera(s.registra(s.mux))
+}
+
+// ListenAndServe avvia il server su addr e lo arresta alla cancellazione di ctx
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("impossibile ascoltare su %s: %w", addr, err)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accetta connessioni da ln finché ctx non viene cancellato
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	logger.Info("API in ascolto su http://%s%s", ln.Addr(), Prefisso)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("errore arresto API: %w", err)
+		}
+		if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		logger.Info("API arrestata")
+		return nil
+	}
+}
+
+// route registra un handler e la sua descrizione per il documento OpenAPI;
+// le operazioni non pubbliche richiedono l'accesso e il permesso indicato
+func (s *Server) route(op operazione, h http.HandlerFunc) {
+	s.operazioni = append(s.operazioni, op)
+	if !op.pubblica {
+		h = s.consenti(op, h)
+	}
+	s.mux.HandleFunc(op.metodo+" "+Prefisso+op.path, h)
+}
+
+// rispostaRegistrata memorizza lo stato HTTP per il log
+type rispostaRegistrata struct {
+	http.ResponseWriter
+	stato int
+}
+
+func (r *rispostaRegistrata) WriteHeader(stato int) {
+	r.stato = stato
+	r.ResponseWriter.WriteHeader(stato)
+}
+
+// registra scrive nel log ogni richiesta con esito e durata
+func (s *Server) registra(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inizio := time.Now()
+		rr := &rispostaRegistrata{ResponseWriter: w, stato: http.StatusOK}
+		next.ServeHTTP(rr, r)
+		logger.Debug("API %s %s → %d (%s)", r.Method, r.URL.RequestURI(), rr.stato, time.Since(inizio).Round(time.Millisecond))
+	})
+}
+
+// recupera trasforma un panic in un errore 500 senza fermare il server
+func (s *Server) recupera(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				logger.Error("API panic su %s %s: %v", r.Method, r.URL.Path, v)
+				scriviErrore(w, http.StatusInternalServerError, "errore interno")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
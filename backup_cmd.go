@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"officina/database"
+	"officina/logger"
+	"officina/utils"
+)
+
+// runBackupCommand gestisce "officina backup create|list|restore|verify"
+func runBackupCommand(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "Uso: officina backup create|list|restore|verify [opzioni]")
+		return exitUso
+	}
+
+	switch args[0] {
+	case "create":
+		return runBackupCreate(args[1:])
+	case "list":
+		return runBackupList(args[1:])
+	case "restore":
+		return runBackupRestore(args[1:])
+	case "verify":
+		return runBackupVerify(args[1:])
+	}
+
+	fmt.Fprintf(os.Stderr, "Comando sconosciuto: backup %s\n", args[0])
+	return exitUso
+}
+
+// openBackupManager apre il database e prepara il gestore dei backup
+func openBackupManager(opts *opzioniComando, replica bool) (*database.DB, *database.BackupManagerMongo, int, bool) {
+	cfg, db, code, stop := opts.open()
+	if stop {
+		return nil, nil, code, true
+	}
+
+	if !replica {
+		return db, database.NewBackupManagerMongo(db, cfg.App.BackupPath, cfg.Backup.MaxFiles), exitOK, false
+	}
+
+	bm, err := database.NewBackupManagerFromConfig(db, cfg)
+	if err != nil {
+		db.Close()
+		logger.Close()
+		opts.fail(err)
+		return nil, nil, exitUso, true
+	}
+
+	return db, bm, exitOK, false
+}
+
+// resolveBackup trova la directory di un backup dato il nome, il percorso
+// o "latest" per il più recente
+func resolveBackup(bm *database.BackupManagerMongo, nome string) (string, error) {
+	if nome == "latest" {
+		backups, err := bm.ListBackups()
+		if err != nil || len(backups) == 0 {
+			return "", fmt.Errorf("nessun backup disponibile in %s", bm.BasePath())
+		}
+		return backups[0], nil
+	}
+
+	if _, err := os.Stat(nome); err == nil {
+		return nome, nil
+	}
+
+	dir := filepath.Join(bm.BasePath(), nome)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("backup non trovato: %s", nome)
+	}
+	return dir, nil
+}
+
+func runBackupCreate(args []string) int {
+	opts := newOpzioni("backup create")
+	noReplica := opts.fs.Bool("no-replica", false, "non replica il backup sulle destinazioni configurate")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	db, bm, code, stop := openBackupManager(opts, !*noReplica)
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	dir, err := bm.CreateBackup()
+	if err != nil && dir == "" {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	info := database.ReadBackupInfo(dir)
+	result := struct {
+		database.BackupInfo
+		Errore string `json:"errore,omitempty"`
+	}{BackupInfo: info}
+	if err != nil {
+		// Il backup locale esiste ma pulizia o replica sono fallite
+		result.Errore = err.Error()
+	}
+
+	logger.Info("Backup creato da riga di comando: %s", dir)
+	opts.output(result, func() {
+		fmt.Printf("Backup creato: %s (%d documenti, %s)\n", dir, info.TotaleDocumenti(), utils.FormatSize(info.Dimensione))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Attenzione: %v\n", err)
+		}
+	})
+
+	if err != nil {
+		return exitErrore
+	}
+	return exitOK
+}
+
+func runBackupList(args []string) int {
+	opts := newOpzioni("backup list")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	// L'elenco legge solo i file: non serve il database
+	cfg, code, stop := opts.load()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+
+	bm := database.NewBackupManagerMongo(nil, cfg.App.BackupPath, cfg.Backup.MaxFiles)
+	infos, err := bm.ListBackupInfo()
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+	if infos == nil {
+		infos = []database.BackupInfo{}
+	}
+
+	opts.output(infos, func() {
+		if len(infos) == 0 {
+			fmt.Printf("Nessun backup in %s\n", cfg.App.BackupPath)
+			return
+		}
+		for _, bi := range infos {
+			fmt.Printf("%-36s %s  %8s  %6d doc  %s\n",
+				bi.Nome, utils.FormatDateTime(bi.Data), utils.FormatSize(bi.Dimensione),
+				bi.TotaleDocumenti(), bi.Verifica)
+		}
+	})
+	return exitOK
+}
+
+func runBackupRestore(args []string) int {
+	opts := newOpzioni("backup restore")
+	yes := opts.fs.Bool("yes", false, "conferma la sostituzione dei dati correnti")
+	merge := opts.fs.Bool("merge", false, "reinserisce solo i record mancanti, senza cancellare nulla")
+	collezioni := opts.fs.String("collection", "", "reinserisce i record mancanti solo delle collezioni indicate, es. clienti,veicoli")
+	record := opts.fs.String("record", "", "reinserisce solo i record indicati, es. clienti:12,veicoli:7")
+	cliente := opts.fs.Int("cliente", 0, "reinserisce il cliente con veicoli, commesse, appuntamenti e movimenti")
+	overwrite := opts.fs.Bool("overwrite", false, "con il ripristino selettivo sostituisce anche i record modificati dopo il backup")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+	if len(opts.args) != 1 {
+		fmt.Fprintln(os.Stderr, "Uso: officina backup restore [--yes|--merge|--collection C,...|--record C:ID,...|--cliente ID] [--overwrite] NOME|PERCORSO|latest")
+		return exitUso
+	}
+
+	refs, err := database.ParseRecordRefs(*record)
+	if err != nil {
+		opts.fail(err)
+		return exitUso
+	}
+	selettivo := *merge || *collezioni != "" || len(refs) > 0 || *cliente != 0
+	if *yes && selettivo {
+		opts.fail(fmt.Errorf("--yes (ripristino completo) non si combina con le opzioni del ripristino selettivo"))
+		return exitUso
+	}
+	if *overwrite && !selettivo {
+		opts.fail(fmt.Errorf("--overwrite vale solo per il ripristino selettivo"))
+		return exitUso
+	}
+	if !*yes && !selettivo {
+		opts.fail(fmt.Errorf("il ripristino completo sostituisce tutti i dati: aggiungi --yes per confermare o usa --merge"))
+		return exitUso
+	}
+
+	db, bm, code, stop := openBackupManager(opts, false)
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	dir, err := resolveBackup(bm, opts.args[0])
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	// Un backup danneggiato non deve mai sostituire i dati
+	if err := bm.VerifyBackup(dir); err != nil {
+		opts.fail(fmt.Errorf("verifica backup fallita, ripristino annullato: %w", err))
+		return exitProblemi
+	}
+
+	if selettivo {
+		ropts := database.RestoreOptions{Records: refs, SovrascriviModificati: *overwrite}
+		if *collezioni != "" {
+			if ropts.Collections, err = collezioniRichieste(splitElenco(*collezioni)); err != nil {
+				opts.fail(err)
+				return exitUso
+			}
+		} else if *merge {
+			// I backup meno recenti non contengono tutte le collezioni attuali
+			if ropts.Collections, err = bm.CollezioniBackup(dir); err != nil {
+				opts.fail(err)
+				return exitErrore
+			}
+		}
+		if *cliente != 0 {
+			collegati, err := bm.RecordCollegatiCliente(dir, *cliente)
+			if err != nil {
+				opts.fail(err)
+				return exitErrore
+			}
+			ropts.Records = append(ropts.Records, collegati...)
+		}
+
+		report, err := bm.RestoreSelective(dir, ropts)
+		if err != nil {
+			opts.fail(err)
+			return exitErrore
+		}
+		logger.Info("Ripristino selettivo da riga di comando: %s (%d record)", dir, report.Totale())
+		opts.output(report, func() {
+			fmt.Printf("Ripristino selettivo da %s: %d record reinseriti o sostituiti\n", dir, report.Totale())
+			if saltati := report.TotaleSaltati(); saltati > 0 {
+				fmt.Printf("%d record modificati dopo il backup non sono stati toccati (usa --overwrite per sostituirli)\n", saltati)
+			}
+		})
+		return exitOK
+	}
+
+	if err := bm.RestoreBackup(dir); err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	logger.Info("Ripristino completo da riga di comando: %s", dir)
+	opts.output(map[string]string{"ripristinato": dir}, func() {
+		fmt.Printf("Database ripristinato da %s\n", dir)
+	})
+	return exitOK
+}
+
+func runBackupVerify(args []string) int {
+	opts := newOpzioni("backup verify")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	cfg, code, stop := opts.load()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+
+	bm := database.NewBackupManagerMongo(nil, cfg.App.BackupPath, cfg.Backup.MaxFiles)
+
+	// Senza argomenti verifica tutti i backup
+	var dirs []string
+	if len(opts.args) == 0 {
+		all, err := bm.ListBackups()
+		if err != nil && !os.IsNotExist(err) {
+			opts.fail(err)
+			return exitErrore
+		}
+		dirs = all
+	}
+	for _, nome := range opts.args {
+		dir, err := resolveBackup(bm, nome)
+		if err != nil {
+			opts.fail(err)
+			return exitErrore
+		}
+		dirs = append(dirs, dir)
+	}
+
+	type esito struct {
+		Path   string `json:"path"`
+		OK     bool   `json:"ok"`
+		Errore string `json:"errore,omitempty"`
+	}
+	esiti := []esito{}
+	falliti := 0
+
+	for _, dir := range dirs {
+		e := esito{Path: dir, OK: true}
+		if err := bm.VerifyBackup(dir); err != nil {
+			e.OK = false
+			e.Errore = err.Error()
+			falliti++
+		}
+		esiti = append(esiti, e)
+	}
+
+	opts.output(esiti, func() {
+		for _, e := range esiti {
+			if e.OK {
+				fmt.Printf("✓ %s\n", filepath.Base(e.Path))
+			} else {
+				fmt.Printf("✗ %s: %s\n", filepath.Base(e.Path), e.Errore)
+			}
+		}
+		fmt.Printf("%d backup verificati, %d falliti\n", len(esiti), falliti)
+	})
+
+	if falliti > 0 {
+		return exitProblemi
+	}
+	return exitOK
+}
+
+// splitElenco divide un elenco separato da virgole, ignorando gli spazi e le
+// voci vuote
+func splitElenco(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"officina/config"
+	"officina/database"
+	"officina/logger"
+)
+
+// Codici di uscita dei comandi
+const (
+	exitOK       = 0 // operazione completata
+	exitErrore   = 1 // errore di esecuzione (database, file, rete)
+	exitUso      = 2 // comando o opzioni non validi
+	exitProblemi = 3 // controllo completato con esito negativo (verify, fsck)
+)
+
+// comando descrive un sottocomando di officina
+type comando struct {
+	nome        string
+	uso         string
+	descrizione string
+	run         func(args []string) int
+}
+
+var comandi []comando
+
+func init() {
+	comandi = []comando{
+		{"tui", "tui [opzioni]", "Avvia l'interfaccia a schermo intero (predefinito)", runTUI},
+		{"backup", "backup create|list|restore|verify [opzioni]", "Gestisce i backup del database", runBackupCommand},
+		{"export", "export [--dir DIR] [collezione...]", "Esporta le collezioni in JSON", runExportCommand},
+		{"import", "import [--replace] FILE.json... | import csv ...", "Importa collezioni JSON o clienti/veicoli da CSV", runImportCommand},
+		{"fatturapa", "fatturapa genera [--dir DIR] NUMERO|ID... | valida FILE... | importa [--magazzino] [--commit] DIR", "Genera e verifica le fatture elettroniche XML, importa quelle ricevute", runFatturaPACommand},
+		{"stampa", "stampa fattura|preventivo|ordine [--dir DIR] NUMERO|ID... | modelli", "Salva il PDF di fatture, preventivi e ordini di lavoro, copia i modelli", runStampaCommand},
+		{"fsck", "fsck [opzioni]", "Controlla l'integrità dei dati", runFsckCommand},
+		{"numerazione", "numerazione [--anno N]", "Controlla buchi, duplicati e ordine dei numeri di fattura", runNumerazioneCommand},
+		{"crediti", "crediti [--data AAAA-MM-GG] [--scadute]", "Scadenzario dei crediti verso i clienti per fascia di ritardo", runCreditiCommand},
+		{"serve", "serve [--api-listen HOST:PORTA] [--openapi]", "Avvia l'API REST sul database", runServeCommand},
+		{"ssh-serve", "ssh-serve [--ssh-listen HOST:PORTA]", "Serve l'interfaccia agli operatori via SSH", runSSHServeCommand},
+		{"webhook", "webhook log|test [opzioni]", "Registro delle consegne e prova dei webhook", runWebhookCommand},
+		{"registro", "registro [--operatore M] [--collezione C] [--limite N]", "Mostra il registro delle modifiche", runRegistroCommand},
+		{"migrate", "migrate [--status] [opzioni]", "Aggiorna lo schema dei dati", runMigrateCommand},
+		{"config", "config show|init [opzioni]", "Mostra o crea il file di configurazione", runConfigCommand},
+		{"version", "version [--json]", "Mostra versione e informazioni di build", runVersionCommand},
+		{"help", "help", "Mostra questo aiuto", func([]string) int { usage(os.Stdout); return exitOK }},
+	}
+}
+
+// run esegue il sottocomando indicato e restituisce il codice di uscita.
+// Senza sottocomando, o se il primo argomento è un'opzione, avvia la TUI.
+func run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "--help" || args[0] == "-help") {
+			usage(os.Stdout)
+			return exitOK
+		}
+		return runTUI(args)
+	}
+
+	for _, c := range comandi {
+		if c.nome == args[0] {
+			return c.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Comando sconosciuto: %s\n\n", args[0])
+	usage(os.Stderr)
+	return exitUso
+}
+
+// usage stampa l'elenco dei comandi
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Uso: officina <comando> [opzioni]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Comandi:")
+	for _, c := range comandi {
+		fmt.Fprintf(w, "  %-46s %s\n", c.uso, c.descrizione)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Tutti i comandi accettano le opzioni di configurazione (--config, --database-uri, ...);")
+	fmt.Fprintln(w, "usa \"officina <comando> -h\" per l'elenco. --json produce output leggibile da script.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Codici di uscita: 0 ok, 1 errore, 2 uso non valido, 3 controllo fallito")
+}
+
+// opzioniComando raccoglie le opzioni comuni di un sottocomando
+type opzioniComando struct {
+	fs     *flag.FlagSet
+	config *config.Flags
+	json   bool
+	args   []string // argomenti posizionali
+}
+
+// newOpzioni crea il FlagSet di un sottocomando con le opzioni di
+// configurazione e --json già registrate
+func newOpzioni(nome string) *opzioniComando {
+	o := &opzioniComando{fs: flag.NewFlagSet("officina "+nome, flag.ContinueOnError)}
+	o.config = config.RegisterFlags(o.fs)
+	o.fs.BoolVar(&o.json, "json", false, "output JSON")
+	return o
+}
+
+// parse analizza gli argomenti, ammettendo opzioni anche dopo quelli
+// posizionali; restituisce un codice di uscita se il comando deve
+// terminare subito (aiuto richiesto o opzioni errate)
+func (o *opzioniComando) parse(args []string) (int, bool) {
+	for {
+		if err := o.fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK, true
+			}
+			return exitUso, true
+		}
+
+		args = o.fs.Args()
+		if len(args) == 0 {
+			return exitOK, false
+		}
+		o.args = append(o.args, args[0])
+		args = args[1:]
+	}
+}
+
+// load carica la configurazione e inizializza il logger
+func (o *opzioniComando) load() (*config.Config, int, bool) {
+	cfg, err := o.config.Load()
+	if err != nil {
+		o.fail(fmt.Errorf("configurazione: %w", err))
+		return nil, exitUso, true
+	}
+	if Version != "dev" {
+		cfg.App.Version = Version
+	}
+
+	if err := logger.Init(cfg.App.LogFile, cfg.App.DebugMode); err != nil {
+		o.fail(err)
+		return nil, exitErrore, true
+	}
+
+	return cfg, exitOK, false
+}
+
+// open carica la configurazione e apre il database
+func (o *opzioniComando) open() (*config.Config, *database.DB, int, bool) {
+	cfg, code, stop := o.load()
+	if stop {
+		return nil, nil, code, true
+	}
+
+	db, err := database.InitMongoDB(cfg.Database.URI, cfg.Database.Name, cfg.Database.Timeout)
+	if err != nil {
+		logger.Close()
+		o.fail(fmt.Errorf("connessione database: %w", err))
+		return nil, nil, exitErrore, true
+	}
+
+	return cfg, db, exitOK, false
+}
+
+// output stampa v in JSON se richiesto, altrimenti chiama text
+func (o *opzioniComando) output(v interface{}, text func()) {
+	if o.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	text()
+}
+
+// fail riporta un errore su stderr (in JSON con --json)
+func (o *opzioniComando) fail(err error) {
+	if o.json {
+		json.NewEncoder(os.Stderr).Encode(map[string]string{"errore": err.Error()})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Errore: %v\n", err)
+}
@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -11,6 +14,12 @@ type Config struct {
 	Database DatabaseConfig
 	App      AppConfig
 	Backup   BackupConfig
+	API      APIConfig
+	SSH      SSHConfig
+	Webhooks []WebhookConfig
+
+	file    string
+	sources map[string]string
 }
 
 type DatabaseConfig struct {
@@ -25,12 +34,80 @@ type AppConfig struct {
 	DebugMode  bool
 	LogFile    string
 	BackupPath string
+	ExportPath string
+
+	// TemplatesPath contiene i modelli personalizzati dei documenti PDF
+	// (fattura.tmpl, preventivo.tmpl, ordine.tmpl); mancando un file si
+	// usa il modello predefinito
+	TemplatesPath string
+
+	// SessionTimeout blocca la TUI dopo questo periodo di inattività,
+	// quando l'accesso operatori è attivo (0 = mai)
+	SessionTimeout time.Duration
 }
 
 type BackupConfig struct {
 	Enabled  bool
 	Interval time.Duration
 	MaxFiles int
+	Targets  []BackupTargetConfig
+}
+
+// APIConfig controlla il server REST (officina serve o avviato dalla TUI)
+type APIConfig struct {
+	Enabled bool   // avvia l'API insieme alla TUI
+	Listen  string // indirizzo host:porta
+}
+
+// SSHConfig controlla il server SSH della TUI (officina ssh-serve)
+type SSHConfig struct {
+	Listen         string // indirizzo host:porta
+	HostKey        string // chiave privata del server, generata se assente
+	AuthorizedKeys string // chiavi pubbliche degli operatori (MATRICOLA chiave)
+}
+
+// WebhookConfig descrive un indirizzo HTTP a cui inviare gli eventi di
+// dominio (commessa chiusa, fattura emessa, ...). Ogni richiesta è firmata
+// con HMAC-SHA256 usando Secret.
+type WebhookConfig struct {
+	Nome         string
+	URL          string
+	Secret       string
+	Eventi       []string // eventi da inviare, tutti se vuoto
+	MaxTentativi int      // tentativi per evento prima di rinunciare (0 = 5)
+}
+
+// Tipi di destinazione per la replica dei backup
+const (
+	BackupTargetDir  = "dir"
+	BackupTargetSFTP = "sftp"
+	BackupTargetS3   = "s3"
+)
+
+// BackupTargetConfig descrive una destinazione esterna su cui replicare
+// ogni backup. I campi usati dipendono dal tipo:
+//   - dir:  Path (disco USB o condivisione di rete montata)
+//   - sftp: Host, Port, User, KeyFile, RemoteDir
+//   - s3:   Endpoint, Region, Bucket, Prefix, AccessKey, SecretKey
+type BackupTargetConfig struct {
+	Nome     string
+	Tipo     string
+	MaxFiles int
+
+	Path string
+
+	Host      string
+	Port      int
+	User      string
+	KeyFile   string
+	RemoteDir string
+
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
 }
 
 func DefaultConfig() *Config {
@@ -50,12 +127,26 @@ func DefaultConfig() *Config {
 			DebugMode:  false,
 			LogFile:    filepath.Join(dataDir, "debug.log"),
 			BackupPath: filepath.Join(dataDir, "backups"),
+			ExportPath: filepath.Join(dataDir, "export"),
+
+			TemplatesPath: filepath.Join(dataDir, "config", "modelli"),
+
+			SessionTimeout: 15 * time.Minute,
 		},
 		Backup: BackupConfig{
 			Enabled:  true,
 			Interval: 24 * time.Hour,
 			MaxFiles: 7,
 		},
+		API: APIConfig{
+			Enabled: false,
+			Listen:  "127.0.0.1:8321",
+		},
+		SSH: SSHConfig{
+			Listen:         "0.0.0.0:2323",
+			HostKey:        filepath.Join(dataDir, "config", "ssh_host_ed25519"),
+			AuthorizedKeys: filepath.Join(dataDir, "config", "ssh_operatori"),
+		},
 	}
 }
 
@@ -63,13 +154,67 @@ func (c *Config) Validate() error {
 	if c.Database.URI == "" {
 		return fmt.Errorf("database URI non può essere vuoto")
 	}
+	if !strings.HasPrefix(c.Database.URI, "mongodb://") && !strings.HasPrefix(c.Database.URI, "mongodb+srv://") {
+		return fmt.Errorf("database URI deve iniziare con mongodb:// o mongodb+srv://")
+	}
 	if c.Database.Name == "" {
 		return fmt.Errorf("database name non può essere vuoto")
 	}
+	if c.Database.Timeout <= 0 {
+		return fmt.Errorf("database timeout deve essere positivo")
+	}
+
+	if c.App.LogFile == "" {
+		return fmt.Errorf("log file non può essere vuoto")
+	}
+
+	if c.App.SessionTimeout < 0 {
+		return fmt.Errorf("session timeout non può essere negativo")
+	}
 
 	if c.Backup.Enabled && c.App.BackupPath == "" {
 		return fmt.Errorf("backup path non può essere vuoto quando i backup sono abilitati")
 	}
+	if c.Backup.Enabled && c.Backup.Interval <= 0 {
+		return fmt.Errorf("intervallo backup deve essere positivo")
+	}
+	if c.Backup.MaxFiles < 1 {
+		return fmt.Errorf("backup max_files deve essere almeno 1")
+	}
+
+	for i, t := range c.Backup.Targets {
+		switch t.Tipo {
+		case BackupTargetDir, BackupTargetSFTP, BackupTargetS3:
+		default:
+			return fmt.Errorf("destinazione backup %d: tipo %q non valido (dir, sftp, s3)", i+1, t.Tipo)
+		}
+		if t.MaxFiles < 0 {
+			return fmt.Errorf("destinazione backup %d: max_files non può essere negativo", i+1)
+		}
+	}
+
+	for i, w := range c.Webhooks {
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook %d: url %q non valido (http:// o https://)", i+1, w.URL)
+		}
+		if w.Secret == "" {
+			return fmt.Errorf("webhook %d: secret non può essere vuoto", i+1)
+		}
+		if w.MaxTentativi < 0 {
+			return fmt.Errorf("webhook %d: max_tentativi non può essere negativo", i+1)
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(c.API.Listen); err != nil {
+		return fmt.Errorf("api listen %q non valido (formato host:porta): %w", c.API.Listen, err)
+	}
+	if _, _, err := net.SplitHostPort(c.SSH.Listen); err != nil {
+		return fmt.Errorf("ssh listen %q non valido (formato host:porta): %w", c.SSH.Listen, err)
+	}
+	if c.SSH.HostKey == "" || c.SSH.AuthorizedKeys == "" {
+		return fmt.Errorf("ssh host_key e authorized_keys non possono essere vuoti")
+	}
 
 	if c.Backup.Enabled {
 		if err := os.MkdirAll(c.App.BackupPath, 0755); err != nil {
@@ -80,10 +225,9 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// LoadOrDefault carica la configurazione da file e variabili d'ambiente,
+// senza opzioni da riga di comando
 func LoadOrDefault() (*Config, error) {
-	cfg := DefaultConfig()
-	if err := cfg.Validate(); err != nil {
-		return nil, err
-	}
-	return cfg, nil
+	cfg, _, err := Load(nil)
+	return cfg, err
 }
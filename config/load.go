@@ -0,0 +1,761 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Origini di un valore di configurazione, in ordine di priorità crescente
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// EnvPrefix è il prefisso delle variabili d'ambiente: database.uri → OFFICINA_DATABASE_URI
+const EnvPrefix = "OFFICINA_"
+
+type settingKind int
+
+const (
+	kindString settingKind = iota
+	kindBool
+	kindInt
+	kindDuration
+	kindList // elenco: array TOML o testo separato da virgole
+)
+
+// setting descrive un'opzione configurabile da file, ambiente e riga di comando
+type setting struct {
+	key  string
+	help string
+	kind settingKind
+	get  func(c *Config) string
+	set  func(c *Config, v string) error
+}
+
+// settings elenca le opzioni nell'ordine in cui compaiono nel file
+var settings = []setting{
+	{"database.uri", "URI di connessione MongoDB", kindString,
+		func(c *Config) string { return c.Database.URI },
+		func(c *Config, v string) error { c.Database.URI = v; return nil }},
+	{"database.name", "Nome del database", kindString,
+		func(c *Config) string { return c.Database.Name },
+		func(c *Config, v string) error { c.Database.Name = v; return nil }},
+	{"database.timeout", "Timeout di connessione (es. 5s, 1m)", kindDuration,
+		func(c *Config) string { return formatDuration(c.Database.Timeout) },
+		func(c *Config, v string) error { return setDuration(&c.Database.Timeout, v) }},
+
+	{"app.name", "Nome mostrato nell'interfaccia", kindString,
+		func(c *Config) string { return c.App.Name },
+		func(c *Config, v string) error { c.App.Name = v; return nil }},
+	{"app.debug", "Abilita i log di debug", kindBool,
+		func(c *Config) string { return strconv.FormatBool(c.App.DebugMode) },
+		func(c *Config, v string) error { return setBool(&c.App.DebugMode, v) }},
+	{"app.log_file", "File di log", kindString,
+		func(c *Config) string { return c.App.LogFile },
+		func(c *Config, v string) error { c.App.LogFile = expandHome(v); return nil }},
+	{"app.session_timeout", "Blocco della sessione dopo questo periodo di inattività (0 = mai)", kindDuration,
+		func(c *Config) string { return formatDuration(c.App.SessionTimeout) },
+		func(c *Config, v string) error { return setDuration(&c.App.SessionTimeout, v) }},
+	{"app.backup_path", "Directory dei backup locali", kindString,
+		func(c *Config) string { return c.App.BackupPath },
+		func(c *Config, v string) error { c.App.BackupPath = expandHome(v); return nil }},
+	{"app.export_path", "Directory dei file CSV/XLSX esportati dalle schermate", kindString,
+		func(c *Config) string { return c.App.ExportPath },
+		func(c *Config, v string) error { c.App.ExportPath = expandHome(v); return nil }},
+	{"app.templates_path", "Directory dei modelli personalizzati dei documenti PDF (officina stampa modelli)", kindString,
+		func(c *Config) string { return c.App.TemplatesPath },
+		func(c *Config, v string) error { c.App.TemplatesPath = expandHome(v); return nil }},
+
+	{"backup.enabled", "Backup automatico all'avvio", kindBool,
+		func(c *Config) string { return strconv.FormatBool(c.Backup.Enabled) },
+		func(c *Config, v string) error { return setBool(&c.Backup.Enabled, v) }},
+	{"backup.interval", "Intervallo tra backup automatici (es. 24h)", kindDuration,
+		func(c *Config) string { return formatDuration(c.Backup.Interval) },
+		func(c *Config, v string) error { return setDuration(&c.Backup.Interval, v) }},
+	{"backup.max_files", "Numero di backup locali da conservare", kindInt,
+		func(c *Config) string { return strconv.Itoa(c.Backup.MaxFiles) },
+		func(c *Config, v string) error { return setInt(&c.Backup.MaxFiles, v) }},
+
+	{"api.enabled", "Avvia l'API REST insieme all'interfaccia", kindBool,
+		func(c *Config) string { return strconv.FormatBool(c.API.Enabled) },
+		func(c *Config, v string) error { return setBool(&c.API.Enabled, v) }},
+	{"api.listen", "Indirizzo dell'API REST (host:porta; 0.0.0.0 per la rete locale)", kindString,
+		func(c *Config) string { return c.API.Listen },
+		func(c *Config, v string) error { c.API.Listen = v; return nil }},
+
+	{"ssh.listen", "Indirizzo del server SSH di officina ssh-serve (host:porta)", kindString,
+		func(c *Config) string { return c.SSH.Listen },
+		func(c *Config, v string) error { c.SSH.Listen = v; return nil }},
+	{"ssh.host_key", "Chiave privata del server SSH (generata se assente)", kindString,
+		func(c *Config) string { return c.SSH.HostKey },
+		func(c *Config, v string) error { c.SSH.HostKey = expandHome(v); return nil }},
+	{"ssh.authorized_keys", "Chiavi pubbliche degli operatori: una per riga, MATRICOLA seguita dalla chiave", kindString,
+		func(c *Config) string { return c.SSH.AuthorizedKeys },
+		func(c *Config, v string) error { c.SSH.AuthorizedKeys = expandHome(v); return nil }},
+}
+
+// targetField descrive un campo di una destinazione [[backup.targets]]
+type targetField struct {
+	key    string
+	kind   settingKind
+	secret bool
+	get    func(t *BackupTargetConfig) string
+	set    func(t *BackupTargetConfig, v string) error
+}
+
+var targetFields = []targetField{
+	{"nome", kindString, false, func(t *BackupTargetConfig) string { return t.Nome },
+		func(t *BackupTargetConfig, v string) error { t.Nome = v; return nil }},
+	{"tipo", kindString, false, func(t *BackupTargetConfig) string { return t.Tipo },
+		func(t *BackupTargetConfig, v string) error { t.Tipo = v; return nil }},
+	{"max_files", kindInt, false, func(t *BackupTargetConfig) string { return strconv.Itoa(t.MaxFiles) },
+		func(t *BackupTargetConfig, v string) error { return setInt(&t.MaxFiles, v) }},
+	{"path", kindString, false, func(t *BackupTargetConfig) string { return t.Path },
+		func(t *BackupTargetConfig, v string) error { t.Path = expandHome(v); return nil }},
+	{"host", kindString, false, func(t *BackupTargetConfig) string { return t.Host },
+		func(t *BackupTargetConfig, v string) error { t.Host = v; return nil }},
+	{"port", kindInt, false, func(t *BackupTargetConfig) string { return strconv.Itoa(t.Port) },
+		func(t *BackupTargetConfig, v string) error { return setInt(&t.Port, v) }},
+	{"user", kindString, false, func(t *BackupTargetConfig) string { return t.User },
+		func(t *BackupTargetConfig, v string) error { t.User = v; return nil }},
+	{"key_file", kindString, false, func(t *BackupTargetConfig) string { return t.KeyFile },
+		func(t *BackupTargetConfig, v string) error { t.KeyFile = expandHome(v); return nil }},
+	{"remote_dir", kindString, false, func(t *BackupTargetConfig) string { return t.RemoteDir },
+		func(t *BackupTargetConfig, v string) error { t.RemoteDir = v; return nil }},
+	{"endpoint", kindString, false, func(t *BackupTargetConfig) string { return t.Endpoint },
+		func(t *BackupTargetConfig, v string) error { t.Endpoint = v; return nil }},
+	{"region", kindString, false, func(t *BackupTargetConfig) string { return t.Region },
+		func(t *BackupTargetConfig, v string) error { t.Region = v; return nil }},
+	{"bucket", kindString, false, func(t *BackupTargetConfig) string { return t.Bucket },
+		func(t *BackupTargetConfig, v string) error { t.Bucket = v; return nil }},
+	{"prefix", kindString, false, func(t *BackupTargetConfig) string { return t.Prefix },
+		func(t *BackupTargetConfig, v string) error { t.Prefix = v; return nil }},
+	{"access_key", kindString, false, func(t *BackupTargetConfig) string { return t.AccessKey },
+		func(t *BackupTargetConfig, v string) error { t.AccessKey = v; return nil }},
+	{"secret_key", kindString, true, func(t *BackupTargetConfig) string { return t.SecretKey },
+		func(t *BackupTargetConfig, v string) error { t.SecretKey = v; return nil }},
+}
+
+// webhookField descrive un campo di un webhook [[webhooks]]
+type webhookField struct {
+	key    string
+	kind   settingKind
+	secret bool
+	get    func(w *WebhookConfig) string
+	set    func(w *WebhookConfig, v string) error
+}
+
+var webhookFields = []webhookField{
+	{"nome", kindString, false, func(w *WebhookConfig) string { return w.Nome },
+		func(w *WebhookConfig, v string) error { w.Nome = v; return nil }},
+	{"url", kindString, false, func(w *WebhookConfig) string { return w.URL },
+		func(w *WebhookConfig, v string) error { w.URL = v; return nil }},
+	{"secret", kindString, true, func(w *WebhookConfig) string { return w.Secret },
+		func(w *WebhookConfig, v string) error { w.Secret = v; return nil }},
+	{"eventi", kindList, false, func(w *WebhookConfig) string { return strings.Join(w.Eventi, ", ") },
+		func(w *WebhookConfig, v string) error { w.Eventi = splitList(v); return nil }},
+	{"max_tentativi", kindInt, false, func(w *WebhookConfig) string { return strconv.Itoa(w.MaxTentativi) },
+		func(w *WebhookConfig, v string) error { return setInt(&w.MaxTentativi, v) }},
+}
+
+// DefaultPath restituisce il percorso predefinito del file di configurazione
+func DefaultPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".officina", "config", "officina.toml")
+}
+
+// EnvName restituisce la variabile d'ambiente associata a una chiave
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// FlagName restituisce l'opzione da riga di comando associata a una chiave
+func FlagName(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(key)
+}
+
+// Load costruisce la configurazione a strati: valori predefiniti, file
+// (--config, OFFICINA_CONFIG o DefaultPath), variabili OFFICINA_* e opzioni
+// da riga di comando. Restituisce gli argomenti non consumati dalle opzioni.
+func Load(args []string) (*Config, []string, error) {
+	cfg, rest, err := load(args)
+	if err != nil {
+		return nil, rest, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, rest, err
+	}
+	return cfg, rest, nil
+}
+
+// LoadNoValidate è come Load ma non valida il risultato; serve per mostrare
+// una configurazione anche quando è errata
+func LoadNoValidate(args []string) (*Config, []string, error) {
+	return load(args)
+}
+
+func load(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("officina", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := flags.build()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// Flags raccoglie le opzioni di configurazione registrate su un FlagSet;
+// permette ai sottocomandi di affiancarle alle proprie opzioni
+type Flags struct {
+	path   *string
+	values []flagValue
+}
+
+type flagValue struct {
+	key   string
+	value string
+}
+
+// RegisterFlags aggiunge a fs --config e un'opzione per ogni chiave di
+// configurazione. Dopo fs.Parse la configurazione si ottiene con Load.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{
+		path: fs.String("config", "", "file di configurazione (default "+DefaultPath()+")"),
+	}
+
+	for _, s := range settings {
+		key := s.key
+		store := func(v string) error {
+			f.values = append(f.values, flagValue{key, v})
+			return nil
+		}
+		if s.kind == kindBool {
+			fs.BoolFunc(FlagName(key), s.help, store)
+		} else {
+			fs.Func(FlagName(key), s.help, store)
+		}
+	}
+
+	return f
+}
+
+// Load costruisce e valida la configurazione usando le opzioni analizzate
+func (f *Flags) Load() (*Config, error) {
+	cfg, err := f.build()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// build applica i vari strati nell'ordine di precedenza
+func (f *Flags) build() (*Config, error) {
+	cfg := DefaultConfig()
+
+	file, explicit := *f.path, true
+	if file == "" {
+		file = os.Getenv(EnvPrefix + "CONFIG")
+	}
+	if file == "" {
+		file, explicit = DefaultPath(), false
+	}
+	file = expandHome(file)
+
+	if _, err := os.Stat(file); err == nil || explicit {
+		if err := cfg.LoadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(EnvName(s.key)); ok {
+			if err := s.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", EnvName(s.key), err)
+			}
+			cfg.setSource(s.key, SourceEnv)
+		}
+	}
+
+	for _, fv := range f.values {
+		s, _ := lookupSetting(fv.key)
+		if err := s.set(cfg, fv.value); err != nil {
+			return nil, fmt.Errorf("--%s: %w", FlagName(fv.key), err)
+		}
+		cfg.setSource(fv.key, SourceFlag)
+	}
+
+	return cfg, nil
+}
+
+// LoadFile applica alla configurazione i valori di un file TOML
+func (c *Config) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("impossibile aprire configurazione: %w", err)
+	}
+	defer f.Close()
+
+	doc, err := parseTOML(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for key, v := range doc.values {
+		s, ok := lookupSetting(key)
+		if !ok {
+			return fmt.Errorf("%s: chiave sconosciuta %s", path, key)
+		}
+		if err := checkList(s.kind, v); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		if err := s.set(c, v.raw); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		c.setSource(key, SourceFile)
+	}
+
+	for name, tables := range doc.arrays {
+		if name == "webhooks" {
+			if err := c.loadWebhooks(path, tables); err != nil {
+				return err
+			}
+			continue
+		}
+		if name != "backup.targets" {
+			return fmt.Errorf("%s: tabella sconosciuta [[%s]]", path, name)
+		}
+
+		c.Backup.Targets = nil
+		for _, table := range tables {
+			var t BackupTargetConfig
+			for key, v := range table {
+				tf, ok := lookupTargetField(key)
+				if !ok {
+					return fmt.Errorf("%s: chiave sconosciuta %s in [[backup.targets]]", path, key)
+				}
+				if err := checkList(tf.kind, v); err != nil {
+					return fmt.Errorf("%s: %s in [[backup.targets]]: %w", path, key, err)
+				}
+				if err := tf.set(&t, v.raw); err != nil {
+					return fmt.Errorf("%s: %s in [[backup.targets]]: %w", path, key, err)
+				}
+			}
+			c.Backup.Targets = append(c.Backup.Targets, t)
+		}
+		c.setSource("backup.targets", SourceFile)
+	}
+
+	c.file = path
+	return nil
+}
+
+// loadWebhooks legge le tabelle [[webhooks]]
+func (c *Config) loadWebhooks(path string, tables []map[string]tomlValue) error {
+	c.Webhooks = nil
+	for _, table := range tables {
+		var w WebhookConfig
+		for key, v := range table {
+			wf, ok := lookupWebhookField(key)
+			if !ok {
+				return fmt.Errorf("%s: chiave sconosciuta %s in [[webhooks]]", path, key)
+			}
+			if err := checkList(wf.kind, v); err != nil {
+				return fmt.Errorf("%s: %s in [[webhooks]]: %w", path, key, err)
+			}
+			if err := wf.set(&w, v.raw); err != nil {
+				return fmt.Errorf("%s: %s in [[webhooks]]: %w", path, key, err)
+			}
+		}
+		c.Webhooks = append(c.Webhooks, w)
+	}
+	c.setSource("webhooks", SourceFile)
+	return nil
+}
+
+// checkList accetta un array TOML solo per le chiavi che sono elenchi
+func checkList(kind settingKind, v tomlValue) error {
+	if v.list && kind != kindList {
+		return fmt.Errorf("atteso un solo valore, non un array")
+	}
+	return nil
+}
+
+// Get restituisce il valore di una chiave ("backup.max_files") come testo
+func (c *Config) Get(key string) (string, error) {
+	s, ok := lookupSetting(key)
+	if !ok {
+		return "", fmt.Errorf("chiave sconosciuta %s", key)
+	}
+	return s.get(c), nil
+}
+
+// Set imposta una chiave a partire dal suo valore testuale, con le stesse
+// conversioni usate per file, ambiente e opzioni
+func (c *Config) Set(key, value string) error {
+	s, ok := lookupSetting(key)
+	if !ok {
+		return fmt.Errorf("chiave sconosciuta %s", key)
+	}
+	return s.set(c, value)
+}
+
+// Clone restituisce una copia indipendente della configurazione, che si
+// può leggere e modificare senza toccare l'originale (per esempio una per
+// ogni sessione SSH)
+func (c *Config) Clone() *Config {
+	copia := *c
+	copia.Backup.Targets = append([]BackupTargetConfig(nil), c.Backup.Targets...)
+	copia.Webhooks = nil
+	for _, w := range c.Webhooks {
+		w.Eventi = append([]string(nil), w.Eventi...)
+		copia.Webhooks = append(copia.Webhooks, w)
+	}
+	copia.sources = make(map[string]string, len(c.sources))
+	for k, v := range c.sources {
+		copia.sources[k] = v
+	}
+	return &copia
+}
+
+// File restituisce il file di configurazione caricato, vuoto se nessuno
+func (c *Config) File() string {
+	return c.file
+}
+
+// Source indica da dove proviene il valore di una chiave
+func (c *Config) Source(key string) string {
+	if s, ok := c.sources[key]; ok {
+		return s
+	}
+	return SourceDefault
+}
+
+func (c *Config) setSource(key, source string) {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[key] = source
+}
+
+// Modalità di scrittura del file TOML
+type writeMode int
+
+const (
+	modeShow     writeMode = iota // configurazione effettiva, segreti mascherati
+	modeTemplate                  // valori predefiniti commentati
+	modeSave                      // file completo, rileggibile da LoadFile
+)
+
+// WriteTOML scrive la configurazione effettiva, annotando l'origine dei
+// valori non predefiniti. Le chiavi segrete vengono mascherate.
+func (c *Config) WriteTOML(w io.Writer) error {
+	return writeTOML(w, c, modeShow)
+}
+
+// WriteTemplate scrive un file di configurazione commentato con i valori
+// predefiniti, da usare come punto di partenza
+func WriteTemplate(w io.Writer) error {
+	return writeTOML(w, DefaultConfig(), modeTemplate)
+}
+
+// LoadFileConfig restituisce i valori predefiniti più quelli del file, senza
+// variabili d'ambiente né opzioni: è la configurazione persistita che
+// Impostazioni modifica. Un file mancante non è un errore.
+func LoadFileConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		cfg.file = path
+		return cfg, nil
+	}
+	if err := cfg.LoadFile(path); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Save scrive la configurazione nel file indicato. La scrittura avviene su un
+// file temporaneo rinominato alla fine, per non lasciare un file troncato.
+func (c *Config) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("impossibile creare directory configurazione: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	// Il file può contenere credenziali: leggibile solo dall'utente
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("impossibile scrivere configurazione: %w", err)
+	}
+
+	if err := writeTOML(f, c, modeSave); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("errore scrittura configurazione: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("errore scrittura configurazione: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("impossibile salvare configurazione: %w", err)
+	}
+
+	c.file = path
+	return nil
+}
+
+func writeTOML(w io.Writer, c *Config, mode writeMode) error {
+	var b strings.Builder
+	template := mode == modeTemplate
+
+	if template {
+		b.WriteString("# Configurazione di Officina Manager\n")
+		b.WriteString("#\n")
+		b.WriteString("# Le righe commentate mostrano il valore predefinito: togliere il # per modificarlo.\n")
+		b.WriteString("# Ogni chiave può essere sovrascritta da una variabile d'ambiente (database.uri →\n")
+		b.WriteString("# " + EnvName("database.uri") + ") o da un'opzione da riga di comando (--" + FlagName("database.uri") + ").\n")
+	} else if mode == modeSave {
+		b.WriteString("# Configurazione di Officina Manager\n")
+		b.WriteString("# Salvata il " + time.Now().Format("02/01/2006 15:04") + "\n")
+	} else if c.file != "" {
+		b.WriteString("# File: " + c.file + "\n")
+	} else {
+		b.WriteString("# Nessun file di configurazione caricato\n")
+	}
+
+	section := ""
+	for _, s := range settings {
+		sec := s.key[:strings.Index(s.key, ".")]
+		name := s.key[len(sec)+1:]
+		first := sec != section
+		if first {
+			b.WriteString("\n[" + sec + "]\n")
+			section = sec
+		}
+
+		value := formatValue(s.kind, s.get(c))
+		if template {
+			if !first {
+				b.WriteString("\n")
+			}
+			b.WriteString("# " + s.help + "\n")
+			b.WriteString("# " + name + " = " + value + "\n")
+			continue
+		}
+		if mode == modeSave {
+			b.WriteString(name + " = " + value + "  # " + s.help + "\n")
+			continue
+		}
+
+		line := name + " = " + value
+		if src := c.Source(s.key); src != SourceDefault {
+			line += "  # " + describeSource(s.key, src)
+		}
+		b.WriteString(line + "\n")
+	}
+
+	if template {
+		b.WriteString("\n# Destinazioni di replica dei backup (una sezione per destinazione).\n")
+		b.WriteString("# tipo: dir (disco USB o condivisione montata), sftp, s3 (AWS, MinIO, B2...)\n")
+		b.WriteString("#\n")
+		b.WriteString("# [[backup.targets]]\n")
+		b.WriteString("# nome = \"USB\"\n")
+		b.WriteString("# tipo = \"dir\"\n")
+		b.WriteString("# path = \"/media/backup\"\n")
+		b.WriteString("# max_files = 14\n")
+		b.WriteString("#\n")
+		b.WriteString("# [[backup.targets]]\n")
+		b.WriteString("# nome = \"NAS\"\n")
+		b.WriteString("# tipo = \"sftp\"\n")
+		b.WriteString("# host = \"nas.local\"\n")
+		b.WriteString("# port = 22\n")
+		b.WriteString("# user = \"backup\"\n")
+		b.WriteString("# key_file = \"~/.ssh/id_ed25519\"\n")
+		b.WriteString("# remote_dir = \"officina\"\n")
+		b.WriteString("#\n")
+		b.WriteString("# [[backup.targets]]\n")
+		b.WriteString("# nome = \"MinIO\"\n")
+		b.WriteString("# tipo = \"s3\"\n")
+		b.WriteString("# endpoint = \"http://localhost:9000\"\n")
+		b.WriteString("# region = \"us-east-1\"\n")
+		b.WriteString("# bucket = \"officina\"\n")
+		b.WriteString("# access_key = \"minioadmin\"\n")
+		b.WriteString("# secret_key = \"minioadmin\"\n")
+		b.WriteString("# max_files = 30\n")
+
+		b.WriteString("\n# Webhook: eventi inviati in POST JSON, firmati con HMAC-SHA256 (header\n")
+		b.WriteString("# X-Officina-Firma). eventi: commessa.chiusa, preventivo.accettato,\n")
+		b.WriteString("# appuntamento.creato, fattura.emessa, movimento.registrato; vuoto per tutti.\n")
+		b.WriteString("#\n")
+		b.WriteString("# [[webhooks]]\n")
+		b.WriteString("# nome = \"SMS\"\n")
+		b.WriteString("# url = \"https://sms.example.com/officina\"\n")
+		b.WriteString("# secret = \"cambiami\"\n")
+		b.WriteString("# eventi = [\"commessa.chiusa\", \"appuntamento.creato\"]\n")
+		b.WriteString("# max_tentativi = 5\n")
+	} else {
+		for i := range c.Backup.Targets {
+			t := &c.Backup.Targets[i]
+			b.WriteString("\n[[backup.targets]]\n")
+			for _, tf := range targetFields {
+				v := tf.get(t)
+				if v == "" || (tf.kind == kindInt && v == "0" && tf.key != "max_files") {
+					continue
+				}
+				if tf.secret && mode == modeShow {
+					v = "********"
+				}
+				b.WriteString(tf.key + " = " + formatValue(tf.kind, v) + "\n")
+			}
+		}
+		for i := range c.Webhooks {
+			w := &c.Webhooks[i]
+			b.WriteString("\n[[webhooks]]\n")
+			for _, wf := range webhookFields {
+				v := wf.get(w)
+				if v == "" || (wf.kind == kindInt && v == "0") {
+					continue
+				}
+				if wf.secret && mode == modeShow {
+					v = "********"
+				}
+				b.WriteString(wf.key + " = " + formatValue(wf.kind, v) + "\n")
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// describeSource descrive l'origine di un valore per WriteTOML
+func describeSource(key, source string) string {
+	switch source {
+	case SourceEnv:
+		return "da " + EnvName(key)
+	case SourceFlag:
+		return "da --" + FlagName(key)
+	}
+	return "da " + source
+}
+
+func formatValue(kind settingKind, v string) string {
+	switch kind {
+	case kindBool, kindInt:
+		return v
+	case kindList:
+		var items []string
+		for _, item := range splitList(v) {
+			items = append(items, quoteTOML(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return quoteTOML(v)
+}
+
+func lookupSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+func lookupTargetField(key string) (targetField, bool) {
+	for _, tf := range targetFields {
+		if tf.key == key {
+			return tf, true
+		}
+	}
+	return targetField{}, false
+}
+
+func lookupWebhookField(key string) (webhookField, bool) {
+	for _, wf := range webhookFields {
+		if wf.key == key {
+			return wf, true
+		}
+	}
+	return webhookField{}, false
+}
+
+// splitList divide un elenco separato da virgole, scartando gli elementi vuoti
+func splitList(v string) []string {
+	var list []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("valore booleano non valido %q", v)
+	}
+	*dst = b
+	return nil
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("numero non valido %q", v)
+	}
+	*dst = n
+	return nil
+}
+
+func setDuration(dst *time.Duration, v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("durata non valida %q (es. 30s, 5m, 24h)", v)
+	}
+	*dst = d
+	return nil
+}
+
+// formatDuration rimuove le unità nulle finali: 24h0m0s → 24h
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// expandHome espande ~/ nella home dell'utente
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{"stringa", "[database]\nuri = \"mongodb://db:27017\"\n", "database.uri", "mongodb://db:27017", false},
+		{"stringa letterale", "[app]\nlog_file = 'C:\\log\\officina.log'\n", "app.log_file", `C:\log\officina.log`, false},
+		{"commento finale", "[backup]\nmax_files = 3 # tre copie\n", "backup.max_files", "3", false},
+		{"cancelletto in stringa", "[app]\nname = \"Officina #1\"\n", "app.name", "Officina #1", false},
+		{"stringa multilinea", "[app]\nname = \"\"\"\nOfficina\nRossi\"\"\"\n", "app.name", "Officina\nRossi", false},
+		{"tabella inline", "database = { uri = \"mongodb://db\" }\n", "database.uri", "mongodb://db", false},
+		{"chiave con punti", "backup.enabled = false\n", "backup.enabled", "false", false},
+		{"array", "[app]\nname = [\"a\", \"b\"]\n", "app.name", "a, b", false},
+		{"senza virgolette", "[app]\nname = Officina Rossi\n", "", "", true},
+		{"data", "[app]\nname = 2026-03-01\n", "", "", true},
+		{"duplicata", "[app]\nname = \"a\"\nname = \"b\"\n", "", "", true},
+		{"intestazione aperta", "[app\n", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseTOML(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTOML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := doc.values[tt.key].raw; got != tt.want {
+				t.Errorf("%s = %q, atteso %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPrecedenza(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("OFFICINA_CONFIG", "")
+
+	file := filepath.Join(dir, "officina.toml")
+	content := `
+[database]
+uri = "mongodb://file:27017"
+name = "da_file"
+
+[backup]
+interval = "12h"
+max_files = 3
+
+[[backup.targets]]
+nome = "USB"
+tipo = "dir"
+path = "/media/usb"
+max_files = 5
+`
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OFFICINA_DATABASE_NAME", "da_env")
+	t.Setenv("OFFICINA_BACKUP_MAX_FILES", "4")
+
+	cfg, rest, err := Load([]string{"--config", file, "--backup-max-files", "9", "--app-debug", "extra"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Database.URI != "mongodb://file:27017" || cfg.Source("database.uri") != SourceFile {
+		t.Errorf("database.uri = %s (%s), atteso valore da file", cfg.Database.URI, cfg.Source("database.uri"))
+	}
+	if cfg.Database.Name != "da_env" || cfg.Source("database.name") != SourceEnv {
+		t.Errorf("database.name = %s (%s), atteso valore da env", cfg.Database.Name, cfg.Source("database.name"))
+	}
+	if cfg.Backup.MaxFiles != 9 || cfg.Source("backup.max_files") != SourceFlag {
+		t.Errorf("backup.max_files = %d (%s), atteso valore da flag", cfg.Backup.MaxFiles, cfg.Source("backup.max_files"))
+	}
+	if cfg.Backup.Interval != 12*time.Hour {
+		t.Errorf("backup.interval = %v, atteso 12h", cfg.Backup.Interval)
+	}
+	if !cfg.App.DebugMode {
+		t.Error("--app-debug non applicato")
+	}
+	if cfg.Database.Timeout != 5*time.Second || cfg.Source("database.timeout") != SourceDefault {
+		t.Errorf("database.timeout = %v, atteso default", cfg.Database.Timeout)
+	}
+	if len(cfg.Backup.Targets) != 1 || cfg.Backup.Targets[0].Path != "/media/usb" || cfg.Backup.Targets[0].MaxFiles != 5 {
+		t.Errorf("backup.targets = %+v", cfg.Backup.Targets)
+	}
+	if len(rest) != 1 || rest[0] != "extra" {
+		t.Errorf("argomenti residui = %v", rest)
+	}
+}
+
+func TestLoadErrori(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("OFFICINA_CONFIG", "")
+
+	file := filepath.Join(dir, "officina.toml")
+	os.WriteFile(file, []byte("[database]\nurl = \"mongodb://x\"\n"), 0600)
+
+	if _, _, err := Load([]string{"--config", file}); err == nil || !strings.Contains(err.Error(), "chiave sconosciuta") {
+		t.Errorf("chiave sconosciuta: error = %v", err)
+	}
+
+	os.WriteFile(file, []byte("[app]\nname = [\"a\", \"b\"]\n"), 0600)
+	if _, _, err := Load([]string{"--config", file}); err == nil || !strings.Contains(err.Error(), "app.name") {
+		t.Errorf("array per una chiave semplice: error = %v", err)
+	}
+
+	os.WriteFile(file, []byte("[backup]\nmax_files = 3.5\n"), 0600)
+	if _, _, err := Load([]string{"--config", file}); err == nil || !strings.Contains(err.Error(), "backup.max_files") {
+		t.Errorf("numero decimale: error = %v", err)
+	}
+
+	if _, _, err := Load([]string{"--config", filepath.Join(dir, "mancante.toml")}); err == nil {
+		t.Error("file esplicito mancante: atteso errore")
+	}
+
+	if _, _, err := Load([]string{"--database-uri", "http://x"}); err == nil {
+		t.Error("URI non valido: atteso errore di validazione")
+	}
+
+	t.Setenv("OFFICINA_DATABASE_TIMEOUT", "cinque")
+	if _, _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "OFFICINA_DATABASE_TIMEOUT") {
+		t.Errorf("durata non valida: error = %v", err)
+	}
+}
+
+func TestTemplateRicaricabile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+
+	var buf bytes.Buffer
+	if err := WriteTemplate(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Il template commentato deve essere valido e non cambiare i default
+	doc, err := parseTOML(&buf)
+	if err != nil {
+		t.Fatalf("template non valido: %v", err)
+	}
+	if len(doc.values) != 0 || len(doc.arrays) != 0 {
+		t.Errorf("il template non deve impostare valori: %v", doc.values)
+	}
+
+	// La configurazione mostrata da "config show" deve essere rileggibile
+	cfg := DefaultConfig()
+	cfg.Backup.Targets = []BackupTargetConfig{{Nome: "NAS", Tipo: BackupTargetSFTP, Host: "nas", User: "bk", Port: 22}}
+	buf.Reset()
+	if err := cfg.WriteTOML(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "show.toml")
+	os.WriteFile(file, buf.Bytes(), 0600)
+	loaded := DefaultConfig()
+	if err := loaded.LoadFile(file); err != nil {
+		t.Fatalf("output di WriteTOML non rileggibile: %v\n%s", err, buf.String())
+	}
+	if len(loaded.Backup.Targets) != 1 || loaded.Backup.Targets[0].Port != 22 {
+		t.Errorf("destinazioni rilette = %+v", loaded.Backup.Targets)
+	}
+}
+
+func TestSaveRicaricabile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+
+	cfg := DefaultConfig()
+	cfg.Database.Name = "officina_prova"
+	cfg.App.Name = `Officina "Da Mario" #2`
+	cfg.Backup.Targets = []BackupTargetConfig{{Nome: "S3", Tipo: BackupTargetS3, Endpoint: "http://x", Bucket: "b", SecretKey: "segreto"}}
+	cfg.Webhooks = []WebhookConfig{{Nome: "SMS", URL: "https://sms.local/hook", Secret: "chiave", Eventi: []string{"commessa.chiusa", "fattura.emessa"}}}
+
+	file := filepath.Join(dir, "config", "officina.toml")
+	if err := cfg.Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadFileConfig(file)
+	if err != nil {
+		t.Fatalf("LoadFileConfig() error = %v", err)
+	}
+	if loaded.Database.Name != "officina_prova" || loaded.App.Name != cfg.App.Name {
+		t.Errorf("valori riletti = %+v / %+v", loaded.Database, loaded.App)
+	}
+	if len(loaded.Backup.Targets) != 1 || loaded.Backup.Targets[0].SecretKey != "segreto" {
+		t.Errorf("il salvataggio deve conservare le credenziali: %+v", loaded.Backup.Targets)
+	}
+	if len(loaded.Webhooks) != 1 || loaded.Webhooks[0].Secret != "chiave" || len(loaded.Webhooks[0].Eventi) != 2 {
+		t.Errorf("webhook riletti = %+v", loaded.Webhooks)
+	}
+}
+
+func TestClone(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Backup.Targets = []BackupTargetConfig{{Nome: "USB", Tipo: BackupTargetDir, Path: "/mnt/usb"}}
+	cfg.Webhooks = []WebhookConfig{{Nome: "SMS", URL: "https://sms.local/hook", Eventi: []string{"commessa.chiusa"}}}
+	cfg.setSource("app.session_timeout", SourceFile)
+
+	copia := cfg.Clone()
+	if err := copia.Set("app.session_timeout", "1m"); err != nil {
+		t.Fatal(err)
+	}
+	copia.setSource("app.session_timeout", SourceEnv)
+	copia.Backup.Targets[0].Path = "/mnt/altro"
+	copia.Webhooks[0].Eventi[0] = "fattura.emessa"
+
+	if cfg.App.SessionTimeout == time.Minute || cfg.Source("app.session_timeout") != SourceFile {
+		t.Errorf("la modifica della copia cambia l'originale: %v da %s", cfg.App.SessionTimeout, cfg.Source("app.session_timeout"))
+	}
+	if cfg.Backup.Targets[0].Path != "/mnt/usb" || cfg.Webhooks[0].Eventi[0] != "commessa.chiusa" {
+		t.Errorf("la copia condivide destinazioni o webhook: %+v %+v", cfg.Backup.Targets, cfg.Webhooks)
+	}
+}
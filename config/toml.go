@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Il file di configurazione è letto con github.com/BurntSushi/toml e i
+// valori sono ricondotti al testo accettato da variabili d'ambiente e
+// opzioni, così che tutti gli strati usino le stesse conversioni: stringhe
+// (anche letterali e multilinea), interi e booleani; gli array di valori
+// diventano un elenco separato da virgole.
+
+// tomlValue è il valore di una chiave come testo; list indica un array
+type tomlValue struct {
+	raw  string
+	list bool
+}
+
+// tomlDoc contiene i valori per chiave completa ("database.uri") e gli
+// array di tabelle ("backup.targets")
+type tomlDoc struct {
+	values map[string]tomlValue
+	arrays map[string][]map[string]tomlValue
+}
+
+// parseTOML legge un documento TOML
+func parseTOML(r io.Reader) (*tomlDoc, error) {
+	var data map[string]any
+	if _, err := toml.NewDecoder(r).Decode(&data); err != nil {
+		var pe toml.ParseError
+		if errors.As(err, &pe) {
+			return nil, fmt.Errorf("riga %d: %s", pe.Position.Line, pe.Message)
+		}
+		return nil, err
+	}
+
+	doc := &tomlDoc{
+		values: make(map[string]tomlValue),
+		arrays: make(map[string][]map[string]tomlValue),
+	}
+	if err := doc.add("", data); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// add registra i valori della tabella con il prefisso delle tabelle che la
+// contengono
+func (doc *tomlDoc) add(prefix string, table map[string]any) error {
+	for key, v := range table {
+		full := prefix + key
+		switch v := v.(type) {
+		case map[string]any:
+			if err := doc.add(full+".", v); err != nil {
+				return err
+			}
+		case []map[string]any:
+			for _, t := range v {
+				values, err := tomlTable(full, t)
+				if err != nil {
+					return err
+				}
+				doc.arrays[full] = append(doc.arrays[full], values)
+			}
+		default:
+			value, err := tomlScalar(full, v)
+			if err != nil {
+				return err
+			}
+			doc.values[full] = value
+		}
+	}
+	return nil
+}
+
+// tomlTable converte una tabella di un array di tabelle, che contiene solo
+// valori
+func tomlTable(name string, table map[string]any) (map[string]tomlValue, error) {
+	values := make(map[string]tomlValue, len(table))
+	for key, v := range table {
+		value, err := tomlScalar(name+"."+key, v)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// tomlScalar converte in testo un valore o un array di valori
+func tomlScalar(key string, v any) (tomlValue, error) {
+	if list, ok := v.([]any); ok {
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			s, err := tomlText(key, item)
+			if err != nil {
+				return tomlValue{}, err
+			}
+			items = append(items, s)
+		}
+		return tomlValue{raw: strings.Join(items, ", "), list: true}, nil
+	}
+	s, err := tomlText(key, v)
+	return tomlValue{raw: s}, err
+}
+
+func tomlText(key string, v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("%s: tipo di valore non supportato (%T)", key, v)
+}
+
+// quoteTOML produce una stringa TOML base; a differenza di strconv.Quote
+// usa solo gli escape previsti da TOML
+func quoteTOML(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"officina/config"
+)
+
+// runConfigCommand gestisce "officina config show|init"
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Uso: officina config show [opzioni] | officina config init [--config file] [--force]")
+		return exitUso
+	}
+
+	switch args[0] {
+	case "show":
+		cfg, _, err := config.LoadNoValidate(args[1:])
+		if err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			fmt.Fprintf(os.Stderr, "Errore: %v\n", err)
+			return exitErrore
+		}
+
+		if err := cfg.WriteTOML(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Errore: %v\n", err)
+			return exitErrore
+		}
+
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "\nConfigurazione non valida: %v\n", err)
+			return exitErrore
+		}
+		return exitOK
+
+	case "init":
+		fs := flag.NewFlagSet("config init", flag.ContinueOnError)
+		path := fs.String("config", config.DefaultPath(), "file da creare")
+		force := fs.Bool("force", false, "sovrascrive un file esistente")
+		if err := fs.Parse(args[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitUso
+		}
+
+		if _, err := os.Stat(*path); err == nil && !*force {
+			fmt.Fprintf(os.Stderr, "%s esiste già (usa --force per sovrascriverlo)\n", *path)
+			return exitErrore
+		}
+
+		if err := os.MkdirAll(filepath.Dir(*path), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Errore: %v\n", err)
+			return exitErrore
+		}
+
+		// Il file può contenere credenziali: leggibile solo dall'utente
+		f, err := os.OpenFile(*path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Errore: %v\n", err)
+			return exitErrore
+		}
+		defer f.Close()
+
+		if err := config.WriteTemplate(f); err != nil {
+			fmt.Fprintf(os.Stderr, "Errore: %v\n", err)
+			return exitErrore
+		}
+
+		fmt.Printf("Configurazione creata: %s\n", *path)
+		return exitOK
+	}
+
+	fmt.Fprintf(os.Stderr, "Comando sconosciuto: config %s\n", args[0])
+	return exitUso
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"officina/database"
+	"officina/logger"
+)
+
+// collezioniRichieste valida le collezioni indicate; nessuna significa tutte
+func collezioniRichieste(nomi []string) ([]string, error) {
+	tutte := database.BackupCollections()
+	if len(nomi) == 0 {
+		return tutte, nil
+	}
+
+	for _, n := range nomi {
+		valida := false
+		for _, c := range tutte {
+			valida = valida || c == n
+		}
+		if !valida {
+			return nil, fmt.Errorf("collezione sconosciuta: %s (valide: %s)", n, strings.Join(tutte, ", "))
+		}
+	}
+	return nomi, nil
+}
+
+// runExportCommand gestisce "officina export": ogni collezione viene scritta
+// in DIR/<collezione>.json, nello stesso formato dei backup. Con --dir - e una
+// sola collezione il JSON va su stdout.
+func runExportCommand(args []string) int {
+	opts := newOpzioni("export")
+	dir := opts.fs.String("dir", "", "directory di destinazione (default officina_export_<data>, - per stdout)")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	collezioni, err := collezioniRichieste(opts.args)
+	if err != nil {
+		opts.fail(err)
+		return exitUso
+	}
+	if *dir == "-" && len(collezioni) != 1 {
+		opts.fail(fmt.Errorf("l'export su stdout richiede una sola collezione"))
+		return exitUso
+	}
+
+	_, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	if *dir == "-" {
+		data, err := db.ExportToJSON(collezioni[0])
+		if err != nil {
+			opts.fail(err)
+			return exitErrore
+		}
+		os.Stdout.Write(data)
+		fmt.Println()
+		return exitOK
+	}
+
+	if *dir == "" {
+		*dir = "officina_export_" + time.Now().Format("20060102_150405")
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		opts.fail(fmt.Errorf("impossibile creare directory export: %w", err))
+		return exitErrore
+	}
+
+	type esportata struct {
+		Collection string `json:"collection"`
+		File       string `json:"file"`
+		Bytes      int    `json:"bytes"`
+	}
+	var risultato []esportata
+
+	for _, c := range collezioni {
+		data, err := db.ExportToJSON(c)
+		if err != nil {
+			opts.fail(fmt.Errorf("export %s: %w", c, err))
+			return exitErrore
+		}
+
+		file := filepath.Join(*dir, c+".json")
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			opts.fail(fmt.Errorf("errore scrittura %s: %w", file, err))
+			return exitErrore
+		}
+		risultato = append(risultato, esportata{c, file, len(data)})
+	}
+
+	logger.Info("Export da riga di comando in %s (%d collezioni)", *dir, len(risultato))
+	opts.output(risultato, func() {
+		for _, e := range risultato {
+			fmt.Printf("%-20s → %s\n", e.Collection, e.File)
+		}
+	})
+	return exitOK
+}
+
+// runImportCommand gestisce "officina import": ogni file <collezione>.json
+// (prodotto da export o presente in un backup) viene importato nella
+// collezione omonima, o in quella indicata da --collection
+func runImportCommand(args []string) int {
+	if len(args) > 0 && args[0] == "csv" {
+		return runImportCSV(args[1:])
+	}
+
+	opts := newOpzioni("import")
+	replace := opts.fs.Bool("replace", false, "sovrascrive i record già presenti con lo stesso id")
+	collection := opts.fs.String("collection", "", "collezione di destinazione (default: nome del file)")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	if len(opts.args) == 0 {
+		fmt.Fprintln(os.Stderr, "Uso: officina import [--replace] [--collection NOME] FILE.json...")
+		return exitUso
+	}
+	if *collection != "" && len(opts.args) > 1 {
+		opts.fail(fmt.Errorf("--collection richiede un solo file"))
+		return exitUso
+	}
+
+	// Valida file e collezioni prima di connettersi
+	type sorgente struct {
+		file       string
+		collection string
+	}
+	var sorgenti []sorgente
+	for _, file := range opts.args {
+		c := *collection
+		if c == "" {
+			c = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		if _, err := collezioniRichieste([]string{c}); err != nil {
+			opts.fail(fmt.Errorf("%s: %w", file, err))
+			return exitUso
+		}
+		sorgenti = append(sorgenti, sorgente{file, c})
+	}
+
+	_, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	var reports []*database.ImportReport
+	for _, s := range sorgenti {
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			opts.fail(err)
+			return exitErrore
+		}
+
+		report, err := db.ImportFromJSON(s.collection, data, *replace)
+		if err != nil {
+			opts.fail(fmt.Errorf("%s: %w", s.file, err))
+			return exitErrore
+		}
+		logger.Info("Import da riga di comando: %s → %s (%d inseriti, %d aggiornati, %d saltati)",
+			s.file, s.collection, report.Inseriti, report.Aggiornati, report.Saltati)
+		reports = append(reports, report)
+	}
+
+	opts.output(reports, func() {
+		for _, r := range reports {
+			fmt.Printf("%-20s %d inseriti, %d aggiornati, %d saltati\n", r.Collection, r.Inseriti, r.Aggiornati, r.Saltati)
+		}
+	})
+	return exitOK
+}
+
+// parseMappaCSV interpreta "campo=Intestazione,campo=Intestazione"
+func parseMappaCSV(s string) (map[string]string, error) {
+	mappa := make(map[string]string)
+	if s == "" {
+		return mappa, nil
+	}
+	for _, coppia := range strings.Split(s, ",") {
+		campo, colonna, ok := strings.Cut(coppia, "=")
+		if !ok || strings.TrimSpace(campo) == "" || strings.TrimSpace(colonna) == "" {
+			return nil, fmt.Errorf("mappatura non valida %q: usare campo=Intestazione", coppia)
+		}
+		mappa[strings.TrimSpace(campo)] = strings.TrimSpace(colonna)
+	}
+	return mappa, nil
+}
+
+// runImportCSV gestisce "officina import csv": senza --commit mostra solo
+// cosa verrebbe importato, con --commit scrive tutto in una transazione
+func runImportCSV(args []string) int {
+	opts := newOpzioni("import csv")
+	fileClienti := opts.fs.String("clienti", "", "file CSV dei clienti")
+	fileVeicoli := opts.fs.String("veicoli", "", "file CSV dei veicoli (colonna cliente: codice, P.IVA, CF o nome)")
+	mapClienti := opts.fs.String("map-clienti", "", "colonne clienti, es. ragione_sociale=Nominativo,partita_iva=PIVA")
+	mapVeicoli := opts.fs.String("map-veicoli", "", "colonne veicoli, es. targa=Targa,cliente=CodCli")
+	commit := opts.fs.Bool("commit", false, "esegue l'importazione (default: solo simulazione)")
+	saltaErrori := opts.fs.Bool("salta-errori", false, "con --commit importa le righe valide ignorando quelle con errori")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	if (*fileClienti == "" && *fileVeicoli == "") || len(opts.args) > 0 {
+		fmt.Fprintln(os.Stderr, "Uso: officina import csv --clienti FILE [--veicoli FILE] [--map-clienti ...] [--map-veicoli ...] [--commit [--salta-errori]]")
+		fmt.Fprintf(os.Stderr, "Campi clienti: %s\n", strings.Join(database.CampiClienteCSV, ", "))
+		fmt.Fprintf(os.Stderr, "Campi veicoli: %s\n", strings.Join(database.CampiVeicoloCSV, ", "))
+		return exitUso
+	}
+
+	var importOpts database.CSVImportOptions
+	var err error
+	if importOpts.MappaClienti, err = parseMappaCSV(*mapClienti); err != nil {
+		opts.fail(err)
+		return exitUso
+	}
+	if importOpts.MappaVeicoli, err = parseMappaCSV(*mapVeicoli); err != nil {
+		opts.fail(err)
+		return exitUso
+	}
+	importOpts.SaltaErrori = *saltaErrori
+
+	// Apre i file prima di connettersi al database
+	var clienti, veicoli *os.File
+	if *fileClienti != "" {
+		if clienti, err = os.Open(*fileClienti); err != nil {
+			opts.fail(err)
+			return exitErrore
+		}
+		defer clienti.Close()
+	}
+	if *fileVeicoli != "" {
+		if veicoli, err = os.Open(*fileVeicoli); err != nil {
+			opts.fail(err)
+			return exitErrore
+		}
+		defer veicoli.Close()
+	}
+
+	_, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	// Un *os.File nil dentro un io.Reader non è nil: si passano solo i file aperti
+	var rc, rv io.Reader
+	if clienti != nil {
+		rc = clienti
+	}
+	if veicoli != nil {
+		rv = veicoli
+	}
+
+	report, err := db.ImportCSV(rc, rv, importOpts, *commit)
+	if report == nil {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	if report.Importato {
+		logger.Info("Import CSV da riga di comando: %d clienti e %d veicoli inseriti",
+			report.ClientiNuovi, report.VeicoliNuovi)
+	}
+	opts.output(report, func() { printReportCSV(report) })
+
+	if err != nil {
+		opts.fail(err)
+		if report.HasErrors() {
+			return exitProblemi
+		}
+		return exitErrore
+	}
+	if report.HasErrors() && !report.Importato {
+		return exitProblemi
+	}
+	return exitOK
+}
+
+// printReportCSV stampa il report di un import CSV
+func printReportCSV(r *database.CSVImportReport) {
+	stampaMappa := func(titolo string, m map[string]string) {
+		if len(m) == 0 {
+			return
+		}
+		campi := make([]string, 0, len(m))
+		for campo := range m {
+			campi = append(campi, campo)
+		}
+		sort.Strings(campi)
+		fmt.Printf("Colonne %s:\n", titolo)
+		for _, campo := range campi {
+			fmt.Printf("  %-20s ← %s\n", campo, m[campo])
+		}
+	}
+	stampaMappa("clienti", r.MappaClienti)
+	stampaMappa("veicoli", r.MappaVeicoli)
+	for _, c := range r.ColonneIgnorate {
+		fmt.Printf("  (ignorata) %s\n", c)
+	}
+	fmt.Println()
+
+	for _, riga := range r.Righe {
+		if riga.Esito == database.CSVNuovo {
+			continue
+		}
+		fmt.Printf("%s:%d  %-9s %-20s %s\n", riga.File, riga.Riga, riga.Esito, riga.Chiave, riga.Messaggio)
+	}
+
+	fmt.Printf("\nClienti: %d nuovi, %d già presenti — Veicoli: %d nuovi, %d già presenti — %d duplicati, %d errori\n",
+		r.ClientiNuovi, r.ClientiEsistenti, r.VeicoliNuovi, r.VeicoliEsistenti, r.Duplicati, r.Errori)
+	switch {
+	case r.Importato:
+		fmt.Println("Importazione completata.")
+	case r.HasErrors():
+		fmt.Println("Simulazione: correggere gli errori oppure usare --commit --salta-errori.")
+	default:
+		fmt.Println("Simulazione: nessun dato scritto, usare --commit per importare.")
+	}
+}
@@ -0,0 +1,483 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FatturaAcquisto è una fattura ricevuta da un fornitore, letta dal file
+// FatturaPA (vedi fatturapa.LeggiAcquisti). Un file con più documenti
+// produce una FatturaAcquisto per documento.
+type FatturaAcquisto struct {
+	File      string    `json:"file"`
+	Fornitore Fornitore `json:"fornitore"`
+	// Identificativi del destinatario, da confrontare con il profilo
+	CessionarioPIVA string             `json:"cessionario_piva"`
+	CessionarioCF   string             `json:"cessionario_cf"`
+	Tipo            string             `json:"tipo"` // TipoDocumento, es. TD01
+	Numero          string             `json:"numero"`
+	Data            time.Time          `json:"data"`
+	Totale          float64            `json:"totale"`
+	Scadenze        []ScadenzaAcquisto `json:"scadenze"`
+	Righe           []RigaAcquisto     `json:"righe"`
+}
+
+// ScadenzaAcquisto è una rata di pagamento della fattura ricevuta
+type ScadenzaAcquisto struct {
+	Data    time.Time `json:"data"` // zero se il fornitore non la indica
+	Importo float64   `json:"importo"`
+	Metodo  string    `json:"metodo"` // uno dei MetodoPagamento*
+}
+
+// RigaAcquisto è una linea della fattura ricevuta
+type RigaAcquisto struct {
+	CodiceArticolo string  `json:"codice_articolo"`
+	Descrizione    string  `json:"descrizione"`
+	Quantita       float64 `json:"quantita"`
+	UnitaMisura    string  `json:"unita_misura"`
+	PrezzoUnitario float64 `json:"prezzo_unitario"`
+	Importo        float64 `json:"importo"`
+}
+
+// CaricoMagazzino registra la merce arrivata con una fattura di acquisto
+type CaricoMagazzino struct {
+	ID             int       `json:"id"`
+	Data           time.Time `json:"data"`
+	FornitoreID    int       `json:"fornitore_id"`
+	NumeroFattura  string    `json:"numero_fattura"`
+	CodiceArticolo string    `json:"codice_articolo"`
+	Descrizione    string    `json:"descrizione"`
+	Quantita       float64   `json:"quantita"`
+	UnitaMisura    string    `json:"unita_misura"`
+	PrezzoUnitario float64   `json:"prezzo_unitario"`
+	Importo        float64   `json:"importo"`
+}
+
+// ListCarichiMagazzino restituisce i carichi dal più recente
+func (db *DB) ListCarichiMagazzino() ([]CaricoMagazzino, error) {
+	var list []CaricoMagazzino
+	cursor, err := db.mongo.db.Collection("carichi_magazzino").Find(db.mongo.ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "data", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(db.mongo.ctx)
+	return list, cursor.All(db.mongo.ctx, &list)
+}
+
+// AcquistiImportOptions configura ImportFattureAcquisto
+type AcquistiImportOptions struct {
+	// Magazzino registra un carico per ogni linea con quantità
+	Magazzino bool
+	// SaltaErrori importa le fatture valide anche se altre contengono errori
+	SaltaErrori bool
+}
+
+// DocumentoAcquisto descrive l'esito di una fattura ricevuta
+type DocumentoAcquisto struct {
+	File      string  `json:"file"`
+	Esito     string  `json:"esito"` // CSVNuovo, CSVDuplicato, CSVErrore
+	Fornitore string  `json:"fornitore,omitempty"`
+	Numero    string  `json:"numero,omitempty"`
+	Data      string  `json:"data,omitempty"`
+	Totale    float64 `json:"totale,omitempty"`
+	Messaggio string  `json:"messaggio,omitempty"`
+}
+
+// AcquistiImportReport riassume un'importazione di fatture ricevute,
+// simulata o eseguita
+type AcquistiImportReport struct {
+	FornitoriNuovi     int                 `json:"fornitori_nuovi"`
+	FornitoriEsistenti int                 `json:"fornitori_esistenti"`
+	Movimenti          int                 `json:"movimenti"`
+	Carichi            int                 `json:"carichi"`
+	Duplicati          int                 `json:"duplicati"`
+	Errori             int                 `json:"errori"`
+	Documenti          []DocumentoAcquisto `json:"documenti"`
+	Importato          bool                `json:"importato"`
+}
+
+// HasErrors indica se qualche fattura non può essere importata
+func (r *AcquistiImportReport) HasErrors() bool {
+	return r.Errori > 0
+}
+
+// Errore aggiunge al report un file che non è stato possibile leggere
+func (r *AcquistiImportReport) Errore(file string, err error) {
+	r.Documenti = append(r.Documenti, DocumentoAcquisto{File: file, Esito: CSVErrore, Messaggio: err.Error()})
+	r.Errori++
+}
+
+// ImportFattureAcquisto registra in prima nota le fatture ricevute dai
+// fornitori. Il fornitore è cercato per partita IVA (o codice fiscale) e,
+// se manca, creato con i dati del cedente; le fatture già registrate
+// (stesso fornitore, numero e anno) sono segnalate come duplicati.
+//
+// Ogni rata di pagamento diventa un'uscita con la data di scadenza, le note
+// di credito un'entrata; con Magazzino le linee con quantità diventano
+// carichi. Con commit false nulla viene scritto; con commit true le
+// scritture avvengono in un'unica transazione, rifiutata se ci sono errori
+// (anche di lettura, già nel report) e SaltaErrori è false.
+func (db *DB) ImportFattureAcquisto(fatture []FatturaAcquisto, report *AcquistiImportReport, opts AcquistiImportOptions, commit bool) (*AcquistiImportReport, error) {
+	fornitori, err := db.ListFornitori()
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura fornitori: %w", err)
+	}
+	movimenti, err := db.ListMovimentiPrimaNota(nil)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura prima nota: %w", err)
+	}
+	profilo, err := db.GetProfiloAzienda()
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura profilo: %w", err)
+	}
+
+	imp := newAcquistiImporter(fornitori, movimenti, profilo, report)
+	imp.analizza(fatture, opts)
+
+	report = imp.report
+	if !commit {
+		return report, nil
+	}
+	if report.HasErrors() && !opts.SaltaErrori {
+		return report, fmt.Errorf("%d fatture con errori: correggere i file o importare solo quelle valide", report.Errori)
+	}
+	if len(imp.movimenti) == 0 {
+		return report, nil
+	}
+
+	if err := db.Autorizza(RisorsaMovimenti, PermessoCrea); err != nil {
+		return report, err
+	}
+	if len(imp.nuoviFornitori) > 0 {
+		if err := db.Autorizza(RisorsaFornitori, PermessoCrea); err != nil {
+			return report, err
+		}
+	}
+
+	carichiEsistenti, err := db.ListCarichiMagazzino()
+	if err != nil {
+		return report, fmt.Errorf("errore lettura magazzino: %w", err)
+	}
+
+	// Id liberi come in ImportCSV: molti record nello stesso secondo
+	idFornitori := idLiberi(len(imp.nuoviFornitori), fornitori, func(f Fornitore) int { return f.ID })
+	idMovimenti := idLiberi(len(imp.movimenti), movimenti, func(m MovimentoPrimaNota) int { return m.ID })
+	idCarichi := idLiberi(len(imp.carichi), carichiEsistenti, func(c CaricoMagazzino) int { return c.ID })
+	for i, f := range imp.nuoviFornitori {
+		f.ID = idFornitori[i]
+	}
+	for i, m := range imp.movimenti {
+		m.movimento.ID = idMovimenti[i]
+		m.movimento.FornitoreID = m.fornitore.ID
+	}
+	for i, c := range imp.carichi {
+		c.carico.ID = idCarichi[i]
+		c.carico.FornitoreID = c.fornitore.ID
+	}
+
+	err = db.mongo.db.Client().UseSession(db.mongo.ctx, func(sessionContext mongo.SessionContext) error {
+		if err := sessionContext.StartTransaction(); err != nil {
+			return err
+		}
+
+		for _, f := range imp.nuoviFornitori {
+			if _, err := db.mongo.db.Collection("fornitori").InsertOne(sessionContext, f); err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return fmt.Errorf("errore import fornitore %s: %w", f.RagioneSociale, err)
+			}
+		}
+		for _, m := range imp.movimenti {
+			if _, err := db.mongo.db.Collection("movimenti_primanota").InsertOne(sessionContext, m.movimento); err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return fmt.Errorf("errore import fattura %s: %w", m.movimento.NumeroFattura, err)
+			}
+		}
+		for _, c := range imp.carichi {
+			if _, err := db.mongo.db.Collection("carichi_magazzino").InsertOne(sessionContext, c.carico); err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return fmt.Errorf("errore carico %s: %w", c.carico.Descrizione, err)
+			}
+		}
+
+		return sessionContext.CommitTransaction(sessionContext)
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, f := range imp.nuoviFornitori {
+		db.traccia(AzioneCrea, "fornitori", f.ID)
+	}
+	for _, m := range imp.movimenti {
+		db.traccia(AzioneCrea, "movimenti_primanota", m.movimento.ID)
+		db.emetti(EventoMovimentoRegistrato, "movimenti_primanota", m.movimento.ID, m.movimento)
+	}
+	for _, c := range imp.carichi {
+		db.traccia(AzioneCrea, "carichi_magazzino", c.carico.ID)
+	}
+
+	report.Importato = true
+	return report, nil
+}
+
+// movimentoAcquisto è un movimento da inserire con il fornitore a cui
+// collegarlo, che può essere nuovo e ricevere l'id solo al commit
+type movimentoAcquisto struct {
+	movimento *MovimentoPrimaNota
+	fornitore *Fornitore
+}
+
+type caricoAcquisto struct {
+	carico    *CaricoMagazzino
+	fornitore *Fornitore
+}
+
+// acquistiImporter contiene lo stato dell'analisi
+type acquistiImporter struct {
+	report  *AcquistiImportReport
+	profilo *ProfiloAzienda
+
+	nuoviFornitori []*Fornitore
+	movimenti      []*movimentoAcquisto
+	carichi        []*caricoAcquisto
+
+	perPIVA    map[string]*Fornitore
+	perCF      map[string]*Fornitore
+	registrate map[string]bool // fornitore|numero|anno delle fatture già in prima nota
+	segnalati  map[*Fornitore]bool
+}
+
+func newAcquistiImporter(fornitori []Fornitore, movimenti []MovimentoPrimaNota, profilo *ProfiloAzienda, report *AcquistiImportReport) *acquistiImporter {
+	if report == nil {
+		report = &AcquistiImportReport{}
+	}
+	if report.Documenti == nil {
+		report.Documenti = []DocumentoAcquisto{}
+	}
+	imp := &acquistiImporter{
+		report:     report,
+		profilo:    profilo,
+		perPIVA:    make(map[string]*Fornitore),
+		perCF:      make(map[string]*Fornitore),
+		registrate: make(map[string]bool),
+		segnalati:  make(map[*Fornitore]bool),
+	}
+
+	perID := make(map[int]*Fornitore, len(fornitori))
+	for i := range fornitori {
+		f := &fornitori[i]
+		perID[f.ID] = f
+		imp.indicizza(f)
+	}
+	for _, m := range movimenti {
+		if f, ok := perID[m.FornitoreID]; ok && m.NumeroFattura != "" {
+			imp.registrate[chiaveAcquisto(f, m.NumeroFattura, m.DataFattura)] = true
+		}
+	}
+	return imp
+}
+
+func (imp *acquistiImporter) indicizza(f *Fornitore) {
+	if piva := normalizzaPIVA(f.PartitaIVA); piva != "" {
+		imp.perPIVA[piva] = f
+	}
+	if cf := strings.ToUpper(strings.TrimSpace(f.CodiceFiscale)); cf != "" {
+		imp.perCF[cf] = f
+	}
+}
+
+// chiaveAcquisto identifica una fattura ricevuta: i fornitori ripartono
+// ogni anno con la numerazione
+func chiaveAcquisto(f *Fornitore, numero string, data time.Time) string {
+	return fmt.Sprintf("%p|%s|%d", f, strings.ToUpper(strings.TrimSpace(numero)), data.Year())
+}
+
+func (imp *acquistiImporter) analizza(fatture []FatturaAcquisto, opts AcquistiImportOptions) {
+	for i := range fatture {
+		fa := &fatture[i]
+		doc := DocumentoAcquisto{
+			File:      fa.File,
+			Fornitore: fa.Fornitore.RagioneSociale,
+			Numero:    fa.Numero,
+			Totale:    Arrotonda(fa.Totale),
+		}
+		if !fa.Data.IsZero() {
+			doc.Data = fa.Data.Format("02/01/2006")
+		}
+
+		esito := func(e, format string, args ...interface{}) {
+			doc.Esito = e
+			doc.Messaggio = fmt.Sprintf(format, args...)
+			imp.report.Documenti = append(imp.report.Documenti, doc)
+			switch e {
+			case CSVErrore:
+				imp.report.Errori++
+			case CSVDuplicato:
+				imp.report.Duplicati++
+			}
+		}
+
+		if msg := imp.controlla(fa); msg != "" {
+			esito(CSVErrore, "%s", msg)
+			continue
+		}
+
+		f := imp.fornitore(&fa.Fornitore)
+		chiave := chiaveAcquisto(f, fa.Numero, fa.Data)
+		if imp.registrate[chiave] {
+			esito(CSVDuplicato, "fattura già registrata")
+			continue
+		}
+		imp.registrate[chiave] = true
+
+		switch {
+		case f.ID == 0 && !imp.segnalati[f]:
+			imp.nuoviFornitori = append(imp.nuoviFornitori, f)
+			imp.report.FornitoriNuovi++
+			imp.segnalati[f] = true
+		case f.ID > 0 && !imp.segnalati[f]:
+			imp.report.FornitoriEsistenti++
+			imp.segnalati[f] = true
+		}
+
+		movimenti := imp.registra(fa, f)
+		carichi := 0
+		if opts.Magazzino && fa.Tipo != TipoDocumentoNotaCredito {
+			carichi = imp.carica(fa, f)
+		}
+
+		msg := fmt.Sprintf("%d movimenti", movimenti)
+		if carichi > 0 {
+			msg += fmt.Sprintf(", %d carichi", carichi)
+		}
+		if f.ID == 0 {
+			msg += ", nuovo fornitore"
+		}
+		esito(CSVNuovo, "%s", msg)
+	}
+}
+
+// controlla restituisce il motivo per cui la fattura non può essere
+// registrata, o "" se è valida
+func (imp *acquistiImporter) controlla(fa *FatturaAcquisto) string {
+	ced := &fa.Fornitore
+	pivaCedente := normalizzaPIVA(ced.PartitaIVA)
+	pivaOfficina := normalizzaPIVA(imp.profilo.PartitaIVA)
+
+	switch {
+	case pivaCedente == "" && strings.TrimSpace(ced.CodiceFiscale) == "":
+		return "fornitore senza partita IVA né codice fiscale"
+	case strings.TrimSpace(fa.Numero) == "":
+		return "numero della fattura mancante"
+	case fa.Data.IsZero():
+		return "data della fattura mancante"
+	case fa.Totale <= 0:
+		return "importo della fattura non positivo"
+	case pivaOfficina != "" && pivaCedente == pivaOfficina:
+		return "fattura emessa dall'officina, non ricevuta"
+	}
+
+	// La fattura deve essere intestata all'officina
+	if pivaOfficina != "" || imp.profilo.CodiceFiscale != "" {
+		intestata := (pivaOfficina != "" && normalizzaPIVA(fa.CessionarioPIVA) == pivaOfficina) ||
+			(imp.profilo.CodiceFiscale != "" && strings.EqualFold(fa.CessionarioCF, imp.profilo.CodiceFiscale))
+		if !intestata {
+			return "fattura intestata a un altro destinatario (" + strings.TrimSpace(fa.CessionarioPIVA+" "+fa.CessionarioCF) + ")"
+		}
+	}
+
+	if err := ced.Validate(); err != nil {
+		return "fornitore: " + err.Error()
+	}
+	return ""
+}
+
+// fornitore cerca il cedente tra i fornitori noti o lo aggiunge ai nuovi
+func (imp *acquistiImporter) fornitore(ced *Fornitore) *Fornitore {
+	if f, ok := imp.perPIVA[normalizzaPIVA(ced.PartitaIVA)]; ok {
+		return f
+	}
+	if f, ok := imp.perCF[strings.ToUpper(strings.TrimSpace(ced.CodiceFiscale))]; ok {
+		return f
+	}
+	f := *ced
+	f.ID = 0
+	imp.indicizza(&f)
+	return &f
+}
+
+// registra aggiunge un movimento per ogni rata; senza rate, un movimento
+// per il totale alla data della fattura. Restituisce il numero di movimenti.
+func (imp *acquistiImporter) registra(fa *FatturaAcquisto, f *Fornitore) int {
+	tipo := TipoMovimentoUscita
+	descrizione := "Fattura " + fa.Numero + " " + f.RagioneSociale
+	if fa.Tipo == TipoDocumentoNotaCredito {
+		// Il fornitore restituisce l'importo: in prima nota è un'entrata
+		tipo = TipoMovimentoEntrata
+		descrizione = "Nota di credito " + fa.Numero + " " + f.RagioneSociale
+	}
+
+	scadenze := fa.Scadenze
+	if len(scadenze) == 0 {
+		scadenze = []ScadenzaAcquisto{{Importo: fa.Totale, Metodo: MetodoPagamentoBanca}}
+	}
+
+	n := 0
+	for i, s := range scadenze {
+		if s.Importo <= 0 {
+			continue
+		}
+		m := &MovimentoPrimaNota{
+			Data:          s.Data,
+			Descrizione:   descrizione,
+			Tipo:          tipo,
+			Importo:       Arrotonda(s.Importo),
+			Metodo:        s.Metodo,
+			NumeroFattura: fa.Numero,
+			DataFattura:   fa.Data,
+		}
+		if m.Data.IsZero() {
+			m.Data = fa.Data
+		}
+		if m.Metodo == "" {
+			m.Metodo = MetodoPagamentoBanca
+		}
+		if len(scadenze) > 1 {
+			m.Descrizione += fmt.Sprintf(" (rata %d/%d)", i+1, len(scadenze))
+		}
+		imp.movimenti = append(imp.movimenti, &movimentoAcquisto{movimento: m, fornitore: f})
+		n++
+	}
+	imp.report.Movimenti += n
+	return n
+}
+
+// carica aggiunge un carico per ogni linea con quantità
+func (imp *acquistiImporter) carica(fa *FatturaAcquisto, f *Fornitore) int {
+	n := 0
+	for _, r := range fa.Righe {
+		if r.Quantita <= 0 {
+			continue
+		}
+		c := &CaricoMagazzino{
+			Data:           fa.Data,
+			NumeroFattura:  fa.Numero,
+			CodiceArticolo: r.CodiceArticolo,
+			Descrizione:    r.Descrizione,
+			Quantita:       r.Quantita,
+			UnitaMisura:    r.UnitaMisura,
+			PrezzoUnitario: r.PrezzoUnitario,
+			Importo:        Arrotonda(r.Importo),
+		}
+		imp.carichi = append(imp.carichi, &caricoAcquisto{carico: c, fornitore: f})
+		n++
+	}
+	imp.report.Carichi += n
+	return n
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalizzaAcquisti(t *testing.T) {
+	marzo := time.Date(2026, 3, 31, 0, 0, 0, 0, time.Local)
+	profilo := &ProfiloAzienda{RagioneSociale: "Officina Rossi", PartitaIVA: "12345678903"}
+	fornitori := []Fornitore{{ID: 7, RagioneSociale: "Ricambi Verdi", PartitaIVA: "IT01234567897"}}
+	movimenti := []MovimentoPrimaNota{{ID: 1, FornitoreID: 7, NumeroFattura: "FV/100", DataFattura: marzo}}
+
+	acquisto := func(ragione, piva, numero string, totale float64) FatturaAcquisto {
+		return FatturaAcquisto{
+			File:            numero + ".xml",
+			Fornitore:       Fornitore{RagioneSociale: ragione, PartitaIVA: piva},
+			CessionarioPIVA: "12345678903",
+			Tipo:            "TD01",
+			Numero:          numero,
+			Data:            marzo,
+			Totale:          totale,
+		}
+	}
+
+	rate := acquisto("Ricambi Verdi S.r.l.", "01234567897", "FV/318", 122)
+	rate.Scadenze = []ScadenzaAcquisto{
+		{Data: marzo.AddDate(0, 1, 0), Importo: 61, Metodo: MetodoPagamentoBonifico},
+		{Importo: 61},
+	}
+	rate.Righe = []RigaAcquisto{
+		{Descrizione: "Filtro olio", Quantita: 4, PrezzoUnitario: 8.5, Importo: 34},
+		{Descrizione: "Spese di trasporto", Importo: 66},
+	}
+	nota := acquisto("Gomme Blu", "09876543210", "NC1", 50)
+	nota.Tipo = TipoDocumentoNotaCredito
+	nota.Righe = []RigaAcquisto{{Descrizione: "Reso pneumatico", Quantita: 1, Importo: 50}}
+	altroDestinatario := acquisto("Gomme Blu", "09876543210", "GB/9", 10)
+	altroDestinatario.CessionarioPIVA = "11111111111"
+
+	fatture := []FatturaAcquisto{
+		rate,
+		acquisto("Ricambi Verdi S.r.l.", "01234567897", "FV/100", 80), // già registrata
+		nota,
+		acquisto("Gomme Blu", "IT09876543210", "GB/7", 30),
+		acquisto("Gomme Blu", "09876543210", "GB/7", 30), // ripetuta nella cartella
+		altroDestinatario,
+		acquisto("Officina Rossi", "12345678903", "1", 10), // emessa dall'officina
+	}
+
+	imp := newAcquistiImporter(fornitori, movimenti, profilo, nil)
+	imp.analizza(fatture, AcquistiImportOptions{Magazzino: true})
+	r := imp.report
+
+	attesi := []string{CSVNuovo, CSVDuplicato, CSVNuovo, CSVNuovo, CSVDuplicato, CSVErrore, CSVErrore}
+	for i, d := range r.Documenti {
+		if i >= len(attesi) || d.Esito != attesi[i] {
+			t.Errorf("documento %d (%s) = %s %q", i, d.Numero, d.Esito, d.Messaggio)
+		}
+	}
+	if r.FornitoriNuovi != 1 || r.FornitoriEsistenti != 1 || r.Duplicati != 2 || r.Errori != 2 {
+		t.Errorf("report = %+v", r)
+	}
+
+	// Rate: due uscite sul fornitore esistente, la seconda alla data fattura
+	if len(imp.movimenti) != 4 || r.Movimenti != 4 {
+		t.Fatalf("movimenti = %d", len(imp.movimenti))
+	}
+	m := imp.movimenti[1]
+	if m.fornitore.ID != 7 || m.movimento.Tipo != TipoMovimentoUscita || !m.movimento.Data.Equal(marzo) ||
+		m.movimento.Metodo != MetodoPagamentoBanca || m.movimento.Descrizione != "Fattura FV/318 Ricambi Verdi (rata 2/2)" {
+		t.Errorf("rata 2 = %+v", m.movimento)
+	}
+	for _, m := range imp.movimenti {
+		if err := m.movimento.Validate(); err != nil {
+			t.Errorf("movimento %s: %v", m.movimento.Descrizione, err)
+		}
+	}
+
+	// La nota di credito è un'entrata e crea il fornitore, riusato da GB/7
+	if nc := imp.movimenti[2]; nc.movimento.Tipo != TipoMovimentoEntrata || nc.fornitore != imp.movimenti[3].fornitore {
+		t.Errorf("nota di credito = %+v", nc.movimento)
+	}
+
+	// Carichi solo per le righe con quantità delle fatture
+	if len(imp.carichi) != 1 || imp.carichi[0].carico.Descrizione != "Filtro olio" || imp.carichi[0].fornitore.ID != 7 {
+		t.Errorf("carichi = %+v", imp.carichi)
+	}
+}
+
+// TestDeleteFornitoreCascade elimina un fornitore con movimenti e carichi
+// e controlla che restino solo quelli degli altri fornitori
+func TestDeleteFornitoreCascade(t *testing.T) {
+	db := mongoDiTest(t)
+
+	var fornitori []*Fornitore
+	for _, nome := range []string{"Ricambi Verdi", "Gomme Neri"} {
+		f := &Fornitore{RagioneSociale: nome}
+		if err := db.CreateFornitore(f); err != nil {
+			t.Fatal(err)
+		}
+		fornitori = append(fornitori, f)
+	}
+	data := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local)
+	for i, f := range fornitori {
+		mov := &MovimentoPrimaNota{Data: data, Descrizione: "Fattura " + f.RagioneSociale, Tipo: TipoMovimentoUscita, Importo: 100, Metodo: MetodoPagamentoBanca, FornitoreID: f.ID}
+		if err := db.CreateMovimentoPrimaNota(mov); err != nil {
+			t.Fatal(err)
+		}
+		carico := CaricoMagazzino{ID: i + 1, Data: data, FornitoreID: f.ID, Descrizione: "Filtro olio", Quantita: 2}
+		if _, err := db.mongo.db.Collection("carichi_magazzino").InsertOne(db.mongo.ctx, carico); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.DeleteFornitore(fornitori[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	carichi, err := db.ListCarichiMagazzino()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(carichi) != 1 || carichi[0].FornitoreID != fornitori[1].ID {
+		t.Errorf("carichi = %+v, atteso solo quello del fornitore #%d", carichi, fornitori[1].ID)
+	}
+	movimenti, err := db.ListMovimentiPrimaNota(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movimenti) != 1 || movimenti[0].FornitoreID != fornitori[1].ID {
+		t.Errorf("movimenti = %+v, atteso solo quello del fornitore #%d", movimenti, fornitori[1].ID)
+	}
+}
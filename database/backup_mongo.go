@@ -10,14 +10,38 @@ import (
 	"strings"
 	"time"
 
+	"officina/logger"
+
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// backupCollections elenca le collezioni incluse in ogni backup
+var backupCollections = []string{
+	"clienti",
+	"fornitori",
+	"veicoli",
+	"commesse",
+	"appuntamenti",
+	"operatori",
+	"preventivi",
+	"fatture",
+	"movimenti_primanota",
+	"profilo_azienda",
+	"contatori",
+	"carichi_magazzino",
+}
+
+// BackupCollections restituisce l'elenco delle collezioni incluse nei backup
+func BackupCollections() []string {
+	return append([]string(nil), backupCollections...)
+}
+
 // BackupManagerMongo gestisce i backup del database MongoDB tramite JSON export
 type BackupManagerMongo struct {
 	db       *DB
 	basePath string
 	maxFiles int
+	targets  []ReplicaTarget
 }
 
 // NewBackupManagerMongo crea un nuovo gestore di backup per MongoDB
@@ -29,8 +53,28 @@ func NewBackupManagerMongo(db *DB, basePath string, maxFiles int) *BackupManager
 	}
 }
 
+// BackupProgressFunc riceve l'avanzamento di un backup: la collezione appena
+// esportata, quante ne sono state completate e il totale
+type BackupProgressFunc func(collection string, fatte, totale int)
+
 // CreateBackup crea un backup di tutte le collezioni MongoDB in formato JSON
 func (bm *BackupManagerMongo) CreateBackup() (string, error) {
+	return bm.CreateBackupProgress(nil)
+}
+
+// CreateBackupProgress crea un backup notificando l'avanzamento collezione per collezione
+func (bm *BackupManagerMongo) CreateBackupProgress(progress BackupProgressFunc) (string, error) {
+	return bm.creaBackup(progress, true)
+}
+
+// CreateLocalBackup crea il backup senza replicarlo sulle destinazioni
+// esterne: la replica, che può richiedere tempo, si esegue a parte con
+// ReplicateBackup
+func (bm *BackupManagerMongo) CreateLocalBackup() (string, error) {
+	return bm.creaBackup(nil, false)
+}
+
+func (bm *BackupManagerMongo) creaBackup(progress BackupProgressFunc, replica bool) (string, error) {
 	// Crea la directory di backup se non esiste
 	if err := os.MkdirAll(bm.basePath, 0755); err != nil {
 		return "", fmt.Errorf("impossibile creare directory backup: %w", err)
@@ -44,25 +88,24 @@ func (bm *BackupManagerMongo) CreateBackup() (string, error) {
 		return "", fmt.Errorf("impossibile creare directory backup: %w", err)
 	}
 
-	// Lista delle collezioni da esportare
-	collections := []string{
-		"clienti",
-		"fornitori",
-		"veicoli",
-		"commesse",
-		"appuntamenti",
-		"operatori",
-		"preventivi",
-		"fatture",
-		"movimenti_primanota",
+	metadata := backupMetadata{
+		Timestamp:   timestamp,
+		Collections: BackupCollections(),
+		Version:     "2.0.0",
+		Documents:   make(map[string]int),
+		Checksums:   make(map[string]string),
 	}
 
 	// Esporta ogni collezione in un file JSON separato
-	for _, collection := range collections {
+	for i, collection := range metadata.Collections {
+		if progress != nil {
+			progress(collection, i, len(metadata.Collections))
+		}
+
 		data, err := bm.db.ExportToJSON(collection)
 		if err != nil {
 			// Continua anche se una collezione fallisce
-			fmt.Printf("Warning: errore export collection %s: %v\n", collection, err)
+			logger.Warn("Errore export collection %s: %v", collection, err)
 			continue
 		}
 
@@ -70,15 +113,19 @@ func (bm *BackupManagerMongo) CreateBackup() (string, error) {
 		if err := os.WriteFile(backupFile, data, 0644); err != nil {
 			return backupDir, fmt.Errorf("errore scrittura backup %s: %w", collection, err)
 		}
+
+		var docs []json.RawMessage
+		if err := json.Unmarshal(data, &docs); err == nil {
+			metadata.Documents[collection] = len(docs)
+		}
+		metadata.Checksums[collection] = checksum(data)
 	}
 
-	// Crea file di metadati
-	metadata := map[string]interface{}{
-		"timestamp":   timestamp,
-		"collections": collections,
-		"version":     "2.0.0",
+	if progress != nil {
+		progress("", len(metadata.Collections), len(metadata.Collections))
 	}
 
+	// Crea file di metadati
 	metadataBytes, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		return backupDir, fmt.Errorf("errore creazione metadati: %w", err)
@@ -94,6 +141,14 @@ func (bm *BackupManagerMongo) CreateBackup() (string, error) {
 		return backupDir, fmt.Errorf("backup creato ma pulizia fallita: %w", err)
 	}
 
+	// Replica sulle destinazioni esterne configurate
+	if !replica {
+		return backupDir, nil
+	}
+	if err := bm.ReplicateBackup(backupDir); err != nil {
+		return backupDir, fmt.Errorf("backup creato ma %w", err)
+	}
+
 	return backupDir, nil
 }
 
@@ -156,25 +211,92 @@ func (bm *BackupManagerMongo) ListBackups() ([]string, error) {
 	return backups, nil
 }
 
-// RestoreBackup ripristina il database da una directory di backup JSON
-func (bm *BackupManagerMongo) RestoreBackup(backupDir string) error {
+// backupMetadata descrive il contenuto di metadata.json
+type backupMetadata struct {
+	Timestamp   string            `json:"timestamp"`
+	Collections []string          `json:"collections"`
+	Version     string            `json:"version"`
+	Documents   map[string]int    `json:"documents,omitempty"`
+	Checksums   map[string]string `json:"checksums,omitempty"`
+}
+
+// readBackupMetadata legge i metadati di una directory di backup
+func readBackupMetadata(backupDir string) (*backupMetadata, error) {
 	// Verifica che la directory di backup esista
 	if _, err := os.Stat(backupDir); os.IsNotExist(err) {
-		return fmt.Errorf("directory di backup non trovata: %s", backupDir)
+		return nil, fmt.Errorf("directory di backup non trovata: %s", backupDir)
 	}
 
-	// Leggi metadati
 	metadataFile := filepath.Join(backupDir, "metadata.json")
 	metadataBytes, err := os.ReadFile(metadataFile)
 	if err != nil {
-		return fmt.Errorf("impossibile leggere metadati: %w", err)
+		return nil, fmt.Errorf("impossibile leggere metadati: %w", err)
 	}
 
-	var metadata struct {
-		Collections []string `json:"collections"`
-	}
+	var metadata backupMetadata
 	if err := json.Unmarshal(metadataBytes, &metadata); err != nil {
-		return fmt.Errorf("errore parsing metadati: %w", err)
+		return nil, fmt.Errorf("errore parsing metadati: %w", err)
+	}
+
+	return &metadata, nil
+}
+
+// CollezioniBackup restituisce le collezioni contenute in un backup. I backup
+// delle versioni precedenti non includono le collezioni aggiunte in seguito,
+// quindi un ripristino di tutto il backup va limitato a questo elenco.
+func (bm *BackupManagerMongo) CollezioniBackup(backupDir string) ([]string, error) {
+	metadata, err := readBackupMetadata(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.Collections, nil
+}
+
+// loadBackupCollection legge i documenti di una collezione da un backup.
+// I file contengono un array JSON di documenti Extended JSON canonici, per cui
+// ogni elemento va decodificato con UnmarshalExtJSON per conservare i tipi BSON
+// (date, interi a 32/64 bit).
+func loadBackupCollection(backupDir, collection string) ([]bson.D, error) {
+	backupFile := filepath.Join(backupDir, fmt.Sprintf("%s.json", collection))
+	data, err := os.ReadFile(backupFile)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura backup %s: %w", collection, err)
+	}
+
+	return parseExtJSONArray(data, collection)
+}
+
+// parseExtJSONArray decodifica un array JSON di documenti Extended JSON,
+// il formato prodotto da ExportToJSON
+func parseExtJSONArray(data []byte, collection string) ([]bson.D, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("errore parsing JSON %s: %w", collection, err)
+	}
+
+	docs := make([]bson.D, 0, len(raw))
+	for i, r := range raw {
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(r, true, &doc); err != nil {
+			return nil, fmt.Errorf("errore parsing documento %d di %s: %w", i, collection, err)
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// RestoreBackup ripristina il database da una directory di backup JSON,
+// sostituendo integralmente le collezioni presenti nel backup.
+// Per un ripristino parziale vedi RestoreSelective.
+func (bm *BackupManagerMongo) RestoreBackup(backupDir string) error {
+	if err := bm.db.Autorizza(RisorsaBackup, PermessoModifica); err != nil {
+		return err
+	}
+
+	metadata, err := readBackupMetadata(backupDir)
+	if err != nil {
+		return err
 	}
 
 	ctx := context.Background()
@@ -185,25 +307,19 @@ func (bm *BackupManagerMongo) RestoreBackup(backupDir string) error {
 
 		// Verifica che il file esista
 		if _, err := os.Stat(backupFile); os.IsNotExist(err) {
-			fmt.Printf("Warning: file backup mancante per collection %s\n", collection)
+			logger.Warn("File backup mancante per collection %s", collection)
 			continue
 		}
 
-		// Leggi file JSON
-		data, err := os.ReadFile(backupFile)
+		docs, err := loadBackupCollection(backupDir, collection)
 		if err != nil {
-			return fmt.Errorf("errore lettura backup %s: %w", collection, err)
-		}
-
-		// Parse JSON array
-		var docs []bson.M
-		if err := json.Unmarshal(data, &docs); err != nil {
-			return fmt.Errorf("errore parsing JSON %s: %w", collection, err)
+			return err
 		}
 
-		// Cancella collezione esistente
-		if err := bm.db.mongo.db.Collection(collection).Drop(ctx); err != nil {
-			fmt.Printf("Warning: impossibile droppare collection %s: %v\n", collection, err)
+		// Svuota la collezione senza eliminarla: Drop cancellerebbe anche gli
+		// indici, compresi quelli univoci come contatori.chiave
+		if _, err := bm.db.mongo.db.Collection(collection).DeleteMany(ctx, bson.M{}); err != nil {
+			return fmt.Errorf("errore svuotamento collection %s: %w", collection, err)
 		}
 
 		// Importa documenti
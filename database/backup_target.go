@@ -0,0 +1,229 @@
+package database
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"officina/config"
+)
+
+// BackupTarget è una destinazione esterna su cui replicare i backup.
+// Ogni backup viene caricato come singolo archivio officina_backup_<timestamp>.tar.gz.
+type BackupTarget interface {
+	// Name identifica la destinazione nei messaggi e nei log
+	Name() string
+	// Upload carica il file locale con il nome di archivio indicato
+	Upload(archiveName, localPath string) error
+	// List restituisce i nomi degli archivi presenti sulla destinazione
+	List() ([]string, error)
+	// Delete rimuove un archivio dalla destinazione
+	Delete(archiveName string) error
+}
+
+// ReplicaTarget associa una destinazione alla sua politica di conservazione
+type ReplicaTarget struct {
+	Target   BackupTarget
+	MaxFiles int
+}
+
+// AddTarget registra una destinazione su cui replicare ogni nuovo backup,
+// conservando al massimo maxFiles archivi (0 = nessun limite)
+func (bm *BackupManagerMongo) AddTarget(target BackupTarget, maxFiles int) {
+	bm.targets = append(bm.targets, ReplicaTarget{Target: target, MaxFiles: maxFiles})
+}
+
+// Targets restituisce le destinazioni di replica configurate
+func (bm *BackupManagerMongo) Targets() []ReplicaTarget {
+	return bm.targets
+}
+
+// NewBackupManagerFromConfig crea il gestore di backup con le destinazioni
+// di replica definite nella configurazione
+func NewBackupManagerFromConfig(db *DB, cfg *config.Config) (*BackupManagerMongo, error) {
+	bm := NewBackupManagerMongo(db, cfg.App.BackupPath, cfg.Backup.MaxFiles)
+
+	for _, tc := range cfg.Backup.Targets {
+		target, err := NewBackupTarget(tc)
+		if err != nil {
+			return bm, err
+		}
+		bm.AddTarget(target, tc.MaxFiles)
+	}
+
+	return bm, nil
+}
+
+// NewBackupTarget crea una destinazione di replica dalla sua configurazione
+func NewBackupTarget(tc config.BackupTargetConfig) (BackupTarget, error) {
+	switch tc.Tipo {
+	case config.BackupTargetDir:
+		if tc.Path == "" {
+			return nil, fmt.Errorf("destinazione %s: path obbligatorio", tc.Nome)
+		}
+		return &DirTarget{Nome: tc.Nome, Path: tc.Path}, nil
+
+	case config.BackupTargetSFTP:
+		if tc.Host == "" || tc.User == "" {
+			return nil, fmt.Errorf("destinazione %s: host e user obbligatori", tc.Nome)
+		}
+		return &SFTPTarget{
+			Nome:      tc.Nome,
+			Host:      tc.Host,
+			Port:      tc.Port,
+			User:      tc.User,
+			KeyFile:   tc.KeyFile,
+			RemoteDir: tc.RemoteDir,
+		}, nil
+
+	case config.BackupTargetS3:
+		if tc.Endpoint == "" || tc.Bucket == "" {
+			return nil, fmt.Errorf("destinazione %s: endpoint e bucket obbligatori", tc.Nome)
+		}
+		return &S3Target{
+			Nome:      tc.Nome,
+			Endpoint:  tc.Endpoint,
+			Region:    tc.Region,
+			Bucket:    tc.Bucket,
+			Prefix:    tc.Prefix,
+			AccessKey: tc.AccessKey,
+			SecretKey: tc.SecretKey,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("destinazione %s: tipo sconosciuto %q", tc.Nome, tc.Tipo)
+}
+
+// ReplicateBackup carica un backup su tutte le destinazioni configurate e
+// applica la politica di conservazione di ciascuna. Un errore su una
+// destinazione non blocca le altre.
+func (bm *BackupManagerMongo) ReplicateBackup(backupDir string) error {
+	if len(bm.targets) == 0 {
+		return nil
+	}
+
+	archive, err := os.CreateTemp("", "officina_backup_*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("impossibile creare archivio temporaneo: %w", err)
+	}
+	archivePath := archive.Name()
+	defer os.Remove(archivePath)
+
+	if err := writeBackupArchive(archive, backupDir); err != nil {
+		archive.Close()
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("errore chiusura archivio: %w", err)
+	}
+
+	archiveName := filepath.Base(backupDir) + ".tar.gz"
+
+	var failures []string
+	for _, rt := range bm.targets {
+		if err := rt.Target.Upload(archiveName, archivePath); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", rt.Target.Name(), err))
+			continue
+		}
+		if err := pruneTarget(rt); err != nil {
+			failures = append(failures, fmt.Sprintf("%s (pulizia): %v", rt.Target.Name(), err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("replica fallita su %s", strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// pruneTarget elimina gli archivi più vecchi oltre il limite della destinazione
+func pruneTarget(rt ReplicaTarget) error {
+	if rt.MaxFiles <= 0 {
+		return nil
+	}
+
+	names, err := rt.Target.List()
+	if err != nil {
+		return err
+	}
+
+	var archives []string
+	for _, name := range names {
+		if isBackupArchive(name) {
+			archives = append(archives, name)
+		}
+	}
+
+	if len(archives) <= rt.MaxFiles {
+		return nil
+	}
+
+	// Il timestamp nel nome garantisce l'ordinamento cronologico
+	sort.Strings(archives)
+	for _, name := range archives[:len(archives)-rt.MaxFiles] {
+		if err := rt.Target.Delete(name); err != nil {
+			return fmt.Errorf("impossibile eliminare %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// isBackupArchive verifica che un nome corrisponda a un archivio di backup
+func isBackupArchive(name string) bool {
+	return strings.HasPrefix(name, "officina_backup_") && strings.HasSuffix(name, ".tar.gz")
+}
+
+// writeBackupArchive comprime una directory di backup in formato tar.gz
+func writeBackupArchive(w io.Writer, backupDir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	root := filepath.Base(backupDir)
+
+	err := filepath.Walk(backupDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(backupDir, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(filepath.Join(root, rel))
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("errore creazione archivio: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("errore chiusura tar: %w", err)
+	}
+	return gz.Close()
+}
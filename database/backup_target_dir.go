@@ -0,0 +1,87 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DirTarget replica i backup in una directory locale, tipicamente un disco
+// USB o una condivisione di rete montata
+type DirTarget struct {
+	Nome string
+	Path string
+}
+
+// Name implementa BackupTarget
+func (t *DirTarget) Name() string {
+	if t.Nome != "" {
+		return t.Nome
+	}
+	return t.Path
+}
+
+// Upload implementa BackupTarget. La directory deve già esistere: se il disco
+// non è montato il backup non deve finire sul disco locale al suo posto.
+func (t *DirTarget) Upload(archiveName, localPath string) error {
+	info, err := os.Stat(t.Path)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("destinazione %s non disponibile (disco non montato?)", t.Path)
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Scrive su un file temporaneo e rinomina, per non lasciare archivi troncati
+	finalPath := filepath.Join(t.Path, archiveName)
+	tmpPath := finalPath + ".part"
+
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("impossibile creare %s: %w", tmpPath, err)
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("errore copia su %s: %w", t.Path, err)
+	}
+
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("errore scrittura su %s: %w", t.Path, err)
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, finalPath)
+}
+
+// List implementa BackupTarget
+func (t *DirTarget) List() ([]string, error) {
+	entries, err := os.ReadDir(t.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// Delete implementa BackupTarget
+func (t *DirTarget) Delete(archiveName string) error {
+	return os.Remove(filepath.Join(t.Path, filepath.Base(archiveName)))
+}
@@ -0,0 +1,302 @@
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Target replica i backup su uno storage compatibile S3 (AWS, MinIO,
+// Backblaze B2, Wasabi...). Le richieste usano l'indirizzamento path-style
+// (endpoint/bucket/chiave), supportato da tutti i provider compatibili.
+type S3Target struct {
+	Nome      string
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+
+	// Client HTTP usato per le richieste; nil = http.DefaultClient
+	Client *http.Client
+}
+
+// Name implementa BackupTarget
+func (t *S3Target) Name() string {
+	if t.Nome != "" {
+		return t.Nome
+	}
+	return fmt.Sprintf("s3://%s/%s", t.Bucket, t.Prefix)
+}
+
+// Upload implementa BackupTarget
+func (t *S3Target) Upload(archiveName, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// La firma richiede l'hash del contenuto: si legge il file due volte
+	// invece di caricarlo in memoria
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, t.objectURL(archiveName, nil), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/gzip")
+
+	_, err = t.do(req, hex.EncodeToString(h.Sum(nil)))
+	return err
+}
+
+// s3ListResult è la risposta di ListObjectsV2
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List implementa BackupTarget
+func (t *S3Target) List() ([]string, error) {
+	var names []string
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if prefix := t.keyPrefix(); prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, t.objectURL("", query), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := t.do(req, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("risposta elenco non valida: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			names = append(names, path.Base(obj.Key))
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	return names, nil
+}
+
+// Delete implementa BackupTarget
+func (t *S3Target) Delete(archiveName string) error {
+	req, err := http.NewRequest(http.MethodDelete, t.objectURL(archiveName, nil), nil)
+	if err != nil {
+		return err
+	}
+	_, err = t.do(req, emptyPayloadHash)
+	return err
+}
+
+// keyPrefix restituisce il prefisso delle chiavi, terminato da "/"
+func (t *S3Target) keyPrefix() string {
+	p := strings.Trim(t.Prefix, "/")
+	if p == "" {
+		return ""
+	}
+	return p + "/"
+}
+
+// objectURL costruisce l'URL path-style di un oggetto (o del bucket se
+// archiveName è vuoto)
+func (t *S3Target) objectURL(archiveName string, query url.Values) string {
+	u := strings.TrimRight(t.Endpoint, "/") + "/" + t.Bucket
+	if archiveName != "" {
+		u += "/" + s3Escape(t.keyPrefix()+archiveName, false)
+	}
+	if len(query) > 0 {
+		u += "?" + s3Query(query)
+	}
+	return u
+}
+
+// do firma ed esegue una richiesta, restituendo il corpo della risposta
+func (t *S3Target) do(req *http.Request, payloadHash string) ([]byte, error) {
+	t.sign(req, payloadHash, time.Now().UTC())
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("connessione a %s fallita: %w", t.Endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var s3err struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(body, &s3err) == nil && s3err.Code != "" {
+			return nil, fmt.Errorf("%s: %s (%s)", resp.Status, s3err.Message, s3err.Code)
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	return body, nil
+}
+
+// emptyPayloadHash è lo SHA-256 di un corpo vuoto
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign aggiunge alla richiesta la firma AWS Signature Version 4
+func (t *S3Target) sign(req *http.Request, payloadHash string, now time.Time) {
+	region := t.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	// Header firmati: host più tutti gli x-amz-* e quelli già impostati
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalPath := req.URL.EscapedPath()
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		s3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		checksum([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+t.SecretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.AccessKey, scope, signedHeaders, signature))
+}
+
+// s3Query codifica la query string in forma canonica (chiavi ordinate,
+// spazi come %20)
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape applica l'URI encoding richiesto da SigV4; i "/" vengono
+// codificati solo nei parametri della query
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
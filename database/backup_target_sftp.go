@@ -0,0 +1,111 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SFTPTarget replica i backup su un server SFTP usando il client OpenSSH
+// di sistema in modalità batch. L'autenticazione avviene tramite chiave
+// (KeyFile o ssh-agent): le password non sono supportate.
+type SFTPTarget struct {
+	Nome      string
+	Host      string
+	Port      int
+	User      string
+	KeyFile   string
+	RemoteDir string
+}
+
+// Name implementa BackupTarget
+func (t *SFTPTarget) Name() string {
+	if t.Nome != "" {
+		return t.Nome
+	}
+	return fmt.Sprintf("sftp://%s@%s", t.User, t.Host)
+}
+
+// Upload implementa BackupTarget
+func (t *SFTPTarget) Upload(archiveName, localPath string) error {
+	remote := t.remotePath(archiveName)
+	_, err := t.run(fmt.Sprintf("put %s %s\nrename %s %s\n",
+		quoteSFTP(localPath), quoteSFTP(remote+".part"),
+		quoteSFTP(remote+".part"), quoteSFTP(remote)))
+	return err
+}
+
+// List implementa BackupTarget
+func (t *SFTPTarget) List() ([]string, error) {
+	dir := t.RemoteDir
+	if dir == "" {
+		dir = "."
+	}
+
+	out, err := t.run(fmt.Sprintf("ls -1 %s\n", quoteSFTP(dir)))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		// In modalità batch sftp ripete i comandi eseguiti preceduti da "sftp>"
+		if line == "" || strings.HasPrefix(line, "sftp>") {
+			continue
+		}
+		names = append(names, path.Base(line))
+	}
+	return names, nil
+}
+
+// Delete implementa BackupTarget
+func (t *SFTPTarget) Delete(archiveName string) error {
+	_, err := t.run(fmt.Sprintf("rm %s\n", quoteSFTP(t.remotePath(archiveName))))
+	return err
+}
+
+// remotePath costruisce il percorso remoto di un archivio
+func (t *SFTPTarget) remotePath(archiveName string) string {
+	if t.RemoteDir == "" {
+		return archiveName
+	}
+	return path.Join(t.RemoteDir, archiveName)
+}
+
+// run esegue uno script di comandi sftp e restituisce l'output
+func (t *SFTPTarget) run(script string) (string, error) {
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if t.Port > 0 {
+		args = append(args, "-P", strconv.Itoa(t.Port))
+	}
+	if t.KeyFile != "" {
+		args = append(args, "-i", t.KeyFile)
+	}
+	args = append(args, fmt.Sprintf("%s@%s", t.User, t.Host))
+
+	cmd := exec.Command("sftp", args...)
+	cmd.Stdin = strings.NewReader(script)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("sftp %s: %s", t.Host, msg)
+	}
+
+	return stdout.String(), nil
+}
+
+// quoteSFTP racchiude un percorso tra virgolette per lo script batch di sftp
+func quoteSFTP(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Stati di verifica di un backup
+const (
+	VerificaNonEseguita = "Non verificato"
+	VerificaOK          = "OK"
+	VerificaFallita     = "Fallita"
+)
+
+// BackupInfo descrive un backup presente su disco
+type BackupInfo struct {
+	Path              string         `json:"path"`
+	Nome              string         `json:"nome"`
+	Data              time.Time      `json:"data"`
+	Dimensione        int64          `json:"dimensione"`
+	Documenti         map[string]int `json:"documenti"`
+	Verifica          string         `json:"verifica"`
+	VerificatoIl      time.Time      `json:"verificato_il,omitempty"`
+	ErroreVerifica    string         `json:"errore_verifica,omitempty"`
+	MetadatiLeggibili bool           `json:"metadati_leggibili"`
+}
+
+// TotaleDocumenti restituisce il numero complessivo di documenti nel backup
+func (bi *BackupInfo) TotaleDocumenti() int {
+	n := 0
+	for _, c := range bi.Documenti {
+		n += c
+	}
+	return n
+}
+
+// backupVerification è il contenuto di verify.json, scritto da VerifyBackup
+type backupVerification struct {
+	Data   time.Time `json:"data"`
+	Esito  string    `json:"esito"`
+	Errore string    `json:"errore,omitempty"`
+}
+
+// ListBackupInfo elenca i backup disponibili con dimensione, data,
+// conteggio documenti e stato dell'ultima verifica
+func (bm *BackupManagerMongo) ListBackupInfo() ([]BackupInfo, error) {
+	backups, err := bm.ListBackups()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	infos := make([]BackupInfo, 0, len(backups))
+	for _, dir := range backups {
+		infos = append(infos, readBackupInfo(dir))
+	}
+
+	return infos, nil
+}
+
+// ReadBackupInfo restituisce le informazioni di un singolo backup
+func ReadBackupInfo(dir string) BackupInfo {
+	return readBackupInfo(dir)
+}
+
+// readBackupInfo raccoglie le informazioni di un singolo backup
+func readBackupInfo(dir string) BackupInfo {
+	info := BackupInfo{
+		Path:      dir,
+		Nome:      filepath.Base(dir),
+		Documenti: make(map[string]int),
+		Verifica:  VerificaNonEseguita,
+	}
+
+	timestamp := strings.TrimPrefix(info.Nome, "officina_backup_")
+	if t, err := time.ParseInLocation("20060102_150405", timestamp, time.Local); err == nil {
+		info.Data = t
+	}
+
+	info.Dimensione, _ = dirSize(dir)
+
+	if metadata, err := readBackupMetadata(dir); err == nil {
+		info.MetadatiLeggibili = true
+		for c, n := range metadata.Documents {
+			info.Documenti[c] = n
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "verify.json")); err == nil {
+		var v backupVerification
+		if json.Unmarshal(data, &v) == nil {
+			info.Verifica = v.Esito
+			info.VerificatoIl = v.Data
+			info.ErroreVerifica = v.Errore
+		}
+	}
+
+	return info
+}
+
+// VerifyBackup controlla l'integrità di un backup: presenza dei file, checksum
+// e leggibilità di ogni documento. L'esito viene salvato in verify.json.
+func (bm *BackupManagerMongo) VerifyBackup(backupDir string) error {
+	verr := verifyBackupDir(backupDir)
+
+	v := backupVerification{Data: time.Now(), Esito: VerificaOK}
+	if verr != nil {
+		v.Esito = VerificaFallita
+		v.Errore = verr.Error()
+	}
+
+	if data, err := json.MarshalIndent(v, "", "  "); err == nil {
+		if err := os.WriteFile(filepath.Join(backupDir, "verify.json"), data, 0644); err != nil && verr == nil {
+			return fmt.Errorf("verifica riuscita ma impossibile salvarne l'esito: %w", err)
+		}
+	}
+
+	return verr
+}
+
+// verifyBackupDir esegue i controlli di VerifyBackup senza registrarne l'esito
+func verifyBackupDir(backupDir string) error {
+	metadata, err := readBackupMetadata(backupDir)
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range metadata.Collections {
+		backupFile := filepath.Join(backupDir, fmt.Sprintf("%s.json", collection))
+		data, err := os.ReadFile(backupFile)
+		if err != nil {
+			return fmt.Errorf("file mancante per %s: %w", collection, err)
+		}
+
+		if expected, ok := metadata.Checksums[collection]; ok && checksum(data) != expected {
+			return fmt.Errorf("checksum non corrispondente per %s", collection)
+		}
+
+		docs, err := loadBackupCollection(backupDir, collection)
+		if err != nil {
+			return err
+		}
+
+		if expected, ok := metadata.Documents[collection]; ok && len(docs) != expected {
+			return fmt.Errorf("%s: %d documenti, attesi %d", collection, len(docs), expected)
+		}
+	}
+
+	return nil
+}
+
+// DeleteBackup elimina una directory di backup gestita da questo manager
+func (bm *BackupManagerMongo) DeleteBackup(backupDir string) error {
+	base, err := filepath.Abs(bm.basePath)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(backupDir)
+	if err != nil {
+		return err
+	}
+
+	if filepath.Dir(dir) != base || !strings.HasPrefix(filepath.Base(dir), "officina_backup_") {
+		return fmt.Errorf("%s non è un backup di %s", backupDir, bm.basePath)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("impossibile eliminare backup %s: %w", backupDir, err)
+	}
+	return nil
+}
+
+// BasePath restituisce la directory in cui vengono salvati i backup
+func (bm *BackupManagerMongo) BasePath() string {
+	return bm.basePath
+}
+
+// checksum calcola lo SHA-256 esadecimale di un contenuto
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// dirSize calcola la dimensione complessiva dei file in una directory
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
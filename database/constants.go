@@ -1,5 +1,7 @@
 package database
 
+import "strings"
+
 // Stati commessa
 const (
 	StatoCommessaAperta = "Aperta"
@@ -78,12 +80,303 @@ func IsValidTipoMovimento(tipo string) bool {
 	return false
 }
 
+// Tipi di documento emessi: i codici FatturaPA di fatture, note di credito e
+// fatture differite, più la proforma, che non è un documento fiscale
+const (
+	TipoDocumentoFattura     = "TD01"
+	TipoDocumentoNotaCredito = "TD04"
+	TipoDocumentoDifferita   = "TD24"
+	TipoDocumentoProforma    = "PROFORMA"
+)
+
+// TipiDocumento elenca i tipi che si scelgono per un nuovo documento; la
+// nota di credito nasce solo dalla fattura che storna
+var TipiDocumento = []string{TipoDocumentoFattura, TipoDocumentoDifferita, TipoDocumentoProforma}
+
+var descrizioniTipiDocumento = map[string]string{
+	TipoDocumentoFattura:     "Fattura",
+	TipoDocumentoNotaCredito: "Nota di credito",
+	TipoDocumentoDifferita:   "Fattura differita",
+	TipoDocumentoProforma:    "Proforma",
+}
+
+// DescrizioneTipoDocumento restituisce la descrizione di un tipo di
+// documento; il tipo vuoto è quello delle fatture registrate prima dei tipi
+func DescrizioneTipoDocumento(tipo string) string {
+	if tipo == "" {
+		tipo = TipoDocumentoFattura
+	}
+	return descrizioniTipiDocumento[tipo]
+}
+
+// IsValidTipoDocumento verifica se un tipo di documento è valido
+func IsValidTipoDocumento(tipo string) bool {
+	_, ok := descrizioniTipiDocumento[tipo]
+	return ok || tipo == ""
+}
+
+// Condizioni di pagamento delle fatture: rimessa diretta alla data della
+// fattura, a 30/60/90 giorni fine mese o in rate a fine mese
+const (
+	PagamentoImmediato = "RD"
+	Pagamento30FM      = "30FM"
+	Pagamento60FM      = "60FM"
+	Pagamento90FM      = "90FM"
+	Pagamento3060FM    = "30-60FM"
+	Pagamento306090FM  = "30-60-90FM"
+)
+
+// CondizioniPagamento elenca le condizioni di pagamento nell'ordine del form
+var CondizioniPagamento = []string{
+	PagamentoImmediato, Pagamento30FM, Pagamento60FM, Pagamento90FM, Pagamento3060FM, Pagamento306090FM,
+}
+
+var descrizioniPagamento = map[string]string{
+	PagamentoImmediato: "Rimessa diretta",
+	Pagamento30FM:      "30 gg fine mese",
+	Pagamento60FM:      "60 gg fine mese",
+	Pagamento90FM:      "90 gg fine mese",
+	Pagamento3060FM:    "2 rate 30/60 gg fine mese",
+	Pagamento306090FM:  "3 rate 30/60/90 gg fine mese",
+}
+
+// giorniPagamento indica per ogni condizione i giorni dalla data fattura di
+// ciascuna rata; le rate dopo zero giorni scadono a fine mese
+var giorniPagamento = map[string][]int{
+	PagamentoImmediato: {0},
+	Pagamento30FM:      {30},
+	Pagamento60FM:      {60},
+	Pagamento90FM:      {90},
+	Pagamento3060FM:    {30, 60},
+	Pagamento306090FM:  {30, 60, 90},
+}
+
+// DescrizioneCondizionePagamento restituisce la descrizione di una
+// condizione di pagamento; quella vuota è la rimessa diretta
+func DescrizioneCondizionePagamento(codice string) string {
+	if codice == "" {
+		codice = PagamentoImmediato
+	}
+	return descrizioniPagamento[codice]
+}
+
+// IsValidCondizionePagamento verifica se una condizione di pagamento è valida
+func IsValidCondizionePagamento(codice string) bool {
+	_, ok := descrizioniPagamento[codice]
+	return ok || codice == ""
+}
+
+// Regimi IVA della fattura: ordinario, scissione dei pagamenti (split
+// payment, art. 17-ter DPR 633/72), in cui il cliente versa l'IVA
+// all'erario, o inversione contabile (reverse charge, art. 17), indicata
+// con la natura N6.x che assumono le righe imponibili
+const (
+	RegimeIVAOrdinario = ""
+	RegimeIVAScissione = "S"
+)
+
+// RegimiIVA elenca i regimi IVA nell'ordine del form
+var RegimiIVA = []string{
+	RegimeIVAOrdinario, RegimeIVAScissione,
+	"N6.1", "N6.2", "N6.3", "N6.4", "N6.5", "N6.6", "N6.7", "N6.8", "N6.9",
+}
+
+// DescrizioneRegimeIVA restituisce la descrizione di un regime IVA
+func DescrizioneRegimeIVA(codice string) string {
+	switch {
+	case codice == RegimeIVAOrdinario:
+		return "Ordinario"
+	case codice == RegimeIVAScissione:
+		return "Scissione dei pagamenti"
+	case InversioneContabile(codice):
+		return descrizioniNature[codice]
+	}
+	return ""
+}
+
+// InversioneContabile indica se il regime IVA è un'inversione contabile
+func InversioneContabile(codice string) bool {
+	return strings.HasPrefix(codice, "N6.") && IsValidNaturaIVA(codice)
+}
+
+// IsValidRegimeIVA verifica se un regime IVA è valido
+func IsValidRegimeIVA(codice string) bool {
+	return codice == RegimeIVAOrdinario || codice == RegimeIVAScissione || InversioneContabile(codice)
+}
+
+// Tipi di ritenuta d'acconto (codici FatturaPA)
+const (
+	RitenutaPersoneFisiche    = "RT01"
+	RitenutaPersoneGiuridiche = "RT02"
+)
+
+// TipiRitenuta elenca i tipi di ritenuta nell'ordine del form; il tipo
+// vuoto indica la fattura senza ritenuta
+var TipiRitenuta = []string{"", RitenutaPersoneFisiche, RitenutaPersoneGiuridiche}
+
+var descrizioniRitenuta = map[string]string{
+	RitenutaPersoneFisiche:    "Ritenuta persone fisiche",
+	RitenutaPersoneGiuridiche: "Ritenuta persone giuridiche",
+}
+
+// DescrizioneTipoRitenuta restituisce la descrizione di un tipo di ritenuta
+func DescrizioneTipoRitenuta(tipo string) string {
+	if tipo == "" {
+		return "Nessuna"
+	}
+	return descrizioniRitenuta[tipo]
+}
+
+// IsValidTipoRitenuta verifica se un tipo di ritenuta è valido
+func IsValidTipoRitenuta(tipo string) bool {
+	_, ok := descrizioniRitenuta[tipo]
+	return ok
+}
+
+// CausaleRitenutaPredefinita è la causale del pagamento (modello 770)
+// proposta per la ritenuta: lavoro autonomo
+const CausaleRitenutaPredefinita = "A"
+
+// IsValidCausaleRitenuta verifica la causale del pagamento soggetto a
+// ritenuta: una lettera o uno dei codici L1, M1, M2, O1, V1, ZO
+func IsValidCausaleRitenuta(causale string) bool {
+	switch causale {
+	case "L1", "M1", "M2", "O1", "V1", "ZO":
+		return true
+	}
+	return len(causale) == 1 && causale[0] >= 'A' && causale[0] <= 'Z'
+}
+
+// Stati di incasso delle fatture, ricavati da scadenze e incassi
+const (
+	StatoDaIncassare = "Da incassare"
+	StatoParziale    = "Parziale"
+	StatoIncassata   = "Incassata"
+	StatoScaduta     = "Scaduta"
+	StatoStornata    = "Stornata" // interamente stornata da note di credito
+)
+
+// Ruoli operatore
+const (
+	RuoloMeccanico    = "Meccanico"
+	RuoloCarrozziere  = "Carrozziere"
+	RuoloElettrauto   = "Elettrauto"
+	RuoloGommista     = "Gommista"
+	RuoloResponsabile = "Responsabile Officina"
+	RuoloAccettazione = "Addetto Accettazione"
+	RuoloApprendista  = "Apprendista"
+)
+
 // Ruoli operatore comuni
 var RuoliOperatoreComuni = []string{
-	"Meccanico",
-	"Carrozziere",
-	"Elettrauto",
-	"Gommista",
-	"Responsabile Officina",
-	"Addetto Accettazione",
+	RuoloMeccanico,
+	RuoloCarrozziere,
+	RuoloElettrauto,
+	RuoloGommista,
+	RuoloResponsabile,
+	RuoloAccettazione,
+	RuoloApprendista,
+}
+
+// Regimi fiscali dell'emittente (codici FatturaPA)
+const (
+	RegimeOrdinario   = "RF01"
+	RegimeMinimi      = "RF02"
+	RegimeForfettario = "RF19"
+)
+
+// RegimiFiscali elenca i codici dei regimi fiscali nell'ordine FatturaPA
+var RegimiFiscali = []string{
+	"RF01", "RF02", "RF04", "RF05", "RF06", "RF07", "RF08", "RF09", "RF10",
+	"RF11", "RF12", "RF13", "RF14", "RF15", "RF16", "RF17", "RF18", "RF19",
+}
+
+// descrizioniRegimi associa a ogni codice la descrizione ufficiale abbreviata
+var descrizioniRegimi = map[string]string{
+	"RF01": "Ordinario",
+	"RF02": "Contribuenti minimi",
+	"RF04": "Agricoltura e pesca",
+	"RF05": "Vendita sali e tabacchi",
+	"RF06": "Commercio fiammiferi",
+	"RF07": "Editoria",
+	"RF08": "Gestione servizi telefonia pubblica",
+	"RF09": "Rivendita documenti di trasporto",
+	"RF10": "Intrattenimenti e giochi",
+	"RF11": "Agenzie viaggi e turismo",
+	"RF12": "Agriturismo",
+	"RF13": "Vendite a domicilio",
+	"RF14": "Rivendita beni usati e antiquariato",
+	"RF15": "Agenzie di vendite all'asta",
+	"RF16": "IVA per cassa P.A.",
+	"RF17": "IVA per cassa",
+	"RF18": "Altro",
+	"RF19": "Forfettario",
+}
+
+// DescrizioneRegimeFiscale restituisce la descrizione di un regime fiscale
+func DescrizioneRegimeFiscale(codice string) string {
+	return descrizioniRegimi[codice]
+}
+
+// IsValidRegimeFiscale verifica se un codice regime fiscale è valido
+func IsValidRegimeFiscale(codice string) bool {
+	_, ok := descrizioniRegimi[codice]
+	return ok
+}
+
+// AliquoteIVA elenca le aliquote IVA ordinaria e ridotte in vigore
+var AliquoteIVA = []float64{22, 10, 5, 4}
+
+// IsValidAliquotaIVA verifica se un'aliquota IVA è prevista
+func IsValidAliquotaIVA(aliquota float64) bool {
+	for _, a := range AliquoteIVA {
+		if a == aliquota {
+			return true
+		}
+	}
+	return false
+}
+
+// Nature delle operazioni senza IVA (codici FatturaPA), da indicare sulle
+// righe con aliquota zero
+var NatureIVA = []string{
+	"N1", "N2.1", "N2.2", "N3.1", "N3.2", "N3.3", "N3.4", "N3.5", "N3.6",
+	"N4", "N5", "N6.1", "N6.2", "N6.3", "N6.4", "N6.5", "N6.6", "N6.7",
+	"N6.8", "N6.9", "N7",
+}
+
+// descrizioniNature associa a ogni natura la descrizione ufficiale abbreviata
+var descrizioniNature = map[string]string{
+	"N1":   "Escluse ex art. 15",
+	"N2.1": "Non soggette, artt. 7-7septies",
+	"N2.2": "Non soggette, altri casi",
+	"N3.1": "Non imponibili, esportazioni",
+	"N3.2": "Non imponibili, cessioni intracomunitarie",
+	"N3.3": "Non imponibili, cessioni verso San Marino",
+	"N3.4": "Non imponibili, assimilate alle esportazioni",
+	"N3.5": "Non imponibili, dichiarazioni d'intento",
+	"N3.6": "Non imponibili, altre operazioni",
+	"N4":   "Esenti",
+	"N5":   "Regime del margine",
+	"N6.1": "Inversione contabile, rottami",
+	"N6.2": "Inversione contabile, oro e argento",
+	"N6.3": "Inversione contabile, subappalto edilizia",
+	"N6.4": "Inversione contabile, fabbricati",
+	"N6.5": "Inversione contabile, telefoni cellulari",
+	"N6.6": "Inversione contabile, prodotti elettronici",
+	"N6.7": "Inversione contabile, comparto edile",
+	"N6.8": "Inversione contabile, settore energetico",
+	"N6.9": "Inversione contabile, altri casi",
+	"N7":   "IVA assolta in altro stato UE",
+}
+
+// DescrizioneNaturaIVA restituisce la descrizione di una natura
+func DescrizioneNaturaIVA(codice string) string {
+	return descrizioniNature[codice]
+}
+
+// IsValidNaturaIVA verifica se un codice natura è valido
+func IsValidNaturaIVA(codice string) bool {
+	_, ok := descrizioniNature[codice]
+	return ok
 }
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Contatore è un valore progressivo condiviso da tutte le sessioni e i
+// terminali che usano il database (collezione contatori, inclusa nei backup)
+type Contatore struct {
+	ID     int    `json:"id"`
+	Chiave string `json:"chiave"`
+	Valore int    `json:"valore"`
+}
+
+// Chiavi dei contatori
+const (
+	ContatoreProgressivoInvio = "fatturapa.progressivo_invio"
+	// Fatture e fatture differite emesse per commesse: serializza la loro
+	// emissione (vedi riservaCommesse)
+	ContatoreFatturazioneCommesse = "fatture.commesse"
+)
+
+// IncrementaContatore aumenta di uno il contatore e restituisce il nuovo
+// valore, partendo da 1. L'aggiornamento è atomico: due sessioni non
+// ottengono mai lo stesso valore.
+func (db *DB) IncrementaContatore(chiave string) (int, error) {
+	var c Contatore
+	err := db.mongo.db.Collection("contatori").FindOneAndUpdate(db.mongo.ctx,
+		bson.M{"chiave": chiave},
+		bson.M{
+			"$inc": bson.M{"valore": 1},
+			// id stabile per chiave, così che i backup abbinino il record
+			"$setOnInsert": bson.M{"id": idContatore(chiave)},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&c)
+	if err != nil {
+		return 0, fmt.Errorf("errore incremento contatore %s: %w", chiave, err)
+	}
+	return c.Valore, nil
+}
+
+func idContatore(chiave string) int {
+	return int(crc32.ChecksumIEEE([]byte(chiave)) & 0x7fffffff)
+}
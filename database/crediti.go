@@ -0,0 +1,367 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"officina/utils"
+)
+
+// Crediti verso i clienti: fatture e fatture differite hanno le scadenze
+// della loro condizione di pagamento e sono incassate dalle entrate di prima
+// nota assegnate (MovimentoPrimaNota.FatturaID). Lo stato di incasso non è
+// salvato: si ricava alla data voluta da scadenze, note di credito e
+// incassi, che coprono le rate in ordine di scadenza.
+
+// Scadenza è una rata della fattura con la parte ancora da incassare
+type Scadenza struct {
+	Data    time.Time `json:"data"`
+	Importo float64   `json:"importo"`
+	Residuo float64   `json:"residuo"`
+}
+
+// Scadenze divide il netto a pagare della fattura nelle rate della
+// condizione di pagamento, con il residuo pari all'importo; l'ultima rata
+// assorbe gli arrotondamenti. Note di credito e proforma non hanno scadenze.
+func (f *Fattura) Scadenze() []Scadenza {
+	totale := f.Credito()
+	if totale <= 0 {
+		return nil
+	}
+	pagamento := f.Pagamento
+	if pagamento == "" {
+		pagamento = PagamentoImmediato
+	}
+	giorni := giorniPagamento[pagamento]
+
+	rata := Arrotonda(totale / float64(len(giorni)))
+	scadenze := make([]Scadenza, len(giorni))
+	for i, g := range giorni {
+		data := f.Data
+		if g > 0 {
+			d := f.Data.AddDate(0, 0, g)
+			data = time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, d.Location())
+		}
+		importo := rata
+		if i == len(giorni)-1 {
+			importo = Arrotonda(totale - rata*float64(len(giorni)-1))
+		}
+		scadenze[i] = Scadenza{Data: data, Importo: importo, Residuo: importo}
+	}
+	return scadenze
+}
+
+// Incassi è la situazione degli incassi di una fattura a una data. Totale è
+// il credito al netto delle note di credito; Ritardo sono i giorni trascorsi
+// dalla prima rata scaduta non ancora incassata.
+type Incassi struct {
+	FatturaID int        `json:"fattura_id"`
+	Scadenze  []Scadenza `json:"scadenze"`
+	Stornato  float64    `json:"stornato"`
+	Totale    float64    `json:"totale"`
+	Incassato float64    `json:"incassato"`
+	Residuo   float64    `json:"residuo"`
+	Stato     string     `json:"stato"`
+	Ritardo   int        `json:"ritardo"`
+}
+
+// CalcolaIncassi ricava la situazione della fattura alla data oggi dagli
+// importi stornati dalle note di credito e dalle entrate assegnate
+func CalcolaIncassi(f *Fattura, stornato float64, movimenti []MovimentoPrimaNota, oggi time.Time) Incassi {
+	s := Incassi{FatturaID: f.ID, Scadenze: f.Scadenze(), Stornato: stornato}
+	for _, m := range movimenti {
+		if m.FatturaID == f.ID && m.Tipo == TipoMovimentoEntrata {
+			s.Incassato += m.Importo
+		}
+	}
+	s.Incassato = Arrotonda(s.Incassato)
+	s.Totale = Arrotonda(f.Credito() - stornato)
+	s.Residuo = max(Arrotonda(s.Totale-s.Incassato), 0)
+
+	coperto := stornato + s.Incassato
+	for i := range s.Scadenze {
+		r := &s.Scadenze[i]
+		parte := min(coperto, r.Importo)
+		r.Residuo = Arrotonda(r.Importo - parte)
+		coperto -= parte
+		if giorni := giorniTra(r.Data, oggi); r.Residuo > 0 && giorni > 0 && s.Ritardo == 0 {
+			s.Ritardo = giorni
+		}
+	}
+
+	switch {
+	case s.Totale <= 0:
+		s.Stato = StatoStornata
+	case s.Residuo <= 0:
+		s.Stato = StatoIncassata
+	case s.Ritardo > 0:
+		s.Stato = StatoScaduta
+	case s.Incassato > 0:
+		s.Stato = StatoParziale
+	default:
+		s.Stato = StatoDaIncassare
+	}
+	return s
+}
+
+// giorniTra conta i giorni di calendario da a fino a b
+func giorniTra(a, b time.Time) int {
+	da := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	fino := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(fino.Sub(da).Hours() / 24)
+}
+
+// SituazioniIncassi calcola alla data oggi la situazione di tutte le fatture
+// e fatture differite, indicizzata per id della fattura
+func SituazioniIncassi(fatture []Fattura, movimenti []MovimentoPrimaNota, oggi time.Time) map[int]Incassi {
+	perFattura := make(map[int][]MovimentoPrimaNota)
+	for _, m := range movimenti {
+		if m.FatturaID > 0 {
+			perFattura[m.FatturaID] = append(perFattura[m.FatturaID], m)
+		}
+	}
+	situazioni := make(map[int]Incassi)
+	for i := range fatture {
+		f := &fatture[i]
+		if Stornabile(f.Tipo) {
+			situazioni[f.ID] = CalcolaIncassi(f, Stornato(f.ID, fatture, 0), perFattura[f.ID], oggi)
+		}
+	}
+	return situazioni
+}
+
+// IncassiFattura restituisce le entrate assegnate alla fattura id
+func (db *DB) IncassiFattura(id int) ([]MovimentoPrimaNota, error) {
+	var list []MovimentoPrimaNota
+	cursor, err := db.mongo.db.Collection("movimenti_primanota").Find(db.mongo.ctx,
+		bson.M{"fatturaid": id}, options.Find().SetSort(bson.D{{Key: "data", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(db.mongo.ctx)
+	return list, cursor.All(db.mongo.ctx, &list)
+}
+
+// SituazioneIncassi calcola la situazione degli incassi della fattura id
+// alla data oggi
+func (db *DB) SituazioneIncassi(id int, oggi time.Time) (*Incassi, error) {
+	f, err := db.mongo.GetFattura(id)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura fattura: %w", err)
+	}
+	if !Stornabile(f.Tipo) {
+		return nil, fmt.Errorf("%s %s: si incassano solo le fatture", DescrizioneTipoDocumento(f.Tipo), f.Numero)
+	}
+	note, err := db.NoteCredito(id)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura note di credito: %w", err)
+	}
+	incassi, err := db.IncassiFattura(id)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura incassi: %w", err)
+	}
+	s := CalcolaIncassi(f, Stornato(id, note, 0), incassi, oggi)
+	return &s, nil
+}
+
+// AssegnaIncasso assegna l'entrata movID alla fattura fatturaID, o la
+// libera con fatturaID zero
+func (db *DB) AssegnaIncasso(movID, fatturaID int) error {
+	mov, err := db.mongo.GetMovimentoPrimaNota(movID)
+	if err != nil {
+		return err
+	}
+	mov.FatturaID = fatturaID
+	return db.UpdateMovimentoPrimaNota(mov)
+}
+
+// controllaIncasso verifica che l'entrata assegnata a una fattura non superi
+// quanto resta da incassare
+func (db *DB) controllaIncasso(mov *MovimentoPrimaNota) error {
+	if mov.FatturaID == 0 {
+		return nil
+	}
+	if err := mov.Validate(); err != nil {
+		return err
+	}
+	f, err := db.mongo.GetFattura(mov.FatturaID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("la fattura %d non esiste", mov.FatturaID)
+	}
+	if err != nil {
+		return fmt.Errorf("errore lettura fattura: %w", err)
+	}
+	if !Stornabile(f.Tipo) {
+		return fmt.Errorf("%s %s: si incassano solo le fatture", DescrizioneTipoDocumento(f.Tipo), f.Numero)
+	}
+
+	note, err := db.NoteCredito(f.ID)
+	if err != nil {
+		return fmt.Errorf("errore lettura note di credito: %w", err)
+	}
+	incassi, err := db.IncassiFattura(f.ID)
+	if err != nil {
+		return fmt.Errorf("errore lettura incassi: %w", err)
+	}
+	altri := incassi[:0]
+	for _, m := range incassi {
+		if m.ID != mov.ID {
+			altri = append(altri, m)
+		}
+	}
+	s := CalcolaIncassi(f, Stornato(f.ID, note, 0), altri, mov.Data)
+	if Arrotonda(mov.Importo) > s.Residuo {
+		return fmt.Errorf("l'incasso (%s) supera quanto resta da incassare della fattura %s (%s)",
+			utils.FormatEuro(mov.Importo), f.Numero, utils.FormatEuro(s.Residuo))
+	}
+	return nil
+}
+
+// controllaIncassata verifica che il totale della fattura in modifica non
+// scenda sotto quanto già incassato
+func (db *DB) controllaIncassata(f *Fattura) error {
+	if f.ID == 0 || !Stornabile(f.Tipo) {
+		return nil
+	}
+	incassi, err := db.IncassiFattura(f.ID)
+	if err != nil {
+		return fmt.Errorf("errore lettura incassi: %w", err)
+	}
+	if len(incassi) == 0 {
+		return nil
+	}
+	note, err := db.NoteCredito(f.ID)
+	if err != nil {
+		return fmt.Errorf("errore lettura note di credito: %w", err)
+	}
+	if s := CalcolaIncassi(f, Stornato(f.ID, note, 0), incassi, time.Now()); s.Incassato > s.Totale {
+		return fmt.Errorf("il netto a pagare %s è inferiore a quanto già incassato (%s)",
+			utils.FormatEuro(f.NettoAPagare()), utils.FormatEuro(s.Incassato))
+	}
+	return nil
+}
+
+// controllaEliminazioneIncassata impedisce di eliminare una fattura con
+// incassi assegnati, che resterebbero senza riferimento
+func (db *DB) controllaEliminazioneIncassata(id int) error {
+	incassi, err := db.IncassiFattura(id)
+	if err != nil {
+		return fmt.Errorf("errore lettura incassi: %w", err)
+	}
+	if len(incassi) > 0 {
+		return fmt.Errorf("la fattura ha %d incassi registrati: toglierli prima di eliminarla", len(incassi))
+	}
+	return nil
+}
+
+// FasceScaduto sono le colonne dello scadenzario: rate non ancora scadute e
+// rate scadute per giorni di ritardo
+var FasceScaduto = []string{"A scadere", "1-30 gg", "31-60 gg", "61-90 gg", "Oltre 90 gg"}
+
+// fasciaScaduto restituisce la fascia di una rata scaduta da giorni
+func fasciaScaduto(giorni int) int {
+	switch {
+	case giorni <= 0:
+		return 0
+	case giorni <= 30:
+		return 1
+	case giorni <= 60:
+		return 2
+	case giorni <= 90:
+		return 3
+	}
+	return 4
+}
+
+// CreditiCliente è una riga dello scadenzario: quanto resta da incassare
+// dal cliente per fascia di ritardo
+type CreditiCliente struct {
+	ClienteID int       `json:"cliente_id"`
+	Cliente   string    `json:"cliente"`
+	Fatture   int       `json:"fatture"`
+	Fasce     []float64 `json:"fasce"`
+	Totale    float64   `json:"totale"`
+}
+
+// ScadenzarioCrediti riepiloga per cliente i crediti aperti alla data, dal
+// cliente con il credito maggiore
+type ScadenzarioCrediti struct {
+	Data    time.Time        `json:"data"`
+	Fasce   []string         `json:"fasce"`
+	Clienti []CreditiCliente `json:"clienti"`
+	Totali  []float64        `json:"totali"`
+	Totale  float64          `json:"totale"`
+}
+
+// Scadenzario costruisce lo scadenzario dei crediti alla data oggi: il
+// residuo di ogni rata è sommato nella fascia dei suoi giorni di ritardo
+func Scadenzario(fatture []Fattura, movimenti []MovimentoPrimaNota, clienti []Cliente, oggi time.Time) *ScadenzarioCrediti {
+	nomi := make(map[int]string, len(clienti))
+	for _, c := range clienti {
+		nomi[c.ID] = c.RagioneSociale
+	}
+
+	r := &ScadenzarioCrediti{Data: oggi, Fasce: FasceScaduto, Totali: make([]float64, len(FasceScaduto))}
+	perCliente := make(map[int]*CreditiCliente)
+	situazioni := SituazioniIncassi(fatture, movimenti, oggi)
+	for _, f := range fatture {
+		s, ok := situazioni[f.ID]
+		if !ok || s.Residuo <= 0 {
+			continue
+		}
+		c := perCliente[f.ClienteID]
+		if c == nil {
+			c = &CreditiCliente{ClienteID: f.ClienteID, Cliente: nomi[f.ClienteID], Fasce: make([]float64, len(FasceScaduto))}
+			perCliente[f.ClienteID] = c
+		}
+		c.Fatture++
+		for _, rata := range s.Scadenze {
+			c.Fasce[fasciaScaduto(giorniTra(rata.Data, oggi))] += rata.Residuo
+		}
+	}
+
+	for _, c := range perCliente {
+		for i := range c.Fasce {
+			c.Fasce[i] = Arrotonda(c.Fasce[i])
+			c.Totale += c.Fasce[i]
+			r.Totali[i] += c.Fasce[i]
+		}
+		c.Totale = Arrotonda(c.Totale)
+		r.Totale += c.Totale
+		r.Clienti = append(r.Clienti, *c)
+	}
+	for i := range r.Totali {
+		r.Totali[i] = Arrotonda(r.Totali[i])
+	}
+	r.Totale = Arrotonda(r.Totale)
+	sort.Slice(r.Clienti, func(i, j int) bool {
+		if r.Clienti[i].Totale != r.Clienti[j].Totale {
+			return r.Clienti[i].Totale > r.Clienti[j].Totale
+		}
+		return r.Clienti[i].Cliente < r.Clienti[j].Cliente
+	})
+	return r
+}
+
+// ScadenzarioCrediti costruisce lo scadenzario dei crediti alla data oggi
+func (db *DB) ScadenzarioCrediti(oggi time.Time) (*ScadenzarioCrediti, error) {
+	fatture, err := db.ListFatture()
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura fatture: %w", err)
+	}
+	movimenti, err := db.ListMovimentiPrimaNota(nil)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura movimenti: %w", err)
+	}
+	clienti, err := db.ListClienti()
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura clienti: %w", err)
+	}
+	return Scadenzario(fatture, movimenti, clienti, oggi), nil
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"time"
@@ -10,19 +11,24 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// DB è l'interfaccia compatibile verso l'esterno
+// DB è l'interfaccia compatibile verso l'esterno. Le scritture fatte
+// tramite CRUD vengono attribuite all'operatore della sessione (vedi
+// NuovaSessione) nel registro attività.
 type DB struct {
-	mongo *MongoDB
+	mongo    *MongoDB
+	sessione *sessione
+	eventi   *ascoltatori
 }
 
-// InitMongoDB inizializza il database MongoDB (usato da main.go)
-func InitMongoDB(uri, dbName string) (*DB, error) {
-	mongo, err := NewMongoDB(uri, dbName)
+// InitMongoDB inizializza il database MongoDB; timeout limita l'attesa
+// del server (0 = 5 secondi)
+func InitMongoDB(uri, dbName string, timeout time.Duration) (*DB, error) {
+	mongo, err := NewMongoDB(uri, dbName, timeout)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DB{mongo: mongo}, nil
+	return &DB{mongo: mongo, eventi: &ascoltatori{}}, nil
 }
 
 // Close chiude la connessione MongoDB
@@ -33,7 +39,14 @@ func (db *DB) Close() error {
 // ==================== CLIENTI ====================
 
 func (db *DB) CreateCliente(c *Cliente) error {
-	return db.mongo.CreateCliente(c)
+	if err := db.Autorizza(RisorsaClienti, PermessoCrea); err != nil {
+		return err
+	}
+	if err := db.mongo.CreateCliente(c); err != nil {
+		return err
+	}
+	db.traccia(AzioneCrea, "clienti", c.ID)
+	return nil
 }
 
 func (db *DB) GetCliente(id int) (*Cliente, error) {
@@ -41,11 +54,25 @@ func (db *DB) GetCliente(id int) (*Cliente, error) {
 }
 
 func (db *DB) UpdateCliente(c *Cliente) error {
-	return db.mongo.UpdateCliente(c)
+	if err := db.Autorizza(RisorsaClienti, PermessoModifica); err != nil {
+		return err
+	}
+	if err := db.mongo.UpdateCliente(c); err != nil {
+		return err
+	}
+	db.traccia(AzioneModifica, "clienti", c.ID)
+	return nil
 }
 
 func (db *DB) DeleteCliente(id int) error {
-	return db.mongo.DeleteCliente(id)
+	if err := db.Autorizza(RisorsaClienti, PermessoElimina); err != nil {
+		return err
+	}
+	if err := db.mongo.DeleteCliente(id); err != nil {
+		return err
+	}
+	db.traccia(AzioneElimina, "clienti", id)
+	return nil
 }
 
 func (db *DB) ListClienti() ([]Cliente, error) {
@@ -55,7 +82,14 @@ func (db *DB) ListClienti() ([]Cliente, error) {
 // ==================== FORNITORI ====================
 
 func (db *DB) CreateFornitore(f *Fornitore) error {
-	return db.mongo.CreateFornitore(f)
+	if err := db.Autorizza(RisorsaFornitori, PermessoCrea); err != nil {
+		return err
+	}
+	if err := db.mongo.CreateFornitore(f); err != nil {
+		return err
+	}
+	db.traccia(AzioneCrea, "fornitori", f.ID)
+	return nil
 }
 
 func (db *DB) GetFornitore(id int) (*Fornitore, error) {
@@ -63,11 +97,25 @@ func (db *DB) GetFornitore(id int) (*Fornitore, error) {
 }
 
 func (db *DB) UpdateFornitore(f *Fornitore) error {
-	return db.mongo.UpdateFornitore(f)
+	if err := db.Autorizza(RisorsaFornitori, PermessoModifica); err != nil {
+		return err
+	}
+	if err := db.mongo.UpdateFornitore(f); err != nil {
+		return err
+	}
+	db.traccia(AzioneModifica, "fornitori", f.ID)
+	return nil
 }
 
 func (db *DB) DeleteFornitore(id int) error {
-	return db.mongo.DeleteFornitore(id)
+	if err := db.Autorizza(RisorsaFornitori, PermessoElimina); err != nil {
+		return err
+	}
+	if err := db.mongo.DeleteFornitore(id); err != nil {
+		return err
+	}
+	db.traccia(AzioneElimina, "fornitori", id)
+	return nil
 }
 
 func (db *DB) ListFornitori() ([]Fornitore, error) {
@@ -77,7 +125,14 @@ func (db *DB) ListFornitori() ([]Fornitore, error) {
 // ==================== VEICOLI ====================
 
 func (db *DB) CreateVeicolo(v *Veicolo) error {
-	return db.mongo.CreateVeicolo(v)
+	if err := db.Autorizza(RisorsaVeicoli, PermessoCrea); err != nil {
+		return err
+	}
+	if err := db.mongo.CreateVeicolo(v); err != nil {
+		return err
+	}
+	db.traccia(AzioneCrea, "veicoli", v.ID)
+	return nil
 }
 
 func (db *DB) GetVeicolo(id int) (*Veicolo, error) {
@@ -85,11 +140,25 @@ func (db *DB) GetVeicolo(id int) (*Veicolo, error) {
 }
 
 func (db *DB) UpdateVeicolo(v *Veicolo) error {
-	return db.mongo.UpdateVeicolo(v)
+	if err := db.Autorizza(RisorsaVeicoli, PermessoModifica); err != nil {
+		return err
+	}
+	if err := db.mongo.UpdateVeicolo(v); err != nil {
+		return err
+	}
+	db.traccia(AzioneModifica, "veicoli", v.ID)
+	return nil
 }
 
 func (db *DB) DeleteVeicolo(id int) error {
-	return db.mongo.DeleteVeicolo(id)
+	if err := db.Autorizza(RisorsaVeicoli, PermessoElimina); err != nil {
+		return err
+	}
+	if err := db.mongo.DeleteVeicolo(id); err != nil {
+		return err
+	}
+	db.traccia(AzioneElimina, "veicoli", id)
+	return nil
 }
 
 func (db *DB) ListVeicoli() ([]Veicolo, error) {
@@ -99,19 +168,90 @@ func (db *DB) ListVeicoli() ([]Veicolo, error) {
 // ==================== COMMESSE ====================
 
 func (db *DB) CreateCommessa(c *Commessa) error {
-	return db.mongo.CreateCommessa(c)
+	if err := db.Autorizza(RisorsaCommesse, PermessoCrea); err != nil {
+		return err
+	}
+	if err := db.mongo.CreateCommessa(c); err != nil {
+		return err
+	}
+	db.traccia(AzioneCrea, "commesse", c.ID)
+	if c.Stato == StatoCommessaChiusa {
+		db.emetti(EventoCommessaChiusa, "commesse", c.ID, c)
+	}
+	return nil
 }
 
 func (db *DB) GetCommessa(id int) (*Commessa, error) {
 	return db.mongo.GetCommessa(id)
 }
 
+// UpdateCommessa salva la commessa; una commessa fatturata resta chiusa
 func (db *DB) UpdateCommessa(c *Commessa) error {
-	return db.mongo.UpdateCommessa(c)
+	if err := db.Autorizza(RisorsaCommesse, PermessoModifica); err != nil {
+		return err
+	}
+	if c.IsOpen() {
+		if err := db.controllaCommessaFatturata(c.ID); err != nil {
+			return err
+		}
+	}
+	chiusa := db.inAscolto() && c.Stato == StatoCommessaChiusa && !db.statoCommessa(c.ID, StatoCommessaChiusa)
+	if err := db.mongo.UpdateCommessa(c); err != nil {
+		return err
+	}
+	db.traccia(AzioneModifica, "commesse", c.ID)
+	if chiusa {
+		db.emetti(EventoCommessaChiusa, "commesse", c.ID, c)
+	}
+	return nil
 }
 
+// DeleteCommessa elimina la commessa se non è fatturata
 func (db *DB) DeleteCommessa(id int) error {
-	return db.mongo.DeleteCommessa(id)
+	if err := db.Autorizza(RisorsaCommesse, PermessoElimina); err != nil {
+		return err
+	}
+	if err := db.controllaCommessaFatturata(id); err != nil {
+		return err
+	}
+	if err := db.mongo.DeleteCommessa(id); err != nil {
+		return err
+	}
+	db.traccia(AzioneElimina, "commesse", id)
+	return nil
+}
+
+// ChiudiCommessa chiude la commessa con la data di oggi; gli effetti
+// collegati (notifiche, fatturazione) seguono l'evento commessa.chiusa
+func (db *DB) ChiudiCommessa(id int) (*Commessa, error) {
+	c, err := db.GetCommessa(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Stato == StatoCommessaChiusa {
+		return c, nil
+	}
+	c.Chiudi(time.Now())
+	if err := db.UpdateCommessa(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RiapriCommessa riporta la commessa nello stato Aperta
+func (db *DB) RiapriCommessa(id int) (*Commessa, error) {
+	c, err := db.GetCommessa(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Stato == StatoCommessaAperta {
+		return c, nil
+	}
+	c.Riapri()
+	if err := db.UpdateCommessa(c); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 func (db *DB) ListCommesse() ([]Commessa, error) {
@@ -121,7 +261,15 @@ func (db *DB) ListCommesse() ([]Commessa, error) {
 // ==================== APPUNTAMENTI ====================
 
 func (db *DB) CreateAppuntamento(a *Appuntamento) error {
-	return db.mongo.CreateAppuntamento(a)
+	if err := db.Autorizza(RisorsaAppuntamenti, PermessoCrea); err != nil {
+		return err
+	}
+	if err := db.mongo.CreateAppuntamento(a); err != nil {
+		return err
+	}
+	db.traccia(AzioneCrea, "appuntamenti", a.ID)
+	db.emetti(EventoAppuntamentoCreato, "appuntamenti", a.ID, a)
+	return nil
 }
 
 func (db *DB) GetAppuntamento(id int) (*Appuntamento, error) {
@@ -129,11 +277,25 @@ func (db *DB) GetAppuntamento(id int) (*Appuntamento, error) {
 }
 
 func (db *DB) UpdateAppuntamento(a *Appuntamento) error {
-	return db.mongo.UpdateAppuntamento(a)
+	if err := db.Autorizza(RisorsaAppuntamenti, PermessoModifica); err != nil {
+		return err
+	}
+	if err := db.mongo.UpdateAppuntamento(a); err != nil {
+		return err
+	}
+	db.traccia(AzioneModifica, "appuntamenti", a.ID)
+	return nil
 }
 
 func (db *DB) DeleteAppuntamento(id int) error {
-	return db.mongo.DeleteAppuntamento(id)
+	if err := db.Autorizza(RisorsaAppuntamenti, PermessoElimina); err != nil {
+		return err
+	}
+	if err := db.mongo.DeleteAppuntamento(id); err != nil {
+		return err
+	}
+	db.traccia(AzioneElimina, "appuntamenti", id)
+	return nil
 }
 
 func (db *DB) ListAppuntamenti() ([]Appuntamento, error) {
@@ -147,7 +309,14 @@ func (db *DB) ListAppuntamentiByDate(date time.Time) ([]Appuntamento, error) {
 // ==================== OPERATORI ====================
 
 func (db *DB) CreateOperatore(o *Operatore) error {
-	return db.mongo.CreateOperatore(o)
+	if err := db.Autorizza(RisorsaOperatori, PermessoCrea); err != nil {
+		return err
+	}
+	if err := db.mongo.CreateOperatore(o); err != nil {
+		return err
+	}
+	db.traccia(AzioneCrea, "operatori", o.ID)
+	return nil
 }
 
 func (db *DB) GetOperatore(id int) (*Operatore, error) {
@@ -155,11 +324,25 @@ func (db *DB) GetOperatore(id int) (*Operatore, error) {
 }
 
 func (db *DB) UpdateOperatore(o *Operatore) error {
-	return db.mongo.UpdateOperatore(o)
+	if err := db.Autorizza(RisorsaOperatori, PermessoModifica); err != nil {
+		return err
+	}
+	if err := db.mongo.UpdateOperatore(o); err != nil {
+		return err
+	}
+	db.traccia(AzioneModifica, "operatori", o.ID)
+	return nil
 }
 
 func (db *DB) DeleteOperatore(id int) error {
-	return db.mongo.DeleteOperatore(id)
+	if err := db.Autorizza(RisorsaOperatori, PermessoElimina); err != nil {
+		return err
+	}
+	if err := db.mongo.DeleteOperatore(id); err != nil {
+		return err
+	}
+	db.traccia(AzioneElimina, "operatori", id)
+	return nil
 }
 
 func (db *DB) ListOperatori() ([]Operatore, error) {
@@ -169,7 +352,17 @@ func (db *DB) ListOperatori() ([]Operatore, error) {
 // ==================== PREVENTIVI ====================
 
 func (db *DB) CreatePreventivo(p *Preventivo) error {
-	return db.mongo.CreatePreventivo(p)
+	if err := db.Autorizza(RisorsaPreventivi, PermessoCrea); err != nil {
+		return err
+	}
+	if err := db.mongo.CreatePreventivo(p); err != nil {
+		return err
+	}
+	db.traccia(AzioneCrea, "preventivi", p.ID)
+	if p.Accettato {
+		db.emetti(EventoPreventivoAccettato, "preventivi", p.ID, p)
+	}
+	return nil
 }
 
 func (db *DB) GetPreventivo(id int) (*Preventivo, error) {
@@ -177,11 +370,42 @@ func (db *DB) GetPreventivo(id int) (*Preventivo, error) {
 }
 
 func (db *DB) UpdatePreventivo(p *Preventivo) error {
-	return db.mongo.UpdatePreventivo(p)
+	if err := db.Autorizza(RisorsaPreventivi, PermessoModifica); err != nil {
+		return err
+	}
+	accettato := db.inAscolto() && p.Accettato && !db.preventivoAccettato(p.ID)
+	if err := db.mongo.UpdatePreventivo(p); err != nil {
+		return err
+	}
+	db.traccia(AzioneModifica, "preventivi", p.ID)
+	if accettato {
+		db.emetti(EventoPreventivoAccettato, "preventivi", p.ID, p)
+	}
+	return nil
+}
+
+// AccettaPreventivo segna il preventivo come accettato o di nuovo in attesa
+func (db *DB) AccettaPreventivo(id int, accettato bool) (*Preventivo, error) {
+	p, err := db.GetPreventivo(id)
+	if err != nil {
+		return nil, err
+	}
+	p.Accettato = accettato
+	if err := db.UpdatePreventivo(p); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 func (db *DB) DeletePreventivo(id int) error {
-	return db.mongo.DeletePreventivo(id)
+	if err := db.Autorizza(RisorsaPreventivi, PermessoElimina); err != nil {
+		return err
+	}
+	if err := db.mongo.DeletePreventivo(id); err != nil {
+		return err
+	}
+	db.traccia(AzioneElimina, "preventivi", id)
+	return nil
 }
 
 func (db *DB) ListPreventivi() ([]Preventivo, error) {
@@ -190,20 +414,77 @@ func (db *DB) ListPreventivi() ([]Preventivo, error) {
 
 // ==================== FATTURE ====================
 
+// CreateFattura registra il documento ricalcolandone i totali dalle righe e
+// gli assegna il numero successivo della sua sequenza; il numero indicato
+// dal chiamante è ignorato. Le note di credito non superano quanto resta da
+// stornare della fattura di riferimento; le commesse indicate sono chiuse e
+// non ancora fatturate.
 func (db *DB) CreateFattura(f *Fattura) error {
-	return db.mongo.CreateFattura(f)
+	if err := db.Autorizza(RisorsaFatture, PermessoCrea); err != nil {
+		return err
+	}
+	f.Calcola()
+	if err := db.controllaRiferimento(f); err != nil {
+		return err
+	}
+	if err := db.controllaCommesse(f); err != nil {
+		return err
+	}
+	if err := db.numeraECrea(f); err != nil {
+		return err
+	}
+	db.traccia(AzioneCrea, "fatture", f.ID)
+	db.emetti(EventoFatturaEmessa, "fatture", f.ID, f)
+	return nil
 }
 
 func (db *DB) GetFattura(id int) (*Fattura, error) {
 	return db.mongo.GetFattura(id)
 }
 
+// UpdateFattura salva il documento mantenendone tipo, numero, sezionale e
+// riferimento; la data resta nell'anno e nell'ordine della numerazione
 func (db *DB) UpdateFattura(f *Fattura) error {
-	return db.mongo.UpdateFattura(f)
+	if err := db.Autorizza(RisorsaFatture, PermessoModifica); err != nil {
+		return err
+	}
+	if err := db.controllaModificaNumerata(f); err != nil {
+		return err
+	}
+	f.Calcola()
+	if err := db.controllaRiferimento(f); err != nil {
+		return err
+	}
+	if err := db.controllaCommesse(f); err != nil {
+		return err
+	}
+	if err := db.controllaIncassata(f); err != nil {
+		return err
+	}
+	if err := db.mongo.UpdateFattura(f); err != nil {
+		return err
+	}
+	db.traccia(AzioneModifica, "fatture", f.ID)
+	return nil
 }
 
+// DeleteFattura elimina il documento; quelli numerati solo se sono l'ultimo
+// della sequenza, le fatture solo se non hanno note di credito né incassi
 func (db *DB) DeleteFattura(id int) error {
-	return db.mongo.DeleteFattura(id)
+	if err := db.Autorizza(RisorsaFatture, PermessoElimina); err != nil {
+		return err
+	}
+	if err := db.controllaEliminazione(id); err != nil {
+		return err
+	}
+	if err := db.controllaEliminazioneIncassata(id); err != nil {
+		return err
+	}
+	if err := db.eliminaNumerata(id); err != nil {
+		return err
+	}
+	db.traccia(AzioneElimina, "fatture", id)
+	return nil
 }
 
 func (db *DB) ListFatture() ([]Fattura, error) {
@@ -212,8 +493,21 @@ func (db *DB) ListFatture() ([]Fattura, error) {
 
 // ==================== MOVIMENTI PRIMA NOTA ====================
 
+// CreateMovimentoPrimaNota registra il movimento; un'entrata assegnata a
+// una fattura non ne supera il residuo da incassare
 func (db *DB) CreateMovimentoPrimaNota(mov *MovimentoPrimaNota) error {
-	return db.mongo.CreateMovimentoPrimaNota(mov)
+	if err := db.Autorizza(RisorsaMovimenti, PermessoCrea); err != nil {
+		return err
+	}
+	if err := db.controllaIncasso(mov); err != nil {
+		return err
+	}
+	if err := db.mongo.CreateMovimentoPrimaNota(mov); err != nil {
+		return err
+	}
+	db.traccia(AzioneCrea, "movimenti_primanota", mov.ID)
+	db.emetti(EventoMovimentoRegistrato, "movimenti_primanota", mov.ID, mov)
+	return nil
 }
 
 func (db *DB) GetMovimentoPrimaNota(id int) (*MovimentoPrimaNota, error) {
@@ -221,17 +515,51 @@ func (db *DB) GetMovimentoPrimaNota(id int) (*MovimentoPrimaNota, error) {
 }
 
 func (db *DB) UpdateMovimentoPrimaNota(mov *MovimentoPrimaNota) error {
-	return db.mongo.UpdateMovimentoPrimaNota(mov)
+	if err := db.Autorizza(RisorsaMovimenti, PermessoModifica); err != nil {
+		return err
+	}
+	if err := db.controllaIncasso(mov); err != nil {
+		return err
+	}
+	if err := db.mongo.UpdateMovimentoPrimaNota(mov); err != nil {
+		return err
+	}
+	db.traccia(AzioneModifica, "movimenti_primanota", mov.ID)
+	return nil
 }
 
 func (db *DB) DeleteMovimentoPrimaNota(id int) error {
-	return db.mongo.DeleteMovimentoPrimaNota(id)
+	if err := db.Autorizza(RisorsaMovimenti, PermessoElimina); err != nil {
+		return err
+	}
+	if err := db.mongo.DeleteMovimentoPrimaNota(id); err != nil {
+		return err
+	}
+	db.traccia(AzioneElimina, "movimenti_primanota", id)
+	return nil
 }
 
 func (db *DB) ListMovimentiPrimaNota(filters map[string]interface{}) ([]MovimentoPrimaNota, error) {
 	return db.mongo.ListMovimentiPrimaNota(filters)
 }
 
+// ==================== PROFILO AZIENDA ====================
+
+func (db *DB) GetProfiloAzienda() (*ProfiloAzienda, error) {
+	return db.mongo.GetProfiloAzienda()
+}
+
+func (db *DB) SaveProfiloAzienda(p *ProfiloAzienda) error {
+	if err := db.Autorizza(RisorsaProfilo, PermessoModifica); err != nil {
+		return err
+	}
+	if err := db.mongo.SaveProfiloAzienda(p); err != nil {
+		return err
+	}
+	db.traccia(AzioneModifica, "profilo_azienda", p.ID)
+	return nil
+}
+
 // ==================== QUERY AGGREGATE ====================
 
 func (db *DB) GetVeicoliByCliente(clienteID int) ([]Veicolo, error) {
@@ -246,7 +574,7 @@ func (db *DB) GetPrimaNotaStats(anno int) (entrata float64, uscita float64, err
 	return db.mongo.GetPrimaNotaStats(anno)
 }
 
-// ==================== EXPORT ====================
+// ==================== EXPORT / IMPORT ====================
 
 func (db *DB) ExportToJSON(collection string) ([]byte, error) {
 	ctx := context.Background()
@@ -273,6 +601,12 @@ func (db *DB) ExportToJSON(collection string) ([]byte, error) {
 		cursor, err = db.mongo.db.Collection("fatture").Find(ctx, bson.M{})
 	case "movimenti_primanota":
 		cursor, err = db.mongo.db.Collection("movimenti_primanota").Find(ctx, bson.M{})
+	case "profilo_azienda":
+		cursor, err = db.mongo.db.Collection("profilo_azienda").Find(ctx, bson.M{})
+	case "contatori":
+		cursor, err = db.mongo.db.Collection("contatori").Find(ctx, bson.M{})
+	case "carichi_magazzino":
+		cursor, err = db.mongo.db.Collection("carichi_magazzino").Find(ctx, bson.M{})
 	default:
 		return nil, fmt.Errorf("collezione sconosciuta: %s", collection)
 	}
@@ -282,15 +616,122 @@ func (db *DB) ExportToJSON(collection string) ([]byte, error) {
 	}
 	defer cursor.Close(ctx)
 
-	var results []bson.M
+	var results []bson.D
 	if err := cursor.All(ctx, &results); err != nil {
 		return nil, fmt.Errorf("errore decodifica export: %w", err)
 	}
 
-	data, err := bson.MarshalExtJSON(results, true, true)
+	// MarshalExtJSON accetta solo documenti: serializza ogni record e
+	// compone l'array JSON a mano
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, doc := range results {
+		data, err := bson.MarshalExtJSON(doc, true, true)
+		if err != nil {
+			return nil, fmt.Errorf("errore serializzazione JSON: %w", err)
+		}
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		buf.Write(data)
+	}
+	buf.WriteString("]")
+
+	return buf.Bytes(), nil
+}
+
+// ImportReport riassume l'esito di ImportFromJSON
+type ImportReport struct {
+	Collection string `json:"collection"`
+	Inseriti   int    `json:"inseriti"`
+	Aggiornati int    `json:"aggiornati"`
+	Saltati    int    `json:"saltati"`
+}
+
+// ImportFromJSON importa in una collezione un array JSON nel formato di
+// ExportToJSON. I record vengono abbinati per id: quelli nuovi sono inseriti,
+// quelli già presenti sovrascritti solo se sovrascrivi è true. Le scritture
+// avvengono in un'unica transazione.
+func (db *DB) ImportFromJSON(collection string, data []byte, sovrascrivi bool) (*ImportReport, error) {
+	valida := false
+	for _, c := range backupCollections {
+		valida = valida || c == collection
+	}
+	if !valida {
+		return nil, fmt.Errorf("collezione sconosciuta: %s", collection)
+	}
+
+	docs, err := parseExtJSONArray(data, collection)
 	if err != nil {
-		return nil, fmt.Errorf("errore serializzazione JSON: %w", err)
+		return nil, err
+	}
+
+	ctx := context.Background()
+	coll := db.mongo.db.Collection(collection)
+	report := &ImportReport{Collection: collection}
+
+	type scrittura struct {
+		id      int
+		doc     bson.D
+		replace bool
+	}
+	var scritture []scrittura
+
+	visti := make(map[int]bool)
+	for i, doc := range docs {
+		id, ok := documentID(doc)
+		if !ok {
+			return nil, fmt.Errorf("documento %d di %s senza id", i, collection)
+		}
+		if visti[id] {
+			return nil, fmt.Errorf("id %d duplicato in %s", id, collection)
+		}
+		visti[id] = true
+
+		n, err := coll.CountDocuments(ctx, bson.M{"id": id})
+		if err != nil {
+			return nil, fmt.Errorf("errore lettura %s: %w", collection, err)
+		}
+
+		switch {
+		case n == 0:
+			scritture = append(scritture, scrittura{id, senzaObjectID(doc), false})
+			report.Inseriti++
+		case sovrascrivi:
+			scritture = append(scritture, scrittura{id, senzaObjectID(doc), true})
+			report.Aggiornati++
+		default:
+			report.Saltati++
+		}
+	}
+
+	if len(scritture) == 0 {
+		return report, nil
+	}
+
+	err = db.mongo.db.Client().UseSession(ctx, func(sessionContext mongo.SessionContext) error {
+		if err := sessionContext.StartTransaction(); err != nil {
+			return err
+		}
+
+		for _, s := range scritture {
+			var err error
+			if s.replace {
+				_, err = coll.ReplaceOne(sessionContext, bson.M{"id": s.id}, s.doc)
+			} else {
+				_, err = coll.InsertOne(sessionContext, s.doc)
+			}
+			if err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return fmt.Errorf("errore import %s #%d: %w", collection, s.id, err)
+			}
+		}
+
+		return sessionContext.CommitTransaction(sessionContext)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return data, nil
+	return report, nil
 }
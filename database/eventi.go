@@ -0,0 +1,187 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"officina/logger"
+)
+
+// Eventi di dominio, emessi dopo una scrittura riuscita
+const (
+	EventoCommessaChiusa      = "commessa.chiusa"
+	EventoPreventivoAccettato = "preventivo.accettato"
+	EventoAppuntamentoCreato  = "appuntamento.creato"
+	EventoFatturaEmessa       = "fattura.emessa"
+	EventoMovimentoRegistrato = "movimento.registrato"
+)
+
+// TipiEvento elenca gli eventi di dominio
+var TipiEvento = []string{
+	EventoCommessaChiusa,
+	EventoPreventivoAccettato,
+	EventoAppuntamentoCreato,
+	EventoFatturaEmessa,
+	EventoMovimentoRegistrato,
+}
+
+// IsValidTipoEvento verifica se un tipo di evento è valido
+func IsValidTipoEvento(tipo string) bool {
+	for _, t := range TipiEvento {
+		if t == tipo {
+			return true
+		}
+	}
+	return false
+}
+
+// Evento descrive un fatto di dominio avvenuto sul database: chi l'ha
+// causato, quando e il record interessato così com'era dopo la scrittura
+type Evento struct {
+	ID         string    `json:"id"`
+	Tipo       string    `json:"evento"`
+	Data       time.Time `json:"data"`
+	Origine    string    `json:"origine"`
+	Operatore  string    `json:"operatore,omitempty"` // matricola
+	Collezione string    `json:"collezione"`
+	RecordID   int       `json:"record_id"`
+	Dati       any       `json:"dati"`
+}
+
+// ascoltatori raccoglie le funzioni che ricevono gli eventi; è condiviso
+// da tutte le sessioni di una connessione
+type ascoltatori struct {
+	mu    sync.RWMutex
+	lista []func(Evento)
+}
+
+// AscoltaEventi registra una funzione chiamata, in modo sincrono, dopo
+// ogni scrittura che produce un evento. Deve tornare subito: il lavoro
+// lento (chiamate di rete) va fatto in un'altra goroutine.
+func (db *DB) AscoltaEventi(f func(Evento)) {
+	if db.eventi == nil {
+		db.eventi = &ascoltatori{}
+	}
+	db.eventi.mu.Lock()
+	defer db.eventi.mu.Unlock()
+	db.eventi.lista = append(db.eventi.lista, f)
+}
+
+// inAscolto indica se qualcuno riceve gli eventi, per evitare le letture
+// necessarie a riconoscerli quando non servono
+func (db *DB) inAscolto() bool {
+	if db.eventi == nil {
+		return false
+	}
+	db.eventi.mu.RLock()
+	defer db.eventi.mu.RUnlock()
+	return len(db.eventi.lista) > 0
+}
+
+// emetti notifica un evento agli ascoltatori
+func (db *DB) emetti(tipo, collezione string, id int, dati any) {
+	if !db.inAscolto() {
+		return
+	}
+
+	e := Evento{
+		ID:         nuovoIDEvento(),
+		Tipo:       tipo,
+		Data:       time.Now(),
+		Origine:    OrigineSistema,
+		Collezione: collezione,
+		RecordID:   id,
+		Dati:       dati,
+	}
+	if db.sessione != nil {
+		e.Origine = db.sessione.origine
+	}
+	if o := db.OperatoreCorrente(); o != nil {
+		e.Operatore = o.Matricola
+	}
+	logger.Debug("Evento %s %s #%d (%s)", e.Tipo, collezione, id, e.ID)
+
+	db.eventi.mu.RLock()
+	lista := db.eventi.lista
+	db.eventi.mu.RUnlock()
+	for _, f := range lista {
+		f(e)
+	}
+}
+
+// statoCommessa indica se la commessa salvata ha lo stato indicato; serve a
+// riconoscere il passaggio di stato prima di sovrascriverla
+func (db *DB) statoCommessa(id int, stato string) bool {
+	c, err := db.mongo.GetCommessa(id)
+	return err == nil && c.Stato == stato
+}
+
+// preventivoAccettato indica se il preventivo salvato è già accettato
+func (db *DB) preventivoAccettato(id int) bool {
+	p, err := db.mongo.GetPreventivo(id)
+	return err == nil && p.Accettato
+}
+
+// nuovoIDEvento genera un identificativo casuale, usato dai destinatari
+// per riconoscere le consegne ripetute
+func nuovoIDEvento() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// ==================== CONSEGNE WEBHOOK ====================
+
+// ConsegnaWebhook è un tentativo di consegna di un evento a un webhook
+type ConsegnaWebhook struct {
+	Data       time.Time     `json:"data"`
+	Webhook    string        `json:"webhook"` // nome del webhook
+	URL        string        `json:"url"`
+	Evento     string        `json:"evento"`
+	EventoID   string        `json:"evento_id"`
+	RecordID   int           `json:"record_id"`
+	Tentativo  int           `json:"tentativo"` // da 1
+	Stato      int           `json:"stato"`     // codice HTTP, 0 se nessuna risposta
+	Errore     string        `json:"errore,omitempty"`
+	Durata     time.Duration `json:"durata"`
+	Riuscita   bool          `json:"riuscita"`
+	Definitiva bool          `json:"definitiva"` // ultimo tentativo per l'evento
+}
+
+// RegistraConsegnaWebhook salva un tentativo di consegna nel registro
+// consegne_webhook
+func (db *DB) RegistraConsegnaWebhook(c ConsegnaWebhook) error {
+	if _, err := db.mongo.db.Collection("consegne_webhook").InsertOne(db.mongo.ctx, c); err != nil {
+		return fmt.Errorf("errore registrazione consegna webhook: %w", err)
+	}
+	return nil
+}
+
+// ListConsegneWebhook restituisce i tentativi di consegna, dal più recente;
+// limite 0 = nessun limite
+func (db *DB) ListConsegneWebhook(limite int) ([]ConsegnaWebhook, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "data", Value: -1}})
+	if limite > 0 {
+		opts.SetLimit(int64(limite))
+	}
+
+	cursor, err := db.mongo.db.Collection("consegne_webhook").Find(db.mongo.ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura consegne webhook: %w", err)
+	}
+	defer cursor.Close(db.mongo.ctx)
+
+	var list []ConsegnaWebhook
+	if err := cursor.All(db.mongo.ctx, &list); err != nil {
+		return nil, fmt.Errorf("errore lettura consegne webhook: %w", err)
+	}
+	return list, nil
+}
@@ -0,0 +1,301 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RigaFattura è una riga di dettaglio della fattura. Le righe senza IVA
+// hanno AliquotaIVA zero e indicano la Natura dell'operazione.
+type RigaFattura struct {
+	Descrizione    string  `json:"descrizione"`
+	Quantita       float64 `json:"quantita"`
+	PrezzoUnitario float64 `json:"prezzo_unitario"`
+	Sconto         float64 `json:"sconto"` // percentuale sul prezzo
+	AliquotaIVA    float64 `json:"aliquota_iva"`
+	Natura         string  `json:"natura,omitempty"`
+}
+
+// RiepilogoIVA somma le righe con la stessa aliquota o natura
+type RiepilogoIVA struct {
+	AliquotaIVA float64 `json:"aliquota_iva"`
+	Natura      string  `json:"natura,omitempty"`
+	Imponibile  float64 `json:"imponibile"`
+	Imposta     float64 `json:"imposta"`
+	Totale      float64 `json:"totale"`
+}
+
+// Arrotonda porta un importo al centesimo, con le metà lontano dallo zero.
+// Il primo arrotondamento elimina l'errore di rappresentazione dei float,
+// così che 2,675 diventi 2,68 e non 2,67.
+func Arrotonda(importo float64) float64 {
+	return math.Round(math.Round(importo*1e6)/1e4) / 100
+}
+
+// Imponibile restituisce il prezzo totale della riga: quantità per prezzo
+// unitario al netto dello sconto, arrotondato al centesimo
+func (r RigaFattura) Imponibile() float64 {
+	return Arrotonda(r.Quantita * r.PrezzoUnitario * (1 - r.Sconto/100))
+}
+
+// CodiceIVA restituisce l'aliquota ("22") o la natura ("N2.2") della riga,
+// nella forma accettata da ParseCodiceIVA
+func (r RigaFattura) CodiceIVA() string {
+	if r.Natura != "" {
+		return r.Natura
+	}
+	return strconv.FormatFloat(r.AliquotaIVA, 'f', -1, 64)
+}
+
+// ParseCodiceIVA interpreta un'aliquota ("22", "10%") o una natura ("N4")
+func ParseCodiceIVA(s string) (aliquota float64, natura string, err error) {
+	s = strings.ToUpper(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%")))
+	if strings.HasPrefix(s, "N") {
+		if !IsValidNaturaIVA(s) {
+			return 0, "", fmt.Errorf("natura IVA non valida: %s (valide: %v)", s, NatureIVA)
+		}
+		return 0, s, nil
+	}
+	aliquota, err = strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+	if err != nil || !IsValidAliquotaIVA(aliquota) {
+		return 0, "", fmt.Errorf("aliquota IVA non valida: %s (valide: %v o una natura N1-N7)", s, AliquoteIVA)
+	}
+	return aliquota, "", nil
+}
+
+func (r RigaFattura) Validate() error {
+	if strings.TrimSpace(r.Descrizione) == "" {
+		return fmt.Errorf("descrizione non può essere vuota")
+	}
+	if r.Quantita <= 0 {
+		return fmt.Errorf("quantità deve essere maggiore di zero")
+	}
+	if r.PrezzoUnitario < 0 {
+		return fmt.Errorf("prezzo unitario non può essere negativo")
+	}
+	if r.Sconto < 0 || r.Sconto > 100 {
+		return fmt.Errorf("sconto deve essere tra 0 e 100%%")
+	}
+	if r.Natura != "" {
+		if !IsValidNaturaIVA(r.Natura) {
+			return fmt.Errorf("natura IVA non valida: %s", r.Natura)
+		}
+		if r.AliquotaIVA != 0 {
+			return fmt.Errorf("natura %s ammessa solo con aliquota zero", r.Natura)
+		}
+		return nil
+	}
+	if !IsValidAliquotaIVA(r.AliquotaIVA) {
+		return fmt.Errorf("aliquota IVA non valida (valide: %v); senza IVA indicare la natura", AliquoteIVA)
+	}
+	return nil
+}
+
+// IVARiga restituisce aliquota e natura con cui la riga entra nel documento:
+// in inversione contabile le righe imponibili passano ad aliquota zero con
+// la natura N6.x del regime, le altre restano come sono
+func (f *Fattura) IVARiga(r RigaFattura) (aliquota float64, natura string) {
+	if InversioneContabile(f.RegimeIVA) && r.Natura == "" {
+		return 0, f.RegimeIVA
+	}
+	return r.AliquotaIVA, r.Natura
+}
+
+// SoggettaRitenuta indica se la riga concorre alla base della ritenuta
+// d'acconto: tutte tranne le spese anticipate in nome e per conto del
+// cliente (natura N1, escluse ex art. 15)
+func (f *Fattura) SoggettaRitenuta(r RigaFattura) bool {
+	return f.RitenutaTipo != "" && r.Natura != "N1"
+}
+
+// Calcola ricava dalle righe il riepilogo per aliquota e natura e i totali
+// del documento. L'imposta di ogni aliquota è calcolata sul suo imponibile
+// complessivo, non riga per riga, come nel riepilogo della FatturaPA. Le
+// fatture senza righe restano invariate.
+func (f *Fattura) Calcola() {
+	if len(f.Righe) == 0 {
+		f.Riepilogo = nil
+		return
+	}
+
+	type chiave struct {
+		aliquota float64
+		natura   string
+	}
+	perChiave := make(map[chiave]*RiepilogoIVA)
+	var baseRitenuta float64
+	for _, r := range f.Righe {
+		aliquota, natura := f.IVARiga(r)
+		k := chiave{aliquota, natura}
+		if perChiave[k] == nil {
+			perChiave[k] = &RiepilogoIVA{AliquotaIVA: aliquota, Natura: natura}
+		}
+		perChiave[k].Imponibile += r.Imponibile()
+		if f.SoggettaRitenuta(r) {
+			baseRitenuta += r.Imponibile()
+		}
+	}
+
+	f.Riepilogo = make([]RiepilogoIVA, 0, len(perChiave))
+	f.Imponibile, f.Imposta = 0, 0
+	for _, r := range perChiave {
+		r.Imponibile = Arrotonda(r.Imponibile)
+		r.Imposta = Arrotonda(r.Imponibile * r.AliquotaIVA / 100)
+		r.Totale = Arrotonda(r.Imponibile + r.Imposta)
+		f.Riepilogo = append(f.Riepilogo, *r)
+		f.Imponibile += r.Imponibile
+		f.Imposta += r.Imposta
+	}
+	f.Imponibile = Arrotonda(f.Imponibile)
+	f.Imposta = Arrotonda(f.Imposta)
+	f.Importo = Arrotonda(f.Imponibile + f.Imposta)
+	f.Ritenuta = 0
+	if f.RitenutaTipo != "" {
+		f.Ritenuta = Arrotonda(Arrotonda(baseRitenuta) * f.RitenutaAliquota / 100)
+	}
+
+	// Aliquote dalla più alta, poi le nature in ordine di codice
+	sort.Slice(f.Riepilogo, func(i, j int) bool {
+		a, b := f.Riepilogo[i], f.Riepilogo[j]
+		if a.AliquotaIVA != b.AliquotaIVA {
+			return a.AliquotaIVA > b.AliquotaIVA
+		}
+		return a.Natura < b.Natura
+	})
+}
+
+// TipoDocumento restituisce il tipo del documento; le fatture registrate
+// prima dei tipi sono fatture TD01
+func (f *Fattura) TipoDocumento() string {
+	if f.Tipo == "" {
+		return TipoDocumentoFattura
+	}
+	return f.Tipo
+}
+
+// NettoAPagare è quanto il cliente versa all'officina: il totale del
+// documento meno l'IVA in scissione dei pagamenti, che il cliente versa
+// all'erario, e meno la ritenuta d'acconto
+func (f *Fattura) NettoAPagare() float64 {
+	netto := f.Importo - f.Ritenuta
+	if f.RegimeIVA == RegimeIVAScissione {
+		netto -= f.Imposta
+	}
+	return Arrotonda(netto)
+}
+
+// Annotazioni restituisce le diciture obbligatorie del regime IVA e della
+// ritenuta, da riportare sul documento
+func (f *Fattura) Annotazioni() []string {
+	var note []string
+	switch {
+	case f.RegimeIVA == RegimeIVAScissione:
+		note = append(note, "Scissione dei pagamenti ai sensi dell'art. 17-ter del DPR 633/72: l'IVA è versata all'erario dal cessionario")
+	case InversioneContabile(f.RegimeIVA):
+		note = append(note, fmt.Sprintf("Inversione contabile ai sensi dell'art. 17 del DPR 633/72 (%s - %s): l'imposta è dovuta dal committente",
+			f.RegimeIVA, DescrizioneNaturaIVA(f.RegimeIVA)))
+	}
+	if f.RitenutaTipo != "" {
+		note = append(note, fmt.Sprintf("Ritenuta d'acconto del %s%% (causale %s) operata dal committente in qualità di sostituto d'imposta",
+			strconv.FormatFloat(f.RitenutaAliquota, 'f', -1, 64), f.RitenutaCausale))
+	}
+	return note
+}
+
+// Credito è l'effetto del documento sui crediti verso il cliente: il netto
+// a pagare per fatture e differite, in negativo per le note di credito,
+// zero per le proforma
+func (f *Fattura) Credito() float64 {
+	switch f.TipoDocumento() {
+	case TipoDocumentoNotaCredito:
+		return -f.NettoAPagare()
+	case TipoDocumentoProforma:
+		return 0
+	}
+	return f.NettoAPagare()
+}
+
+func (f *Fattura) Validate() error {
+	if !IsValidTipoDocumento(f.Tipo) {
+		return fmt.Errorf("tipo documento non valido: %s", f.Tipo)
+	}
+	if f.TipoDocumento() == TipoDocumentoNotaCredito {
+		if f.RiferimentoID <= 0 {
+			return fmt.Errorf("la nota di credito deve indicare la fattura che storna")
+		}
+	} else if f.RiferimentoID != 0 {
+		return fmt.Errorf("solo le note di credito indicano una fattura di riferimento")
+	}
+	if len(f.Commesse) > 0 && f.TipoDocumento() == TipoDocumentoNotaCredito {
+		return fmt.Errorf("la nota di credito non fattura commesse")
+	}
+	commesse := make(map[int]bool, len(f.Commesse))
+	for _, id := range f.Commesse {
+		if id <= 0 || commesse[id] {
+			return fmt.Errorf("commessa %d non valida o ripetuta", id)
+		}
+		commesse[id] = true
+	}
+	if !IsValidCondizionePagamento(f.Pagamento) {
+		return fmt.Errorf("condizione di pagamento non valida: %s (valide: %v)", f.Pagamento, CondizioniPagamento)
+	}
+	if err := f.validaRegime(); err != nil {
+		return err
+	}
+	if f.Data.IsZero() {
+		return fmt.Errorf("data obbligatoria")
+	}
+	if f.ClienteID <= 0 {
+		return fmt.Errorf("cliente obbligatorio")
+	}
+	if err := validaSezionale(f.Sezionale); err != nil {
+		return err
+	}
+	for i, r := range f.Righe {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("riga %d: %w", i+1, err)
+		}
+	}
+	if f.Importo <= 0 {
+		return fmt.Errorf("importo deve essere maggiore di zero")
+	}
+	if f.NettoAPagare() <= 0 {
+		return fmt.Errorf("il netto a pagare deve essere maggiore di zero")
+	}
+	return nil
+}
+
+// validaRegime verifica regime IVA e ritenuta d'acconto, che si calcolano
+// sulle righe del documento
+func (f *Fattura) validaRegime() error {
+	if !IsValidRegimeIVA(f.RegimeIVA) {
+		return fmt.Errorf("regime IVA non valido: %s (validi: scissione dei pagamenti S o inversione contabile N6.1-N6.9)", f.RegimeIVA)
+	}
+	if f.RitenutaTipo == "" {
+		if f.RitenutaAliquota != 0 || f.RitenutaCausale != "" {
+			return fmt.Errorf("aliquota e causale della ritenuta richiedono il tipo di ritenuta")
+		}
+	} else {
+		if !IsValidTipoRitenuta(f.RitenutaTipo) {
+			return fmt.Errorf("tipo di ritenuta non valido: %s (validi: %s, %s)", f.RitenutaTipo, RitenutaPersoneFisiche, RitenutaPersoneGiuridiche)
+		}
+		if f.RitenutaAliquota <= 0 || f.RitenutaAliquota > 100 {
+			return fmt.Errorf("aliquota della ritenuta deve essere tra 0 e 100%%")
+		}
+		if !IsValidCausaleRitenuta(f.RitenutaCausale) {
+			return fmt.Errorf("causale del pagamento della ritenuta non valida: %s", f.RitenutaCausale)
+		}
+	}
+	if (f.RegimeIVA != RegimeIVAOrdinario || f.RitenutaTipo != "") && len(f.Righe) == 0 {
+		return fmt.Errorf("regime IVA e ritenuta richiedono le righe del documento")
+	}
+	for i, r := range f.Righe {
+		if f.RegimeIVA == RegimeIVAScissione && strings.HasPrefix(r.Natura, "N6") {
+			return fmt.Errorf("riga %d: la natura %s (inversione contabile) non ammette la scissione dei pagamenti", i+1, r.Natura)
+		}
+	}
+	return nil
+}
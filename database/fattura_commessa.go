@@ -0,0 +1,239 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Fatturazione delle commesse: una commessa chiusa si fattura una sola volta,
+// da sola (TD01) o insieme ad altre commesse dello stesso cliente in una
+// fattura differita (TD24). Il proprietario del veicolo è l'intestatario. I
+// costi di manodopera e ricambi della commessa sono al netto dell'IVA. Le
+// proforma possono indicare commesse senza fatturarle.
+
+// RigheCommessa restituisce le righe che fatturano la commessa: una per la
+// manodopera, con i lavori eseguiti, e una per i ricambi, all'aliquota o
+// natura indicata. Le descrizioni riportano numero, data di chiusura e targa,
+// come richiesto per i documenti richiamati da una fattura differita.
+func RigheCommessa(c *Commessa, targa string, aliquota float64, natura string) []RigaFattura {
+	rif := fmt.Sprintf("commessa %s del %s", c.Numero, c.DataChiusura.Format("02/01/2006"))
+	if targa != "" {
+		rif += " (" + strings.ToUpper(targa) + ")"
+	}
+
+	var righe []RigaFattura
+	riga := func(descrizione string, importo float64) {
+		if importo <= 0 {
+			return
+		}
+		righe = append(righe, RigaFattura{
+			Descrizione:    descrizione,
+			Quantita:       1,
+			PrezzoUnitario: Arrotonda(importo),
+			AliquotaIVA:    aliquota,
+			Natura:         natura,
+		})
+	}
+
+	manodopera := "Manodopera " + rif
+	var lavori []string
+	for _, l := range strings.Split(c.LavoriEseguiti, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			lavori = append(lavori, l)
+		}
+	}
+	if len(lavori) > 0 {
+		manodopera += ": " + strings.Join(lavori, ", ")
+	}
+	riga(manodopera, c.CostoManodopera)
+	riga("Ricambi "+rif, c.CostoRicambi)
+	return righe
+}
+
+// FatturaCommessa restituisce la fattura o fattura differita che ha
+// fatturato la commessa id, nil se non è ancora fatturata
+func (db *DB) FatturaCommessa(id int) (*Fattura, error) {
+	return db.fatturaCommessa(db.mongo.ctx, id)
+}
+
+// fatturaCommessa cerca la fattura della commessa nel contesto indicato,
+// anche quello di una transazione
+func (db *DB) fatturaCommessa(ctx context.Context, id int) (*Fattura, error) {
+	var f Fattura
+	err := db.mongo.db.Collection("fatture").FindOne(ctx, bson.M{
+		"commesse": id,
+		"tipo":     bson.M{"$in": bson.A{"", nil, TipoDocumentoFattura, TipoDocumentoDifferita}},
+	}).Decode(&f)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore ricerca fattura della commessa: %w", err)
+	}
+	return &f, nil
+}
+
+// BozzaFatturaCommesse prepara la fattura delle commesse indicate, in ordine
+// di chiusura: una fattura per una sola commessa, una fattura differita per
+// più commesse. Le commesse devono essere chiuse, non ancora fatturate e di
+// veicoli dello stesso proprietario. La bozza va salvata con CreateFattura.
+func (db *DB) BozzaFatturaCommesse(ids []int) (*Fattura, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("nessuna commessa da fatturare")
+	}
+	profilo, err := db.GetProfiloAzienda()
+	if err != nil {
+		return nil, err
+	}
+	aliquota, natura := profilo.IVAPredefinita()
+
+	type daFatturare struct {
+		commessa *Commessa
+		veicolo  *Veicolo
+	}
+	var elenco []daFatturare
+	for _, id := range ids {
+		c, v, err := db.commessaChiusa(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.controllaFatturata(c, 0); err != nil {
+			return nil, err
+		}
+		if len(elenco) > 0 && v.ClienteID != elenco[0].veicolo.ClienteID {
+			return nil, fmt.Errorf("le commesse %s e %s sono di clienti diversi", elenco[0].commessa.Numero, c.Numero)
+		}
+		elenco = append(elenco, daFatturare{c, v})
+	}
+	sort.SliceStable(elenco, func(i, j int) bool {
+		return elenco[i].commessa.DataChiusura.Before(elenco[j].commessa.DataChiusura)
+	})
+
+	f := &Fattura{
+		Tipo:      TipoDocumentoFattura,
+		Data:      time.Now(),
+		ClienteID: elenco[0].veicolo.ClienteID,
+	}
+	if len(elenco) > 1 {
+		f.Tipo = TipoDocumentoDifferita
+	}
+	for _, e := range elenco {
+		f.Commesse = append(f.Commesse, e.commessa.ID)
+		f.Righe = append(f.Righe, RigheCommessa(e.commessa, e.veicolo.Targa, aliquota, natura)...)
+	}
+	if len(f.Righe) == 0 {
+		return nil, fmt.Errorf("le commesse non hanno costi da fatturare")
+	}
+	f.Calcola()
+	return f, nil
+}
+
+// commessaChiusa legge una commessa da fatturare e il suo veicolo, che deve
+// avere un proprietario
+func (db *DB) commessaChiusa(id int) (*Commessa, *Veicolo, error) {
+	c, err := db.mongo.GetCommessa(id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("commessa %d: %w", id, err)
+	}
+	if c.IsOpen() {
+		return nil, nil, fmt.Errorf("la commessa %s è ancora aperta: chiuderla prima di fatturarla", c.Numero)
+	}
+	v, err := db.mongo.GetVeicolo(c.VeicoloID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("veicolo della commessa %s: %w", c.Numero, err)
+	}
+	if v.ClienteID <= 0 {
+		return nil, nil, fmt.Errorf("il veicolo %s della commessa %s non ha un proprietario da fatturare", v.Targa, c.Numero)
+	}
+	return c, v, nil
+}
+
+// controllaFatturata verifica che la commessa non sia già fatturata da un
+// documento diverso da escludi (la fattura in modifica)
+func (db *DB) controllaFatturata(c *Commessa, escludi int) error {
+	f, err := db.FatturaCommessa(c.ID)
+	if err != nil {
+		return err
+	}
+	if f != nil && f.ID != escludi {
+		return fmt.Errorf("la commessa %s è già fatturata con la fattura %s", c.Numero, f.Numero)
+	}
+	return nil
+}
+
+// controllaCommesse verifica le commesse indicate dal documento: chiuse,
+// dei veicoli del cliente e, salvo per le proforma, non fatturate da altri
+// documenti
+func (db *DB) controllaCommesse(f *Fattura) error {
+	for _, id := range f.Commesse {
+		c, v, err := db.commessaChiusa(id)
+		if err != nil {
+			return err
+		}
+		if v.ClienteID != f.ClienteID {
+			return fmt.Errorf("la commessa %s è del veicolo %s di un altro cliente", c.Numero, v.Targa)
+		}
+		if f.TipoDocumento() == TipoDocumentoProforma {
+			continue
+		}
+		if err := db.controllaFatturata(c, f.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// riservaCommesse ripete, nella transazione che numera e inserisce il
+// documento, il controllo che le sue commesse non siano già fatturate e
+// incrementa il contatore ContatoreFatturazioneCommesse. Due sessioni che
+// fatturano commesse nello stesso momento scrivono così lo stesso
+// documento: una delle transazioni va in conflitto e, ritentata, trova la
+// fattura dell'altra.
+func (db *DB) riservaCommesse(ctx mongo.SessionContext, f *Fattura) error {
+	if len(f.Commesse) == 0 || f.TipoDocumento() == TipoDocumentoProforma {
+		return nil
+	}
+	for _, id := range f.Commesse {
+		fc, err := db.fatturaCommessa(ctx, id)
+		if err != nil {
+			return err
+		}
+		if fc != nil {
+			numero := strconv.Itoa(id)
+			if c, err := db.mongo.GetCommessa(id); err == nil {
+				numero = c.Numero
+			}
+			return fmt.Errorf("la commessa %s è già fatturata con la fattura %s", numero, fc.Numero)
+		}
+	}
+	_, err := db.mongo.db.Collection("contatori").UpdateOne(ctx,
+		bson.M{"chiave": ContatoreFatturazioneCommesse},
+		bson.M{
+			"$inc":         bson.M{"valore": 1},
+			"$setOnInsert": bson.M{"id": idContatore(ContatoreFatturazioneCommesse)},
+		},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// controllaCommessaFatturata impedisce di riaprire o eliminare una commessa
+// già fatturata
+func (db *DB) controllaCommessaFatturata(id int) error {
+	f, err := db.FatturaCommessa(id)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		return fmt.Errorf("la commessa è fatturata con la fattura %s", f.Numero)
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArrotonda(t *testing.T) {
+	tests := []struct {
+		importo, want float64
+	}{
+		{2.675, 2.68},
+		{1.005, 1.01},
+		{0.125, 0.13},
+		{10.004999, 10},
+		{-2.675, -2.68},
+		{1234.5, 1234.5},
+	}
+
+	for _, tt := range tests {
+		if got := Arrotonda(tt.importo); got != tt.want {
+			t.Errorf("Arrotonda(%v) = %v, want %v", tt.importo, got, tt.want)
+		}
+	}
+}
+
+func TestFatturaCalcola(t *testing.T) {
+	tests := []struct {
+		name       string
+		righe      []RigaFattura
+		riepilogo  []RiepilogoIVA
+		imponibile float64
+		imposta    float64
+		totale     float64
+	}{
+		{
+			name: "aliquota unica con sconto",
+			righe: []RigaFattura{
+				{Descrizione: "Manodopera", Quantita: 2.5, PrezzoUnitario: 40, AliquotaIVA: 22},
+				{Descrizione: "Filtro olio", Quantita: 1, PrezzoUnitario: 12.90, Sconto: 10, AliquotaIVA: 22},
+			},
+			riepilogo:  []RiepilogoIVA{{AliquotaIVA: 22, Imponibile: 111.61, Imposta: 24.55, Totale: 136.16}},
+			imponibile: 111.61, imposta: 24.55, totale: 136.16,
+		},
+		{
+			// L'imposta sull'imponibile complessivo (3 x 0,33 = 0,99 -> 0,22)
+			// differisce dalla somma delle imposte di riga (3 x 0,07 = 0,21)
+			name: "imposta calcolata sul totale dell'aliquota",
+			righe: []RigaFattura{
+				{Descrizione: "Rondella", Quantita: 1, PrezzoUnitario: 0.33, AliquotaIVA: 22},
+				{Descrizione: "Rondella", Quantita: 1, PrezzoUnitario: 0.33, AliquotaIVA: 22},
+				{Descrizione: "Rondella", Quantita: 1, PrezzoUnitario: 0.33, AliquotaIVA: 22},
+			},
+			riepilogo:  []RiepilogoIVA{{AliquotaIVA: 22, Imponibile: 0.99, Imposta: 0.22, Totale: 1.21}},
+			imponibile: 0.99, imposta: 0.22, totale: 1.21,
+		},
+		{
+			name: "aliquote e nature diverse",
+			righe: []RigaFattura{
+				{Descrizione: "Bollo", Quantita: 1, PrezzoUnitario: 2, Natura: "N1"},
+				{Descrizione: "Pneumatici", Quantita: 4, PrezzoUnitario: 89.99, AliquotaIVA: 22},
+				{Descrizione: "Ausilio disabili", Quantita: 1, PrezzoUnitario: 150, AliquotaIVA: 4},
+				{Descrizione: "Revisione", Quantita: 1, PrezzoUnitario: 45, Natura: "N4"},
+			},
+			riepilogo: []RiepilogoIVA{
+				{AliquotaIVA: 22, Imponibile: 359.96, Imposta: 79.19, Totale: 439.15},
+				{AliquotaIVA: 4, Imponibile: 150, Imposta: 6, Totale: 156},
+				{Natura: "N1", Imponibile: 2, Totale: 2},
+				{Natura: "N4", Imponibile: 45, Totale: 45},
+			},
+			imponibile: 556.96, imposta: 85.19, totale: 642.15,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Fattura{Righe: tt.righe}
+			f.Calcola()
+
+			if !reflect.DeepEqual(f.Riepilogo, tt.riepilogo) {
+				t.Errorf("Riepilogo = %+v, want %+v", f.Riepilogo, tt.riepilogo)
+			}
+			if f.Imponibile != tt.imponibile || f.Imposta != tt.imposta || f.Importo != tt.totale {
+				t.Errorf("totali = %v + %v = %v, want %v + %v = %v",
+					f.Imponibile, f.Imposta, f.Importo, tt.imponibile, tt.imposta, tt.totale)
+			}
+		})
+	}
+
+	// Le fatture senza righe conservano l'importo registrato
+	f := &Fattura{Importo: 122}
+	f.Calcola()
+	if f.Importo != 122 || f.Riepilogo != nil {
+		t.Errorf("fattura senza righe = %+v", f)
+	}
+}
+
+func TestRigaFatturaValidate(t *testing.T) {
+	valida := RigaFattura{Descrizione: "Tagliando", Quantita: 1, PrezzoUnitario: 100, AliquotaIVA: 22}
+
+	tests := []struct {
+		name    string
+		modify  func(r *RigaFattura)
+		wantErr bool
+	}{
+		{"riga valida", func(r *RigaFattura) {}, false},
+		{"senza descrizione", func(r *RigaFattura) { r.Descrizione = " " }, true},
+		{"quantità zero", func(r *RigaFattura) { r.Quantita = 0 }, true},
+		{"sconto oltre 100", func(r *RigaFattura) { r.Sconto = 120 }, true},
+		{"aliquota non prevista", func(r *RigaFattura) { r.AliquotaIVA = 21 }, true},
+		{"aliquota zero senza natura", func(r *RigaFattura) { r.AliquotaIVA = 0 }, true},
+		{"natura valida", func(r *RigaFattura) { r.AliquotaIVA, r.Natura = 0, "N2.2" }, false},
+		{"natura con aliquota", func(r *RigaFattura) { r.Natura = "N4" }, true},
+		{"natura sconosciuta", func(r *RigaFattura) { r.AliquotaIVA, r.Natura = 0, "N2" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valida
+			tt.modify(&r)
+			if err := r.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCodiceIVA(t *testing.T) {
+	tests := []struct {
+		in       string
+		aliquota float64
+		natura   string
+		wantErr  bool
+	}{
+		{"22", 22, "", false},
+		{" 10% ", 10, "", false},
+		{"n2.2", 0, "N2.2", false},
+		{"N4", 0, "N4", false},
+		{"21", 0, "", true},
+		{"N8", 0, "", true},
+		{"", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		aliquota, natura, err := ParseCodiceIVA(tt.in)
+		if (err != nil) != tt.wantErr || aliquota != tt.aliquota || natura != tt.natura {
+			t.Errorf("ParseCodiceIVA(%q) = %v, %q, %v", tt.in, aliquota, natura, err)
+		}
+	}
+}
+
+func TestTipoDocumento(t *testing.T) {
+	data := time.Date(2026, 3, 5, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		f       Fattura
+		credito float64
+		wantErr bool
+	}{
+		{"fattura senza tipo", Fattura{}, 122, false},
+		{"differita", Fattura{Tipo: TipoDocumentoDifferita}, 122, false},
+		{"nota di credito", Fattura{Tipo: TipoDocumentoNotaCredito, RiferimentoID: 1}, -122, false},
+		{"proforma", Fattura{Tipo: TipoDocumentoProforma}, 0, false},
+		{"nota senza fattura", Fattura{Tipo: TipoDocumentoNotaCredito}, -122, true},
+		{"fattura con riferimento", Fattura{RiferimentoID: 1}, 122, true},
+		{"tipo sconosciuto", Fattura{Tipo: "TD99"}, 122, true},
+		{"differita con commesse", Fattura{Tipo: TipoDocumentoDifferita, Commesse: []int{3, 4}}, 122, false},
+		{"commessa ripetuta", Fattura{Commesse: []int{3, 3}}, 122, true},
+		{"nota con commesse", Fattura{Tipo: TipoDocumentoNotaCredito, RiferimentoID: 1, Commesse: []int{3}}, -122, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.f
+			f.Data, f.ClienteID, f.Importo = data, 1, 122
+			if got := f.Credito(); got != tt.credito {
+				t.Errorf("Credito() = %v, atteso %v", got, tt.credito)
+			}
+			if err := f.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	note := []Fattura{
+		{ID: 2, Tipo: TipoDocumentoNotaCredito, RiferimentoID: 1, Importo: 20.1},
+		{ID: 3, Tipo: TipoDocumentoNotaCredito, RiferimentoID: 1, Importo: 30.2},
+		{ID: 4, Tipo: TipoDocumentoNotaCredito, RiferimentoID: 9, Importo: 5},
+	}
+	if got := Stornato(1, note, 0); got != 50.3 {
+		t.Errorf("Stornato() = %v", got)
+	}
+	if got := Stornato(1, note, 3); got != 20.1 {
+		t.Errorf("Stornato() senza la nota in modifica = %v", got)
+	}
+}
+
+func TestRegimeIVA(t *testing.T) {
+	righe := []RigaFattura{
+		{Descrizione: "Manodopera", Quantita: 1, PrezzoUnitario: 100, AliquotaIVA: 22},
+		{Descrizione: "Bollo anticipato", Quantita: 1, PrezzoUnitario: 10, Natura: "N1"},
+	}
+	tests := []struct {
+		name      string
+		f         Fattura
+		riepilogo []RiepilogoIVA
+		imposta   float64
+		ritenuta  float64
+		netto     float64
+		note      int
+		wantErr   bool
+	}{
+		{
+			name:      "ordinario",
+			riepilogo: []RiepilogoIVA{{AliquotaIVA: 22, Imponibile: 100, Imposta: 22, Totale: 122}, {Natura: "N1", Imponibile: 10, Totale: 10}},
+			imposta:   22, netto: 132,
+		},
+		{
+			name:      "scissione dei pagamenti",
+			f:         Fattura{RegimeIVA: RegimeIVAScissione},
+			riepilogo: []RiepilogoIVA{{AliquotaIVA: 22, Imponibile: 100, Imposta: 22, Totale: 122}, {Natura: "N1", Imponibile: 10, Totale: 10}},
+			imposta:   22, netto: 110, note: 1,
+		},
+		{
+			name:      "inversione contabile",
+			f:         Fattura{RegimeIVA: "N6.3"},
+			riepilogo: []RiepilogoIVA{{Natura: "N1", Imponibile: 10, Totale: 10}, {Natura: "N6.3", Imponibile: 100, Totale: 100}},
+			netto:     110, note: 1,
+		},
+		{
+			name:      "ritenuta senza le spese anticipate",
+			f:         Fattura{RitenutaTipo: RitenutaPersoneFisiche, RitenutaAliquota: 20, RitenutaCausale: "A"},
+			riepilogo: []RiepilogoIVA{{AliquotaIVA: 22, Imponibile: 100, Imposta: 22, Totale: 122}, {Natura: "N1", Imponibile: 10, Totale: 10}},
+			imposta:   22, ritenuta: 20, netto: 112, note: 1,
+		},
+		{
+			name: "scissione e ritenuta",
+			f: Fattura{RegimeIVA: RegimeIVAScissione,
+				RitenutaTipo: RitenutaPersoneGiuridiche, RitenutaAliquota: 4, RitenutaCausale: "A"},
+			riepilogo: []RiepilogoIVA{{AliquotaIVA: 22, Imponibile: 100, Imposta: 22, Totale: 122}, {Natura: "N1", Imponibile: 10, Totale: 10}},
+			imposta:   22, ritenuta: 4, netto: 106, note: 2,
+		},
+		{name: "regime sconosciuto", f: Fattura{RegimeIVA: "N4"}, wantErr: true},
+		{name: "ritenuta senza causale", f: Fattura{RitenutaTipo: RitenutaPersoneFisiche, RitenutaAliquota: 20}, wantErr: true},
+		{name: "ritenuta senza aliquota", f: Fattura{RitenutaTipo: RitenutaPersoneFisiche, RitenutaCausale: "A"}, wantErr: true},
+		{name: "aliquota senza tipo", f: Fattura{RitenutaAliquota: 20}, wantErr: true},
+		{name: "tipo sconosciuto", f: Fattura{RitenutaTipo: "RT09", RitenutaAliquota: 20, RitenutaCausale: "A"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.f
+			f.Data, f.ClienteID, f.Righe = time.Date(2026, 3, 5, 0, 0, 0, 0, time.Local), 1, righe
+			f.Calcola()
+			err := f.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(f.Riepilogo, tt.riepilogo) {
+				t.Errorf("Riepilogo = %+v, want %+v", f.Riepilogo, tt.riepilogo)
+			}
+			if f.Imposta != tt.imposta || f.Ritenuta != tt.ritenuta || f.NettoAPagare() != tt.netto {
+				t.Errorf("imposta %v, ritenuta %v, netto %v; attesi %v, %v, %v",
+					f.Imposta, f.Ritenuta, f.NettoAPagare(), tt.imposta, tt.ritenuta, tt.netto)
+			}
+			// Il credito verso il cliente e le rate sono il netto a pagare
+			if f.Credito() != tt.netto || f.Scadenze()[0].Importo != tt.netto {
+				t.Errorf("Credito() = %v, Scadenze() = %+v, atteso %v", f.Credito(), f.Scadenze(), tt.netto)
+			}
+			if note := f.Annotazioni(); len(note) != tt.note {
+				t.Errorf("Annotazioni() = %q, attese %d", note, tt.note)
+			}
+		})
+	}
+
+	// Scissione dei pagamenti e inversione contabile non si combinano
+	f := Fattura{Data: time.Now(), ClienteID: 1, RegimeIVA: RegimeIVAScissione,
+		Righe: []RigaFattura{{Descrizione: "Rottami", Quantita: 1, PrezzoUnitario: 50, Natura: "N6.1"}}}
+	f.Calcola()
+	if err := f.Validate(); err == nil {
+		t.Error("scissione con righe N6: errore atteso")
+	}
+	// Il regime si applica solo alle fatture con righe
+	f = Fattura{Data: time.Now(), ClienteID: 1, RegimeIVA: RegimeIVAScissione, Importo: 122}
+	if err := f.Validate(); err == nil {
+		t.Error("scissione senza righe: errore atteso")
+	}
+}
+
+func TestRigheCommessa(t *testing.T) {
+	c := &Commessa{
+		Numero:          "COM-0012",
+		DataChiusura:    time.Date(2026, 3, 5, 0, 0, 0, 0, time.Local),
+		LavoriEseguiti:  "tagliando, , freni ",
+		CostoManodopera: 150,
+		CostoRicambi:    80.555,
+	}
+	righe := RigheCommessa(c, "ab123cd", 22, "")
+	want := []RigaFattura{
+		{Descrizione: "Manodopera commessa COM-0012 del 05/03/2026 (AB123CD): tagliando, freni", Quantita: 1, PrezzoUnitario: 150, AliquotaIVA: 22},
+		{Descrizione: "Ricambi commessa COM-0012 del 05/03/2026 (AB123CD)", Quantita: 1, PrezzoUnitario: 80.56, AliquotaIVA: 22},
+	}
+	if !reflect.DeepEqual(righe, want) {
+		t.Errorf("RigheCommessa() = %+v", righe)
+	}
+
+	// Senza ricambi resta la sola manodopera, qui senza IVA
+	c.CostoRicambi = 0
+	if righe := RigheCommessa(c, "", 0, "N2.2"); len(righe) != 1 || righe[0].Natura != "N2.2" {
+		t.Errorf("RigheCommessa() senza ricambi = %+v", righe)
+	}
+}
+
+func TestCalcolaIncassi(t *testing.T) {
+	data := time.Date(2026, 1, 20, 0, 0, 0, 0, time.Local)
+	giorno := func(m, g int) time.Time { return time.Date(2026, time.Month(m), g, 0, 0, 0, 0, time.Local) }
+	entrata := func(importo float64) MovimentoPrimaNota {
+		return MovimentoPrimaNota{Tipo: TipoMovimentoEntrata, Importo: importo, FatturaID: 1}
+	}
+
+	tests := []struct {
+		name      string
+		pagamento string
+		stornato  float64
+		incassi   []MovimentoPrimaNota
+		oggi      time.Time
+		scadenze  []Scadenza
+		stato     string
+		ritardo   int
+	}{
+		{"rimessa diretta", "", 0, nil, data, []Scadenza{{data, 100, 100}}, StatoDaIncassare, 0},
+		{"rimessa diretta scaduta", PagamentoImmediato, 0, nil, giorno(1, 25), []Scadenza{{data, 100, 100}}, StatoScaduta, 5},
+		{"30 gg fine mese", Pagamento30FM, 0, nil, giorno(2, 28), []Scadenza{{giorno(2, 28), 100, 100}}, StatoDaIncassare, 0},
+		{"tre rate, prima incassata", Pagamento306090FM, 0, []MovimentoPrimaNota{entrata(33.33)}, giorno(3, 10),
+			[]Scadenza{{giorno(2, 28), 33.33, 0}, {giorno(3, 31), 33.33, 33.33}, {giorno(4, 30), 33.34, 33.34}}, StatoParziale, 0},
+		{"due rate, nota e incasso parziale", Pagamento3060FM, 20, []MovimentoPrimaNota{entrata(10)}, giorno(4, 1),
+			[]Scadenza{{giorno(2, 28), 50, 20}, {giorno(3, 31), 50, 50}}, StatoScaduta, 32},
+		{"incassata", Pagamento60FM, 0, []MovimentoPrimaNota{entrata(60), entrata(40)}, giorno(6, 1),
+			[]Scadenza{{giorno(3, 31), 100, 0}}, StatoIncassata, 0},
+		{"stornata", "", 100, nil, giorno(6, 1), []Scadenza{{data, 100, 0}}, StatoStornata, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Fattura{ID: 1, Data: data, Importo: 100, Pagamento: tt.pagamento}
+			s := CalcolaIncassi(f, tt.stornato, tt.incassi, tt.oggi)
+			if !reflect.DeepEqual(s.Scadenze, tt.scadenze) {
+				t.Errorf("scadenze = %+v, attese %+v", s.Scadenze, tt.scadenze)
+			}
+			if s.Stato != tt.stato || s.Ritardo != tt.ritardo {
+				t.Errorf("stato = %s (%d gg), atteso %s (%d gg)", s.Stato, s.Ritardo, tt.stato, tt.ritardo)
+			}
+		})
+	}
+}
+
+func TestScadenzario(t *testing.T) {
+	oggi := time.Date(2026, 6, 15, 0, 0, 0, 0, time.Local)
+	fatture := []Fattura{
+		{ID: 1, ClienteID: 1, Data: time.Date(2026, 6, 1, 0, 0, 0, 0, time.Local), Importo: 100, Pagamento: Pagamento30FM},
+		{ID: 2, ClienteID: 1, Data: time.Date(2026, 5, 1, 0, 0, 0, 0, time.Local), Importo: 50},
+		{ID: 3, ClienteID: 2, Data: time.Date(2026, 1, 10, 0, 0, 0, 0, time.Local), Importo: 200},
+		{ID: 4, ClienteID: 2, Data: time.Date(2026, 6, 1, 0, 0, 0, 0, time.Local), Importo: 80},
+		{ID: 5, Tipo: TipoDocumentoProforma, ClienteID: 2, Data: time.Date(2026, 6, 1, 0, 0, 0, 0, time.Local), Importo: 80},
+	}
+	movimenti := []MovimentoPrimaNota{{ID: 9, Tipo: TipoMovimentoEntrata, Importo: 80, FatturaID: 4}}
+	clienti := []Cliente{{ID: 1, RagioneSociale: "Rossi"}, {ID: 2, RagioneSociale: "Bianchi"}}
+
+	r := Scadenzario(fatture, movimenti, clienti, oggi)
+	if len(r.Clienti) != 2 || r.Totale != 350 {
+		t.Fatalf("scadenzario = %+v", r)
+	}
+	if c := r.Clienti[0]; c.Cliente != "Bianchi" || c.Fatture != 1 || !reflect.DeepEqual(c.Fasce, []float64{0, 0, 0, 0, 200}) {
+		t.Errorf("Bianchi = %+v", c)
+	}
+	if c := r.Clienti[1]; c.Cliente != "Rossi" || c.Fatture != 2 || !reflect.DeepEqual(c.Fasce, []float64{100, 0, 50, 0, 0}) {
+		t.Errorf("Rossi = %+v", c)
+	}
+	if !reflect.DeepEqual(r.Totali, []float64{100, 0, 50, 0, 200}) {
+		t.Errorf("totali = %v", r.Totali)
+	}
+}
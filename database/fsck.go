@@ -0,0 +1,231 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Anomalia descrive un problema di integrità rilevato da CheckIntegrity
+type Anomalia struct {
+	Collection string `json:"collection"`
+	ID         int    `json:"id"`
+	Messaggio  string `json:"messaggio"`
+}
+
+func (a Anomalia) String() string {
+	return fmt.Sprintf("%s #%d: %s", a.Collection, a.ID, a.Messaggio)
+}
+
+// IntegrityReport è il risultato di un controllo di integrità
+type IntegrityReport struct {
+	Documenti map[string]int `json:"documenti"`
+	Anomalie  []Anomalia     `json:"anomalie"`
+}
+
+// OK indica se il controllo non ha trovato anomalie
+func (r *IntegrityReport) OK() bool {
+	return len(r.Anomalie) == 0
+}
+
+// datiIntegrita contiene i record su cui si basa il controllo
+type datiIntegrita struct {
+	clienti      []Cliente
+	fornitori    []Fornitore
+	veicoli      []Veicolo
+	commesse     []Commessa
+	appuntamenti []Appuntamento
+	fatture      []Fattura
+	movimenti    []MovimentoPrimaNota
+}
+
+// CheckIntegrity verifica i dati senza modificarli: id duplicati, record che
+// non superano la validazione e riferimenti a clienti, veicoli, commesse o
+// fornitori inesistenti.
+func (db *DB) CheckIntegrity() (*IntegrityReport, error) {
+	var d datiIntegrita
+	var err error
+
+	if d.clienti, err = db.ListClienti(); err != nil {
+		return nil, fmt.Errorf("errore lettura clienti: %w", err)
+	}
+	if d.fornitori, err = db.ListFornitori(); err != nil {
+		return nil, fmt.Errorf("errore lettura fornitori: %w", err)
+	}
+	if d.veicoli, err = db.ListVeicoli(); err != nil {
+		return nil, fmt.Errorf("errore lettura veicoli: %w", err)
+	}
+	if d.commesse, err = db.ListCommesse(); err != nil {
+		return nil, fmt.Errorf("errore lettura commesse: %w", err)
+	}
+	if d.appuntamenti, err = db.ListAppuntamenti(); err != nil {
+		return nil, fmt.Errorf("errore lettura appuntamenti: %w", err)
+	}
+	if d.fatture, err = db.ListFatture(); err != nil {
+		return nil, fmt.Errorf("errore lettura fatture: %w", err)
+	}
+	if d.movimenti, err = db.ListMovimentiPrimaNota(nil); err != nil {
+		return nil, fmt.Errorf("errore lettura prima nota: %w", err)
+	}
+
+	report := checkIntegrity(&d)
+
+	// Il profilo è facoltativo, ma se presente deve essere valido
+	if p, err := db.GetProfiloAzienda(); err != nil {
+		return nil, fmt.Errorf("errore lettura profilo azienda: %w", err)
+	} else if !p.AggiornatoIl.IsZero() {
+		if err := p.Validate(); err != nil {
+			report.Anomalie = append(report.Anomalie, Anomalia{"profilo_azienda", p.ID, err.Error()})
+		}
+	}
+
+	return report, nil
+}
+
+// checkIntegrity esegue i controlli sui dati già caricati
+func checkIntegrity(d *datiIntegrita) *IntegrityReport {
+	r := &IntegrityReport{Documenti: map[string]int{
+		"clienti":             len(d.clienti),
+		"fornitori":           len(d.fornitori),
+		"veicoli":             len(d.veicoli),
+		"commesse":            len(d.commesse),
+		"appuntamenti":        len(d.appuntamenti),
+		"fatture":             len(d.fatture),
+		"movimenti_primanota": len(d.movimenti),
+	}}
+
+	add := func(collection string, id int, format string, args ...interface{}) {
+		r.Anomalie = append(r.Anomalie, Anomalia{collection, id, fmt.Sprintf(format, args...)})
+	}
+
+	// ids registra gli id di una collezione segnalando i duplicati
+	ids := func(collection string, n int, id func(i int) int) map[int]bool {
+		visti := make(map[int]bool, n)
+		for i := 0; i < n; i++ {
+			if visti[id(i)] {
+				add(collection, id(i), "id duplicato")
+			}
+			visti[id(i)] = true
+		}
+		return visti
+	}
+
+	clienti := ids("clienti", len(d.clienti), func(i int) int { return d.clienti[i].ID })
+	fornitori := ids("fornitori", len(d.fornitori), func(i int) int { return d.fornitori[i].ID })
+	veicoli := ids("veicoli", len(d.veicoli), func(i int) int { return d.veicoli[i].ID })
+	commesse := ids("commesse", len(d.commesse), func(i int) int { return d.commesse[i].ID })
+	ids("appuntamenti", len(d.appuntamenti), func(i int) int { return d.appuntamenti[i].ID })
+	ids("fatture", len(d.fatture), func(i int) int { return d.fatture[i].ID })
+	ids("movimenti_primanota", len(d.movimenti), func(i int) int { return d.movimenti[i].ID })
+
+	for _, c := range d.clienti {
+		if err := c.Validate(); err != nil {
+			add("clienti", c.ID, "%v", err)
+		}
+	}
+
+	for _, f := range d.fornitori {
+		if err := f.Validate(); err != nil {
+			add("fornitori", f.ID, "%v", err)
+		}
+	}
+
+	targhe := make(map[string]int)
+	for _, v := range d.veicoli {
+		if err := v.Validate(); err != nil {
+			add("veicoli", v.ID, "%v", err)
+		}
+		if v.ClienteID > 0 && !clienti[v.ClienteID] {
+			add("veicoli", v.ID, "cliente %d inesistente", v.ClienteID)
+		}
+		targa := strings.ToUpper(strings.ReplaceAll(v.Targa, " ", ""))
+		if altro, ok := targhe[targa]; ok && targa != "" {
+			add("veicoli", v.ID, "targa %s già usata dal veicolo %d", v.Targa, altro)
+		} else {
+			targhe[targa] = v.ID
+		}
+	}
+
+	for _, c := range d.commesse {
+		if err := c.Validate(); err != nil {
+			add("commesse", c.ID, "%v", err)
+		}
+		if c.VeicoloID > 0 && !veicoli[c.VeicoloID] {
+			add("commesse", c.ID, "veicolo %d inesistente", c.VeicoloID)
+		}
+	}
+
+	for _, a := range d.appuntamenti {
+		if a.VeicoloID > 0 && !veicoli[a.VeicoloID] {
+			add("appuntamenti", a.ID, "veicolo %d inesistente", a.VeicoloID)
+		}
+	}
+
+	fatture := make(map[int]bool, len(d.fatture))
+	stornato := make(map[int]float64)
+	fatturata := make(map[int]int) // commessa -> fattura che la fattura
+	for _, f := range d.fatture {
+		fatture[f.ID] = true
+		if f.TipoDocumento() == TipoDocumentoNotaCredito {
+			stornato[f.RiferimentoID] += f.NettoAPagare()
+		}
+	}
+	for _, f := range d.fatture {
+		if f.ClienteID > 0 && !clienti[f.ClienteID] {
+			add("fatture", f.ID, "cliente %d inesistente", f.ClienteID)
+		}
+		if f.TipoDocumento() == TipoDocumentoNotaCredito && !fatture[f.RiferimentoID] {
+			add("fatture", f.ID, "la nota di credito storna la fattura %d, inesistente", f.RiferimentoID)
+		}
+		for _, id := range f.Commesse {
+			if !commesse[id] {
+				add("fatture", f.ID, "commessa %d inesistente", id)
+			} else if Stornabile(f.Tipo) {
+				if altra, ok := fatturata[id]; ok {
+					add("fatture", f.ID, "commessa %d già fatturata dalla fattura %d", id, altra)
+				} else {
+					fatturata[id] = f.ID
+				}
+			}
+		}
+		if s := Arrotonda(stornato[f.ID]); s > f.NettoAPagare() {
+			add("fatture", f.ID, "le note di credito (%.2f) superano il totale (%.2f)", s, f.NettoAPagare())
+		}
+		if len(f.Righe) > 0 {
+			ricalcolata := f
+			ricalcolata.Calcola()
+			if ricalcolata.Importo != f.Importo {
+				add("fatture", f.ID, "totale %.2f diverso da quello delle righe (%.2f)", f.Importo, ricalcolata.Importo)
+			}
+			if ricalcolata.Ritenuta != f.Ritenuta {
+				add("fatture", f.ID, "ritenuta %.2f diversa da quella delle righe (%.2f)", f.Ritenuta, ricalcolata.Ritenuta)
+			}
+		}
+	}
+
+	incassato := make(map[int]float64)
+	for _, m := range d.movimenti {
+		if err := m.Validate(); err != nil {
+			add("movimenti_primanota", m.ID, "%v", err)
+		}
+		if m.FatturaID > 0 {
+			if !fatture[m.FatturaID] {
+				add("movimenti_primanota", m.ID, "fattura %d inesistente", m.FatturaID)
+			}
+			incassato[m.FatturaID] += m.Importo
+		}
+		if m.CommessaID > 0 && !commesse[m.CommessaID] {
+			add("movimenti_primanota", m.ID, "commessa %d inesistente", m.CommessaID)
+		}
+		if m.FornitoreID > 0 && !fornitori[m.FornitoreID] {
+			add("movimenti_primanota", m.ID, "fornitore %d inesistente", m.FornitoreID)
+		}
+	}
+
+	for _, f := range d.fatture {
+		if i := Arrotonda(incassato[f.ID]); i > 0 && i > Arrotonda(f.Credito()-stornato[f.ID]) {
+			add("fatture", f.ID, "gli incassi (%.2f) superano il totale da incassare (%.2f)", i, Arrotonda(f.Credito()-stornato[f.ID]))
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	anno := time.Now().Year()
+
+	tests := []struct {
+		name    string
+		dati    datiIntegrita
+		attese  []string
+		clienti int
+	}{
+		{
+			name: "dati coerenti",
+			dati: datiIntegrita{
+				clienti:  []Cliente{{ID: 1, RagioneSociale: "Rossi"}},
+				veicoli:  []Veicolo{{ID: 10, Targa: "AB123CD", Marca: "Fiat", Anno: anno, ClienteID: 1}},
+				commesse: []Commessa{{ID: 20, VeicoloID: 10, Stato: StatoCommessaAperta}},
+				movimenti: []MovimentoPrimaNota{
+					{ID: 30, Tipo: TipoMovimentoEntrata, Importo: 10, Metodo: MetodoPagamentoCassa, CommessaID: 20},
+				},
+			},
+			clienti: 1,
+		},
+		{
+			name: "riferimenti mancanti",
+			dati: datiIntegrita{
+				veicoli:      []Veicolo{{ID: 10, Targa: "AB123CD", Marca: "Fiat", Anno: anno, ClienteID: 7}},
+				commesse:     []Commessa{{ID: 20, VeicoloID: 99, Stato: StatoCommessaChiusa}},
+				appuntamenti: []Appuntamento{{ID: 40, VeicoloID: 98}},
+				fatture:      []Fattura{{ID: 50, ClienteID: 8}},
+			},
+			attese: []string{
+				"veicoli #10: cliente 7 inesistente",
+				"commesse #20: veicolo 99 inesistente",
+				"appuntamenti #40: veicolo 98 inesistente",
+				"fatture #50: cliente 8 inesistente",
+			},
+		},
+		{
+			name: "duplicati e record non validi",
+			dati: datiIntegrita{
+				clienti: []Cliente{{ID: 1, RagioneSociale: "Rossi"}, {ID: 1, RagioneSociale: ""}},
+				veicoli: []Veicolo{
+					{ID: 10, Targa: "AB123CD", Marca: "Fiat", Anno: anno, ClienteID: 1},
+					{ID: 11, Targa: "ab 123 cd", Marca: "Fiat", Anno: anno, ClienteID: 1},
+				},
+			},
+			attese: []string{
+				"clienti #1: id duplicato",
+				"clienti #1: ragione sociale non può essere vuota",
+				"veicoli #11: targa ab 123 cd già usata dal veicolo 10",
+			},
+			clienti: 2,
+		},
+		{
+			name: "totale fattura diverso dalle righe",
+			dati: datiIntegrita{
+				clienti: []Cliente{{ID: 1, RagioneSociale: "Rossi"}},
+				fatture: []Fattura{
+					{ID: 50, ClienteID: 1, Importo: 122, Righe: []RigaFattura{{Descrizione: "Tagliando", Quantita: 1, PrezzoUnitario: 100, AliquotaIVA: 22}}},
+					{ID: 51, ClienteID: 1, Importo: 100, Righe: []RigaFattura{{Descrizione: "Tagliando", Quantita: 1, PrezzoUnitario: 100, AliquotaIVA: 22}}},
+				},
+			},
+			attese:  []string{"fatture #51: totale 100.00 diverso da quello delle righe (122.00)"},
+			clienti: 1,
+		},
+		{
+			name: "note di credito",
+			dati: datiIntegrita{
+				clienti: []Cliente{{ID: 1, RagioneSociale: "Rossi"}},
+				fatture: []Fattura{
+					{ID: 50, ClienteID: 1, Importo: 100},
+					{ID: 51, Tipo: TipoDocumentoNotaCredito, ClienteID: 1, RiferimentoID: 50, Importo: 60},
+					{ID: 52, Tipo: TipoDocumentoNotaCredito, ClienteID: 1, RiferimentoID: 50, Importo: 50},
+					{ID: 53, Tipo: TipoDocumentoNotaCredito, ClienteID: 1, RiferimentoID: 49, Importo: 10},
+				},
+			},
+			attese: []string{
+				"fatture #50: le note di credito (110.00) superano il totale (100.00)",
+				"fatture #53: la nota di credito storna la fattura 49, inesistente",
+			},
+			clienti: 1,
+		},
+		{
+			name: "commesse fatturate",
+			dati: datiIntegrita{
+				clienti:  []Cliente{{ID: 1, RagioneSociale: "Rossi"}},
+				veicoli:  []Veicolo{{ID: 10, Targa: "AB123CD", Marca: "Fiat", Anno: anno, ClienteID: 1}},
+				commesse: []Commessa{{ID: 20, VeicoloID: 10, Stato: StatoCommessaChiusa}},
+				fatture: []Fattura{
+					{ID: 50, ClienteID: 1, Importo: 100, Commesse: []int{20}},
+					{ID: 51, Tipo: TipoDocumentoDifferita, ClienteID: 1, Importo: 100, Commesse: []int{20, 21}},
+					{ID: 52, Tipo: TipoDocumentoProforma, ClienteID: 1, Importo: 100, Commesse: []int{20}},
+				},
+			},
+			attese: []string{
+				"fatture #51: commessa 20 già fatturata dalla fattura 50",
+				"fatture #51: commessa 21 inesistente",
+			},
+			clienti: 1,
+		},
+		{
+			name: "incassi",
+			dati: datiIntegrita{
+				clienti: []Cliente{{ID: 1, RagioneSociale: "Rossi"}},
+				fatture: []Fattura{
+					{ID: 50, ClienteID: 1, Importo: 100},
+					{ID: 51, Tipo: TipoDocumentoNotaCredito, ClienteID: 1, RiferimentoID: 50, Importo: 30},
+				},
+				movimenti: []MovimentoPrimaNota{
+					{ID: 30, Tipo: TipoMovimentoEntrata, Importo: 50, Metodo: MetodoPagamentoCassa, FatturaID: 50},
+					{ID: 31, Tipo: TipoMovimentoEntrata, Importo: 40, Metodo: MetodoPagamentoBonifico, FatturaID: 50},
+					{ID: 32, Tipo: TipoMovimentoUscita, Importo: 5, Metodo: MetodoPagamentoCassa, FatturaID: 49},
+				},
+			},
+			attese: []string{
+				"movimenti_primanota #32: solo le entrate si assegnano a una fattura emessa",
+				"movimenti_primanota #32: fattura 49 inesistente",
+				"fatture #50: gli incassi (90.00) superano il totale da incassare (70.00)",
+			},
+			clienti: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := checkIntegrity(&tt.dati)
+
+			var got []string
+			for _, a := range r.Anomalie {
+				got = append(got, a.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.attese, "\n") {
+				t.Errorf("anomalie:\n%s\nattese:\n%s", strings.Join(got, "\n"), strings.Join(tt.attese, "\n"))
+			}
+			if r.OK() != (len(tt.attese) == 0) {
+				t.Errorf("OK() = %v", r.OK())
+			}
+			if r.Documenti["clienti"] != tt.clienti {
+				t.Errorf("documenti clienti = %d, attesi %d", r.Documenti["clienti"], tt.clienti)
+			}
+		})
+	}
+}
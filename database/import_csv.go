@@ -0,0 +1,786 @@
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"officina/utils"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Campi importabili da CSV. "codice" è il codice cliente del vecchio
+// gestionale: non viene salvato ma serve a collegare i veicoli.
+var (
+	CampiClienteCSV = []string{
+		"codice", "ragione_sociale", "telefono", "email", "pec", "codice_fiscale",
+		"partita_iva", "codice_destinatario", "indirizzo", "cap", "citta", "provincia",
+	}
+	CampiVeicoloCSV = []string{
+		"targa", "marca", "modello", "anno", "km", "ultima_rev", "cliente",
+	}
+)
+
+// sinonimiCSV elenca, per ogni campo, le intestazioni riconosciute in
+// automatico (confrontate minuscole e senza spazi né punteggiatura)
+var sinonimiCSV = map[string][]string{
+	"codice":              {"codice", "codicecliente", "codcliente", "codcli", "idcliente"},
+	"ragione_sociale":     {"ragionesociale", "ragsociale", "denominazione", "nominativo", "nome", "cognomenome", "intestatario"},
+	"telefono":            {"telefono", "tel", "cellulare", "cell", "recapito"},
+	"email":               {"email", "mail", "posta"},
+	"pec":                 {"pec", "emailpec", "postacertificata"},
+	"codice_fiscale":      {"codicefiscale", "codfiscale", "codfisc", "cf"},
+	"partita_iva":         {"partitaiva", "piva", "partiva", "iva", "vat"},
+	"codice_destinatario": {"codicedestinatario", "coddestinatario", "codicesdi", "sdi"},
+	"indirizzo":           {"indirizzo", "via", "sede"},
+	"cap":                 {"cap"},
+	"citta":               {"citta", "comune", "localita", "città"},
+	"provincia":           {"provincia", "prov", "pr"},
+	"targa":               {"targa", "targaveicolo"},
+	"marca":               {"marca", "casa", "costruttore"},
+	"modello":             {"modello", "mod"},
+	"anno":                {"anno", "annoimmatricolazione", "immatricolazione"},
+	"km":                  {"km", "chilometri", "kilometri", "percorrenza"},
+	"ultima_rev":          {"ultimarevisione", "ultimarev", "revisione", "datarevisione"},
+	"cliente":             {"cliente", "proprietario", "codicecliente", "codcliente", "intestatario"},
+}
+
+// Esiti di una riga importata
+const (
+	CSVNuovo      = "nuovo"
+	CSVEsistente  = "esistente"
+	CSVDuplicato  = "duplicato"
+	CSVErrore     = "errore"
+	CSVAvviso     = "avviso"
+	csvFileUnico  = "clienti+veicoli"
+	csvFileClient = "clienti"
+	csvFileVeic   = "veicoli"
+)
+
+// CSVImportOptions configura ImportCSV
+type CSVImportOptions struct {
+	// MappaClienti e MappaVeicoli associano un campo (es. "partita_iva")
+	// all'intestazione della colonna CSV; i campi assenti sono riconosciuti
+	// dalle intestazioni
+	MappaClienti map[string]string
+	MappaVeicoli map[string]string
+	// SaltaErrori importa le righe valide anche se altre contengono errori
+	SaltaErrori bool
+}
+
+// RigaCSV descrive l'esito di una riga del file
+type RigaCSV struct {
+	File      string `json:"file"`
+	Riga      int    `json:"riga"`
+	Esito     string `json:"esito"`
+	Chiave    string `json:"chiave"`
+	Messaggio string `json:"messaggio,omitempty"`
+}
+
+// CSVImportReport riassume un'importazione CSV, simulata o eseguita
+type CSVImportReport struct {
+	MappaClienti     map[string]string `json:"mappa_clienti"`
+	MappaVeicoli     map[string]string `json:"mappa_veicoli"`
+	ColonneIgnorate  []string          `json:"colonne_ignorate,omitempty"`
+	ClientiNuovi     int               `json:"clienti_nuovi"`
+	ClientiEsistenti int               `json:"clienti_esistenti"`
+	VeicoliNuovi     int               `json:"veicoli_nuovi"`
+	VeicoliEsistenti int               `json:"veicoli_esistenti"`
+	Duplicati        int               `json:"duplicati"`
+	Errori           int               `json:"errori"`
+	Righe            []RigaCSV         `json:"righe"`
+	Importato        bool              `json:"importato"`
+}
+
+// HasErrors indica se qualche riga non può essere importata
+func (r *CSVImportReport) HasErrors() bool {
+	return r.Errori > 0
+}
+
+// csvTabella è un file CSV letto in memoria
+type csvTabella struct {
+	nome         string
+	intestazioni []string
+	righe        [][]string
+}
+
+// ImportCSV importa clienti e veicoli da file CSV esportati da altri
+// programmi. Il file dei veicoli è facoltativo: se il file clienti contiene
+// anche la colonna targa, ogni riga può descrivere un cliente e un suo veicolo.
+//
+// Ogni riga viene validata con i validatori di utils e con Validate() del
+// modello; i duplicati sono cercati per partita IVA, codice fiscale e targa
+// sia nel file sia nel database. Con commit false nulla viene scritto e il
+// report descrive cosa accadrebbe; con commit true le scritture avvengono in
+// un'unica transazione, rifiutata se ci sono errori e SaltaErrori è false.
+func (db *DB) ImportCSV(clienti, veicoli io.Reader, opts CSVImportOptions, commit bool) (*CSVImportReport, error) {
+	esistentiClienti, err := db.ListClienti()
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura clienti: %w", err)
+	}
+	esistentiVeicoli, err := db.ListVeicoli()
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura veicoli: %w", err)
+	}
+
+	imp := newCSVImporter(esistentiClienti, esistentiVeicoli)
+	if err := imp.analizza(clienti, veicoli, opts); err != nil {
+		return nil, err
+	}
+
+	report := imp.report
+	if !commit {
+		return report, nil
+	}
+	if report.HasErrors() && !opts.SaltaErrori {
+		return report, fmt.Errorf("%d righe con errori: correggere il file o importare solo le righe valide", report.Errori)
+	}
+	if len(imp.nuoviClienti) == 0 && len(imp.nuoviVeicoli) == 0 {
+		return report, nil
+	}
+
+	// Gli id di CreateCliente/CreateVeicolo derivano dall'ora corrente: per
+	// centinaia di record si usano secondi passati non ancora occupati
+	idClienti := idLiberi(len(imp.nuoviClienti), esistentiClienti, func(c Cliente) int { return c.ID })
+	idVeicoli := idLiberi(len(imp.nuoviVeicoli), esistentiVeicoli, func(v Veicolo) int { return v.ID })
+
+	for i, c := range imp.nuoviClienti {
+		c.ID = idClienti[i]
+	}
+	for i, v := range imp.nuoviVeicoli {
+		v.veicolo.ID = idVeicoli[i]
+		if v.cliente != nil {
+			v.veicolo.ClienteID = v.cliente.ID
+		}
+	}
+
+	err = db.mongo.db.Client().UseSession(db.mongo.ctx, func(sessionContext mongo.SessionContext) error {
+		if err := sessionContext.StartTransaction(); err != nil {
+			return err
+		}
+
+		for _, c := range imp.nuoviClienti {
+			if _, err := db.mongo.db.Collection("clienti").InsertOne(sessionContext, c); err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return fmt.Errorf("errore import cliente %s: %w", c.RagioneSociale, err)
+			}
+		}
+		for _, v := range imp.nuoviVeicoli {
+			if _, err := db.mongo.db.Collection("veicoli").InsertOne(sessionContext, v.veicolo); err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return fmt.Errorf("errore import veicolo %s: %w", v.veicolo.Targa, err)
+			}
+		}
+
+		return sessionContext.CommitTransaction(sessionContext)
+	})
+	if err != nil {
+		return report, err
+	}
+
+	report.Importato = true
+	return report, nil
+}
+
+// idLiberi restituisce n id non usati, scendendo a partire dall'ora corrente
+func idLiberi[T any](n int, esistenti []T, id func(T) int) []int {
+	usati := make(map[int]bool, len(esistenti))
+	for _, e := range esistenti {
+		usati[id(e)] = true
+	}
+
+	ids := make([]int, 0, n)
+	for next := generaID() - 1; len(ids) < n; next-- {
+		if !usati[next] {
+			ids = append(ids, next)
+		}
+	}
+	return ids
+}
+
+// veicoloCSV è un veicolo da inserire con il cliente a cui collegarlo
+type veicoloCSV struct {
+	veicolo *Veicolo
+	cliente *Cliente // nil se il proprietario è già nel database
+}
+
+// csvImporter contiene lo stato dell'analisi
+type csvImporter struct {
+	report *CSVImportReport
+
+	nuoviClienti []*Cliente
+	nuoviVeicoli []*veicoloCSV
+
+	// Indici per duplicati e collegamenti: chiave normalizzata → cliente.
+	// I clienti del database hanno ID > 0, quelli del file ID 0 fino al commit.
+	perPIVA   map[string]*Cliente
+	perCF     map[string]*Cliente
+	perCodice map[string]*Cliente
+	perNome   map[string][]*Cliente
+	targhe    map[string]bool
+	segnalati map[*Cliente]bool // clienti del database già riportati come esistenti
+}
+
+func newCSVImporter(clienti []Cliente, veicoli []Veicolo) *csvImporter {
+	imp := &csvImporter{
+		report:    &CSVImportReport{Righe: []RigaCSV{}},
+		perPIVA:   make(map[string]*Cliente),
+		perCF:     make(map[string]*Cliente),
+		perCodice: make(map[string]*Cliente),
+		perNome:   make(map[string][]*Cliente),
+		targhe:    make(map[string]bool),
+		segnalati: make(map[*Cliente]bool),
+	}
+
+	for i := range clienti {
+		imp.indicizza(&clienti[i], "")
+	}
+	for _, v := range veicoli {
+		imp.targhe[normalizzaTarga(v.Targa)] = true
+	}
+
+	return imp
+}
+
+// indicizza registra un cliente negli indici di ricerca
+func (imp *csvImporter) indicizza(c *Cliente, codice string) {
+	if c.PartitaIVA != "" {
+		imp.perPIVA[c.PartitaIVA] = c
+	}
+	if c.CodiceFiscale != "" {
+		imp.perCF[strings.ToUpper(c.CodiceFiscale)] = c
+	}
+	if codice != "" {
+		imp.perCodice[strings.ToUpper(codice)] = c
+	}
+	nome := normalizzaNome(c.RagioneSociale)
+	imp.perNome[nome] = append(imp.perNome[nome], c)
+}
+
+// aggiungi registra l'esito di una riga nel report
+func (imp *csvImporter) aggiungi(file string, riga int, esito, chiave, format string, args ...interface{}) {
+	r := RigaCSV{File: file, Riga: riga, Esito: esito, Chiave: chiave}
+	if format != "" {
+		r.Messaggio = fmt.Sprintf(format, args...)
+	}
+	imp.report.Righe = append(imp.report.Righe, r)
+
+	switch esito {
+	case CSVErrore:
+		imp.report.Errori++
+	case CSVDuplicato:
+		imp.report.Duplicati++
+	}
+}
+
+// analizza legge i file e prepara le scritture senza toccare il database
+func (imp *csvImporter) analizza(clienti, veicoli io.Reader, opts CSVImportOptions) error {
+	if clienti == nil && veicoli == nil {
+		return fmt.Errorf("nessun file da importare")
+	}
+
+	var tabClienti, tabVeicoli *csvTabella
+	var err error
+	if clienti != nil {
+		if tabClienti, err = leggiCSV(clienti, csvFileClient); err != nil {
+			return err
+		}
+	}
+	if veicoli != nil {
+		if tabVeicoli, err = leggiCSV(veicoli, csvFileVeic); err != nil {
+			return err
+		}
+	}
+
+	// File unico: le colonne dei veicoli stanno nel file clienti
+	unico := false
+	if tabClienti != nil && tabVeicoli == nil {
+		if _, ok := opts.MappaVeicoli["targa"]; ok || trovaColonna(tabClienti.intestazioni, "targa") >= 0 {
+			unico = true
+			tabClienti.nome = csvFileUnico
+		}
+	}
+
+	var colClienti, colVeicoli map[string]int
+	usate := make(map[string]map[int]bool)
+
+	if tabClienti != nil {
+		colClienti, err = mappaColonne(tabClienti, CampiClienteCSV, opts.MappaClienti, []string{"ragione_sociale"})
+		if err != nil {
+			return err
+		}
+		imp.report.MappaClienti = nomiColonne(tabClienti, colClienti)
+		usate[tabClienti.nome] = indiciUsati(colClienti)
+	}
+
+	if unico || tabVeicoli != nil {
+		tab := tabVeicoli
+		obbligatori := []string{"targa", "marca", "cliente"}
+		if unico {
+			tab = tabClienti
+			obbligatori = []string{"targa", "marca"}
+		}
+
+		campi := CampiVeicoloCSV
+		if unico {
+			// Nel file unico "cliente" indicherebbe la colonna del nome
+			campi = CampiVeicoloCSV[:len(CampiVeicoloCSV)-1]
+		}
+		colVeicoli, err = mappaColonne(tab, campi, opts.MappaVeicoli, obbligatori)
+		if err != nil {
+			return err
+		}
+		imp.report.MappaVeicoli = nomiColonne(tab, colVeicoli)
+		if usate[tab.nome] == nil {
+			usate[tab.nome] = make(map[int]bool)
+		}
+		for i := range indiciUsati(colVeicoli) {
+			usate[tab.nome][i] = true
+		}
+	}
+
+	for _, tab := range []*csvTabella{tabClienti, tabVeicoli} {
+		if tab == nil {
+			continue
+		}
+		for i, h := range tab.intestazioni {
+			if !usate[tab.nome][i] && strings.TrimSpace(h) != "" {
+				imp.report.ColonneIgnorate = append(imp.report.ColonneIgnorate, tab.nome+": "+h)
+			}
+		}
+	}
+
+	if tabClienti != nil {
+		for i, rec := range tabClienti.righe {
+			riga := i + 2 // la riga 1 è l'intestazione
+			cliente := imp.analizzaCliente(tabClienti.nome, riga, valoriCampi(rec, colClienti))
+			if unico && cliente != nil {
+				imp.analizzaVeicolo(tabClienti.nome, riga, valoriCampi(rec, colVeicoli), cliente)
+			}
+		}
+	}
+
+	if tabVeicoli != nil {
+		for i, rec := range tabVeicoli.righe {
+			imp.analizzaVeicolo(tabVeicoli.nome, i+2, valoriCampi(rec, colVeicoli), nil)
+		}
+	}
+
+	return nil
+}
+
+// analizzaCliente valida una riga cliente; restituisce il cliente a cui
+// collegare eventuali veicoli della stessa riga (nuovo o già presente)
+func (imp *csvImporter) analizzaCliente(file string, riga int, v map[string]string) *Cliente {
+	c := &Cliente{
+		RagioneSociale:     v["ragione_sociale"],
+		Telefono:           v["telefono"],
+		Email:              v["email"],
+		PEC:                v["pec"],
+		CodiceFiscale:      strings.ToUpper(strings.ReplaceAll(v["codice_fiscale"], " ", "")),
+		PartitaIVA:         normalizzaPIVA(v["partita_iva"]),
+		CodiceDestinatario: strings.ToUpper(v["codice_destinatario"]),
+		Indirizzo:          v["indirizzo"],
+		CAP:                v["cap"],
+		Citta:              v["citta"],
+		Provincia:          strings.ToUpper(v["provincia"]),
+	}
+	chiave := c.RagioneSociale
+
+	// Riga vuota (ad es. solo veicolo nel file unico, o separatori finali)
+	vuota := true
+	for _, s := range v {
+		vuota = vuota && s == ""
+	}
+	if vuota {
+		return nil
+	}
+
+	if err := validaClienteCSV(c); err != nil {
+		imp.aggiungi(file, riga, CSVErrore, chiave, "%v", err)
+		return nil
+	}
+
+	// Duplicati per P.IVA e codice fiscale, nel database o nel file
+	var gia *Cliente
+	motivo := ""
+	if c.PartitaIVA != "" && imp.perPIVA[c.PartitaIVA] != nil {
+		gia, motivo = imp.perPIVA[c.PartitaIVA], "partita IVA "+c.PartitaIVA
+	} else if c.CodiceFiscale != "" && imp.perCF[c.CodiceFiscale] != nil {
+		gia, motivo = imp.perCF[c.CodiceFiscale], "codice fiscale "+c.CodiceFiscale
+	} else if file == csvFileUnico && c.PartitaIVA == "" && c.CodiceFiscale == "" {
+		// Nel file unico un privato senza identificativi si ripete per ogni
+		// veicolo: lo si riconosce dal nome, se già letto dal file stesso
+		for _, altro := range imp.perNome[normalizzaNome(c.RagioneSociale)] {
+			if altro.ID == 0 && altro.PartitaIVA == "" && altro.CodiceFiscale == "" {
+				gia = altro
+			}
+		}
+	}
+
+	if gia != nil {
+		if v["codice"] != "" {
+			imp.perCodice[strings.ToUpper(v["codice"])] = gia
+		}
+		ripetuto := file == csvFileUnico && normalizzaNome(gia.RagioneSociale) == normalizzaNome(c.RagioneSociale)
+		switch {
+		case gia.ID > 0:
+			if !imp.segnalati[gia] {
+				imp.segnalati[gia] = true
+				imp.report.ClientiEsistenti++
+				imp.aggiungi(file, riga, CSVEsistente, chiave, "%s già presente (cliente #%d %s)", motivo, gia.ID, gia.RagioneSociale)
+			}
+		case !ripetuto:
+			// Nel file unico lo stesso cliente compare su più righe, una per veicolo
+			imp.aggiungi(file, riga, CSVDuplicato, chiave, "%s già presente nel file (%s)", motivo, gia.RagioneSociale)
+		}
+		return gia
+	}
+
+	if v["codice"] != "" {
+		if altro := imp.perCodice[strings.ToUpper(v["codice"])]; altro != nil {
+			imp.aggiungi(file, riga, CSVErrore, chiave, "codice cliente %s ripetuto (già usato da %s)", v["codice"], altro.RagioneSociale)
+			return nil
+		}
+	}
+
+	imp.indicizza(c, v["codice"])
+	imp.nuoviClienti = append(imp.nuoviClienti, c)
+	imp.report.ClientiNuovi++
+	imp.aggiungi(file, riga, CSVNuovo, chiave, "")
+	return c
+}
+
+// analizzaVeicolo valida una riga veicolo; proprietario è il cliente della
+// stessa riga nel file unico, altrimenti viene cercato dalla colonna cliente
+func (imp *csvImporter) analizzaVeicolo(file string, riga int, v map[string]string, proprietario *Cliente) {
+	targa := normalizzaTarga(v["targa"])
+	if targa == "" && proprietario != nil {
+		return // nel file unico i clienti senza veicolo lasciano la targa vuota
+	}
+
+	veicolo := &Veicolo{
+		Targa:   targa,
+		Marca:   v["marca"],
+		Modello: v["modello"],
+	}
+
+	if err := utils.ValidateTarga(targa); err != nil {
+		imp.aggiungi(file, riga, CSVErrore, targa, "%v", err)
+		return
+	}
+
+	var err error
+	if v["anno"] != "" {
+		if veicolo.Anno, err = strconv.Atoi(v["anno"]); err != nil {
+			imp.aggiungi(file, riga, CSVErrore, targa, "anno non valido: %s", v["anno"])
+			return
+		}
+	}
+	if v["km"] != "" {
+		km := strings.NewReplacer(".", "", " ", "", "km", "", "KM", "").Replace(v["km"])
+		if veicolo.Km, err = strconv.Atoi(km); err != nil || veicolo.Km < 0 {
+			imp.aggiungi(file, riga, CSVErrore, targa, "km non validi: %s", v["km"])
+			return
+		}
+	}
+	if v["ultima_rev"] != "" {
+		if veicolo.UltimaRev, err = parseDataCSV(v["ultima_rev"]); err != nil {
+			imp.aggiungi(file, riga, CSVErrore, targa, "data revisione non valida: %s", v["ultima_rev"])
+			return
+		}
+	}
+
+	if proprietario == nil {
+		if proprietario, err = imp.trovaCliente(v["cliente"]); err != nil {
+			imp.aggiungi(file, riga, CSVErrore, targa, "%v", err)
+			return
+		}
+	}
+
+	// Validate richiede un cliente salvato e l'anno: l'id definitivo dei
+	// clienti nuovi si assegna al commit e l'anno manca spesso nei vecchi archivi
+	controllo := *veicolo
+	controllo.ClienteID = proprietario.ID
+	if controllo.ClienteID == 0 {
+		controllo.ClienteID = 1
+	}
+	if controllo.Anno == 0 {
+		controllo.Anno = time.Now().Year()
+	}
+	if err := controllo.Validate(); err != nil {
+		imp.aggiungi(file, riga, CSVErrore, targa, "%v", err)
+		return
+	}
+
+	if imp.targhe[targa] {
+		if proprietario.ID > 0 || file != csvFileUnico {
+			imp.report.VeicoliEsistenti++
+			imp.aggiungi(file, riga, CSVEsistente, targa, "targa già presente, veicolo non modificato")
+		} else {
+			imp.aggiungi(file, riga, CSVDuplicato, targa, "targa ripetuta nel file")
+		}
+		return
+	}
+	imp.targhe[targa] = true
+
+	nuovo := &veicoloCSV{veicolo: veicolo}
+	if proprietario.ID > 0 {
+		veicolo.ClienteID = proprietario.ID
+	} else {
+		nuovo.cliente = proprietario
+	}
+	imp.nuoviVeicoli = append(imp.nuoviVeicoli, nuovo)
+	imp.report.VeicoliNuovi++
+
+	if veicolo.Anno == 0 {
+		imp.aggiungi(file, riga, CSVAvviso, targa, "anno mancante")
+	} else if file != csvFileUnico {
+		imp.aggiungi(file, riga, CSVNuovo, targa, "")
+	}
+}
+
+// trovaCliente individua il proprietario di un veicolo: per codice del vecchio
+// gestionale, partita IVA, codice fiscale o ragione sociale
+func (imp *csvImporter) trovaCliente(rif string) (*Cliente, error) {
+	rif = strings.TrimSpace(rif)
+	if rif == "" {
+		return nil, fmt.Errorf("proprietario mancante")
+	}
+
+	if c := imp.perCodice[strings.ToUpper(rif)]; c != nil {
+		return c, nil
+	}
+	if c := imp.perPIVA[normalizzaPIVA(rif)]; c != nil {
+		return c, nil
+	}
+	if c := imp.perCF[strings.ToUpper(strings.ReplaceAll(rif, " ", ""))]; c != nil {
+		return c, nil
+	}
+
+	switch trovati := imp.perNome[normalizzaNome(rif)]; len(trovati) {
+	case 0:
+		return nil, fmt.Errorf("proprietario %q non trovato", rif)
+	case 1:
+		return trovati[0], nil
+	default:
+		return nil, fmt.Errorf("proprietario %q ambiguo (%d clienti con questo nome): usare codice, P.IVA o CF", rif, len(trovati))
+	}
+}
+
+// validaClienteCSV applica le stesse regole della schermata clienti
+func validaClienteCSV(c *Cliente) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if err := utils.ValidateEmail(c.Email); err != nil {
+		return err
+	}
+	if err := utils.ValidateEmail(c.PEC); err != nil {
+		return fmt.Errorf("PEC non valida: %w", err)
+	}
+	// Le società hanno un codice fiscale numerico di 11 cifre
+	if len(c.CodiceFiscale) == 11 {
+		if err := utils.ValidatePartitaIVA(c.CodiceFiscale); err != nil {
+			return fmt.Errorf("codice fiscale numerico non valido: %w", err)
+		}
+	} else if err := utils.ValidateCodiceFiscale(c.CodiceFiscale); err != nil {
+		return err
+	}
+	if err := utils.ValidatePartitaIVA(c.PartitaIVA); err != nil {
+		return err
+	}
+	if err := utils.ValidateCAP(c.CAP); err != nil {
+		return err
+	}
+	if err := utils.ValidateTelefono(c.Telefono); err != nil {
+		return err
+	}
+	return nil
+}
+
+// leggiCSV legge un file CSV riconoscendo separatore (; , o tab), BOM e
+// codifica Latin-1/Windows-1252 usata da molti gestionali
+func leggiCSV(r io.Reader, nome string) (*csvTabella, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura %s: %w", nome, err)
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		data = latin1ToUTF8(data)
+	}
+
+	primaRiga := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		primaRiga = data[:i]
+	}
+	sep := ';'
+	for _, s := range []rune{',', '\t'} {
+		if bytes.Count(primaRiga, []byte(string(s))) > bytes.Count(primaRiga, []byte(string(sep))) {
+			sep = s
+		}
+	}
+
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comma = sep
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.TrimLeadingSpace = true
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("errore parsing CSV %s: %w", nome, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("file %s vuoto", nome)
+	}
+
+	return &csvTabella{nome: nome, intestazioni: records[0], righe: records[1:]}, nil
+}
+
+// latin1ToUTF8 converte testo ISO-8859-1 in UTF-8
+func latin1ToUTF8(data []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(data) + len(data)/8)
+	for _, b := range data {
+		buf.WriteRune(rune(b))
+	}
+	return buf.Bytes()
+}
+
+// mappaColonne associa i campi agli indici di colonna: prima quelli
+// indicati esplicitamente, poi quelli riconosciuti dalle intestazioni
+func mappaColonne(tab *csvTabella, campi []string, esplicita map[string]string, obbligatori []string) (map[string]int, error) {
+	col := make(map[string]int)
+	usate := make(map[int]bool)
+
+	ammessi := make(map[string]bool, len(campi))
+	for _, c := range campi {
+		ammessi[c] = true
+	}
+
+	nomi := make([]string, 0, len(esplicita))
+	for campo := range esplicita {
+		nomi = append(nomi, campo)
+	}
+	sort.Strings(nomi)
+
+	for _, campo := range nomi {
+		if !ammessi[campo] {
+			return nil, fmt.Errorf("%s: campo sconosciuto %q (validi: %s)", tab.nome, campo, strings.Join(campi, ", "))
+		}
+		i := -1
+		for j, h := range tab.intestazioni {
+			if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(esplicita[campo])) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("%s: colonna %q non trovata per il campo %s", tab.nome, esplicita[campo], campo)
+		}
+		col[campo] = i
+		usate[i] = true
+	}
+
+	for _, campo := range campi {
+		if _, ok := col[campo]; ok {
+			continue
+		}
+		if i := trovaColonna(tab.intestazioni, campo); i >= 0 && !usate[i] {
+			col[campo] = i
+			usate[i] = true
+		}
+	}
+
+	for _, campo := range obbligatori {
+		if _, ok := col[campo]; !ok {
+			return nil, fmt.Errorf("%s: nessuna colonna per il campo obbligatorio %s (indicarla con la mappatura %s=<intestazione>)", tab.nome, campo, campo)
+		}
+	}
+
+	return col, nil
+}
+
+// trovaColonna cerca la colonna di un campo tra le intestazioni
+func trovaColonna(intestazioni []string, campo string) int {
+	for _, s := range sinonimiCSV[campo] {
+		for i, h := range intestazioni {
+			if normalizzaIntestazione(h) == s {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// valoriCampi estrae i valori di una riga secondo la mappatura
+func valoriCampi(rec []string, col map[string]int) map[string]string {
+	v := make(map[string]string, len(col))
+	for campo, i := range col {
+		if i < len(rec) {
+			v[campo] = strings.TrimSpace(rec[i])
+		}
+	}
+	return v
+}
+
+func nomiColonne(tab *csvTabella, col map[string]int) map[string]string {
+	nomi := make(map[string]string, len(col))
+	for campo, i := range col {
+		nomi[campo] = tab.intestazioni[i]
+	}
+	return nomi
+}
+
+func indiciUsati(col map[string]int) map[int]bool {
+	usati := make(map[int]bool, len(col))
+	for _, i := range col {
+		usati[i] = true
+	}
+	return usati
+}
+
+// normalizzaIntestazione riduce un'intestazione a lettere e cifre minuscole
+func normalizzaIntestazione(h string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(h) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == 'à' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func normalizzaNome(s string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(s)), " ")
+}
+
+func normalizzaTarga(s string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(s))
+}
+
+// normalizzaPIVA rimuove spazi e prefisso IT
+func normalizzaPIVA(s string) string {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	return strings.TrimPrefix(s, "IT")
+}
+
+// parseDataCSV accetta le date nei formati più comuni dei gestionali
+func parseDataCSV(s string) (time.Time, error) {
+	for _, layout := range []string{"02/01/2006", "2/1/2006", "02-01-2006", "2006-01-02", "02.01.2006", "02/01/06"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("formato data non riconosciuto")
+}
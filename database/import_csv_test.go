@@ -0,0 +1,117 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestAnalizzaCSV(t *testing.T) {
+	esistenti := []Cliente{{ID: 5, RagioneSociale: "Bianchi Srl", PartitaIVA: "01234567890"}}
+	veicoliEsistenti := []Veicolo{{ID: 9, Targa: "ZZ999ZZ", Marca: "Fiat", ClienteID: 5}}
+
+	tests := []struct {
+		name      string
+		clienti   string
+		veicoli   string
+		opts      CSVImportOptions
+		esiti     []string // file:riga esito, escluse le righe "nuovo"
+		nuoviC    int
+		nuoviV    int
+		collegati map[string]string // targa → ragione sociale del proprietario
+	}{
+		{
+			name: "file separati con codice cliente",
+			clienti: "\xef\xbb\xbfCodice;Nominativo;P.IVA;Cod. Fiscale;Prov\n" +
+				"C1;Rossi Mario;;rssmra80a01h501u;rm\n" +
+				"C2;Verdi Snc;IT 09876543210;;MI\n" +
+				"C3;Bianchi S.r.l.;01234567890;;TO\n",
+			veicoli: "Targa;Marca;Modello;Anno;Km;Cliente\n" +
+				"ab 123 cd;Fiat;Panda;2015;120.000;C1\n" +
+				"EF456GH;Ford;Focus;;;09876543210\n" +
+				"zz999zz;Fiat;Punto;2010;;C3\n" +
+				"GH789IJ;Opel;Corsa;2018;;Sconosciuto\n",
+			esiti: []string{
+				"clienti:4 esistente",
+				"veicoli:3 avviso",
+				"veicoli:4 esistente",
+				"veicoli:5 errore",
+			},
+			nuoviC:    2,
+			nuoviV:    2,
+			collegati: map[string]string{"AB123CD": "Rossi Mario", "EF456GH": "Verdi Snc"},
+		},
+		{
+			name: "file unico con cliente ripetuto e mappatura esplicita",
+			clienti: "Ragione,PI,Targa,Marca,Anno\n" +
+				"Neri Luca,,AA111AA,Fiat,2020\n" +
+				"Neri Luca,,BB222BB,Alfa,2019\n" +
+				"Gialli Spa,11111111111,CC333CC,Bmw,2021\n" +
+				"Blu Srl,11111111111,DD444DD,Audi,2021\n",
+			opts: CSVImportOptions{MappaClienti: map[string]string{"ragione_sociale": "Ragione", "partita_iva": "PI"}},
+			esiti: []string{
+				"clienti+veicoli:5 duplicato",
+			},
+			nuoviC: 2,
+			nuoviV: 4,
+			collegati: map[string]string{
+				"AA111AA": "Neri Luca", "BB222BB": "Neri Luca", "CC333CC": "Gialli Spa", "DD444DD": "Gialli Spa",
+			},
+		},
+		{
+			name: "errori di validazione",
+			clienti: "Ragione Sociale;Email;CAP;Partita IVA\n" +
+				";a@b.it;00100;\n" +
+				"Rossi;non-una-mail;00100;\n" +
+				"Verdi;;001;\n" +
+				"Gialli;;;123\n",
+			esiti: []string{
+				"clienti:2 errore",
+				"clienti:3 errore",
+				"clienti:4 errore",
+				"clienti:5 errore",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imp := newCSVImporter(esistenti, veicoliEsistenti)
+
+			var veicoli io.Reader
+			if tt.veicoli != "" {
+				veicoli = strings.NewReader(tt.veicoli)
+			}
+			if err := imp.analizza(strings.NewReader(tt.clienti), veicoli, tt.opts); err != nil {
+				t.Fatalf("analizza: %v", err)
+			}
+
+			var got []string
+			for _, r := range imp.report.Righe {
+				if r.Esito != CSVNuovo {
+					got = append(got, fmt.Sprintf("%s:%d %s", r.File, r.Riga, r.Esito))
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.esiti, "\n") {
+				t.Errorf("esiti:\n%s\nattesi:\n%s", strings.Join(got, "\n"), strings.Join(tt.esiti, "\n"))
+			}
+
+			if len(imp.nuoviClienti) != tt.nuoviC || len(imp.nuoviVeicoli) != tt.nuoviV {
+				t.Errorf("nuovi clienti/veicoli = %d/%d, attesi %d/%d",
+					len(imp.nuoviClienti), len(imp.nuoviVeicoli), tt.nuoviC, tt.nuoviV)
+			}
+
+			for _, v := range imp.nuoviVeicoli {
+				atteso, ok := tt.collegati[v.veicolo.Targa]
+				if !ok {
+					t.Errorf("veicolo inatteso %s", v.veicolo.Targa)
+					continue
+				}
+				if v.cliente == nil || v.cliente.RagioneSociale != atteso {
+					t.Errorf("veicolo %s collegato a %+v, atteso %s", v.veicolo.Targa, v.cliente, atteso)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// schemaID è l'identificativo del documento che registra la versione dello schema
+const schemaID = 1
+
+// Migrazione è un aggiornamento dei dati da applicare una sola volta.
+// Le migrazioni devono essere idempotenti: un backup ripristinato può
+// riportare dati precedenti senza riportare la versione.
+type Migrazione struct {
+	Versione    int    `json:"versione"`
+	Descrizione string `json:"descrizione"`
+	applica     func(db *DB) (int, error)
+}
+
+// MigrazioneEseguita riporta l'esito di una migrazione applicata
+type MigrazioneEseguita struct {
+	Versione    int    `json:"versione"`
+	Descrizione string `json:"descrizione"`
+	Modificati  int    `json:"modificati"`
+}
+
+// schemaVersion è il documento salvato nella collezione "schema"
+type schemaVersion struct {
+	ID           int       `json:"id" bson:"id"`
+	Versione     int       `json:"versione" bson:"versione"`
+	AggiornatoIl time.Time `json:"aggiornato_il" bson:"aggiornato_il"`
+}
+
+// migrazioni elenca gli aggiornamenti in ordine di versione
+var migrazioni = []Migrazione{
+	{1, "Targhe dei veicoli in maiuscolo senza spazi", migraTarghe},
+	{2, "Totale commesse ricalcolato da manodopera e ricambi", migraTotaliCommesse},
+}
+
+// SchemaVersion restituisce la versione corrente dello schema (0 se mai migrato)
+func (db *DB) SchemaVersion() (int, error) {
+	var v schemaVersion
+	err := db.mongo.db.Collection("schema").FindOne(db.mongo.ctx, bson.M{"id": schemaID}).Decode(&v)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("errore lettura versione schema: %w", err)
+	}
+	return v.Versione, nil
+}
+
+// LatestSchemaVersion restituisce la versione raggiunta applicando tutte le migrazioni
+func LatestSchemaVersion() int {
+	if len(migrazioni) == 0 {
+		return 0
+	}
+	return migrazioni[len(migrazioni)-1].Versione
+}
+
+// PendingMigrations elenca le migrazioni non ancora applicate
+func (db *DB) PendingMigrations() ([]Migrazione, error) {
+	attuale, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migrazione
+	for _, m := range migrazioni {
+		if m.Versione > attuale {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applica in ordine le migrazioni mancanti, registrando la versione
+// dopo ciascuna; in caso di errore si ferma all'ultima riuscita
+func (db *DB) Migrate() ([]MigrazioneEseguita, error) {
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var eseguite []MigrazioneEseguita
+	for _, m := range pending {
+		n, err := m.applica(db)
+		if err != nil {
+			return eseguite, fmt.Errorf("migrazione %d (%s): %w", m.Versione, m.Descrizione, err)
+		}
+
+		_, err = db.mongo.db.Collection("schema").ReplaceOne(db.mongo.ctx,
+			bson.M{"id": schemaID},
+			schemaVersion{ID: schemaID, Versione: m.Versione, AggiornatoIl: time.Now()},
+			options.Replace().SetUpsert(true))
+		if err != nil {
+			return eseguite, fmt.Errorf("errore salvataggio versione schema: %w", err)
+		}
+
+		eseguite = append(eseguite, MigrazioneEseguita{m.Versione, m.Descrizione, n})
+	}
+
+	return eseguite, nil
+}
+
+// migraTarghe normalizza le targhe, che la ricerca confronta in maiuscolo
+func migraTarghe(db *DB) (int, error) {
+	veicoli, err := db.ListVeicoli()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := range veicoli {
+		v := &veicoli[i]
+		targa := strings.ToUpper(strings.ReplaceAll(v.Targa, " ", ""))
+		if targa == v.Targa {
+			continue
+		}
+		v.Targa = targa
+		if err := db.UpdateVeicolo(v); err != nil {
+			return n, fmt.Errorf("veicolo %d: %w", v.ID, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// migraTotaliCommesse corregge le commesse salvate con un totale incoerente
+func migraTotaliCommesse(db *DB) (int, error) {
+	commesse, err := db.ListCommesse()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := range commesse {
+		c := &commesse[i]
+		totale := c.Totale
+		c.CalculateTotal()
+		if c.Totale == totale {
+			continue
+		}
+		if err := db.UpdateCommessa(c); err != nil {
+			return n, fmt.Errorf("commessa %d: %w", c.ID, err)
+		}
+		n++
+	}
+	return n, nil
+}
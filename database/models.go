@@ -3,8 +3,11 @@ package database
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"strings"
 	"time"
+
+	"officina/utils"
 )
 
 // Cliente rappresenta un cliente dell'officina
@@ -132,6 +135,18 @@ func (c *Commessa) IsOpen() bool {
 	return c.Stato == StatoCommessaAperta
 }
 
+// Chiudi porta la commessa nello stato Chiusa alla data indicata
+func (c *Commessa) Chiudi(quando time.Time) {
+	c.Stato = StatoCommessaChiusa
+	c.DataChiusura = quando
+}
+
+// Riapri riporta la commessa nello stato Aperta
+func (c *Commessa) Riapri() {
+	c.Stato = StatoCommessaAperta
+	c.DataChiusura = time.Time{}
+}
+
 // Appuntamento rappresenta un appuntamento in agenda
 type Appuntamento struct {
 	ID        int       `json:"id"`
@@ -140,13 +155,26 @@ type Appuntamento struct {
 	Nota      string    `json:"nota"`
 }
 
-// Operatore rappresenta un operatore dell'officina
+// Operatore rappresenta un operatore dell'officina. PasswordHash contiene
+// l'hash bcrypt della password o del PIN di accesso e non viene mai
+// serializzato in JSON (API, export).
 type Operatore struct {
-	ID        int    `json:"id"`
-	Matricola string `json:"matricola"`
-	Nome      string `json:"nome"`
-	Cognome   string `json:"cognome"`
-	Ruolo     string `json:"ruolo"`
+	ID           int    `json:"id"`
+	Matricola    string `json:"matricola"`
+	Nome         string `json:"nome"`
+	Cognome      string `json:"cognome"`
+	Ruolo        string `json:"ruolo"`
+	PasswordHash string `json:"-"`
+}
+
+// NomeCompleto restituisce nome e cognome
+func (o *Operatore) NomeCompleto() string {
+	return strings.TrimSpace(o.Nome + " " + o.Cognome)
+}
+
+// HaCredenziale indica se l'operatore può accedere con password o PIN
+func (o *Operatore) HaCredenziale() bool {
+	return o.PasswordHash != ""
 }
 
 // Preventivo rappresenta un preventivo
@@ -160,13 +188,40 @@ type Preventivo struct {
 	Accettato   bool      `json:"accettato"`
 }
 
-// Fattura rappresenta una fattura emessa
+// Fattura rappresenta un documento emesso: fattura, fattura differita, nota
+// di credito o proforma secondo Tipo (vuoto per le fatture registrate prima
+// dei tipi). Imponibile, Imposta, Importo (totale documento) e Riepilogo
+// sono calcolati dalle righe con Calcola; le fatture registrate prima delle
+// righe hanno solo Importo. Numero e Progressivo sono assegnati da
+// CreateFattura nella sequenza del tipo, dell'anno e del sezionale (vedi
+// numerazione.go). Le note di credito indicano in Riferimento la fattura
+// che stornano; gli importi sono sempre positivi. Commesse elenca le
+// commesse fatturate dal documento (vedi fattura_commessa.go). Pagamento
+// determina le scadenze, gli incassi sono i movimenti di prima nota
+// assegnati alla fattura (vedi crediti.go).
 type Fattura struct {
-	ID        int       `json:"id"`
-	Numero    string    `json:"numero"`
-	Data      time.Time `json:"data"`
-	ClienteID int       `json:"cliente_id"`
-	Importo   float64   `json:"importo"`
+	ID                int            `json:"id"`
+	Tipo              string         `json:"tipo,omitempty"`
+	Numero            string         `json:"numero"`
+	Sezionale         string         `json:"sezionale,omitempty"`
+	Progressivo       int            `json:"progressivo,omitempty"`
+	Data              time.Time      `json:"data"`
+	ClienteID         int            `json:"cliente_id"`
+	RiferimentoID     int            `json:"riferimento_id,omitempty"`
+	RiferimentoNumero string         `json:"riferimento_numero,omitempty"`
+	RiferimentoData   time.Time      `json:"riferimento_data"`
+	Commesse          []int          `json:"commesse,omitempty"`
+	Pagamento         string         `json:"pagamento,omitempty"`         // condizione di pagamento (Pagamento*)
+	RegimeIVA         string         `json:"regime_iva,omitempty"`        // RegimeIVAScissione o natura N6.x dell'inversione contabile
+	RitenutaTipo      string         `json:"ritenuta_tipo,omitempty"`     // RT01, RT02; vuoto senza ritenuta d'acconto
+	RitenutaAliquota  float64        `json:"ritenuta_aliquota,omitempty"` // percentuale sull'imponibile soggetto
+	RitenutaCausale   string         `json:"ritenuta_causale,omitempty"`  // causale del pagamento (modello 770)
+	Righe             []RigaFattura  `json:"righe,omitempty"`
+	Riepilogo         []RiepilogoIVA `json:"riepilogo,omitempty"`
+	Imponibile        float64        `json:"imponibile"`
+	Imposta           float64        `json:"imposta"`
+	Importo           float64        `json:"importo"`
+	Ritenuta          float64        `json:"ritenuta,omitempty"` // importo della ritenuta d'acconto
 }
 
 // MovimentoPrimaNota rappresenta un movimento di prima nota (entrata/uscita)
@@ -181,12 +236,16 @@ type MovimentoPrimaNota struct {
 	FornitoreID   int       `json:"fornitore_id"`
 	NumeroFattura string    `json:"numero_fattura"`
 	DataFattura   time.Time `json:"data_fattura"`
+	FatturaID     int       `json:"fattura_id,omitempty"` // fattura emessa incassata dall'entrata
 }
 
 func (m *MovimentoPrimaNota) Validate() error {
 	if !IsValidTipoMovimento(m.Tipo) {
 		return fmt.Errorf("tipo deve essere '%s' o '%s'", TipoMovimentoEntrata, TipoMovimentoUscita)
 	}
+	if m.FatturaID != 0 && m.Tipo != TipoMovimentoEntrata {
+		return fmt.Errorf("solo le entrate si assegnano a una fattura emessa")
+	}
 	if m.Importo <= 0 {
 		return fmt.Errorf("importo deve essere maggiore di zero")
 	}
@@ -196,6 +255,179 @@ func (m *MovimentoPrimaNota) Validate() error {
 	return nil
 }
 
+// ProfiloAzienda contiene i dati dell'officina che emette fatture e preventivi.
+// Esiste un solo profilo per database.
+type ProfiloAzienda struct {
+	ID             int       `json:"id"`
+	RagioneSociale string    `json:"ragione_sociale"`
+	PartitaIVA     string    `json:"partita_iva"`
+	CodiceFiscale  string    `json:"codice_fiscale"`
+	REAUfficio     string    `json:"rea_ufficio"`
+	REANumero      string    `json:"rea_numero"`
+	Indirizzo      string    `json:"indirizzo"`
+	CAP            string    `json:"cap"`
+	Citta          string    `json:"citta"`
+	Provincia      string    `json:"provincia"`
+	Nazione        string    `json:"nazione"`
+	Telefono       string    `json:"telefono"`
+	Email          string    `json:"email"`
+	PEC            string    `json:"pec"`
+	IBAN           string    `json:"iban"`
+	Banca          string    `json:"banca"`
+	RegimeFiscale  string    `json:"regime_fiscale"`
+	LogoTesto      string    `json:"logo_testo"`
+	AliquotaIVA    float64   `json:"aliquota_iva"`
+	FormatoNumero  string    `json:"formato_numero"` // numerazione fatture, es. {anno}/{n:4}
+	AggiornatoIl   time.Time `json:"aggiornato_il"`
+}
+
+// NuovoProfiloAzienda restituisce un profilo vuoto con i valori predefiniti
+func NuovoProfiloAzienda() *ProfiloAzienda {
+	return &ProfiloAzienda{
+		ID:            profiloAziendaID,
+		Nazione:       "IT",
+		RegimeFiscale: RegimeOrdinario,
+		AliquotaIVA:   22,
+	}
+}
+
+func (p *ProfiloAzienda) Validate() error {
+	if strings.TrimSpace(p.RagioneSociale) == "" {
+		return fmt.Errorf("ragione sociale non può essere vuota")
+	}
+	if strings.TrimSpace(p.PartitaIVA) == "" {
+		return fmt.Errorf("partita IVA obbligatoria per emettere documenti")
+	}
+	if err := utils.ValidatePartitaIVA(p.PartitaIVA); err != nil {
+		return err
+	}
+	// Le società hanno un codice fiscale numerico, uguale o simile alla P.IVA
+	if len(p.CodiceFiscale) == 11 {
+		if err := utils.ValidatePartitaIVA(p.CodiceFiscale); err != nil {
+			return fmt.Errorf("codice fiscale numerico non valido: %w", err)
+		}
+	} else if err := utils.ValidateCodiceFiscale(p.CodiceFiscale); err != nil {
+		return err
+	}
+	if p.REANumero != "" && len(p.REAUfficio) != 2 {
+		return fmt.Errorf("ufficio REA deve essere la sigla della provincia (es. RM)")
+	}
+	if err := utils.ValidateCAP(p.CAP); err != nil {
+		return err
+	}
+	if err := utils.ValidateEmail(p.Email); err != nil {
+		return err
+	}
+	if err := utils.ValidateEmail(p.PEC); err != nil {
+		return fmt.Errorf("PEC non valida: %w", err)
+	}
+	if err := utils.ValidateIBAN(p.IBAN); err != nil {
+		return err
+	}
+	if !IsValidRegimeFiscale(p.RegimeFiscale) {
+		return fmt.Errorf("regime fiscale non valido: %s", p.RegimeFiscale)
+	}
+	if !IsValidAliquotaIVA(p.AliquotaIVA) {
+		return fmt.Errorf("aliquota IVA predefinita non valida (valide: %v)", AliquoteIVA)
+	}
+	return ValidaFormatoNumero(p.FormatoNumero)
+}
+
+// IVAPredefinita restituisce l'aliquota proposta per le nuove righe dei
+// documenti: quella del profilo, o la natura N2.2 per i regimi senza IVA
+func (p *ProfiloAzienda) IVAPredefinita() (aliquota float64, natura string) {
+	if p.RegimeFiscale == RegimeForfettario || p.RegimeFiscale == RegimeMinimi {
+		return 0, "N2.2"
+	}
+	return p.AliquotaIVA, ""
+}
+
+// Mancanti elenca i dati necessari sui documenti fiscali che non sono ancora compilati
+func (p *ProfiloAzienda) Mancanti() []string {
+	var mancanti []string
+	campi := []struct {
+		nome, valore string
+	}{
+		{"ragione sociale", p.RagioneSociale},
+		{"partita IVA", p.PartitaIVA},
+		{"indirizzo", p.Indirizzo},
+		{"CAP", p.CAP},
+		{"città", p.Citta},
+		{"provincia", p.Provincia},
+		{"regime fiscale", p.RegimeFiscale},
+	}
+	for _, c := range campi {
+		if strings.TrimSpace(c.valore) == "" {
+			mancanti = append(mancanti, c.nome)
+		}
+	}
+	return mancanti
+}
+
+// IndirizzoCompleto restituisce l'indirizzo su una riga (via, CAP città (PR))
+func (p *ProfiloAzienda) IndirizzoCompleto() string {
+	var parts []string
+	if p.Indirizzo != "" {
+		parts = append(parts, p.Indirizzo)
+	}
+	localita := strings.TrimSpace(p.CAP + " " + p.Citta)
+	if p.Provincia != "" {
+		localita += " (" + p.Provincia + ")"
+	}
+	if localita != "" {
+		parts = append(parts, localita)
+	}
+	return strings.Join(parts, " - ")
+}
+
+// Intestazione restituisce le righe dell'intestazione da stampare sui documenti
+func (p *ProfiloAzienda) Intestazione() []string {
+	nome := p.RagioneSociale
+	if p.LogoTesto != "" {
+		nome = p.LogoTesto
+	}
+
+	righe := []string{nome}
+	if p.LogoTesto != "" && p.LogoTesto != p.RagioneSociale {
+		righe = append(righe, p.RagioneSociale)
+	}
+	if ind := p.IndirizzoCompleto(); ind != "" {
+		righe = append(righe, ind)
+	}
+
+	fiscali := "P.IVA " + p.PartitaIVA
+	if p.CodiceFiscale != "" && p.CodiceFiscale != p.PartitaIVA {
+		fiscali += " - C.F. " + p.CodiceFiscale
+	}
+	if p.REANumero != "" {
+		fiscali += " - REA " + p.REAUfficio + "-" + p.REANumero
+	}
+	righe = append(righe, fiscali)
+
+	var contatti []string
+	if p.Telefono != "" {
+		contatti = append(contatti, "Tel. "+p.Telefono)
+	}
+	if p.Email != "" {
+		contatti = append(contatti, p.Email)
+	}
+	if p.PEC != "" {
+		contatti = append(contatti, "PEC "+p.PEC)
+	}
+	if len(contatti) > 0 {
+		righe = append(righe, strings.Join(contatti, " - "))
+	}
+
+	return righe
+}
+
+// ScorporoIVA divide un importo IVA inclusa in imponibile e imposta
+// all'aliquota predefinita del profilo, arrotondando al centesimo
+func (p *ProfiloAzienda) ScorporoIVA(totale float64) (imponibile, iva float64) {
+	imponibile = math.Round(totale/(1+p.AliquotaIVA/100)*100) / 100
+	return imponibile, math.Round((totale-imponibile)*100) / 100
+}
+
 // --- Serializzatori JSON ---
 func (c *Cliente) ToJSON() ([]byte, error) {
 	return json.Marshal(c)
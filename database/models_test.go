@@ -0,0 +1,55 @@
+package database
+
+import "testing"
+
+func TestProfiloAziendaValidate(t *testing.T) {
+	valido := func() *ProfiloAzienda {
+		p := NuovoProfiloAzienda()
+		p.RagioneSociale = "Officina Rossi S.r.l."
+		p.PartitaIVA = "12345678903"
+		p.CAP = "00100"
+		p.IBAN = "IT60X0542811101000000123456"
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(p *ProfiloAzienda)
+		wantErr bool
+	}{
+		{"profilo valido", func(p *ProfiloAzienda) {}, false},
+		{"senza ragione sociale", func(p *ProfiloAzienda) { p.RagioneSociale = "" }, true},
+		{"senza partita IVA", func(p *ProfiloAzienda) { p.PartitaIVA = "" }, true},
+		{"CF numerico uguale a P.IVA", func(p *ProfiloAzienda) { p.CodiceFiscale = "12345678903" }, false},
+		{"CF persona fisica", func(p *ProfiloAzienda) { p.CodiceFiscale = "RSSMRA80A01H501U" }, false},
+		{"IBAN errato", func(p *ProfiloAzienda) { p.IBAN = "IT60X0542811101000000123457" }, true},
+		{"REA senza ufficio", func(p *ProfiloAzienda) { p.REANumero = "123456" }, true},
+		{"regime sconosciuto", func(p *ProfiloAzienda) { p.RegimeFiscale = "RF03" }, true},
+		{"aliquota non prevista", func(p *ProfiloAzienda) { p.AliquotaIVA = 21 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valido()
+			tt.modify(p)
+			if err := p.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProfiloAziendaScorporoIVA(t *testing.T) {
+	p := NuovoProfiloAzienda()
+
+	imponibile, iva := p.ScorporoIVA(122)
+	if imponibile != 100 || iva != 22 {
+		t.Errorf("ScorporoIVA(122) = %v, %v; atteso 100, 22", imponibile, iva)
+	}
+
+	p.AliquotaIVA = 10
+	imponibile, iva = p.ScorporoIVA(100)
+	if imponibile != 90.91 || iva != 9.09 {
+		t.Errorf("ScorporoIVA(100) al 10%% = %v, %v; atteso 90.91, 9.09", imponibile, iva)
+	}
+}
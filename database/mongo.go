@@ -19,11 +19,15 @@ type MongoDB struct {
 }
 
 // NewMongoDB crea una nuova connessione MongoDB
-func NewMongoDB(uri, dbName string) (*MongoDB, error) {
+func NewMongoDB(uri, dbName string, timeout time.Duration) (*MongoDB, error) {
 	ctx := context.Background()
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
 
 	opts := options.Client().ApplyURI(uri)
-	opts.SetConnectTimeout(5 * time.Second)
+	opts.SetConnectTimeout(timeout)
+	opts.SetServerSelectionTimeout(timeout)
 
 	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
@@ -48,6 +52,34 @@ func NewMongoDB(uri, dbName string) (*MongoDB, error) {
 	}, nil
 }
 
+// TestConnection verifica che il server MongoDB indicato sia raggiungibile,
+// senza modificare la connessione in uso
+func TestConnection(uri, dbName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	opts := options.Client().ApplyURI(uri)
+	opts.SetConnectTimeout(timeout)
+	opts.SetServerSelectionTimeout(timeout)
+
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("errore connessione mongo: %w", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("errore ping mongo: %w", err)
+	}
+
+	// Il database viene creato alla prima scrittura: basta che il nome sia accettato
+	if _, err := client.Database(dbName).ListCollectionNames(ctx, bson.D{}); err != nil {
+		return fmt.Errorf("database %s non accessibile: %w", dbName, err)
+	}
+
+	return nil
+}
+
 func setupIndexes(ctx context.Context, db *mongo.Database) error {
 	// Indici per query comuni
 	indexes := map[string][]mongo.IndexModel{
@@ -77,6 +109,11 @@ func setupIndexes(ctx context.Context, db *mongo.Database) error {
 			{Keys: bson.D{{Key: "ragione_sociale", Value: 1}}},
 			{Keys: bson.D{{Key: "partita_iva", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
 		},
+		// Un solo contatore per chiave: due sessioni che emettono insieme il
+		// primo numero di una sequenza non possono crearne due
+		"contatori": {
+			{Keys: bson.D{{Key: "chiave", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
 	}
 
 	for collection, idxs := range indexes {
@@ -233,14 +270,20 @@ func (m *MongoDB) UpdateFornitore(f *Fornitore) error {
 }
 
 func (m *MongoDB) DeleteFornitore(id int) error {
-	// Cascade movimenti
+	// Cascade movimenti e carichi di magazzino. I campi senza tag bson sono
+	// salvati con il nome in minuscolo (fornitoreid)
 	return m.db.Client().UseSession(m.ctx, func(sessionContext mongo.SessionContext) error {
 		err := sessionContext.StartTransaction()
 		if err != nil {
 			return err
 		}
 
-		if _, err := m.db.Collection("movimenti_primanota").DeleteMany(sessionContext, bson.M{"fornitore_id": id}); err != nil {
+		if _, err := m.db.Collection("movimenti_primanota").DeleteMany(sessionContext, bson.M{"fornitoreid": id}); err != nil {
+			sessionContext.AbortTransaction(sessionContext)
+			return err
+		}
+
+		if _, err := m.db.Collection("carichi_magazzino").DeleteMany(sessionContext, bson.M{"fornitoreid": id}); err != nil {
 			sessionContext.AbortTransaction(sessionContext)
 			return err
 		}
@@ -369,9 +412,6 @@ func (m *MongoDB) GetCommessa(id int) (*Commessa, error) {
 
 func (m *MongoDB) UpdateCommessa(c *Commessa) error {
 	c.Totale = c.CostoManodopera + c.CostoRicambi
-	if c.Stato == "Chiusa" && c.DataChiusura.IsZero() {
-		c.DataChiusura = time.Now()
-	}
 
 	result := m.db.Collection("commesse").FindOneAndReplace(m.ctx, bson.M{"id": c.ID}, c)
 	if result.Err() != nil {
@@ -522,6 +562,14 @@ func (m *MongoDB) GetOperatore(id int) (*Operatore, error) {
 }
 
 func (m *MongoDB) UpdateOperatore(o *Operatore) error {
+	// La credenziale non arriva dai form né dall'API: si conserva quella
+	// salvata, che si modifica solo con ImpostaCredenziale
+	if o.PasswordHash == "" {
+		if prec, err := m.GetOperatore(o.ID); err == nil {
+			o.PasswordHash = prec.PasswordHash
+		}
+	}
+
 	result := m.db.Collection("operatori").FindOneAndReplace(m.ctx, bson.M{"id": o.ID}, o)
 	if result.Err() != nil {
 		return fmt.Errorf("operatore #%d non trovato", o.ID)
@@ -679,6 +727,42 @@ func (m *MongoDB) ListMovimentiPrimaNota(filters map[string]interface{}) ([]Movi
 	return list, cursor.All(m.ctx, &list)
 }
 
+// ==================== PROFILO AZIENDA ====================
+
+// profiloAziendaID è l'identificativo fisso dell'unico profilo
+const profiloAziendaID = 1
+
+// GetProfiloAzienda restituisce il profilo dell'officina; se non è ancora
+// stato compilato restituisce un profilo vuoto con i valori predefiniti
+func (m *MongoDB) GetProfiloAzienda() (*ProfiloAzienda, error) {
+	var p ProfiloAzienda
+	err := m.db.Collection("profilo_azienda").FindOne(m.ctx, bson.M{"id": profiloAziendaID}).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return NuovoProfiloAzienda(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura profilo azienda: %w", err)
+	}
+	return &p, nil
+}
+
+// SaveProfiloAzienda valida e salva il profilo dell'officina
+func (m *MongoDB) SaveProfiloAzienda(p *ProfiloAzienda) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	p.ID = profiloAziendaID
+	p.AggiornatoIl = time.Now()
+
+	_, err := m.db.Collection("profilo_azienda").ReplaceOne(m.ctx,
+		bson.M{"id": profiloAziendaID}, p, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("errore salvataggio profilo azienda: %w", err)
+	}
+	return nil
+}
+
 // ==================== AGGREGATE QUERIES ====================
 
 func (m *MongoDB) GetVeicoliByCliente(clienteID int) ([]Veicolo, error) {
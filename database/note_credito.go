@@ -0,0 +1,164 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"officina/utils"
+)
+
+// Note di credito: stornano in tutto o in parte una fattura o una fattura
+// differita dello stesso cliente e hanno una numerazione propria. La nota
+// ha il regime IVA e la ritenuta della fattura, e il netto a pagare delle
+// note di una fattura non supera quello della fattura, così che il credito
+// verso il cliente (Fattura.Credito) non diventi negativo; una fattura con
+// note collegate non si elimina.
+
+// Stornabile indica se il tipo di documento può essere stornato da una
+// nota di credito
+func Stornabile(tipo string) bool {
+	return tipo == "" || tipo == TipoDocumentoFattura || tipo == TipoDocumentoDifferita
+}
+
+// Stornato somma il netto a pagare delle note di credito che stornano la
+// fattura id, esclusa quella con id escludi (la nota in modifica)
+func Stornato(id int, note []Fattura, escludi int) float64 {
+	var totale float64
+	for _, n := range note {
+		if n.TipoDocumento() == TipoDocumentoNotaCredito && n.RiferimentoID == id && n.ID != escludi {
+			totale += n.NettoAPagare()
+		}
+	}
+	return Arrotonda(totale)
+}
+
+// NoteCredito restituisce le note di credito che stornano la fattura id
+func (db *DB) NoteCredito(id int) ([]Fattura, error) {
+	var list []Fattura
+	cursor, err := db.mongo.db.Collection("fatture").Find(db.mongo.ctx,
+		bson.M{"tipo": TipoDocumentoNotaCredito, "riferimentoid": id},
+		options.Find().SetSort(bson.D{{Key: "data", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(db.mongo.ctx)
+	return list, cursor.All(db.mongo.ctx, &list)
+}
+
+// BozzaNotaCredito prepara lo storno totale della fattura id: stesso
+// cliente, sezionale, regime IVA e ritenuta, stesse righe (o lo stesso
+// importo per le fatture senza righe) e data di oggi. Residuo è l'importo ancora da stornare: se
+// la fattura è già stornata in parte, le righe vanno ridotte prima di
+// salvare la nota con CreateFattura.
+func (db *DB) BozzaNotaCredito(id int) (nota *Fattura, residuo float64, err error) {
+	f, err := db.mongo.GetFattura(id)
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore lettura fattura: %w", err)
+	}
+	if !Stornabile(f.Tipo) {
+		return nil, 0, fmt.Errorf("%s %s: la nota di credito si emette solo su fatture", DescrizioneTipoDocumento(f.Tipo), f.Numero)
+	}
+	note, err := db.NoteCredito(id)
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore lettura note di credito: %w", err)
+	}
+	residuo = Arrotonda(f.NettoAPagare() - Stornato(id, note, 0))
+	if residuo <= 0 {
+		return nil, 0, fmt.Errorf("la fattura %s è già stornata per intero", f.Numero)
+	}
+
+	nota = &Fattura{
+		Tipo:              TipoDocumentoNotaCredito,
+		Sezionale:         f.Sezionale,
+		Data:              time.Now(),
+		ClienteID:         f.ClienteID,
+		RiferimentoID:     f.ID,
+		RiferimentoNumero: f.Numero,
+		RiferimentoData:   f.Data,
+		RegimeIVA:         f.RegimeIVA,
+		RitenutaTipo:      f.RitenutaTipo,
+		RitenutaAliquota:  f.RitenutaAliquota,
+		RitenutaCausale:   f.RitenutaCausale,
+		Righe:             append([]RigaFattura(nil), f.Righe...),
+	}
+	if len(f.Righe) == 0 {
+		nota.Importo = residuo
+	}
+	nota.Calcola()
+	return nota, residuo, nil
+}
+
+// controllaRiferimento completa la nota di credito con numero e data della
+// fattura stornata e verifica cliente, data e importo; per le fatture
+// verifica che l'importo non scenda sotto quello già stornato
+func (db *DB) controllaRiferimento(f *Fattura) error {
+	switch {
+	case f.TipoDocumento() == TipoDocumentoProforma:
+		return nil
+	case Stornabile(f.Tipo):
+		if f.ID == 0 {
+			return nil
+		}
+		note, err := db.NoteCredito(f.ID)
+		if err != nil {
+			return fmt.Errorf("errore lettura note di credito: %w", err)
+		}
+		if stornato := Stornato(f.ID, note, 0); f.NettoAPagare() < stornato {
+			return fmt.Errorf("il netto a pagare %s è inferiore a quanto già stornato dalle note di credito (%s)",
+				utils.FormatEuro(f.NettoAPagare()), utils.FormatEuro(stornato))
+		}
+		return nil
+	}
+
+	origine, err := db.mongo.GetFattura(f.RiferimentoID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("la fattura stornata (id %d) non esiste", f.RiferimentoID)
+	}
+	if err != nil {
+		return fmt.Errorf("errore lettura fattura stornata: %w", err)
+	}
+	if !Stornabile(origine.Tipo) {
+		return fmt.Errorf("%s %s: la nota di credito si emette solo su fatture", DescrizioneTipoDocumento(origine.Tipo), origine.Numero)
+	}
+	if origine.ClienteID != f.ClienteID {
+		return fmt.Errorf("la nota di credito deve essere intestata al cliente della fattura %s", origine.Numero)
+	}
+	if f.Data.Before(origine.Data) {
+		return fmt.Errorf("la nota di credito non può precedere la fattura %s del %s", origine.Numero, origine.Data.Format("02/01/2006"))
+	}
+	if f.RegimeIVA != origine.RegimeIVA || f.RitenutaTipo != origine.RitenutaTipo ||
+		f.RitenutaAliquota != origine.RitenutaAliquota || f.RitenutaCausale != origine.RitenutaCausale {
+		return fmt.Errorf("la nota di credito deve avere il regime IVA e la ritenuta della fattura %s", origine.Numero)
+	}
+	f.RiferimentoNumero = origine.Numero
+	f.RiferimentoData = origine.Data
+
+	note, err := db.NoteCredito(origine.ID)
+	if err != nil {
+		return fmt.Errorf("errore lettura note di credito: %w", err)
+	}
+	residuo := Arrotonda(origine.NettoAPagare() - Stornato(origine.ID, note, f.ID))
+	if f.NettoAPagare() > residuo {
+		return fmt.Errorf("la nota di credito (%s) supera quanto resta da stornare della fattura %s (%s)",
+			utils.FormatEuro(f.NettoAPagare()), origine.Numero, utils.FormatEuro(residuo))
+	}
+	return nil
+}
+
+// controllaEliminazione impedisce di eliminare una fattura stornata da note
+// di credito, che resterebbero senza riferimento
+func (db *DB) controllaEliminazione(id int) error {
+	note, err := db.NoteCredito(id)
+	if err != nil {
+		return fmt.Errorf("errore lettura note di credito: %w", err)
+	}
+	if len(note) > 0 {
+		return fmt.Errorf("la fattura è stornata dalla nota di credito %s: eliminare prima la nota", note[len(note)-1].Numero)
+	}
+	return nil
+}
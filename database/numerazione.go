@@ -0,0 +1,623 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Numerazione delle fatture: ogni anno e ogni sezionale hanno una sequenza
+// progressiva senza buchi né duplicati, condivisa da fatture e fatture
+// differite; note di credito e proforma hanno sequenze proprie, con numeri
+// preceduti da NC- e PF-. Il progressivo è assegnato da
+// CreateFattura nella stessa transazione che inserisce la fattura, con il
+// contatore della sequenza nella collezione contatori: due terminali che
+// emettono insieme vanno in conflitto sul contatore e il secondo riprova.
+//
+// Il formato del numero è nel profilo dell'officina (FormatoNumero) e
+// combina testo fisso e segnaposto:
+//
+//	{anno}  anno a quattro cifre        {aa}  anno a due cifre
+//	{n}     progressivo                 {n:4} progressivo su 4 cifre (0042)
+//	{sez}   sezionale
+//
+// "{anno}/{n:4}" produce 2026/0042, "{n}/{sez}" produce 42/A. Le proforma
+// non sono documenti fiscali: la data non segue l'ordine della numerazione
+// e si eliminano senza vincoli.
+
+// FormatoNumeroPredefinito è il formato usato se il profilo non ne indica uno
+const FormatoNumeroPredefinito = "{anno}/{n:4}"
+
+var segnapostoNumero = regexp.MustCompile(`\{([a-z]+)(?::(\d))?\}`)
+
+// parteFormato è un pezzo del formato: testo fisso o segnaposto
+type parteFormato struct {
+	testo     string
+	campo     string // anno, aa, n, sez; vuoto per il testo fisso
+	larghezza int
+}
+
+// leggiFormato scompone e valida un formato di numerazione
+func leggiFormato(formato string) ([]parteFormato, error) {
+	if strings.TrimSpace(formato) == "" {
+		formato = FormatoNumeroPredefinito
+	}
+
+	var parti []parteFormato
+	progressivi := 0
+	inizio := 0
+	for _, m := range segnapostoNumero.FindAllStringSubmatchIndex(formato, -1) {
+		if m[0] > inizio {
+			parti = append(parti, parteFormato{testo: formato[inizio:m[0]]})
+		}
+		p := parteFormato{campo: formato[m[2]:m[3]]}
+		if m[4] >= 0 {
+			p.larghezza, _ = strconv.Atoi(formato[m[4]:m[5]])
+		}
+		switch p.campo {
+		case "n":
+			progressivi++
+		case "anno", "aa", "sez":
+			if p.larghezza > 0 {
+				return nil, fmt.Errorf("formato numero: {%s} non ammette la larghezza", p.campo)
+			}
+		default:
+			return nil, fmt.Errorf("formato numero: segnaposto {%s} sconosciuto (validi: {anno}, {aa}, {n}, {n:4}, {sez})", p.campo)
+		}
+		parti = append(parti, p)
+		inizio = m[1]
+	}
+	if inizio < len(formato) {
+		parti = append(parti, parteFormato{testo: formato[inizio:]})
+	}
+
+	if progressivi != 1 {
+		return nil, fmt.Errorf("formato numero: il progressivo {n} deve comparire una volta")
+	}
+	for _, p := range parti {
+		if strings.ContainsAny(p.testo, "{}") {
+			return nil, fmt.Errorf("formato numero: parentesi graffe fuori da un segnaposto")
+		}
+	}
+	return parti, nil
+}
+
+// ValidaFormatoNumero controlla un formato di numerazione
+func ValidaFormatoNumero(formato string) error {
+	_, err := leggiFormato(formato)
+	return err
+}
+
+// sequenzaTipo restituisce la sequenza di numerazione di un tipo di
+// documento e il prefisso dei suoi numeri
+func sequenzaTipo(tipo string) (sequenza, prefisso string) {
+	switch tipo {
+	case TipoDocumentoNotaCredito:
+		return "note_credito", "NC-"
+	case TipoDocumentoProforma:
+		return "proforma", "PF-"
+	}
+	return "fatture", ""
+}
+
+// partiDocumento completa il formato per il tipo e il sezionale: aggiunge il
+// prefisso del tipo e "/{sez}" ai formati che non lo indicano, così che i
+// numeri di sequenze diverse non coincidano
+func partiDocumento(parti []parteFormato, tipo, sezionale string) []parteFormato {
+	var out []parteFormato
+	if _, prefisso := sequenzaTipo(tipo); prefisso != "" {
+		out = append(out, parteFormato{testo: prefisso})
+	}
+	out = append(out, parti...)
+	if sezionale == "" {
+		return out
+	}
+	for _, p := range parti {
+		if p.campo == "sez" {
+			return out
+		}
+	}
+	return append(out, parteFormato{testo: "/"}, parteFormato{campo: "sez"})
+}
+
+// FormattaNumero compone il numero di un documento del tipo indicato
+func FormattaNumero(formato, tipo string, anno, progressivo int, sezionale string) (string, error) {
+	parti, err := leggiFormato(formato)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, p := range partiDocumento(parti, tipo, sezionale) {
+		switch p.campo {
+		case "":
+			b.WriteString(p.testo)
+		case "anno":
+			fmt.Fprintf(&b, "%04d", anno)
+		case "aa":
+			fmt.Fprintf(&b, "%02d", anno%100)
+		case "n":
+			fmt.Fprintf(&b, "%0*d", p.larghezza, progressivo)
+		case "sez":
+			b.WriteString(sezionale)
+		}
+	}
+	return b.String(), nil
+}
+
+// progressivoDaNumero ricava il progressivo dal numero di una fattura
+// registrata prima della numerazione automatica; ok è false se il numero
+// non segue il formato o l'anno indicato non è quello della data
+func progressivoDaNumero(parti []parteFormato, numero, tipo string, anno int, sezionale string) (int, bool) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, p := range partiDocumento(parti, tipo, sezionale) {
+		switch p.campo {
+		case "":
+			expr.WriteString(regexp.QuoteMeta(p.testo))
+		case "anno":
+			expr.WriteString(regexp.QuoteMeta(fmt.Sprintf("%04d", anno)))
+		case "aa":
+			expr.WriteString(regexp.QuoteMeta(fmt.Sprintf("%02d", anno%100)))
+		case "n":
+			expr.WriteString(`(\d+)`)
+		case "sez":
+			expr.WriteString(regexp.QuoteMeta(sezionale))
+		}
+	}
+	expr.WriteString("$")
+
+	m := regexp.MustCompile(expr.String()).FindStringSubmatch(strings.TrimSpace(numero))
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	return n, err == nil && n > 0
+}
+
+// NormalizzaSezionale riporta il sezionale alla forma salvata
+func NormalizzaSezionale(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+// validaSezionale accetta solo lettere e cifre, al massimo 10: il
+// sezionale compare nel numero e nella chiave del contatore
+func validaSezionale(s string) error {
+	if len(s) > 10 {
+		return fmt.Errorf("sezionale troppo lungo (massimo 10 caratteri)")
+	}
+	for _, r := range s {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return fmt.Errorf("sezionale non valido %q: solo lettere e cifre", s)
+		}
+	}
+	return nil
+}
+
+// chiaveNumerazione è la chiave del contatore di una sequenza
+func chiaveNumerazione(tipo string, anno int, sezionale string) string {
+	sequenza, _ := sequenzaTipo(tipo)
+	chiave := fmt.Sprintf("%s.%d", sequenza, anno)
+	if sezionale != "" {
+		chiave += "." + sezionale
+	}
+	return chiave
+}
+
+// progressivoFattura restituisce il progressivo di una fattura della
+// sequenza, ricavandolo dal numero per quelle registrate a mano
+func progressivoFattura(parti []parteFormato, f *Fattura) (int, bool) {
+	if f.Progressivo > 0 {
+		return f.Progressivo, true
+	}
+	return progressivoDaNumero(parti, f.Numero, f.TipoDocumento(), f.Data.Year(), NormalizzaSezionale(f.Sezionale))
+}
+
+// assegnaNumero dà alla fattura il progressivo successivo della sua
+// sequenza (documenti dello stesso tipo, anno e sezionale) e ne compone il numero.
+// contatore è l'ultimo progressivo assegnato (0 se la sequenza è nuova).
+// La data non può precedere quella dell'ultima fattura della sequenza.
+func assegnaNumero(f *Fattura, sequenza []Fattura, contatore int, formato string) error {
+	parti, err := leggiFormato(formato)
+	if err != nil {
+		return err
+	}
+	f.Sezionale = NormalizzaSezionale(f.Sezionale)
+	anno := f.Data.Year()
+
+	ultimo := contatore
+	var ultima *Fattura
+	for i := range sequenza {
+		s := &sequenza[i]
+		if n, ok := progressivoFattura(parti, s); ok && n > ultimo {
+			ultimo = n
+		}
+		if ultima == nil || s.Data.After(ultima.Data) {
+			ultima = s
+		}
+	}
+	if ultima != nil && f.Data.Before(ultima.Data) && f.TipoDocumento() != TipoDocumentoProforma {
+		return fmt.Errorf("la data %s precede quella della fattura %s (%s): le fatture si numerano in ordine di data",
+			f.Data.Format("02/01/2006"), ultima.Numero, ultima.Data.Format("02/01/2006"))
+	}
+
+	f.Progressivo = ultimo + 1
+	f.Numero, err = FormattaNumero(formato, f.TipoDocumento(), anno, f.Progressivo, f.Sezionale)
+	return err
+}
+
+// controllaData verifica che la nuova data di una fattura numerata resti
+// nell'anno della sequenza e tra quelle delle fatture precedente e successiva
+func controllaData(f *Fattura, vecchia *Fattura, sequenza []Fattura, formato string) error {
+	if f.Data.Year() != vecchia.Data.Year() {
+		return fmt.Errorf("la fattura %s è numerata nel %d: non si può spostare in un altro anno", vecchia.Numero, vecchia.Data.Year())
+	}
+	parti, err := leggiFormato(formato)
+	if err != nil {
+		return err
+	}
+	for i := range sequenza {
+		s := &sequenza[i]
+		n, ok := progressivoFattura(parti, s)
+		if !ok || s.ID == f.ID {
+			continue
+		}
+		if n < f.Progressivo && f.Data.Before(s.Data) {
+			return fmt.Errorf("la data %s precede quella della fattura precedente %s (%s)",
+				f.Data.Format("02/01/2006"), s.Numero, s.Data.Format("02/01/2006"))
+		}
+		if n > f.Progressivo && f.Data.After(s.Data) {
+			return fmt.Errorf("la data %s segue quella della fattura successiva %s (%s)",
+				f.Data.Format("02/01/2006"), s.Numero, s.Data.Format("02/01/2006"))
+		}
+	}
+	return nil
+}
+
+// SequenzaNumerazione riassume i numeri di un anno e sezionale; Sequenza è
+// "fatture" (anche differite) o "note_credito"
+type SequenzaNumerazione struct {
+	Sequenza  string `json:"sequenza"`
+	Anno      int    `json:"anno"`
+	Sezionale string `json:"sezionale,omitempty"`
+	Fatture   int    `json:"fatture"`
+	Ultimo    int    `json:"ultimo"`
+	// Mancanti sono i progressivi tra 1 e l'ultimo senza fattura
+	Mancanti []int `json:"mancanti,omitempty"`
+	// Duplicati, FuoriOrdine e NonRiconosciuti descrivono le fatture con
+	// un problema, per numero
+	Duplicati       []string `json:"duplicati,omitempty"`
+	FuoriOrdine     []string `json:"fuori_ordine,omitempty"`
+	NonRiconosciuti []string `json:"non_riconosciuti,omitempty"`
+}
+
+// OK indica se la sequenza non ha problemi
+func (s *SequenzaNumerazione) OK() bool {
+	return len(s.Mancanti) == 0 && len(s.Duplicati) == 0 && len(s.FuoriOrdine) == 0 && len(s.NonRiconosciuti) == 0
+}
+
+// ReportNumerazione elenca le sequenze delle fatture con buchi, duplicati
+// e date fuori ordine
+type ReportNumerazione struct {
+	Formato  string                `json:"formato"`
+	Sequenze []SequenzaNumerazione `json:"sequenze"`
+}
+
+// HasErrors indica se qualche sequenza ha problemi
+func (r *ReportNumerazione) HasErrors() bool {
+	for i := range r.Sequenze {
+		if !r.Sequenze[i].OK() {
+			return true
+		}
+	}
+	return false
+}
+
+// ControllaNumerazione raggruppa i documenti per sequenza, anno e sezionale
+// e ne controlla i progressivi; con anno diverso da zero considera solo
+// quello. Le proforma non sono controllate.
+func ControllaNumerazione(fatture []Fattura, formato string, anno int) (*ReportNumerazione, error) {
+	parti, err := leggiFormato(formato)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(formato) == "" {
+		formato = FormatoNumeroPredefinito
+	}
+
+	type chiave struct {
+		sequenza  string
+		anno      int
+		sezionale string
+	}
+	type numerata struct {
+		n int
+		f *Fattura
+	}
+	gruppi := make(map[chiave][]numerata)
+	report := &ReportNumerazione{Formato: formato, Sequenze: []SequenzaNumerazione{}}
+	sequenze := make(map[chiave]*SequenzaNumerazione)
+
+	for i := range fatture {
+		f := &fatture[i]
+		if (anno != 0 && f.Data.Year() != anno) || f.TipoDocumento() == TipoDocumentoProforma {
+			continue
+		}
+		sequenza, _ := sequenzaTipo(f.TipoDocumento())
+		k := chiave{sequenza, f.Data.Year(), NormalizzaSezionale(f.Sezionale)}
+		if sequenze[k] == nil {
+			sequenze[k] = &SequenzaNumerazione{Sequenza: k.sequenza, Anno: k.anno, Sezionale: k.sezionale}
+		}
+		s := sequenze[k]
+		s.Fatture++
+
+		n, ok := progressivoFattura(parti, f)
+		if !ok {
+			numero := f.Numero
+			if numero == "" {
+				numero = fmt.Sprintf("#%d senza numero", f.ID)
+			}
+			s.NonRiconosciuti = append(s.NonRiconosciuti, numero)
+			continue
+		}
+		gruppi[k] = append(gruppi[k], numerata{n, f})
+	}
+
+	for k, s := range sequenze {
+		numeri := gruppi[k]
+		sort.SliceStable(numeri, func(i, j int) bool { return numeri[i].n < numeri[j].n })
+
+		visti := make(map[int]bool)
+		var precedente *numerata
+		for i := range numeri {
+			nf := &numeri[i]
+			if visti[nf.n] {
+				s.Duplicati = append(s.Duplicati, nf.f.Numero)
+				continue
+			}
+			visti[nf.n] = true
+			if nf.n > s.Ultimo {
+				s.Ultimo = nf.n
+			}
+			if precedente != nil && nf.f.Data.Before(precedente.f.Data) {
+				s.FuoriOrdine = append(s.FuoriOrdine, fmt.Sprintf("%s del %s precede %s del %s",
+					nf.f.Numero, nf.f.Data.Format("02/01/2006"), precedente.f.Numero, precedente.f.Data.Format("02/01/2006")))
+			}
+			precedente = nf
+		}
+		for n := 1; n < s.Ultimo; n++ {
+			if !visti[n] {
+				s.Mancanti = append(s.Mancanti, n)
+			}
+		}
+		report.Sequenze = append(report.Sequenze, *s)
+	}
+
+	sort.Slice(report.Sequenze, func(i, j int) bool {
+		a, b := report.Sequenze[i], report.Sequenze[j]
+		if a.Anno != b.Anno {
+			return a.Anno > b.Anno
+		}
+		if a.Sequenza != b.Sequenza {
+			return a.Sequenza < b.Sequenza
+		}
+		return a.Sezionale < b.Sezionale
+	})
+	return report, nil
+}
+
+// ReportNumerazione controlla la numerazione delle fatture registrate
+func (db *DB) ReportNumerazione(anno int) (*ReportNumerazione, error) {
+	fatture, err := db.ListFatture()
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura fatture: %w", err)
+	}
+	formato, err := db.formatoNumero()
+	if err != nil {
+		return nil, err
+	}
+	return ControllaNumerazione(fatture, formato, anno)
+}
+
+// formatoNumero legge dal profilo il formato della numerazione
+func (db *DB) formatoNumero() (string, error) {
+	p, err := db.GetProfiloAzienda()
+	if err != nil {
+		return "", fmt.Errorf("errore lettura profilo: %w", err)
+	}
+	if strings.TrimSpace(p.FormatoNumero) == "" {
+		return FormatoNumeroPredefinito, nil
+	}
+	return p.FormatoNumero, nil
+}
+
+// sequenzaFatture legge i documenti della sequenza del tipo, dello stesso
+// anno e sezionale
+func (db *DB) sequenzaFatture(ctx mongo.SessionContext, tipo string, anno int, sezionale string) ([]Fattura, error) {
+	filtro := bson.M{
+		"tipo": tipo,
+		"data": bson.M{
+			"$gte": time.Date(anno, 1, 1, 0, 0, 0, 0, time.Local),
+			"$lt":  time.Date(anno+1, 1, 1, 0, 0, 0, 0, time.Local),
+		},
+		"sezionale": sezionale,
+	}
+	if sezionale == "" {
+		// Le fatture registrate prima dei sezionali non hanno il campo
+		filtro["sezionale"] = bson.M{"$in": bson.A{"", nil}}
+	}
+	if sequenza, _ := sequenzaTipo(tipo); sequenza == "fatture" {
+		// Le fatture registrate prima dei tipi non hanno il campo
+		filtro["tipo"] = bson.M{"$in": bson.A{"", nil, TipoDocumentoFattura, TipoDocumentoDifferita}}
+	}
+	var list []Fattura
+	cursor, err := db.mongo.db.Collection("fatture").Find(ctx, filtro)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	return list, cursor.All(ctx, &list)
+}
+
+// numeraECrea assegna il numero e inserisce la fattura in un'unica
+// transazione, nella quale verifica anche che le commesse non siano già
+// fatturate; i conflitti con un'altra sessione che numera o fattura le
+// stesse commesse nello stesso momento sono ritentati, compreso il
+// contatore creato da entrambe e respinto dall'indice unico su chiave
+func (db *DB) numeraECrea(f *Fattura) error {
+	formato, err := db.formatoNumero()
+	if err != nil {
+		return err
+	}
+	f.Sezionale = NormalizzaSezionale(f.Sezionale)
+	chiave := chiaveNumerazione(f.TipoDocumento(), f.Data.Year(), f.Sezionale)
+
+	for tentativo := 1; ; tentativo++ {
+		err = db.mongo.db.Client().UseSession(db.mongo.ctx, func(sessionContext mongo.SessionContext) error {
+			if err := sessionContext.StartTransaction(); err != nil {
+				return err
+			}
+
+			sequenza, err := db.sequenzaFatture(sessionContext, f.TipoDocumento(), f.Data.Year(), f.Sezionale)
+			if err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return fmt.Errorf("errore lettura numerazione: %w", err)
+			}
+			var c Contatore
+			err = db.mongo.db.Collection("contatori").FindOne(sessionContext, bson.M{"chiave": chiave}).Decode(&c)
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				sessionContext.AbortTransaction(sessionContext)
+				return fmt.Errorf("errore lettura contatore %s: %w", chiave, err)
+			}
+			if err := assegnaNumero(f, sequenza, c.Valore, formato); err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return err
+			}
+
+			_, err = db.mongo.db.Collection("contatori").UpdateOne(sessionContext,
+				bson.M{"chiave": chiave},
+				bson.M{
+					"$set":         bson.M{"valore": f.Progressivo},
+					"$setOnInsert": bson.M{"id": idContatore(chiave)},
+				},
+				options.Update().SetUpsert(true))
+			if err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return err
+			}
+
+			if err := db.riservaCommesse(sessionContext, f); err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return err
+			}
+
+			f.ID = generaID()
+			if _, err := db.mongo.db.Collection("fatture").InsertOne(sessionContext, f); err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return err
+			}
+			return sessionContext.CommitTransaction(sessionContext)
+		})
+
+		if err == nil || tentativo == 5 || !conflittoNumerazione(err) {
+			return err
+		}
+		time.Sleep(time.Duration(tentativo) * 50 * time.Millisecond)
+	}
+}
+
+// conflittoNumerazione indica se la transazione di numerazione è fallita
+// per un'altra sessione che numerava nello stesso momento e va ritentata
+func conflittoNumerazione(err error) bool {
+	var le mongo.LabeledError
+	if errors.As(err, &le) && le.HasErrorLabel("TransientTransactionError") {
+		return true
+	}
+	return mongo.IsDuplicateKeyError(err)
+}
+
+// controllaModificaNumerata mantiene tipo, numero, progressivo, sezionale e
+// riferimento del documento salvato e verifica che la nuova data rispetti
+// l'ordine
+func (db *DB) controllaModificaNumerata(f *Fattura) error {
+	vecchia, err := db.mongo.GetFattura(f.ID)
+	if err != nil {
+		return err
+	}
+	f.Tipo = vecchia.Tipo
+	f.Numero = vecchia.Numero
+	f.Progressivo = vecchia.Progressivo
+	f.Sezionale = vecchia.Sezionale
+	f.RiferimentoID = vecchia.RiferimentoID
+	f.RiferimentoNumero = vecchia.RiferimentoNumero
+	f.RiferimentoData = vecchia.RiferimentoData
+	if f.Progressivo == 0 || f.TipoDocumento() == TipoDocumentoProforma {
+		return nil
+	}
+
+	formato, err := db.formatoNumero()
+	if err != nil {
+		return err
+	}
+	var sequenza []Fattura
+	err = db.mongo.db.Client().UseSession(db.mongo.ctx, func(sessionContext mongo.SessionContext) error {
+		var err error
+		sequenza, err = db.sequenzaFatture(sessionContext, vecchia.TipoDocumento(), vecchia.Data.Year(), vecchia.Sezionale)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("errore lettura numerazione: %w", err)
+	}
+	return controllaData(f, vecchia, sequenza, formato)
+}
+
+// eliminaNumerata elimina una fattura numerata solo se è l'ultima della
+// sequenza, riportando indietro il contatore: le altre lascerebbero un buco
+func (db *DB) eliminaNumerata(id int) error {
+	f, err := db.mongo.GetFattura(id)
+	if err != nil {
+		return err
+	}
+	if f.Progressivo == 0 || f.TipoDocumento() == TipoDocumentoProforma {
+		return db.mongo.DeleteFattura(id)
+	}
+	chiave := chiaveNumerazione(f.TipoDocumento(), f.Data.Year(), f.Sezionale)
+
+	return db.mongo.db.Client().UseSession(db.mongo.ctx, func(sessionContext mongo.SessionContext) error {
+		if err := sessionContext.StartTransaction(); err != nil {
+			return err
+		}
+
+		var c Contatore
+		if err := db.mongo.db.Collection("contatori").FindOne(sessionContext, bson.M{"chiave": chiave}).Decode(&c); err != nil {
+			sessionContext.AbortTransaction(sessionContext)
+			return fmt.Errorf("errore lettura contatore %s: %w", chiave, err)
+		}
+		if c.Valore != f.Progressivo {
+			sessionContext.AbortTransaction(sessionContext)
+			if f.TipoDocumento() == TipoDocumentoNotaCredito {
+				return fmt.Errorf("la nota di credito %s non è l'ultima del %d: eliminarla lascerebbe un buco nella numerazione", f.Numero, f.Data.Year())
+			}
+			return fmt.Errorf("la fattura %s non è l'ultima del %d: eliminarla lascerebbe un buco nella numerazione, emettere una nota di credito", f.Numero, f.Data.Year())
+		}
+
+		if _, err := db.mongo.db.Collection("contatori").UpdateOne(sessionContext,
+			bson.M{"chiave": chiave}, bson.M{"$inc": bson.M{"valore": -1}}); err != nil {
+			sessionContext.AbortTransaction(sessionContext)
+			return err
+		}
+		if _, err := db.mongo.db.Collection("fatture").DeleteOne(sessionContext, bson.M{"id": id}); err != nil {
+			sessionContext.AbortTransaction(sessionContext)
+			return err
+		}
+		return sessionContext.CommitTransaction(sessionContext)
+	})
+}
@@ -0,0 +1,306 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestFormattaNumero(t *testing.T) {
+	tests := []struct {
+		formato     string
+		tipo        string
+		progressivo int
+		sezionale   string
+		want        string
+		err         string
+	}{
+		{"", "", 42, "", "2026/0042", ""},
+		{"{anno}/{n:4}", TipoDocumentoDifferita, 12345, "", "2026/12345", ""},
+		{"{n}/{sez}", "", 42, "A", "42/A", ""},
+		{"FT{aa}-{n:3}", "", 7, "", "FT26-007", ""},
+		{"{anno}/{n:4}", "", 42, "B", "2026/0042/B", ""}, // sezionale aggiunto
+		{"{anno}/{n:4}", TipoDocumentoNotaCredito, 3, "", "NC-2026/0003", ""},
+		{"{n}/{sez}", TipoDocumentoProforma, 5, "A", "PF-5/A", ""},
+		{"{anno}", "", 1, "", "", "deve comparire una volta"},
+		{"{n}/{n}", "", 1, "", "", "deve comparire una volta"},
+		{"{num}", "", 1, "", "", "sconosciuto"},
+		{"{anno:2}/{n}", "", 1, "", "", "larghezza"},
+		{"{n}}", "", 1, "", "", "parentesi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.formato, func(t *testing.T) {
+			got, err := FormattaNumero(tt.formato, tt.tipo, 2026, tt.progressivo, tt.sezionale)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("FormattaNumero() errore = %v, atteso %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("FormattaNumero() = %q, %v; atteso %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssegnaNumero(t *testing.T) {
+	giorno := func(g int) time.Time { return time.Date(2026, 3, g, 0, 0, 0, 0, time.Local) }
+	sequenza := []Fattura{
+		{ID: 1, Numero: "2026/0001", Data: giorno(2)},                  // registrata a mano
+		{ID: 2, Numero: "2026/0007", Progressivo: 7, Data: giorno(10)}, // numerata
+		{ID: 3, Numero: "bozza", Data: giorno(1)},                      // fuori formato, ignorata
+	}
+
+	tests := []struct {
+		name      string
+		f         Fattura
+		contatore int
+		want      string
+		err       bool
+	}{
+		{"dopo l'ultima", Fattura{Data: giorno(10)}, 7, "2026/0008", false},
+		{"contatore avanti", Fattura{Data: giorno(12)}, 9, "2026/0010", false},
+		{"data precedente", Fattura{Data: giorno(9)}, 7, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := assegnaNumero(&tt.f, sequenza, tt.contatore, "")
+			if tt.err {
+				if err == nil {
+					t.Errorf("assegnaNumero() = %q, atteso errore", tt.f.Numero)
+				}
+				return
+			}
+			if err != nil || tt.f.Numero != tt.want {
+				t.Errorf("assegnaNumero() = %q, %v; atteso %q", tt.f.Numero, err, tt.want)
+			}
+		})
+	}
+
+	// Un sezionale nuovo parte da 1 ed è riportato nel numero
+	f := Fattura{Data: giorno(1), Sezionale: " a"}
+	if err := assegnaNumero(&f, nil, 0, "{n}/{sez}"); err != nil || f.Numero != "1/A" || f.Progressivo != 1 {
+		t.Errorf("sezionale = %q %d, %v", f.Numero, f.Progressivo, err)
+	}
+}
+
+func TestControllaData(t *testing.T) {
+	giorno := func(m, g int) time.Time { return time.Date(2026, time.Month(m), g, 0, 0, 0, 0, time.Local) }
+	sequenza := []Fattura{
+		{ID: 1, Numero: "2026/0001", Progressivo: 1, Data: giorno(3, 2)},
+		{ID: 2, Numero: "2026/0002", Progressivo: 2, Data: giorno(3, 10)},
+		{ID: 3, Numero: "2026/0003", Progressivo: 3, Data: giorno(3, 20)},
+	}
+	vecchia := sequenza[1]
+
+	tests := []struct {
+		name string
+		data time.Time
+		err  bool
+	}{
+		{"stessa data", giorno(3, 10), false},
+		{"tra le vicine", giorno(3, 15), false},
+		{"uguale alla successiva", giorno(3, 20), false},
+		{"prima della precedente", giorno(3, 1), true},
+		{"dopo la successiva", giorno(3, 21), true},
+		{"altro anno", time.Date(2027, 3, 10, 0, 0, 0, 0, time.Local), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := vecchia
+			f.Data = tt.data
+			if err := controllaData(&f, &vecchia, sequenza, ""); (err != nil) != tt.err {
+				t.Errorf("controllaData() errore = %v, atteso %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestControllaNumerazione(t *testing.T) {
+	giorno := func(a, g int) time.Time { return time.Date(a, 4, g, 0, 0, 0, 0, time.Local) }
+	fatture := []Fattura{
+		{ID: 1, Numero: "2026/0001", Progressivo: 1, Data: giorno(2026, 1)},
+		{ID: 2, Numero: "2026/0002", Data: giorno(2026, 5)},
+		{ID: 3, Numero: "2026/0002", Data: giorno(2026, 5)},
+		{ID: 4, Numero: "2026/0005", Progressivo: 5, Data: giorno(2026, 3)}, // data fuori ordine
+		{ID: 5, Numero: "FT-9", Data: giorno(2026, 6)},
+		{ID: 6, Numero: "2026/0001/B", Progressivo: 1, Sezionale: "B", Data: giorno(2026, 2)},
+		{ID: 7, Numero: "2025/0001", Progressivo: 1, Data: giorno(2025, 2)},
+		{ID: 8, Tipo: TipoDocumentoDifferita, Numero: "2026/0006", Progressivo: 6, Data: giorno(2026, 7)},
+		{ID: 9, Tipo: TipoDocumentoNotaCredito, Numero: "NC-2026/0001", Data: giorno(2026, 8), RiferimentoID: 1},
+		{ID: 10, Tipo: TipoDocumentoProforma, Numero: "PF-2026/0004", Progressivo: 4, Data: giorno(2026, 1)},
+	}
+
+	r, err := ControllaNumerazione(fatture, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.HasErrors() || len(r.Sequenze) != 4 {
+		t.Fatalf("report = %+v", r)
+	}
+
+	principale := r.Sequenze[0]
+	if principale.Anno != 2026 || principale.Sequenza != "fatture" || principale.Sezionale != "" || principale.Fatture != 6 || principale.Ultimo != 6 {
+		t.Errorf("sequenza 2026 = %+v", principale)
+	}
+	if !reflect.DeepEqual(principale.Mancanti, []int{3, 4}) ||
+		!reflect.DeepEqual(principale.Duplicati, []string{"2026/0002"}) ||
+		len(principale.FuoriOrdine) != 1 ||
+		!reflect.DeepEqual(principale.NonRiconosciuti, []string{"FT-9"}) {
+		t.Errorf("anomalie 2026 = %+v", principale)
+	}
+	if s := r.Sequenze[1]; s.Sezionale != "B" || !s.OK() {
+		t.Errorf("sezionale B = %+v", s)
+	}
+	if s := r.Sequenze[2]; s.Sequenza != "note_credito" || s.Fatture != 1 || s.Ultimo != 1 || !s.OK() {
+		t.Errorf("note di credito = %+v", s)
+	}
+	if s := r.Sequenze[3]; s.Anno != 2025 || !s.OK() {
+		t.Errorf("sequenza 2025 = %+v", s)
+	}
+
+	if r, _ := ControllaNumerazione(fatture, "", 2025); len(r.Sequenze) != 1 || r.HasErrors() {
+		t.Errorf("solo 2025 = %+v", r)
+	}
+}
+
+func TestConflittoNumerazione(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"transitorio", mongo.CommandError{Code: 112, Labels: []string{"TransientTransactionError"}}, true},
+		{"chiave duplicata", mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}, true},
+		{"chiave duplicata avvolta", fmt.Errorf("contatore: %w", mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}), true},
+		{"altro errore", errors.New("connessione chiusa"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := conflittoNumerazione(tt.err); got != tt.want {
+				t.Errorf("conflittoNumerazione() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// mongoDiTest apre un database vuoto su un MongoDB reale (replica set, per
+// le transazioni), eliminato a fine test, se configurato:
+//
+//	OFFICINA_TEST_MONGO_URI=mongodb://localhost:27017/?replicaSet=rs0 go test ./database
+func mongoDiTest(t *testing.T) *DB {
+	t.Helper()
+	uri := os.Getenv("OFFICINA_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("OFFICINA_TEST_MONGO_URI non impostato")
+	}
+
+	nome := fmt.Sprintf("officina_test_%d", time.Now().UnixNano())
+	db, err := InitMongoDB(uri, nome, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.mongo.db.Drop(db.mongo.ctx)
+		db.Close()
+	})
+	return db
+}
+
+// TestNumerazioneConcorrente emette insieme le prime fatture di una
+// sequenza nuova
+func TestNumerazioneConcorrente(t *testing.T) {
+	db := mongoDiTest(t)
+
+	const n = 8
+	data := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local)
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = db.CreateFattura(&Fattura{Data: data, Sezionale: "B", Importo: 100})
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("fattura %d: %v", i, err)
+		}
+	}
+
+	fatture, err := db.ListFatture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var progressivi []int
+	for _, f := range fatture {
+		progressivi = append(progressivi, f.Progressivo)
+	}
+	sort.Ints(progressivi)
+	want := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	if !reflect.DeepEqual(progressivi, want) {
+		t.Errorf("progressivi = %v, want %v", progressivi, want)
+	}
+}
+
+// TestFatturazioneCommessaConcorrente fattura insieme la stessa commessa in
+// sezionali diversi: una sola fattura va a buon fine
+func TestFatturazioneCommessaConcorrente(t *testing.T) {
+	db := mongoDiTest(t)
+
+	cliente := &Cliente{RagioneSociale: "Rossi"}
+	if err := db.CreateCliente(cliente); err != nil {
+		t.Fatal(err)
+	}
+	veicolo := &Veicolo{ClienteID: cliente.ID, Targa: "AB123CD", Marca: "Fiat", Anno: 2020}
+	if err := db.CreateVeicolo(veicolo); err != nil {
+		t.Fatal(err)
+	}
+	commessa := &Commessa{
+		VeicoloID:       veicolo.ID,
+		Stato:           StatoCommessaChiusa,
+		DataChiusura:    time.Now(),
+		CostoManodopera: 100,
+	}
+	if err := db.CreateCommessa(commessa); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 4
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		f, err := db.BozzaFatturaCommesse([]int{commessa.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Sezionale = string(rune('A' + i))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = db.CreateFattura(f)
+		}(i)
+	}
+	wg.Wait()
+
+	riuscite := 0
+	for _, err := range errs {
+		if err == nil {
+			riuscite++
+		}
+	}
+	if riuscite != 1 {
+		t.Errorf("fatture emesse = %d, want 1 (errori: %v)", riuscite, errs)
+	}
+}
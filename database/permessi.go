@@ -0,0 +1,157 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Permesso è un'operazione che un ruolo può eseguire su una risorsa
+type Permesso string
+
+// Permessi per risorsa. Crea, modifica, elimina ed esporta sono verificati
+// dal database (Autorizza); vedi è applicato solo dal menu, dalle schermate
+// e dall'API, perché le letture del database servono anche a controlli e
+// calcoli interni. Un dato nascosto a un ruolo non è quindi riservato: il
+// saldo di prima nota, per esempio, è la somma dei movimenti visibili.
+const (
+	PermessoVedi     Permesso = "vedi"
+	PermessoCrea     Permesso = "crea"
+	PermessoModifica Permesso = "modifica"
+	PermessoElimina  Permesso = "elimina"
+	PermessoEsporta  Permesso = "esporta"
+)
+
+// Risorse soggette a permessi: le collezioni, con gli stessi nomi del
+// registro attività, più le funzioni che non corrispondono a una collezione
+const (
+	RisorsaClienti      = "clienti"
+	RisorsaFornitori    = "fornitori"
+	RisorsaVeicoli      = "veicoli"
+	RisorsaCommesse     = "commesse"
+	RisorsaAppuntamenti = "appuntamenti"
+	RisorsaOperatori    = "operatori"
+	RisorsaPreventivi   = "preventivi"
+	RisorsaFatture      = "fatture"
+	RisorsaMovimenti    = "movimenti_primanota"
+	RisorsaSaldo        = "saldo_primanota" // totali e saldo della prima nota
+	RisorsaProfilo      = "profilo_azienda"
+	RisorsaBackup       = "backup"
+	RisorsaImpostazioni = "impostazioni"
+	RisorsaRegistro     = "registro_attivita"
+)
+
+// verbiPermesso descrive i permessi nei messaggi di errore
+var verbiPermesso = map[Permesso]string{
+	PermessoVedi:     "vedere",
+	PermessoCrea:     "creare",
+	PermessoModifica: "modificare",
+	PermessoElimina:  "eliminare",
+	PermessoEsporta:  "esportare",
+}
+
+// ErrPermessoNegato è restituito, eventualmente avvolto, quando il ruolo
+// dell'operatore corrente non consente l'operazione
+var ErrPermessoNegato = errors.New("operazione non consentita")
+
+var (
+	soloVedi  = []Permesso{PermessoVedi}
+	operativo = []Permesso{PermessoVedi, PermessoCrea, PermessoModifica}
+	completo  = []Permesso{PermessoVedi, PermessoCrea, PermessoModifica, PermessoElimina, PermessoEsporta}
+)
+
+// capacita associa a ogni risorsa i permessi di un ruolo; le risorse non
+// elencate non sono accessibili
+type capacita map[string][]Permesso
+
+// capacitaOperativo vale per meccanici, carrozzieri, elettrauto, gommisti
+// e per i ruoli non riconosciuti
+var capacitaOperativo = capacita{
+	RisorsaClienti:      soloVedi,
+	RisorsaFornitori:    soloVedi,
+	RisorsaVeicoli:      operativo,
+	RisorsaCommesse:     operativo,
+	RisorsaAppuntamenti: operativo,
+	RisorsaOperatori:    soloVedi,
+	RisorsaPreventivi:   operativo,
+	RisorsaFatture:      soloVedi,
+	RisorsaMovimenti:    {PermessoVedi, PermessoCrea},
+	RisorsaSaldo:        soloVedi,
+	RisorsaProfilo:      soloVedi,
+}
+
+// capacitaRuoli definisce i permessi dei ruoli comuni. Il Responsabile
+// Officina non compare: può tutto.
+var capacitaRuoli = map[string]capacita{
+	RuoloMeccanico:   capacitaOperativo,
+	RuoloCarrozziere: capacitaOperativo,
+	RuoloElettrauto:  capacitaOperativo,
+	RuoloGommista:    capacitaOperativo,
+	RuoloAccettazione: {
+		RisorsaClienti:      completo,
+		RisorsaFornitori:    operativo,
+		RisorsaVeicoli:      completo,
+		RisorsaCommesse:     completo,
+		RisorsaAppuntamenti: completo,
+		RisorsaOperatori:    soloVedi,
+		RisorsaPreventivi:   completo,
+		RisorsaFatture:      completo,
+		RisorsaMovimenti:    {PermessoVedi, PermessoCrea, PermessoModifica, PermessoEsporta},
+		RisorsaSaldo:        soloVedi,
+		RisorsaProfilo:      soloVedi,
+	},
+	RuoloApprendista: {
+		RisorsaClienti:      soloVedi,
+		RisorsaFornitori:    soloVedi,
+		RisorsaVeicoli:      soloVedi,
+		RisorsaCommesse:     {PermessoVedi, PermessoModifica},
+		RisorsaAppuntamenti: soloVedi,
+		RisorsaOperatori:    soloVedi,
+		RisorsaPreventivi:   soloVedi,
+		RisorsaFatture:      soloVedi,
+		RisorsaMovimenti:    {PermessoVedi, PermessoCrea},
+	},
+}
+
+// Consentito indica se il ruolo può eseguire l'operazione sulla risorsa.
+// Il ruolo è confrontato senza distinguere maiuscole; un ruolo non
+// riconosciuto ha i permessi di un meccanico.
+func Consentito(ruolo, risorsa string, p Permesso) bool {
+	ruolo = strings.TrimSpace(ruolo)
+	if strings.EqualFold(ruolo, RuoloResponsabile) {
+		return true
+	}
+
+	c := capacitaOperativo
+	for nome, cr := range capacitaRuoli {
+		if strings.EqualFold(nome, ruolo) {
+			c = cr
+			break
+		}
+	}
+
+	for _, consentito := range c[risorsa] {
+		if consentito == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Autorizza verifica che l'operatore corrente della sessione possa eseguire
+// l'operazione. Senza operatore (accesso non configurato, comandi da riga
+// di comando) tutto è consentito.
+func (db *DB) Autorizza(risorsa string, p Permesso) error {
+	o := db.OperatoreCorrente()
+	if o == nil || Consentito(o.Ruolo, risorsa, p) {
+		return nil
+	}
+	return fmt.Errorf("%w: il ruolo %s non può %s %s",
+		ErrPermessoNegato, o.Ruolo, verbiPermesso[p], strings.ReplaceAll(risorsa, "_", " "))
+}
+
+// Consentito indica se l'operatore corrente della sessione può eseguire
+// l'operazione; le schermate lo usano per nascondere voci e comandi
+func (db *DB) Consentito(risorsa string, p Permesso) bool {
+	return db.Autorizza(risorsa, p) == nil
+}
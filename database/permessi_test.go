@@ -0,0 +1,55 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConsentito(t *testing.T) {
+	tests := []struct {
+		name     string
+		ruolo    string
+		risorsa  string
+		permesso Permesso
+		want     bool
+	}{
+		{"responsabile elimina fatture", RuoloResponsabile, RisorsaFatture, PermessoElimina, true},
+		{"responsabile backup", RuoloResponsabile, RisorsaBackup, PermessoVedi, true},
+		{"apprendista saldo", RuoloApprendista, RisorsaSaldo, PermessoVedi, false},
+		{"apprendista elimina fatture", RuoloApprendista, RisorsaFatture, PermessoElimina, false},
+		{"apprendista vede fatture", RuoloApprendista, RisorsaFatture, PermessoVedi, true},
+		{"apprendista registra movimenti", RuoloApprendista, RisorsaMovimenti, PermessoCrea, true},
+		{"accettazione modifica operatori", RuoloAccettazione, RisorsaOperatori, PermessoModifica, false},
+		{"accettazione vede operatori", RuoloAccettazione, RisorsaOperatori, PermessoVedi, true},
+		{"accettazione elimina fatture", RuoloAccettazione, RisorsaFatture, PermessoElimina, true},
+		{"meccanico impostazioni", RuoloMeccanico, RisorsaImpostazioni, PermessoVedi, false},
+		{"meccanico modifica commesse", RuoloMeccanico, RisorsaCommesse, PermessoModifica, true},
+		{"ruolo minuscolo", "  apprendista ", RisorsaSaldo, PermessoVedi, false},
+		{"ruolo sconosciuto come meccanico", "Verniciatore", RisorsaCommesse, PermessoCrea, true},
+		{"ruolo sconosciuto senza backup", "Verniciatore", RisorsaBackup, PermessoVedi, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Consentito(tt.ruolo, tt.risorsa, tt.permesso); got != tt.want {
+				t.Errorf("Consentito(%q, %q, %q) = %v, want %v", tt.ruolo, tt.risorsa, tt.permesso, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutorizza(t *testing.T) {
+	db := (&DB{}).NuovaSessione(OrigineTUI)
+	if err := db.Autorizza(RisorsaFatture, PermessoElimina); err != nil {
+		t.Fatalf("senza operatore: %v", err)
+	}
+
+	db.ImpostaOperatore(&Operatore{Matricola: "APP01", Ruolo: RuoloApprendista})
+	err := db.Autorizza(RisorsaFatture, PermessoElimina)
+	if !errors.Is(err, ErrPermessoNegato) {
+		t.Fatalf("errore = %v, atteso ErrPermessoNegato", err)
+	}
+	if err.Error() != "operazione non consentita: il ruolo Apprendista non può eliminare fatture" {
+		t.Errorf("messaggio = %q", err.Error())
+	}
+}
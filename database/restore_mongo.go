@@ -0,0 +1,543 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Stati di un record nel confronto tra backup e database
+const (
+	DiffMancante   = "mancante"   // presente nel backup, assente nel database (es. eliminato per errore)
+	DiffNuovo      = "nuovo"      // presente solo nel database (creato dopo il backup)
+	DiffModificato = "modificato" // presente in entrambi con contenuto diverso
+)
+
+// RecordRef identifica un singolo record di una collezione
+type RecordRef struct {
+	Collection string `json:"collection"`
+	ID         int    `json:"id"`
+}
+
+// RecordDiff descrive la differenza di un record tra backup e database
+type RecordDiff struct {
+	ID     int      `json:"id"`
+	Stato  string   `json:"stato"`
+	Campi  []string `json:"campi,omitempty"`
+	Backup bson.D   `json:"-"`
+	Live   bson.D   `json:"-"`
+}
+
+// CollectionDiff raccoglie le differenze di una collezione
+type CollectionDiff struct {
+	Collection string       `json:"collection"`
+	Records    []RecordDiff `json:"records"`
+	Invariati  int          `json:"invariati"`
+}
+
+// Count conta i record della collezione nello stato indicato
+func (cd *CollectionDiff) Count(stato string) int {
+	n := 0
+	for _, r := range cd.Records {
+		if r.Stato == stato {
+			n++
+		}
+	}
+	return n
+}
+
+// HasChanges indica se la collezione differisce dal backup
+func (cd *CollectionDiff) HasChanges() bool {
+	return len(cd.Records) > 0
+}
+
+// BackupDiff è il confronto completo tra un backup e il database corrente
+type BackupDiff struct {
+	BackupDir   string           `json:"backup_dir"`
+	Collections []CollectionDiff `json:"collections"`
+}
+
+// Collection restituisce il diff di una collezione (nil se assente)
+func (bd *BackupDiff) Collection(name string) *CollectionDiff {
+	for i := range bd.Collections {
+		if bd.Collections[i].Collection == name {
+			return &bd.Collections[i]
+		}
+	}
+	return nil
+}
+
+// ParseRecordRefs legge un elenco di record nella forma
+// "collezione:id,collezione:id", come lo accetta backup restore --record
+func ParseRecordRefs(s string) ([]RecordRef, error) {
+	var refs []RecordRef
+	for _, parte := range strings.Split(s, ",") {
+		parte = strings.TrimSpace(parte)
+		if parte == "" {
+			continue
+		}
+		collection, idStr, ok := strings.Cut(parte, ":")
+		id, err := strconv.Atoi(strings.TrimSpace(idStr))
+		if !ok || strings.TrimSpace(collection) == "" || err != nil {
+			return nil, fmt.Errorf("record non valido %q: atteso collezione:id", parte)
+		}
+		refs = append(refs, RecordRef{Collection: strings.TrimSpace(collection), ID: id})
+	}
+	return refs, nil
+}
+
+// RestoreOptions seleziona cosa ripristinare e come
+type RestoreOptions struct {
+	// Collections ripristina interamente (in modalità merge) le collezioni indicate
+	Collections []string
+	// Records ripristina solo i singoli record indicati
+	Records []RecordRef
+	// SovrascriviModificati sostituisce anche i record modificati dopo il backup.
+	// Per default vengono reinseriti solo i record mancanti, senza toccare i dati più recenti.
+	SovrascriviModificati bool
+}
+
+// RestoreReport riepiloga l'esito di un ripristino selettivo
+type RestoreReport struct {
+	Inseriti     map[string]int `json:"inseriti"`
+	Sovrascritti map[string]int `json:"sovrascritti"`
+	Saltati      map[string]int `json:"saltati"`
+}
+
+// Totale restituisce il numero di record scritti nel database
+func (r *RestoreReport) Totale() int {
+	n := 0
+	for _, v := range r.Inseriti {
+		n += v
+	}
+	for _, v := range r.Sovrascritti {
+		n += v
+	}
+	return n
+}
+
+// TotaleSaltati restituisce il numero di record modificati dopo il backup e
+// lasciati invariati
+func (r *RestoreReport) TotaleSaltati() int {
+	n := 0
+	for _, v := range r.Saltati {
+		n += v
+	}
+	return n
+}
+
+// DiffBackup confronta un backup con il database corrente, collezione per collezione
+// e record per record. I record sono associati tramite il campo id.
+func (bm *BackupManagerMongo) DiffBackup(backupDir string) (*BackupDiff, error) {
+	metadata, err := readBackupMetadata(backupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &BackupDiff{BackupDir: backupDir}
+	for _, collection := range metadata.Collections {
+		backupDocs, err := loadBackupCollection(backupDir, collection)
+		if err != nil {
+			return nil, err
+		}
+
+		liveDocs, err := bm.loadLiveCollection(collection)
+		if err != nil {
+			return nil, err
+		}
+
+		cd := diffDocumenti(backupDocs, liveDocs)
+		cd.Collection = collection
+		diff.Collections = append(diff.Collections, cd)
+	}
+
+	return diff, nil
+}
+
+// RestoreSelective ripristina solo le collezioni o i record selezionati,
+// unendoli ai dati correnti: i record creati dopo il backup non vengono mai
+// eliminati e quelli modificati vengono sovrascritti solo se richiesto.
+func (bm *BackupManagerMongo) RestoreSelective(backupDir string, opts RestoreOptions) (*RestoreReport, error) {
+	if err := bm.db.Autorizza(RisorsaBackup, PermessoModifica); err != nil {
+		return nil, err
+	}
+
+	metadata, err := readBackupMetadata(backupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	inBackup := make(map[string]bool)
+	for _, c := range metadata.Collections {
+		inBackup[c] = true
+	}
+
+	// Raggruppa la selezione per collezione: nil = collezione intera
+	selezione := make(map[string]map[int]bool)
+	for _, c := range opts.Collections {
+		if !inBackup[c] {
+			return nil, fmt.Errorf("collezione %s non presente nel backup", c)
+		}
+		selezione[c] = nil
+	}
+	for _, ref := range opts.Records {
+		if !inBackup[ref.Collection] {
+			return nil, fmt.Errorf("collezione %s non presente nel backup", ref.Collection)
+		}
+		ids, ok := selezione[ref.Collection]
+		if ok && ids == nil {
+			continue // collezione già selezionata per intero
+		}
+		if ids == nil {
+			ids = make(map[int]bool)
+			selezione[ref.Collection] = ids
+		}
+		ids[ref.ID] = true
+	}
+
+	report := &RestoreReport{
+		Inseriti:     make(map[string]int),
+		Sovrascritti: make(map[string]int),
+		Saltati:      make(map[string]int),
+	}
+
+	// Calcola tutte le scritture prima di toccare il database
+	type scrittura struct {
+		collection string
+		id         int
+		doc        bson.D
+		replace    bool
+	}
+	var scritture []scrittura
+
+	collections := make([]string, 0, len(selezione))
+	for c := range selezione {
+		collections = append(collections, c)
+	}
+	sort.Strings(collections)
+
+	for _, collection := range collections {
+		ids := selezione[collection]
+
+		backupDocs, err := loadBackupCollection(backupDir, collection)
+		if err != nil {
+			return nil, err
+		}
+
+		liveDocs, err := bm.loadLiveCollection(collection)
+		if err != nil {
+			return nil, err
+		}
+
+		cd := diffDocumenti(backupDocs, liveDocs)
+		for _, r := range cd.Records {
+			if ids != nil && !ids[r.ID] {
+				continue
+			}
+
+			switch r.Stato {
+			case DiffMancante:
+				scritture = append(scritture, scrittura{collection, r.ID, r.Backup, false})
+				report.Inseriti[collection]++
+			case DiffModificato:
+				if opts.SovrascriviModificati {
+					scritture = append(scritture, scrittura{collection, r.ID, r.Backup, true})
+					report.Sovrascritti[collection]++
+				} else {
+					report.Saltati[collection]++
+				}
+			}
+		}
+	}
+
+	if len(scritture) == 0 {
+		return report, nil
+	}
+
+	ctx := context.Background()
+	err = bm.db.mongo.db.Client().UseSession(ctx, func(sessionContext mongo.SessionContext) error {
+		if err := sessionContext.StartTransaction(); err != nil {
+			return err
+		}
+
+		for _, s := range scritture {
+			coll := bm.db.mongo.db.Collection(s.collection)
+			var err error
+			if s.replace {
+				_, err = coll.ReplaceOne(sessionContext, bson.M{"id": s.id}, senzaObjectID(s.doc))
+			} else {
+				_, err = coll.InsertOne(sessionContext, s.doc)
+			}
+			if err != nil {
+				sessionContext.AbortTransaction(sessionContext)
+				return fmt.Errorf("errore ripristino %s #%d: %w", s.collection, s.id, err)
+			}
+		}
+
+		return sessionContext.CommitTransaction(sessionContext)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// RestoreCliente ripristina un singolo cliente dal backup insieme ai suoi
+// veicoli, alle commesse, agli appuntamenti e ai movimenti collegati.
+func (bm *BackupManagerMongo) RestoreCliente(backupDir string, clienteID int, sovrascrivi bool) (*RestoreReport, error) {
+	refs, err := bm.RecordCollegatiCliente(backupDir, clienteID)
+	if err != nil {
+		return nil, err
+	}
+
+	return bm.RestoreSelective(backupDir, RestoreOptions{
+		Records:               refs,
+		SovrascriviModificati: sovrascrivi,
+	})
+}
+
+// RecordCollegatiCliente elenca, leggendo il backup, il cliente indicato e
+// tutti i record che ne dipendono (veicoli, commesse, appuntamenti, movimenti).
+func (bm *BackupManagerMongo) RecordCollegatiCliente(backupDir string, clienteID int) ([]RecordRef, error) {
+	var clienti []Cliente
+	if err := loadBackupTyped(backupDir, "clienti", &clienti); err != nil {
+		return nil, err
+	}
+
+	trovato := false
+	for _, c := range clienti {
+		if c.ID == clienteID {
+			trovato = true
+			break
+		}
+	}
+	if !trovato {
+		return nil, fmt.Errorf("cliente #%d non presente nel backup", clienteID)
+	}
+
+	refs := []RecordRef{{Collection: "clienti", ID: clienteID}}
+
+	var veicoli []Veicolo
+	if err := loadBackupTyped(backupDir, "veicoli", &veicoli); err != nil {
+		return nil, err
+	}
+	veicoliIDs := make(map[int]bool)
+	for _, v := range veicoli {
+		if v.ClienteID == clienteID {
+			veicoliIDs[v.ID] = true
+			refs = append(refs, RecordRef{Collection: "veicoli", ID: v.ID})
+		}
+	}
+
+	var commesse []Commessa
+	if err := loadBackupTyped(backupDir, "commesse", &commesse); err != nil {
+		return nil, err
+	}
+	commesseIDs := make(map[int]bool)
+	for _, c := range commesse {
+		if veicoliIDs[c.VeicoloID] {
+			commesseIDs[c.ID] = true
+			refs = append(refs, RecordRef{Collection: "commesse", ID: c.ID})
+		}
+	}
+
+	var appuntamenti []Appuntamento
+	if err := loadBackupTyped(backupDir, "appuntamenti", &appuntamenti); err != nil {
+		return nil, err
+	}
+	for _, a := range appuntamenti {
+		if veicoliIDs[a.VeicoloID] {
+			refs = append(refs, RecordRef{Collection: "appuntamenti", ID: a.ID})
+		}
+	}
+
+	var movimenti []MovimentoPrimaNota
+	if err := loadBackupTyped(backupDir, "movimenti_primanota", &movimenti); err != nil {
+		return nil, err
+	}
+	for _, mov := range movimenti {
+		if commesseIDs[mov.CommessaID] {
+			refs = append(refs, RecordRef{Collection: "movimenti_primanota", ID: mov.ID})
+		}
+	}
+
+	return refs, nil
+}
+
+// loadLiveCollection legge tutti i documenti correnti di una collezione
+func (bm *BackupManagerMongo) loadLiveCollection(collection string) ([]bson.D, error) {
+	ctx := context.Background()
+	cursor, err := bm.db.mongo.db.Collection(collection).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura collection %s: %w", collection, err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []bson.D
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("errore decodifica collection %s: %w", collection, err)
+	}
+	return docs, nil
+}
+
+// loadBackupTyped decodifica una collezione del backup nei modelli tipizzati.
+// Le collezioni assenti dal backup producono una lista vuota.
+func loadBackupTyped(backupDir, collection string, out interface{}) error {
+	metadata, err := readBackupMetadata(backupDir)
+	if err != nil {
+		return err
+	}
+
+	presente := false
+	for _, c := range metadata.Collections {
+		if c == collection {
+			presente = true
+			break
+		}
+	}
+	if !presente {
+		return nil
+	}
+
+	docs, err := loadBackupCollection(backupDir, collection)
+	if err != nil {
+		return err
+	}
+
+	slice := reflect.ValueOf(out).Elem()
+	for _, doc := range docs {
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("errore conversione %s: %w", collection, err)
+		}
+		elem := reflect.New(slice.Type().Elem())
+		if err := bson.Unmarshal(data, elem.Interface()); err != nil {
+			return fmt.Errorf("errore decodifica %s: %w", collection, err)
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	return nil
+}
+
+// diffDocumenti confronta due insiemi di documenti associandoli per id.
+// Il campo _id viene ignorato perché non è significativo per l'applicazione.
+func diffDocumenti(backup, live []bson.D) CollectionDiff {
+	var cd CollectionDiff
+
+	liveByID := make(map[int]bson.D, len(live))
+	for _, doc := range live {
+		if id, ok := documentID(doc); ok {
+			liveByID[id] = doc
+		}
+	}
+
+	visti := make(map[int]bool, len(backup))
+	for _, doc := range backup {
+		id, ok := documentID(doc)
+		if !ok {
+			continue
+		}
+		visti[id] = true
+
+		liveDoc, esiste := liveByID[id]
+		if !esiste {
+			cd.Records = append(cd.Records, RecordDiff{ID: id, Stato: DiffMancante, Backup: doc})
+			continue
+		}
+
+		if campi := campiDiversi(doc, liveDoc); len(campi) > 0 {
+			cd.Records = append(cd.Records, RecordDiff{ID: id, Stato: DiffModificato, Campi: campi, Backup: doc, Live: liveDoc})
+		} else {
+			cd.Invariati++
+		}
+	}
+
+	for _, doc := range live {
+		id, ok := documentID(doc)
+		if ok && !visti[id] {
+			cd.Records = append(cd.Records, RecordDiff{ID: id, Stato: DiffNuovo, Live: doc})
+		}
+	}
+
+	sort.SliceStable(cd.Records, func(i, j int) bool {
+		return cd.Records[i].ID < cd.Records[j].ID
+	})
+
+	return cd
+}
+
+// campiDiversi restituisce i nomi dei campi con valori diversi tra i due documenti
+func campiDiversi(a, b bson.D) []string {
+	am := documentMap(a)
+	bm := documentMap(b)
+
+	var campi []string
+	for k, av := range am {
+		if k == "_id" {
+			continue
+		}
+		if bv, ok := bm[k]; !ok || !reflect.DeepEqual(av, bv) {
+			campi = append(campi, k)
+		}
+	}
+	for k := range bm {
+		if k == "_id" {
+			continue
+		}
+		if _, ok := am[k]; !ok {
+			campi = append(campi, k)
+		}
+	}
+
+	sort.Strings(campi)
+	return campi
+}
+
+// documentMap indicizza i campi di un documento per nome
+func documentMap(doc bson.D) map[string]interface{} {
+	m := make(map[string]interface{}, len(doc))
+	for _, e := range doc {
+		m[e.Key] = e.Value
+	}
+	return m
+}
+
+// documentID estrae il campo id applicativo da un documento
+func documentID(doc bson.D) (int, bool) {
+	for _, e := range doc {
+		if e.Key != "id" {
+			continue
+		}
+		switch v := e.Value.(type) {
+		case int32:
+			return int(v), true
+		case int64:
+			return int(v), true
+		case int:
+			return v, true
+		case float64:
+			return int(v), true
+		}
+	}
+	return 0, false
+}
+
+// senzaObjectID restituisce una copia del documento senza il campo _id,
+// necessario per le ReplaceOne che non possono modificare _id.
+func senzaObjectID(doc bson.D) bson.D {
+	out := make(bson.D, 0, len(doc))
+	for _, e := range doc {
+		if e.Key != "_id" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,325 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDiffDocumenti(t *testing.T) {
+	backup := []bson.D{
+		{{Key: "_id", Value: "a"}, {Key: "id", Value: int64(1)}, {Key: "ragionesociale", Value: "Rossi"}},
+		{{Key: "_id", Value: "b"}, {Key: "id", Value: int64(2)}, {Key: "ragionesociale", Value: "Bianchi"}},
+		{{Key: "_id", Value: "c"}, {Key: "id", Value: int64(3)}, {Key: "ragionesociale", Value: "Verdi"}},
+	}
+	live := []bson.D{
+		{{Key: "_id", Value: "x"}, {Key: "id", Value: int64(1)}, {Key: "ragionesociale", Value: "Rossi"}},
+		{{Key: "_id", Value: "c"}, {Key: "id", Value: int64(3)}, {Key: "ragionesociale", Value: "Verdi Srl"}, {Key: "telefono", Value: "333"}},
+		{{Key: "_id", Value: "d"}, {Key: "id", Value: int64(4)}, {Key: "ragionesociale", Value: "Neri"}},
+	}
+
+	cd := diffDocumenti(backup, live)
+
+	if cd.Invariati != 1 {
+		t.Errorf("Invariati = %d, want 1", cd.Invariati)
+	}
+
+	want := []struct {
+		id    int
+		stato string
+		campi []string
+	}{
+		{2, DiffMancante, nil},
+		{3, DiffModificato, []string{"ragionesociale", "telefono"}},
+		{4, DiffNuovo, nil},
+	}
+
+	if len(cd.Records) != len(want) {
+		t.Fatalf("Records = %d, want %d", len(cd.Records), len(want))
+	}
+
+	for i, w := range want {
+		r := cd.Records[i]
+		if r.ID != w.id || r.Stato != w.stato {
+			t.Errorf("Records[%d] = #%d %s, want #%d %s", i, r.ID, r.Stato, w.id, w.stato)
+		}
+		if !reflect.DeepEqual(r.Campi, w.campi) {
+			t.Errorf("Records[%d].Campi = %v, want %v", i, r.Campi, w.campi)
+		}
+	}
+
+	if cd.Count(DiffMancante) != 1 || cd.Count(DiffNuovo) != 1 || cd.Count(DiffModificato) != 1 {
+		t.Errorf("Count() non coerente con Records: %+v", cd.Records)
+	}
+}
+
+func TestDocumentID(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    bson.D
+		want   int
+		wantOk bool
+	}{
+		{"int32", bson.D{{Key: "id", Value: int32(7)}}, 7, true},
+		{"int64", bson.D{{Key: "id", Value: int64(1736344335)}}, 1736344335, true},
+		{"senza id", bson.D{{Key: "_id", Value: "x"}}, 0, false},
+		{"id non numerico", bson.D{{Key: "id", Value: "7"}}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := documentID(tt.doc)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("documentID() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+// creaBackupVecchio scrive un backup nel formato delle prime versioni, senza
+// le collezioni aggiunte in seguito (fornitori, contatori, carichi...)
+func creaBackupVecchio(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "officina_backup_20250110_090000")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := map[string]string{
+		"metadata.json": `{"timestamp":"20250110_090000","collections":["clienti","veicoli"],"version":"1.0.0"}`,
+		"clienti.json":  `[{"id":{"$numberInt":"1"},"ragionesociale":"Rossi"},{"id":{"$numberInt":"2"},"ragionesociale":"Bianchi"}]`,
+		"veicoli.json":  `[{"id":{"$numberInt":"1"},"clienteid":{"$numberInt":"1"},"targa":"AB123CD"}]`,
+	}
+	for nome, contenuto := range file {
+		if err := os.WriteFile(filepath.Join(dir, nome), []byte(contenuto), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCollezioniBackupVecchio(t *testing.T) {
+	dir := creaBackupVecchio(t)
+	bm := NewBackupManagerMongo(nil, filepath.Dir(dir), 0)
+
+	collections, err := bm.CollezioniBackup(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"clienti", "veicoli"}; !reflect.DeepEqual(collections, want) {
+		t.Errorf("CollezioniBackup() = %v, want %v", collections, want)
+	}
+}
+
+// TestRestoreMergeBackupVecchio reinserisce i record mancanti da un backup
+// senza tutte le collezioni attuali, come fa backup restore --merge
+func TestRestoreMergeBackupVecchio(t *testing.T) {
+	db := mongoDiTest(t)
+	dir := creaBackupVecchio(t)
+	bm := NewBackupManagerMongo(db, filepath.Dir(dir), 0)
+
+	// Il cliente 1 c'è ancora, il 2 e il veicolo sono stati eliminati
+	if _, err := db.mongo.db.Collection("clienti").InsertOne(db.mongo.ctx, Cliente{ID: 1, RagioneSociale: "Rossi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	collections, err := bm.CollezioniBackup(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := bm.RestoreSelective(dir, RestoreOptions{Collections: collections})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Inseriti["clienti"] != 1 || report.Inseriti["veicoli"] != 1 {
+		t.Errorf("Inseriti = %v, attesi 1 cliente e 1 veicolo", report.Inseriti)
+	}
+}
+
+func TestParseRecordRefs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []RecordRef
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"clienti:12", []RecordRef{{"clienti", 12}}, false},
+		{" clienti:12, veicoli:7 ,", []RecordRef{{"clienti", 12}, {"veicoli", 7}}, false},
+		{"clienti", nil, true},
+		{"clienti:abc", nil, true},
+		{":12", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRecordRefs(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRecordRefs(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRecordRefs(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// creaBackupCliente scrive un backup con due clienti, i loro veicoli e i
+// record collegati
+func creaBackupCliente(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "officina_backup_20260301_090000")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := map[string]string{
+		"metadata.json": `{"timestamp":"20260301_090000","collections":["clienti","veicoli","commesse","appuntamenti","movimenti_primanota"],"version":"2.0.0"}`,
+		"clienti.json":  `[{"id":{"$numberInt":"1"},"ragionesociale":"Rossi"},{"id":{"$numberInt":"2"},"ragionesociale":"Bianchi"}]`,
+		"veicoli.json": `[{"id":{"$numberInt":"10"},"clienteid":{"$numberInt":"1"},"targa":"AB123CD"},` +
+			`{"id":{"$numberInt":"11"},"clienteid":{"$numberInt":"2"},"targa":"EF456GH"},` +
+			`{"id":{"$numberInt":"12"},"clienteid":{"$numberInt":"1"},"targa":"IL789MN"}]`,
+		"commesse.json": `[{"id":{"$numberInt":"100"},"veicoloid":{"$numberInt":"10"},"stato":"APERTA"},` +
+			`{"id":{"$numberInt":"101"},"veicoloid":{"$numberInt":"11"},"stato":"APERTA"}]`,
+		"appuntamenti.json": `[{"id":{"$numberInt":"200"},"veicoloid":{"$numberInt":"12"}}]`,
+		"movimenti_primanota.json": `[{"id":{"$numberInt":"300"},"commessaid":{"$numberInt":"100"},"importo":{"$numberDouble":"50.0"}},` +
+			`{"id":{"$numberInt":"301"},"commessaid":{"$numberInt":"101"},"importo":{"$numberDouble":"70.0"}}]`,
+	}
+	for nome, contenuto := range file {
+		if err := os.WriteFile(filepath.Join(dir, nome), []byte(contenuto), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRecordCollegatiCliente(t *testing.T) {
+	dir := creaBackupCliente(t)
+	bm := NewBackupManagerMongo(nil, filepath.Dir(dir), 0)
+
+	refs, err := bm.RecordCollegatiCliente(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RecordRef{
+		{"clienti", 1},
+		{"veicoli", 10},
+		{"veicoli", 12},
+		{"commesse", 100},
+		{"appuntamenti", 200},
+		{"movimenti_primanota", 300},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("RecordCollegatiCliente() = %v, want %v", refs, want)
+	}
+
+	if _, err := bm.RecordCollegatiCliente(dir, 99); err == nil {
+		t.Error("RecordCollegatiCliente() di un cliente assente: atteso errore")
+	}
+}
+
+// TestRestoreCliente reinserisce un cliente eliminato con i suoi record e
+// sovrascrive quelli modificati solo se richiesto
+func TestRestoreCliente(t *testing.T) {
+	db := mongoDiTest(t)
+	dir := creaBackupCliente(t)
+	bm := NewBackupManagerMongo(db, filepath.Dir(dir), 0)
+
+	// Del cliente 1 resta solo il veicolo 10, con la targa cambiata
+	if _, err := db.mongo.db.Collection("veicoli").InsertOne(db.mongo.ctx,
+		bson.D{{Key: "id", Value: 10}, {Key: "clienteid", Value: 1}, {Key: "targa", Value: "ZZ999ZZ"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := bm.RestoreCliente(dir, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inseriti := map[string]int{"clienti": 1, "veicoli": 1, "commesse": 1, "appuntamenti": 1, "movimenti_primanota": 1}
+	if !reflect.DeepEqual(report.Inseriti, inseriti) || report.Saltati["veicoli"] != 1 {
+		t.Errorf("report = %+v, attesi inseriti %v e un veicolo saltato", report, inseriti)
+	}
+
+	report, err = bm.RestoreCliente(dir, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sovrascritti["veicoli"] != 1 || report.Totale() != 1 {
+		t.Errorf("report con sovrascrittura = %+v, atteso un veicolo sovrascritto", report)
+	}
+
+	diff, err := bm.DiffBackup(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := diff.Collection("veicoli").Count(DiffModificato); n != 0 {
+		t.Errorf("veicoli modificati dopo il ripristino = %d, want 0", n)
+	}
+	if n := diff.Collection("clienti").Count(DiffMancante); n != 1 {
+		t.Errorf("clienti mancanti = %d, want 1 (il cliente 2 non va ripristinato)", n)
+	}
+}
+
+// TestRestoreBackupIndici controlla che il ripristino completo conservi gli
+// indici, in particolare quello univoco sulla chiave dei contatori
+func TestRestoreBackupIndici(t *testing.T) {
+	db := mongoDiTest(t)
+	bm := NewBackupManagerMongo(db, t.TempDir(), 0)
+
+	if err := db.CreateCliente(&Cliente{RagioneSociale: "Rossi"}); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := bm.CreateBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.RestoreBackup(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := db.mongo.db.Collection("contatori").Indexes().List(db.mongo.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indici []bson.M
+	if err := cursor.All(db.mongo.ctx, &indici); err != nil {
+		t.Fatal(err)
+	}
+	univoco := false
+	for _, ix := range indici {
+		if chiavi, ok := ix["key"].(bson.M); ok && chiavi["chiave"] != nil && ix["unique"] == true {
+			univoco = true
+		}
+	}
+	if !univoco {
+		t.Errorf("indice univoco su contatori.chiave assente dopo il ripristino: %v", indici)
+	}
+
+	clienti, err := db.ListClienti()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clienti) != 1 {
+		t.Errorf("clienti dopo il ripristino = %d, want 1", len(clienti))
+	}
+}
+
+// TestRestoreNonAutorizzato controlla che un ruolo senza permessi sui backup
+// non possa ripristinare, né per intero né in parte
+func TestRestoreNonAutorizzato(t *testing.T) {
+	dir := creaBackupCliente(t)
+	db := (&DB{}).NuovaSessione(OrigineTUI)
+	db.ImpostaOperatore(&Operatore{Matricola: "ACC01", Ruolo: RuoloAccettazione})
+	bm := NewBackupManagerMongo(db, filepath.Dir(dir), 0)
+
+	if err := bm.RestoreBackup(dir); !errors.Is(err, ErrPermessoNegato) {
+		t.Errorf("RestoreBackup() = %v, atteso ErrPermessoNegato", err)
+	}
+	if _, err := bm.RestoreSelective(dir, RestoreOptions{Collections: []string{"clienti"}}); !errors.Is(err, ErrPermessoNegato) {
+		t.Errorf("RestoreSelective() = %v, atteso ErrPermessoNegato", err)
+	}
+	if _, err := bm.RestoreCliente(dir, 1, false); !errors.Is(err, ErrPermessoNegato) {
+		t.Errorf("RestoreCliente() = %v, atteso ErrPermessoNegato", err)
+	}
+}
@@ -0,0 +1,255 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+
+	"officina/logger"
+)
+
+// LunghezzaMinimaCredenziale è la lunghezza minima di password e PIN
+const LunghezzaMinimaCredenziale = 4
+
+// ErrCredenzialiNonValide è restituito da Autentica per matricola
+// inesistente, operatore senza credenziale o password errata, senza
+// distinguere i casi
+var ErrCredenzialiNonValide = errors.New("matricola o password non validi")
+
+// Azioni registrate nel registro attività
+const (
+	AzioneCrea        = "crea"
+	AzioneModifica    = "modifica"
+	AzioneElimina     = "elimina"
+	AzioneAccesso     = "accesso"
+	AzioneCredenziale = "credenziale"
+)
+
+// Origini delle scritture nel registro attività
+const (
+	OrigineSistema = "sistema" // riga di comando, backup automatici
+	OrigineTUI     = "tui"
+	OrigineAPI     = "api"
+	OrigineSSH     = "ssh"
+)
+
+// Attivita è una voce del registro attività: chi ha scritto cosa e quando
+type Attivita struct {
+	Data        time.Time `json:"data"`
+	OperatoreID int       `json:"operatore_id"`
+	Operatore   string    `json:"operatore"` // matricola, vuota se nessun operatore
+	Origine     string    `json:"origine"`
+	Azione      string    `json:"azione"`
+	Collezione  string    `json:"collezione"`
+	RecordID    int       `json:"record_id"`
+}
+
+// sessione identifica chi sta usando il database
+type sessione struct {
+	mu        sync.RWMutex
+	origine   string
+	operatore *Operatore
+}
+
+// NuovaSessione restituisce un DB che condivide la connessione con db ma ha
+// un proprio operatore corrente, usato per attribuire le scritture. Ogni
+// interfaccia (TUI, API, sessione SSH) lavora sulla propria sessione; Close
+// su una sessione chiude la connessione condivisa.
+func (db *DB) NuovaSessione(origine string) *DB {
+	return &DB{mongo: db.mongo, sessione: &sessione{origine: origine}, eventi: db.eventi}
+}
+
+// ImpostaOperatore imposta l'operatore a cui attribuire le scritture
+// della sessione; nil indica nessun operatore
+func (db *DB) ImpostaOperatore(o *Operatore) {
+	if db.sessione == nil {
+		db.sessione = &sessione{origine: OrigineSistema}
+	}
+	db.sessione.mu.Lock()
+	defer db.sessione.mu.Unlock()
+	db.sessione.operatore = o
+}
+
+// OperatoreCorrente restituisce l'operatore della sessione, o nil
+func (db *DB) OperatoreCorrente() *Operatore {
+	if db.sessione == nil {
+		return nil
+	}
+	db.sessione.mu.RLock()
+	defer db.sessione.mu.RUnlock()
+	return db.sessione.operatore
+}
+
+// traccia registra una scrittura riuscita nel registro attività. Un errore
+// di registrazione non annulla la scrittura: viene solo scritto nel log.
+func (db *DB) traccia(azione, collezione string, id int) {
+	a := Attivita{
+		Data:       time.Now(),
+		Origine:    OrigineSistema,
+		Azione:     azione,
+		Collezione: collezione,
+		RecordID:   id,
+	}
+	if db.sessione != nil {
+		a.Origine = db.sessione.origine
+	}
+	if o := db.OperatoreCorrente(); o != nil {
+		a.OperatoreID = o.ID
+		a.Operatore = o.Matricola
+	}
+
+	if _, err := db.mongo.db.Collection("registro_attivita").InsertOne(db.mongo.ctx, a); err != nil {
+		logger.Warn("Registro attività: impossibile registrare %s %s #%d: %v", azione, collezione, id, err)
+	}
+}
+
+// FiltroAttivita seleziona le voci di ListAttivita; i campi vuoti non filtrano
+type FiltroAttivita struct {
+	Operatore  string // matricola
+	Collezione string
+	Dal        time.Time
+	Limite     int // 0 = nessun limite
+}
+
+// ListAttivita restituisce le voci del registro, dalla più recente
+func (db *DB) ListAttivita(f FiltroAttivita) ([]Attivita, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "data", Value: -1}})
+	if f.Limite > 0 {
+		opts.SetLimit(int64(f.Limite))
+	}
+
+	// I campi sono salvati con i nomi predefiniti del driver (minuscoli)
+	query := bson.M{}
+	if f.Operatore != "" {
+		query["operatore"] = strings.ToUpper(f.Operatore)
+	}
+	if f.Collezione != "" {
+		query["collezione"] = f.Collezione
+	}
+	if !f.Dal.IsZero() {
+		query["data"] = bson.M{"$gte": f.Dal}
+	}
+
+	cursor, err := db.mongo.db.Collection("registro_attivita").Find(db.mongo.ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura registro attività: %w", err)
+	}
+	defer cursor.Close(db.mongo.ctx)
+
+	var list []Attivita
+	if err := cursor.All(db.mongo.ctx, &list); err != nil {
+		return nil, fmt.Errorf("errore lettura registro attività: %w", err)
+	}
+	return list, nil
+}
+
+// ==================== CREDENZIALI ====================
+
+// HashCredenziale calcola l'hash bcrypt di una password o di un PIN
+func HashCredenziale(credenziale string) (string, error) {
+	if len([]rune(credenziale)) < LunghezzaMinimaCredenziale {
+		return "", fmt.Errorf("password o PIN devono avere almeno %d caratteri", LunghezzaMinimaCredenziale)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(credenziale), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("errore calcolo hash: %w", err)
+	}
+	return string(hash), nil
+}
+
+// VerificaCredenziale confronta una password o un PIN con l'hash salvato
+func (o *Operatore) VerificaCredenziale(credenziale string) bool {
+	if o.PasswordHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(o.PasswordHash), []byte(credenziale)) == nil
+}
+
+// ImpostaCredenziale imposta la password o il PIN dell'operatore; una
+// credenziale vuota revoca l'accesso. Ogni operatore può cambiare la
+// propria, quelle degli altri richiedono il permesso di modifica.
+func (db *DB) ImpostaCredenziale(id int, credenziale string) error {
+	if c := db.OperatoreCorrente(); c == nil || c.ID != id {
+		if err := db.Autorizza(RisorsaOperatori, PermessoModifica); err != nil {
+			return err
+		}
+	}
+
+	o, err := db.GetOperatore(id)
+	if err != nil {
+		return err
+	}
+
+	hash := ""
+	if credenziale != "" {
+		if hash, err = HashCredenziale(credenziale); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.mongo.db.Collection("operatori").UpdateOne(db.mongo.ctx,
+		bson.M{"id": id}, bson.M{"$set": bson.M{"passwordhash": hash}})
+	if err != nil {
+		return fmt.Errorf("errore salvataggio credenziale di %s: %w", o.Matricola, err)
+	}
+	db.traccia(AzioneCredenziale, "operatori", id)
+	return nil
+}
+
+// GetOperatoreByMatricola cerca un operatore per matricola, senza
+// distinguere maiuscole; restituisce nil se non esiste
+func (db *DB) GetOperatoreByMatricola(matricola string) (*Operatore, error) {
+	matricola = strings.TrimSpace(matricola)
+
+	list, err := db.ListOperatori()
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura operatori: %w", err)
+	}
+	for i := range list {
+		if strings.EqualFold(list[i].Matricola, matricola) {
+			return &list[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Autentica verifica matricola e credenziale e restituisce l'operatore
+func (db *DB) Autentica(matricola, credenziale string) (*Operatore, error) {
+	o, err := db.GetOperatoreByMatricola(matricola)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil || !o.VerificaCredenziale(credenziale) {
+		return nil, ErrCredenzialiNonValide
+	}
+	return o, nil
+}
+
+// AccessoRichiesto indica se almeno un operatore ha una credenziale: solo
+// in quel caso l'interfaccia chiede l'accesso, così che un'installazione
+// senza operatori configurati resti utilizzabile
+func (db *DB) AccessoRichiesto() (bool, error) {
+	list, err := db.ListOperatori()
+	if err != nil {
+		return false, fmt.Errorf("errore lettura operatori: %w", err)
+	}
+	for _, o := range list {
+		if o.HaCredenziale() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RegistraAccesso annota nel registro l'accesso dell'operatore corrente
+func (db *DB) RegistraAccesso() {
+	if o := db.OperatoreCorrente(); o != nil {
+		db.traccia(AzioneAccesso, "operatori", o.ID)
+	}
+}
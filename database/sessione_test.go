@@ -0,0 +1,34 @@
+package database
+
+import "testing"
+
+func TestCredenziale(t *testing.T) {
+	if _, err := HashCredenziale("123"); err == nil {
+		t.Fatal("PIN di 3 cifre accettato")
+	}
+
+	hash, err := HashCredenziale("4821")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &Operatore{Matricola: "OPR001", PasswordHash: hash}
+
+	tests := []struct {
+		credenziale string
+		valida      bool
+	}{
+		{"4821", true},
+		{"4822", false},
+		{"", false},
+		{hash, false},
+	}
+	for _, tt := range tests {
+		if got := o.VerificaCredenziale(tt.credenziale); got != tt.valida {
+			t.Errorf("VerificaCredenziale(%q) = %v, atteso %v", tt.credenziale, got, tt.valida)
+		}
+	}
+
+	if (&Operatore{}).VerificaCredenziale("") {
+		t.Error("operatore senza credenziale autenticato")
+	}
+}
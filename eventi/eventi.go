@@ -0,0 +1,193 @@
+// Package eventi è il bus di pubblicazione degli eventi di dominio. Il
+// database annuncia i fatti avvenuti (commessa chiusa, movimento
+// registrato, ...); Collega li converte negli eventi tipizzati di questo
+// package e li consegna ai sottoscrittori, in modo che notifiche, registro,
+// fatturazione e magazzino reagiscano senza che le schermate ne sappiano
+// nulla.
+package eventi
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"officina/database"
+	"officina/logger"
+)
+
+// Evento è implementato da tutti gli eventi del bus
+type Evento interface {
+	// Intestazione restituisce l'evento così come annunciato dal database:
+	// identificativo, tipo, data, origine, operatore e record
+	Intestazione() database.Evento
+}
+
+// Base contiene l'intestazione comune; gli eventi la incorporano
+type Base struct {
+	database.Evento
+}
+
+// Intestazione implementa Evento
+func (b Base) Intestazione() database.Evento { return b.Evento }
+
+// CommessaChiusa: una commessa è passata allo stato Chiusa
+type CommessaChiusa struct {
+	Base
+	Commessa database.Commessa
+}
+
+// PreventivoAccettato: un preventivo è stato accettato dal cliente
+type PreventivoAccettato struct {
+	Base
+	Preventivo database.Preventivo
+}
+
+// MovimentoRegistrato: è stato registrato un movimento di prima nota
+type MovimentoRegistrato struct {
+	Base
+	Movimento database.MovimentoPrimaNota
+}
+
+// AppuntamentoCreato: è stato fissato un appuntamento
+type AppuntamentoCreato struct {
+	Base
+	Appuntamento database.Appuntamento
+}
+
+// FatturaEmessa: è stata registrata una fattura
+type FatturaEmessa struct {
+	Base
+	Fattura database.Fattura
+}
+
+// sottoscrittore è una funzione registrata sul bus
+type sottoscrittore struct {
+	nome      string
+	f         func(Evento)
+	asincrono bool
+}
+
+// Bus consegna gli eventi ai sottoscrittori. I sottoscrittori sincroni sono
+// chiamati nell'ordine di registrazione, prima che Pubblica torni; quelli
+// asincroni in una goroutine ciascuno. Un sottoscrittore che va in panic
+// viene segnalato nel log senza interrompere gli altri.
+type Bus struct {
+	mu      sync.RWMutex
+	perTipo map[reflect.Type][]sottoscrittore
+	tutti   []sottoscrittore
+	wg      sync.WaitGroup
+}
+
+// NewBus crea un bus senza sottoscrittori
+func NewBus() *Bus {
+	return &Bus{perTipo: make(map[reflect.Type][]sottoscrittore)}
+}
+
+// Sottoscrivi registra f per gli eventi di tipo E, eseguita prima che
+// Pubblica torni: adatta a lavori brevi che devono essere conclusi quando
+// la scrittura che ha prodotto l'evento termina
+func Sottoscrivi[E Evento](b *Bus, f func(E)) {
+	aggiungi(b, f, false)
+}
+
+// SottoscriviAsincrono registra f per gli eventi di tipo E, eseguita in una
+// goroutine: adatta a lavori lenti come le chiamate di rete
+func SottoscriviAsincrono[E Evento](b *Bus, f func(E)) {
+	aggiungi(b, f, true)
+}
+
+func aggiungi[E Evento](b *Bus, f func(E), asincrono bool) {
+	tipo := reflect.TypeOf((*E)(nil)).Elem()
+	s := sottoscrittore{
+		nome:      tipo.Name(),
+		f:         func(e Evento) { f(e.(E)) },
+		asincrono: asincrono,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.perTipo[tipo] = append(b.perTipo[tipo], s)
+}
+
+// SottoscriviTutti registra f, sincrona, per ogni evento pubblicato
+func (b *Bus) SottoscriviTutti(f func(Evento)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tutti = append(b.tutti, sottoscrittore{nome: "tutti", f: f})
+}
+
+// Pubblica consegna l'evento ai sottoscrittori del suo tipo e a quelli di
+// tutti gli eventi
+func (b *Bus) Pubblica(e Evento) {
+	b.mu.RLock()
+	lista := append(append([]sottoscrittore(nil), b.perTipo[reflect.TypeOf(e)]...), b.tutti...)
+	b.mu.RUnlock()
+
+	for _, s := range lista {
+		if !s.asincrono {
+			s.esegui(e)
+			continue
+		}
+		b.wg.Add(1)
+		go func(s sottoscrittore) {
+			defer b.wg.Done()
+			s.esegui(e)
+		}(s)
+	}
+}
+
+// Attendi aspetta che i sottoscrittori asincroni abbiano finito
+func (b *Bus) Attendi() {
+	b.wg.Wait()
+}
+
+// esegui chiama il sottoscrittore isolandone i panic
+func (s sottoscrittore) esegui(e Evento) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Eventi: sottoscrittore di %s fallito su %s: %v", s.nome, e.Intestazione().ID, r)
+		}
+	}()
+	s.f(e)
+}
+
+// Collega pubblica sul bus gli eventi annunciati dal database, compresi
+// quelli delle sessioni create in seguito con NuovaSessione
+func Collega(b *Bus, db *database.DB) {
+	db.AscoltaEventi(func(e database.Evento) {
+		tipizzato, err := Tipizza(e)
+		if err != nil {
+			logger.Warn("Eventi: %v", err)
+			return
+		}
+		b.Pubblica(tipizzato)
+	})
+}
+
+// Tipizza converte un evento del database nell'evento corrispondente
+func Tipizza(e database.Evento) (Evento, error) {
+	base := Base{e}
+	switch dati := e.Dati.(type) {
+	case *database.Commessa:
+		if e.Tipo == database.EventoCommessaChiusa {
+			return CommessaChiusa{base, *dati}, nil
+		}
+	case *database.Preventivo:
+		if e.Tipo == database.EventoPreventivoAccettato {
+			return PreventivoAccettato{base, *dati}, nil
+		}
+	case *database.MovimentoPrimaNota:
+		if e.Tipo == database.EventoMovimentoRegistrato {
+			return MovimentoRegistrato{base, *dati}, nil
+		}
+	case *database.Appuntamento:
+		if e.Tipo == database.EventoAppuntamentoCreato {
+			return AppuntamentoCreato{base, *dati}, nil
+		}
+	case *database.Fattura:
+		if e.Tipo == database.EventoFatturaEmessa {
+			return FatturaEmessa{base, *dati}, nil
+		}
+	}
+	return nil, fmt.Errorf("evento %s con dati %T non riconosciuto", e.Tipo, e.Dati)
+}
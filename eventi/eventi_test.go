@@ -0,0 +1,97 @@
+package eventi
+
+import (
+	"sync"
+	"testing"
+
+	"officina/database"
+)
+
+func TestPubblica(t *testing.T) {
+	b := NewBus()
+
+	var mu sync.Mutex
+	var ricevuti []string
+	annota := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		ricevuti = append(ricevuti, s)
+	}
+
+	Sottoscrivi(b, func(e CommessaChiusa) { annota("sync " + e.Commessa.Numero) })
+	Sottoscrivi(b, func(e CommessaChiusa) { panic("sottoscrittore difettoso") })
+	SottoscriviAsincrono(b, func(e CommessaChiusa) { annota("async " + e.Commessa.Numero) })
+	Sottoscrivi(b, func(e PreventivoAccettato) { annota("preventivo " + e.Preventivo.Numero) })
+	b.SottoscriviTutti(func(e Evento) { annota("tutti " + e.Intestazione().Tipo) })
+
+	b.Pubblica(CommessaChiusa{Base{database.Evento{Tipo: database.EventoCommessaChiusa}}, database.Commessa{Numero: "C-1"}})
+	b.Attendi()
+
+	// Il sottoscrittore in panic non ferma gli altri; quello del preventivo
+	// non riceve la commessa
+	want := map[string]bool{"sync C-1": true, "async C-1": true, "tutti commessa.chiusa": true}
+	if len(ricevuti) != len(want) {
+		t.Fatalf("ricevuti = %v", ricevuti)
+	}
+	for _, r := range ricevuti {
+		if !want[r] {
+			t.Errorf("consegna inattesa %q (ricevuti %v)", r, ricevuti)
+		}
+	}
+	if ricevuti[0] != "sync C-1" {
+		t.Errorf("i sottoscrittori sincroni vanno chiamati prima che Pubblica torni: %v", ricevuti)
+	}
+}
+
+func TestTipizza(t *testing.T) {
+	tests := []struct {
+		name string
+		e    database.Evento
+		want string // nome del tipo, "" se non riconosciuto
+	}{
+		{"commessa chiusa", database.Evento{Tipo: database.EventoCommessaChiusa, Dati: &database.Commessa{ID: 1}}, "CommessaChiusa"},
+		{"preventivo accettato", database.Evento{Tipo: database.EventoPreventivoAccettato, Dati: &database.Preventivo{ID: 2}}, "PreventivoAccettato"},
+		{"movimento registrato", database.Evento{Tipo: database.EventoMovimentoRegistrato, Dati: &database.MovimentoPrimaNota{ID: 3}}, "MovimentoRegistrato"},
+		{"appuntamento creato", database.Evento{Tipo: database.EventoAppuntamentoCreato, Dati: &database.Appuntamento{ID: 4}}, "AppuntamentoCreato"},
+		{"fattura emessa", database.Evento{Tipo: database.EventoFatturaEmessa, Dati: &database.Fattura{ID: 5}}, "FatturaEmessa"},
+		{"dati di altro tipo", database.Evento{Tipo: database.EventoCommessaChiusa, Dati: &database.Fattura{ID: 5}}, ""},
+		{"senza dati", database.Evento{Tipo: database.EventoFatturaEmessa}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Tipizza(tt.e)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("Tipizza() = %T, atteso errore", e)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Tipizza() error = %v", err)
+			}
+			if got := nomeTipo(e); got != tt.want {
+				t.Errorf("Tipizza() = %s, want %s", got, tt.want)
+			}
+			if e.Intestazione().Tipo != tt.e.Tipo {
+				t.Errorf("intestazione = %+v", e.Intestazione())
+			}
+		})
+	}
+}
+
+func nomeTipo(e Evento) string {
+	switch e.(type) {
+	case CommessaChiusa:
+		return "CommessaChiusa"
+	case PreventivoAccettato:
+		return "PreventivoAccettato"
+	case MovimentoRegistrato:
+		return "MovimentoRegistrato"
+	case AppuntamentoCreato:
+		return "AppuntamentoCreato"
+	case FatturaEmessa:
+		return "FatturaEmessa"
+	}
+	return ""
+}
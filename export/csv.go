@@ -0,0 +1,47 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// WriteCSV scrive la tabella in CSV con separatore ";" e BOM UTF-8, le
+// impostazioni con cui Excel in italiano apre il file senza conversioni
+func WriteCSV(w io.Writer, t *Tabella) error {
+	if _, err := io.WriteString(w, "\xef\xbb\xbf"); err != nil {
+		return fmt.Errorf("errore scrittura CSV: %w", err)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+
+	cw.Write(t.Colonne)
+	for _, riga := range t.Righe {
+		cw.Write(testi(riga))
+	}
+
+	if len(t.Totali) > 0 {
+		cw.Write(testi(t.Totali))
+	}
+	if len(t.Note) > 0 {
+		cw.Write(nil)
+		for _, nota := range t.Note {
+			cw.Write([]string{nota})
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("errore scrittura CSV: %w", err)
+	}
+	return nil
+}
+
+func testi(celle []Cella) []string {
+	s := make([]string, len(celle))
+	for i, c := range celle {
+		s[i] = c.String()
+	}
+	return s
+}
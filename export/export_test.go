@@ -0,0 +1,151 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"officina/database"
+)
+
+func TestViste(t *testing.T) {
+	data := time.Date(2026, 3, 5, 0, 0, 0, 0, time.Local)
+	clienti := []database.Cliente{{ID: 1, RagioneSociale: "Rossi; Mario", PartitaIVA: "01234567890"}}
+	veicoli := []database.Veicolo{{ID: 10, Targa: "AB123CD", Marca: "Fiat", Modello: "Panda", ClienteID: 1}}
+	commesse := []database.Commessa{{ID: 20, Numero: "C-1", VeicoloID: 10, Stato: database.StatoCommessaAperta, DataApertura: data, Totale: 150}}
+	movimenti := []database.MovimentoPrimaNota{
+		{ID: 30, Data: data, Descrizione: "Acconto", Tipo: database.TipoMovimentoEntrata, Importo: 100, Metodo: database.MetodoPagamentoCassa, CommessaID: 20},
+		{ID: 31, Data: data, Descrizione: "Ricambi", Tipo: database.TipoMovimentoUscita, Importo: 40.5, Metodo: database.MetodoPagamentoCassa, FornitoreID: 2},
+	}
+	fornitori := []database.Fornitore{{ID: 2, RagioneSociale: "Ricambi Spa"}}
+	fatture := []database.Fattura{
+		{ID: 40, Numero: "1/2026", Data: data, ClienteID: 1, Importo: 122, Imponibile: 100, Imposta: 22,
+			Righe: []database.RigaFattura{{Descrizione: "Tagliando", Quantita: 1, PrezzoUnitario: 100, AliquotaIVA: 22}}},
+		{ID: 41, Numero: "2/2026", Data: data, ClienteID: 1, Importo: 50},
+		{ID: 42, Tipo: database.TipoDocumentoNotaCredito, Numero: "NC-1/2026", Data: data, ClienteID: 1, RiferimentoID: 40,
+			Importo: 12.2, Imponibile: 10, Imposta: 2.2,
+			Righe: []database.RigaFattura{{Descrizione: "Sconto", Quantita: 1, PrezzoUnitario: 10, AliquotaIVA: 22}}},
+		{ID: 43, Tipo: database.TipoDocumentoProforma, Numero: "PF-1/2026", Data: data, ClienteID: 1, Importo: 61},
+	}
+
+	tests := []struct {
+		name    string
+		tabella *Tabella
+		csv     []string
+	}{
+		{
+			name:    "veicoli",
+			tabella: Veicoli(veicoli, clienti),
+			csv: []string{
+				"Targa;Marca;Modello;Anno;Km;Ultima revisione;Cliente",
+				`AB123CD;Fiat;Panda;;;;"Rossi; Mario"`,
+			},
+		},
+		{
+			name:    "commesse",
+			tabella: Commesse(commesse, veicoli, clienti, movimenti),
+			csv: []string{
+				"Numero;Stato;Apertura;Chiusura;Targa;Veicolo;Cliente;Lavori eseguiti;Manodopera;Ricambi;Totale;Versato;Residuo",
+				`C-1;Aperta;05/03/2026;;AB123CD;Fiat Panda;"Rossi; Mario";;€ 0.00;€ 0.00;€ 150.00;€ 100.00;€ 50.00`,
+				"Totale (1);;;;;;;;;;€ 150.00;€ 100.00;€ 50.00",
+			},
+		},
+		{
+			name:    "prima nota con filtri",
+			tabella: PrimaNota(movimenti, commesse, fornitori, []string{"Descrizione: acc"}),
+			csv: []string{
+				"Data;Descrizione;Tipo;Metodo;Entrate;Uscite;Commessa;Fornitore;N. fattura;Data fattura",
+				"05/03/2026;Acconto;Entrata;CASSA;€ 100.00;;C-1;;;",
+				"05/03/2026;Ricambi;Uscita;CASSA;;€ 40.50;;Ricambi Spa;;",
+				"Totali;Saldo € 59.50;;;€ 100.00;€ 40.50",
+				"",
+				"Filtri attivi:",
+				"Descrizione: acc",
+			},
+		},
+		{
+			name:    "fatture",
+			tabella: Fatture(fatture, clienti),
+			csv: []string{
+				"Numero;Data;Cliente;Partita IVA;Codice fiscale;Imponibile;IVA;Totale;Netto a pagare",
+				`1/2026;05/03/2026;"Rossi; Mario";01234567890;;€ 100.00;€ 22.00;€ 122.00;€ 122.00`,
+				`2/2026;05/03/2026;"Rossi; Mario";01234567890;;;;€ 50.00;€ 50.00`,
+				`NC-1/2026;05/03/2026;"Rossi; Mario";01234567890;;€ -10.00;€ -2.20;€ -12.20;€ -12.20`,
+				`PF-1/2026;05/03/2026;"Rossi; Mario";01234567890;;;;€ 61.00;€ 61.00`,
+				"Totale (4);;;;;€ 90.00;€ 19.80;€ 159.80;€ 159.80",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteCSV(&buf, tt.tabella); err != nil {
+				t.Fatal(err)
+			}
+
+			got := strings.TrimPrefix(buf.String(), "\xef\xbb\xbf")
+			want := strings.Join(tt.csv, "\n") + "\n"
+			if got != want {
+				t.Errorf("CSV:\n%s\natteso:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	tab := &Tabella{Nome: "Prima nota: marzo", Colonne: []string{"Data", "Descrizione", "Importo"}}
+	tab.Aggiungi(Data(time.Date(2026, 3, 5, 0, 0, 0, 0, time.Local)), Testo("Olio & filtri <5W30>"), Euro(40.5))
+	tab.Totali = []Cella{Testo("Totale"), {}, Euro(40.5)}
+
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, tab); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("XLSX non è uno zip valido: %v", err)
+	}
+
+	parti := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		parti[f.Name] = string(data)
+	}
+
+	for _, nome := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parti[nome]; !ok {
+			t.Errorf("parte mancante: %s", nome)
+		}
+	}
+
+	sheet := parti["xl/worksheets/sheet1.xml"]
+	for _, atteso := range []string{
+		`<c r="A2" s="3"><v>46086</v></c>`,
+		`Olio &amp; filtri &lt;5W30&gt;`,
+		`<c r="C2" s="2"><v>40.50</v></c>`,
+		`<c r="C3" s="5"><v>40.50</v></c>`,
+		`<autoFilter ref="A1:C2"/>`,
+	} {
+		if !strings.Contains(sheet, atteso) {
+			t.Errorf("foglio senza %s:\n%s", atteso, sheet)
+		}
+	}
+	if !strings.Contains(parti["xl/workbook.xml"], `name="Prima nota- marzo"`) {
+		t.Errorf("nome foglio non valido:\n%s", parti["xl/workbook.xml"])
+	}
+}
+
+func TestColonnaXLSX(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := colonnaXLSX(i); got != want {
+			t.Errorf("colonnaXLSX(%d) = %s, atteso %s", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package export salva le viste elenco dell'applicazione in formati aperti
+// da fogli di calcolo (CSV e XLSX), con intestazioni leggibili, date ed
+// importi in formato italiano e nomi al posto degli identificativi.
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"officina/utils"
+)
+
+// Formati di esportazione supportati
+const (
+	FormatoCSV  = "csv"
+	FormatoXLSX = "xlsx"
+)
+
+// Formati elenca i formati supportati
+func Formati() []string {
+	return []string{FormatoCSV, FormatoXLSX}
+}
+
+type tipoCella int
+
+const (
+	cellaTesto tipoCella = iota
+	cellaEuro
+	cellaData
+	cellaIntero
+)
+
+// Cella è un valore della tabella: il CSV ne scrive la forma testuale,
+// l'XLSX conserva numeri e date perché si possano sommare e ordinare
+type Cella struct {
+	tipo   tipoCella
+	testo  string
+	numero float64
+	data   time.Time
+}
+
+// Testo crea una cella di testo
+func Testo(s string) Cella {
+	return Cella{tipo: cellaTesto, testo: s}
+}
+
+// Euro crea una cella con un importo
+func Euro(v float64) Cella {
+	return Cella{tipo: cellaEuro, numero: v}
+}
+
+// Data crea una cella con una data; la data zero resta vuota
+func Data(t time.Time) Cella {
+	if t.IsZero() {
+		return Testo("")
+	}
+	return Cella{tipo: cellaData, data: t}
+}
+
+// Intero crea una cella con un numero intero; zero resta vuoto se
+// omettiZero è true (anno o km non indicati)
+func Intero(n int, omettiZero bool) Cella {
+	if n == 0 && omettiZero {
+		return Testo("")
+	}
+	return Cella{tipo: cellaIntero, numero: float64(n)}
+}
+
+// String restituisce la cella in formato italiano
+func (c Cella) String() string {
+	switch c.tipo {
+	case cellaEuro:
+		return utils.FormatEuro(c.numero)
+	case cellaData:
+		return utils.FormatDate(c.data)
+	case cellaIntero:
+		return strconv.Itoa(int(c.numero))
+	}
+	return c.testo
+}
+
+// Tabella è una vista pronta da esportare
+type Tabella struct {
+	Nome    string // titolo della vista, usato per il nome del file e del foglio
+	Colonne []string
+	Righe   [][]Cella
+	Totali  []Cella  // riga di totali facoltativa, dopo i dati
+	Note    []string // righe descrittive in fondo (es. filtri attivi)
+}
+
+// Aggiungi accoda una riga
+func (t *Tabella) Aggiungi(celle ...Cella) {
+	t.Righe = append(t.Righe, celle)
+}
+
+// Scrivi scrive la tabella nel formato indicato
+func Scrivi(w io.Writer, formato string, t *Tabella) error {
+	switch formato {
+	case FormatoCSV:
+		return WriteCSV(w, t)
+	case FormatoXLSX:
+		return WriteXLSX(w, t)
+	}
+	return fmt.Errorf("formato non supportato: %s (validi: %s)", formato, strings.Join(Formati(), ", "))
+}
+
+// Salva scrive la tabella in dir con nome <vista>_<data ora>.<formato> e
+// restituisce il percorso del file
+func Salva(dir, formato string, t *Tabella) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("impossibile creare directory export: %w", err)
+	}
+
+	nome := fmt.Sprintf("%s_%s.%s", nomeFile(t.Nome), time.Now().Format("20060102_150405"), formato)
+	path := filepath.Join(dir, nome)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("errore creazione %s: %w", path, err)
+	}
+
+	if err := Scrivi(f, formato, t); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("errore scrittura %s: %w", path, err)
+	}
+
+	return path, nil
+}
+
+// nomeFile riduce il titolo della vista a un nome di file sicuro
+func nomeFile(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '_':
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "export"
+	}
+	return b.String()
+}
@@ -0,0 +1,202 @@
+package export
+
+import (
+	"fmt"
+
+	"officina/database"
+)
+
+// Clienti prepara l'elenco clienti
+func Clienti(clienti []database.Cliente) *Tabella {
+	t := &Tabella{
+		Nome: "Clienti",
+		Colonne: []string{
+			"Codice", "Ragione sociale / Nome", "Telefono", "Email", "PEC", "Codice fiscale",
+			"Partita IVA", "Codice destinatario", "Indirizzo", "CAP", "Città", "Provincia",
+		},
+	}
+
+	for _, c := range clienti {
+		t.Aggiungi(
+			Intero(c.ID, false), Testo(c.RagioneSociale), Testo(c.Telefono), Testo(c.Email), Testo(c.PEC),
+			Testo(c.CodiceFiscale), Testo(c.PartitaIVA), Testo(c.CodiceDestinatario),
+			Testo(c.Indirizzo), Testo(c.CAP), Testo(c.Citta), Testo(c.Provincia),
+		)
+	}
+	return t
+}
+
+// Veicoli prepara l'elenco veicoli con il nome del proprietario
+func Veicoli(veicoli []database.Veicolo, clienti []database.Cliente) *Tabella {
+	nomi := nomiClienti(clienti)
+	t := &Tabella{
+		Nome:    "Veicoli",
+		Colonne: []string{"Targa", "Marca", "Modello", "Anno", "Km", "Ultima revisione", "Cliente"},
+	}
+
+	for _, v := range veicoli {
+		t.Aggiungi(
+			Testo(v.Targa), Testo(v.Marca), Testo(v.Modello), Intero(v.Anno, true), Intero(v.Km, true),
+			Data(v.UltimaRev), Testo(nomi[v.ClienteID]),
+		)
+	}
+	return t
+}
+
+// Commesse prepara l'elenco commesse con veicolo, cliente e importi versati
+// (entrate di prima nota collegate alla commessa)
+func Commesse(commesse []database.Commessa, veicoli []database.Veicolo, clienti []database.Cliente, movimenti []database.MovimentoPrimaNota) *Tabella {
+	nomi := nomiClienti(clienti)
+	perID := make(map[int]database.Veicolo, len(veicoli))
+	for _, v := range veicoli {
+		perID[v.ID] = v
+	}
+	versato := make(map[int]float64)
+	for _, m := range movimenti {
+		if m.CommessaID > 0 && m.Tipo == database.TipoMovimentoEntrata {
+			versato[m.CommessaID] += m.Importo
+		}
+	}
+
+	t := &Tabella{
+		Nome: "Commesse",
+		Colonne: []string{
+			"Numero", "Stato", "Apertura", "Chiusura", "Targa", "Veicolo", "Cliente", "Lavori eseguiti",
+			"Manodopera", "Ricambi", "Totale", "Versato", "Residuo",
+		},
+	}
+
+	var totale, totVersato, totResiduo float64
+	for _, c := range commesse {
+		v, ok := perID[c.VeicoloID]
+		targa, veicolo, cliente := "", "", ""
+		if ok {
+			targa, veicolo, cliente = v.Targa, v.Marca+" "+v.Modello, nomi[v.ClienteID]
+		}
+
+		residuo := c.Totale - versato[c.ID]
+		if residuo < 0 {
+			residuo = 0
+		}
+		totale += c.Totale
+		totVersato += versato[c.ID]
+		totResiduo += residuo
+
+		t.Aggiungi(
+			Testo(c.Numero), Testo(c.Stato), Data(c.DataApertura), Data(c.DataChiusura),
+			Testo(targa), Testo(veicolo), Testo(cliente), Testo(c.LavoriEseguiti),
+			Euro(c.CostoManodopera), Euro(c.CostoRicambi), Euro(c.Totale), Euro(versato[c.ID]), Euro(residuo),
+		)
+	}
+
+	if len(commesse) > 0 {
+		t.Totali = []Cella{
+			Testo(fmt.Sprintf("Totale (%d)", len(commesse))), {}, {}, {}, {}, {}, {}, {}, {}, {},
+			Euro(totale), Euro(totVersato), Euro(totResiduo),
+		}
+	}
+	return t
+}
+
+// PrimaNota prepara i movimenti con numero di commessa e fornitore; filtri
+// descrive i filtri attivi nella schermata e viene riportato in fondo
+func PrimaNota(movimenti []database.MovimentoPrimaNota, commesse []database.Commessa, fornitori []database.Fornitore, filtri []string) *Tabella {
+	numeri := make(map[int]string, len(commesse))
+	for _, c := range commesse {
+		numeri[c.ID] = c.Numero
+	}
+	nomiFornitori := make(map[int]string, len(fornitori))
+	for _, f := range fornitori {
+		nomiFornitori[f.ID] = f.RagioneSociale
+	}
+
+	t := &Tabella{
+		Nome: "Prima nota",
+		Colonne: []string{
+			"Data", "Descrizione", "Tipo", "Metodo", "Entrate", "Uscite",
+			"Commessa", "Fornitore", "N. fattura", "Data fattura",
+		},
+	}
+
+	var entrate, uscite float64
+	for _, m := range movimenti {
+		in, out := Cella{}, Cella{}
+		if m.Tipo == database.TipoMovimentoEntrata {
+			in = Euro(m.Importo)
+			entrate += m.Importo
+		} else {
+			out = Euro(m.Importo)
+			uscite += m.Importo
+		}
+
+		t.Aggiungi(
+			Data(m.Data), Testo(m.Descrizione), Testo(m.Tipo), Testo(m.Metodo), in, out,
+			Testo(numeri[m.CommessaID]), Testo(nomiFornitori[m.FornitoreID]),
+			Testo(m.NumeroFattura), Data(m.DataFattura),
+		)
+	}
+
+	t.Totali = []Cella{Testo("Totali"), Testo(fmt.Sprintf("Saldo %s", Euro(entrate-uscite))), {}, {}, Euro(entrate), Euro(uscite)}
+	if len(filtri) > 0 {
+		t.Note = append(t.Note, "Filtri attivi:")
+		t.Note = append(t.Note, filtri...)
+	}
+	return t
+}
+
+// Fatture prepara l'elenco fatture con i dati fiscali del cliente; i
+// totali sono al netto delle note di credito
+func Fatture(fatture []database.Fattura, clienti []database.Cliente) *Tabella {
+	perID := make(map[int]database.Cliente, len(clienti))
+	for _, c := range clienti {
+		perID[c.ID] = c
+	}
+
+	t := &Tabella{
+		Nome:    "Fatture",
+		Colonne: []string{"Numero", "Data", "Cliente", "Partita IVA", "Codice fiscale", "Imponibile", "IVA", "Totale", "Netto a pagare"},
+	}
+
+	var imponibile, imposta, totale, netto float64
+	for _, f := range fatture {
+		c := perID[f.ClienteID]
+		// Le note di credito sono in negativo; le proforma si elencano ma
+		// non entrano nei totali
+		segno := 1.0
+		if f.TipoDocumento() == database.TipoDocumentoNotaCredito {
+			segno = -1
+		}
+		fiscale := f.TipoDocumento() != database.TipoDocumentoProforma
+		if fiscale {
+			totale += segno * f.Importo
+		}
+		// Il netto esclude l'IVA in scissione dei pagamenti e la ritenuta
+		netto += f.Credito()
+		// Le fatture senza righe hanno solo il totale
+		imp, iva := Cella{}, Cella{}
+		if len(f.Righe) > 0 {
+			imp, iva = Euro(segno*f.Imponibile), Euro(segno*f.Imposta)
+			if fiscale {
+				imponibile += segno * f.Imponibile
+				imposta += segno * f.Imposta
+			}
+		}
+		t.Aggiungi(
+			Testo(f.Numero), Data(f.Data), Testo(c.RagioneSociale), Testo(c.PartitaIVA),
+			Testo(c.CodiceFiscale), imp, iva, Euro(segno*f.Importo), Euro(segno*f.NettoAPagare()),
+		)
+	}
+
+	if len(fatture) > 0 {
+		t.Totali = []Cella{Testo(fmt.Sprintf("Totale (%d)", len(fatture))), {}, {}, {}, {}, Euro(imponibile), Euro(imposta), Euro(totale), Euro(netto)}
+	}
+	return t
+}
+
+func nomiClienti(clienti []database.Cliente) map[int]string {
+	nomi := make(map[int]string, len(clienti))
+	for _, c := range clienti {
+		nomi[c.ID] = c.RagioneSociale
+	}
+	return nomi
+}
@@ -0,0 +1,248 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Stili definiti in xlsxStyles, nell'ordine di cellXfs
+const (
+	stileNormale = iota
+	stileIntestazione
+	stileEuro
+	stileData
+	stileIntero
+	stileTotaleEuro
+	stileTotaleTesto
+)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="&quot;€&quot; #,##0.00"/><numFmt numFmtId="165" formatCode="dd/mm/yyyy"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill><fill><patternFill patternType="solid"><fgColor rgb="FFD9E1F2"/></patternFill></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="7">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="1" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="1" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" applyFont="1"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+</cellXfs>
+</styleSheet>`
+
+// WriteXLSX scrive la tabella come cartella di lavoro Excel con un solo
+// foglio: intestazione in grassetto e bloccata, filtro automatico, importi
+// e date come valori numerici formattati
+func WriteXLSX(w io.Writer, t *Tabella) error {
+	zw := zip.NewWriter(w)
+
+	parti := []struct {
+		nome      string
+		contenuto string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook(t.Nome)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+		{"xl/worksheets/sheet1.xml", xlsxSheet(t)},
+	}
+
+	for _, p := range parti {
+		f, err := zw.Create(p.nome)
+		if err != nil {
+			return fmt.Errorf("errore scrittura XLSX: %w", err)
+		}
+		if _, err := io.WriteString(f, p.contenuto); err != nil {
+			return fmt.Errorf("errore scrittura XLSX: %w", err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("errore scrittura XLSX: %w", err)
+	}
+	return nil
+}
+
+func xlsxWorkbook(nome string) string {
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="` + xmlEscape(nomeFoglio(nome)) + `" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+}
+
+// nomeFoglio rispetta i vincoli di Excel: massimo 31 caratteri, senza []:*?/\
+func nomeFoglio(nome string) string {
+	nome = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, nome)
+	if nome == "" {
+		nome = "Export"
+	}
+	if utf8.RuneCountInString(nome) > 31 {
+		nome = string([]rune(nome)[:31])
+	}
+	return nome
+}
+
+func xlsxSheet(t *Tabella) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>
+`)
+
+	if len(t.Colonne) > 0 {
+		b.WriteString("<cols>")
+		for i, w := range larghezzeColonne(t) {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, w)
+		}
+		b.WriteString("</cols>\n")
+	}
+
+	b.WriteString("<sheetData>\n")
+	riga := 1
+
+	intestazione := make([]Cella, len(t.Colonne))
+	for i, c := range t.Colonne {
+		intestazione[i] = Testo(c)
+	}
+	scriviRigaXLSX(&b, riga, intestazione, true)
+
+	for _, celle := range t.Righe {
+		riga++
+		scriviRigaXLSX(&b, riga, celle, false)
+	}
+	ultimaDati := riga
+
+	if len(t.Totali) > 0 {
+		riga++
+		scriviRigaXLSX(&b, riga, t.Totali, true)
+	}
+	if len(t.Note) > 0 {
+		riga++
+		for _, nota := range t.Note {
+			riga++
+			scriviRigaXLSX(&b, riga, []Cella{Testo(nota)}, false)
+		}
+	}
+	b.WriteString("</sheetData>\n")
+
+	if len(t.Colonne) > 0 {
+		fmt.Fprintf(&b, `<autoFilter ref="A1:%s%d"/>`+"\n", colonnaXLSX(len(t.Colonne)-1), ultimaDati)
+	}
+	b.WriteString("</worksheet>")
+	return b.String()
+}
+
+// scriviRigaXLSX scrive una riga; grassetto è usato per intestazione e totali
+func scriviRigaXLSX(b *strings.Builder, riga int, celle []Cella, grassetto bool) {
+	fmt.Fprintf(b, `<row r="%d">`, riga)
+	for i, c := range celle {
+		ref := colonnaXLSX(i) + strconv.Itoa(riga)
+
+		switch c.tipo {
+		case cellaEuro:
+			stile := stileEuro
+			if grassetto {
+				stile = stileTotaleEuro
+			}
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, stile, strconv.FormatFloat(c.numero, 'f', 2, 64))
+		case cellaIntero:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, stileIntero, int(c.numero))
+		case cellaData:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, stileData, strconv.FormatFloat(serialeExcel(c.data), 'f', -1, 64))
+		default:
+			if c.testo == "" {
+				continue
+			}
+			stile := stileNormale
+			if grassetto {
+				stile = stileTotaleTesto
+				if riga == 1 {
+					stile = stileIntestazione
+				}
+			}
+			fmt.Fprintf(b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, stile, xmlEscape(c.testo))
+		}
+	}
+	b.WriteString("</row>\n")
+}
+
+// serialeExcel converte una data nel numero di giorni dal 30/12/1899
+func serialeExcel(t time.Time) float64 {
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	giorno := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return giorno.Sub(base).Hours() / 24
+}
+
+// colonnaXLSX converte un indice (da 0) nella lettera di colonna: A, B, ..., AA
+func colonnaXLSX(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
+
+// larghezzeColonne stima la larghezza delle colonne dal contenuto
+func larghezzeColonne(t *Tabella) []int {
+	w := make([]int, len(t.Colonne))
+	for i, c := range t.Colonne {
+		w[i] = utf8.RuneCountInString(c) + 4 // spazio per la freccia del filtro
+	}
+	for _, riga := range t.Righe {
+		for i, c := range riga {
+			if i < len(w) {
+				if n := utf8.RuneCountInString(c.String()) + 2; n > w[i] {
+					w[i] = n
+				}
+			}
+		}
+	}
+	for i := range w {
+		if w[i] > 60 {
+			w[i] = 60
+		}
+	}
+	return w
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,258 @@
+package fatturapa
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"officina/utils"
+)
+
+// Controlli sui contenuti che lo SDI applica dopo lo schema. Ogni problema
+// riporta il codice dello scarto indicato nelle specifiche tecniche, così
+// che un errore trovato qui corrisponda a quello che restituirebbe lo SDI.
+const (
+	ScartoIdCedente          = "00301" // IdFiscaleIVA del cedente non valido
+	ScartoIdCessionario      = "00305" // IdFiscaleIVA del cessionario non valido
+	ScartoCFCessionario      = "00306" // CodiceFiscale del cessionario non valido
+	ScartoNaturaMancante     = "00400" // linea con aliquota zero senza natura
+	ScartoNaturaNonAmmessa   = "00401" // linea con natura e aliquota diversa da zero
+	ScartoDataFutura         = "00403" // data della fattura successiva alla ricezione
+	ScartoDatiRitenuta       = "00411" // linee soggette a ritenuta senza DatiRitenuta
+	ScartoIdentificativi     = "00417" // cessionario senza IdFiscaleIVA né CodiceFiscale
+	ScartoRiepilogoMancante  = "00419" // aliquota o natura delle linee senza riepilogo
+	ScartoEsigibilitaNatura  = "00420" // natura N6.x con scissione dei pagamenti
+	ScartoImposta            = "00421" // imposta diversa da imponibile × aliquota
+	ScartoImponibile         = "00422" // imponibile diverso dalla somma delle linee
+	ScartoPrezzoTotale       = "00423" // prezzo totale diverso da quantità × prezzo
+	ScartoAliquota           = "00424" // aliquota non espressa in percentuale
+	ScartoNumero             = "00425" // numero della fattura senza cifre
+	ScartoPECDestinatario    = "00426" // PEC indicata con un codice destinatario
+	ScartoCodiceDestinatario = "00427" // codice destinatario di lunghezza errata
+	ScartoNaturaRiepilogo    = "00429" // riepilogo con aliquota zero senza natura
+	ScartoNaturaRiepilogoIVA = "00430" // riepilogo con natura e aliquota diversa da zero
+	ScartoAutofattura        = "00471" // cedente e cessionario coincidono
+)
+
+// Tolleranze dello SDI sul ricalcolo degli importi
+const (
+	tolleranzaImporto    = 0.01
+	tolleranzaImponibile = 1.00
+)
+
+// tipiCedenteDiverso sono i documenti in cui cedente e cessionario non
+// possono coincidere
+var tipiCedenteDiverso = map[string]bool{
+	"TD01": true, "TD02": true, "TD03": true, "TD06": true, "TD24": true, "TD25": true,
+}
+
+// ControllaSDI applica al documento i controlli sui contenuti dello SDI
+func ControllaSDI(fe *FatturaElettronica) []Problema {
+	var problemi []Problema
+	add := func(codice, percorso, format string, args ...interface{}) {
+		problemi = append(problemi, Problema{
+			Campo:     campoDaPercorso(percorso),
+			Messaggio: fmt.Sprintf(format, args...),
+			Percorso:  percorso,
+			Codice:    codice,
+		})
+	}
+
+	const (
+		trasmissione = "FatturaElettronicaHeader/DatiTrasmissione"
+		cedente      = "FatturaElettronicaHeader/CedentePrestatore/DatiAnagrafici"
+		cessionario  = "FatturaElettronicaHeader/CessionarioCommittente/DatiAnagrafici"
+	)
+
+	// Trasmissione
+	t := fe.Header.DatiTrasmissione
+	lunghezza := 7
+	if t.FormatoTrasmissione == "FPA12" {
+		lunghezza = 6
+	}
+	if len(t.CodiceDestinatario) != lunghezza {
+		add(ScartoCodiceDestinatario, trasmissione+"/CodiceDestinatario",
+			"il codice destinatario deve avere %d caratteri per il formato %s", lunghezza, t.FormatoTrasmissione)
+	}
+	if t.PECDestinatario != "" && t.CodiceDestinatario != DestinatarioSenzaCodice {
+		add(ScartoPECDestinatario, trasmissione+"/PECDestinatario",
+			"la PEC del destinatario si indica solo con codice destinatario %s", DestinatarioSenzaCodice)
+	}
+
+	// Cedente e cessionario
+	ced := fe.Header.CedentePrestatore.DatiAnagrafici
+	if id := ced.IdFiscaleIVA; id != nil && id.IdPaese == "IT" {
+		if !partitaIVAValida(id.IdCodice) {
+			add(ScartoIdCedente, cedente+"/IdFiscaleIVA/IdCodice", "partita IVA del cedente %s non valida", id.IdCodice)
+		}
+	}
+	ces := fe.Header.CessionarioCommittente.DatiAnagrafici
+	if ces.IdFiscaleIVA == nil && ces.CodiceFiscale == "" {
+		add(ScartoIdentificativi, cessionario, "il cessionario deve avere partita IVA o codice fiscale")
+	}
+	if id := ces.IdFiscaleIVA; id != nil && id.IdPaese == "IT" {
+		if !partitaIVAValida(id.IdCodice) {
+			add(ScartoIdCessionario, cessionario+"/IdFiscaleIVA/IdCodice", "partita IVA del cessionario %s non valida", id.IdCodice)
+		}
+	}
+	if cf := ces.CodiceFiscale; cf != "" {
+		valido := partitaIVAValida(cf)
+		if len(cf) != 11 {
+			valido = utils.ValidateCodiceFiscale(cf) == nil
+		}
+		if !valido {
+			add(ScartoCFCessionario, cessionario+"/CodiceFiscale", "codice fiscale del cessionario %s non valido", cf)
+		}
+	}
+	stessoSoggetto := ced.IdFiscaleIVA != nil && ces.IdFiscaleIVA != nil && *ced.IdFiscaleIVA == *ces.IdFiscaleIVA
+
+	oggi := time.Now().Format("2006-01-02")
+	for b, body := range fe.Body {
+		corpo := fmt.Sprintf("FatturaElettronicaBody[%d]", b+1)
+		doc := body.DatiGenerali.DatiGeneraliDocumento
+		percorsoDoc := corpo + "/DatiGenerali/DatiGeneraliDocumento"
+
+		if stessoSoggetto && tipiCedenteDiverso[doc.TipoDocumento] {
+			add(ScartoAutofattura, cessionario+"/IdFiscaleIVA",
+				"cedente e cessionario coincidono, non ammesso per il tipo documento %s", doc.TipoDocumento)
+		}
+		if !strings.ContainsAny(doc.Numero, "0123456789") {
+			add(ScartoNumero, percorsoDoc+"/Numero", "il numero della fattura deve contenere almeno una cifra")
+		}
+		if doc.Data > oggi {
+			add(ScartoDataFutura, percorsoDoc+"/Data", "la data %s è successiva a oggi", doc.Data)
+		}
+
+		// Linee: prezzo totale, aliquota e natura; i totali per aliquota
+		// servono al confronto con il riepilogo
+		beni := corpo + "/DatiBeniServizi"
+		totali := map[string]float64{}
+		for i, l := range body.DatiBeniServizi.DettaglioLinee {
+			linea := fmt.Sprintf("%s/DettaglioLinee[%d]", beni, i+1)
+			aliquota := numero(l.AliquotaIVA)
+
+			controllaAliquota(aliquota, l.Natura, linea, ScartoNaturaMancante, ScartoNaturaNonAmmessa, add)
+			if l.Ritenuta == RitenutaSI && len(doc.DatiRitenuta) == 0 {
+				add(ScartoDatiRitenuta, linea+"/Ritenuta",
+					"la linea è soggetta a ritenuta ma il documento non ha i dati della ritenuta")
+			}
+
+			quantita := 1.0
+			if l.Quantita != "" {
+				quantita = numero(l.Quantita)
+			}
+			atteso := quantita * numero(l.PrezzoUnitario)
+			for _, s := range l.ScontoMaggiorazione {
+				segno := -1.0
+				if s.Tipo == "MG" {
+					segno = 1
+				}
+				switch {
+				case s.Importo != "":
+					atteso += segno * numero(s.Importo) * quantita
+				case s.Percentuale != "":
+					atteso += segno * atteso * numero(s.Percentuale) / 100
+				default:
+					add("", linea+"/ScontoMaggiorazione", "sconto senza percentuale né importo")
+				}
+			}
+			if totale := numero(l.PrezzoTotale); math.Abs(totale-atteso) > tolleranzaImporto+1e-9 {
+				add(ScartoPrezzoTotale, linea+"/PrezzoTotale",
+					"prezzo totale %s diverso da quantità per prezzo unitario (%.2f)", l.PrezzoTotale, atteso)
+			}
+			totali[chiaveIVA(aliquota, l.Natura)] += numero(l.PrezzoTotale)
+		}
+
+		// Riepilogo: un blocco per ogni aliquota e natura delle linee,
+		// con imponibile e imposta coerenti
+		riepiloghi := map[string]bool{}
+		for i, r := range body.DatiBeniServizi.DatiRiepilogo {
+			riepilogo := fmt.Sprintf("%s/DatiRiepilogo[%d]", beni, i+1)
+			aliquota := numero(r.AliquotaIVA)
+			chiave := chiaveIVA(aliquota, r.Natura)
+			riepiloghi[chiave] = true
+
+			controllaAliquota(aliquota, r.Natura, riepilogo, ScartoNaturaRiepilogo, ScartoNaturaRiepilogoIVA, add)
+
+			if strings.HasPrefix(r.Natura, "N6") && r.EsigibilitaIVA == "S" {
+				add(ScartoEsigibilitaNatura, riepilogo+"/EsigibilitaIVA",
+					"la natura %s (inversione contabile) non ammette la scissione dei pagamenti", r.Natura)
+			}
+			imponibile := numero(r.ImponibileImporto)
+			if math.Abs(imponibile-totali[chiave]) > tolleranzaImponibile+1e-9 {
+				add(ScartoImponibile, riepilogo+"/ImponibileImporto",
+					"imponibile %s diverso dalla somma delle linee (%.2f)", r.ImponibileImporto, totali[chiave])
+			}
+			imposta := math.Round(imponibile*aliquota) / 100
+			if math.Abs(numero(r.Imposta)-imposta) > tolleranzaImporto+1e-9 {
+				add(ScartoImposta, riepilogo+"/Imposta",
+					"imposta %s diversa da imponibile per aliquota (%.2f)", r.Imposta, imposta)
+			}
+		}
+		for chiave := range totali {
+			if !riepiloghi[chiave] {
+				add(ScartoRiepilogoMancante, beni+"/DatiRiepilogo",
+					"manca il riepilogo per %s", descriviChiave(chiave))
+			}
+		}
+	}
+	return problemi
+}
+
+// controllaAliquota verifica la coerenza tra aliquota e natura di una linea
+// o di un riepilogo
+func controllaAliquota(aliquota float64, natura, percorso, scartoMancante, scartoNonAmmessa string, add func(codice, percorso, format string, args ...interface{})) {
+	switch {
+	case aliquota > 0 && aliquota < 1:
+		add(ScartoAliquota, percorso+"/AliquotaIVA", "aliquota %.2f non espressa in percentuale", aliquota)
+	case aliquota == 0 && natura == "":
+		add(scartoMancante, percorso+"/Natura", "con aliquota zero la natura è obbligatoria")
+	case aliquota != 0 && natura != "":
+		add(scartoNonAmmessa, percorso+"/Natura", "natura %s indicata con aliquota %.2f", natura, aliquota)
+	}
+}
+
+// chiaveIVA raggruppa linee e riepiloghi per aliquota e natura
+func chiaveIVA(aliquota float64, natura string) string {
+	return strconv.FormatFloat(aliquota, 'f', 2, 64) + "|" + natura
+}
+
+func descriviChiave(chiave string) string {
+	aliquota, natura, _ := strings.Cut(chiave, "|")
+	if natura != "" {
+		return "la natura " + natura
+	}
+	return "l'aliquota " + aliquota + "%"
+}
+
+// partitaIVAValida controlla formato e cifra di controllo di una partita
+// IVA italiana; lo SDI la verifica anche in anagrafe tributaria, cosa che
+// senza rete non si può fare
+func partitaIVAValida(piva string) bool {
+	if len(piva) != 11 {
+		return false
+	}
+	somma := 0
+	for i, r := range piva[:10] {
+		if r < '0' || r > '9' {
+			return false
+		}
+		d := int(r - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		somma += d
+	}
+	return piva[10] >= '0' && piva[10] <= '9' && (10-somma%10)%10 == int(piva[10]-'0')
+}
+
+// numero legge un importo del tracciato; i valori non numerici sono già
+// segnalati dallo schema
+func numero(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return v
+}
@@ -0,0 +1,496 @@
+// Package fatturapa genera le fatture elettroniche nel formato FatturaPA
+// 1.2 per i privati (FPR12) da trasmettere al Sistema di Interscambio: il
+// file IT<partita IVA>_<progressivo>.xml con trasmissione, cedente,
+// cessionario, dati generali, righe, riepilogo IVA e pagamento. Prima di
+// generare il file Controlla elenca i dati obbligatori mancanti; il file
+// generato è poi verificato senza rete con lo schema del tracciato
+// (ValidaXML) e con i controlli sui contenuti dello SDI (ControllaSDI).
+// Le fatture ricevute dai fornitori, anche firmate (.p7m), sono lette da
+// LeggiAcquisti e registrate in prima nota da ImportaCartella.
+package fatturapa
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"officina/database"
+	"officina/utils"
+)
+
+// Codici del tracciato usati nei documenti dell'officina; il tipo documento
+// è quello della fattura (database.TipoDocumento*)
+const (
+	DestinatarioSenzaCodice = "0000000" // consegna via PEC o nel cassetto fiscale
+	PagamentoRate           = "TP01"
+	PagamentoCompleto       = "TP02"
+	ModalitaContanti        = "MP01"
+	ModalitaBonifico        = "MP05"
+	EsigibilitaImmediata    = "I"
+	EsigibilitaScissione    = "S" // scissione dei pagamenti
+	RitenutaSI              = "SI"
+	LiquidazioneNo          = "LN" // società non in liquidazione
+)
+
+// Problema è un dato mancante o non valido per la fattura elettronica.
+// Campo indica il dato nella forma "fattura.numero", "cliente.cap",
+// "profilo.partita_iva" o "righe[0].descrizione" (righe numerate da zero),
+// così che le schermate possano ricondurlo al campo da correggere. I
+// problemi trovati sul file XML indicano anche l'elemento (Percorso) e, per
+// i controlli dello SDI, il codice dello scarto (Codice).
+type Problema struct {
+	Campo     string `json:"campo"`
+	Messaggio string `json:"messaggio"`
+	Percorso  string `json:"percorso,omitempty"`
+	Codice    string `json:"codice,omitempty"`
+}
+
+func (p Problema) String() string {
+	if p.Codice != "" {
+		return p.Campo + ": [" + p.Codice + "] " + p.Messaggio
+	}
+	return p.Campo + ": " + p.Messaggio
+}
+
+// ErroreControllo è restituito quando la fattura ha dati da correggere
+type ErroreControllo struct {
+	Problemi []Problema
+}
+
+func (e *ErroreControllo) Error() string {
+	if len(e.Problemi) == 1 {
+		return "fattura elettronica non generabile: " + e.Problemi[0].String()
+	}
+	return fmt.Sprintf("fattura elettronica non generabile: %d dati da correggere", len(e.Problemi))
+}
+
+// Controlla verifica che fattura, cliente e profilo dell'officina contengano
+// i dati obbligatori del tracciato; c è nil se il cliente non esiste
+func Controlla(f *database.Fattura, c *database.Cliente, p *database.ProfiloAzienda) []Problema {
+	var problemi []Problema
+	add := func(campo, format string, args ...interface{}) {
+		problemi = append(problemi, Problema{Campo: campo, Messaggio: fmt.Sprintf(format, args...)})
+	}
+	obbligatorio := func(campo, valore, nome string) {
+		if strings.TrimSpace(valore) == "" {
+			add(campo, "%s obbligatorio", nome)
+		}
+	}
+
+	// Cedente: il profilo dell'officina
+	obbligatorio("profilo.ragione_sociale", p.RagioneSociale, "ragione sociale dell'officina")
+	if p.PartitaIVA == "" {
+		add("profilo.partita_iva", "partita IVA dell'officina obbligatoria")
+	} else if err := utils.ValidatePartitaIVA(p.PartitaIVA); err != nil {
+		add("profilo.partita_iva", "%v", err)
+	}
+	if !database.IsValidRegimeFiscale(p.RegimeFiscale) {
+		add("profilo.regime_fiscale", "regime fiscale non valido: %q", p.RegimeFiscale)
+	}
+	controllaSede("profilo", p.Indirizzo, p.CAP, p.Citta, p.Provincia, add)
+	if p.REANumero != "" && len(p.REAUfficio) != 2 {
+		add("profilo.rea_ufficio", "ufficio REA deve essere la sigla della provincia")
+	}
+
+	// Cessionario
+	if c == nil {
+		add("fattura.cliente_id", "cliente non indicato o inesistente")
+	} else {
+		obbligatorio("cliente.ragione_sociale", c.RagioneSociale, "ragione sociale del cliente")
+		if c.PartitaIVA == "" && c.CodiceFiscale == "" {
+			add("cliente.partita_iva", "indicare partita IVA o codice fiscale del cliente")
+		}
+		if c.PartitaIVA != "" {
+			if err := utils.ValidatePartitaIVA(c.PartitaIVA); err != nil {
+				add("cliente.partita_iva", "%v", err)
+			}
+		}
+		// Le società hanno un codice fiscale numerico
+		if len(c.CodiceFiscale) == 11 {
+			if err := utils.ValidatePartitaIVA(c.CodiceFiscale); err != nil {
+				add("cliente.codice_fiscale", "codice fiscale numerico non valido: %v", err)
+			}
+		} else if c.CodiceFiscale != "" {
+			if err := utils.ValidateCodiceFiscale(c.CodiceFiscale); err != nil {
+				add("cliente.codice_fiscale", "%v", err)
+			}
+		}
+		if c.CodiceDestinatario != "" && !alfanumerico(c.CodiceDestinatario, 7) {
+			add("cliente.codice_destinatario", "codice destinatario deve avere 7 caratteri alfanumerici")
+		}
+		controllaSede("cliente", c.Indirizzo, c.CAP, c.Citta, c.Provincia, add)
+		// In inversione contabile l'imposta è dovuta dal cliente
+		if database.InversioneContabile(f.RegimeIVA) && c.PartitaIVA == "" {
+			add("cliente.partita_iva", "l'inversione contabile richiede la partita IVA del cliente")
+		}
+	}
+
+	// Documento
+	switch f.TipoDocumento() {
+	case database.TipoDocumentoProforma:
+		add("fattura.tipo", "la proforma non è un documento fiscale: per la fattura elettronica emettere la fattura")
+	case database.TipoDocumentoNotaCredito:
+		if strings.TrimSpace(f.RiferimentoNumero) == "" || f.RiferimentoData.IsZero() {
+			add("fattura.riferimento", "numero e data della fattura stornata obbligatori")
+		}
+	}
+	if strings.TrimSpace(f.Numero) == "" {
+		add("fattura.numero", "numero fattura obbligatorio")
+	} else if !strings.ContainsAny(f.Numero, "0123456789") {
+		add("fattura.numero", "il numero fattura deve contenere almeno una cifra")
+	}
+	if f.Data.IsZero() {
+		add("fattura.data", "data obbligatoria")
+	} else if f.Data.After(time.Now()) {
+		add("fattura.data", "la data non può essere futura")
+	}
+	if len(f.Righe) == 0 {
+		add("fattura.righe", "la fattura non ha righe di dettaglio")
+	}
+	for i, r := range f.Righe {
+		if err := r.Validate(); err != nil {
+			add(fmt.Sprintf("righe[%d]", i), "riga %d: %v", i+1, err)
+		}
+	}
+
+	return problemi
+}
+
+// controllaSede verifica l'indirizzo di cedente o cessionario
+func controllaSede(soggetto, indirizzo, cap, citta, provincia string, add func(campo, format string, args ...interface{})) {
+	if strings.TrimSpace(indirizzo) == "" {
+		add(soggetto+".indirizzo", "indirizzo obbligatorio")
+	}
+	if cap == "" {
+		add(soggetto+".cap", "CAP obbligatorio")
+	} else if err := utils.ValidateCAP(cap); err != nil {
+		add(soggetto+".cap", "%v", err)
+	}
+	if strings.TrimSpace(citta) == "" {
+		add(soggetto+".citta", "comune obbligatorio")
+	}
+	if provincia != "" && !alfanumerico(provincia, 2) {
+		add(soggetto+".provincia", "provincia deve essere la sigla di due lettere")
+	}
+}
+
+// Genera costruisce la fattura elettronica; progressivo è il progressivo
+// di invio che compare anche nel nome del file (vedi Progressivo). Se
+// mancano dati obbligatori restituisce un *ErroreControllo.
+func Genera(f *database.Fattura, c *database.Cliente, p *database.ProfiloAzienda, progressivo string) (*FatturaElettronica, error) {
+	if problemi := Controlla(f, c, p); len(problemi) > 0 {
+		return nil, &ErroreControllo{problemi}
+	}
+
+	// I totali sono ricalcolati dalle righe, come al salvataggio
+	doc := *f
+	doc.Calcola()
+
+	fe := &FatturaElettronica{
+		Versione:       FormatoPrivati,
+		XmlnsDs:        NamespaceFirma,
+		XmlnsP:         NamespaceFatturaPA,
+		XmlnsXsi:       NamespaceXSI,
+		SchemaLocation: SchemaLocation,
+	}
+
+	trasmissione := DatiTrasmissione{
+		IdTrasmittente:      IdFiscale{"IT", idTrasmittente(p)},
+		ProgressivoInvio:    progressivo,
+		FormatoTrasmissione: FormatoPrivati,
+		CodiceDestinatario:  strings.ToUpper(c.CodiceDestinatario),
+	}
+	if trasmissione.CodiceDestinatario == "" {
+		trasmissione.CodiceDestinatario = DestinatarioSenzaCodice
+		trasmissione.PECDestinatario = c.PEC
+	}
+	fe.Header.DatiTrasmissione = trasmissione
+
+	nazione := p.Nazione
+	if nazione == "" {
+		nazione = "IT"
+	}
+	cedente := CedentePrestatore{
+		DatiAnagrafici: DatiAnagrafici{
+			IdFiscaleIVA:  &IdFiscale{"IT", p.PartitaIVA},
+			CodiceFiscale: strings.ToUpper(p.CodiceFiscale),
+			Anagrafica:    Anagrafica{Denominazione: testo(p.RagioneSociale, 80)},
+			RegimeFiscale: p.RegimeFiscale,
+		},
+		Sede: Indirizzo{Indirizzo: testo(p.Indirizzo, 60), CAP: p.CAP, Comune: testo(p.Citta, 60), Provincia: strings.ToUpper(p.Provincia), Nazione: nazione},
+	}
+	if p.REANumero != "" {
+		cedente.IscrizioneREA = &IscrizioneREA{strings.ToUpper(p.REAUfficio), testo(p.REANumero, 20), LiquidazioneNo}
+	}
+	if p.Telefono != "" || p.Email != "" {
+		cedente.Contatti = &Contatti{testo(p.Telefono, 12), testo(p.Email, 256)}
+	}
+	fe.Header.CedentePrestatore = cedente
+
+	cessionario := CessionarioCommittente{
+		DatiAnagrafici: DatiAnagrafici{
+			CodiceFiscale: strings.ToUpper(c.CodiceFiscale),
+			Anagrafica:    Anagrafica{Denominazione: testo(c.RagioneSociale, 80)},
+		},
+		Sede: Indirizzo{Indirizzo: testo(c.Indirizzo, 60), CAP: c.CAP, Comune: testo(c.Citta, 60), Provincia: strings.ToUpper(c.Provincia), Nazione: "IT"},
+	}
+	if c.PartitaIVA != "" {
+		cessionario.DatiAnagrafici.IdFiscaleIVA = &IdFiscale{"IT", c.PartitaIVA}
+	}
+	fe.Header.CessionarioCommittente = cessionario
+
+	body := FatturaElettronicaBody{
+		DatiGenerali: DatiGenerali{DatiGeneraliDocumento: DatiGeneraliDocumento{
+			TipoDocumento:          doc.TipoDocumento(),
+			Divisa:                 "EUR",
+			Data:                   doc.Data.Format("2006-01-02"),
+			Numero:                 testo(doc.Numero, 20),
+			ImportoTotaleDocumento: importo(doc.Importo),
+		}},
+	}
+	if doc.RitenutaTipo != "" {
+		body.DatiGenerali.DatiGeneraliDocumento.DatiRitenuta = []DatiRitenuta{{
+			TipoRitenuta:     doc.RitenutaTipo,
+			ImportoRitenuta:  importo(doc.Ritenuta),
+			AliquotaRitenuta: importo(doc.RitenutaAliquota),
+			CausalePagamento: doc.RitenutaCausale,
+		}}
+	}
+	// La nota di credito richiama la fattura che storna
+	causale := &body.DatiGenerali.DatiGeneraliDocumento.Causale
+	if doc.TipoDocumento() == database.TipoDocumentoNotaCredito {
+		rif := doc.RiferimentoData.Format("2006-01-02")
+		*causale = append(*causale, testo(fmt.Sprintf("Storno fattura n. %s del %s",
+			doc.RiferimentoNumero, doc.RiferimentoData.Format("02/01/2006")), 200))
+		body.DatiGenerali.DatiFattureCollegate = []DatiDocumentiCorrelati{{IdDocumento: testo(doc.RiferimentoNumero, 20), Data: rif}}
+	}
+	// Le diciture obbligatorie di regime IVA e ritenuta
+	for _, nota := range doc.Annotazioni() {
+		*causale = append(*causale, testo(nota, 200))
+	}
+
+	for i, r := range doc.Righe {
+		aliquota, natura := doc.IVARiga(r)
+		linea := DettaglioLinee{
+			NumeroLinea:    i + 1,
+			Descrizione:    testo(r.Descrizione, 1000),
+			Quantita:       decimali(r.Quantita),
+			PrezzoUnitario: decimali(r.PrezzoUnitario),
+			PrezzoTotale:   importo(r.Imponibile()),
+			AliquotaIVA:    importo(aliquota),
+			Natura:         natura,
+		}
+		if doc.SoggettaRitenuta(r) {
+			linea.Ritenuta = RitenutaSI
+		}
+		if r.Sconto != 0 {
+			linea.ScontoMaggiorazione = []ScontoMaggiorazione{{Tipo: "SC", Percentuale: importo(r.Sconto)}}
+		}
+		body.DatiBeniServizi.DettaglioLinee = append(body.DatiBeniServizi.DettaglioLinee, linea)
+	}
+
+	for _, r := range doc.Riepilogo {
+		riepilogo := DatiRiepilogo{
+			AliquotaIVA:       importo(r.AliquotaIVA),
+			Natura:            r.Natura,
+			ImponibileImporto: importo(r.Imponibile),
+			Imposta:           importo(r.Imposta),
+		}
+		switch {
+		case r.Natura == "" && doc.RegimeIVA == database.RegimeIVAScissione:
+			riepilogo.EsigibilitaIVA = EsigibilitaScissione
+		case r.Natura == "":
+			riepilogo.EsigibilitaIVA = EsigibilitaImmediata
+		default:
+			riepilogo.RiferimentoNormativo = testo(database.DescrizioneNaturaIVA(r.Natura), 100)
+		}
+		body.DatiBeniServizi.DatiRiepilogo = append(body.DatiBeniServizi.DatiRiepilogo, riepilogo)
+	}
+
+	// Con l'IBAN nel profilo il pagamento è per bonifico, altrimenti in
+	// contanti; le condizioni a fine mese indicano la scadenza di ogni rata.
+	// L'importo è il netto a pagare, senza IVA in scissione e ritenuta.
+	dettaglio := func(importoRata float64) DettaglioPagamento {
+		pagamento := DettaglioPagamento{ModalitaPagamento: ModalitaContanti, ImportoPagamento: importo(importoRata)}
+		if p.IBAN != "" {
+			pagamento.ModalitaPagamento = ModalitaBonifico
+			pagamento.IstitutoFinanziario = testo(p.Banca, 80)
+			pagamento.IBAN = strings.ToUpper(strings.ReplaceAll(p.IBAN, " ", ""))
+		}
+		return pagamento
+	}
+	pagamento := DatiPagamento{PagamentoCompleto, []DettaglioPagamento{dettaglio(doc.NettoAPagare())}}
+	if scadenze := doc.Scadenze(); len(scadenze) > 0 && doc.Pagamento != "" && doc.Pagamento != database.PagamentoImmediato {
+		pagamento.DettaglioPagamento = nil
+		for _, s := range scadenze {
+			d := dettaglio(s.Importo)
+			d.DataScadenzaPagamento = s.Data.Format("2006-01-02")
+			pagamento.DettaglioPagamento = append(pagamento.DettaglioPagamento, d)
+		}
+		if len(scadenze) > 1 {
+			pagamento.CondizioniPagamento = PagamentoRate
+		}
+	}
+	body.DatiPagamento = []DatiPagamento{pagamento}
+
+	fe.Body = []FatturaElettronicaBody{body}
+	return fe, nil
+}
+
+// XML restituisce il file con la dichiarazione XML iniziale
+func (fe *FatturaElettronica) XML() ([]byte, error) {
+	data, err := xml.MarshalIndent(fe, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("errore generazione XML: %w", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// Progressivo converte il contatore degli invii nel progressivo del nome
+// file: cinque caratteri alfanumerici (base 36), da 00001 a ZZZZZ
+func Progressivo(n int) string {
+	s := strings.ToUpper(strconv.FormatInt(int64(n), 36))
+	if len(s) < 5 {
+		s = strings.Repeat("0", 5-len(s)) + s
+	}
+	return s
+}
+
+// idTrasmittente restituisce il codice del trasmittente: il codice fiscale
+// dell'officina se indicato, altrimenti la partita IVA
+func idTrasmittente(p *database.ProfiloAzienda) string {
+	if p.CodiceFiscale != "" {
+		return strings.ToUpper(p.CodiceFiscale)
+	}
+	return strings.ToUpper(p.PartitaIVA)
+}
+
+// NomeFile restituisce il nome del file da trasmettere allo SDI, con lo
+// stesso identificativo di IdTrasmittente come richiesto dalle specifiche
+func NomeFile(p *database.ProfiloAzienda, progressivo string) string {
+	return "IT" + idTrasmittente(p) + "_" + progressivo + ".xml"
+}
+
+// Esporta genera la fattura elettronica della fattura id nella directory
+// dir e restituisce il percorso del file. Ogni esportazione usa un nuovo
+// progressivo di invio, perché lo SDI scarta i nomi file già ricevuti.
+func Esporta(db *database.DB, id int, dir string) (string, error) {
+	f, err := db.GetFattura(id)
+	if err != nil {
+		return "", err
+	}
+	var c *database.Cliente
+	if f.ClienteID > 0 {
+		c, err = db.GetCliente(f.ClienteID)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return "", err
+		}
+	}
+	p, err := db.GetProfiloAzienda()
+	if err != nil {
+		return "", err
+	}
+
+	if problemi := Controlla(f, c, p); len(problemi) > 0 {
+		return "", &ErroreControllo{problemi}
+	}
+
+	// Il documento è verificato prima di assegnare il progressivo, così
+	// che le fatture scartate non consumino numeri di invio
+	fe, err := Genera(f, c, p, Progressivo(0))
+	if err != nil {
+		return "", err
+	}
+	problemi, err := Verifica(fe)
+	if err != nil {
+		return "", err
+	}
+	if len(problemi) > 0 {
+		return "", &ErroreControllo{problemi}
+	}
+
+	n, err := db.IncrementaContatore(database.ContatoreProgressivoInvio)
+	if err != nil {
+		return "", err
+	}
+	fe.Header.DatiTrasmissione.ProgressivoInvio = Progressivo(n)
+	data, err := fe.XML()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("impossibile creare la directory %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, NomeFile(p, Progressivo(n)))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("errore scrittura %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// importo formatta un importo con due decimali
+func importo(v float64) string {
+	return strconv.FormatFloat(database.Arrotonda(v), 'f', 2, 64)
+}
+
+// decimali formatta quantità e prezzi unitari: almeno due decimali, fino
+// agli otto ammessi dal tracciato
+func decimali(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	intera, dec, _ := strings.Cut(s, ".")
+	if len(dec) > 8 {
+		return strconv.FormatFloat(v, 'f', 8, 64)
+	}
+	for len(dec) < 2 {
+		dec += "0"
+	}
+	return intera + "." + dec
+}
+
+// sostituzioni converte i caratteri tipografici più comuni, fuori dal
+// Latin-1 accettato dallo SDI
+var sostituzioni = strings.NewReplacer(
+	"€", "EUR", "‘", "'", "’", "'", "“", `"`, "”", `"`, "–", "-", "—", "-", "…", "...",
+)
+
+// testo prepara un valore testuale per il tracciato: caratteri Latin-1,
+// spazi al posto dei controlli, lunghezza massima in caratteri
+func testo(s string, max int) string {
+	s = sostituzioni.Replace(strings.TrimSpace(s))
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		switch {
+		case unicode.IsControl(r):
+			r = ' '
+		case r > 0xFF:
+			r = '?'
+		}
+		out = append(out, r)
+	}
+	if len(out) > max {
+		out = out[:max]
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// alfanumerico verifica lunghezza e caratteri di codici e sigle
+func alfanumerico(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) || r > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
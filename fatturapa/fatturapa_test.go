@@ -0,0 +1,328 @@
+package fatturapa
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"officina/database"
+)
+
+// esempio restituisce una fattura completa con cliente e profilo
+func esempio() (*database.Fattura, *database.Cliente, *database.ProfiloAzienda) {
+	p := database.NuovoProfiloAzienda()
+	p.RagioneSociale = "Officina Rossi S.r.l."
+	p.PartitaIVA = "12345678903"
+	p.CodiceFiscale = "12345678903"
+	p.Indirizzo = "Via Roma 1"
+	p.CAP = "00100"
+	p.Citta = "Roma"
+	p.Provincia = "RM"
+	p.REAUfficio = "RM"
+	p.REANumero = "123456"
+	p.IBAN = "IT60X0542811101000000123456"
+	p.Banca = "Banca di Roma"
+
+	c := &database.Cliente{
+		ID: 1, RagioneSociale: "Trasporti Bianchi S.p.A.", PartitaIVA: "01234567897",
+		CodiceDestinatario: "abc1234", Indirizzo: "Via Milano 2", CAP: "20100", Citta: "Milano", Provincia: "MI",
+	}
+
+	f := &database.Fattura{
+		ID: 40, Numero: "2026/0042", Data: time.Date(2026, 3, 5, 0, 0, 0, 0, time.Local), ClienteID: 1,
+		Righe: []database.RigaFattura{
+			{Descrizione: "Manodopera “tagliando”", Quantita: 2.5, PrezzoUnitario: 40, AliquotaIVA: 22},
+			{Descrizione: "Filtro olio", Quantita: 1, PrezzoUnitario: 12.9, Sconto: 10, AliquotaIVA: 22},
+			{Descrizione: "Bollo auto anticipato", Quantita: 1, PrezzoUnitario: 150.75, Natura: "N1"},
+		},
+	}
+	f.Calcola()
+	return f, c, p
+}
+
+func TestGenera(t *testing.T) {
+	f, c, p := esempio()
+
+	fe, err := Genera(f, c, p, Progressivo(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := fe.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := string(data)
+
+	for _, atteso := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<p:FatturaElettronica versione="FPR12" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" xmlns:p="http://ivaservizi.agenziaentrate.gov.it/docs/xsd/fatture/v1.2"`,
+		`<ProgressivoInvio>00016</ProgressivoInvio>`,
+		`<CodiceDestinatario>ABC1234</CodiceDestinatario>`,
+		`<IdFiscaleIVA>` + "\n" + `          <IdPaese>IT</IdPaese>` + "\n" + `          <IdCodice>12345678903</IdCodice>`,
+		`<RegimeFiscale>RF01</RegimeFiscale>`,
+		`<StatoLiquidazione>LN</StatoLiquidazione>`,
+		`<Denominazione>Trasporti Bianchi S.p.A.</Denominazione>`,
+		`<TipoDocumento>TD01</TipoDocumento>`,
+		`<Data>2026-03-05</Data>`,
+		`<Numero>2026/0042</Numero>`,
+		`<ImportoTotaleDocumento>286.91</ImportoTotaleDocumento>`,
+		`<Descrizione>Manodopera &#34;tagliando&#34;</Descrizione>`,
+		`<Quantita>2.50</Quantita>`,
+		`<PrezzoUnitario>12.90</PrezzoUnitario>`,
+		`<Percentuale>10.00</Percentuale>`,
+		`<PrezzoTotale>11.61</PrezzoTotale>`,
+		`<Natura>N1</Natura>`,
+		`<ImponibileImporto>111.61</ImponibileImporto>`,
+		`<Imposta>24.55</Imposta>`,
+		`<EsigibilitaIVA>I</EsigibilitaIVA>`,
+		`<RiferimentoNormativo>Escluse ex art. 15</RiferimentoNormativo>`,
+		`<ModalitaPagamento>MP05</ModalitaPagamento>`,
+		`<ImportoPagamento>286.91</ImportoPagamento>`,
+		`<IBAN>IT60X0542811101000000123456</IBAN>`,
+	} {
+		if !strings.Contains(xml, atteso) {
+			t.Errorf("manca %s", atteso)
+		}
+	}
+
+	// Senza codice destinatario la fattura va alla PEC del cliente
+	c.CodiceDestinatario, c.PEC = "", "bianchi@pec.it"
+	fe, _ = Genera(f, c, p, "00001")
+	if d := fe.Header.DatiTrasmissione; d.CodiceDestinatario != "0000000" || d.PECDestinatario != "bianchi@pec.it" {
+		t.Errorf("trasmissione = %+v", d)
+	}
+
+	// La nota di credito richiama la fattura stornata e supera la verifica
+	nc := *f
+	nc.Tipo, nc.Numero = database.TipoDocumentoNotaCredito, "NC-2026/0001"
+	nc.RiferimentoID, nc.RiferimentoNumero, nc.RiferimentoData = f.ID, f.Numero, f.Data
+	fe, err = Genera(&nc, c, p, "00002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problemi, err := Verifica(fe); err != nil || len(problemi) > 0 {
+		t.Errorf("Verifica() nota di credito = %v, %v", problemi, err)
+	}
+	data, _ = fe.XML()
+	for _, atteso := range []string{
+		`<TipoDocumento>TD04</TipoDocumento>`,
+		`<Causale>Storno fattura n. 2026/0042 del 05/03/2026</Causale>`,
+		`<DatiFattureCollegate>` + "\n" + `        <IdDocumento>2026/0042</IdDocumento>` + "\n" + `        <Data>2026-03-05</Data>`,
+	} {
+		if !strings.Contains(string(data), atteso) {
+			t.Errorf("nota di credito: manca %s", atteso)
+		}
+	}
+
+	// Il pagamento in rate indica la scadenza e l'importo di ciascuna
+	f.Pagamento = database.Pagamento3060FM
+	fe, err = Genera(f, c, p, "00003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problemi, err := Verifica(fe); err != nil || len(problemi) > 0 {
+		t.Errorf("Verifica() in rate = %v, %v", problemi, err)
+	}
+	pagamento := fe.Body[0].DatiPagamento[0]
+	if pagamento.CondizioniPagamento != PagamentoRate || len(pagamento.DettaglioPagamento) != 2 {
+		t.Fatalf("pagamento = %+v", pagamento)
+	}
+	if d := pagamento.DettaglioPagamento[1]; d.DataScadenzaPagamento != "2026-05-31" || d.ImportoPagamento != "143.45" {
+		t.Errorf("seconda rata = %+v", d)
+	}
+}
+
+func TestGeneraRegimi(t *testing.T) {
+	tests := []struct {
+		name    string
+		regime  func(f *database.Fattura)
+		attesi  []string
+		assenti []string
+	}{
+		{
+			name: "scissione dei pagamenti",
+			regime: func(f *database.Fattura) {
+				f.RegimeIVA = database.RegimeIVAScissione
+			},
+			attesi: []string{
+				`<EsigibilitaIVA>S</EsigibilitaIVA>`,
+				`<ImportoTotaleDocumento>286.91</ImportoTotaleDocumento>`,
+				`<ImportoPagamento>262.36</ImportoPagamento>`,
+				`<Causale>Scissione dei pagamenti ai sensi dell&#39;art. 17-ter`,
+			},
+			assenti: []string{`<EsigibilitaIVA>I</EsigibilitaIVA>`, `<DatiRitenuta>`},
+		},
+		{
+			name: "inversione contabile",
+			regime: func(f *database.Fattura) {
+				f.RegimeIVA = "N6.9"
+			},
+			attesi: []string{
+				`<AliquotaIVA>0.00</AliquotaIVA>` + "\n" + `        <Natura>N6.9</Natura>`,
+				`<ImponibileImporto>111.61</ImponibileImporto>` + "\n" + `        <Imposta>0.00</Imposta>`,
+				`<ImportoTotaleDocumento>262.36</ImportoTotaleDocumento>`,
+				`<Causale>Inversione contabile ai sensi dell&#39;art. 17`,
+			},
+			assenti: []string{`<AliquotaIVA>22.00</AliquotaIVA>`, `<EsigibilitaIVA>`},
+		},
+		{
+			name: "ritenuta d'acconto",
+			regime: func(f *database.Fattura) {
+				f.RitenutaTipo, f.RitenutaAliquota, f.RitenutaCausale = database.RitenutaPersoneFisiche, 20, "A"
+			},
+			attesi: []string{
+				`<DatiRitenuta>` + "\n" + `          <TipoRitenuta>RT01</TipoRitenuta>` + "\n" +
+					`          <ImportoRitenuta>22.32</ImportoRitenuta>` + "\n" +
+					`          <AliquotaRitenuta>20.00</AliquotaRitenuta>` + "\n" +
+					`          <CausalePagamento>A</CausalePagamento>`,
+				`<AliquotaIVA>22.00</AliquotaIVA>` + "\n" + `        <Ritenuta>SI</Ritenuta>`,
+				`<ImportoTotaleDocumento>286.91</ImportoTotaleDocumento>`,
+				`<ImportoPagamento>264.59</ImportoPagamento>`,
+			},
+			// Il bollo anticipato (N1) non è soggetto a ritenuta
+			assenti: []string{`<Ritenuta>SI</Ritenuta>` + "\n" + `        <Natura>N1</Natura>`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, c, p := esempio()
+			tt.regime(f)
+			if err := f.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			fe, err := Genera(f, c, p, Progressivo(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if problemi, err := Verifica(fe); err != nil || len(problemi) > 0 {
+				t.Errorf("Verifica() = %v, %v", problemi, err)
+			}
+			data, _ := fe.XML()
+			for _, atteso := range tt.attesi {
+				if !strings.Contains(string(data), atteso) {
+					t.Errorf("manca %s", atteso)
+				}
+			}
+			for _, assente := range tt.assenti {
+				if strings.Contains(string(data), assente) {
+					t.Errorf("presente %s", assente)
+				}
+			}
+		})
+	}
+
+	// Le linee soggette a ritenuta richiedono i dati della ritenuta
+	f, c, p := esempio()
+	f.RitenutaTipo, f.RitenutaAliquota, f.RitenutaCausale = database.RitenutaPersoneFisiche, 20, "A"
+	fe, _ := Genera(f, c, p, Progressivo(1))
+	fe.Body[0].DatiGenerali.DatiGeneraliDocumento.DatiRitenuta = nil
+	if problemi := ControllaSDI(fe); len(problemi) != 2 || problemi[0].Codice != ScartoDatiRitenuta {
+		t.Errorf("ControllaSDI() senza DatiRitenuta = %v", problemi)
+	}
+
+	// L'inversione contabile richiede la partita IVA del cliente
+	f, c, p = esempio()
+	f.RegimeIVA, c.PartitaIVA, c.CodiceFiscale = "N6.9", "", "RSSMRA80A01H501U"
+	if problemi := Controlla(f, c, p); len(problemi) != 1 || problemi[0].Campo != "cliente.partita_iva" {
+		t.Errorf("Controlla() inversione senza P.IVA = %v", problemi)
+	}
+}
+
+func TestControlla(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda)
+		campi  []string
+	}{
+		{"fattura completa", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) {}, nil},
+		{"numero mancante", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) { f.Numero = "" }, []string{"fattura.numero"}},
+		{"numero senza cifre", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) { f.Numero = "A" }, []string{"fattura.numero"}},
+		{"data futura", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) {
+			f.Data = time.Now().AddDate(0, 0, 2)
+		}, []string{"fattura.data"}},
+		{"senza righe", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) { f.Righe = nil }, []string{"fattura.righe"}},
+		{"riga non valida", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) {
+			f.Righe[1].Descrizione = ""
+		}, []string{"righe[1]"}},
+		{"proforma", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) {
+			f.Tipo = database.TipoDocumentoProforma
+		}, []string{"fattura.tipo"}},
+		{"nota di credito senza fattura", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) {
+			f.Tipo = database.TipoDocumentoNotaCredito
+		}, []string{"fattura.riferimento"}},
+		{"cliente inesistente", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) { *c = nil }, []string{"fattura.cliente_id"}},
+		{"cliente senza dati fiscali e sede", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) {
+			(*c).PartitaIVA, (*c).Indirizzo, (*c).CAP = "", "", "123"
+		}, []string{"cliente.partita_iva", "cliente.indirizzo", "cliente.cap"}},
+		{"codice destinatario errato", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) {
+			(*c).CodiceDestinatario = "ABC"
+		}, []string{"cliente.codice_destinatario"}},
+		{"profilo incompleto", func(f *database.Fattura, c **database.Cliente, p *database.ProfiloAzienda) {
+			p.PartitaIVA, p.Citta = "", ""
+		}, []string{"profilo.partita_iva", "profilo.citta"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, c, p := esempio()
+			tt.modify(f, &c, p)
+
+			var campi []string
+			for _, pr := range Controlla(f, c, p) {
+				campi = append(campi, pr.Campo)
+			}
+			if strings.Join(campi, ",") != strings.Join(tt.campi, ",") {
+				t.Errorf("campi = %v, attesi %v", campi, tt.campi)
+			}
+
+			_, err := Genera(f, c, p, "00001")
+			var ec *ErroreControllo
+			if (len(tt.campi) > 0) != errors.As(err, &ec) {
+				t.Errorf("Genera() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestNomeFile(t *testing.T) {
+	_, _, p := esempio()
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{1, "IT12345678903_00001.xml"},
+		{36, "IT12345678903_00010.xml"},
+		{60466175, "IT12345678903_ZZZZZ.xml"},
+	}
+	for _, tt := range tests {
+		if got := NomeFile(p, Progressivo(tt.n)); got != tt.want {
+			t.Errorf("NomeFile(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+
+	// Il nome usa lo stesso identificativo di IdTrasmittente: il codice
+	// fiscale, se diverso dalla partita IVA, altrimenti la partita IVA
+	p.CodiceFiscale = "rssmra80a01h501u"
+	if got := NomeFile(p, "00001"); got != "ITRSSMRA80A01H501U_00001.xml" {
+		t.Errorf("NomeFile() con codice fiscale = %s", got)
+	}
+	p.CodiceFiscale = ""
+	if got := NomeFile(p, "00001"); got != "IT12345678903_00001.xml" {
+		t.Errorf("NomeFile() senza codice fiscale = %s", got)
+	}
+}
+
+func TestFormati(t *testing.T) {
+	if got := decimali(0.125); got != "0.125" {
+		t.Errorf("decimali(0.125) = %s", got)
+	}
+	if got := decimali(3); got != "3.00" {
+		t.Errorf("decimali(3) = %s", got)
+	}
+	if got := testo("  Cambio olio 5W30 — 4,5 l € 🔧 ", 30); got != "Cambio olio 5W30 - 4,5 l EUR ?" {
+		t.Errorf("testo() = %q", got)
+	}
+}
@@ -0,0 +1,182 @@
+package fatturapa
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// I file .p7m sono buste CMS (PKCS#7) SignedData con firma CAdES: il file
+// XML è il contenuto firmato (eContent). La busta è spesso codificata in
+// BER con lunghezze indefinite e contenuto spezzato in più OCTET STRING,
+// che encoding/asn1 non accetta: per estrarre il contenuto basta un lettore
+// BER minimo. La firma non viene verificata.
+
+var (
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+	errNonP7M = errors.New("il file non è una busta P7M (CMS SignedData)")
+)
+
+// tlv è un elemento BER: classe e numero del tag, costruito o primitivo,
+// contenuto (per i costruiti, gli elementi interni)
+type tlv struct {
+	classe    int
+	tag       int
+	costruito bool
+	contenuto []byte
+	figli     []tlv
+}
+
+// leggiTLV legge un elemento all'inizio di data e restituisce il resto
+func leggiTLV(data []byte) (tlv, []byte, error) {
+	var t tlv
+	if len(data) < 2 {
+		return t, nil, errNonP7M
+	}
+	b := data[0]
+	t.classe = int(b >> 6)
+	t.costruito = b&0x20 != 0
+	t.tag = int(b & 0x1f)
+	i := 1
+	if t.tag == 0x1f {
+		t.tag = 0
+		for {
+			if i >= len(data) || i > 4 {
+				return t, nil, errNonP7M
+			}
+			t.tag = t.tag<<7 | int(data[i]&0x7f)
+			i++
+			if data[i-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	if i >= len(data) {
+		return t, nil, errNonP7M
+	}
+	l := int(data[i])
+	i++
+
+	// Lunghezza indefinita: gli elementi interni terminano con 00 00
+	if l == 0x80 {
+		if !t.costruito {
+			return t, nil, errNonP7M
+		}
+		resto := data[i:]
+		for {
+			if len(resto) >= 2 && resto[0] == 0 && resto[1] == 0 {
+				return t, resto[2:], nil
+			}
+			figlio, r, err := leggiTLV(resto)
+			if err != nil {
+				return t, nil, err
+			}
+			t.figli = append(t.figli, figlio)
+			resto = r
+		}
+	}
+
+	if l > 0x80 {
+		n := l & 0x7f
+		if n > 4 || i+n > len(data) {
+			return t, nil, errNonP7M
+		}
+		l = 0
+		for _, c := range data[i : i+n] {
+			l = l<<8 | int(c)
+		}
+		i += n
+	}
+	if l < 0 || i+l > len(data) {
+		return t, nil, errNonP7M
+	}
+	t.contenuto = data[i : i+l]
+	if t.costruito {
+		for resto := t.contenuto; len(resto) > 0; {
+			figlio, r, err := leggiTLV(resto)
+			if err != nil {
+				return t, nil, err
+			}
+			t.figli = append(t.figli, figlio)
+			resto = r
+		}
+	}
+	return t, data[i+l:], nil
+}
+
+// ottetti restituisce il valore di una OCTET STRING, anche se spezzata
+func (t tlv) ottetti() []byte {
+	if !t.costruito {
+		return t.contenuto
+	}
+	var buf bytes.Buffer
+	for _, f := range t.figli {
+		buf.Write(f.ottetti())
+	}
+	return buf.Bytes()
+}
+
+// EstraiP7M restituisce il contenuto firmato di una busta P7M, in binario
+// o in Base64. Le buste annidate (file firmati più volte) sono aperte fino
+// al documento.
+func EstraiP7M(data []byte) ([]byte, error) {
+	for livello := 0; livello < 4; livello++ {
+		der := data
+		var err error
+		if len(der) > 0 && der[0] != 0x30 {
+			der, err = base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(der), nil)))
+		}
+
+		var contenuto []byte
+		if err == nil {
+			contenuto, err = contenutoFirmato(der)
+		}
+		if err != nil {
+			if livello > 0 {
+				// Il contenuto non è un'altra busta: è il documento
+				return data, nil
+			}
+			return nil, err
+		}
+		data = contenuto
+	}
+	return data, nil
+}
+
+// contenutoFirmato legge ContentInfo → SignedData → encapContentInfo → eContent
+func contenutoFirmato(der []byte) ([]byte, error) {
+	info, _, err := leggiTLV(der)
+	if err != nil || !info.costruito || len(info.figli) < 2 {
+		return nil, errNonP7M
+	}
+
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(append([]byte{0x06, byte(len(info.figli[0].contenuto))}, info.figli[0].contenuto...), &oid); err != nil || !oid.Equal(oidSignedData) {
+		return nil, errNonP7M
+	}
+
+	// [0] EXPLICIT SignedData
+	esplicito := info.figli[1]
+	if esplicito.classe != 2 || len(esplicito.figli) == 0 {
+		return nil, errNonP7M
+	}
+	signed := esplicito.figli[0]
+	// version, digestAlgorithms, encapContentInfo, ...
+	if len(signed.figli) < 3 {
+		return nil, errNonP7M
+	}
+	encap := signed.figli[2]
+	if len(encap.figli) < 2 {
+		return nil, fmt.Errorf("busta P7M senza contenuto (firma separata dal documento)")
+	}
+	// [0] EXPLICIT OCTET STRING
+	eContent := encap.figli[1]
+	if eContent.classe != 2 || len(eContent.figli) == 0 {
+		return nil, errNonP7M
+	}
+	return eContent.figli[0].ottetti(), nil
+}
@@ -0,0 +1,179 @@
+package fatturapa
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"officina/database"
+)
+
+// Fatture ricevute dai fornitori: i file scaricati dal cassetto fiscale o
+// arrivati via PEC, in chiaro (.xml) o firmati (.p7m), sono letti e
+// registrati in prima nota con database.ImportFattureAcquisto.
+
+// metodiPagamento converte le modalità di pagamento del tracciato nei
+// metodi della prima nota; le modalità non elencate diventano BANCA
+var metodiPagamento = map[string]string{
+	"MP01": database.MetodoPagamentoCassa,
+	"MP02": database.MetodoPagamentoAssegno,
+	"MP03": database.MetodoPagamentoAssegno,
+	"MP05": database.MetodoPagamentoBonifico,
+	"MP08": database.MetodoPagamentoPOS,
+}
+
+// LeggiAcquisti interpreta un file ricevuto, estraendo l'XML dalla busta
+// se il file è firmato, e restituisce un documento per ogni fattura
+func LeggiAcquisti(nome string, data []byte) ([]database.FatturaAcquisto, error) {
+	testo := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if strings.EqualFold(filepath.Ext(nome), ".p7m") || !bytes.HasPrefix(testo, []byte("<")) {
+		xml, err := EstraiP7M(data)
+		if err != nil {
+			return nil, err
+		}
+		data = xml
+	}
+
+	fe, err := Leggi(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ced := fe.Header.CedentePrestatore
+	fornitore := database.Fornitore{
+		RagioneSociale: denominazione(ced.DatiAnagrafici.Anagrafica),
+		CodiceFiscale:  ced.DatiAnagrafici.CodiceFiscale,
+		Indirizzo:      strings.TrimSpace(ced.Sede.Indirizzo + " " + ced.Sede.NumeroCivico),
+		CAP:            ced.Sede.CAP,
+		Citta:          ced.Sede.Comune,
+		Provincia:      ced.Sede.Provincia,
+	}
+	if id := ced.DatiAnagrafici.IdFiscaleIVA; id != nil {
+		fornitore.PartitaIVA = id.IdCodice
+		if id.IdPaese != "IT" {
+			fornitore.PartitaIVA = id.IdPaese + id.IdCodice
+		}
+	}
+	if c := ced.Contatti; c != nil {
+		fornitore.Telefono = c.Telefono
+		fornitore.Email = c.Email
+	}
+
+	ces := fe.Header.CessionarioCommittente.DatiAnagrafici
+	var fatture []database.FatturaAcquisto
+	for _, body := range fe.Body {
+		doc := body.DatiGenerali.DatiGeneraliDocumento
+		fa := database.FatturaAcquisto{
+			File:          filepath.Base(nome),
+			Fornitore:     fornitore,
+			CessionarioCF: ces.CodiceFiscale,
+			Tipo:          doc.TipoDocumento,
+			Numero:        doc.Numero,
+			Data:          dataTracciato(doc.Data),
+			Totale:        numero(doc.ImportoTotaleDocumento),
+		}
+		if ces.IdFiscaleIVA != nil {
+			fa.CessionarioPIVA = ces.IdFiscaleIVA.IdCodice
+		}
+
+		// Senza importo totale, il totale è la somma del riepilogo IVA
+		if doc.ImportoTotaleDocumento == "" {
+			for _, r := range body.DatiBeniServizi.DatiRiepilogo {
+				fa.Totale += numero(r.ImponibileImporto) + numero(r.Imposta)
+			}
+		}
+
+		for _, p := range body.DatiPagamento {
+			for _, d := range p.DettaglioPagamento {
+				metodo, ok := metodiPagamento[d.ModalitaPagamento]
+				if !ok {
+					metodo = database.MetodoPagamentoBanca
+				}
+				fa.Scadenze = append(fa.Scadenze, database.ScadenzaAcquisto{
+					Data:    dataTracciato(d.DataScadenzaPagamento),
+					Importo: numero(d.ImportoPagamento),
+					Metodo:  metodo,
+				})
+			}
+		}
+
+		for _, l := range body.DatiBeniServizi.DettaglioLinee {
+			riga := database.RigaAcquisto{
+				Descrizione:    l.Descrizione,
+				Quantita:       numero(l.Quantita),
+				UnitaMisura:    l.UnitaMisura,
+				PrezzoUnitario: numero(l.PrezzoUnitario),
+				Importo:        numero(l.PrezzoTotale),
+			}
+			if len(l.CodiceArticolo) > 0 {
+				riga.CodiceArticolo = l.CodiceArticolo[0].CodiceValore
+			}
+			fa.Righe = append(fa.Righe, riga)
+		}
+
+		fatture = append(fatture, fa)
+	}
+	return fatture, nil
+}
+
+// ImportaCartella legge i file .xml e .p7m della cartella e li registra
+// con database.ImportFattureAcquisto. I file illeggibili sono errori del
+// report; ricevute e metadati dello SDI sono segnalati e ignorati.
+func ImportaCartella(db *database.DB, dir string, opts database.AcquistiImportOptions, commit bool) (*database.AcquistiImportReport, error) {
+	voci, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura cartella: %w", err)
+	}
+	sort.Slice(voci, func(i, j int) bool { return voci[i].Name() < voci[j].Name() })
+
+	report := &database.AcquistiImportReport{Documenti: []database.DocumentoAcquisto{}}
+	var fatture []database.FatturaAcquisto
+	for _, v := range voci {
+		ext := strings.ToLower(filepath.Ext(v.Name()))
+		if v.IsDir() || (ext != ".xml" && ext != ".p7m") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, v.Name()))
+		if err != nil {
+			return nil, err
+		}
+		lette, err := LeggiAcquisti(v.Name(), data)
+		switch {
+		case errors.Is(err, ErrNonFattura):
+			report.Documenti = append(report.Documenti, database.DocumentoAcquisto{
+				File: v.Name(), Esito: database.CSVAvviso, Messaggio: "non è una fattura, ignorato",
+			})
+		case err != nil:
+			report.Errore(v.Name(), err)
+		default:
+			fatture = append(fatture, lette...)
+		}
+	}
+
+	return db.ImportFattureAcquisto(fatture, report, opts, commit)
+}
+
+// denominazione restituisce la ragione sociale o, per le persone fisiche,
+// nome e cognome
+func denominazione(a Anagrafica) string {
+	if a.Denominazione != "" {
+		return a.Denominazione
+	}
+	return strings.TrimSpace(a.Nome + " " + a.Cognome)
+}
+
+// dataTracciato legge una data del tracciato (AAAA-MM-GG); le date non
+// valide sono zero e il documento viene segnalato dall'importazione
+func dataTracciato(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(s), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,123 @@
+package fatturapa
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"officina/database"
+)
+
+// busta costruisce una busta CMS SignedData minima attorno al contenuto;
+// con indefinita usa la codifica BER delle firme digitali più comuni, con
+// lunghezze indefinite e contenuto spezzato in blocchi
+func busta(contenuto []byte, indefinita bool) []byte {
+	tlv := func(tag byte, parti ...[]byte) []byte {
+		corpo := bytes.Join(parti, nil)
+		if indefinita && tag&0x20 != 0 {
+			return append(append([]byte{tag, 0x80}, corpo...), 0, 0)
+		}
+		n := len(corpo)
+		switch {
+		case n < 0x80:
+			return append([]byte{tag, byte(n)}, corpo...)
+		case n < 0x100:
+			return append([]byte{tag, 0x81, byte(n)}, corpo...)
+		default:
+			return append([]byte{tag, 0x82, byte(n >> 8), byte(n)}, corpo...)
+		}
+	}
+	oid := func(o asn1.ObjectIdentifier) []byte {
+		b, _ := asn1.Marshal(o)
+		return b
+	}
+
+	ottetti := tlv(0x04, contenuto)
+	if indefinita {
+		meta := len(contenuto) / 2
+		ottetti = tlv(0x24, tlv(0x04, contenuto[:meta]), tlv(0x04, contenuto[meta:]))
+	}
+	encap := tlv(0x30, oid(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}), tlv(0xa0, ottetti))
+	signed := tlv(0x30, []byte{0x02, 0x01, 0x01}, tlv(0x31), encap, tlv(0x31))
+	return tlv(0x30, oid(oidSignedData), tlv(0xa0, signed))
+}
+
+func TestEstraiP7M(t *testing.T) {
+	xml := []byte(`<?xml version="1.0"?><p:FatturaElettronica versione="FPR12"/>`)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"DER", busta(xml, false)},
+		{"BER indefinita", busta(xml, true)},
+		{"Base64", []byte(base64.StdEncoding.EncodeToString(busta(xml, false)) + "\r\n")},
+		{"firma doppia", busta(busta(xml, true), false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EstraiP7M(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, xml) {
+				t.Errorf("EstraiP7M() = %q", got)
+			}
+		})
+	}
+
+	if _, err := EstraiP7M(xml); err == nil {
+		t.Error("EstraiP7M() accetta un file non firmato")
+	}
+}
+
+func TestLeggiAcquisti(t *testing.T) {
+	xml, err := os.ReadFile(filepath.Join("testdata", "acquisto_rate.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for nome, data := range map[string][]byte{
+		"acquisto_rate.xml":     xml,
+		"acquisto_rate.xml.p7m": busta(xml, true),
+	} {
+		fatture, err := LeggiAcquisti(nome, data)
+		if err != nil {
+			t.Fatalf("%s: %v", nome, err)
+		}
+		if len(fatture) != 1 {
+			t.Fatalf("%s: %d fatture", nome, len(fatture))
+		}
+		fa := fatture[0]
+
+		f := fa.Fornitore
+		if f.RagioneSociale != "Ricambi Verdi S.r.l." || f.PartitaIVA != "01234567897" || f.Indirizzo != "Via dell'Industria 12/B" || f.Email != "ordini@ricambiverdi.it" {
+			t.Errorf("%s: fornitore = %+v", nome, f)
+		}
+		if fa.CessionarioPIVA != "12345678903" || fa.Numero != "FV/318" || fa.Totale != 122 ||
+			!fa.Data.Equal(time.Date(2026, 3, 31, 0, 0, 0, 0, time.Local)) {
+			t.Errorf("%s: documento = %+v", nome, fa)
+		}
+
+		attese := []database.ScadenzaAcquisto{
+			{Data: time.Date(2026, 4, 30, 0, 0, 0, 0, time.Local), Importo: 61, Metodo: database.MetodoPagamentoBonifico},
+			{Data: time.Date(2026, 5, 31, 0, 0, 0, 0, time.Local), Importo: 61, Metodo: database.MetodoPagamentoBanca},
+		}
+		if len(fa.Scadenze) != len(attese) {
+			t.Fatalf("%s: scadenze = %+v", nome, fa.Scadenze)
+		}
+		for i, s := range fa.Scadenze {
+			if !s.Data.Equal(attese[i].Data) || s.Importo != attese[i].Importo || s.Metodo != attese[i].Metodo {
+				t.Errorf("%s: scadenza %d = %+v", nome, i, s)
+			}
+		}
+
+		if len(fa.Righe) != 2 || fa.Righe[0].CodiceArticolo != "OF-1042" || fa.Righe[1].UnitaMisura != "LT" || fa.Righe[1].Quantita != 6 {
+			t.Errorf("%s: righe = %+v", nome, fa.Righe)
+		}
+	}
+}
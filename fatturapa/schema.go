@@ -0,0 +1,625 @@
+package fatturapa
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaXSD è lo schema ridotto del tracciato incluso nel programma, così
+// che la validazione funzioni senza rete. Non è lo schema ufficiale
+// dell'Agenzia delle Entrate: ne ripete la struttura, ma verifica il
+// contenuto solo degli elementi che l'officina genera.
+//
+//go:embed schema/fatturapa_v1.2_ridotto.xsd
+var schemaXSD []byte
+
+// Lo schema è interpretato da un validatore minimo che conosce solo i
+// costrutti usati dal file: tipi complessi con xs:sequence, xs:choice,
+// xs:any e attributi, elementi xs:anyType accettati senza controlli, tipi
+// semplici con xs:restriction (pattern, enumeration,
+// length, minLength, maxLength, minInclusive, maxInclusive) e i tipi base
+// string, normalizedString, decimal, integer e date.
+
+// nodo è un elemento di un documento XML letto in memoria
+type nodo struct {
+	nome  xml.Name
+	attr  []xml.Attr
+	figli []*nodo
+	testo string
+}
+
+func (n *nodo) attributo(nome string) (string, bool) {
+	for _, a := range n.attr {
+		if a.Name.Local == nome && a.Name.Space == "" {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// leggiNodi legge il documento e restituisce l'elemento radice
+func leggiNodi(data []byte) (*nodo, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charsetLatin1
+
+	var pila []*nodo
+	var radice *nodo
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("XML non valido: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &nodo{nome: t.Name, attr: t.Attr}
+			if len(pila) > 0 {
+				padre := pila[len(pila)-1]
+				padre.figli = append(padre.figli, n)
+			} else if radice == nil {
+				radice = n
+			}
+			pila = append(pila, n)
+		case xml.EndElement:
+			pila = pila[:len(pila)-1]
+		case xml.CharData:
+			if len(pila) > 0 {
+				pila[len(pila)-1].testo += string(t)
+			}
+		}
+	}
+	if radice == nil {
+		return nil, fmt.Errorf("XML non valido: documento vuoto")
+	}
+	return radice, nil
+}
+
+// charsetLatin1 accetta i file dichiarati ISO-8859-1, ammessi dallo SDI
+func charsetLatin1(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1":
+	default:
+		return nil, fmt.Errorf("codifica %s non supportata", charset)
+	}
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return strings.NewReader(string(runes)), nil
+}
+
+// particella è un elemento, una sequenza o una scelta del modello di contenuto
+type particella struct {
+	genere string // element, sequence, choice, any
+	nome   string
+	ns     string // namespace ammesso da any
+	tipo   string
+	min    int
+	max    int // -1 illimitato
+	figli  []*particella
+}
+
+type attributoXSD struct {
+	nome         string
+	tipo         string
+	obbligatorio bool
+}
+
+type tipoComplesso struct {
+	contenuto *particella
+	attributi []attributoXSD
+}
+
+type tipoSemplice struct {
+	base      string
+	pattern   []*regexp.Regexp
+	valori    []string
+	lunghezza int
+	minLen    int
+	maxLen    int
+	minIncl   *float64
+	maxIncl   *float64
+	minData   string
+}
+
+type schema struct {
+	ns        string
+	elementi  map[string]string // elementi radice e loro tipo
+	complessi map[string]*tipoComplesso
+	semplici  map[string]*tipoSemplice
+}
+
+var (
+	schemaOnce    sync.Once
+	schemaFattura *schema
+	schemaErrore  error
+)
+
+// caricaSchema interpreta lo schema incluso una sola volta
+func caricaSchema() (*schema, error) {
+	schemaOnce.Do(func() {
+		schemaFattura, schemaErrore = leggiSchema(schemaXSD)
+	})
+	return schemaFattura, schemaErrore
+}
+
+func leggiSchema(data []byte) (*schema, error) {
+	radice, err := leggiNodi(data)
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	s := &schema{
+		elementi:  map[string]string{},
+		complessi: map[string]*tipoComplesso{},
+		semplici:  map[string]*tipoSemplice{},
+	}
+	s.ns, _ = radice.attributo("targetNamespace")
+
+	for _, n := range radice.figli {
+		nome, _ := n.attributo("name")
+		switch n.nome.Local {
+		case "element":
+			tipo, _ := n.attributo("type")
+			s.elementi[nome] = tipo
+		case "complexType":
+			t := &tipoComplesso{}
+			for _, c := range n.figli {
+				switch c.nome.Local {
+				case "sequence", "choice":
+					if t.contenuto, err = leggiParticella(c); err != nil {
+						return nil, fmt.Errorf("schema, tipo %s: %w", nome, err)
+					}
+				case "attribute":
+					a := attributoXSD{}
+					a.nome, _ = c.attributo("name")
+					a.tipo, _ = c.attributo("type")
+					use, _ := c.attributo("use")
+					a.obbligatorio = use == "required"
+					t.attributi = append(t.attributi, a)
+				}
+			}
+			s.complessi[nome] = t
+		case "simpleType":
+			t, err := leggiTipoSemplice(n)
+			if err != nil {
+				return nil, fmt.Errorf("schema, tipo %s: %w", nome, err)
+			}
+			s.semplici[nome] = t
+		}
+	}
+	return s, nil
+}
+
+func leggiParticella(n *nodo) (*particella, error) {
+	p := &particella{genere: n.nome.Local, min: 1, max: 1}
+	p.nome, _ = n.attributo("name")
+	p.tipo, _ = n.attributo("type")
+	if p.genere == "any" {
+		p.ns, _ = n.attributo("namespace")
+		p.tipo = tipoQualsiasi
+	}
+	if v, ok := n.attributo("minOccurs"); ok {
+		p.min, _ = strconv.Atoi(v)
+	}
+	if v, ok := n.attributo("maxOccurs"); ok {
+		if v == "unbounded" {
+			p.max = -1
+		} else {
+			p.max, _ = strconv.Atoi(v)
+		}
+	}
+	if p.genere == "element" || p.genere == "any" {
+		return p, nil
+	}
+	for _, c := range n.figli {
+		figlio, err := leggiParticella(c)
+		if err != nil {
+			return nil, err
+		}
+		p.figli = append(p.figli, figlio)
+	}
+	return p, nil
+}
+
+func leggiTipoSemplice(n *nodo) (*tipoSemplice, error) {
+	t := &tipoSemplice{lunghezza: -1, minLen: -1, maxLen: -1}
+	for _, r := range n.figli {
+		if r.nome.Local != "restriction" {
+			continue
+		}
+		t.base, _ = r.attributo("base")
+		for _, f := range r.figli {
+			v, _ := f.attributo("value")
+			switch f.nome.Local {
+			case "pattern":
+				re, err := regexp.Compile("^(?:" + v + ")$")
+				if err != nil {
+					return nil, fmt.Errorf("pattern %q: %w", v, err)
+				}
+				t.pattern = append(t.pattern, re)
+			case "enumeration":
+				t.valori = append(t.valori, v)
+			case "length":
+				t.lunghezza, _ = strconv.Atoi(v)
+			case "minLength":
+				t.minLen, _ = strconv.Atoi(v)
+			case "maxLength":
+				t.maxLen, _ = strconv.Atoi(v)
+			case "minInclusive", "maxInclusive":
+				if t.base == "xs:date" {
+					if f.nome.Local == "minInclusive" {
+						t.minData = v
+					}
+					continue
+				}
+				x, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s %q non numerico", f.nome.Local, v)
+				}
+				if f.nome.Local == "minInclusive" {
+					t.minIncl = &x
+				} else {
+					t.maxIncl = &x
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// ValidaXML controlla il file rispetto allo schema ridotto del tracciato. Ogni
+// problema riporta in Percorso l'elemento del file (per esempio
+// "FatturaElettronicaBody[1]/DatiBeniServizi/DettaglioLinee[2]/PrezzoTotale")
+// e in Campo il dato della fattura da correggere.
+func ValidaXML(data []byte) ([]Problema, error) {
+	s, err := caricaSchema()
+	if err != nil {
+		return nil, err
+	}
+	radice, err := leggiNodi(data)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &validatore{schema: s}
+	tipo, ok := s.elementi[radice.nome.Local]
+	if !ok || radice.nome.Space != s.ns {
+		v.aggiungi("", "l'elemento radice deve essere FatturaElettronica nel namespace %s", s.ns)
+		return v.problemi, nil
+	}
+	v.elemento(radice, tipo, "")
+	return v.problemi, nil
+}
+
+type validatore struct {
+	schema   *schema
+	problemi []Problema
+}
+
+func (v *validatore) aggiungi(percorso string, format string, args ...interface{}) {
+	v.problemi = append(v.problemi, Problema{
+		Campo:     campoDaPercorso(percorso),
+		Percorso:  percorso,
+		Messaggio: fmt.Sprintf(format, args...),
+	})
+}
+
+// tipoQualsiasi dichiara gli elementi di cui lo schema ridotto non descrive
+// il contenuto
+const tipoQualsiasi = "xs:anyType"
+
+// elemento valida n rispetto al tipo dichiarato
+func (v *validatore) elemento(n *nodo, tipo, percorso string) {
+	if tipo == tipoQualsiasi {
+		return
+	}
+	if c, ok := v.schema.complessi[tipo]; ok {
+		v.complesso(n, c, percorso)
+		return
+	}
+
+	if len(n.figli) > 0 {
+		v.aggiungi(percorso, "<%s> non può contenere l'elemento <%s>", n.nome.Local, n.figli[0].nome.Local)
+		return
+	}
+	if err := v.valore(tipo, n.testo); err != nil {
+		v.aggiungi(percorso, "<%s>: %v", n.nome.Local, err)
+	}
+}
+
+func (v *validatore) complesso(n *nodo, t *tipoComplesso, percorso string) {
+	// Attributi
+	dichiarati := map[string]bool{}
+	for _, a := range t.attributi {
+		dichiarati[a.nome] = true
+		val, ok := n.attributo(a.nome)
+		if !ok {
+			if a.obbligatorio {
+				v.aggiungi(percorso, "manca l'attributo %s di <%s>", a.nome, n.nome.Local)
+			}
+			continue
+		}
+		if err := v.valore(a.tipo, val); err != nil {
+			v.aggiungi(percorso, "attributo %s: %v", a.nome, err)
+		}
+	}
+	for _, a := range n.attr {
+		if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" || a.Name.Space == NamespaceXSI {
+			continue
+		}
+		if a.Name.Space != "" || !dichiarati[a.Name.Local] {
+			v.aggiungi(percorso, "attributo %s non previsto in <%s>", a.Name.Local, n.nome.Local)
+		}
+	}
+
+	if strings.TrimSpace(n.testo) != "" {
+		v.aggiungi(percorso, "<%s> non può contenere testo", n.nome.Local)
+	}
+
+	// Gli elementi interni del tracciato non hanno namespace, salvo quelli
+	// ammessi da xs:any come la firma
+	for _, f := range n.figli {
+		if f.nome.Space != "" && (t.contenuto == nil || !ammesso(t.contenuto, f.nome.Space)) {
+			v.aggiungi(figlio(percorso, f.nome.Local), "l'elemento <%s> non deve avere namespace", f.nome.Local)
+			return
+		}
+	}
+
+	decl := make([]*particella, len(n.figli))
+	if t.contenuto != nil {
+		i, manca := confronta(t.contenuto, n.figli, 0, decl)
+		if manca != "" && i < len(n.figli) && !dichiarato(t.contenuto, n.figli[i].nome.Local) {
+			f := n.figli[i]
+			v.aggiungi(figlio(percorso, f.nome.Local), "elemento <%s> non previsto in <%s>", f.nome.Local, n.nome.Local)
+			return
+		}
+		if manca != "" {
+			v.aggiungi(figlio(percorso, strings.SplitN(manca, " ", 2)[0]), "manca l'elemento obbligatorio <%s> in <%s>", manca, n.nome.Local)
+			return
+		}
+		if i < len(n.figli) {
+			f := n.figli[i]
+			v.aggiungi(figlio(percorso, f.nome.Local), "elemento <%s> non previsto in questa posizione di <%s>", f.nome.Local, n.nome.Local)
+			return
+		}
+	} else if len(n.figli) > 0 {
+		v.aggiungi(percorso, "<%s> non può contenere elementi", n.nome.Local)
+		return
+	}
+
+	// Elementi ripetibili numerati da 1, come le linee del documento
+	conteggio := map[string]int{}
+	for i, f := range n.figli {
+		p := figlio(percorso, f.nome.Local)
+		if decl[i].max != 1 {
+			conteggio[f.nome.Local]++
+			p += fmt.Sprintf("[%d]", conteggio[f.nome.Local])
+		}
+		v.elemento(f, decl[i].tipo, p)
+	}
+}
+
+// figlio aggiunge un elemento al percorso; gli elementi sotto la radice
+// non la ripetono
+func figlio(percorso, nome string) string {
+	if percorso == "" {
+		return nome
+	}
+	return percorso + "/" + nome
+}
+
+// confronta abbina gli elementi da i in poi alla particella p e annota in
+// decl la dichiarazione di ciascuno. Restituisce la posizione raggiunta o,
+// se manca un elemento obbligatorio, il suo nome.
+func confronta(p *particella, figli []*nodo, i int, decl []*particella) (int, string) {
+	switch p.genere {
+	case "element", "any":
+		n := 0
+		for i < len(figli) && (p.max < 0 || n < p.max) && corrisponde(p, figli[i].nome) {
+			decl[i] = p
+			i++
+			n++
+		}
+		if n < p.min {
+			return i, p.nome
+		}
+		return i, ""
+
+	case "sequence":
+		for occ := 0; p.max < 0 || occ < p.max; occ++ {
+			j, manca := i, ""
+			for _, c := range p.figli {
+				if j, manca = confronta(c, figli, j, decl); manca != "" {
+					break
+				}
+			}
+			if manca != "" {
+				if occ < p.min {
+					return j, manca
+				}
+				break
+			}
+			if j == i {
+				break
+			}
+			i = j
+		}
+		return i, ""
+
+	case "choice":
+		for occ := 0; p.max < 0 || occ < p.max; occ++ {
+			scelta, vuota := -1, false
+			for _, c := range p.figli {
+				j, manca := confronta(c, figli, i, decl)
+				if manca == "" && j > i {
+					scelta = j
+					break
+				}
+				if manca == "" {
+					vuota = true
+				}
+			}
+			if scelta < 0 {
+				if occ < p.min && !vuota {
+					return i, alternative(p)
+				}
+				break
+			}
+			i = scelta
+		}
+		return i, ""
+	}
+	return i, ""
+}
+
+// corrisponde indica se l'elemento nome soddisfa la particella p
+func corrisponde(p *particella, nome xml.Name) bool {
+	if p.genere == "any" {
+		return nome.Space == p.ns
+	}
+	return nome.Space == "" && nome.Local == p.nome
+}
+
+// ammesso indica se il modello di contenuto accetta elementi del namespace ns
+func ammesso(p *particella, ns string) bool {
+	if p.genere == "any" {
+		return p.ns == ns
+	}
+	for _, c := range p.figli {
+		if ammesso(c, ns) {
+			return true
+		}
+	}
+	return false
+}
+
+// dichiarato indica se il modello di contenuto prevede l'elemento nome
+func dichiarato(p *particella, nome string) bool {
+	if p.genere == "element" {
+		return p.nome == nome
+	}
+	for _, c := range p.figli {
+		if dichiarato(c, nome) {
+			return true
+		}
+	}
+	return false
+}
+
+// alternative descrive gli elementi attesi da una scelta
+func alternative(p *particella) string {
+	var nomi []string
+	for _, c := range p.figli {
+		if c.genere == "element" {
+			nomi = append(nomi, c.nome)
+		} else if len(c.figli) > 0 {
+			nomi = append(nomi, alternative(&particella{figli: c.figli[:1]}))
+		}
+	}
+	return strings.Join(nomi, " o ")
+}
+
+// valore controlla un valore testuale rispetto a un tipo semplice
+func (v *validatore) valore(tipo, s string) error {
+	t, ok := v.schema.semplici[tipo]
+	if !ok {
+		return valoreBase(tipo, s)
+	}
+	if err := v.valore(t.base, s); err != nil {
+		return err
+	}
+
+	n := len([]rune(s))
+	switch {
+	case t.lunghezza >= 0 && n != t.lunghezza:
+		return fmt.Errorf("%q deve avere %d caratteri", s, t.lunghezza)
+	case t.minLen >= 0 && n < t.minLen:
+		return fmt.Errorf("%q deve avere almeno %d caratteri", s, t.minLen)
+	case t.maxLen >= 0 && n > t.maxLen:
+		return fmt.Errorf("%q supera i %d caratteri", s, t.maxLen)
+	}
+	if len(t.valori) > 0 && !contiene(t.valori, s) {
+		if len(t.valori) > 6 {
+			return fmt.Errorf("valore %q non ammesso", s)
+		}
+		return fmt.Errorf("valore %q non ammesso (valori: %s)", s, strings.Join(t.valori, ", "))
+	}
+	for _, re := range t.pattern {
+		if !re.MatchString(s) {
+			if s == "" {
+				return fmt.Errorf("valore obbligatorio")
+			}
+			return fmt.Errorf("valore %q non conforme al formato", s)
+		}
+	}
+	if t.minIncl != nil || t.maxIncl != nil {
+		x, _ := strconv.ParseFloat(s, 64)
+		if t.minIncl != nil && x < *t.minIncl {
+			return fmt.Errorf("valore %s inferiore al minimo %v", s, *t.minIncl)
+		}
+		if t.maxIncl != nil && x > *t.maxIncl {
+			return fmt.Errorf("valore %s superiore al massimo %v", s, *t.maxIncl)
+		}
+	}
+	if t.minData != "" && s < t.minData {
+		return fmt.Errorf("data %s anteriore al %s", s, t.minData)
+	}
+	return nil
+}
+
+var (
+	reDecimale = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+	reIntero   = regexp.MustCompile(`^[+-]?[0-9]+$`)
+)
+
+// valoreBase controlla i tipi predefiniti di XML Schema usati dal tracciato
+func valoreBase(tipo, s string) error {
+	switch tipo {
+	case "xs:string":
+		return nil
+	case "xs:normalizedString":
+		if strings.ContainsAny(s, "\t\n\r") {
+			return fmt.Errorf("%q contiene tabulazioni o a capo", s)
+		}
+		return nil
+	case "xs:decimal":
+		if !reDecimale.MatchString(s) {
+			return fmt.Errorf("%q non è un numero", s)
+		}
+		return nil
+	case "xs:integer":
+		if !reIntero.MatchString(s) {
+			return fmt.Errorf("%q non è un numero intero", s)
+		}
+		return nil
+	case "xs:date":
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return fmt.Errorf("%q non è una data AAAA-MM-GG", s)
+		}
+		return nil
+	}
+	return fmt.Errorf("tipo %s non definito nello schema", tipo)
+}
+
+func contiene(valori []string, s string) bool {
+	for _, v := range valori {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package fatturapa
+
+import "encoding/xml"
+
+// Strutture del tracciato FatturaPA 1.2 (FPR12), con i soli elementi usati
+// dall'officina. I nomi ricalcano quelli delle specifiche tecniche; l'ordine
+// dei campi è quello imposto dallo schema XSD ufficiale.
+
+// Namespace e schema del tracciato
+const (
+	NamespaceFatturaPA = "http://ivaservizi.agenziaentrate.gov.it/docs/xsd/fatture/v1.2"
+	NamespaceFirma     = "http://www.w3.org/2000/09/xmldsig#"
+	NamespaceXSI       = "http://www.w3.org/2001/XMLSchema-instance"
+	SchemaLocation     = NamespaceFatturaPA + " http://www.fatturapa.gov.it/export/fatturazione/sdi/fatturapa/v1.2/Schema_del_file_xml_FatturaPA_versione_1.2.xsd"
+)
+
+// FormatoPrivati è il formato delle fatture verso privati (B2B e B2C)
+const FormatoPrivati = "FPR12"
+
+// FatturaElettronica è l'elemento radice del file
+type FatturaElettronica struct {
+	XMLName        xml.Name `xml:"p:FatturaElettronica"`
+	Versione       string   `xml:"versione,attr"`
+	XmlnsDs        string   `xml:"xmlns:ds,attr"`
+	XmlnsP         string   `xml:"xmlns:p,attr"`
+	XmlnsXsi       string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+
+	Header FatturaElettronicaHeader `xml:"FatturaElettronicaHeader"`
+	Body   []FatturaElettronicaBody `xml:"FatturaElettronicaBody"`
+}
+
+// FatturaElettronicaHeader contiene trasmissione, cedente e cessionario
+type FatturaElettronicaHeader struct {
+	DatiTrasmissione       DatiTrasmissione
+	CedentePrestatore      CedentePrestatore
+	CessionarioCommittente CessionarioCommittente
+}
+
+type DatiTrasmissione struct {
+	IdTrasmittente      IdFiscale
+	ProgressivoInvio    string
+	FormatoTrasmissione string
+	CodiceDestinatario  string
+	PECDestinatario     string `xml:",omitempty"`
+}
+
+type IdFiscale struct {
+	IdPaese  string
+	IdCodice string
+}
+
+type CedentePrestatore struct {
+	DatiAnagrafici DatiAnagrafici
+	Sede           Indirizzo
+	IscrizioneREA  *IscrizioneREA `xml:",omitempty"`
+	Contatti       *Contatti      `xml:",omitempty"`
+}
+
+type CessionarioCommittente struct {
+	DatiAnagrafici DatiAnagrafici
+	Sede           Indirizzo
+}
+
+// DatiAnagrafici è comune a cedente (con RegimeFiscale) e cessionario
+type DatiAnagrafici struct {
+	IdFiscaleIVA  *IdFiscale `xml:",omitempty"`
+	CodiceFiscale string     `xml:",omitempty"`
+	Anagrafica    Anagrafica
+	RegimeFiscale string `xml:",omitempty"`
+}
+
+type Anagrafica struct {
+	Denominazione string `xml:",omitempty"`
+	Nome          string `xml:",omitempty"`
+	Cognome       string `xml:",omitempty"`
+}
+
+type Indirizzo struct {
+	Indirizzo    string
+	NumeroCivico string `xml:",omitempty"`
+	CAP          string
+	Comune       string
+	Provincia    string `xml:",omitempty"`
+	Nazione      string
+}
+
+type IscrizioneREA struct {
+	Ufficio           string
+	NumeroREA         string
+	StatoLiquidazione string
+}
+
+type Contatti struct {
+	Telefono string `xml:",omitempty"`
+	Email    string `xml:",omitempty"`
+}
+
+// FatturaElettronicaBody descrive un documento; l'officina ne emette uno per file
+type FatturaElettronicaBody struct {
+	DatiGenerali    DatiGenerali
+	DatiBeniServizi DatiBeniServizi
+	DatiPagamento   []DatiPagamento `xml:",omitempty"`
+}
+
+type DatiGenerali struct {
+	DatiGeneraliDocumento DatiGeneraliDocumento
+	DatiFattureCollegate  []DatiDocumentiCorrelati `xml:",omitempty"`
+}
+
+type DatiGeneraliDocumento struct {
+	TipoDocumento          string
+	Divisa                 string
+	Data                   string
+	Numero                 string
+	DatiRitenuta           []DatiRitenuta `xml:",omitempty"`
+	ImportoTotaleDocumento string         `xml:",omitempty"`
+	Causale                []string       `xml:",omitempty"`
+}
+
+// DatiRitenuta riporta la ritenuta d'acconto operata dal cessionario
+type DatiRitenuta struct {
+	TipoRitenuta     string
+	ImportoRitenuta  string
+	AliquotaRitenuta string
+	CausalePagamento string
+}
+
+// DatiDocumentiCorrelati identifica un documento collegato, per esempio la
+// fattura stornata da una nota di credito
+type DatiDocumentiCorrelati struct {
+	IdDocumento string
+	Data        string `xml:",omitempty"`
+}
+
+type DatiBeniServizi struct {
+	DettaglioLinee []DettaglioLinee
+	DatiRiepilogo  []DatiRiepilogo
+}
+
+type DettaglioLinee struct {
+	NumeroLinea         int
+	CodiceArticolo      []CodiceArticolo `xml:",omitempty"`
+	Descrizione         string
+	Quantita            string `xml:",omitempty"`
+	UnitaMisura         string `xml:",omitempty"`
+	PrezzoUnitario      string
+	ScontoMaggiorazione []ScontoMaggiorazione `xml:",omitempty"`
+	PrezzoTotale        string
+	AliquotaIVA         string
+	Ritenuta            string `xml:",omitempty"` // "SI" per le linee soggette a ritenuta
+	Natura              string `xml:",omitempty"`
+}
+
+// CodiceArticolo identifica il bene, es. CodiceTipo "EAN" o "Codice Art. fornitore"
+type CodiceArticolo struct {
+	CodiceTipo   string
+	CodiceValore string
+}
+
+type ScontoMaggiorazione struct {
+	Tipo        string // SC sconto, MG maggiorazione
+	Percentuale string `xml:",omitempty"`
+	Importo     string `xml:",omitempty"`
+}
+
+type DatiRiepilogo struct {
+	AliquotaIVA          string
+	Natura               string `xml:",omitempty"`
+	ImponibileImporto    string
+	Imposta              string
+	EsigibilitaIVA       string `xml:",omitempty"`
+	RiferimentoNormativo string `xml:",omitempty"`
+}
+
+type DatiPagamento struct {
+	CondizioniPagamento string
+	DettaglioPagamento  []DettaglioPagamento
+}
+
+type DettaglioPagamento struct {
+	ModalitaPagamento     string
+	DataScadenzaPagamento string `xml:",omitempty"`
+	ImportoPagamento      string
+	IstitutoFinanziario   string `xml:",omitempty"`
+	IBAN                  string `xml:",omitempty"`
+}
@@ -0,0 +1,199 @@
+package fatturapa
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNonFattura indica un file XML che non è una fattura, per esempio una
+// ricevuta o un file di metadati dello SDI
+var ErrNonFattura = errors.New("il file non è una fattura elettronica")
+
+// Leggi interpreta un file FatturaPA. Gli elementi non previsti dalle
+// strutture del tracciato sono ignorati.
+func Leggi(data []byte) (*FatturaElettronica, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charsetLatin1
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("XML non valido: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "FatturaElettronica" {
+			return nil, fmt.Errorf("%w (<%s>)", ErrNonFattura, start.Name.Local)
+		}
+
+		// Il prefisso del namespace varia da file a file: la radice si
+		// legge senza XMLName
+		var contenuto struct {
+			Versione string                   `xml:"versione,attr"`
+			Header   FatturaElettronicaHeader `xml:"FatturaElettronicaHeader"`
+			Body     []FatturaElettronicaBody `xml:"FatturaElettronicaBody"`
+		}
+		if err := d.DecodeElement(&contenuto, &start); err != nil {
+			return nil, fmt.Errorf("XML non valido: %w", err)
+		}
+		return &FatturaElettronica{
+			Versione:       contenuto.Versione,
+			XmlnsDs:        NamespaceFirma,
+			XmlnsP:         NamespaceFatturaPA,
+			XmlnsXsi:       NamespaceXSI,
+			SchemaLocation: SchemaLocation,
+			Header:         contenuto.Header,
+			Body:           contenuto.Body,
+		}, nil
+	}
+}
+
+// Verifica controlla la fattura generata come farebbe lo SDI: prima lo
+// schema del tracciato, poi, se lo schema è rispettato, i controlli sui
+// contenuti (ControllaSDI)
+func Verifica(fe *FatturaElettronica) ([]Problema, error) {
+	data, err := fe.XML()
+	if err != nil {
+		return nil, err
+	}
+	return VerificaXML(data)
+}
+
+// VerificaXML controlla un file FatturaPA, generato o ricevuto
+func VerificaXML(data []byte) ([]Problema, error) {
+	problemi, err := ValidaXML(data)
+	if err != nil || len(problemi) > 0 {
+		return problemi, err
+	}
+	fe, err := Leggi(data)
+	if err != nil {
+		return nil, err
+	}
+	return ControllaSDI(fe), nil
+}
+
+// Dati del profilo e del cliente corrispondenti agli elementi di cedente e
+// cessionario; il primo elemento trovato risalendo il percorso decide
+var campiSoggetto = map[string]string{
+	"IdFiscaleIVA":  "partita_iva",
+	"CodiceFiscale": "codice_fiscale",
+	"Anagrafica":    "ragione_sociale",
+	"RegimeFiscale": "regime_fiscale",
+	"Indirizzo":     "indirizzo",
+	"NumeroCivico":  "indirizzo",
+	"CAP":           "cap",
+	"Comune":        "citta",
+	"Provincia":     "provincia",
+	"Nazione":       "nazione",
+	"Ufficio":       "rea_ufficio",
+	"NumeroREA":     "rea_numero",
+	"Telefono":      "telefono",
+	"Email":         "email",
+}
+
+// Dati della riga corrispondenti agli elementi di DettaglioLinee
+var campiLinea = map[string]string{
+	"Descrizione":         "descrizione",
+	"Quantita":            "quantita",
+	"PrezzoUnitario":      "prezzo_unitario",
+	"ScontoMaggiorazione": "sconto",
+	"AliquotaIVA":         "aliquota_iva",
+	"Natura":              "natura",
+}
+
+var reLinea = regexp.MustCompile(`DettaglioLinee\[(\d+)\]`)
+
+// campoDaPercorso riconduce un elemento del file al dato della fattura,
+// del cliente o del profilo dell'officina da cui è generato
+func campoDaPercorso(percorso string) string {
+	var segmenti []string
+	for _, s := range strings.Split(percorso, "/") {
+		nome, _, _ := strings.Cut(s, "[")
+		segmenti = append(segmenti, nome)
+	}
+	contiene := func(nome string) bool {
+		for _, s := range segmenti {
+			if s == nome {
+				return true
+			}
+		}
+		return false
+	}
+	ultimo := segmenti[len(segmenti)-1]
+
+	switch {
+	case contiene("CedentePrestatore"), contiene("CessionarioCommittente"):
+		soggetto := "cliente"
+		if contiene("CedentePrestatore") {
+			soggetto = "profilo"
+		}
+		for i := len(segmenti) - 1; i >= 0; i-- {
+			if segmenti[i] == "IdFiscaleIVA" {
+				return soggetto + ".partita_iva"
+			}
+		}
+		for i := len(segmenti) - 1; i >= 0; i-- {
+			if c, ok := campiSoggetto[segmenti[i]]; ok {
+				return soggetto + "." + c
+			}
+		}
+		return soggetto
+
+	case contiene("DatiTrasmissione"):
+		switch ultimo {
+		case "CodiceDestinatario":
+			return "cliente.codice_destinatario"
+		case "PECDestinatario":
+			return "cliente.pec"
+		case "IdTrasmittente", "IdPaese", "IdCodice":
+			return "profilo.codice_fiscale"
+		}
+
+	case contiene("DettaglioLinee"):
+		m := reLinea.FindStringSubmatch(percorso)
+		if m == nil {
+			return "fattura.righe"
+		}
+		n, _ := strconv.Atoi(m[1])
+		campo := fmt.Sprintf("righe[%d]", n-1)
+		for i := len(segmenti) - 1; i >= 0 && segmenti[i] != "DettaglioLinee"; i-- {
+			if c, ok := campiLinea[segmenti[i]]; ok {
+				return campo + "." + c
+			}
+		}
+		return campo
+
+	case contiene("DatiRiepilogo") && ultimo == "EsigibilitaIVA":
+		return "fattura.regime_iva"
+
+	case contiene("DatiRiepilogo"), contiene("DatiBeniServizi"):
+		return "fattura.righe"
+
+	case contiene("DatiRitenuta"):
+		return "fattura.ritenuta"
+
+	case contiene("DatiGeneraliDocumento"):
+		switch ultimo {
+		case "Data":
+			return "fattura.data"
+		case "Numero":
+			return "fattura.numero"
+		}
+
+	case contiene("DatiPagamento"):
+		switch ultimo {
+		case "IBAN":
+			return "profilo.iban"
+		case "IstitutoFinanziario":
+			return "profilo.banca"
+		}
+	}
+	return "fattura"
+}
@@ -0,0 +1,122 @@
+package fatturapa
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestVerificaXML controlla i file di esempio in testdata: fatture valide
+// e fatture che lo SDI scarterebbe, con i campi e i codici attesi
+func TestVerificaXML(t *testing.T) {
+	tests := []struct {
+		file     string
+		attesi   []string // campo o campo [codice]
+		percorso string
+	}{
+		{"IT12345678903_00001.xml", nil, ""},
+		{"privato_latin1.xml", nil, ""},
+		{"acquisto_rate.xml", nil, ""},
+		{"facoltativi.xml", nil, ""},
+		{"schema_facoltativo_fuori_posto.xml", []string{"fattura"}, "FatturaElettronicaBody[1]/DatiGenerali/DatiGeneraliDocumento/DatiBollo"},
+		{"schema_cap.xml", []string{"cliente.cap"}, "FatturaElettronicaHeader/CessionarioCommittente/Sede/CAP"},
+		{"schema_numero.xml", []string{"fattura.numero"}, "FatturaElettronicaBody[1]/DatiGenerali/DatiGeneraliDocumento/Numero"},
+		{"schema_linea.xml", []string{"righe[0].aliquota_iva", "righe[1]"}, "FatturaElettronicaBody[1]/DatiBeniServizi/DettaglioLinee[1]/AliquotaIVA"},
+		{"scarto_00423.xml", []string{"righe[1] [00423]", "fattura.righe [00422]"}, ""},
+		{"scarto_00400.xml", []string{"righe[2].natura [00400]", "fattura.righe [00429]"}, ""},
+		{"scarto_00419.xml", []string{"fattura.righe [00421]", "fattura.righe [00419]"}, ""},
+		{"scarto_00426.xml", []string{"cliente.pec [00426]", "cliente.partita_iva [00305]"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			problemi, err := VerificaXML(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var trovati []string
+			for _, p := range problemi {
+				s := p.Campo
+				if p.Codice != "" {
+					s += " [" + p.Codice + "]"
+				}
+				trovati = append(trovati, s)
+			}
+			if strings.Join(trovati, ", ") != strings.Join(tt.attesi, ", ") {
+				t.Errorf("problemi = %v, attesi %v", problemi, tt.attesi)
+			}
+			if tt.percorso != "" && problemi[0].Percorso != tt.percorso {
+				t.Errorf("percorso = %s, atteso %s", problemi[0].Percorso, tt.percorso)
+			}
+		})
+	}
+}
+
+func TestLeggi(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "privato_latin1.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe, err := Leggi(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := fe.Header.CessionarioCommittente.DatiAnagrafici.Anagrafica; a.Cognome != "Rossi Niccolò" {
+		t.Errorf("cognome = %q", a.Cognome)
+	}
+	if n := len(fe.Body[0].DatiBeniServizi.DettaglioLinee); n != 3 {
+		t.Errorf("linee = %d", n)
+	}
+
+	if _, err := Leggi([]byte(`<?xml version="1.0"?><Ordine/>`)); err == nil {
+		t.Error("Leggi() accetta un file che non è una fattura")
+	}
+}
+
+// TestVerificaGenerata verifica i documenti prodotti da Genera
+func TestVerificaGenerata(t *testing.T) {
+	f, c, p := esempio()
+	fe, err := Genera(f, c, p, Progressivo(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	problemi, err := Verifica(fe)
+	if err != nil || len(problemi) > 0 {
+		t.Fatalf("Verifica() = %v, %v", problemi, err)
+	}
+
+	// Un telefono troppo corto supera i controlli preliminari ma non lo schema
+	p.Telefono = "112"
+	fe, _ = Genera(f, c, p, Progressivo(1))
+	problemi, _ = Verifica(fe)
+	if len(problemi) != 1 || problemi[0].Campo != "profilo.telefono" {
+		t.Errorf("Verifica() = %v", problemi)
+	}
+}
+
+func TestCampoDaPercorso(t *testing.T) {
+	tests := []struct {
+		percorso string
+		want     string
+	}{
+		{"FatturaElettronicaHeader/DatiTrasmissione/CodiceDestinatario", "cliente.codice_destinatario"},
+		{"FatturaElettronicaHeader/CedentePrestatore/DatiAnagrafici/IdFiscaleIVA/IdCodice", "profilo.partita_iva"},
+		{"FatturaElettronicaHeader/CedentePrestatore/IscrizioneREA/Ufficio", "profilo.rea_ufficio"},
+		{"FatturaElettronicaHeader/CessionarioCommittente/DatiAnagrafici/Anagrafica/Denominazione", "cliente.ragione_sociale"},
+		{"FatturaElettronicaBody[1]/DatiBeniServizi/DettaglioLinee[3]/ScontoMaggiorazione[1]/Percentuale", "righe[2].sconto"},
+		{"FatturaElettronicaBody[1]/DatiBeniServizi/DatiRiepilogo[1]/Imposta", "fattura.righe"},
+		{"FatturaElettronicaBody[1]/DatiPagamento[1]/DettaglioPagamento[1]/IBAN", "profilo.iban"},
+		{"FatturaElettronicaBody[1]/DatiGenerali/DatiGeneraliDocumento/Divisa", "fattura"},
+	}
+	for _, tt := range tests {
+		if got := campoDaPercorso(tt.percorso); got != tt.want {
+			t.Errorf("campoDaPercorso(%s) = %s, want %s", tt.percorso, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"officina/database"
+	"officina/fatturapa"
+	"officina/logger"
+)
+
+// runFatturaPACommand gestisce "officina fatturapa genera|valida|importa"
+func runFatturaPACommand(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "Uso: officina fatturapa genera|valida|importa [opzioni] ...")
+		return exitUso
+	}
+
+	switch args[0] {
+	case "genera":
+		return runFatturaPAGenera(args[1:])
+	case "valida":
+		return runFatturaPAValida(args[1:])
+	case "importa":
+		return runFatturaPAImporta(args[1:])
+	}
+
+	fmt.Fprintf(os.Stderr, "Comando sconosciuto: fatturapa %s\n", args[0])
+	return exitUso
+}
+
+// esitoFatturaPA descrive la generazione di una fattura elettronica
+type esitoFatturaPA struct {
+	Fattura  string               `json:"fattura,omitempty"`
+	File     string               `json:"file,omitempty"`
+	Problemi []fatturapa.Problema `json:"problemi,omitempty"`
+}
+
+// runFatturaPAGenera genera i file XML delle fatture indicate per numero o
+// id; esce con 3 se qualche fattura ha dati da correggere
+func runFatturaPAGenera(args []string) int {
+	opts := newOpzioni("fatturapa genera")
+	dir := opts.fs.String("dir", "", "directory di destinazione (default app.export_path)")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+	if len(opts.args) == 0 {
+		opts.fail(fmt.Errorf("indicare il numero o l'id di almeno una fattura"))
+		return exitUso
+	}
+
+	cfg, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	if *dir == "" {
+		*dir = cfg.App.ExportPath
+	}
+
+	fatture, err := db.ListFatture()
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	var esiti []esitoFatturaPA
+	code = exitOK
+	for _, arg := range opts.args {
+		f := cercaFattura(fatture, arg)
+		if f == nil {
+			opts.fail(fmt.Errorf("fattura %s non trovata", arg))
+			return exitUso
+		}
+
+		esito := esitoFatturaPA{Fattura: f.Numero}
+		if esito.Fattura == "" {
+			esito.Fattura = "#" + strconv.Itoa(f.ID)
+		}
+		path, err := fatturapa.Esporta(db, f.ID, *dir)
+		var ec *fatturapa.ErroreControllo
+		switch {
+		case errors.As(err, &ec):
+			esito.Problemi = ec.Problemi
+			code = exitProblemi
+		case err != nil:
+			opts.fail(fmt.Errorf("fattura %s: %w", esito.Fattura, err))
+			return exitErrore
+		default:
+			esito.File = path
+			logger.Info("FatturaPA: fattura %s salvata in %s", esito.Fattura, path)
+		}
+		esiti = append(esiti, esito)
+	}
+
+	opts.output(esiti, func() {
+		for _, e := range esiti {
+			if e.File != "" {
+				fmt.Printf("✓ %s → %s\n", e.Fattura, e.File)
+				continue
+			}
+			fmt.Printf("✗ %s: dati da correggere\n", e.Fattura)
+			stampaProblemi(e.Problemi)
+		}
+	})
+	return code
+}
+
+// runFatturaPAValida controlla file FatturaPA già generati o ricevuti con
+// lo schema del tracciato e i controlli dello SDI, senza rete; esce con 3
+// se qualche file verrebbe scartato
+func runFatturaPAValida(args []string) int {
+	opts := newOpzioni("fatturapa valida")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+	if len(opts.args) == 0 {
+		opts.fail(fmt.Errorf("indicare almeno un file XML"))
+		return exitUso
+	}
+
+	var esiti []esitoFatturaPA
+	code := exitOK
+	for _, path := range opts.args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			opts.fail(err)
+			return exitErrore
+		}
+		problemi, err := fatturapa.VerificaXML(data)
+		if err != nil {
+			opts.fail(fmt.Errorf("%s: %w", path, err))
+			return exitErrore
+		}
+		if len(problemi) > 0 {
+			code = exitProblemi
+		}
+		esiti = append(esiti, esitoFatturaPA{File: path, Problemi: problemi})
+	}
+
+	opts.output(esiti, func() {
+		for _, e := range esiti {
+			if len(e.Problemi) == 0 {
+				fmt.Printf("✓ %s\n", e.File)
+				continue
+			}
+			fmt.Printf("✗ %s: %d problemi\n", e.File, len(e.Problemi))
+			stampaProblemi(e.Problemi)
+		}
+	})
+	return code
+}
+
+// runFatturaPAImporta registra in prima nota le fatture ricevute (.xml e
+// .p7m) di una cartella; senza --commit simula e basta. Esce con 3 se
+// qualche file non può essere importato.
+func runFatturaPAImporta(args []string) int {
+	opts := newOpzioni("fatturapa importa")
+	magazzino := opts.fs.Bool("magazzino", false, "registra un carico di magazzino per ogni riga con quantità")
+	commit := opts.fs.Bool("commit", false, "esegue l'importazione (default: solo simulazione)")
+	saltaErrori := opts.fs.Bool("salta-errori", false, "con --commit importa le fatture valide ignorando quelle con errori")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+	if len(opts.args) != 1 {
+		opts.fail(fmt.Errorf("indicare la cartella delle fatture ricevute"))
+		return exitUso
+	}
+
+	_, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	importOpts := database.AcquistiImportOptions{Magazzino: *magazzino, SaltaErrori: *saltaErrori}
+	report, err := fatturapa.ImportaCartella(db, opts.args[0], importOpts, *commit)
+	if report == nil {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	if report.Importato {
+		logger.Info("Import fatture ricevute da %s: %d movimenti, %d carichi, %d nuovi fornitori",
+			opts.args[0], report.Movimenti, report.Carichi, report.FornitoriNuovi)
+	}
+	opts.output(report, func() { printReportAcquisti(report) })
+
+	if err != nil {
+		opts.fail(err)
+		if report.HasErrors() {
+			return exitProblemi
+		}
+		return exitErrore
+	}
+	if report.HasErrors() && !report.Importato {
+		return exitProblemi
+	}
+	return exitOK
+}
+
+// printReportAcquisti stampa il report di un import di fatture ricevute
+func printReportAcquisti(r *database.AcquistiImportReport) {
+	for _, d := range r.Documenti {
+		documento := strings.TrimSpace(d.Fornitore + " " + d.Numero)
+		if d.Data != "" {
+			documento += " del " + d.Data
+		}
+		fmt.Printf("%-9s %-32s %-40s %s\n", d.Esito, d.File, documento, d.Messaggio)
+	}
+
+	fmt.Printf("\nFornitori: %d nuovi, %d già presenti — %d movimenti, %d carichi — %d duplicati, %d errori\n",
+		r.FornitoriNuovi, r.FornitoriEsistenti, r.Movimenti, r.Carichi, r.Duplicati, r.Errori)
+	switch {
+	case r.Importato:
+		fmt.Println("Importazione completata.")
+	case r.HasErrors():
+		fmt.Println("Simulazione: correggere gli errori oppure usare --commit --salta-errori.")
+	default:
+		fmt.Println("Simulazione: nessun dato scritto, usare --commit per importare.")
+	}
+}
+
+// stampaProblemi elenca i problemi con il campo da correggere e, per quelli
+// trovati nel file, l'elemento XML
+func stampaProblemi(problemi []fatturapa.Problema) {
+	for _, p := range problemi {
+		msg := p.Messaggio
+		if p.Codice != "" {
+			msg = "[" + p.Codice + "] " + msg
+		}
+		fmt.Printf("    %-28s %s\n", p.Campo, msg)
+		if p.Percorso != "" {
+			fmt.Printf("    %-28s %s\n", "", p.Percorso)
+		}
+	}
+}
+
+// cercaFattura trova una fattura per numero o, in mancanza, per id
+func cercaFattura(fatture []database.Fattura, arg string) *database.Fattura {
+	for i := range fatture {
+		if fatture[i].Numero == arg {
+			return &fatture[i]
+		}
+	}
+	if id, err := strconv.Atoi(arg); err == nil {
+		for i := range fatture {
+			if fatture[i].ID == id {
+				return &fatture[i]
+			}
+		}
+	}
+	return nil
+}
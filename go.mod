@@ -1,20 +1,35 @@
 module officina
 
-go 1.23
+go 1.23.0
 
 require (
+    github.com/BurntSushi/toml v1.5.0
     github.com/charmbracelet/bubbles v0.20.0
     github.com/charmbracelet/bubbletea v1.3.4
-    github.com/charmbracelet/lipgloss v1.0.0
+    github.com/charmbracelet/lipgloss v1.1.0
+    github.com/charmbracelet/ssh v0.0.0-20250826160808-ebfa259c7309
+    github.com/charmbracelet/wish v1.4.7
+    github.com/muesli/termenv v0.16.0
     go.mongodb.org/mongo-driver v1.17.1
+    golang.org/x/crypto v0.37.0
 )
 
 require (
+    github.com/anmitsu/go-shlex v0.0.0-20200514113438-38f4b401e2be // indirect
     github.com/atotto/clipboard v0.1.4 // indirect
     github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
+    github.com/charmbracelet/colorprofile v0.2.3-0.20250311203215-f60798e515dc // indirect
+    github.com/charmbracelet/keygen v0.5.3 // indirect
+    github.com/charmbracelet/log v0.4.1 // indirect
     github.com/charmbracelet/x/ansi v0.8.0 // indirect
+    github.com/charmbracelet/x/cellbuf v0.0.13-0.20250311204145-2c3ea96c31dd // indirect
+    github.com/charmbracelet/x/conpty v0.1.0 // indirect
+    github.com/charmbracelet/x/errors v0.0.0-20240508181413-e8d8b6e2de86 // indirect
     github.com/charmbracelet/x/term v0.2.1 // indirect
+    github.com/charmbracelet/x/termios v0.1.0 // indirect
+    github.com/creack/pty v1.1.21 // indirect
     github.com/erikgeiser/coninput v0.0.0-20211004153227-1c3628e74d0f // indirect
+    github.com/go-logfmt/logfmt v0.6.0 // indirect
     github.com/golang/snappy v0.0.4 // indirect
     github.com/klauspost/compress v1.17.11 // indirect
     github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
@@ -24,15 +39,14 @@ require (
     github.com/montanaflynn/stats v0.7.1 // indirect
     github.com/muesli/ansi v0.0.0-20230316100256-276c6243b2f6 // indirect
     github.com/musesli/cancelreader v0.2.2 // indirect
-    github.com/muesli/termenv v0.15.2 // indirect
     github.com/rivo/uniseg v0.4.7 // indirect
     github.com/xdg-go/pbkdf2 v1.0.0 // indirect
     github.com/xdg-go/scram v1.1.2 // indirect
     github.com/xdg-go/stringprep v1.0.4 // indirect
-    github.com/youmark/pkcs8 v0.0.0-20240726163527-a3c4f1cca3e5 // indirect
     github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
-    golang.org/x/crypto v0.33.0 // indirect
-    golang.org/x/sync v0.11.0 // indirect
-    golang.org/x/sys v0.30.0 // indirect
-    golang.org/x/text v0.22.0 // indirect
+    github.com/youmark/pkcs8 v0.0.0-20240726163527-a3c4f1cca3e5 // indirect
+    golang.org/x/exp v0.0.0-20240719175910-8a7402abbf56 // indirect
+    golang.org/x/sync v0.13.0 // indirect
+    golang.org/x/sys v0.32.0 // indirect
+    golang.org/x/text v0.24.0 // indirect
 )
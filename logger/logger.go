@@ -40,6 +40,13 @@ func Init(logPath string, debugMode bool) error {
 	return nil
 }
 
+// SetDebug abilita o disabilita i messaggi DEBUG senza riavviare l'applicazione
+func SetDebug(enabled bool) {
+	if defaultLogger != nil {
+		defaultLogger.debugMode = enabled
+	}
+}
+
 func Close() error {
 	if defaultLogger != nil && defaultLogger.file != nil {
 		return defaultLogger.file.Close()
@@ -1,50 +1,68 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"strings"
+	"time"
 
+	"officina/api"
 	"officina/config"
 	"officina/database"
+	"officina/eventi"
 	"officina/logger"
 	"officina/ui/screens"
+	"officina/webhook"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+// Informazioni di build, impostate dal Makefile tramite -ldflags
+var (
+	Version   = "dev"
+	BuildTime = "unknown"
+	Commit    = "unknown"
+)
+
 func main() {
-	// Carica configurazione
-	cfg, err := config.LoadOrDefault()
-	if err != nil {
-		log.Fatalf("Errore caricamento configurazione: %v", err)
-	}
+	os.Exit(run(os.Args[1:]))
+}
 
-	// Inizializza logger
-	if err := logger.Init(cfg.App.LogFile, cfg.App.DebugMode); err != nil {
-		log.Fatalf("Errore inizializzazione logger: %v", err)
+// runTUI avvia l'interfaccia a schermo intero
+func runTUI(args []string) int {
+	opts := newOpzioni("tui")
+	if code, stop := opts.parse(args); stop {
+		return code
 	}
-	defer logger.Close()
 
-	logger.Info("Avvio %s v%s", cfg.App.Name, cfg.App.Version)
-
-	// Inizializza database MongoDB
-	db, err := database.InitMongoDB(cfg.Database.URI, cfg.Database.Name)
-	if err != nil {
-		logger.Error("Errore connessione database MongoDB: %v", err)
-		log.Fatalf("Errore connessione MongoDB: %v", err)
+	// Carica configurazione: default, file, variabili OFFICINA_* e opzioni
+	cfg, db, code, stop := opts.open()
+	if stop {
+		return code
 	}
+	defer logger.Close()
 	defer db.Close()
 
+	logger.Info("Avvio %s v%s", cfg.App.Name, cfg.App.Version)
 	logger.Info("Database MongoDB connesso: %s/%s", cfg.Database.URI, cfg.Database.Name)
 
-	// Backup automatico
+	// Backup automatico: la copia locale è pronta prima di aprire
+	// l'interfaccia, la replica sulle destinazioni esterne prosegue in
+	// background e l'esito compare nell'interfaccia
+	model := screens.NewModel(db, cfg)
 	if cfg.Backup.Enabled {
-		backupMgr := database.NewBackupManager(db, cfg.App.BackupPath, cfg.Backup.MaxFiles)
-		if backupFile, err := backupMgr.CreateBackup(); err != nil {
+		backupMgr, err := database.NewBackupManagerFromConfig(db, cfg)
+		if err != nil {
+			logger.Warn("Destinazioni di replica backup non valide: %v", err)
+		}
+		if backupFile, err := backupMgr.CreateLocalBackup(); err != nil {
 			logger.Warn("Impossibile creare backup iniziale: %v", err)
 		} else {
 			logger.Info("Backup creato: %s", backupFile)
+			if len(backupMgr.Targets()) > 0 {
+				model = model.ReplicaBackup(backupFile)
+			}
 		}
 	}
 
@@ -57,19 +75,58 @@ func main() {
 		}
 	}
 
+	defer avviaEventi(cfg, db)()
+
+	// API REST nello stesso processo, sullo stesso database
+	if cfg.API.Enabled {
+		ctx, stopAPI := context.WithCancel(context.Background())
+		defer stopAPI()
+		go func() {
+			if err := api.NewServer(db, cfg.App.Version).ListenAndServe(ctx, cfg.API.Listen); err != nil {
+				logger.Error("API REST non avviata: %v", err)
+			}
+		}()
+	}
+
 	// Avvia interfaccia utente
 	logger.Info("Avvio interfaccia utente")
 
 	p := tea.NewProgram(
-		screens.NewModel(db),
+		model,
 		tea.WithAltScreen(),
 	)
 
 	if _, err := p.Run(); err != nil {
 		logger.Error("Errore esecuzione: %v", err)
 		fmt.Printf("Errore esecuzione: %v\n", err)
-		os.Exit(1)
+		return exitErrore
 	}
 
 	logger.Info("Applicazione terminata correttamente")
+	return exitOK
+}
+
+// avviaEventi collega il bus degli eventi al database e vi registra i
+// webhook configurati. Restituisce la funzione da chiamare in chiusura, che
+// attende i sottoscrittori e le consegne in corso. Un errore di
+// configurazione dei webhook li disattiva senza impedire l'avvio.
+func avviaEventi(cfg *config.Config, db *database.DB) func() {
+	bus := eventi.NewBus()
+	eventi.Collega(bus, db)
+
+	if len(cfg.Webhooks) == 0 {
+		return bus.Attendi
+	}
+	d, err := webhook.NewDispatcher(cfg.Webhooks, db)
+	if err != nil {
+		logger.Error("Webhook disattivati: %v", err)
+		return bus.Attendi
+	}
+	bus.SottoscriviTutti(func(e eventi.Evento) { d.Invia(e.Intestazione()) })
+	logger.Info("Webhook attivi: %s", strings.Join(d.Nomi(), ", "))
+
+	return func() {
+		bus.Attendi()
+		d.Chiudi(10 * time.Second)
+	}
 }
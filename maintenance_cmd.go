@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"officina/database"
+	"officina/logger"
+	"officina/utils"
+)
+
+// runFsckCommand gestisce "officina fsck": esce con 3 se trova anomalie
+func runFsckCommand(args []string) int {
+	opts := newOpzioni("fsck")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	_, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	report, err := db.CheckIntegrity()
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+	if report.Anomalie == nil {
+		report.Anomalie = []database.Anomalia{}
+	}
+
+	opts.output(report, func() {
+		collezioni := make([]string, 0, len(report.Documenti))
+		for c := range report.Documenti {
+			collezioni = append(collezioni, c)
+		}
+		sort.Strings(collezioni)
+		for _, c := range collezioni {
+			fmt.Printf("%-20s %6d documenti\n", c, report.Documenti[c])
+		}
+
+		fmt.Println()
+		for _, a := range report.Anomalie {
+			fmt.Printf("✗ %s\n", a)
+		}
+		if report.OK() {
+			fmt.Println("✓ Nessuna anomalia")
+		} else {
+			fmt.Printf("%d anomalie trovate\n", len(report.Anomalie))
+		}
+	})
+
+	if !report.OK() {
+		logger.Warn("fsck: %d anomalie trovate", len(report.Anomalie))
+		return exitProblemi
+	}
+	return exitOK
+}
+
+// runNumerazioneCommand controlla la numerazione delle fatture: per ogni
+// anno e sezionale l'ultimo numero, i numeri mancanti, i duplicati e le
+// date fuori ordine; esce con 3 se qualche sequenza ha problemi
+func runNumerazioneCommand(args []string) int {
+	opts := newOpzioni("numerazione")
+	anno := opts.fs.Int("anno", 0, "controlla solo l'anno indicato")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	_, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	report, err := db.ReportNumerazione(*anno)
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	opts.output(report, func() {
+		fmt.Printf("Formato: %s\n\n", report.Formato)
+		if len(report.Sequenze) == 0 {
+			fmt.Println("Nessuna fattura")
+		}
+		for _, s := range report.Sequenze {
+			nome := fmt.Sprintf("%d", s.Anno)
+			if s.Sequenza == "note_credito" {
+				nome += " note di credito"
+			}
+			if s.Sezionale != "" {
+				nome += " sezionale " + s.Sezionale
+			}
+			segno := "✓"
+			if !s.OK() {
+				segno = "✗"
+			}
+			fmt.Printf("%s %-40s %4d documenti, ultimo progressivo %d\n", segno, nome, s.Fatture, s.Ultimo)
+			if len(s.Mancanti) > 0 {
+				fmt.Printf("    mancanti:         %s\n", elencoNumeri(s.Mancanti))
+			}
+			for _, d := range s.Duplicati {
+				fmt.Printf("    duplicato:        %s\n", d)
+			}
+			for _, d := range s.FuoriOrdine {
+				fmt.Printf("    fuori ordine:     %s\n", d)
+			}
+			for _, d := range s.NonRiconosciuti {
+				fmt.Printf("    fuori formato:    %s\n", d)
+			}
+		}
+	})
+
+	if report.HasErrors() {
+		return exitProblemi
+	}
+	return exitOK
+}
+
+// elencoNumeri compatta i progressivi consecutivi: 3, 5-7, 12
+func elencoNumeri(numeri []int) string {
+	var parti []string
+	for i := 0; i < len(numeri); {
+		j := i
+		for j+1 < len(numeri) && numeri[j+1] == numeri[j]+1 {
+			j++
+		}
+		if j > i {
+			parti = append(parti, fmt.Sprintf("%d-%d", numeri[i], numeri[j]))
+		} else {
+			parti = append(parti, fmt.Sprintf("%d", numeri[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parti, ", ")
+}
+
+// runCreditiCommand stampa lo scadenzario dei crediti verso i clienti alla
+// data indicata; con --scadute esce con 3 se ci sono rate scadute
+func runCreditiCommand(args []string) int {
+	opts := newOpzioni("crediti")
+	dataStr := opts.fs.String("data", "", "data di riferimento AAAA-MM-GG (predefinita: oggi)")
+	scadute := opts.fs.Bool("scadute", false, "esce con 3 se ci sono crediti scaduti")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+	oggi := time.Now()
+	if *dataStr != "" {
+		d, err := time.ParseInLocation("2006-01-02", *dataStr, time.Local)
+		if err != nil {
+			opts.fail(fmt.Errorf("data non valida (formato AAAA-MM-GG): %s", *dataStr))
+			return exitUso
+		}
+		oggi = d
+	}
+
+	_, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	report, err := db.ScadenzarioCrediti(oggi)
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	opts.output(report, func() {
+		fmt.Printf("Crediti al %s\n\n", oggi.Format("02/01/2006"))
+		if len(report.Clienti) == 0 {
+			fmt.Println("Nessun credito da incassare")
+			return
+		}
+		fmt.Printf("%-30s", "Cliente")
+		for _, f := range report.Fasce {
+			fmt.Printf(" %12s", f)
+		}
+		fmt.Printf(" %12s\n", "Totale")
+		riga := func(nome string, fasce []float64, totale float64) {
+			fmt.Printf("%-30s", nome)
+			for _, v := range fasce {
+				fmt.Printf(" %12.2f", v)
+			}
+			fmt.Printf(" %12.2f\n", totale)
+		}
+		for _, c := range report.Clienti {
+			nome := c.Cliente
+			if nome == "" {
+				nome = fmt.Sprintf("cliente %d", c.ClienteID)
+			}
+			riga(utils.Truncate(nome, 30), c.Fasce, c.Totale)
+		}
+		riga("Totale", report.Totali, report.Totale)
+	})
+
+	if *scadute && report.Totale > report.Totali[0] {
+		return exitProblemi
+	}
+	return exitOK
+}
+
+// runMigrateCommand gestisce "officina migrate"; con --status elenca solo
+// le migrazioni da applicare ed esce con 3 se ce ne sono
+func runMigrateCommand(args []string) int {
+	opts := newOpzioni("migrate")
+	status := opts.fs.Bool("status", false, "mostra le migrazioni da applicare senza eseguirle")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	_, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	versione, err := db.SchemaVersion()
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	if *status {
+		pending, err := db.PendingMigrations()
+		if err != nil {
+			opts.fail(err)
+			return exitErrore
+		}
+		if pending == nil {
+			pending = []database.Migrazione{}
+		}
+
+		opts.output(map[string]interface{}{
+			"versione":     versione,
+			"ultima":       database.LatestSchemaVersion(),
+			"da_applicare": pending,
+		}, func() {
+			fmt.Printf("Versione schema: %d (ultima: %d)\n", versione, database.LatestSchemaVersion())
+			for _, m := range pending {
+				fmt.Printf("  da applicare: %d - %s\n", m.Versione, m.Descrizione)
+			}
+		})
+
+		if len(pending) > 0 {
+			return exitProblemi
+		}
+		return exitOK
+	}
+
+	eseguite, err := db.Migrate()
+	for _, m := range eseguite {
+		logger.Info("Migrazione %d applicata: %s (%d record)", m.Versione, m.Descrizione, m.Modificati)
+	}
+	if eseguite == nil {
+		eseguite = []database.MigrazioneEseguita{}
+	}
+
+	risultato := map[string]interface{}{
+		"versione_precedente": versione,
+		"eseguite":            eseguite,
+	}
+	if err != nil {
+		risultato["errore"] = err.Error()
+	}
+
+	opts.output(risultato, func() {
+		for _, m := range eseguite {
+			fmt.Printf("✓ %d - %s (%d record)\n", m.Versione, m.Descrizione, m.Modificati)
+		}
+		if len(eseguite) == 0 && err == nil {
+			fmt.Printf("Schema già aggiornato (versione %d)\n", versione)
+		}
+	})
+
+	if err != nil {
+		logger.Error("Migrazione fallita: %v", err)
+		opts.fail(err)
+		return exitErrore
+	}
+	return exitOK
+}
+
+// runRegistroCommand gestisce "officina registro": mostra chi ha modificato
+// i dati, dalla voce più recente
+func runRegistroCommand(args []string) int {
+	opts := newOpzioni("registro")
+	var f database.FiltroAttivita
+	opts.fs.StringVar(&f.Operatore, "operatore", "", "solo le voci dell'operatore con questa matricola")
+	opts.fs.StringVar(&f.Collezione, "collezione", "", "solo le voci di questa collezione")
+	opts.fs.IntVar(&f.Limite, "limite", 50, "numero massimo di voci (0 = tutte)")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	_, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	list, err := db.ListAttivita(f)
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+	if list == nil {
+		list = []database.Attivita{}
+	}
+
+	opts.output(list, func() {
+		for _, a := range list {
+			operatore := a.Operatore
+			if operatore == "" {
+				operatore = "-"
+			}
+			fmt.Printf("%s  %-10s %-8s %-12s %-20s #%d\n",
+				a.Data.Format("2006-01-02 15:04:05"), operatore, a.Origine, a.Azione, a.Collezione, a.RecordID)
+		}
+	})
+	return exitOK
+}
+
+// runVersionCommand gestisce "officina version"
+func runVersionCommand(args []string) int {
+	opts := newOpzioni("version")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	info := map[string]string{
+		"version":    Version,
+		"commit":     Commit,
+		"build_time": BuildTime,
+		"go":         runtime.Version(),
+		"platform":   runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	opts.output(info, func() {
+		fmt.Printf("officina %s (commit %s, build %s, %s %s)\n",
+			Version, Commit, BuildTime, info["go"], info["platform"])
+	})
+	return exitOK
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"officina/api"
+	"officina/logger"
+)
+
+// runServeCommand gestisce "officina serve": avvia l'API REST finché non
+// riceve Ctrl+C o SIGTERM. Con --openapi stampa il documento OpenAPI ed
+// esce senza collegarsi al database.
+func runServeCommand(args []string) int {
+	opts := newOpzioni("serve")
+	openapi := opts.fs.Bool("openapi", false, "stampa il documento OpenAPI ed esce")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	if *openapi {
+		doc, err := api.OpenAPI(Version)
+		if err != nil {
+			opts.fail(err)
+			return exitErrore
+		}
+		fmt.Println(string(doc))
+		return exitOK
+	}
+
+	cfg, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	defer avviaEventi(cfg, db)()
+
+	ctx, stopSignal := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignal()
+
+	srv := api.NewServer(db, cfg.App.Version)
+	fmt.Fprintf(os.Stderr, "API in ascolto su http://%s%s (Ctrl+C per terminare)\n", cfg.API.Listen, api.Prefisso)
+	if err := srv.ListenAndServe(ctx, cfg.API.Listen); err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+	return exitOK
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+
+	"officina/logger"
+	"officina/sshserver"
+)
+
+// runSSHServeCommand gestisce "officina ssh-serve": serve l'interfaccia a
+// schermo intero a più operatori via SSH finché non riceve Ctrl+C o SIGTERM
+func runSSHServeCommand(args []string) int {
+	opts := newOpzioni("ssh-serve")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	cfg, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	// Gli stili sono globali e il processo non ha un terminale proprio: i
+	// colori sono fissati al profilo usato per le sessioni
+	lipgloss.SetColorProfile(termenv.ANSI256)
+
+	srv, err := sshserver.NewServer(db, cfg)
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	chiavi, err := sshserver.CaricaChiavi(cfg.SSH.AuthorizedKeys)
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+	if len(chiavi) == 0 {
+		fmt.Fprintf(os.Stderr, "Attenzione: nessuna chiave operatore in %s, nessuno potrà collegarsi\n", cfg.SSH.AuthorizedKeys)
+	}
+
+	defer avviaEventi(cfg, db)()
+
+	ctx, stopSignal := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignal()
+
+	fmt.Fprintf(os.Stderr, "Server SSH in ascolto su %s (Ctrl+C per terminare)\n", cfg.SSH.Listen)
+	if err := srv.ListenAndServe(ctx); err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+	return exitOK
+}
@@ -0,0 +1,90 @@
+package sshserver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ChiaveOperatore associa una chiave pubblica SSH a un operatore
+type ChiaveOperatore struct {
+	Matricola string
+	Chiave    gossh.PublicKey
+	Commento  string
+}
+
+// LeggiChiavi interpreta il file delle chiavi degli operatori: una chiave
+// per riga, preceduta dalla matricola, nel formato di authorized_keys
+//
+//	OPR001 ssh-ed25519 AAAAC3Nza... mario@banco1
+//
+// Le righe vuote e quelle che iniziano con # sono ignorate.
+func LeggiChiavi(r io.Reader) ([]ChiaveOperatore, error) {
+	var chiavi []ChiaveOperatore
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	riga := 0
+	for scanner.Scan() {
+		riga++
+		testo := strings.TrimSpace(scanner.Text())
+		if testo == "" || strings.HasPrefix(testo, "#") {
+			continue
+		}
+
+		matricola, chiave, ok := strings.Cut(testo, " ")
+		if !ok || strings.TrimSpace(chiave) == "" {
+			return nil, fmt.Errorf("riga %d: attesi matricola e chiave pubblica", riga)
+		}
+
+		pub, commento, _, _, err := gossh.ParseAuthorizedKey([]byte(strings.TrimSpace(chiave)))
+		if err != nil {
+			return nil, fmt.Errorf("riga %d: chiave di %s non valida: %w", riga, matricola, err)
+		}
+		chiavi = append(chiavi, ChiaveOperatore{
+			Matricola: strings.ToUpper(matricola),
+			Chiave:    pub,
+			Commento:  commento,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("errore lettura chiavi: %w", err)
+	}
+
+	return chiavi, nil
+}
+
+// CaricaChiavi legge il file delle chiavi; un file assente equivale a
+// nessuna chiave autorizzata
+func CaricaChiavi(path string) ([]ChiaveOperatore, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore apertura %s: %w", path, err)
+	}
+	defer f.Close()
+
+	chiavi, err := LeggiChiavi(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return chiavi, nil
+}
+
+// cercaMatricola restituisce la matricola associata alla chiave
+func cercaMatricola(chiavi []ChiaveOperatore, chiave gossh.PublicKey) (string, bool) {
+	dati := chiave.Marshal()
+	for _, c := range chiavi {
+		if bytes.Equal(c.Chiave.Marshal(), dati) {
+			return c.Matricola, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,65 @@
+package sshserver
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// chiaveDiProva genera una chiave ed25519 e la sua riga authorized_keys
+func chiaveDiProva(t *testing.T) (gossh.PublicKey, string) {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, strings.TrimSpace(string(gossh.MarshalAuthorizedKey(k)))
+}
+
+func TestLeggiChiavi(t *testing.T) {
+	mario, rigaMario := chiaveDiProva(t)
+	luca, rigaLuca := chiaveDiProva(t)
+	estranea, _ := chiaveDiProva(t)
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+		chiave  gossh.PublicKey
+		want    string // matricola attesa, "" se la chiave non è autorizzata
+	}{
+		{"chiave trovata", "OPR001 " + rigaMario + " mario@banco1\nopr002 " + rigaLuca, "", mario, "OPR001"},
+		{"matricola maiuscola", "# commento\n\nopr002 " + rigaLuca + "\n", "", luca, "OPR002"},
+		{"chiave estranea", "OPR001 " + rigaMario, "", estranea, ""},
+		{"file vuoto", "", "", mario, ""},
+		{"senza matricola", rigaMario, "riga 1", nil, ""},
+		{"solo matricola", "# operatori\nOPR001", "riga 2: attesi matricola", nil, ""},
+		{"chiave non valida", "OPR001 ssh-ed25519 AAAA", "riga 1: chiave di OPR001 non valida", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chiavi, err := LeggiChiavi(strings.NewReader(tt.file))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("errore = %v, atteso %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("errore inatteso: %v", err)
+			}
+
+			got, ok := cercaMatricola(chiavi, tt.chiave)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("cercaMatricola = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
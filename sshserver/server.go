@@ -0,0 +1,167 @@
+// Package sshserver serve l'interfaccia a schermo intero via SSH (officina
+// ssh-serve): ogni connessione ha la propria sessione dell'applicazione,
+// con l'operatore individuato dalla chiave pubblica, e tutte condividono
+// la connessione al database del processo.
+package sshserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/activeterm"
+	bm "github.com/charmbracelet/wish/bubbletea"
+	"github.com/muesli/termenv"
+	gossh "golang.org/x/crypto/ssh"
+
+	"officina/config"
+	"officina/database"
+	"officina/logger"
+	"officina/ui/screens"
+)
+
+// Chiavi dei valori salvati nel contesto della connessione
+type chiaveContesto string
+
+const (
+	ctxMatricola chiaveContesto = "matricola"
+	ctxSessione  chiaveContesto = "sessione"
+)
+
+// Server accetta le connessioni SSH degli operatori
+type Server struct {
+	db       *database.DB
+	cfg      *config.Config
+	srv      *ssh.Server
+	sessioni atomic.Int64 // numerazione delle sessioni per il log
+	attive   atomic.Int64
+}
+
+// NewServer prepara il server SSH; la chiave del server viene generata al
+// primo avvio in cfg.SSH.HostKey
+func NewServer(db *database.DB, cfg *config.Config) (*Server, error) {
+	s := &Server{db: db, cfg: cfg}
+
+	srv, err := wish.NewServer(
+		wish.WithAddress(cfg.SSH.Listen),
+		wish.WithHostKeyPath(cfg.SSH.HostKey),
+		wish.WithPublicKeyAuth(s.autentica),
+		wish.WithMiddleware(
+			bm.MiddlewareWithColorProfile(s.avvia, termenv.ANSI256),
+			activeterm.Middleware(),
+			s.registra,
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("errore configurazione server SSH: %w", err)
+	}
+	s.srv = srv
+	return s, nil
+}
+
+// ListenAndServe accetta connessioni finché ctx non viene cancellato; alla
+// chiusura le sessioni aperte vengono terminate
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.SSH.Listen)
+	if err != nil {
+		return fmt.Errorf("impossibile ascoltare su %s: %w", s.cfg.SSH.Listen, err)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.srv.Serve(ln) }()
+	logger.Info("Server SSH in ascolto su %s", ln.Addr())
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.srv.Shutdown(shutdownCtx); err != nil {
+			// Le sessioni TUI non terminano da sole: si chiudono le connessioni
+			s.srv.Close()
+		}
+		if err := <-errc; err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+			return err
+		}
+		logger.Info("Server SSH arrestato")
+		return nil
+	}
+}
+
+// autentica accetta solo le chiavi associate a un operatore esistente. Il
+// file delle chiavi è riletto a ogni connessione: aggiunte e revoche valgono
+// senza riavviare il server.
+func (s *Server) autentica(ctx ssh.Context, chiave ssh.PublicKey) bool {
+	impronta := gossh.FingerprintSHA256(chiave)
+
+	chiavi, err := CaricaChiavi(s.cfg.SSH.AuthorizedKeys)
+	if err != nil {
+		logger.Error("SSH: %v", err)
+		return false
+	}
+	matricola, ok := cercaMatricola(chiavi, chiave)
+	if !ok {
+		logger.Warn("SSH: chiave %s da %s non autorizzata (utente %s)", impronta, ctx.RemoteAddr(), ctx.User())
+		return false
+	}
+
+	o, err := s.db.GetOperatoreByMatricola(matricola)
+	if err != nil {
+		logger.Error("SSH: %v", err)
+		return false
+	}
+	if o == nil {
+		logger.Warn("SSH: chiave %s associata a %s, operatore inesistente", impronta, matricola)
+		return false
+	}
+
+	ctx.SetValue(ctxMatricola, o.Matricola)
+	return true
+}
+
+// registra numera la sessione e ne scrive nel log apertura e chiusura
+func (s *Server) registra(next ssh.Handler) ssh.Handler {
+	return func(sess ssh.Session) {
+		id := s.sessioni.Add(1)
+		sess.Context().SetValue(ctxSessione, id)
+		matricola, _ := sess.Context().Value(ctxMatricola).(string)
+
+		pty, _, _ := sess.Pty()
+		inizio := time.Now()
+		attive := s.attive.Add(1)
+		logger.Info("SSH #%d: aperta da %s, operatore %s, terminale %s %dx%d (%d attive)",
+			id, sess.RemoteAddr(), matricola, pty.Term, pty.Window.Width, pty.Window.Height, attive)
+
+		defer func() {
+			attive := s.attive.Add(-1)
+			logger.Info("SSH #%d: chiusa dopo %s (%d attive)", id, time.Since(inizio).Round(time.Second), attive)
+		}()
+		next(sess)
+	}
+}
+
+// avvia crea la sessione dell'applicazione per la connessione
+func (s *Server) avvia(sess ssh.Session) (tea.Model, []tea.ProgramOption) {
+	id, _ := sess.Context().Value(ctxSessione).(int64)
+	matricola, _ := sess.Context().Value(ctxMatricola).(string)
+
+	// L'operatore è riletto per partire con ruolo e dati aggiornati
+	o, err := s.db.GetOperatoreByMatricola(matricola)
+	if err != nil || o == nil {
+		logger.Error("SSH #%d: operatore %s non disponibile: %v", id, matricola, err)
+		wish.Fatalln(sess, "Operatore non disponibile, riprova più tardi.")
+		return nil, nil
+	}
+
+	// Ogni sessione legge la propria copia della configurazione: le sessioni
+	// girano in goroutine diverse e Config non è protetta da lock
+	m := screens.NewModelOperatore(s.db, s.cfg.Clone(), database.OrigineSSH, o)
+	return m, []tea.ProgramOption{tea.WithAltScreen()}
+}
@@ -0,0 +1,223 @@
+package stampa
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"officina/database"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Dati sono i dati a disposizione dei modelli. Officina è sempre presente;
+// gli altri campi dipendono dal documento: Fattura con Scadenze e Commesse
+// per il modello fattura, Preventivo per il preventivo, Commessa per
+// l'ordine di lavoro. Cliente e Veicolo possono mancare.
+type Dati struct {
+	Titolo   string // "Fattura", "Nota di credito", "Preventivo", ...
+	Numero   string
+	Data     time.Time
+	Stampato time.Time
+
+	// Cortesia indica la copia di cortesia di una fattura elettronica: il
+	// documento fiscale è il file XML trasmesso allo SDI
+	Cortesia bool
+
+	Officina *database.ProfiloAzienda
+	Cliente  *database.Cliente
+	Veicolo  *database.Veicolo
+
+	Fattura  *database.Fattura
+	Scadenze []database.Scadenza
+	Commesse []database.Commessa // commesse fatturate
+
+	Preventivo *database.Preventivo
+	Imponibile float64 // scorporo del totale del preventivo
+	Imposta    float64
+
+	Commessa *database.Commessa
+}
+
+// DatiFattura raccoglie i dati della fattura id
+func DatiFattura(db *database.DB, id int) (*Dati, error) {
+	f, err := db.GetFattura(id)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura fattura: %w", err)
+	}
+	d, err := nuoviDati(db, database.DescrizioneTipoDocumento(f.Tipo), f.Numero, f.Data)
+	if err != nil {
+		return nil, err
+	}
+	d.Fattura = f
+	d.Cortesia = f.TipoDocumento() != database.TipoDocumentoProforma
+	d.Scadenze = f.Scadenze()
+	if d.Cliente, err = cliente(db, f.ClienteID); err != nil {
+		return nil, err
+	}
+	for _, cid := range f.Commesse {
+		c, err := db.GetCommessa(cid)
+		if err != nil {
+			return nil, fmt.Errorf("errore lettura commessa %d: %w", cid, err)
+		}
+		d.Commesse = append(d.Commesse, *c)
+	}
+	// Il veicolo è indicato quando la fattura riguarda una sola commessa
+	if len(d.Commesse) == 1 {
+		if d.Veicolo, err = veicolo(db, d.Commesse[0].VeicoloID); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// DatiPreventivo raccoglie i dati del preventivo id; il cliente del
+// preventivo è un nome, cercato in anagrafica per completare l'indirizzo
+func DatiPreventivo(db *database.DB, id int) (*Dati, error) {
+	p, err := db.GetPreventivo(id)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura preventivo: %w", err)
+	}
+	d, err := nuoviDati(db, "Preventivo", p.Numero, p.Data)
+	if err != nil {
+		return nil, err
+	}
+	d.Preventivo = p
+	d.Imponibile, d.Imposta = d.Officina.ScorporoIVA(p.Totale)
+
+	d.Cliente = &database.Cliente{RagioneSociale: p.Cliente}
+	clienti, err := db.ListClienti()
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura clienti: %w", err)
+	}
+	for i := range clienti {
+		if strings.EqualFold(strings.TrimSpace(clienti[i].RagioneSociale), strings.TrimSpace(p.Cliente)) {
+			d.Cliente = &clienti[i]
+			break
+		}
+	}
+	return d, nil
+}
+
+// DatiOrdine raccoglie i dati dell'ordine di lavoro della commessa id
+func DatiOrdine(db *database.DB, id int) (*Dati, error) {
+	c, err := db.GetCommessa(id)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura commessa: %w", err)
+	}
+	d, err := nuoviDati(db, "Ordine di lavoro", c.Numero, c.DataApertura)
+	if err != nil {
+		return nil, err
+	}
+	d.Commessa = c
+	if d.Veicolo, err = veicolo(db, c.VeicoloID); err != nil {
+		return nil, err
+	}
+	if d.Veicolo != nil {
+		if d.Cliente, err = cliente(db, d.Veicolo.ClienteID); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func nuoviDati(db *database.DB, titolo, numero string, data time.Time) (*Dati, error) {
+	p, err := db.GetProfiloAzienda()
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura dati officina: %w", err)
+	}
+	return &Dati{Titolo: titolo, Numero: numero, Data: data, Stampato: time.Now(), Officina: p}, nil
+}
+
+// cliente legge il cliente id, nil se non indicato o non più in anagrafica
+func cliente(db *database.DB, id int) (*database.Cliente, error) {
+	if id <= 0 {
+		return nil, nil
+	}
+	c, err := db.GetCliente(id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura cliente: %w", err)
+	}
+	return c, nil
+}
+
+// veicolo legge il veicolo id, nil se non più in anagrafica
+func veicolo(db *database.DB, id int) (*database.Veicolo, error) {
+	v, err := db.GetVeicolo(id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura veicolo: %w", err)
+	}
+	return v, nil
+}
+
+// Documento prepara il PDF del modello per il record id (fattura,
+// preventivo o commessa) con i modelli di dir e ne propone il nome del file
+func Documento(db *database.DB, modello string, id int, dir string) (string, []byte, error) {
+	var d *Dati
+	var err error
+	switch modello {
+	case ModelloFattura:
+		d, err = DatiFattura(db, id)
+	case ModelloPreventivo:
+		d, err = DatiPreventivo(db, id)
+	case ModelloOrdine:
+		d, err = DatiOrdine(db, id)
+	default:
+		return "", nil, fmt.Errorf("modello sconosciuto: %s (validi: %s)", modello, strings.Join(Modelli, ", "))
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	pdf, err := Genera(modello, d, dir)
+	if err != nil {
+		return "", nil, err
+	}
+	return NomeFile(d), pdf, nil
+}
+
+// Esporta scrive in dirExport il PDF del modello per il record id e ne
+// restituisce il percorso; un file con lo stesso nome è sostituito
+func Esporta(db *database.DB, modello string, id int, dirModelli, dirExport string) (string, error) {
+	nome, pdf, err := Documento(db, modello, id, dirModelli)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dirExport, 0755); err != nil {
+		return "", fmt.Errorf("impossibile creare la directory %s: %w", dirExport, err)
+	}
+	path := filepath.Join(dirExport, nome)
+	if err := os.WriteFile(path, pdf, 0644); err != nil {
+		return "", fmt.Errorf("errore scrittura %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// NomeFile compone il nome del PDF da titolo e numero del documento, per
+// esempio "fattura_2026-0042.pdf" o "ordine_di_lavoro_C0012.pdf"
+func NomeFile(d *Dati) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(d.Titolo + " " + d.Numero) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-':
+			b.WriteRune(r)
+		case r == ' ' || r == '_':
+			b.WriteRune('_')
+		case r == '/' || r == '\\':
+			b.WriteRune('-')
+		}
+	}
+	nome := strings.Trim(b.String(), "_-")
+	if nome == "" {
+		nome = "documento"
+	}
+	return nome + ".pdf"
+}
@@ -0,0 +1,371 @@
+package stampa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// I modelli producono testo in un formato a righe che l'impaginatore
+// trasforma in pagine PDF. Ogni riga è un blocco:
+//
+//	# Titolo                 titolo grande in grassetto
+//	## Sezione               titolo di sezione, sottolineato
+//	! testo                  paragrafo in grassetto
+//	> testo                  riga allineata a destra
+//	testo                    paragrafo, a capo automatico
+//	\testo                   paragrafo che inizia con un carattere riservato
+//	(riga vuota)             spazio verticale
+//	---                      riga orizzontale
+//	@colonne * 20r 30r       colonne delle tabelle in mm: * occupa lo spazio
+//	                         rimasto, r allinea a destra, c al centro
+//	| a | b | c              riga di tabella
+//	|! a | b | c             intestazione di tabella (grassetto su grigio),
+//	                         ripetuta in cima alle pagine successive
+//	|* a | b | c             riga di tabella in grassetto
+//	@riquadro testo          riquadro con bordo per annotazioni e firme
+//	@corpo 9                 dimensione del testo dei blocchi successivi
+//	@spazio 10               spazio verticale in mm
+//	@piede testo             piè di pagina di tutte le pagine
+//	@pagina                  nuova pagina
+//
+// Gli spazi all'inizio delle righe sono ignorati.
+
+// Margini della pagina in punti
+var (
+	margineSinistro = mm(15)
+	margineDestro   = larghezzaPagina - mm(15)
+	margineAlto     = mm(15)
+	margineBasso    = mm(20)
+)
+
+// interlinea è l'altezza di una riga di testo rispetto al corpo
+const interlinea = 1.3
+
+// colonna di una tabella
+type colonna struct {
+	larghezza    float64 // in punti
+	allineamento byte    // 'l', 'r' o 'c'
+}
+
+// impaginatore scrive i blocchi sulle pagine dall'alto in basso
+type impaginatore struct {
+	pdf          *documentoPDF
+	y            float64 // posizione dall'alto della pagina corrente
+	corpo        float64
+	colonne      []colonna
+	intestazione []string // intestazione della tabella in corso
+	piede        string
+}
+
+// ErroreModello segnala una riga del modello che l'impaginatore non capisce
+type ErroreModello struct {
+	Riga      int
+	Messaggio string
+}
+
+func (e *ErroreModello) Error() string {
+	return fmt.Sprintf("riga %d del documento: %s", e.Riga, e.Messaggio)
+}
+
+// impagina converte il testo prodotto da un modello in un file PDF
+func impagina(testo, titolo, autore string, creato time.Time) ([]byte, error) {
+	im := &impaginatore{pdf: nuovoPDF(titolo, autore, creato), corpo: 9}
+	im.colonne = []colonna{{larghezza: margineDestro - margineSinistro, allineamento: 'l'}}
+	im.nuovaPagina()
+
+	for n, riga := range strings.Split(testo, "\n") {
+		if err := im.blocco(strings.TrimLeft(riga, " \t")); err != nil {
+			return nil, &ErroreModello{Riga: n + 1, Messaggio: err.Error()}
+		}
+	}
+	im.chiudiPagina()
+	return im.pdf.Bytes(), nil
+}
+
+// blocco interpreta una riga del documento
+func (im *impaginatore) blocco(riga string) error {
+	switch {
+	case riga == "":
+		im.y += im.corpo * 0.6
+	case riga == "---":
+		im.spazio(im.corpo)
+		im.pdf.linea(margineSinistro, im.base(im.corpo*0.4), margineDestro, im.base(im.corpo*0.4), 0.5, 0.4)
+		im.y += im.corpo
+	case strings.HasPrefix(riga, "## "):
+		corpo := im.corpo + 2
+		im.y += corpo * 0.5
+		im.paragrafo(riga[3:], corpo, true, 'l')
+		im.pdf.linea(margineSinistro, im.base(corpo*0.1), margineDestro, im.base(corpo*0.1), 0.5, 0.6)
+		im.y += corpo * 0.3
+	case strings.HasPrefix(riga, "# "):
+		im.paragrafo(riga[2:], im.corpo*1.8, true, 'l')
+	case strings.HasPrefix(riga, "! "):
+		im.paragrafo(riga[2:], im.corpo, true, 'l')
+	case strings.HasPrefix(riga, "> "):
+		im.paragrafo(riga[2:], im.corpo, false, 'r')
+	case strings.HasPrefix(riga, "\\"):
+		im.paragrafo(riga[1:], im.corpo, false, 'l')
+	case strings.HasPrefix(riga, "|"):
+		im.tabella(riga)
+	case strings.HasPrefix(riga, "@"):
+		return im.comando(riga)
+	default:
+		im.paragrafo(riga, im.corpo, false, 'l')
+	}
+	return nil
+}
+
+// comando esegue una riga @comando
+func (im *impaginatore) comando(riga string) error {
+	nome, arg, _ := strings.Cut(riga[1:], " ")
+	arg = strings.TrimSpace(arg)
+	switch nome {
+	case "colonne":
+		colonne, err := leggiColonne(arg)
+		if err != nil {
+			return err
+		}
+		im.colonne = colonne
+		im.intestazione = nil
+	case "corpo":
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil || v < 5 || v > 40 {
+			return fmt.Errorf("corpo del testo non valido: %q", arg)
+		}
+		im.corpo = v
+	case "spazio":
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("spazio non valido: %q", arg)
+		}
+		im.y += mm(v)
+	case "riquadro":
+		im.riquadro(arg)
+	case "piede":
+		im.piede = arg
+	case "pagina":
+		im.chiudiPagina()
+		im.nuovaPagina()
+	default:
+		return fmt.Errorf("comando sconosciuto: @%s", nome)
+	}
+	return nil
+}
+
+// leggiColonne interpreta le larghezze di @colonne
+func leggiColonne(arg string) ([]colonna, error) {
+	campi := strings.Fields(arg)
+	if len(campi) == 0 {
+		return nil, fmt.Errorf("@colonne senza larghezze")
+	}
+	disponibile := margineDestro - margineSinistro
+	var colonne []colonna
+	variabili := 0
+	occupato := 0.0
+	for _, c := range campi {
+		col := colonna{allineamento: 'l'}
+		if n := len(c) - 1; c[n] == 'r' || c[n] == 'c' || c[n] == 'l' {
+			col.allineamento = c[n]
+			c = c[:n]
+		}
+		if c == "*" {
+			col.larghezza = -1
+			variabili++
+		} else {
+			v, err := strconv.ParseFloat(c, 64)
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("larghezza di colonna non valida: %q", c)
+			}
+			col.larghezza = mm(v)
+			occupato += col.larghezza
+		}
+		colonne = append(colonne, col)
+	}
+	if occupato > disponibile+0.5 {
+		return nil, fmt.Errorf("le colonne superano la larghezza della pagina (%.0f mm)", (disponibile)*25.4/72)
+	}
+	for i := range colonne {
+		if colonne[i].larghezza < 0 {
+			colonne[i].larghezza = (disponibile - occupato) / float64(variabili)
+		}
+	}
+	return colonne, nil
+}
+
+// nuovaPagina apre una pagina e riporta la posizione in cima
+func (im *impaginatore) nuovaPagina() {
+	im.pdf.nuovaPagina()
+	im.y = margineAlto
+}
+
+// chiudiPagina scrive il piè di pagina con il numero della pagina
+func (im *impaginatore) chiudiPagina() {
+	y := margineBasso - mm(8)
+	im.pdf.linea(margineSinistro, y+mm(4), margineDestro, y+mm(4), 0.3, 0.6)
+	if im.piede != "" {
+		for i, r := range spezza(im.piede, 7, false, margineDestro-margineSinistro-mm(25)) {
+			im.pdf.testo(margineSinistro, y-float64(i)*7*interlinea, 7, false, r)
+		}
+	}
+	numero := fmt.Sprintf("Pagina %d", len(im.pdf.pagine))
+	im.pdf.testo(margineDestro-larghezzaTesto(numero, 7, false), y, 7, false, numero)
+}
+
+// spazio passa alla pagina successiva se non restano altezza punti
+func (im *impaginatore) spazio(altezza float64) bool {
+	if im.y+altezza <= altezzaPagina-margineBasso {
+		return false
+	}
+	im.chiudiPagina()
+	im.nuovaPagina()
+	return true
+}
+
+// base converte la posizione dall'alto più scostamento nella coordinata
+// PDF dal basso
+func (im *impaginatore) base(scostamento float64) float64 {
+	return altezzaPagina - im.y - scostamento
+}
+
+// paragrafo scrive il testo andando a capo entro la larghezza della pagina
+func (im *impaginatore) paragrafo(s string, corpo float64, grassetto bool, allineamento byte) {
+	larghezza := margineDestro - margineSinistro
+	for _, r := range spezza(s, corpo, grassetto, larghezza) {
+		h := corpo * interlinea
+		im.spazio(h)
+		im.pdf.testo(allinea(r, margineSinistro, larghezza, corpo, grassetto, allineamento), im.base(corpo), corpo, grassetto, r)
+		im.y += h
+	}
+}
+
+// rigaTabella è una riga di tabella divisa in righe di testo per cella
+type rigaTabella struct {
+	stile byte // 0, '!' intestazione, '*' grassetto
+	celle [][]string
+}
+
+// tabella scrive una riga nelle colonne correnti; le celle vanno a capo
+// entro la loro larghezza e la riga è alta quanto la cella più lunga
+func (im *impaginatore) tabella(riga string) {
+	stile := byte(0)
+	if len(riga) > 1 && (riga[1] == '!' || riga[1] == '*') {
+		stile = riga[1]
+		riga = riga[2:]
+	} else {
+		riga = riga[1:]
+	}
+	celle := strings.Split(riga, "|")
+	for i := range celle {
+		celle[i] = strings.TrimSpace(celle[i])
+	}
+	if stile == '!' {
+		im.intestazione = celle
+	}
+
+	righe, altezza := im.misuraRiga(celle, stile)
+	if im.spazio(altezza) && stile != '!' && im.intestazione != nil {
+		// La tabella riprende con l'intestazione sulla pagina nuova
+		im.scriviRiga(im.misuraRiga(im.intestazione, '!'))
+	}
+	im.scriviRiga(righe, altezza)
+}
+
+// margineCella separa il testo dai bordi della cella
+const margineCella = 2.5
+
+// misuraRiga divide le celle in righe di testo e calcola l'altezza della riga
+func (im *impaginatore) misuraRiga(celle []string, stile byte) (rigaTabella, float64) {
+	r := rigaTabella{stile: stile}
+	altezza := 0.0
+	for i, col := range im.colonne {
+		testo := ""
+		if i < len(celle) {
+			testo = celle[i]
+		}
+		t := spezza(testo, im.corpo, stile != 0, col.larghezza-2*margineCella)
+		r.celle = append(r.celle, t)
+		altezza = max(altezza, float64(len(t))*im.corpo*interlinea)
+	}
+	return r, altezza + margineCella
+}
+
+// scriviRiga disegna una riga misurata nella posizione corrente
+func (im *impaginatore) scriviRiga(r rigaTabella, altezza float64) {
+	grassetto := r.stile != 0
+	if r.stile == '!' {
+		im.pdf.rettangolo(margineSinistro, im.base(altezza), margineDestro-margineSinistro, altezza, 0.88)
+	}
+	x := margineSinistro
+	for i, col := range im.colonne {
+		for j, t := range r.celle[i] {
+			xt := allinea(t, x+margineCella, col.larghezza-2*margineCella, im.corpo, grassetto, col.allineamento)
+			im.pdf.testo(xt, im.base(margineCella/2+im.corpo+float64(j)*im.corpo*interlinea), im.corpo, grassetto, t)
+		}
+		x += col.larghezza
+	}
+	im.y += altezza
+}
+
+// riquadro disegna un riquadro con bordo alto tre righe, con il testo in
+// alto a sinistra: spazio per note scritte a mano e firme
+func (im *impaginatore) riquadro(s string) {
+	larghezza := margineDestro - margineSinistro
+	righe := spezza(s, im.corpo, false, larghezza-mm(4))
+	altezza := float64(len(righe)+2)*im.corpo*interlinea + mm(2)
+	im.spazio(altezza)
+	im.pdf.riquadro(margineSinistro, im.base(altezza), larghezza, altezza, 0.5, 0.4)
+	for i, r := range righe {
+		im.pdf.testo(margineSinistro+mm(2), im.base(mm(1)+im.corpo+float64(i)*im.corpo*interlinea), im.corpo, false, r)
+	}
+	im.y += altezza + mm(2)
+}
+
+// allinea restituisce l'ascissa del testo nella larghezza disponibile
+func allinea(s string, x, larghezza, corpo float64, grassetto bool, allineamento byte) float64 {
+	switch allineamento {
+	case 'r':
+		return x + larghezza - larghezzaTesto(s, corpo, grassetto)
+	case 'c':
+		return x + (larghezza-larghezzaTesto(s, corpo, grassetto))/2
+	}
+	return x
+}
+
+// spezza divide s in righe non più larghe di larghezza, a capo tra le
+// parole; le parole troppo lunghe sono spezzate. Un testo vuoto è una riga
+// vuota.
+func spezza(s string, corpo float64, grassetto bool, larghezza float64) []string {
+	parole := strings.Fields(s)
+	if len(parole) == 0 {
+		return []string{""}
+	}
+	var righe []string
+	corrente := ""
+	for _, p := range parole {
+		prova := p
+		if corrente != "" {
+			prova = corrente + " " + p
+		}
+		if larghezzaTesto(prova, corpo, grassetto) <= larghezza {
+			corrente = prova
+			continue
+		}
+		if corrente != "" {
+			righe = append(righe, corrente)
+		}
+		corrente = ""
+		for larghezzaTesto(p, corpo, grassetto) > larghezza {
+			r := []rune(p)
+			n := len(r) - 1
+			for n > 1 && larghezzaTesto(string(r[:n]), corpo, grassetto) > larghezza {
+				n--
+			}
+			righe = append(righe, string(r[:n]))
+			p = string(r[n:])
+		}
+		corrente = p
+	}
+	return append(righe, corrente)
+}
@@ -0,0 +1,189 @@
+package stampa
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"officina/database"
+	"officina/utils"
+)
+
+// Modelli dei documenti stampabili
+const (
+	ModelloFattura    = "fattura"    // fatture, note di credito e proforma
+	ModelloPreventivo = "preventivo" // preventivi
+	ModelloOrdine     = "ordine"     // ordine di lavoro di una commessa
+)
+
+// Modelli elenca i modelli nell'ordine di "officina stampa modelli"
+var Modelli = []string{ModelloFattura, ModelloPreventivo, ModelloOrdine}
+
+// I modelli predefiniti sono inclusi nel programma; un file <nome>.tmpl
+// nella cartella dei modelli (app.templates_path) li sostituisce.
+//
+//go:embed modelli/*.tmpl
+var modelliPredefiniti embed.FS
+
+// ModelloPredefinito restituisce il testo del modello incluso nel programma
+func ModelloPredefinito(nome string) ([]byte, error) {
+	data, err := modelliPredefiniti.ReadFile("modelli/" + nome + ".tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("modello sconosciuto: %s (validi: %s)", nome, strings.Join(Modelli, ", "))
+	}
+	return data, nil
+}
+
+// FileModello restituisce il percorso del modello personalizzato nome in dir
+func FileModello(dir, nome string) string {
+	return filepath.Join(dir, nome+".tmpl")
+}
+
+// caricaModello legge il modello personalizzato da dir o, se manca, quello
+// predefinito
+func caricaModello(nome, dir string) (*template.Template, error) {
+	data, err := ModelloPredefinito(nome)
+	if err != nil {
+		return nil, err
+	}
+	origine := "predefinito"
+	if dir != "" {
+		path := FileModello(dir, nome)
+		personale, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			data, origine = personale, path
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("errore lettura modello %s: %w", path, err)
+		}
+	}
+	t, err := template.New(nome).Funcs(funzioni).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("modello %s (%s): %w", nome, origine, err)
+	}
+	return t, nil
+}
+
+// ScriviModelli copia in dir i modelli predefiniti da personalizzare; i
+// file già presenti non sono toccati. Restituisce i file scritti.
+func ScriviModelli(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("impossibile creare la directory %s: %w", dir, err)
+	}
+	var scritti []string
+	for _, nome := range Modelli {
+		path := FileModello(dir, nome)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		data, err := ModelloPredefinito(nome)
+		if err != nil {
+			return scritti, err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return scritti, fmt.Errorf("errore scrittura %s: %w", path, err)
+		}
+		scritti = append(scritti, path)
+	}
+	return scritti, nil
+}
+
+// Genera compila il modello con i dati e ne impagina il risultato
+func Genera(nome string, d *Dati, dir string) ([]byte, error) {
+	t, err := caricaModello(nome, dir)
+	if err != nil {
+		return nil, err
+	}
+	var testo bytes.Buffer
+	if err := t.Execute(&testo, d); err != nil {
+		return nil, fmt.Errorf("modello %s: %w", nome, err)
+	}
+	autore := ""
+	if d.Officina != nil {
+		autore = d.Officina.RagioneSociale
+	}
+	pdf, err := impagina(testo.String(), d.Titolo+" "+d.Numero, autore, d.Stampato)
+	if err != nil {
+		return nil, fmt.Errorf("modello %s: %w", nome, err)
+	}
+	return pdf, nil
+}
+
+// funzioni sono a disposizione dei modelli
+var funzioni = template.FuncMap{
+	"euro":        utils.FormatEuro,
+	"data":        utils.FormatDate,
+	"quantita":    quantita,
+	"aliquota":    aliquota,
+	"ivaRiga":     ivaRiga,
+	"natura":      database.DescrizioneNaturaIVA,
+	"pagamento":   database.DescrizioneCondizionePagamento,
+	"regime":      database.DescrizioneRegimeFiscale,
+	"maiuscolo":   strings.ToUpper,
+	"cella":       cella,
+	"paragrafi":   paragrafi,
+	"elenco":      elenco,
+	"progressivo": func(i int) int { return i + 1 },
+}
+
+// quantita scrive una quantità senza decimali superflui
+func quantita(v float64) string {
+	return strings.Replace(strconv.FormatFloat(v, 'f', -1, 64), ".", ",", 1)
+}
+
+// aliquota scrive l'aliquota della riga o, senza IVA, la sua natura
+func aliquota(r database.RigaFattura) string {
+	if r.Natura != "" {
+		return r.Natura
+	}
+	return quantita(r.AliquotaIVA) + "%"
+}
+
+// ivaRiga scrive l'IVA della riga come la applica il regime della fattura:
+// con l'inversione contabile la natura N6 al posto dell'aliquota
+func ivaRiga(f *database.Fattura, r database.RigaFattura) string {
+	r.AliquotaIVA, r.Natura = f.IVARiga(r)
+	return aliquota(r)
+}
+
+// cella rende un testo adatto a una cella di tabella: una sola riga, senza
+// il separatore delle celle
+func cella(s string) string {
+	s = strings.ReplaceAll(s, "|", "/")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// paragrafi divide un testo su più righe in paragrafi del documento; le
+// righe che iniziano con un carattere riservato sono protette con "\"
+func paragrafi(s string) []string {
+	var out []string
+	for _, r := range strings.Split(strings.TrimSpace(s), "\n") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if strings.ContainsAny(r[:1], "#!>|@\\") || r == "---" {
+			r = "\\" + r
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// elenco divide un elenco separato da virgole, come i lavori eseguiti di
+// una commessa
+func elenco(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = cella(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,227 @@
+package stampa
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Il PDF è scritto da un generatore minimo: pagine A4, testo con i font
+// standard Helvetica e Helvetica-Bold (nessun font da incorporare) in
+// codifica WinAnsi, linee e rettangoli pieni in scala di grigi. I caratteri
+// fuori da WinAnsi sono sostituiti da "?".
+
+// Dimensioni della pagina A4 in punti tipografici
+const (
+	larghezzaPagina = 595.28
+	altezzaPagina   = 841.89
+)
+
+// mm converte millimetri in punti
+func mm(v float64) float64 {
+	return v * 72 / 25.4
+}
+
+// documentoPDF raccoglie le pagine in costruzione
+type documentoPDF struct {
+	titolo string
+	autore string
+	creato time.Time
+	pagine []*bytes.Buffer
+	pagina *bytes.Buffer
+}
+
+func nuovoPDF(titolo, autore string, creato time.Time) *documentoPDF {
+	return &documentoPDF{titolo: titolo, autore: autore, creato: creato}
+}
+
+// nuovaPagina apre una pagina vuota su cui disegnano le chiamate successive
+func (d *documentoPDF) nuovaPagina() {
+	d.pagina = &bytes.Buffer{}
+	d.pagine = append(d.pagine, d.pagina)
+}
+
+// testo scrive s con la linea di base in (x, y), misurati in punti dal
+// margine sinistro e dal basso della pagina
+func (d *documentoPDF) testo(x, y, corpo float64, grassetto bool, s string) {
+	font := "F1"
+	if grassetto {
+		font = "F2"
+	}
+	fmt.Fprintf(d.pagina, "BT /%s %s Tf %s %s Td (%s) Tj ET\n",
+		font, numeroPDF(corpo), numeroPDF(x), numeroPDF(y), stringaPDF(s))
+}
+
+// linea traccia un segmento del grigio indicato (0 nero, 1 bianco)
+func (d *documentoPDF) linea(x1, y1, x2, y2, spessore, grigio float64) {
+	fmt.Fprintf(d.pagina, "%s G %s w %s %s m %s %s l S\n",
+		numeroPDF(grigio), numeroPDF(spessore),
+		numeroPDF(x1), numeroPDF(y1), numeroPDF(x2), numeroPDF(y2))
+}
+
+// rettangolo riempie il rettangolo con angolo in basso a sinistra in (x, y)
+func (d *documentoPDF) rettangolo(x, y, w, h, grigio float64) {
+	fmt.Fprintf(d.pagina, "%s g %s %s %s %s re f 0 g\n",
+		numeroPDF(grigio), numeroPDF(x), numeroPDF(y), numeroPDF(w), numeroPDF(h))
+}
+
+// riquadro traccia il bordo del rettangolo
+func (d *documentoPDF) riquadro(x, y, w, h, spessore, grigio float64) {
+	fmt.Fprintf(d.pagina, "%s G %s w %s %s %s %s re S\n",
+		numeroPDF(grigio), numeroPDF(spessore),
+		numeroPDF(x), numeroPDF(y), numeroPDF(w), numeroPDF(h))
+}
+
+// Bytes restituisce il file PDF: catalogo, albero delle pagine, i due font,
+// le pagine con i loro contenuti, le informazioni e la tabella xref
+func (d *documentoPDF) Bytes() []byte {
+	if len(d.pagine) == 0 {
+		d.nuovaPagina()
+	}
+
+	var out bytes.Buffer
+	var offset []int
+	oggetto := func(corpo string) {
+		offset = append(offset, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offset), corpo)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalogo, 2 pagine, 3-4 font, 5 informazioni, poi pagina e
+	// contenuto per ogni pagina
+	primaPagina := 6
+	var kids []string
+	for i := range d.pagine {
+		kids = append(kids, fmt.Sprintf("%d 0 R", primaPagina+2*i))
+	}
+	oggetto("<< /Type /Catalog /Pages 2 0 R >>")
+	oggetto(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pagine)))
+	oggetto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	oggetto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	oggetto(fmt.Sprintf("<< /Title (%s) /Author (%s) /Producer (Officina Manager) /CreationDate (D:%s) >>",
+		stringaPDF(d.titolo), stringaPDF(d.autore), d.creato.Format("20060102150405")))
+
+	for i, p := range d.pagine {
+		oggetto(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			numeroPDF(larghezzaPagina), numeroPDF(altezzaPagina), primaPagina+2*i+1))
+		oggetto(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.Len(), p.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offset)+1)
+	for _, o := range offset {
+		fmt.Fprintf(&out, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offset)+1, xref)
+	return out.Bytes()
+}
+
+// numeroPDF scrive un numero con al più due decimali
+func numeroPDF(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// stringaPDF converte s in una stringa letterale WinAnsi
+func stringaPDF(s string) string {
+	var b strings.Builder
+	for _, c := range winAnsi(s) {
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c < 32 {
+				b.WriteByte(' ')
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// Caratteri WinAnsi (cp1252) fuori dal Latin-1
+var cp1252 = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+	'›': 0x9b, '‹': 0x8b,
+}
+
+// winAnsi codifica s in cp1252
+func winAnsi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for len(s) > 0 {
+		r, n := utf8.DecodeRuneInString(s)
+		s = s[n:]
+		switch {
+		case r < 0x80, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		case cp1252[r] != 0:
+			out = append(out, cp1252[r])
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// Larghezze dei caratteri ASCII da 32 a 126 in millesimi del corpo, dalle
+// metriche AFM dei font standard
+var (
+	larghezzeHelvetica = [95]uint16{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	larghezzeGrassetto = [95]uint16{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// Lettere accentate misurate come la lettera di base
+var lettereBase = map[byte]byte{
+	0xe0: 'a', 0xe1: 'a', 0xe2: 'a', 0xe4: 'a', 0xe8: 'e', 0xe9: 'e', 0xea: 'e', 0xeb: 'e',
+	0xec: 'i', 0xed: 'i', 0xee: 'i', 0xef: 'i', 0xf2: 'o', 0xf3: 'o', 0xf4: 'o', 0xf6: 'o',
+	0xf9: 'u', 0xfa: 'u', 0xfb: 'u', 0xfc: 'u', 0xe7: 'c', 0xf1: 'n',
+	0xc0: 'A', 0xc1: 'A', 0xc8: 'E', 0xc9: 'E', 0xcc: 'I', 0xcd: 'I', 0xd2: 'O', 0xd3: 'O',
+	0xd9: 'U', 0xda: 'U', 0xc7: 'C', 0xd1: 'N',
+}
+
+// larghezzaTesto misura s in punti al corpo indicato
+func larghezzaTesto(s string, corpo float64, grassetto bool) float64 {
+	tabella := &larghezzeHelvetica
+	if grassetto {
+		tabella = &larghezzeGrassetto
+	}
+	var totale int
+	for _, c := range winAnsi(s) {
+		if base, ok := lettereBase[c]; ok {
+			c = base
+		}
+		switch {
+		case c >= 32 && c <= 126:
+			totale += int(tabella[c-32])
+		case c == 0x95, c == 0xb7:
+			totale += 350
+		case c == 0xb0:
+			totale += 400
+		default:
+			totale += 556
+		}
+	}
+	return float64(totale) * corpo / 1000
+}
@@ -0,0 +1,269 @@
+package stampa
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"officina/database"
+)
+
+// esempio restituisce i dati di una fattura di due commesse a rate
+func esempio() *Dati {
+	p := database.NuovoProfiloAzienda()
+	p.RagioneSociale = "Officina Rossi S.r.l."
+	p.PartitaIVA = "12345678903"
+	p.Indirizzo = "Via Roma 1"
+	p.CAP = "00100"
+	p.Citta = "Roma"
+	p.Provincia = "RM"
+	p.IBAN = "IT60X0542811101000000123456"
+
+	f := &database.Fattura{
+		ID: 40, Tipo: database.TipoDocumentoDifferita, Numero: "2026/0042",
+		Data: time.Date(2026, 3, 5, 0, 0, 0, 0, time.Local), ClienteID: 1,
+		Pagamento: database.Pagamento3060FM,
+		Righe: []database.RigaFattura{
+			{Descrizione: "Manodopera (tagliando) | controllo freni", Quantita: 2.5, PrezzoUnitario: 40, AliquotaIVA: 22},
+			{Descrizione: "Filtro olio", Quantita: 1, PrezzoUnitario: 12.9, Sconto: 10, AliquotaIVA: 22},
+			{Descrizione: "Bollo auto anticipato", Quantita: 1, PrezzoUnitario: 150.75, Natura: "N1"},
+		},
+	}
+	f.Calcola()
+
+	return &Dati{
+		Titolo: "Fattura differita", Numero: f.Numero, Data: f.Data,
+		Stampato: time.Date(2026, 3, 6, 10, 0, 0, 0, time.UTC),
+		Cortesia: true,
+		Officina: p,
+		Cliente:  &database.Cliente{RagioneSociale: "Trasporti Bianchi S.p.A.", PartitaIVA: "01234567897", Citta: "Milano"},
+		Fattura:  f,
+		Scadenze: f.Scadenze(),
+		Commesse: []database.Commessa{
+			{ID: 1, Numero: "C0001", DataChiusura: time.Date(2026, 2, 10, 0, 0, 0, 0, time.Local)},
+			{ID: 2, Numero: "C0002", DataChiusura: time.Date(2026, 2, 20, 0, 0, 0, 0, time.Local)},
+		},
+	}
+}
+
+// testoPDF estrae le stringhe scritte nelle pagine, decodificate da WinAnsi
+func testoPDF(t *testing.T, pdf []byte) string {
+	t.Helper()
+	var b strings.Builder
+	for _, m := range regexp.MustCompile(`\((.*?)\) Tj`).FindAllSubmatch(pdf, -1) {
+		s := strings.NewReplacer(`\(`, "(", `\)`, ")", `\\`, `\`).Replace(string(m[1]))
+		for _, c := range []byte(s) {
+			if c == 0x80 {
+				b.WriteRune('€')
+			} else {
+				b.WriteRune(rune(c))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// controllaXref verifica che la tabella xref punti all'inizio di ogni oggetto
+func controllaXref(t *testing.T, pdf []byte) int {
+	t.Helper()
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("startxref mancante")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d non punta alla tabella xref", xref)
+	}
+	voci := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	for i, v := range voci {
+		off, _ := strconv.Atoi(string(v[1]))
+		if atteso := strconv.Itoa(i+1) + " 0 obj\n"; !bytes.HasPrefix(pdf[off:], []byte(atteso)) {
+			t.Errorf("oggetto %d: l'offset %d non punta a %q", i+1, off, atteso)
+		}
+	}
+	return len(voci)
+}
+
+func TestGeneraFattura(t *testing.T) {
+	pdf, err := Genera(ModelloFattura, esempio(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) {
+		t.Fatalf("intestazione PDF mancante: %q", pdf[:10])
+	}
+	if n := controllaXref(t, pdf); n != 7 {
+		t.Errorf("oggetti = %d, attesi 7 (una pagina)", n)
+	}
+
+	testo := testoPDF(t, pdf)
+	for _, atteso := range []string{
+		"FATTURA DIFFERITA N. 2026/0042",
+		"Spett.le Trasporti Bianchi S.p.A.",
+		"Commesse: C0001 del 10/02/2026 C0002 del 20/02/2026",
+		"Manodopera (tagliando) / controllo freni",
+		"2,5",
+		"N1 - ",
+		"Totale documento",
+		"2 rate 30/60 gg fine mese",
+		"30/04/2026",
+		"IBAN IT60X0542811101000000123456",
+		"Copia di cortesia",
+		"Pagina 1",
+	} {
+		if !strings.Contains(testo, atteso) {
+			t.Errorf("testo %q mancante in:\n%s", atteso, testo)
+		}
+	}
+
+	// Regime IVA e ritenuta riportano le diciture e il netto a pagare
+	d := esempio()
+	d.Fattura.RegimeIVA = database.RegimeIVAScissione
+	d.Fattura.RitenutaTipo, d.Fattura.RitenutaAliquota, d.Fattura.RitenutaCausale = database.RitenutaPersoneFisiche, 20, "A"
+	d.Fattura.Calcola()
+	pdf, err = Genera(ModelloFattura, d, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testo = testoPDF(t, pdf)
+	for _, atteso := range []string{"IVA in scissione dei pagamenti", "Ritenuta d'acconto 20%", "Netto a pagare", "€ 240.04", "17-ter"} {
+		if !strings.Contains(testo, atteso) {
+			t.Errorf("regime: testo %q mancante in:\n%s", atteso, testo)
+		}
+	}
+}
+
+func TestGeneraModelli(t *testing.T) {
+	d := esempio()
+	d.Titolo, d.Numero = "Preventivo", "P0007"
+	d.Preventivo = &database.Preventivo{Numero: "P0007", Totale: 122, Descrizione: "Sostituzione frizione\n# volano compreso"}
+	d.Imponibile, d.Imposta = d.Officina.ScorporoIVA(122)
+	pdf, err := Genera(ModelloPreventivo, d, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testo := testoPDF(t, pdf)
+	for _, atteso := range []string{"PREVENTIVO N. P0007", "# volano compreso", "IVA 22%", "€ 100.00", "Per accettazione"} {
+		if !strings.Contains(testo, atteso) {
+			t.Errorf("preventivo: testo %q mancante in:\n%s", atteso, testo)
+		}
+	}
+
+	d = esempio()
+	d.Titolo, d.Numero = "Ordine di lavoro", "C0003"
+	d.Commessa = &database.Commessa{Numero: "C0003", Stato: database.StatoCommessaAperta,
+		DataApertura: time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local), LavoriEseguiti: "Tagliando, Cambio gomme"}
+	d.Veicolo = &database.Veicolo{Targa: "AB123CD", Marca: "Fiat", Modello: "Panda", Anno: 2019}
+	pdf, err = Genera(ModelloOrdine, d, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testo = testoPDF(t, pdf)
+	for _, atteso := range []string{"ORDINE DI LAVORO N. C0003", "AB123CD", "Fiat Panda", "1.", "Tagliando", "2.", "Cambio gomme", "Ritiro del veicolo"} {
+		if !strings.Contains(testo, atteso) {
+			t.Errorf("ordine: testo %q mancante in:\n%s", atteso, testo)
+		}
+	}
+}
+
+func TestModelloPersonalizzato(t *testing.T) {
+	dir := t.TempDir()
+	scritti, err := ScriviModelli(dir)
+	if err != nil || len(scritti) != len(Modelli) {
+		t.Fatalf("ScriviModelli = %v, %v", scritti, err)
+	}
+
+	// Un modello modificato sostituisce il predefinito e non è sovrascritto
+	personale := "# Fattura {{.Numero}}\n@colonne * 30r\n{{range .Fattura.Righe}}| {{cella .Descrizione}} | {{euro .Imponibile}}\n{{end}}"
+	if err := os.WriteFile(FileModello(dir, ModelloFattura), []byte(personale), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if scritti, _ := ScriviModelli(dir); len(scritti) != 0 {
+		t.Errorf("ScriviModelli ha sovrascritto %v", scritti)
+	}
+	pdf, err := Genera(ModelloFattura, esempio(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testo := testoPDF(t, pdf); !strings.Contains(testo, "Fattura 2026/0042") || strings.Contains(testo, "Copia di cortesia") {
+		t.Errorf("modello personalizzato non usato:\n%s", testo)
+	}
+
+	// Errori del modello e dei blocchi
+	os.WriteFile(FileModello(dir, ModelloFattura), []byte("{{.Inesistente}}"), 0644)
+	if _, err := Genera(ModelloFattura, esempio(), dir); err == nil || !strings.Contains(err.Error(), "Inesistente") {
+		t.Errorf("campo inesistente: errore %v", err)
+	}
+	os.WriteFile(FileModello(dir, ModelloFattura), []byte("# Titolo\n@colonne 100 100\n"), 0644)
+	var em *ErroreModello
+	if _, err := Genera(ModelloFattura, esempio(), dir); !errors.As(err, &em) || em.Riga != 2 {
+		t.Errorf("colonne troppo larghe: errore %v", err)
+	}
+	if _, err := Genera("fattura", esempio(), filepath.Join(dir, "mancante")); err != nil {
+		t.Errorf("cartella dei modelli mancante: %v", err)
+	}
+}
+
+func TestImpaginaPiuPagine(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("@piede Officina di prova\n@colonne * 30r\n|! Descrizione | Importo\n")
+	for i := 0; i < 120; i++ {
+		b.WriteString("| Riga " + strconv.Itoa(i) + " | € 1.00\n")
+	}
+	pdf, err := impagina(b.String(), "Prova", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pagine := controllaXref(t, pdf) - 5
+	if pagine%2 != 0 || pagine/2 < 2 {
+		t.Fatalf("oggetti delle pagine = %d, attese almeno due pagine", pagine)
+	}
+	testo := testoPDF(t, pdf)
+	if n := strings.Count(testo, "Descrizione\n"); n != pagine/2 {
+		t.Errorf("intestazione ripetuta %d volte su %d pagine", n, pagine/2)
+	}
+	if !strings.Contains(testo, "Riga 119") || !strings.Contains(testo, "Pagina 2") {
+		t.Errorf("righe o numeri di pagina mancanti")
+	}
+}
+
+func TestSpezza(t *testing.T) {
+	righe := spezza("Sostituzione delle pastiglie dei freni anteriori", 10, false, 100)
+	if len(righe) < 2 {
+		t.Fatalf("spezza = %q, attese più righe", righe)
+	}
+	for _, r := range righe {
+		if w := larghezzaTesto(r, 10, false); w > 100 {
+			t.Errorf("riga %q larga %.1f > 100", r, w)
+		}
+	}
+	if got := strings.Join(righe, " "); got != "Sostituzione delle pastiglie dei freni anteriori" {
+		t.Errorf("testo ricomposto = %q", got)
+	}
+	if righe := spezza(strings.Repeat("W", 40), 10, true, 50); len(righe) < 5 {
+		t.Errorf("parola lunga non spezzata: %q", righe)
+	}
+}
+
+func TestNomeFile(t *testing.T) {
+	tests := []struct {
+		titolo, numero, atteso string
+	}{
+		{"Fattura", "2026/0042", "fattura_2026-0042.pdf"},
+		{"Nota di credito", "NC-2026/0001", "nota_di_credito_nc-2026-0001.pdf"},
+		{"Ordine di lavoro", "C0012", "ordine_di_lavoro_c0012.pdf"},
+		{"Fattura", "", "fattura.pdf"},
+	}
+	for _, tt := range tests {
+		if got := NomeFile(&Dati{Titolo: tt.titolo, Numero: tt.numero}); got != tt.atteso {
+			t.Errorf("NomeFile(%q, %q) = %q, atteso %q", tt.titolo, tt.numero, got, tt.atteso)
+		}
+	}
+}
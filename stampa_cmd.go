@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"officina/database"
+	"officina/logger"
+	"officina/stampa"
+)
+
+// runStampaCommand gestisce "officina stampa fattura|preventivo|ordine|modelli"
+func runStampaCommand(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "Uso: officina stampa fattura|preventivo|ordine|modelli [opzioni] ...")
+		return exitUso
+	}
+
+	if args[0] == "modelli" {
+		return runStampaModelli(args[1:])
+	}
+	for _, m := range stampa.Modelli {
+		if args[0] == m {
+			return runStampaDocumenti(m, args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Comando sconosciuto: stampa %s\n", args[0])
+	return exitUso
+}
+
+// esitoStampa descrive un documento stampato in PDF
+type esitoStampa struct {
+	Documento string `json:"documento"`
+	File      string `json:"file"`
+}
+
+// runStampaDocumenti salva il PDF dei documenti indicati per numero o id:
+// fatture, preventivi o ordini di lavoro delle commesse
+func runStampaDocumenti(modello string, args []string) int {
+	opts := newOpzioni("stampa " + modello)
+	dir := opts.fs.String("dir", "", "directory di destinazione (default app.export_path)")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+	if len(opts.args) == 0 {
+		opts.fail(fmt.Errorf("indicare il numero o l'id di almeno un documento"))
+		return exitUso
+	}
+
+	cfg, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	if *dir == "" {
+		*dir = cfg.App.ExportPath
+	}
+
+	var esiti []esitoStampa
+	for _, arg := range opts.args {
+		id, err := cercaDocumento(db, modello, arg)
+		if err != nil {
+			opts.fail(err)
+			return exitErrore
+		}
+		if id == 0 {
+			opts.fail(fmt.Errorf("%s %s non trovato", modello, arg))
+			return exitUso
+		}
+		path, err := stampa.Esporta(db, modello, id, cfg.App.TemplatesPath, *dir)
+		if err != nil {
+			opts.fail(fmt.Errorf("%s %s: %w", modello, arg, err))
+			return exitErrore
+		}
+		logger.Info("Stampa: %s %s salvato in %s", modello, arg, path)
+		esiti = append(esiti, esitoStampa{Documento: arg, File: path})
+	}
+
+	opts.output(esiti, func() {
+		for _, e := range esiti {
+			fmt.Printf("✓ %s → %s\n", e.Documento, e.File)
+		}
+	})
+	return exitOK
+}
+
+// cercaDocumento restituisce l'id del documento del modello con numero o
+// id arg, zero se non esiste
+func cercaDocumento(db *database.DB, modello, arg string) (int, error) {
+	type documento struct {
+		id     int
+		numero string
+	}
+	var elenco []documento
+	switch modello {
+	case stampa.ModelloFattura:
+		fatture, err := db.ListFatture()
+		if err != nil {
+			return 0, err
+		}
+		if f := cercaFattura(fatture, arg); f != nil {
+			return f.ID, nil
+		}
+		return 0, nil
+	case stampa.ModelloPreventivo:
+		preventivi, err := db.ListPreventivi()
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range preventivi {
+			elenco = append(elenco, documento{p.ID, p.Numero})
+		}
+	case stampa.ModelloOrdine:
+		commesse, err := db.ListCommesse()
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range commesse {
+			elenco = append(elenco, documento{c.ID, c.Numero})
+		}
+	}
+
+	for _, d := range elenco {
+		if d.numero == arg {
+			return d.id, nil
+		}
+	}
+	if id, err := strconv.Atoi(arg); err == nil {
+		for _, d := range elenco {
+			if d.id == id {
+				return d.id, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// runStampaModelli copia i modelli predefiniti nella cartella dei modelli
+// per personalizzarli; i file già presenti non sono sovrascritti
+func runStampaModelli(args []string) int {
+	opts := newOpzioni("stampa modelli")
+	dir := opts.fs.String("dir", "", "directory dei modelli (default app.templates_path)")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+	cfg, code, stop := opts.load()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+
+	if *dir == "" {
+		*dir = cfg.App.TemplatesPath
+	}
+	scritti, err := stampa.ScriviModelli(*dir)
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+
+	opts.output(map[string]interface{}{"dir": *dir, "scritti": scritti}, func() {
+		for _, path := range scritti {
+			fmt.Printf("✓ %s\n", path)
+		}
+		if len(scritti) == 0 {
+			fmt.Printf("I modelli sono già presenti in %s\n", *dir)
+		}
+	})
+	return exitOK
+}
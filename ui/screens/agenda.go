@@ -394,10 +394,18 @@ func (m AgendaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyMsg:
 			switch msg.String() {
 			case "n":
+				if err := m.db.Autorizza(database.RisorsaAppuntamenti, database.PermessoCrea); err != nil {
+					m.err = err
+					return m, nil
+				}
 				m.mode = AgendaAdd
 				m.resetForm()
 				return m, nil
 			case "e", "enter":
+				if err := m.db.Autorizza(database.RisorsaAppuntamenti, database.PermessoModifica); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.loadIntoForm(id)
@@ -405,6 +413,10 @@ func (m AgendaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			case "x", "d":
+				if err := m.db.Autorizza(database.RisorsaAppuntamenti, database.PermessoElimina); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.deletingID = id
@@ -1,14 +1,22 @@
 package screens
 
 import (
+	"officina/config"
 	"officina/database"
+	"officina/export"
+	"officina/fatturapa"
+	"officina/logger"
+	"officina/stampa"
+	"time"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 // AppModel è il model principale dell'applicazione
 type AppModel struct {
 	db            *database.DB
+	cfg           *config.Config
 	currentScreen AppState
 	menu          MenuModel
 	clienti       ClientiModel
@@ -20,31 +28,159 @@ type AppModel struct {
 	operatori     OperatoriModel
 	preventivi    PreventiviModel
 	fatture       FattureModel
-	width         int
-	height        int
+	backup        BackupModel
+	impostazioni  ImpostazioniModel
+	azienda       ProfiloAziendaModel
+	login         LoginModel
+	backupGen     int
+	replicaAvvio  string // backup creato all'avvio da replicare in background
+
+	// Accesso operatori: attivo se almeno un operatore ha una credenziale
+	accessoRichiesto  bool
+	operatore         *database.Operatore
+	ultimaAttivita    time.Time
+	schermataBloccata AppState // schermata da riprendere allo sblocco
+	remota            bool     // sessione servita da ssh-serve
+
+	width  int
+	height int
+}
+
+// autoBackupMsg scatta allo scadere dell'intervallo dei backup automatici;
+// gen scarta i timer programmati prima di una modifica delle impostazioni
+type autoBackupMsg struct {
+	gen int
+}
+
+// controlloSessioneMsg scatta periodicamente per bloccare la sessione
+// inattiva
+type controlloSessioneMsg struct{}
+
+// intervalloControlloSessione è la frequenza del controllo di inattività
+const intervalloControlloSessione = 15 * time.Second
+
+// NewModel crea una nuova istanza del model principale. Ogni istanza lavora
+// su una propria sessione del database, a cui viene associato l'operatore
+// che ha eseguito l'accesso.
+func NewModel(db *database.DB, cfg *config.Config) AppModel {
+	return newAppModel(db.NuovaSessione(database.OrigineTUI), cfg)
 }
 
-// NewModel crea una nuova istanza del model principale
-func NewModel(db *database.DB) AppModel {
+// NewModelOperatore crea il model di una sessione remota già autenticata
+// (chiave SSH): parte dal menu con l'operatore collegato. I backup
+// automatici restano compito del processo che serve le sessioni, e le
+// impostazioni del processo non si cambiano da una sessione remota.
+func NewModelOperatore(db *database.DB, cfg *config.Config, origine string, o *database.Operatore) AppModel {
+	m := newAppModel(db.NuovaSessione(origine), cfg)
+	m.remota = true
+	m.menu.Nascondi(StateImpostazioni)
+	m.accedi(o)
+	return m
+}
+
+func newAppModel(db *database.DB, cfg *config.Config) AppModel {
+	richiesto, err := db.AccessoRichiesto()
+	if err != nil {
+		// Senza poter leggere gli operatori si chiede comunque l'accesso
+		logger.Error("Impossibile verificare gli accessi operatore: %v", err)
+		richiesto = true
+	}
+
+	schermata := StateMenu
+	if richiesto {
+		schermata = StateLogin
+	}
+
 	return AppModel{
-		db:            db,
-		currentScreen: StateMenu,
-		menu:          NewMenuModel(db),
-		clienti:       NewClientiModel(db),
-		fornitori:     NewFornitoriModel(db),
-		veicoli:       NewVeicoliModel(db),
-		commesse:      NewCommesseModel(db),
-		agenda:        NewAgendaModel(db),
-		primanota:     NewPrimaNotaModel(db),
-		operatori:     NewOperatoriModel(db),
-		preventivi:    NewPreventiviModel(db),
-		fatture:       NewFattureModel(db),
+		db:               db,
+		cfg:              cfg,
+		currentScreen:    schermata,
+		accessoRichiesto: richiesto,
+		ultimaAttivita:   time.Now(),
+		login:            NewLoginModel(db),
+		menu:             NewMenuModel(db),
+		clienti:          NewClientiModel(db),
+		fornitori:        NewFornitoriModel(db),
+		veicoli:          NewVeicoliModel(db),
+		commesse:         NewCommesseModel(db),
+		agenda:           NewAgendaModel(db),
+		primanota:        NewPrimaNotaModel(db),
+		operatori:        NewOperatoriModel(db),
+		preventivi:       NewPreventiviModel(db),
+		fatture:          NewFattureModel(db),
+		backup:           NewBackupModel(db, cfg),
+		impostazioni:     NewImpostazioniModel(cfg),
+		azienda:          NewProfiloAziendaModel(db, cfg.App.Version),
 	}
 }
 
+// accedi collega l'operatore alla sessione e mostra il menu; se è lo
+// stesso operatore della sessione bloccata riprende dalla schermata lasciata
+func (m *AppModel) accedi(o *database.Operatore) {
+	stesso := m.operatore != nil && m.operatore.ID == o.ID
+	m.operatore = o
+	m.db.ImpostaOperatore(o)
+	m.db.RegistraAccesso()
+	m.menu.SetOperatore(o, m.accessoRichiesto)
+	m.ultimaAttivita = time.Now()
+	logger.Info("Accesso operatore %s (%s)", o.Matricola, o.NomeCompleto())
+
+	m.currentScreen = StateMenu
+	if stesso {
+		m.currentScreen = m.schermataBloccata
+	}
+}
+
+// scheduleAutoBackup programma il prossimo backup automatico
+func (m AppModel) scheduleAutoBackup() tea.Cmd {
+	if m.remota || !m.cfg.Backup.Enabled || m.cfg.Backup.Interval <= 0 {
+		return nil
+	}
+
+	gen := m.backupGen
+	return tea.Tick(m.cfg.Backup.Interval, func(time.Time) tea.Msg {
+		return autoBackupMsg{gen: gen}
+	})
+}
+
+// scheduleControlloSessione programma il prossimo controllo di inattività
+func scheduleControlloSessione() tea.Cmd {
+	return tea.Tick(intervalloControlloSessione, func(time.Time) tea.Msg {
+		return controlloSessioneMsg{}
+	})
+}
+
+// blocca mostra la schermata di sblocco, ricordando dove riprendere
+func (m *AppModel) blocca() {
+	if m.currentScreen == StateLogin {
+		return
+	}
+	logger.Info("Sessione di %s bloccata", m.operatore.Matricola)
+	m.schermataBloccata = m.currentScreen
+	m.currentScreen = StateLogin
+	m.login.Blocca(m.operatore)
+}
+
+// ReplicaBackup fa replicare in background sulle destinazioni esterne il
+// backup creato all'avvio, senza ritardare l'apertura dell'interfaccia.
+// L'avanzamento e l'esito compaiono nella schermata Backup; un errore è
+// segnalato anche nel menu.
+func (m AppModel) ReplicaBackup(path string) AppModel {
+	m.replicaAvvio = path
+	m.backup.startBusy("Replica del backup iniziale")
+	return m
+}
+
 // Init implementa tea.Model
 func (m AppModel) Init() tea.Cmd {
-	return nil
+	cmds := []tea.Cmd{m.scheduleAutoBackup()}
+	if m.replicaAvvio != "" {
+		cmds = append(cmds, m.backup.spinner.Tick, m.backup.replicaAvvioCmd(m.replicaAvvio))
+	}
+	if m.accessoRichiesto {
+		cmds = append(cmds, scheduleControlloSessione(), m.login.Init())
+	}
+	return tea.Batch(cmds...)
 }
 
 // Update implementa tea.Model
@@ -55,13 +191,124 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 
 	case ChangeScreenMsg:
+		if m.remota && AppState(msg) == StateImpostazioni {
+			return m, nil
+		}
 		m.currentScreen = AppState(msg)
+		if m.currentScreen == StateBackup {
+			m.menu.SetAvviso("")
+		}
 		return m, nil
 
 	case tea.KeyMsg:
+		m.ultimaAttivita = time.Now()
 		if msg.String() == "ctrl+c" {
 			return m, tea.Quit
 		}
+
+	case controlloSessioneMsg:
+		// La durata è letta ogni volta: può essere cambiata da Impostazioni
+		timeout := m.cfg.App.SessionTimeout
+		if m.accessoRichiesto && m.operatore != nil && timeout > 0 && time.Since(m.ultimaAttivita) >= timeout {
+			m.blocca()
+		}
+		return m, scheduleControlloSessione()
+
+	case BloccaSessioneMsg:
+		if m.accessoRichiesto && m.operatore != nil {
+			m.blocca()
+		}
+		return m, nil
+
+	case LoginMsg:
+		m.accedi(msg.Operatore)
+		return m, nil
+
+	case autoBackupMsg:
+		if msg.gen != m.backupGen {
+			return m, nil
+		}
+		return m, tea.Batch(m.backup.StartAutoBackup(), m.scheduleAutoBackup())
+
+	case ImpostazioniSalvateMsg:
+		// Percorso, conservazione e intervallo dei backup valgono da subito
+		m.backup.Reconfigure(m.cfg)
+		m.backupGen++
+		return m, m.scheduleAutoBackup()
+
+	case ProfiloAziendaSalvatoMsg:
+		m.fatture.RefreshProfilo()
+		m.preventivi.RefreshProfilo()
+		return m, nil
+
+	case FatturaCommesseMsg:
+		m.fatture.ApriFatturaCommesse(msg.Bozza)
+		m.currentScreen = StateFatture
+		return m, nil
+
+	case EsportaVistaMsg:
+		// La cartella è letta ora: può essere cambiata da Impostazioni
+		dir := m.cfg.App.ExportPath
+		return m, func() tea.Msg {
+			path, err := export.Salva(dir, msg.Formato, msg.Tabella)
+			if err != nil {
+				logger.Error("Errore esportazione %s: %v", msg.Tabella.Nome, err)
+			} else {
+				logger.Info("Esportata vista %s in %s", msg.Tabella.Nome, path)
+			}
+			return EsportazioneMsg{Path: path, Righe: len(msg.Tabella.Righe), Err: err}
+		}
+
+	case GeneraFatturaPAMsg:
+		dir := m.cfg.App.ExportPath
+		db := m.db
+		return m, func() tea.Msg {
+			path, err := fatturapa.Esporta(db, msg.FatturaID, dir)
+			if err != nil {
+				logger.Error("Errore fattura elettronica %d: %v", msg.FatturaID, err)
+			} else {
+				logger.Info("Fattura elettronica %d salvata in %s", msg.FatturaID, path)
+			}
+			return FatturaPAGenerataMsg{FatturaID: msg.FatturaID, Path: path, Err: err}
+		}
+
+	case StampaMsg:
+		// Le cartelle sono lette ora: possono essere cambiate da Impostazioni
+		dirModelli, dirExport := m.cfg.App.TemplatesPath, m.cfg.App.ExportPath
+		db := m.db
+		return m, func() tea.Msg {
+			path, err := stampa.Esporta(db, msg.Modello, msg.ID, dirModelli, dirExport)
+			if err != nil {
+				logger.Error("Errore stampa %s %d: %v", msg.Modello, msg.ID, err)
+			} else {
+				logger.Info("Stampa %s %d salvata in %s", msg.Modello, msg.ID, path)
+			}
+			return StampaEseguitaMsg{Path: path, Err: err}
+		}
+
+	case impostazioniTestMsg:
+		model, cmd := m.impostazioni.Update(msg)
+		m.impostazioni = model.(ImpostazioniModel)
+		return m, cmd
+
+	case backupProgressMsg, backupDoneMsg, backupDiffMsg:
+		// Le operazioni di backup proseguono anche lasciando la schermata;
+		// quelle in background che falliscono lo segnalano nel menu
+		if done, ok := msg.(backupDoneMsg); ok && done.err != nil && m.currentScreen != StateBackup {
+			m.menu.SetAvviso(done.err.Error())
+		}
+		model, cmd := m.backup.Update(msg)
+		m.backup = model.(BackupModel)
+		return m, cmd
+
+	case spinner.TickMsg:
+		// Lo spinner del backup gira finché dura l'operazione, anche in
+		// un'altra schermata; gli altri spinner sono della schermata attiva
+		if msg.ID == m.backup.spinner.ID() {
+			model, cmd := m.backup.Update(msg)
+			m.backup = model.(BackupModel)
+			return m, cmd
+		}
 	}
 
 	var cmd tea.Cmd
@@ -107,6 +354,22 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		var model tea.Model
 		model, cmd = m.fatture.Update(msg)
 		m.fatture = model.(FattureModel)
+	case StateBackup:
+		var model tea.Model
+		model, cmd = m.backup.Update(msg)
+		m.backup = model.(BackupModel)
+	case StateImpostazioni:
+		var model tea.Model
+		model, cmd = m.impostazioni.Update(msg)
+		m.impostazioni = model.(ImpostazioniModel)
+	case StateProfiloAzienda:
+		var model tea.Model
+		model, cmd = m.azienda.Update(msg)
+		m.azienda = model.(ProfiloAziendaModel)
+	case StateLogin:
+		var model tea.Model
+		model, cmd = m.login.Update(msg)
+		m.login = model.(LoginModel)
 	}
 
 	return m, cmd
@@ -135,6 +398,14 @@ func (m AppModel) View() string {
 		return m.preventivi.View()
 	case StateFatture:
 		return m.fatture.View()
+	case StateBackup:
+		return m.backup.View()
+	case StateImpostazioni:
+		return m.impostazioni.View()
+	case StateProfiloAzienda:
+		return m.azienda.View()
+	case StateLogin:
+		return m.login.View()
 	}
 
 	return "Schermata sconosciuta"
@@ -0,0 +1,374 @@
+package screens
+
+import (
+	"fmt"
+	"officina/database"
+	"officina/utils"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Indici dei campi del profilo azienda
+const (
+	azRagioneSociale = iota
+	azLogoTesto
+	azPartitaIVA
+	azCodiceFiscale
+	azREAUfficio
+	azREANumero
+	azIndirizzo
+	azCAP
+	azCitta
+	azProvincia
+	azTelefono
+	azEmail
+	azPEC
+	azIBAN
+	azBanca
+	azRegimeFiscale
+	azAliquotaIVA
+	azFormatoNumero
+	azNumCampi
+)
+
+// ProfiloAziendaSalvatoMsg notifica il salvataggio dei dati dell'officina;
+// AppModel lo usa per aggiornare fatture e preventivi
+type ProfiloAziendaSalvatoMsg struct{}
+
+// ProfiloAziendaModel gestisce la schermata dei dati dell'officina
+type ProfiloAziendaModel struct {
+	db         *database.DB
+	version    string
+	inputs     []textinput.Model
+	focusIndex int
+	err        error
+	msg        string
+	width      int
+	height     int
+}
+
+// NewProfiloAziendaModel crea una nuova istanza della schermata dati officina
+func NewProfiloAziendaModel(db *database.DB, version string) ProfiloAziendaModel {
+	inputs := make([]textinput.Model, azNumCampi)
+	for i := range inputs {
+		inputs[i] = textinput.New()
+		inputs[i].Width = 45
+	}
+
+	inputs[azRagioneSociale].Placeholder = "Ragione sociale"
+	inputs[azLogoTesto].Placeholder = "Nome in evidenza sui documenti (opzionale)"
+	inputs[azPartitaIVA].Placeholder = "11 cifre"
+	inputs[azPartitaIVA].CharLimit = 11
+	inputs[azCodiceFiscale].Placeholder = "Se diverso dalla P.IVA"
+	inputs[azCodiceFiscale].CharLimit = 16
+	inputs[azREAUfficio].Placeholder = "RM"
+	inputs[azREAUfficio].CharLimit = 2
+	inputs[azREAUfficio].Width = 4
+	inputs[azREANumero].Placeholder = "Numero REA"
+	inputs[azREANumero].CharLimit = 20
+	inputs[azREANumero].Width = 22
+	inputs[azIndirizzo].Placeholder = "Via, numero"
+	inputs[azCAP].CharLimit = 5
+	inputs[azCAP].Width = 7
+	inputs[azProvincia].CharLimit = 2
+	inputs[azProvincia].Width = 4
+	inputs[azIBAN].Placeholder = "IT60X0542811101000000123456"
+	inputs[azIBAN].CharLimit = 34
+	inputs[azRegimeFiscale].Placeholder = "[Spazio] per cambiare"
+	inputs[azAliquotaIVA].Placeholder = "[Spazio] per cambiare"
+	inputs[azFormatoNumero].Placeholder = database.FormatoNumeroPredefinito
+	inputs[azFormatoNumero].CharLimit = 40
+
+	m := ProfiloAziendaModel{
+		db:      db,
+		version: version,
+		inputs:  inputs,
+	}
+
+	m.Reload()
+	return m
+}
+
+// Reload carica il profilo dal database
+func (m *ProfiloAziendaModel) Reload() {
+	p, err := m.db.GetProfiloAzienda()
+	if err != nil {
+		m.err = err
+		p = database.NuovoProfiloAzienda()
+	}
+
+	m.inputs[azRagioneSociale].SetValue(p.RagioneSociale)
+	m.inputs[azLogoTesto].SetValue(p.LogoTesto)
+	m.inputs[azPartitaIVA].SetValue(p.PartitaIVA)
+	m.inputs[azCodiceFiscale].SetValue(p.CodiceFiscale)
+	m.inputs[azREAUfficio].SetValue(p.REAUfficio)
+	m.inputs[azREANumero].SetValue(p.REANumero)
+	m.inputs[azIndirizzo].SetValue(p.Indirizzo)
+	m.inputs[azCAP].SetValue(p.CAP)
+	m.inputs[azCitta].SetValue(p.Citta)
+	m.inputs[azProvincia].SetValue(p.Provincia)
+	m.inputs[azTelefono].SetValue(p.Telefono)
+	m.inputs[azEmail].SetValue(p.Email)
+	m.inputs[azPEC].SetValue(p.PEC)
+	m.inputs[azIBAN].SetValue(p.IBAN)
+	m.inputs[azBanca].SetValue(p.Banca)
+	m.inputs[azRegimeFiscale].SetValue(p.RegimeFiscale)
+	m.inputs[azAliquotaIVA].SetValue(formatAliquota(p.AliquotaIVA))
+	m.inputs[azFormatoNumero].SetValue(p.FormatoNumero)
+
+	m.focusIndex = 0
+	m.updateFocus()
+}
+
+// updateFocus aggiorna il focus tra i campi
+func (m *ProfiloAziendaModel) updateFocus() {
+	for i := range m.inputs {
+		if i == m.focusIndex {
+			m.inputs[i].Focus()
+		} else {
+			m.inputs[i].Blur()
+		}
+	}
+}
+
+// cicla passa al valore successivo di un campo a scelta fissa
+func (m *ProfiloAziendaModel) cicla() {
+	switch m.focusIndex {
+	case azRegimeFiscale:
+		attuale := m.inputs[azRegimeFiscale].Value()
+		next := database.RegimiFiscali[0]
+		for i, r := range database.RegimiFiscali {
+			if r == attuale && i+1 < len(database.RegimiFiscali) {
+				next = database.RegimiFiscali[i+1]
+			}
+		}
+		m.inputs[azRegimeFiscale].SetValue(next)
+
+	case azAliquotaIVA:
+		attuale := m.inputs[azAliquotaIVA].Value()
+		next := database.AliquoteIVA[0]
+		for i, a := range database.AliquoteIVA {
+			if formatAliquota(a) == attuale && i+1 < len(database.AliquoteIVA) {
+				next = database.AliquoteIVA[i+1]
+			}
+		}
+		m.inputs[azAliquotaIVA].SetValue(formatAliquota(next))
+	}
+}
+
+// save valida e salva il profilo
+func (m *ProfiloAziendaModel) save() error {
+	aliquota, err := utils.ParseFloat(m.inputs[azAliquotaIVA].Value())
+	if err != nil {
+		return fmt.Errorf("aliquota IVA non valida")
+	}
+
+	value := func(i int) string { return strings.TrimSpace(m.inputs[i].Value()) }
+
+	p := &database.ProfiloAzienda{
+		RagioneSociale: value(azRagioneSociale),
+		LogoTesto:      value(azLogoTesto),
+		PartitaIVA:     value(azPartitaIVA),
+		CodiceFiscale:  strings.ToUpper(value(azCodiceFiscale)),
+		REAUfficio:     strings.ToUpper(value(azREAUfficio)),
+		REANumero:      value(azREANumero),
+		Indirizzo:      value(azIndirizzo),
+		CAP:            value(azCAP),
+		Citta:          value(azCitta),
+		Provincia:      strings.ToUpper(value(azProvincia)),
+		Nazione:        "IT",
+		Telefono:       value(azTelefono),
+		Email:          value(azEmail),
+		PEC:            value(azPEC),
+		IBAN:           strings.ToUpper(strings.ReplaceAll(value(azIBAN), " ", "")),
+		Banca:          value(azBanca),
+		RegimeFiscale:  value(azRegimeFiscale),
+		AliquotaIVA:    aliquota,
+		FormatoNumero:  value(azFormatoNumero),
+	}
+
+	if err := m.db.SaveProfiloAzienda(p); err != nil {
+		return err
+	}
+
+	m.msg = "✓ Dati officina salvati"
+	if mancanti := p.Mancanti(); len(mancanti) > 0 {
+		m.msg += " (mancano per i documenti: " + strings.Join(mancanti, ", ") + ")"
+	}
+	return nil
+}
+
+// salva esegue il salvataggio e notifica le altre schermate
+func (m *ProfiloAziendaModel) salva() tea.Cmd {
+	m.err = nil
+	m.msg = ""
+	if err := m.save(); err != nil {
+		m.err = err
+		return nil
+	}
+	return func() tea.Msg { return ProfiloAziendaSalvatoMsg{} }
+}
+
+// Init implementa tea.Model
+func (m ProfiloAziendaModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update implementa tea.Model
+func (m ProfiloAziendaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+	}
+
+	if k, ok := msg.(tea.KeyMsg); ok {
+		switch k.String() {
+		case "esc":
+			m.err = nil
+			m.msg = ""
+			m.Reload()
+			return m, func() tea.Msg { return ChangeScreenMsg(StateMenu) }
+		case "ctrl+s":
+			return m, m.salva()
+		case "enter":
+			if m.focusIndex == len(m.inputs)-1 {
+				return m, m.salva()
+			}
+			m.focusIndex++
+			m.updateFocus()
+			return m, nil
+		case "tab", "down":
+			m.focusIndex++
+			if m.focusIndex >= len(m.inputs) {
+				m.focusIndex = 0
+			}
+			m.updateFocus()
+			return m, nil
+		case "shift+tab", "up":
+			m.focusIndex--
+			if m.focusIndex < 0 {
+				m.focusIndex = len(m.inputs) - 1
+			}
+			m.updateFocus()
+			return m, nil
+		}
+
+		if m.focusIndex == azRegimeFiscale || m.focusIndex == azAliquotaIVA {
+			if k.String() == " " {
+				m.cicla()
+			}
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.inputs[m.focusIndex], cmd = m.inputs[m.focusIndex].Update(msg)
+	return m, cmd
+}
+
+// View implementa tea.Model
+func (m ProfiloAziendaModel) View() string {
+	width := 85
+	if m.width > 0 {
+		width = min(m.width, 100)
+	}
+
+	header := RenderHeader("DATI OFFICINA", width)
+
+	labels := []string{
+		"Ragione sociale", "Nome su documenti", "P.IVA", "Cod. Fiscale",
+		"Ufficio REA", "Numero REA", "Indirizzo", "CAP", "Città", "Provincia",
+		"Telefono", "Email", "PEC", "IBAN", "Banca", "Regime fiscale", "IVA predef. %",
+		"Numero fattura",
+	}
+
+	var form strings.Builder
+	for i, inp := range m.inputs {
+		if i == azIndirizzo || i == azTelefono || i == azIBAN || i == azFormatoNumero {
+			form.WriteString("\n")
+		}
+
+		labelStyle := LabelStyle
+		if i == m.focusIndex {
+			labelStyle = LabelFocusedStyle
+		}
+
+		note := ""
+		if i == azRegimeFiscale {
+			note = HelpStyle.Render(" " + database.DescrizioneRegimeFiscale(inp.Value()))
+		}
+		if i == azFormatoNumero {
+			note = HelpStyle.Render(" {anno} {aa} {n} {n:4} {sez}")
+		}
+
+		form.WriteString(fmt.Sprintf("%s %s%s\n",
+			labelStyle.Render(labels[i]+":"),
+			inp.View(),
+			note))
+	}
+
+	form.WriteString("\n")
+	form.WriteString(HelpStyle.Render("[Tab/↑↓] Naviga • [Spazio] Cambia regime/aliquota • [Ctrl+S] Salva • [Esc] Annulla"))
+
+	footer := RenderFooter(width, m.version)
+	if m.err != nil {
+		footer = "\n" + ErrorStyle.Render("✗ "+m.err.Error()) + "\n" + footer
+	}
+
+	if m.msg != "" {
+		footer = "\n" + SuccessStyle.Render(m.msg) + "\n" + footer
+	}
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		"",
+		lipgloss.NewStyle().Padding(0, 2).Render(form.String()),
+		"",
+		footer,
+	)
+
+	box := MainBoxStyle.Copy().Width(width - 4).Render(content)
+
+	if m.width > 0 && m.height > 0 {
+		return CenterContent(m.width, m.height, box)
+	}
+
+	return "\n" + box
+}
+
+// formatAliquota rappresenta un'aliquota IVA senza decimali superflui
+func formatAliquota(a float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", a), "0"), ".")
+}
+
+// renderEmittente restituisce la riga con i dati dell'officina mostrata
+// su fatture e preventivi, o un avviso se il profilo è incompleto
+func renderEmittente(p *database.ProfiloAzienda) string {
+	if p == nil {
+		return ""
+	}
+	if mancanti := p.Mancanti(); len(mancanti) > 0 {
+		return WarningStyle.Render("⚠ Dati officina incompleti (" + strings.Join(mancanti, ", ") + "): menu [A]")
+	}
+	return HelpStyle.Render("🏢 " + p.RagioneSociale + " • P.IVA " + p.PartitaIVA + " • " + database.DescrizioneRegimeFiscale(p.RegimeFiscale))
+}
+
+// renderScorporoIVA mostra imponibile e IVA contenuti nell'importo inserito,
+// calcolati con l'aliquota predefinita dell'officina
+func renderScorporoIVA(p *database.ProfiloAzienda, importo string) string {
+	if p == nil {
+		return ""
+	}
+	totale, err := utils.ParseFloat(importo)
+	if err != nil || totale <= 0 {
+		return ""
+	}
+	imponibile, iva := p.ScorporoIVA(totale)
+	return HelpStyle.Render(fmt.Sprintf("  di cui imponibile %s + IVA %s%% %s",
+		utils.FormatEuro(imponibile), formatAliquota(p.AliquotaIVA), utils.FormatEuro(iva)))
+}
@@ -0,0 +1,899 @@
+package screens
+
+import (
+	"fmt"
+	"officina/config"
+	"officina/database"
+	"officina/logger"
+	"officina/utils"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Fasi di conferma del ripristino completo
+const (
+	restoreNessuna = iota
+	restorePrimaConferma
+	restoreSecondaConferma
+)
+
+// backupProgressMsg notifica l'avanzamento di un backup in corso
+type backupProgressMsg struct {
+	collection string
+	fatte      int
+	totale     int
+	ch         <-chan tea.Msg
+}
+
+// backupDoneMsg notifica la fine di un'operazione asincrona sui backup
+type backupDoneMsg struct {
+	azione string
+	path   string
+	err    error
+}
+
+// backupDiffMsg trasporta il confronto tra un backup e il database
+type backupDiffMsg struct {
+	diff *database.BackupDiff
+	err  error
+}
+
+// rigaDiff è una riga selezionabile dell'anteprima: l'intestazione di una
+// collezione (record nil) o un record con differenze
+type rigaDiff struct {
+	collection string
+	record     *database.RecordDiff
+}
+
+// ripristinoSelettivo descrive il ripristino in attesa di conferma
+type ripristinoSelettivo struct {
+	descrizione string
+	opts        database.RestoreOptions
+	cliente     int // se impostato ripristina il cliente con i record collegati
+}
+
+// BackupModel gestisce la schermata Backup & Ripristino
+type BackupModel struct {
+	db           *database.DB
+	manager      *database.BackupManagerMongo
+	version      string
+	table        table.Model
+	backups      []database.BackupInfo
+	spinner      spinner.Model
+	viewport     viewport.Model
+	err          error
+	msg          string
+	width        int
+	height       int
+	busy         bool
+	busyLabel    string
+	fatte        int
+	totale       int
+	showConfirm  bool
+	restoreStep  int
+	mergeConfirm bool
+	showOverlay  bool
+	diff         *database.BackupDiff
+	righeDiff    []rigaDiff
+	cursore      int
+	selezione    map[database.RecordRef]bool // record scelti con Spazio; id 0 = collezione intera
+	sovrascrivi  bool
+	ripristino   ripristinoSelettivo
+	targetPath   string
+}
+
+// NewBackupModel crea una nuova istanza della schermata backup
+func NewBackupModel(db *database.DB, cfg *config.Config) BackupModel {
+	columns := []table.Column{
+		{Title: "#", Width: 3},
+		{Title: "Data", Width: 17},
+		{Title: "Dimensione", Width: 11},
+		{Title: "Documenti", Width: 10},
+		{Title: "Verifica", Width: 16},
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithFocused(true),
+		table.WithHeight(12),
+	)
+
+	t.SetStyles(GetTableStyles())
+
+	sp := spinner.New()
+	sp.Spinner = spinner.Dot
+	sp.Style = lipgloss.NewStyle().Foreground(ColorPrimary)
+
+	vp := viewport.New(80, 20)
+	vp.Style = lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ColorBorder).
+		Padding(1, 2)
+
+	manager, err := database.NewBackupManagerFromConfig(db, cfg)
+
+	m := BackupModel{
+		db:       db,
+		manager:  manager,
+		version:  cfg.App.Version,
+		table:    t,
+		spinner:  sp,
+		viewport: vp,
+	}
+
+	m.Refresh()
+	if err != nil {
+		m.err = fmt.Errorf("configurazione destinazioni: %w", err)
+	}
+	return m
+}
+
+// Refresh aggiorna la lista dei backup
+func (m *BackupModel) Refresh() {
+	infos, err := m.manager.ListBackupInfo()
+	if err != nil {
+		m.err = fmt.Errorf("errore lettura backup: %w", err)
+	}
+	m.backups = infos
+
+	rows := []table.Row{}
+	for i, b := range m.backups {
+		verifica := "⏳ " + b.Verifica
+		switch b.Verifica {
+		case database.VerificaOK:
+			verifica = "✅ " + b.Verifica
+		case database.VerificaFallita:
+			verifica = "❌ " + b.Verifica
+		}
+
+		documenti := "—"
+		if b.MetadatiLeggibili {
+			documenti = utils.FormatInt(b.TotaleDocumenti())
+		}
+
+		rows = append(rows, table.Row{
+			strconv.Itoa(i + 1),
+			utils.FormatDateTime(b.Data),
+			utils.FormatSize(b.Dimensione),
+			documenti,
+			verifica,
+		})
+	}
+
+	m.table.SetRows(rows)
+}
+
+// selected restituisce il backup selezionato in tabella
+func (m *BackupModel) selected() *database.BackupInfo {
+	row := m.table.SelectedRow()
+	if len(row) == 0 {
+		return nil
+	}
+	idx, _ := strconv.Atoi(row[0])
+	if idx < 1 || idx > len(m.backups) {
+		return nil
+	}
+	return &m.backups[idx-1]
+}
+
+// startBusy segna l'inizio di un'operazione asincrona
+func (m *BackupModel) startBusy(label string) tea.Cmd {
+	m.busy = true
+	m.busyLabel = label
+	m.fatte = 0
+	m.totale = 0
+	m.err = nil
+	m.msg = ""
+	return m.spinner.Tick
+}
+
+// waitBackupEvent attende il prossimo messaggio dal backup in corso
+func waitBackupEvent(ch <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
+// createBackupCmd avvia un backup in background inoltrando l'avanzamento
+func (m *BackupModel) createBackupCmd() tea.Cmd {
+	ch := make(chan tea.Msg)
+	manager := m.manager
+
+	go func() {
+		defer close(ch)
+		path, err := manager.CreateBackupProgress(func(collection string, fatte, totale int) {
+			ch <- backupProgressMsg{collection: collection, fatte: fatte, totale: totale, ch: ch}
+		})
+		ch <- backupDoneMsg{azione: "create", path: path, err: err}
+	}()
+
+	return waitBackupEvent(ch)
+}
+
+// verifyBackupCmd verifica un backup in background
+func (m *BackupModel) verifyBackupCmd(path string) tea.Cmd {
+	manager := m.manager
+	return func() tea.Msg {
+		return backupDoneMsg{azione: "verify", path: path, err: manager.VerifyBackup(path)}
+	}
+}
+
+// restoreBackupCmd ripristina integralmente un backup in background
+func (m *BackupModel) restoreBackupCmd(path string) tea.Cmd {
+	manager := m.manager
+	return func() tea.Msg {
+		return backupDoneMsg{azione: "restore", path: path, err: manager.RestoreBackup(path)}
+	}
+}
+
+// StartAutoBackup avvia un backup programmato, se non c'è già un'operazione
+// in corso
+func (m *BackupModel) StartAutoBackup() tea.Cmd {
+	if m.busy {
+		return nil
+	}
+
+	manager := m.manager
+	return tea.Batch(m.startBusy("Backup automatico in corso"), func() tea.Msg {
+		path, err := manager.CreateBackup()
+		if err != nil {
+			logger.Warn("Backup automatico non riuscito: %v", err)
+		} else {
+			logger.Info("Backup automatico creato: %s", path)
+		}
+		return backupDoneMsg{azione: "auto", path: path, err: err}
+	})
+}
+
+// Reconfigure ricrea il gestore dei backup dopo una modifica della configurazione
+func (m *BackupModel) Reconfigure(cfg *config.Config) {
+	manager, err := database.NewBackupManagerFromConfig(m.db, cfg)
+	m.manager = manager
+	m.version = cfg.App.Version
+	m.Refresh()
+	if err != nil {
+		m.err = fmt.Errorf("configurazione destinazioni: %w", err)
+	}
+}
+
+// replicateBackupCmd carica un backup sulle destinazioni esterne in background
+func (m *BackupModel) replicateBackupCmd(path string) tea.Cmd {
+	manager := m.manager
+	return func() tea.Msg {
+		return backupDoneMsg{azione: "replicate", path: path, err: manager.ReplicateBackup(path)}
+	}
+}
+
+// replicaAvvioCmd replica in background il backup creato all'avvio
+func (m *BackupModel) replicaAvvioCmd(path string) tea.Cmd {
+	manager := m.manager
+	return func() tea.Msg {
+		err := manager.ReplicateBackup(path)
+		if err != nil {
+			logger.Warn("Replica del backup iniziale non riuscita: %v", err)
+			err = fmt.Errorf("replica del backup iniziale: %w", err)
+		} else {
+			logger.Info("Backup iniziale replicato: %s", path)
+		}
+		return backupDoneMsg{azione: "replicate", path: path, err: err}
+	}
+}
+
+// mergeBackupCmd esegue il ripristino selettivo confermato: i record
+// modificati dopo il backup sono sostituiti solo se richiesto
+func (m *BackupModel) mergeBackupCmd(path string, rs ripristinoSelettivo) tea.Cmd {
+	manager := m.manager
+	return func() tea.Msg {
+		var report *database.RestoreReport
+		var err error
+		if rs.cliente != 0 {
+			report, err = manager.RestoreCliente(path, rs.cliente, rs.opts.SovrascriviModificati)
+		} else {
+			report, err = manager.RestoreSelective(path, rs.opts)
+		}
+		if err != nil {
+			return backupDoneMsg{azione: "merge", path: path, err: err}
+		}
+		esito := fmt.Sprintf("%d record reinseriti o sostituiti", report.Totale())
+		if saltati := report.TotaleSaltati(); saltati > 0 {
+			esito += fmt.Sprintf(", %d modificati lasciati invariati", saltati)
+		}
+		return backupDoneMsg{azione: "merge", path: esito}
+	}
+}
+
+// deleteBackupCmd elimina un backup in background
+func (m *BackupModel) deleteBackupCmd(path string) tea.Cmd {
+	manager := m.manager
+	return func() tea.Msg {
+		return backupDoneMsg{azione: "delete", path: path, err: manager.DeleteBackup(path)}
+	}
+}
+
+// diffBackupCmd calcola in background le differenze tra backup e database
+func (m *BackupModel) diffBackupCmd(path string) tea.Cmd {
+	manager := m.manager
+	return func() tea.Msg {
+		diff, err := manager.DiffBackup(path)
+		return backupDiffMsg{diff: diff, err: err}
+	}
+}
+
+// preparaRigheDiff elenca le righe selezionabili dell'anteprima
+func (m *BackupModel) preparaRigheDiff() {
+	m.righeDiff = nil
+	m.cursore = 0
+	m.selezione = map[database.RecordRef]bool{}
+	for _, cd := range m.diff.Collections {
+		if !cd.HasChanges() {
+			continue
+		}
+		m.righeDiff = append(m.righeDiff, rigaDiff{collection: cd.Collection})
+		for i := range cd.Records {
+			m.righeDiff = append(m.righeDiff, rigaDiff{collection: cd.Collection, record: &cd.Records[i]})
+		}
+	}
+}
+
+// rigaCorrente restituisce la riga sotto il cursore (nil se non ce ne sono)
+func (m *BackupModel) rigaCorrente() *rigaDiff {
+	if m.cursore < 0 || m.cursore >= len(m.righeDiff) {
+		return nil
+	}
+	return &m.righeDiff[m.cursore]
+}
+
+// ref restituisce il riferimento usato nella selezione per la riga
+func (r rigaDiff) ref() database.RecordRef {
+	if r.record == nil {
+		return database.RecordRef{Collection: r.collection}
+	}
+	return database.RecordRef{Collection: r.collection, ID: r.record.ID}
+}
+
+// selezionabile indica se la riga può essere ripristinata: i record creati
+// dopo il backup non ci sono nel backup
+func (r rigaDiff) selezionabile() bool {
+	return r.record == nil || r.record.Stato != database.DiffNuovo
+}
+
+// casella mostra lo stato di selezione della riga
+func (m *BackupModel) casella(r rigaDiff) string {
+	switch {
+	case !r.selezionabile():
+		return "    "
+	case m.selezione[r.ref()] || m.selezione[database.RecordRef{Collection: r.collection}]:
+		return "[x] "
+	}
+	return "[ ] "
+}
+
+// ripristinoSelezionato prepara il ripristino delle collezioni e dei record
+// scelti con Spazio
+func (m *BackupModel) ripristinoSelezionato() ripristinoSelettivo {
+	opts := database.RestoreOptions{SovrascriviModificati: m.sovrascrivi}
+	for ref := range m.selezione {
+		if ref.ID == 0 {
+			opts.Collections = append(opts.Collections, ref.Collection)
+		}
+	}
+	for ref := range m.selezione {
+		if ref.ID != 0 && !m.selezione[database.RecordRef{Collection: ref.Collection}] {
+			opts.Records = append(opts.Records, ref)
+		}
+	}
+	sort.Strings(opts.Collections)
+	sort.Slice(opts.Records, func(i, j int) bool {
+		if opts.Records[i].Collection != opts.Records[j].Collection {
+			return opts.Records[i].Collection < opts.Records[j].Collection
+		}
+		return opts.Records[i].ID < opts.Records[j].ID
+	})
+
+	var parti []string
+	if len(opts.Collections) > 0 {
+		parti = append(parti, "le collezioni "+strings.Join(opts.Collections, ", "))
+	}
+	if len(opts.Records) > 0 {
+		parti = append(parti, fmt.Sprintf("%d record selezionati", len(opts.Records)))
+	}
+	return ripristinoSelettivo{
+		descrizione: "Ripristinare dal backup " + strings.Join(parti, " e "),
+		opts:        opts,
+	}
+}
+
+// renderDiff prepara il contenuto dell'anteprima differenze, con il cursore
+// sulla riga corrente
+func (m *BackupModel) renderDiff() {
+	var sb strings.Builder
+	linea, lineaCursore := 0, 0
+	scrivi := func(s string) {
+		sb.WriteString(s + "\n")
+		linea += strings.Count(s, "\n") + 1
+	}
+	riga := 0
+	cursore := func() string {
+		defer func() { riga++ }()
+		if riga == m.cursore {
+			lineaCursore = linea
+			return "▶ "
+		}
+		return "  "
+	}
+
+	scrivi(lipgloss.NewStyle().
+		Bold(true).
+		Foreground(ColorPrimary).
+		Render("🔍 BACKUP vs DATABASE"))
+	scrivi(HelpStyle.Render(m.diff.BackupDir) + "\n")
+
+	for _, cd := range m.diff.Collections {
+		title := fmt.Sprintf("%s (%d invariati)", strings.ToUpper(cd.Collection), cd.Invariati)
+		if !cd.HasChanges() {
+			scrivi("  " + lipgloss.NewStyle().Foreground(ColorHighlight).Render(title) + " nessuna differenza")
+			continue
+		}
+
+		scrivi(cursore() + m.casella(rigaDiff{collection: cd.Collection}) + lipgloss.NewStyle().
+			Bold(true).
+			Foreground(ColorHighlight).
+			Render(title))
+		scrivi(fmt.Sprintf("         🟥 %d mancanti nel database • 🟨 %d modificati • 🟩 %d nuovi",
+			cd.Count(database.DiffMancante),
+			cd.Count(database.DiffModificato),
+			cd.Count(database.DiffNuovo)))
+
+		for i := range cd.Records {
+			r := &cd.Records[i]
+			prefisso := cursore() + "  " + m.casella(rigaDiff{collection: cd.Collection, record: r})
+			switch r.Stato {
+			case database.DiffMancante:
+				scrivi(fmt.Sprintf("%s- #%d eliminato dopo il backup", prefisso, r.ID))
+			case database.DiffModificato:
+				scrivi(fmt.Sprintf("%s~ #%d modificato: %s", prefisso, r.ID, strings.Join(r.Campi, ", ")))
+			case database.DiffNuovo:
+				scrivi(fmt.Sprintf("%s+ #%d creato dopo il backup", prefisso, r.ID))
+			}
+		}
+		scrivi("")
+	}
+
+	sovrascrivi := "no"
+	if m.sovrascrivi {
+		sovrascrivi = "sì"
+	}
+	scrivi(HelpStyle.Render("Sostituisci i record modificati: " + sovrascrivi))
+	sb.WriteString(HelpStyle.Render("[↑/↓] Scorri • [Spazio] Seleziona collezione o record • [M] Ripristina selezionati (o tutti i mancanti) • " +
+		"[C] Ripristina il cliente sotto il cursore • [O] Sostituisci modificati • [Esc] Chiudi"))
+
+	m.viewport.SetContent(sb.String())
+	if lineaCursore < m.viewport.YOffset {
+		m.viewport.SetYOffset(lineaCursore)
+	} else if lineaCursore >= m.viewport.YOffset+m.viewport.Height-4 {
+		m.viewport.SetYOffset(lineaCursore - m.viewport.Height + 5)
+	}
+}
+
+// collezioniConMancanti restituisce le collezioni del diff con record da reinserire
+func (m *BackupModel) collezioniConMancanti() []string {
+	var collections []string
+	if m.diff == nil {
+		return collections
+	}
+	for _, cd := range m.diff.Collections {
+		if cd.Count(database.DiffMancante) > 0 {
+			collections = append(collections, cd.Collection)
+		}
+	}
+	sort.Strings(collections)
+	return collections
+}
+
+// collezioniConDifferenze restituisce le collezioni del diff con record
+// mancanti o modificati
+func (m *BackupModel) collezioniConDifferenze() []string {
+	var collections []string
+	if m.diff == nil {
+		return collections
+	}
+	for _, cd := range m.diff.Collections {
+		if cd.Count(database.DiffMancante) > 0 || cd.Count(database.DiffModificato) > 0 {
+			collections = append(collections, cd.Collection)
+		}
+	}
+	sort.Strings(collections)
+	return collections
+}
+
+// Init implementa tea.Model
+func (m BackupModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update implementa tea.Model
+func (m BackupModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case spinner.TickMsg:
+		if !m.busy {
+			return m, nil
+		}
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case backupProgressMsg:
+		m.fatte = msg.fatte
+		m.totale = msg.totale
+		if msg.collection != "" {
+			m.busyLabel = "Backup in corso: " + msg.collection
+		}
+		return m, waitBackupEvent(msg.ch)
+
+	case backupDiffMsg:
+		m.busy = false
+		if msg.err != nil {
+			m.err = fmt.Errorf("errore confronto: %w", msg.err)
+			return m, nil
+		}
+		m.diff = msg.diff
+		m.sovrascrivi = false
+		m.preparaRigheDiff()
+		m.viewport.GotoTop()
+		m.renderDiff()
+		m.showOverlay = true
+		return m, nil
+
+	case backupDoneMsg:
+		m.busy = false
+		if msg.err != nil {
+			m.err = msg.err
+		} else {
+			switch msg.azione {
+			case "create":
+				m.msg = "✓ Backup creato: " + msg.path
+			case "auto":
+				m.msg = "✓ Backup automatico creato: " + msg.path
+			case "verify":
+				m.msg = "✓ Backup verificato correttamente"
+			case "restore":
+				m.msg = "✓ Database ripristinato dal backup"
+			case "merge":
+				m.msg = "✓ Ripristino selettivo completato: " + msg.path
+			case "replicate":
+				m.msg = fmt.Sprintf("✓ Backup replicato su %d destinazioni", len(m.manager.Targets()))
+			case "delete":
+				m.msg = "✓ Backup eliminato"
+			}
+		}
+		m.Refresh()
+		return m, nil
+	}
+
+	if m.busy {
+		return m, nil
+	}
+
+	if m.showOverlay {
+		if k, ok := msg.(tea.KeyMsg); ok {
+			if m.mergeConfirm {
+				switch k.String() {
+				case "y", "Y":
+					m.mergeConfirm = false
+					m.showOverlay = false
+					return m, tea.Batch(m.startBusy("Ripristino selettivo in corso"), m.mergeBackupCmd(m.targetPath, m.ripristino))
+				case "n", "N", "esc":
+					m.mergeConfirm = false
+				}
+				return m, nil
+			}
+
+			switch k.String() {
+			case "esc", "q":
+				m.showOverlay = false
+				return m, nil
+			case "up", "k":
+				if m.cursore > 0 {
+					m.cursore--
+					m.renderDiff()
+				}
+				return m, nil
+			case "down", "j":
+				if m.cursore < len(m.righeDiff)-1 {
+					m.cursore++
+					m.renderDiff()
+				}
+				return m, nil
+			case "o", "O":
+				m.sovrascrivi = !m.sovrascrivi
+				m.renderDiff()
+				return m, nil
+			case " ":
+				if r := m.rigaCorrente(); r != nil && r.selezionabile() {
+					ref := r.ref()
+					if m.selezione[ref] {
+						delete(m.selezione, ref)
+					} else {
+						m.selezione[ref] = true
+					}
+					m.renderDiff()
+				}
+				return m, nil
+			case "m", "M":
+				if len(m.selezione) > 0 {
+					m.ripristino = m.ripristinoSelezionato()
+					m.mergeConfirm = true
+					return m, nil
+				}
+				collections := m.collezioniConMancanti()
+				if m.sovrascrivi {
+					collections = m.collezioniConDifferenze()
+				}
+				if len(collections) == 0 {
+					m.err = fmt.Errorf("nessun record da ripristinare")
+					m.showOverlay = false
+					return m, nil
+				}
+				m.ripristino = ripristinoSelettivo{
+					descrizione: "Reinserire i record mancanti in: " + strings.Join(collections, ", "),
+					opts:        database.RestoreOptions{Collections: collections, SovrascriviModificati: m.sovrascrivi},
+				}
+				m.mergeConfirm = true
+				return m, nil
+			case "c", "C":
+				r := m.rigaCorrente()
+				if r == nil || r.collection != "clienti" || r.record == nil || r.record.Stato == database.DiffNuovo {
+					m.err = fmt.Errorf("seleziona un cliente eliminato o modificato dopo il backup")
+					m.showOverlay = false
+					return m, nil
+				}
+				m.ripristino = ripristinoSelettivo{
+					descrizione: fmt.Sprintf("Ripristinare il cliente #%d con veicoli, commesse, appuntamenti e movimenti", r.record.ID),
+					opts:        database.RestoreOptions{SovrascriviModificati: m.sovrascrivi},
+					cliente:     r.record.ID,
+				}
+				m.mergeConfirm = true
+				return m, nil
+			}
+		}
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+
+	if m.restoreStep != restoreNessuna {
+		if k, ok := msg.(tea.KeyMsg); ok {
+			switch k.String() {
+			case "y", "Y":
+				if m.restoreStep == restorePrimaConferma {
+					m.restoreStep = restoreSecondaConferma
+					return m, nil
+				}
+			case "r", "R":
+				if m.restoreStep == restoreSecondaConferma {
+					m.restoreStep = restoreNessuna
+					return m, tea.Batch(m.startBusy("Ripristino in corso"), m.restoreBackupCmd(m.targetPath))
+				}
+			case "n", "N", "esc":
+				m.restoreStep = restoreNessuna
+			}
+			return m, nil
+		}
+	}
+
+	if m.showConfirm {
+		if k, ok := msg.(tea.KeyMsg); ok {
+			switch k.String() {
+			case "y", "Y":
+				m.showConfirm = false
+				return m, tea.Batch(m.startBusy("Eliminazione in corso"), m.deleteBackupCmd(m.targetPath))
+			case "n", "N", "esc":
+				m.showConfirm = false
+			}
+			return m, nil
+		}
+	}
+
+	if k, ok := msg.(tea.KeyMsg); ok {
+		switch k.String() {
+		case "esc":
+			m.err = nil
+			m.msg = ""
+			return m, func() tea.Msg { return ChangeScreenMsg(StateMenu) }
+		case "n":
+			return m, tea.Batch(m.startBusy("Backup in corso"), m.createBackupCmd())
+		case "v":
+			if b := m.selected(); b != nil {
+				return m, tea.Batch(m.startBusy("Verifica in corso"), m.verifyBackupCmd(b.Path))
+			}
+			return m, nil
+		case "p":
+			if b := m.selected(); b != nil {
+				m.targetPath = b.Path
+				return m, tea.Batch(m.startBusy("Confronto con il database"), m.diffBackupCmd(b.Path))
+			}
+			return m, nil
+		case "u":
+			if len(m.manager.Targets()) == 0 {
+				m.err = fmt.Errorf("nessuna destinazione di replica configurata")
+				return m, nil
+			}
+			if b := m.selected(); b != nil {
+				return m, tea.Batch(m.startBusy("Replica in corso"), m.replicateBackupCmd(b.Path))
+			}
+			return m, nil
+		case "r":
+			if b := m.selected(); b != nil {
+				m.targetPath = b.Path
+				m.restoreStep = restorePrimaConferma
+			}
+			return m, nil
+		case "x", "d":
+			if b := m.selected(); b != nil {
+				m.targetPath = b.Path
+				m.showConfirm = true
+			}
+			return m, nil
+		case "f5":
+			m.Refresh()
+			return m, nil
+		}
+	}
+
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+// renderConfirm renderizza un dialog di conferma
+func (m BackupModel) renderConfirm(titolo, testo, help string) string {
+	var message strings.Builder
+	message.WriteString(titolo + "\n\n")
+	message.WriteString(testo)
+	message.WriteString(HelpStyle.Render("\n" + help))
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ColorError).
+		Padding(1, 2).
+		Width(70).
+		Render(message.String())
+
+	if m.width > 0 && m.height > 0 {
+		return CenterContent(m.width, m.height, box)
+	}
+
+	return box
+}
+
+// renderProgress renderizza la barra di avanzamento testuale
+func (m BackupModel) renderProgress(width int) string {
+	line := m.spinner.View() + " " + m.busyLabel
+	if m.totale == 0 {
+		return line
+	}
+
+	barWidth := width - 20
+	if barWidth < 10 {
+		barWidth = 10
+	}
+
+	pieni := barWidth * m.fatte / m.totale
+	bar := lipgloss.NewStyle().Foreground(ColorPrimary).Render(strings.Repeat("█", pieni)) +
+		lipgloss.NewStyle().Foreground(ColorBorder).Render(strings.Repeat("░", barWidth-pieni))
+
+	return line + "\n" + bar + fmt.Sprintf(" %d/%d", m.fatte, m.totale)
+}
+
+// View implementa tea.Model
+func (m BackupModel) View() string {
+	width := 85
+	if m.width > 0 {
+		width = min(m.width, 95)
+	}
+
+	if m.showOverlay {
+		view := m.viewport.View()
+		if m.mergeConfirm {
+			testo := m.ripristino.descrizione
+			if m.ripristino.opts.SovrascriviModificati {
+				testo += ", sostituendo i record modificati dopo il backup"
+			}
+			view += "\n" + WarningStyle.Render(testo+"? [Y] Sì • [N] No")
+		}
+		return CenterContent(m.width, m.height, view)
+	}
+
+	switch m.restoreStep {
+	case restorePrimaConferma:
+		return m.renderConfirm(
+			"⚠️  RIPRISTINO COMPLETO",
+			ErrorStyle.Render(fmt.Sprintf(
+				"Tutte le collezioni verranno SOSTITUITE con il contenuto di:\n%s\n\n"+
+					"Le modifiche successive al backup andranno perse.\n"+
+					"Per recuperare solo alcuni dati usa [P] Anteprima.\n", m.targetPath)),
+			"[Y] Continua • [N/Esc] Annulla")
+	case restoreSecondaConferma:
+		return m.renderConfirm(
+			"⚠️  CONFERMA DEFINITIVA",
+			WarningStyle.Render("Ultima conferma: il database corrente verrà sovrascritto.\n"),
+			"[R] Ripristina ora • [N/Esc] Annulla")
+	}
+
+	if m.showConfirm {
+		return m.renderConfirm(
+			"⚠️  ELIMINAZIONE BACKUP",
+			fmt.Sprintf("%s\n\n", m.targetPath)+WarningStyle.Render("Sei sicuro di voler procedere?\n"),
+			"[Y] Sì, elimina • [N/Esc] Annulla")
+	}
+
+	header := RenderHeader("BACKUP & RIPRISTINO", width)
+
+	helpText := lipgloss.NewStyle().
+		MarginBottom(1).
+		Foreground(ColorSubText).
+		Render("[N] Crea ora • [V] Verifica • [P] Anteprima/Ripristino selettivo • [R] Ripristina • [U] Replica • [X/D] Elimina • [ESC] Menu")
+
+	body := lipgloss.JoinVertical(
+		lipgloss.Left,
+		helpText,
+		HelpStyle.Render("📁 "+m.manager.BasePath()),
+		HelpStyle.Render("☁️  Repliche: "+m.describeTargets()),
+		m.table.View(),
+	)
+
+	if m.busy {
+		body = lipgloss.JoinVertical(lipgloss.Left, body, "", m.renderProgress(width))
+	}
+
+	footer := RenderFooter(width, m.version)
+	if m.err != nil {
+		footer = "\n" + ErrorStyle.Render("✗ "+m.err.Error()) + "\n" + footer
+	}
+
+	if m.msg != "" {
+		footer = "\n" + SuccessStyle.Render(m.msg) + "\n" + footer
+	}
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		"",
+		lipgloss.NewStyle().Padding(0, 2).Render(body),
+		"",
+		footer,
+	)
+
+	box := MainBoxStyle.Copy().Width(width - 4).Render(content)
+
+	if m.width > 0 && m.height > 0 {
+		return CenterContent(m.width, m.height, box)
+	}
+
+	return "\n" + box
+}
+
+// describeTargets elenca le destinazioni di replica configurate
+func (m BackupModel) describeTargets() string {
+	targets := m.manager.Targets()
+	if len(targets) == 0 {
+		return "nessuna"
+	}
+
+	names := make([]string, 0, len(targets))
+	for _, rt := range targets {
+		names = append(names, rt.Target.Name())
+	}
+	return strings.Join(names, ", ")
+}
@@ -3,6 +3,7 @@ package screens
 import (
 	"fmt"
 	"officina/database"
+	"officina/export"
 	"officina/utils"
 	"strconv"
 	"strings"
@@ -40,6 +41,7 @@ type ClientiModel struct {
 	deleteWarningCommesse  int
 	deleteWarningMovimenti int
 	deleteWarningTotale    float64
+	esporta                sceltaEsportazione
 }
 
 // NewClientiModel crea una nuova istanza del model clienti
@@ -137,6 +139,12 @@ func (m *ClientiModel) Refresh() {
 	m.table.SetRows(rows)
 }
 
+// tabellaExport prepara l'elenco clienti per l'esportazione
+func (m *ClientiModel) tabellaExport() *export.Tabella {
+	list, _ := m.db.ListClienti()
+	return export.Clienti(list)
+}
+
 // countDataForCliente conta veicoli, commesse e movimenti associati a un cliente
 func (m *ClientiModel) countDataForCliente(clienteID int) (int, int, int, float64) {
 	veicoli, _ := m.db.ListVeicoli()
@@ -334,6 +342,15 @@ func (m ClientiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	if msg, ok := msg.(EsportazioneMsg); ok {
+		m.msg, m.err = esitoEsportazione(msg)
+		return m, nil
+	}
+
+	if k, ok := msg.(tea.KeyMsg); ok && m.esporta.attiva {
+		return m, m.esporta.update(k, m.tabellaExport)
+	}
+
 	if k, ok := msg.(tea.KeyMsg); ok && k.String() == "esc" {
 		if m.mode != ClList {
 			m.mode = ClList
@@ -349,10 +366,27 @@ func (m ClientiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyMsg:
 			switch msg.String() {
 			case "n":
+				if err := m.db.Autorizza(database.RisorsaClienti, database.PermessoCrea); err != nil {
+					m.err = err
+					return m, nil
+				}
 				m.mode = ClAdd
 				m.resetForm()
 				return m, nil
+			case "E":
+				if err := m.db.Autorizza(database.RisorsaClienti, database.PermessoEsporta); err != nil {
+					m.err = err
+					return m, nil
+				}
+				m.esporta.attiva = true
+				m.err = nil
+				m.msg = ""
+				return m, nil
 			case "e", "enter":
+				if err := m.db.Autorizza(database.RisorsaClienti, database.PermessoModifica); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.loadIntoForm(id)
@@ -360,6 +394,10 @@ func (m ClientiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			case "x", "d":
+				if err := m.db.Autorizza(database.RisorsaClienti, database.PermessoElimina); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.deletingID = id
@@ -496,13 +534,16 @@ func (m ClientiModel) View() string {
 		helpText := lipgloss.NewStyle().
 			MarginBottom(1).
 			Foreground(ColorSubText).
-			Render("[N] Nuovo • [E/↵] Modifica • [X/D] Elimina • [ESC] Menu")
+			Render("[N] Nuovo • [E/↵] Modifica • [X/D] Elimina • [⇧E] Esporta • [ESC] Menu")
 
 		body = lipgloss.JoinVertical(
 			lipgloss.Left,
 			helpText,
 			m.table.View(),
 		)
+		if m.esporta.attiva {
+			body = lipgloss.JoinVertical(lipgloss.Left, body, "", m.esporta.View())
+		}
 	} else {
 		var form strings.Builder
 		labels := []string{
@@ -3,11 +3,12 @@ package screens
 import (
 	"fmt"
 	"officina/database"
+	"officina/export"
+	"officina/stampa"
 	"officina/utils"
 	"sort"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -26,6 +27,12 @@ const (
 	CommDetail
 )
 
+// FatturaCommesseMsg chiede ad AppModel di aprire nella schermata Fatture la
+// bozza che fattura le commesse selezionate
+type FatturaCommesseMsg struct {
+	Bozza *database.Fattura
+}
+
 // CommesseModel gestisce la schermata commesse
 type CommesseModel struct {
 	db               *database.DB
@@ -49,6 +56,10 @@ type CommesseModel struct {
 	showOverlay      bool
 	deleteWarningMov int
 	deleteWarningTot float64
+	vista            []database.Commessa // commesse nell'ordine mostrato
+	esporta          sceltaEsportazione
+	fatturate        map[int]string // commessa -> numero della fattura
+	daFatturare      map[int]bool   // commesse selezionate per una fattura differita
 }
 
 // CommessaViewItem contiene i dati di visualizzazione di una commessa
@@ -56,6 +67,7 @@ type CommessaViewItem struct {
 	Commessa database.Commessa
 	Versato  float64
 	Residuo  float64
+	Fattura  string
 }
 
 // NewCommesseModel crea una nuova istanza del model commesse
@@ -69,6 +81,7 @@ func NewCommesseModel(db *database.DB) CommesseModel {
 		{Title: "Totale", Width: 12},
 		{Title: "Versato", Width: 12},
 		{Title: "Residuo", Width: 12},
+		{Title: "Fattura", Width: 14},
 	}
 
 	t := table.New(
@@ -133,6 +146,7 @@ func NewCommesseModel(db *database.DB) CommesseModel {
 		veicoloTable:  vt,
 		veicoloFilter: vf,
 		viewport:      vp,
+		daFatturare:   make(map[int]bool),
 	}
 
 	m.Refresh()
@@ -143,6 +157,21 @@ func NewCommesseModel(db *database.DB) CommesseModel {
 func (m *CommesseModel) Refresh() {
 	commesse, _ := m.db.ListCommesse()
 	movimenti, _ := m.db.ListMovimenti()
+	fatture, _ := m.db.ListFatture()
+
+	m.fatturate = make(map[int]string)
+	for _, f := range fatture {
+		if database.Stornabile(f.Tipo) {
+			for _, id := range f.Commesse {
+				m.fatturate[id] = f.Numero
+			}
+		}
+	}
+	for id := range m.daFatturare {
+		if m.fatturate[id] != "" {
+			delete(m.daFatturare, id)
+		}
+	}
 
 	accontiMap := make(map[int]float64)
 	for _, mov := range movimenti {
@@ -163,6 +192,7 @@ func (m *CommesseModel) Refresh() {
 			Commessa: c,
 			Versato:  versato,
 			Residuo:  residuo,
+			Fattura:  m.fatturate[c.ID],
 		})
 	}
 
@@ -176,9 +206,11 @@ func (m *CommesseModel) Refresh() {
 		return viewItems[i].Commessa.DataApertura.After(viewItems[j].Commessa.DataApertura)
 	})
 
+	m.vista = m.vista[:0]
 	rows := []table.Row{}
 	for _, item := range viewItems {
 		c := item.Commessa
+		m.vista = append(m.vista, c)
 		v, _ := m.db.GetVeicolo(c.VeicoloID)
 		veicoloInfo := "N/D"
 		if v != nil {
@@ -190,6 +222,11 @@ func (m *CommesseModel) Refresh() {
 			stato = "🟢 Chiusa"
 		}
 
+		fattura := item.Fattura
+		if m.daFatturare[c.ID] {
+			fattura = "☑ da fatturare"
+		}
+
 		rows = append(rows, table.Row{
 			fmt.Sprintf("%d", c.ID),
 			c.Numero,
@@ -199,12 +236,21 @@ func (m *CommesseModel) Refresh() {
 			utils.FormatEuro(c.Totale),
 			utils.FormatEuro(item.Versato),
 			utils.FormatEuro(item.Residuo),
+			fattura,
 		})
 	}
 
 	m.table.SetRows(rows)
 }
 
+// tabellaExport prepara le commesse nell'ordine della lista per l'esportazione
+func (m *CommesseModel) tabellaExport() *export.Tabella {
+	veicoli, _ := m.db.ListVeicoli()
+	clienti, _ := m.db.ListClienti()
+	movimenti, _ := m.db.ListMovimentiPrimaNota(nil)
+	return export.Commesse(m.vista, veicoli, clienti, movimenti)
+}
+
 // updateVeicoloTable aggiorna la tabella veicoli con filtro
 func (m *CommesseModel) updateVeicoloTable() {
 	veicoli, _ := m.db.ListVeicoli()
@@ -373,6 +419,15 @@ func (m *CommesseModel) loadDetail(id int) {
 		}
 	}
 
+	if numero := m.fatturate[comm.ID]; numero != "" {
+		sb.WriteString("\n")
+		sb.WriteString(lipgloss.NewStyle().
+			Bold(true).
+			Foreground(ColorHighlight).
+			Render("FATTURA") + "\n")
+		sb.WriteString(fmt.Sprintf("📄 Fatturata con la fattura %s\n", numero))
+	}
+
 	if comm.Note != "" {
 		sb.WriteString("\n")
 		sb.WriteString(lipgloss.NewStyle().
@@ -493,7 +548,7 @@ func (m *CommesseModel) save() error {
 		CostoManodopera: manodopera,
 		CostoRicambi:    ricambi,
 		Note:            m.inputs[4].Value(),
-		Stato:           "Aperta",
+		Stato:           database.StatoCommessaAperta,
 	}
 
 	if m.mode == CommAdd {
@@ -521,22 +576,19 @@ func (m *CommesseModel) save() error {
 	return nil
 }
 
-// toggleStato cambia lo stato di una commessa
+// toggleStato chiude la commessa aperta o riapre quella chiusa
 func (m *CommesseModel) toggleStato(id int) error {
 	c, err := m.db.GetCommessa(id)
 	if err != nil {
 		return err
 	}
 
-	if c.Stato == "Aperta" {
-		c.Stato = "Chiusa"
-		c.DataChiusura = time.Now()
+	if c.IsOpen() {
+		c, err = m.db.ChiudiCommessa(id)
 	} else {
-		c.Stato = "Aperta"
-		c.DataChiusura = time.Time{}
+		c, err = m.db.RiapriCommessa(id)
 	}
-
-	if err := m.db.UpdateCommessa(c); err != nil {
+	if err != nil {
 		return err
 	}
 
@@ -545,6 +597,62 @@ func (m *CommesseModel) toggleStato(id int) error {
 	return nil
 }
 
+// selezionaDaFatturare aggiunge o toglie la commessa da quelle da fatturare
+// insieme; si selezionano solo commesse chiuse e non ancora fatturate
+func (m *CommesseModel) selezionaDaFatturare(id int) error {
+	if m.daFatturare[id] {
+		delete(m.daFatturare, id)
+		m.Refresh()
+		return nil
+	}
+
+	c, err := m.db.GetCommessa(id)
+	if err != nil {
+		return err
+	}
+	if c.IsOpen() {
+		return fmt.Errorf("la commessa %s è ancora aperta: chiuderla prima di fatturarla", c.Numero)
+	}
+	if numero := m.fatturate[id]; numero != "" {
+		return fmt.Errorf("la commessa %s è già fatturata con la fattura %s", c.Numero, numero)
+	}
+
+	m.daFatturare[id] = true
+	m.msg = fmt.Sprintf("%d commesse da fatturare: [F] per preparare la fattura", len(m.daFatturare))
+	m.Refresh()
+	return nil
+}
+
+// preparaFattura prepara la fattura delle commesse selezionate, o della sola
+// commessa id se non ne è selezionata nessuna, e la apre nella schermata
+// Fatture
+func (m *CommesseModel) preparaFattura(id int) tea.Cmd {
+	if err := m.db.Autorizza(database.RisorsaFatture, database.PermessoCrea); err != nil {
+		m.err = err
+		return nil
+	}
+
+	ids := []int{id}
+	if len(m.daFatturare) > 0 {
+		ids = ids[:0]
+		for id := range m.daFatturare {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+	}
+	bozza, err := m.db.BozzaFatturaCommesse(ids)
+	if err != nil {
+		m.err = err
+		return nil
+	}
+
+	m.daFatturare = make(map[int]bool)
+	m.err = nil
+	m.msg = ""
+	m.Refresh()
+	return func() tea.Msg { return FatturaCommesseMsg{Bozza: bozza} }
+}
+
 // Init implementa tea.Model
 func (m CommesseModel) Init() tea.Cmd {
 	return nil
@@ -621,6 +729,19 @@ func (m CommesseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	if msg, ok := msg.(EsportazioneMsg); ok {
+		m.msg, m.err = esitoEsportazione(msg)
+		return m, nil
+	}
+	if msg, ok := msg.(StampaEseguitaMsg); ok {
+		m.msg, m.err = esitoStampa(msg)
+		return m, nil
+	}
+
+	if k, ok := msg.(tea.KeyMsg); ok && m.esporta.attiva {
+		return m, m.esporta.update(k, m.tabellaExport)
+	}
+
 	if k, ok := msg.(tea.KeyMsg); ok && k.String() == "esc" {
 		if m.mode != CommList {
 			m.mode = CommList
@@ -636,10 +757,39 @@ func (m CommesseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyMsg:
 			switch msg.String() {
 			case "n":
+				if err := m.db.Autorizza(database.RisorsaCommesse, database.PermessoCrea); err != nil {
+					m.err = err
+					return m, nil
+				}
 				m.mode = CommAdd
 				m.resetForm()
 				return m, nil
+			case "E":
+				if err := m.db.Autorizza(database.RisorsaCommesse, database.PermessoEsporta); err != nil {
+					m.err = err
+					return m, nil
+				}
+				m.esporta.attiva = true
+				m.err = nil
+				m.msg = ""
+				return m, nil
+			case "P":
+				if err := m.db.Autorizza(database.RisorsaCommesse, database.PermessoEsporta); err != nil {
+					m.err = err
+					return m, nil
+				}
+				if row := m.table.SelectedRow(); len(row) > 0 {
+					id, _ := strconv.Atoi(row[0])
+					m.err = nil
+					m.msg = ""
+					return m, func() tea.Msg { return StampaMsg{Modello: stampa.ModelloOrdine, ID: id} }
+				}
+				return m, nil
 			case "e", "enter":
+				if err := m.db.Autorizza(database.RisorsaCommesse, database.PermessoModifica); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.loadIntoForm(id)
@@ -652,6 +802,22 @@ func (m CommesseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.loadDetail(id)
 				}
 				return m, nil
+			case " ":
+				if row := m.table.SelectedRow(); len(row) > 0 {
+					id, _ := strconv.Atoi(row[0])
+					m.err = nil
+					m.msg = ""
+					if err := m.selezionaDaFatturare(id); err != nil {
+						m.err = err
+					}
+				}
+				return m, nil
+			case "f":
+				if row := m.table.SelectedRow(); len(row) > 0 {
+					id, _ := strconv.Atoi(row[0])
+					return m, m.preparaFattura(id)
+				}
+				return m, nil
 			case "s":
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
@@ -661,6 +827,10 @@ func (m CommesseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			case "x":
+				if err := m.db.Autorizza(database.RisorsaCommesse, database.PermessoElimina); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.deletingID = id
@@ -822,13 +992,16 @@ func (m CommesseModel) View() string {
 		helpText := lipgloss.NewStyle().
 			MarginBottom(1).
 			Foreground(ColorSubText).
-			Render(openBadge + "[N] Nuova • [E/↵] Modifica • [D] Dettaglio • [S] Cambia Stato • [X] Elimina • [ESC] Menu")
+			Render(openBadge + "[N] Nuova • [E/↵] Modifica • [D] Dettaglio • [S] Cambia Stato • [Spazio] Seleziona • [F] Fattura • [X] Elimina • [⇧P] Ordine di lavoro • [⇧E] Esporta • [ESC] Menu")
 
 		body = lipgloss.JoinVertical(
 			lipgloss.Left,
 			helpText,
 			m.table.View(),
 		)
+		if m.esporta.attiva {
+			body = lipgloss.JoinVertical(lipgloss.Left, body, "", m.esporta.View())
+		}
 	} else {
 		var form strings.Builder
 		labels := []string{"Veicolo", "Lavori Eseguiti", "Costo Manodopera", "Costo Ricambi", "Note"}
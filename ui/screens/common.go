@@ -21,6 +21,10 @@ const (
 	StateOperatori
 	StatePreventivi
 	StateFatture
+	StateBackup
+	StateImpostazioni
+	StateProfiloAzienda
+	StateLogin
 )
 
 // ChangeScreenMsg è il messaggio per cambiare schermata
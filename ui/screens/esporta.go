@@ -0,0 +1,60 @@
+package screens
+
+import (
+	"fmt"
+	"officina/export"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// EsportaVistaMsg chiede ad AppModel di salvare la vista corrente nella
+// cartella di export configurata
+type EsportaVistaMsg struct {
+	Tabella *export.Tabella
+	Formato string
+}
+
+// EsportazioneMsg riporta alla schermata attiva l'esito dell'esportazione
+type EsportazioneMsg struct {
+	Path  string
+	Righe int
+	Err   error
+}
+
+// sceltaEsportazione gestisce la scelta del formato dopo [Shift+E] nelle
+// schermate elenco
+type sceltaEsportazione struct {
+	attiva bool
+}
+
+// update chiude la scelta; vista costruisce la tabella solo se l'utente
+// sceglie un formato
+func (s *sceltaEsportazione) update(k tea.KeyMsg, vista func() *export.Tabella) tea.Cmd {
+	s.attiva = false
+
+	formato := ""
+	switch k.String() {
+	case "c", "C":
+		formato = export.FormatoCSV
+	case "x", "X":
+		formato = export.FormatoXLSX
+	default:
+		return nil
+	}
+
+	t := vista()
+	return func() tea.Msg { return EsportaVistaMsg{Tabella: t, Formato: formato} }
+}
+
+// View mostra i formati disponibili
+func (s sceltaEsportazione) View() string {
+	return WarningStyle.Render("Esporta la vista corrente: [C] CSV • [X] Excel (XLSX) • [Esc] Annulla")
+}
+
+// esitoEsportazione converte l'esito nel messaggio mostrato dalla schermata
+func esitoEsportazione(msg EsportazioneMsg) (string, error) {
+	if msg.Err != nil {
+		return "", fmt.Errorf("esportazione non riuscita: %w", msg.Err)
+	}
+	return fmt.Sprintf("✓ Esportate %d righe in %s", msg.Righe, msg.Path), nil
+}
@@ -0,0 +1,138 @@
+package screens
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"officina/fatturapa"
+)
+
+// GeneraFatturaPAMsg chiede ad AppModel di generare l'XML della fattura
+// nella cartella di export configurata
+type GeneraFatturaPAMsg struct {
+	FatturaID int
+}
+
+// FatturaPAGenerataMsg riporta alla schermata Fatture l'esito della generazione
+type FatturaPAGenerataMsg struct {
+	FatturaID int
+	Path      string
+	Err       error
+}
+
+// esitoFatturaPA converte l'esito nel messaggio mostrato dalla schermata;
+// i dati da correggere sono elencati uno per riga con il campo e, per i
+// controlli dello SDI, il codice dello scarto
+func esitoFatturaPA(msg FatturaPAGenerataMsg) (string, error) {
+	var ec *fatturapa.ErroreControllo
+	if errors.As(msg.Err, &ec) {
+		var b strings.Builder
+		b.WriteString("fattura elettronica non generata, dati da correggere:")
+		for _, p := range ec.Problemi {
+			b.WriteString("\n  • " + etichettaCampo(p.Campo) + ": " + p.Messaggio)
+			if p.Codice != "" {
+				b.WriteString(" [" + p.Codice + "]")
+			}
+		}
+		return "", errors.New(b.String())
+	}
+	if msg.Err != nil {
+		return "", fmt.Errorf("fattura elettronica non generata: %w", msg.Err)
+	}
+	return "✓ Fattura elettronica salvata in " + msg.Path, nil
+}
+
+// Schede in cui si correggono i dati segnalati
+var schedeCampo = map[string]string{
+	"fattura": "Fattura",
+	"cliente": "Cliente",
+	"profilo": "Dati Officina",
+}
+
+// Nomi dei dati nelle schermate
+var nomiCampo = map[string]string{
+	"numero":              "Numero",
+	"data":                "Data",
+	"cliente_id":          "Cliente",
+	"righe":               "Righe",
+	"ragione_sociale":     "Ragione sociale",
+	"partita_iva":         "P.IVA",
+	"codice_fiscale":      "Codice fiscale",
+	"codice_destinatario": "Codice destinatario",
+	"pec":                 "PEC",
+	"indirizzo":           "Indirizzo",
+	"cap":                 "CAP",
+	"citta":               "Città",
+	"provincia":           "Provincia",
+	"nazione":             "Nazione",
+	"regime_fiscale":      "Regime fiscale",
+	"rea_ufficio":         "Ufficio REA",
+	"rea_numero":          "Numero REA",
+	"telefono":            "Telefono",
+	"email":               "Email",
+	"iban":                "IBAN",
+	"banca":               "Banca",
+	"descrizione":         "Descrizione",
+	"quantita":            "Quantità",
+	"prezzo_unitario":     "Prezzo",
+	"sconto":              "Sconto %",
+	"aliquota_iva":        "IVA",
+	"natura":              "IVA",
+	"regime_iva":          "Regime IVA",
+	"ritenuta":            "Ritenuta",
+}
+
+// etichettaCampo descrive un campo dei problemi FatturaPA come lo vede
+// l'operatore: "cliente.cap" diventa "Cliente › CAP", "righe[2].sconto"
+// diventa "Riga 3 › Sconto %"
+func etichettaCampo(campo string) string {
+	scheda, nome, _ := strings.Cut(campo, ".")
+	if riga, ok := rigaCampo(campo); ok {
+		scheda = fmt.Sprintf("Riga %d", riga+1)
+	} else if s, ok := schedeCampo[scheda]; ok {
+		scheda = s
+	}
+	if nome == "" {
+		return scheda
+	}
+	if n, ok := nomiCampo[nome]; ok {
+		nome = n
+	}
+	return scheda + " › " + nome
+}
+
+// rigaCampo restituisce l'indice della riga per i campi "righe[i]..."
+func rigaCampo(campo string) (int, bool) {
+	if !strings.HasPrefix(campo, "righe[") {
+		return 0, false
+	}
+	indice, _, _ := strings.Cut(strings.TrimPrefix(campo, "righe["), "]")
+	i, err := strconv.Atoi(indice)
+	return i, err == nil
+}
+
+// campoForm restituisce il campo del form fattura in cui si corregge il
+// problema: i dati del cliente si correggono scegliendo o modificando il
+// cliente, quelli del profilo non sono nel form (-1)
+func campoForm(campo string) int {
+	if _, ok := rigaCampo(campo); ok {
+		return fatCampoRighe
+	}
+	switch {
+	case campo == "fattura.tipo", campo == "fattura.riferimento":
+		return fatCampoTipo
+	case campo == "fattura.data":
+		return fatCampoData
+	case campo == "fattura.cliente_id", strings.HasPrefix(campo, "cliente."):
+		return fatCampoCliente
+	case campo == "fattura.regime_iva":
+		return fatCampoRegime
+	case campo == "fattura.ritenuta":
+		return fatCampoRitenuta
+	case campo == "fattura.righe":
+		return fatCampoRighe
+	}
+	return -1
+}
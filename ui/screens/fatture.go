@@ -1,8 +1,12 @@
 package screens
 
 import (
+	"errors"
 	"fmt"
 	"officina/database"
+	"officina/export"
+	"officina/fatturapa"
+	"officina/stampa"
 	"officina/utils"
 	"strconv"
 	"strings"
@@ -23,6 +27,28 @@ const (
 	FatModeEdit
 )
 
+// Campi del form fattura; l'ultimo è la tabella delle righe
+const (
+	fatCampoTipo = iota
+	fatCampoData
+	fatCampoSezionale
+	fatCampoCliente
+	fatCampoPagamento
+	fatCampoRegime
+	fatCampoRitenuta
+	fatCampoRighe
+	fatNumCampi
+)
+
+// Campi del form di una riga
+const (
+	rigaDescrizione = iota
+	rigaQuantita
+	rigaPrezzo
+	rigaSconto
+	rigaIVA
+)
+
 // FattureModel gestisce la schermata fatture
 type FattureModel struct {
 	db          *database.DB
@@ -31,12 +57,52 @@ type FattureModel struct {
 	mode        FattureMode
 	focusIndex  int
 	selectedID  int
+	numero      string // numero della fattura in modifica
+	tipo        string // tipo del documento (database.TipoDocumento*)
 	err         error
 	msg         string
 	width       int
 	height      int
 	showConfirm bool
 	deletingID  int
+	profilo     *database.ProfiloAzienda
+	esporta     sceltaEsportazione
+
+	// Fattura stornata dalla nota di credito in preparazione
+	riferimentoID int
+	riferimento   string
+	residuo       float64
+
+	// Commesse fatturate dal documento
+	commesse     []int
+	commesseInfo string // numeri delle commesse, per il form
+
+	// Condizione di pagamento (database.Pagamento*) e regime IVA
+	// (database.RegimeIVA* o natura N6.x)
+	pagamento string
+	regime    string
+
+	// Incassi della fattura selezionata e scadenzario dei crediti
+	incassi     *pannelloIncassi
+	scadenzario *database.ScadenzarioCrediti
+
+	// Cliente intestatario
+	clienteID     int
+	selectionMode bool
+	clientTable   table.Model
+	clientFilter  textinput.Model
+
+	// Righe del documento
+	righe        []database.RigaFattura
+	righeTable   table.Model
+	rigaInputs   []textinput.Model
+	rigaAperta   bool
+	rigaIndex    int // riga in modifica, -1 per una nuova
+	rigaFocus    int
+	importoFisso float64 // totale delle fatture registrate senza righe
+
+	// Dati da correggere segnalati dalla generazione della fattura elettronica
+	problemi []fatturapa.Problema
 }
 
 // NewFattureModel crea una nuova istanza del model fatture
@@ -45,10 +111,12 @@ func NewFattureModel(db *database.DB) FattureModel {
 	t := table.New(
 		table.WithColumns([]table.Column{
 			{Title: "ID", Width: 4},
+			{Title: "Tipo", Width: 4},
 			{Title: "Numero", Width: 15},
 			{Title: "Data", Width: 12},
-			{Title: "Cliente", Width: 30},
-			{Title: "Importo", Width: 12},
+			{Title: "Cliente", Width: 24},
+			{Title: "Totale", Width: 12},
+			{Title: "Stato", Width: 14},
 		}),
 		table.WithHeight(12),
 		table.WithFocused(true),
@@ -57,25 +125,95 @@ func NewFattureModel(db *database.DB) FattureModel {
 	t.SetStyles(GetTableStyles())
 
 	// Configurazione inputs
-	inputs := make([]textinput.Model, 3)
-	inputs[0] = textinput.New()
-	inputs[0].Placeholder = "Data (GG/MM/AAAA)"
-	inputs[0].CharLimit = 10
-	inputs[0].Width = 30
+	inputs := make([]textinput.Model, fatCampoRighe)
+	inputs[fatCampoTipo] = textinput.New()
+	inputs[fatCampoTipo].Width = 30
+
+	inputs[fatCampoData] = textinput.New()
+	inputs[fatCampoData].Placeholder = "Data (GG/MM/AAAA)"
+	inputs[fatCampoData].CharLimit = 10
+	inputs[fatCampoData].Width = 30
+
+	inputs[fatCampoSezionale] = textinput.New()
+	inputs[fatCampoSezionale].Placeholder = "Vuoto = principale (es. A)"
+	inputs[fatCampoSezionale].CharLimit = 10
+	inputs[fatCampoSezionale].Width = 30
+
+	inputs[fatCampoCliente] = textinput.New()
+	inputs[fatCampoCliente].Placeholder = "[ INVIO PER SCEGLIERE IL CLIENTE ]"
+	inputs[fatCampoCliente].Width = 50
+
+	inputs[fatCampoPagamento] = textinput.New()
+	inputs[fatCampoPagamento].Width = 30
+
+	inputs[fatCampoRegime] = textinput.New()
+	inputs[fatCampoRegime].Width = 40
+
+	inputs[fatCampoRitenuta] = textinput.New()
+	inputs[fatCampoRitenuta].Placeholder = "Vuoto = nessuna (es. 20 RT01 A)"
+	inputs[fatCampoRitenuta].CharLimit = 20
+	inputs[fatCampoRitenuta].Width = 30
+
+	rt := table.New(
+		table.WithColumns([]table.Column{
+			{Title: "#", Width: 3},
+			{Title: "Descrizione", Width: 28},
+			{Title: "Q.tà", Width: 6},
+			{Title: "Prezzo", Width: 11},
+			{Title: "Sc.%", Width: 5},
+			{Title: "IVA", Width: 5},
+			{Title: "Imponibile", Width: 12},
+		}),
+		table.WithHeight(6),
+	)
+	rt.SetStyles(GetTableStyles())
+
+	rigaInputs := make([]textinput.Model, 5)
+	rigaInputs[rigaDescrizione] = textinput.New()
+	rigaInputs[rigaDescrizione].Placeholder = "Descrizione (es. Sostituzione pastiglie)"
+	rigaInputs[rigaDescrizione].CharLimit = 1000
+	rigaInputs[rigaDescrizione].Width = 50
+
+	rigaInputs[rigaQuantita] = textinput.New()
+	rigaInputs[rigaQuantita].Placeholder = "Quantità (vuoto = 1)"
+	rigaInputs[rigaQuantita].Width = 20
+
+	rigaInputs[rigaPrezzo] = textinput.New()
+	rigaInputs[rigaPrezzo].Placeholder = "Prezzo unitario IVA esclusa"
+	rigaInputs[rigaPrezzo].Width = 30
+
+	rigaInputs[rigaSconto] = textinput.New()
+	rigaInputs[rigaSconto].Placeholder = "Sconto % (vuoto = nessuno)"
+	rigaInputs[rigaSconto].Width = 30
 
-	inputs[1] = textinput.New()
-	inputs[1].Placeholder = "Cliente o descrizione"
-	inputs[1].Width = 50
+	rigaInputs[rigaIVA] = textinput.New()
+	rigaInputs[rigaIVA].Placeholder = "Aliquota (22, 10, 5, 4) o natura (N1-N7)"
+	rigaInputs[rigaIVA].Width = 45
 
-	inputs[2] = textinput.New()
-	inputs[2].Placeholder = "Importo (es. 1250.50)"
-	inputs[2].Width = 30
+	ct := table.New(
+		table.WithColumns([]table.Column{
+			{Title: "ID", Width: 4},
+			{Title: "Ragione Sociale/N.C.", Width: 35},
+			{Title: "P.IVA / C.F.", Width: 16},
+		}),
+		table.WithFocused(true),
+		table.WithHeight(10),
+	)
+	ct.SetStyles(GetTableStyles())
+
+	cf := textinput.New()
+	cf.Placeholder = "🔍 Cerca cliente..."
+	cf.Width = 50
 
 	m := FattureModel{
-		db:     db,
-		table:  t,
-		inputs: inputs,
-		mode:   FatModeList,
+		db:           db,
+		table:        t,
+		inputs:       inputs,
+		mode:         FatModeList,
+		clientTable:  ct,
+		clientFilter: cf,
+		righeTable:   rt,
+		rigaInputs:   rigaInputs,
 	}
 
 	m.Refresh()
@@ -84,7 +222,11 @@ func NewFattureModel(db *database.DB) FattureModel {
 
 // Refresh aggiorna la lista delle fatture
 func (m *FattureModel) Refresh() {
+	m.RefreshProfilo()
+
 	list, _ := m.db.ListFatture()
+	movimenti, _ := m.db.ListMovimentiPrimaNota(nil)
+	situazioni := database.SituazioniIncassi(list, movimenti, time.Now())
 	rows := []table.Row{}
 
 	for _, f := range list {
@@ -96,18 +238,168 @@ func (m *FattureModel) Refresh() {
 			}
 		}
 
+		// Le note di credito riducono il credito verso il cliente
+		totale := f.Importo
+		if f.TipoDocumento() == database.TipoDocumentoNotaCredito {
+			totale = -totale
+		}
+		// Solo fatture e fatture differite si incassano
+		stato := ""
+		if s, ok := situazioni[f.ID]; ok {
+			stato = s.Stato
+			if s.Ritardo > 0 {
+				stato += fmt.Sprintf(" %dgg", s.Ritardo)
+			}
+		}
 		rows = append(rows, table.Row{
 			fmt.Sprintf("%d", f.ID),
+			siglaTipo[f.TipoDocumento()],
 			f.Numero,
 			utils.FormatDate(f.Data),
-			utils.Truncate(cliente, 30),
-			utils.FormatEuro(f.Importo),
+			utils.Truncate(cliente, 24),
+			utils.FormatEuro(totale),
+			stato,
 		})
 	}
 
 	m.table.SetRows(rows)
 }
 
+// siglaTipo abbrevia il tipo di documento nella lista
+var siglaTipo = map[string]string{
+	database.TipoDocumentoFattura:     "FT",
+	database.TipoDocumentoDifferita:   "FD",
+	database.TipoDocumentoNotaCredito: "NC",
+	database.TipoDocumentoProforma:    "PF",
+}
+
+// tabellaExport prepara l'elenco fatture per l'esportazione
+func (m *FattureModel) tabellaExport() *export.Tabella {
+	fatture, _ := m.db.ListFatture()
+	clienti, _ := m.db.ListClienti()
+	return export.Fatture(fatture, clienti)
+}
+
+// RefreshProfilo ricarica i dati dell'officina che emette le fatture
+func (m *FattureModel) RefreshProfilo() {
+	if p, err := m.db.GetProfiloAzienda(); err == nil {
+		m.profilo = p
+	}
+}
+
+// updateClientTable aggiorna la tabella clienti con filtro
+func (m *FattureModel) updateClientTable() {
+	clienti, _ := m.db.ListClienti()
+	filter := strings.ToUpper(strings.TrimSpace(m.clientFilter.Value()))
+	rows := []table.Row{}
+
+	for _, c := range clienti {
+		fiscale := c.PartitaIVA
+		if fiscale == "" {
+			fiscale = c.CodiceFiscale
+		}
+
+		if filter == "" ||
+			strings.Contains(strings.ToUpper(c.RagioneSociale), filter) ||
+			strings.Contains(strings.ToUpper(fiscale), filter) {
+			rows = append(rows, table.Row{
+				fmt.Sprintf("%d", c.ID),
+				utils.Truncate(c.RagioneSociale, 35),
+				fiscale,
+			})
+		}
+	}
+
+	m.clientTable.SetRows(rows)
+}
+
+// updateRigheTable mostra le righe del documento
+func (m *FattureModel) updateRigheTable() {
+	rows := make([]table.Row, len(m.righe))
+	for i, r := range m.righe {
+		sconto := ""
+		if r.Sconto != 0 {
+			sconto = formatAliquota(r.Sconto)
+		}
+		numero := fmt.Sprintf("%d", i+1)
+		for _, p := range m.problemi {
+			if riga, ok := rigaCampo(p.Campo); ok && riga == i {
+				numero = "⚠" + numero
+				break
+			}
+		}
+		rows[i] = table.Row{
+			numero,
+			utils.Truncate(r.Descrizione, 28),
+			formatAliquota(r.Quantita),
+			utils.FormatEuro(r.PrezzoUnitario),
+			sconto,
+			r.CodiceIVA(),
+			utils.FormatEuro(r.Imponibile()),
+		}
+	}
+	m.righeTable.SetRows(rows)
+}
+
+// apriProblemi apre la fattura nel form sul primo campo da correggere; chi
+// non può modificare le fatture vede solo l'elenco dei problemi
+func (m *FattureModel) apriProblemi(id int, problemi []fatturapa.Problema) {
+	if err := m.db.Autorizza(database.RisorsaFatture, database.PermessoModifica); err != nil {
+		return
+	}
+	m.loadIntoForm(id)
+	if m.err != nil {
+		return
+	}
+	m.mode = FatModeEdit
+	m.problemi = problemi
+
+	for _, p := range problemi {
+		campo := campoForm(p.Campo)
+		if campo < 0 {
+			continue
+		}
+		m.focusIndex = campo
+		if riga, ok := rigaCampo(p.Campo); ok && riga < len(m.righe) {
+			m.righeTable.SetCursor(riga)
+		}
+		break
+	}
+	m.updateRigheTable()
+	m.updateFocus()
+}
+
+// segnaProblemi evidenzia accanto al campo i dati da correggere
+func (m FattureModel) segnaProblemi(campo int) string {
+	if !m.haProblemi(campo) {
+		return ""
+	}
+	return " " + WarningStyle.Render("⚠ da correggere")
+}
+
+// haProblemi indica se un campo del form ha dati da correggere
+func (m FattureModel) haProblemi(campo int) bool {
+	for _, p := range m.problemi {
+		if campoForm(p.Campo) == campo {
+			return true
+		}
+	}
+	return false
+}
+
+// codiceIVAPredefinito è l'aliquota proposta per le nuove righe (vedi
+// ProfiloAzienda.IVAPredefinita)
+func (m *FattureModel) codiceIVAPredefinito() string {
+	if m.profilo == nil {
+		return formatAliquota(database.AliquoteIVA[0])
+	}
+	aliquota, natura := m.profilo.IVAPredefinita()
+	if natura != "" {
+		return natura
+	}
+	return formatAliquota(aliquota)
+}
+
 // resetForm resetta il form
 func (m *FattureModel) resetForm() {
 	for i := range m.inputs {
@@ -115,11 +407,24 @@ func (m *FattureModel) resetForm() {
 	}
 
 	// Imposta data corrente
-	m.inputs[0].SetValue(time.Now().Format("02/01/2006"))
-	m.focusIndex = 0
+	m.inputs[fatCampoData].SetValue(time.Now().Format("02/01/2006"))
+	m.numero = ""
+	m.impostaTipo(database.TipoDocumentoFattura)
+	m.riferimentoID = 0
+	m.riferimento = ""
+	m.residuo = 0
+	m.impostaCommesse(nil)
+	m.impostaPagamento("")
+	m.impostaRegime(database.RegimeIVAOrdinario)
+	m.clienteID = 0
+	m.righe = nil
+	m.importoFisso = 0
+	m.rigaAperta = false
+	m.updateRigheTable()
+	m.focusIndex = fatCampoData
 	m.err = nil
 	m.msg = ""
-	m.inputs[0].Focus()
+	m.updateFocus()
 }
 
 // loadIntoForm carica una fattura nel form
@@ -131,23 +436,202 @@ func (m *FattureModel) loadIntoForm(id int) {
 	}
 
 	m.selectedID = id
-	m.inputs[0].SetValue(f.Data.Format("02/01/2006"))
+	m.numero = f.Numero
+	m.impostaTipo(f.TipoDocumento())
+	m.riferimentoID = f.RiferimentoID
+	m.riferimento = ""
+	if f.RiferimentoID > 0 {
+		m.riferimento = f.RiferimentoNumero + " del " + utils.FormatDate(f.RiferimentoData)
+	}
+	m.residuo = 0
+	m.impostaCommesse(f.Commesse)
+	m.impostaPagamento(f.Pagamento)
+	m.impostaRegime(f.RegimeIVA)
+	m.inputs[fatCampoRitenuta].SetValue(formatRitenuta(f))
+	m.inputs[fatCampoData].SetValue(f.Data.Format("02/01/2006"))
+	m.inputs[fatCampoSezionale].SetValue(f.Sezionale)
 
-	cliente := ""
+	m.clienteID = f.ClienteID
+	m.inputs[fatCampoCliente].SetValue("")
 	if f.ClienteID > 0 {
 		c, _ := m.db.GetCliente(f.ClienteID)
 		if c != nil {
-			cliente = c.RagioneSociale
+			m.inputs[fatCampoCliente].SetValue(c.RagioneSociale)
 		}
 	}
 
-	m.inputs[1].SetValue(cliente)
-	m.inputs[2].SetValue(fmt.Sprintf("%.2f", f.Importo))
+	m.problemi = nil
+	m.righe = append([]database.RigaFattura(nil), f.Righe...)
+	m.importoFisso = 0
+	if len(f.Righe) == 0 {
+		m.importoFisso = f.Importo
+	}
+	m.rigaAperta = false
+	m.updateRigheTable()
 
-	m.focusIndex = 0
+	m.focusIndex = fatCampoData
 	m.err = nil
 	m.msg = ""
-	m.inputs[0].Focus()
+	m.updateFocus()
+}
+
+// impostaTipo cambia il tipo del documento e la sua descrizione nel form
+func (m *FattureModel) impostaTipo(tipo string) {
+	m.tipo = tipo
+	m.inputs[fatCampoTipo].SetValue(database.DescrizioneTipoDocumento(tipo))
+}
+
+// ciclaTipo passa al tipo successivo tra quelli di un nuovo documento
+func (m *FattureModel) ciclaTipo() {
+	tipi := database.TipiDocumento
+	for i, t := range tipi {
+		if t == m.tipo {
+			m.impostaTipo(tipi[(i+1)%len(tipi)])
+			return
+		}
+	}
+	m.impostaTipo(tipi[0])
+}
+
+// impostaCommesse collega al documento le commesse che fattura
+func (m *FattureModel) impostaCommesse(ids []int) {
+	m.commesse = ids
+	var numeri []string
+	for _, id := range ids {
+		if c, err := m.db.GetCommessa(id); err == nil {
+			numeri = append(numeri, c.Numero)
+		} else {
+			numeri = append(numeri, fmt.Sprintf("#%d", id))
+		}
+	}
+	m.commesseInfo = strings.Join(numeri, ", ")
+}
+
+// impostaPagamento cambia la condizione di pagamento e la sua descrizione nel form
+func (m *FattureModel) impostaPagamento(pagamento string) {
+	m.pagamento = pagamento
+	m.inputs[fatCampoPagamento].SetValue(database.DescrizioneCondizionePagamento(pagamento))
+}
+
+// ciclaPagamento passa alla condizione di pagamento successiva
+func (m *FattureModel) ciclaPagamento() {
+	condizioni := database.CondizioniPagamento
+	for i, c := range condizioni {
+		if c == m.pagamento {
+			m.impostaPagamento(condizioni[(i+1)%len(condizioni)])
+			return
+		}
+	}
+	m.impostaPagamento(condizioni[0])
+}
+
+// impostaRegime cambia il regime IVA e la sua descrizione nel form
+func (m *FattureModel) impostaRegime(regime string) {
+	m.regime = regime
+	descrizione := database.DescrizioneRegimeIVA(regime)
+	if database.InversioneContabile(regime) {
+		descrizione = regime + " " + descrizione
+	}
+	m.inputs[fatCampoRegime].SetValue(descrizione)
+}
+
+// ciclaRegime passa al regime IVA successivo
+func (m *FattureModel) ciclaRegime() {
+	regimi := database.RegimiIVA
+	for i, r := range regimi {
+		if r == m.regime {
+			m.impostaRegime(regimi[(i+1)%len(regimi)])
+			return
+		}
+	}
+	m.impostaRegime(regimi[0])
+}
+
+// parseRitenuta interpreta la ritenuta d'acconto scritta come "aliquota
+// [tipo] [causale]", per esempio "20", "20 RT01 A" o "4 RT02"; tipo e
+// causale mancanti sono RT01 e la causale predefinita. Vuoto è nessuna
+// ritenuta.
+func parseRitenuta(s string) (tipo string, aliquota float64, causale string, err error) {
+	campi := strings.Fields(strings.ToUpper(s))
+	if len(campi) == 0 {
+		return "", 0, "", nil
+	}
+	if len(campi) > 3 {
+		return "", 0, "", fmt.Errorf("ritenuta: indicare aliquota, tipo e causale (es. 20 RT01 A)")
+	}
+	aliquota, err = strconv.ParseFloat(strings.ReplaceAll(strings.TrimSuffix(campi[0], "%"), ",", "."), 64)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("ritenuta: aliquota non valida: %s", campi[0])
+	}
+	tipo, causale = database.RitenutaPersoneFisiche, database.CausaleRitenutaPredefinita
+	if len(campi) > 1 {
+		tipo = campi[1]
+	}
+	if len(campi) > 2 {
+		causale = campi[2]
+	}
+	return tipo, aliquota, causale, nil
+}
+
+// formatRitenuta scrive la ritenuta della fattura nella forma letta da
+// parseRitenuta
+func formatRitenuta(f *database.Fattura) string {
+	if f.RitenutaTipo == "" {
+		return ""
+	}
+	return formatAliquota(f.RitenutaAliquota) + " " + f.RitenutaTipo + " " + f.RitenutaCausale
+}
+
+// apriBozza carica nel form un nuovo documento preparato dal database
+func (m *FattureModel) apriBozza(f *database.Fattura) {
+	m.mode = FatModeAdd
+	m.problemi = nil
+	m.resetForm()
+	m.impostaTipo(f.TipoDocumento())
+	m.impostaCommesse(f.Commesse)
+	m.impostaPagamento(f.Pagamento)
+	m.impostaRegime(f.RegimeIVA)
+	m.inputs[fatCampoRitenuta].SetValue(formatRitenuta(f))
+	m.inputs[fatCampoSezionale].SetValue(f.Sezionale)
+	m.clienteID = f.ClienteID
+	if c, err := m.db.GetCliente(f.ClienteID); err == nil {
+		m.inputs[fatCampoCliente].SetValue(c.RagioneSociale)
+	}
+	m.righe = f.Righe
+	if len(f.Righe) == 0 {
+		m.importoFisso = f.Importo
+	}
+	m.updateRigheTable()
+
+	m.focusIndex = fatCampoRighe
+	m.updateFocus()
+}
+
+// apriNotaCredito prepara nel form la nota di credito che storna per intero
+// la fattura id; per uno storno parziale si riducono o eliminano le righe
+func (m *FattureModel) apriNotaCredito(id int) {
+	if err := m.db.Autorizza(database.RisorsaFatture, database.PermessoCrea); err != nil {
+		m.err = err
+		return
+	}
+	nota, residuo, err := m.db.BozzaNotaCredito(id)
+	if err != nil {
+		m.err = err
+		return
+	}
+
+	m.apriBozza(nota)
+	m.riferimentoID = nota.RiferimentoID
+	m.riferimento = nota.RiferimentoNumero + " del " + utils.FormatDate(nota.RiferimentoData)
+	m.residuo = residuo
+	m.msg = "Storno totale della fattura " + nota.RiferimentoNumero + ": per uno storno parziale modifica o elimina le righe"
+}
+
+// ApriFatturaCommesse apre nel form la fattura delle commesse preparata
+// dalla schermata Commesse (vedi database.BozzaFatturaCommesse)
+func (m *FattureModel) ApriFatturaCommesse(f *database.Fattura) {
+	m.apriBozza(f)
+	m.msg = database.DescrizioneTipoDocumento(f.Tipo) + " delle commesse " + m.commesseInfo + ": controlla le righe e salva"
 }
 
 // updateFocus aggiorna il focus tra i campi
@@ -159,11 +643,131 @@ func (m *FattureModel) updateFocus() {
 			m.inputs[i].Blur()
 		}
 	}
+	if m.focusIndex == fatCampoRighe {
+		m.righeTable.Focus()
+	} else {
+		m.righeTable.Blur()
+	}
+}
+
+// updateRigaFocus aggiorna il focus tra i campi della riga
+func (m *FattureModel) updateRigaFocus() {
+	for i := range m.rigaInputs {
+		if i == m.rigaFocus {
+			m.rigaInputs[i].Focus()
+		} else {
+			m.rigaInputs[i].Blur()
+		}
+	}
+}
+
+// apriRiga apre il form della riga indicata, o di una nuova con indice -1
+func (m *FattureModel) apriRiga(indice int) {
+	for i := range m.rigaInputs {
+		m.rigaInputs[i].SetValue("")
+	}
+
+	if indice >= 0 && indice < len(m.righe) {
+		r := m.righe[indice]
+		m.rigaInputs[rigaDescrizione].SetValue(r.Descrizione)
+		m.rigaInputs[rigaQuantita].SetValue(formatAliquota(r.Quantita))
+		m.rigaInputs[rigaPrezzo].SetValue(fmt.Sprintf("%.2f", r.PrezzoUnitario))
+		if r.Sconto != 0 {
+			m.rigaInputs[rigaSconto].SetValue(formatAliquota(r.Sconto))
+		}
+		m.rigaInputs[rigaIVA].SetValue(r.CodiceIVA())
+	} else {
+		indice = -1
+		m.rigaInputs[rigaIVA].SetValue(m.codiceIVAPredefinito())
+	}
+
+	m.rigaIndex = indice
+	m.rigaAperta = true
+	m.rigaFocus = rigaDescrizione
+	m.err = nil
+	m.updateRigaFocus()
+}
+
+// confermaRiga valida il form della riga e la aggiunge al documento
+func (m *FattureModel) confermaRiga() error {
+	valore := func(i int) string { return strings.TrimSpace(m.rigaInputs[i].Value()) }
+
+	r := database.RigaFattura{Descrizione: valore(rigaDescrizione), Quantita: 1}
+	if q := valore(rigaQuantita); q != "" {
+		v, err := utils.ParseFloat(q)
+		if err != nil {
+			return fmt.Errorf("quantità non valida")
+		}
+		r.Quantita = v
+	}
+
+	prezzo, err := utils.ParseFloat(valore(rigaPrezzo))
+	if err != nil {
+		return fmt.Errorf("prezzo unitario non valido")
+	}
+	r.PrezzoUnitario = prezzo
+
+	sconto, err := utils.ParseFloat(valore(rigaSconto))
+	if err != nil {
+		return fmt.Errorf("sconto non valido")
+	}
+	r.Sconto = sconto
+
+	if r.AliquotaIVA, r.Natura, err = database.ParseCodiceIVA(valore(rigaIVA)); err != nil {
+		return err
+	}
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	if m.rigaIndex >= 0 {
+		m.righe[m.rigaIndex] = r
+	} else {
+		m.righe = append(m.righe, r)
+		m.righeTable.SetCursor(len(m.righe) - 1)
+	}
+	m.rigaAperta = false
+	m.updateRigheTable()
+	return nil
+}
+
+// eliminaRiga rimuove la riga selezionata nella tabella
+func (m *FattureModel) eliminaRiga() {
+	i := m.righeTable.Cursor()
+	if i < 0 || i >= len(m.righe) {
+		return
+	}
+	m.righe = append(m.righe[:i], m.righe[i+1:]...)
+	m.updateRigheTable()
+	if i >= len(m.righe) && i > 0 {
+		m.righeTable.SetCursor(i - 1)
+	}
+}
+
+// fattura restituisce il documento descritto dal form, con i totali calcolati
+func (m *FattureModel) fattura() *database.Fattura {
+	data, _ := time.Parse("02/01/2006", strings.TrimSpace(m.inputs[fatCampoData].Value()))
+	f := &database.Fattura{
+		Tipo:          m.tipo,
+		Data:          data,
+		Sezionale:     database.NormalizzaSezionale(m.inputs[fatCampoSezionale].Value()),
+		ClienteID:     m.clienteID,
+		RiferimentoID: m.riferimentoID,
+		Commesse:      m.commesse,
+		Pagamento:     m.pagamento,
+		RegimeIVA:     m.regime,
+		Righe:         m.righe,
+		Importo:       m.importoFisso,
+	}
+	// Una ritenuta non valida è segnalata da validate
+	f.RitenutaTipo, f.RitenutaAliquota, f.RitenutaCausale, _ = parseRitenuta(m.inputs[fatCampoRitenuta].Value())
+	f.Calcola()
+	return f
 }
 
 // validate valida i dati del form
 func (m *FattureModel) validate() error {
-	dateStr := strings.TrimSpace(m.inputs[0].Value())
+	dateStr := strings.TrimSpace(m.inputs[fatCampoData].Value())
 	if dateStr == "" {
 		return fmt.Errorf("data obbligatoria")
 	}
@@ -173,20 +777,19 @@ func (m *FattureModel) validate() error {
 		return fmt.Errorf("formato data non valido (usa GG/MM/AAAA)")
 	}
 
-	if err := utils.ValidateNotEmpty(m.inputs[1].Value(), "Cliente"); err != nil {
-		return err
+	if m.clienteID == 0 {
+		return fmt.Errorf("seleziona un cliente")
 	}
 
-	importo, err := utils.ParseFloat(m.inputs[2].Value())
-	if err != nil {
-		return fmt.Errorf("importo non valido")
+	if len(m.righe) == 0 && m.importoFisso == 0 {
+		return fmt.Errorf("aggiungi almeno una riga")
 	}
 
-	if err := utils.ValidateImportoPositivo(importo); err != nil {
+	if _, _, _, err := parseRitenuta(m.inputs[fatCampoRitenuta].Value()); err != nil {
 		return err
 	}
 
-	return nil
+	return m.fattura().Validate()
 }
 
 // save salva la fattura corrente
@@ -195,39 +798,93 @@ func (m *FattureModel) save() error {
 		return err
 	}
 
-	data, _ := time.Parse("02/01/2006", strings.TrimSpace(m.inputs[0].Value()))
-	importo, _ := utils.ParseFloat(m.inputs[2].Value())
-
-	f := &database.Fattura{
-		Data:    data,
-		Importo: importo,
-	}
+	f := m.fattura()
 
 	if m.mode == FatModeAdd {
 		if err := m.db.CreateFattura(f); err != nil {
 			return fmt.Errorf("errore creazione: %w", err)
 		}
-		m.msg = "✓ Fattura creata con successo"
+		m.msg = "✓ " + database.DescrizioneTipoDocumento(f.Tipo) + " " + f.Numero + " creata con successo"
 	} else {
+		// Tipo, numero e sezionale restano quelli assegnati alla creazione
 		f.ID = m.selectedID
-		// Mantieni numero esistente
-		old, _ := m.db.GetFattura(m.selectedID)
-		if old != nil {
-			f.Numero = old.Numero
-			f.ClienteID = old.ClienteID
-		}
-
 		if err := m.db.UpdateFattura(f); err != nil {
 			return fmt.Errorf("errore aggiornamento: %w", err)
 		}
-		m.msg = "✓ Fattura aggiornata con successo"
+		m.msg = "✓ " + database.DescrizioneTipoDocumento(f.Tipo) + " aggiornata con successo"
 	}
 
 	m.mode = FatModeList
+	m.problemi = nil
 	m.Refresh()
 	return nil
 }
 
+// updateSelezioneCliente gestisce la scelta del cliente intestatario
+func (m FattureModel) updateSelezioneCliente(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if k, ok := msg.(tea.KeyMsg); ok {
+		switch k.String() {
+		case "esc":
+			m.selectionMode = false
+			m.updateFocus()
+			return m, nil
+		case "enter":
+			if row := m.clientTable.SelectedRow(); len(row) > 0 {
+				m.clienteID, _ = strconv.Atoi(row[0])
+				if c, err := m.db.GetCliente(m.clienteID); err == nil {
+					m.inputs[fatCampoCliente].SetValue(c.RagioneSociale)
+				}
+				m.selectionMode = false
+				m.focusIndex = fatCampoRighe
+				m.updateFocus()
+			}
+			return m, nil
+		}
+	}
+
+	var cmdF, cmdT tea.Cmd
+	m.clientFilter, cmdF = m.clientFilter.Update(msg)
+	m.updateClientTable()
+	m.clientTable, cmdT = m.clientTable.Update(msg)
+	return m, tea.Batch(cmdF, cmdT)
+}
+
+// updateRiga gestisce il form della riga aperta
+func (m FattureModel) updateRiga(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if k, ok := msg.(tea.KeyMsg); ok {
+		switch k.String() {
+		case "esc":
+			m.rigaAperta = false
+			m.err = nil
+			return m, nil
+		case "enter":
+			if m.rigaFocus < len(m.rigaInputs)-1 {
+				m.rigaFocus++
+				m.updateRigaFocus()
+				return m, nil
+			}
+			if err := m.confermaRiga(); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.err = nil
+			return m, nil
+		case "tab", "down":
+			m.rigaFocus = (m.rigaFocus + 1) % len(m.rigaInputs)
+			m.updateRigaFocus()
+			return m, nil
+		case "shift+tab", "up":
+			m.rigaFocus = (m.rigaFocus + len(m.rigaInputs) - 1) % len(m.rigaInputs)
+			m.updateRigaFocus()
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.rigaInputs[m.rigaFocus], cmd = m.rigaInputs[m.rigaFocus].Update(msg)
+	return m, cmd
+}
+
 // Init implementa tea.Model
 func (m FattureModel) Init() tea.Cmd {
 	return nil
@@ -263,10 +920,49 @@ func (m FattureModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	// Esportazione della lista
+	if msg, ok := msg.(EsportazioneMsg); ok {
+		m.msg, m.err = esitoEsportazione(msg)
+		return m, nil
+	}
+	if msg, ok := msg.(StampaEseguitaMsg); ok {
+		m.msg, m.err = esitoStampa(msg)
+		return m, nil
+	}
+	if msg, ok := msg.(FatturaPAGenerataMsg); ok {
+		var ec *fatturapa.ErroreControllo
+		if errors.As(msg.Err, &ec) {
+			m.apriProblemi(msg.FatturaID, ec.Problemi)
+		}
+		m.msg, m.err = esitoFatturaPA(msg)
+		return m, nil
+	}
+	if k, ok := msg.(tea.KeyMsg); ok && m.esporta.attiva {
+		return m, m.esporta.update(k, m.tabellaExport)
+	}
+
+	// Scelta del cliente e form della riga hanno il proprio ESC
+	if m.selectionMode {
+		return m.updateSelezioneCliente(msg)
+	}
+	if m.rigaAperta {
+		return m.updateRiga(msg)
+	}
+	if m.incassi != nil {
+		return m.updateIncassi(msg)
+	}
+	if m.scadenzario != nil {
+		if k, ok := msg.(tea.KeyMsg); ok && k.String() == "esc" {
+			m.scadenzario = nil
+		}
+		return m, nil
+	}
+
 	// Gestione ESC
 	if k, ok := msg.(tea.KeyMsg); ok && k.String() == "esc" {
 		if m.mode != FatModeList {
 			m.mode = FatModeList
+			m.problemi = nil
 			m.err = nil
 			m.msg = ""
 			return m, nil
@@ -280,10 +976,67 @@ func (m FattureModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyMsg:
 			switch msg.String() {
 			case "n":
+				if err := m.db.Autorizza(database.RisorsaFatture, database.PermessoCrea); err != nil {
+					m.err = err
+					return m, nil
+				}
 				m.mode = FatModeAdd
 				m.resetForm()
 				return m, nil
+			case "E":
+				if err := m.db.Autorizza(database.RisorsaFatture, database.PermessoEsporta); err != nil {
+					m.err = err
+					return m, nil
+				}
+				m.esporta.attiva = true
+				m.err = nil
+				m.msg = ""
+				return m, nil
+			case "F":
+				if err := m.db.Autorizza(database.RisorsaFatture, database.PermessoEsporta); err != nil {
+					m.err = err
+					return m, nil
+				}
+				if row := m.table.SelectedRow(); len(row) > 0 {
+					id, _ := strconv.Atoi(row[0])
+					m.err = nil
+					m.msg = ""
+					return m, func() tea.Msg { return GeneraFatturaPAMsg{FatturaID: id} }
+				}
+				return m, nil
+			case "P":
+				if err := m.db.Autorizza(database.RisorsaFatture, database.PermessoEsporta); err != nil {
+					m.err = err
+					return m, nil
+				}
+				if row := m.table.SelectedRow(); len(row) > 0 {
+					id, _ := strconv.Atoi(row[0])
+					m.err = nil
+					m.msg = ""
+					return m, func() tea.Msg { return StampaMsg{Modello: stampa.ModelloFattura, ID: id} }
+				}
+				return m, nil
+			case "c":
+				if row := m.table.SelectedRow(); len(row) > 0 {
+					id, _ := strconv.Atoi(row[0])
+					m.err = nil
+					m.apriNotaCredito(id)
+				}
+				return m, nil
+			case "i":
+				if row := m.table.SelectedRow(); len(row) > 0 {
+					id, _ := strconv.Atoi(row[0])
+					m.apriIncassi(id)
+				}
+				return m, nil
+			case "s":
+				m.apriScadenzario()
+				return m, nil
 			case "e", "enter":
+				if err := m.db.Autorizza(database.RisorsaFatture, database.PermessoModifica); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.loadIntoForm(id)
@@ -291,6 +1044,10 @@ func (m FattureModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			case "x", "d":
+				if err := m.db.Autorizza(database.RisorsaFatture, database.PermessoElimina); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.deletingID = id
@@ -306,47 +1063,91 @@ func (m FattureModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Modalità Form (Add/Edit)
 	if m.mode == FatModeAdd || m.mode == FatModeEdit {
 		if k, ok := msg.(tea.KeyMsg); ok {
-			switch k.String() {
-			case "enter":
-				// Se siamo sull'ultimo campo, salva
-				if m.focusIndex == len(m.inputs)-1 {
-					if err := m.save(); err != nil {
-						m.err = err
-						return m, nil
-					}
-					return m, nil
+			if k.String() == "ctrl+s" {
+				if err := m.save(); err != nil {
+					m.err = err
 				}
+				return m, nil
+			}
 
-				// Altrimenti passa al prossimo campo
-				m.focusIndex++
-				if m.focusIndex >= len(m.inputs) {
-					m.focusIndex = 0
+			// Nota di credito sulla fattura aperta
+			if k.String() == "ctrl+n" && m.mode == FatModeEdit && database.Stornabile(m.tipo) {
+				m.apriNotaCredito(m.selectedID)
+				return m, nil
+			}
+
+			if m.focusIndex == fatCampoTipo && k.String() == " " {
+				if m.mode == FatModeAdd && m.tipo != database.TipoDocumentoNotaCredito {
+					m.ciclaTipo()
 				}
-				m.updateFocus()
 				return m, nil
-			case "tab", "down":
-				m.focusIndex++
-				if m.focusIndex >= len(m.inputs) {
-					m.focusIndex = 0
+			}
+
+			if m.focusIndex == fatCampoPagamento && k.String() == " " {
+				if m.tipo != database.TipoDocumentoNotaCredito {
+					m.ciclaPagamento()
+				}
+				return m, nil
+			}
+
+			// La nota di credito ha il regime IVA della fattura stornata
+			if m.focusIndex == fatCampoRegime && k.String() == " " {
+				if m.tipo != database.TipoDocumentoNotaCredito {
+					m.ciclaRegime()
+				}
+				return m, nil
+			}
+
+			// La nota di credito resta intestata al cliente della fattura
+			if m.focusIndex == fatCampoCliente && m.tipo != database.TipoDocumentoNotaCredito && (k.String() == "enter" || k.String() == " ") {
+				m.selectionMode = true
+				m.clientFilter.SetValue("")
+				m.updateClientTable()
+				m.clientFilter.Focus()
+				return m, nil
+			}
+
+			if m.focusIndex == fatCampoRighe {
+				switch k.String() {
+				case "a", "+", "n":
+					m.apriRiga(-1)
+					return m, nil
+				case "enter", "e":
+					if len(m.righe) == 0 {
+						m.apriRiga(-1)
+					} else {
+						m.apriRiga(m.righeTable.Cursor())
+					}
+					return m, nil
+				case "x", "d", "delete":
+					m.eliminaRiga()
+					return m, nil
+				case "up", "down", "pgup", "pgdown", "home", "end":
+					m.righeTable, cmd = m.righeTable.Update(msg)
+					return m, cmd
 				}
+			}
+
+			switch k.String() {
+			case "enter", "tab", "down":
+				m.focusIndex = (m.focusIndex + 1) % fatNumCampi
 				m.updateFocus()
 				return m, nil
 			case "shift+tab", "up":
-				m.focusIndex--
-				if m.focusIndex < 0 {
-					m.focusIndex = len(m.inputs) - 1
-				}
+				m.focusIndex = (m.focusIndex + fatNumCampi - 1) % fatNumCampi
 				m.updateFocus()
 				return m, nil
 			}
 		}
 
-		// Update inputs
-		cmds := make([]tea.Cmd, len(m.inputs))
-		for i := range m.inputs {
-			m.inputs[i], cmds[i] = m.inputs[i].Update(msg)
+		// Il cliente si sceglie dalla lista, non si digita; il sezionale
+		// si sceglie solo prima che la fattura riceva il numero, la
+		// ritenuta della nota di credito è quella della fattura stornata
+		if m.focusIndex == fatCampoData || (m.focusIndex == fatCampoSezionale && m.mode == FatModeAdd) ||
+			(m.focusIndex == fatCampoRitenuta && m.tipo != database.TipoDocumentoNotaCredito) {
+			m.inputs[m.focusIndex], cmd = m.inputs[m.focusIndex].Update(msg)
 		}
-		return m, tea.Batch(cmds...)
+		return m, cmd
 	}
 
 	return m, nil
@@ -361,10 +1162,14 @@ func (m FattureModel) View() string {
 
 	// Titolo dinamico
 	title := "GESTIONE FATTURE"
+	documento := strings.ToUpper(database.DescrizioneTipoDocumento(m.tipo))
 	if m.mode == FatModeAdd {
-		title = "NUOVA FATTURA"
+		title = "NUOVA " + documento
 	} else if m.mode == FatModeEdit {
-		title = fmt.Sprintf("MODIFICA FATTURA #%d", m.selectedID)
+		title = fmt.Sprintf("MODIFICA %s #%d", documento, m.selectedID)
+		if m.numero != "" {
+			title = "MODIFICA " + documento + " " + m.numero
+		}
 	}
 
 	header := RenderHeader(title, width)
@@ -385,22 +1190,34 @@ func (m FattureModel) View() string {
 			Render(message.String())
 
 		return CenterContent(m.width, m.height, box)
+	} else if m.selectionMode {
+		return m.viewSelezioneCliente(width)
+	} else if m.incassi != nil {
+		header = RenderHeader("INCASSI "+strings.ToUpper(database.DescrizioneTipoDocumento(m.incassi.fattura.Tipo))+" "+m.incassi.fattura.Numero, width)
+		body = m.viewIncassi()
+	} else if m.scadenzario != nil {
+		header = RenderHeader("SCADENZARIO CREDITI", width)
+		body = m.viewScadenzario()
 	} else if m.mode == FatModeList {
 		// Vista lista
 		helpText := lipgloss.NewStyle().
 			MarginBottom(1).
 			Foreground(ColorSubText).
-			Render("[N] Nuova • [E/↵] Modifica • [X/D] Elimina • [ESC] Menu")
+			Render("[N] Nuova • [E/↵] Modifica • [C] Nota di credito • [I] Incassi • [S] Scadenzario • [X/D] Elimina • [⇧F] FatturaPA • [⇧P] PDF • [⇧E] Esporta • [ESC] Menu")
 
 		body = lipgloss.JoinVertical(
 			lipgloss.Left,
+			renderEmittente(m.profilo),
 			helpText,
 			m.table.View(),
 		)
+		if m.esporta.attiva {
+			body = lipgloss.JoinVertical(lipgloss.Left, body, "", m.esporta.View())
+		}
 	} else {
 		// Vista form
 		var form strings.Builder
-		labels := []string{"Data", "Cliente", "Importo €"}
+		labels := []string{"Documento", "Data", "Sezionale", "Cliente", "Pagamento", "Regime IVA", "Ritenuta"}
 
 		for i, inp := range m.inputs {
 			labelStyle := LabelStyle
@@ -408,13 +1225,64 @@ func (m FattureModel) View() string {
 				labelStyle = LabelFocusedStyle
 			}
 
-			form.WriteString(fmt.Sprintf("%s %s\n",
+			nota := m.segnaProblemi(i)
+			switch {
+			case i == fatCampoTipo && m.riferimento != "":
+				rif := " storna la fattura " + m.riferimento
+				if m.residuo > 0 {
+					rif += " • da stornare " + utils.FormatEuro(m.residuo)
+				}
+				nota += HelpStyle.Render(rif)
+			case i == fatCampoTipo && m.commesseInfo != "":
+				nota += HelpStyle.Render(" commesse " + m.commesseInfo)
+				if m.mode == FatModeAdd {
+					nota += HelpStyle.Render(" • [Spazio] per cambiare")
+				}
+			case i == fatCampoTipo && m.mode == FatModeAdd:
+				nota += HelpStyle.Render(" [Spazio] per cambiare")
+			case i == fatCampoSezionale && m.mode == FatModeAdd:
+				nota = HelpStyle.Render(" numero assegnato al salvataggio")
+			case i == fatCampoPagamento && m.tipo == database.TipoDocumentoNotaCredito:
+				nota += HelpStyle.Render(" riduce il credito della fattura stornata")
+			case i == fatCampoPagamento:
+				nota += HelpStyle.Render(" [Spazio] per cambiare")
+			case (i == fatCampoRegime || i == fatCampoRitenuta) && m.tipo == database.TipoDocumentoNotaCredito:
+				nota += HelpStyle.Render(" come la fattura stornata")
+			case i == fatCampoRegime:
+				nota += HelpStyle.Render(" [Spazio] per cambiare")
+			case i == fatCampoRitenuta:
+				nota += HelpStyle.Render(" aliquota % [RT01/RT02] [causale]")
+			}
+			form.WriteString(fmt.Sprintf("%s %s%s\n",
 				labelStyle.Render(labels[i]+":"),
-				inp.View()))
+				inp.View(),
+				nota))
+		}
+
+		labelStyle := LabelStyle
+		if m.focusIndex == fatCampoRighe {
+			labelStyle = LabelFocusedStyle
 		}
+		form.WriteString("\n" + labelStyle.Render("Righe:") + m.segnaProblemi(fatCampoRighe) + "\n")
+		if len(m.righe) == 0 {
+			form.WriteString(HelpStyle.Render("  Nessuna riga: [A] per aggiungerne una") + "\n")
+		} else {
+			form.WriteString(m.righeTable.View() + "\n")
+		}
+		form.WriteString(renderRiepilogoFattura(m.fattura()) + "\n")
 
 		form.WriteString("\n")
-		form.WriteString(HelpStyle.Render("[Tab/↑↓] Naviga • [↵] Conferma/Prossimo • [Esc] Annulla"))
+		if m.rigaAperta {
+			form.WriteString(m.viewRiga())
+		} else if m.focusIndex == fatCampoRighe {
+			form.WriteString(HelpStyle.Render("[A] Aggiungi • [↵/E] Modifica • [X/D] Elimina riga • [↑↓] Scorri • [Tab] Campo successivo • [Ctrl+S] Salva • [Esc] Annulla"))
+		} else {
+			help := "[Tab/↑↓] Naviga • [↵] Prossimo/Scegli cliente • [Ctrl+S] Salva • [Esc] Annulla"
+			if m.mode == FatModeEdit && database.Stornabile(m.tipo) {
+				help = "[Tab/↑↓] Naviga • [↵] Prossimo/Scegli cliente • [Ctrl+S] Salva • [Ctrl+N] Nota di credito • [Esc] Annulla"
+			}
+			form.WriteString(HelpStyle.Render(help))
+		}
 		body = form.String()
 	}
 
@@ -446,3 +1314,89 @@ func (m FattureModel) View() string {
 
 	return "\n" + box
 }
+
+// viewRiga mostra il form della riga aperta
+func (m FattureModel) viewRiga() string {
+	var b strings.Builder
+
+	titolo := "NUOVA RIGA"
+	if m.rigaIndex >= 0 {
+		titolo = fmt.Sprintf("RIGA %d", m.rigaIndex+1)
+	}
+	b.WriteString(LabelFocusedStyle.Render(titolo) + "\n")
+
+	labels := []string{"Descrizione", "Quantità", "Prezzo €", "Sconto %", "IVA"}
+	for i, inp := range m.rigaInputs {
+		labelStyle := LabelStyle
+		if i == m.rigaFocus {
+			labelStyle = LabelFocusedStyle
+		}
+		b.WriteString(fmt.Sprintf("%s %s\n", labelStyle.Render(labels[i]+":"), inp.View()))
+	}
+
+	if _, natura, err := database.ParseCodiceIVA(m.rigaInputs[rigaIVA].Value()); err == nil && natura != "" {
+		b.WriteString(HelpStyle.Render("  "+natura+" "+database.DescrizioneNaturaIVA(natura)) + "\n")
+	}
+
+	b.WriteString(HelpStyle.Render("[Tab/↑↓] Naviga • [↵] Prossimo/Conferma riga • [Esc] Annulla riga"))
+	return b.String()
+}
+
+// viewSelezioneCliente mostra la lista clienti da cui scegliere l'intestatario
+func (m FattureModel) viewSelezioneCliente(width int) string {
+	title := RenderHeader("SELEZIONA CLIENTE", width)
+	filterView := lipgloss.NewStyle().
+		MarginBottom(1).
+		Render(m.clientFilter.View())
+
+	body := lipgloss.JoinVertical(
+		lipgloss.Left,
+		filterView,
+		m.clientTable.View(),
+	)
+
+	helpText := HelpStyle.Render("\n[↑↓] Naviga • [↵] Seleziona • [Esc] Annulla")
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Left,
+		title,
+		"",
+		lipgloss.NewStyle().Padding(0, 2).Render(body),
+		helpText,
+	)
+
+	box := MainBoxStyle.Copy().Width(width - 4).Render(content)
+	return CenterContent(m.width, m.height, box)
+}
+
+// renderRiepilogoFattura mostra imponibile e imposta per aliquota e natura e
+// i totali del documento
+func renderRiepilogoFattura(f *database.Fattura) string {
+	if len(f.Righe) == 0 {
+		if f.Importo > 0 {
+			return HelpStyle.Render(fmt.Sprintf("  Fattura registrata senza righe, totale %s: aggiungi le righe per il dettaglio IVA",
+				utils.FormatEuro(f.Importo)))
+		}
+		return ""
+	}
+
+	var b strings.Builder
+	for _, r := range f.Riepilogo {
+		voce := "IVA " + formatAliquota(r.AliquotaIVA) + "%"
+		if r.Natura != "" {
+			voce = r.Natura + " " + utils.Truncate(database.DescrizioneNaturaIVA(r.Natura), 30)
+		}
+		b.WriteString(HelpStyle.Render(fmt.Sprintf("  %-36s imponibile %12s  imposta %10s",
+			voce, utils.FormatEuro(r.Imponibile), utils.FormatEuro(r.Imposta))) + "\n")
+	}
+	totali := fmt.Sprintf("  Imponibile %s • IVA %s • Totale %s",
+		utils.FormatEuro(f.Imponibile), utils.FormatEuro(f.Imposta), utils.FormatEuro(f.Importo))
+	if f.Ritenuta > 0 {
+		totali += " • Ritenuta " + utils.FormatEuro(f.Ritenuta)
+	}
+	if netto := f.NettoAPagare(); netto != f.Importo {
+		totali += " • Netto a pagare " + utils.FormatEuro(netto)
+	}
+	b.WriteString(lipgloss.NewStyle().Bold(true).Render(totali))
+	return b.String()
+}
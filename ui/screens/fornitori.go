@@ -323,10 +323,18 @@ func (m FornitoriModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyMsg:
 			switch msg.String() {
 			case "n":
+				if err := m.db.Autorizza(database.RisorsaFornitori, database.PermessoCrea); err != nil {
+					m.err = err
+					return m, nil
+				}
 				m.mode = FornAdd
 				m.resetForm()
 				return m, nil
 			case "e", "enter":
+				if err := m.db.Autorizza(database.RisorsaFornitori, database.PermessoModifica); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.loadIntoForm(id)
@@ -334,6 +342,10 @@ func (m FornitoriModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			case "x", "d":
+				if err := m.db.Autorizza(database.RisorsaFornitori, database.PermessoElimina); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.deletingID = id
@@ -0,0 +1,383 @@
+package screens
+
+import (
+	"fmt"
+	"officina/config"
+	"officina/database"
+	"officina/logger"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// campoImpostazione descrive un campo modificabile della schermata
+type campoImpostazione struct {
+	key      string // chiave di configurazione (es. "backup.max_files")
+	label    string
+	sezione  string // titolo di sezione mostrato prima del campo
+	booleano bool
+	riavvio  bool // la modifica ha effetto solo al prossimo avvio
+	limite   int
+}
+
+var campiImpostazioni = []campoImpostazione{
+	{key: "database.uri", label: "URI MongoDB", sezione: "Database", riavvio: true},
+	{key: "database.name", label: "Nome database", riavvio: true},
+	{key: "database.timeout", label: "Timeout", riavvio: true},
+
+	{key: "app.backup_path", label: "Cartella backup", sezione: "Backup"},
+	{key: "backup.enabled", label: "Backup automatico", booleano: true},
+	{key: "backup.interval", label: "Intervallo", limite: 10},
+	{key: "backup.max_files", label: "Copie conservate", limite: 4},
+
+	{key: "api.enabled", label: "API REST attiva", sezione: "API REST", booleano: true, riavvio: true},
+	{key: "api.listen", label: "Indirizzo", limite: 40, riavvio: true},
+
+	{key: "ssh.listen", label: "Indirizzo SSH", sezione: "Server SSH", limite: 40, riavvio: true},
+	{key: "ssh.authorized_keys", label: "Chiavi operatori", riavvio: true},
+
+	{key: "app.export_path", label: "Cartella export", sezione: "Applicazione"},
+	{key: "app.templates_path", label: "Cartella modelli PDF"},
+	{key: "app.session_timeout", label: "Blocco inattività", limite: 10},
+	{key: "app.debug", label: "Modalità debug", booleano: true},
+}
+
+// ImpostazioniSalvateMsg notifica il salvataggio della configurazione;
+// AppModel lo usa per riapplicare le impostazioni dei backup
+type ImpostazioniSalvateMsg struct {
+	Riavvio bool
+}
+
+// impostazioniTestMsg riporta l'esito della prova di connessione al database
+type impostazioniTestMsg struct {
+	cfg *config.Config
+	err error
+}
+
+// ImpostazioniModel gestisce la schermata Impostazioni
+type ImpostazioniModel struct {
+	cfg        *config.Config // configurazione effettiva, condivisa con AppModel
+	path       string         // file su cui vengono salvate le modifiche
+	inputs     []textinput.Model
+	focusIndex int
+	err        error
+	msg        string
+	width      int
+	height     int
+	testing    bool
+}
+
+// NewImpostazioniModel crea una nuova istanza della schermata impostazioni
+func NewImpostazioniModel(cfg *config.Config) ImpostazioniModel {
+	path := cfg.File()
+	if path == "" {
+		path = config.DefaultPath()
+	}
+
+	inputs := make([]textinput.Model, len(campiImpostazioni))
+	for i, c := range campiImpostazioni {
+		inputs[i] = textinput.New()
+		inputs[i].Width = 45
+		if c.limite > 0 {
+			inputs[i].CharLimit = c.limite
+			inputs[i].Width = c.limite + 2
+		}
+		if c.booleano {
+			inputs[i].Placeholder = "[Spazio] per cambiare"
+		}
+	}
+
+	m := ImpostazioniModel{
+		cfg:    cfg,
+		path:   path,
+		inputs: inputs,
+	}
+
+	m.Reload()
+	return m
+}
+
+// Reload carica nel form la configurazione salvata su file
+func (m *ImpostazioniModel) Reload() {
+	saved, err := config.LoadFileConfig(m.path)
+	if err != nil {
+		m.err = fmt.Errorf("errore lettura configurazione: %w", err)
+		saved = config.DefaultConfig()
+	}
+
+	for i, c := range campiImpostazioni {
+		v, _ := saved.Get(c.key)
+		if c.booleano {
+			v = formatSiNo(v == "true")
+		}
+		m.inputs[i].SetValue(v)
+	}
+
+	m.focusIndex = 0
+	m.updateFocus()
+}
+
+// updateFocus aggiorna il focus tra i campi
+func (m *ImpostazioniModel) updateFocus() {
+	for i := range m.inputs {
+		if i == m.focusIndex {
+			m.inputs[i].Focus()
+		} else {
+			m.inputs[i].Blur()
+		}
+	}
+}
+
+// buildConfig applica i valori del form alla configurazione salvata e la valida
+func (m *ImpostazioniModel) buildConfig() (*config.Config, error) {
+	saved, err := config.LoadFileConfig(m.path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range campiImpostazioni {
+		v := strings.TrimSpace(m.inputs[i].Value())
+		if c.booleano {
+			v = fmt.Sprintf("%t", v == formatSiNo(true))
+		}
+		if err := saved.Set(c.key, v); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.label, err)
+		}
+	}
+
+	if err := saved.Validate(); err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// connessioneCambiata indica se i parametri del database differiscono da
+// quelli della connessione in uso
+func (m *ImpostazioniModel) connessioneCambiata(nuova *config.Config) bool {
+	return nuova.Database.URI != m.cfg.Database.URI ||
+		nuova.Database.Name != m.cfg.Database.Name ||
+		nuova.Database.Timeout != m.cfg.Database.Timeout
+}
+
+// testConnessioneCmd prova la nuova connessione in background
+func testConnessioneCmd(nuova *config.Config) tea.Cmd {
+	return func() tea.Msg {
+		err := database.TestConnection(nuova.Database.URI, nuova.Database.Name, nuova.Database.Timeout)
+		return impostazioniTestMsg{cfg: nuova, err: err}
+	}
+}
+
+// persist salva la configurazione e applica subito le modifiche che non
+// richiedono un riavvio
+func (m *ImpostazioniModel) persist(nuova *config.Config) tea.Cmd {
+	if err := nuova.Save(m.path); err != nil {
+		m.err = err
+		return nil
+	}
+
+	riavvio := false
+	for _, c := range campiImpostazioni {
+		nuovo, _ := nuova.Get(c.key)
+		attuale, _ := m.cfg.Get(c.key)
+		if nuovo == attuale {
+			continue
+		}
+
+		// Un valore imposto da variabile d'ambiente o opzione resta in vigore
+		if src := m.cfg.Source(c.key); src == config.SourceEnv || src == config.SourceFlag {
+			continue
+		}
+
+		if c.riavvio {
+			riavvio = true
+			continue
+		}
+		m.cfg.Set(c.key, nuovo)
+	}
+
+	logger.SetDebug(m.cfg.App.DebugMode)
+	logger.Info("Configurazione salvata in %s", m.path)
+
+	m.err = nil
+	m.msg = "✓ Impostazioni salvate e applicate"
+	if riavvio {
+		m.msg = "✓ Impostazioni salvate: alcune modifiche valgono dal prossimo avvio"
+	}
+
+	return func() tea.Msg { return ImpostazioniSalvateMsg{Riavvio: riavvio} }
+}
+
+// save valida il form e, se la connessione al database è cambiata, la prova
+// prima di salvare
+func (m *ImpostazioniModel) save() tea.Cmd {
+	nuova, err := m.buildConfig()
+	if err != nil {
+		m.err = err
+		m.msg = ""
+		return nil
+	}
+
+	if m.connessioneCambiata(nuova) {
+		m.testing = true
+		m.err = nil
+		m.msg = "Verifica connessione al database..."
+		return testConnessioneCmd(nuova)
+	}
+
+	return m.persist(nuova)
+}
+
+// Init implementa tea.Model
+func (m ImpostazioniModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update implementa tea.Model
+func (m ImpostazioniModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case impostazioniTestMsg:
+		m.testing = false
+		if msg.err != nil {
+			m.msg = ""
+			m.err = fmt.Errorf("connessione non riuscita, impostazioni non salvate: %w", msg.err)
+			return m, nil
+		}
+		return m, m.persist(msg.cfg)
+	}
+
+	if m.testing {
+		return m, nil
+	}
+
+	if k, ok := msg.(tea.KeyMsg); ok {
+		switch k.String() {
+		case "esc":
+			m.err = nil
+			m.msg = ""
+			m.Reload()
+			return m, func() tea.Msg { return ChangeScreenMsg(StateMenu) }
+		case "ctrl+s":
+			return m, m.save()
+		case "enter":
+			if m.focusIndex == len(m.inputs)-1 {
+				return m, m.save()
+			}
+			m.focusIndex++
+			m.updateFocus()
+			return m, nil
+		case "tab", "down":
+			m.focusIndex++
+			if m.focusIndex >= len(m.inputs) {
+				m.focusIndex = 0
+			}
+			m.updateFocus()
+			return m, nil
+		case "shift+tab", "up":
+			m.focusIndex--
+			if m.focusIndex < 0 {
+				m.focusIndex = len(m.inputs) - 1
+			}
+			m.updateFocus()
+			return m, nil
+		}
+
+		if campiImpostazioni[m.focusIndex].booleano {
+			if k.String() == " " {
+				attivo := m.inputs[m.focusIndex].Value() == formatSiNo(true)
+				m.inputs[m.focusIndex].SetValue(formatSiNo(!attivo))
+			}
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.inputs[m.focusIndex], cmd = m.inputs[m.focusIndex].Update(msg)
+	return m, cmd
+}
+
+// View implementa tea.Model
+func (m ImpostazioniModel) View() string {
+	width := 85
+	if m.width > 0 {
+		width = min(m.width, 100)
+	}
+
+	header := RenderHeader("IMPOSTAZIONI", width)
+
+	var form strings.Builder
+	form.WriteString(HelpStyle.Render("📄 "+m.path) + "\n")
+
+	for i, c := range campiImpostazioni {
+		if c.sezione != "" {
+			form.WriteString("\n" + lipgloss.NewStyle().Bold(true).Foreground(ColorPrimary).Render(c.sezione) + "\n")
+		}
+
+		labelStyle := LabelStyle
+		if i == m.focusIndex {
+			labelStyle = LabelFocusedStyle
+		}
+
+		note := ""
+		if src := m.cfg.Source(c.key); src == config.SourceEnv {
+			note = WarningStyle.Render(" ⚠ sovrascritto da " + config.EnvName(c.key))
+		} else if src == config.SourceFlag {
+			note = WarningStyle.Render(" ⚠ sovrascritto da --" + config.FlagName(c.key))
+		} else if c.riavvio {
+			note = HelpStyle.Render(" ↻ riavvio")
+		}
+
+		form.WriteString(fmt.Sprintf("%s %s%s\n",
+			labelStyle.Render(c.label+":"),
+			m.inputs[i].View(),
+			note))
+	}
+
+	form.WriteString("\n")
+	form.WriteString(HelpStyle.Render("[Tab/↑↓] Naviga • [Spazio] Sì/No • [Ctrl+S] Salva • [Esc] Annulla"))
+
+	footer := RenderFooter(width, m.cfg.App.Version)
+	if m.err != nil {
+		footer = "\n" + ErrorStyle.Render("✗ "+m.err.Error()) + "\n" + footer
+	}
+
+	if m.msg != "" {
+		style := SuccessStyle
+		if m.testing {
+			style = WarningStyle
+		}
+		footer = "\n" + style.Render(m.msg) + "\n" + footer
+	}
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		"",
+		lipgloss.NewStyle().Padding(0, 2).Render(form.String()),
+		"",
+		footer,
+	)
+
+	box := MainBoxStyle.Copy().Width(width - 4).Render(content)
+
+	if m.width > 0 && m.height > 0 {
+		return CenterContent(m.width, m.height, box)
+	}
+
+	return "\n" + box
+}
+
+// formatSiNo rappresenta un valore booleano nel form
+func formatSiNo(v bool) string {
+	if v {
+		return "Sì"
+	}
+	return "No"
+}
@@ -0,0 +1,341 @@
+package screens
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"officina/database"
+	"officina/utils"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// pannelloIncassi mostra scadenze e incassi della fattura selezionata nella
+// lista: le entrate assegnate alla fattura e quelle libere, che si assegnano
+// o liberano con [Spazio], e il form del nuovo incasso
+type pannelloIncassi struct {
+	fattura    *database.Fattura
+	situazione *database.Incassi
+	entrate    []database.MovimentoPrimaNota
+	tabella    table.Model
+
+	nuovo   bool
+	importo textinput.Model
+	metodo  int
+}
+
+// apriIncassi apre il pannello degli incassi della fattura id
+func (m *FattureModel) apriIncassi(id int) {
+	if err := m.db.Autorizza(database.RisorsaMovimenti, database.PermessoModifica); err != nil {
+		m.err = err
+		return
+	}
+	f, err := m.db.GetFattura(id)
+	if err != nil {
+		m.err = fmt.Errorf("errore caricamento fattura: %w", err)
+		return
+	}
+	if !database.Stornabile(f.Tipo) {
+		m.err = fmt.Errorf("%s %s: si incassano solo le fatture", database.DescrizioneTipoDocumento(f.Tipo), f.Numero)
+		return
+	}
+
+	t := table.New(
+		table.WithColumns([]table.Column{
+			{Title: "", Width: 2},
+			{Title: "Data", Width: 10},
+			{Title: "Descrizione", Width: 34},
+			{Title: "Metodo", Width: 9},
+			{Title: "Importo", Width: 12},
+		}),
+		table.WithHeight(7),
+		table.WithFocused(true),
+	)
+	t.SetStyles(GetTableStyles())
+
+	imp := textinput.New()
+	imp.Placeholder = "Importo incassato"
+	imp.Width = 20
+
+	m.incassi = &pannelloIncassi{fattura: f, tabella: t, importo: imp}
+	m.err = nil
+	m.msg = ""
+	m.aggiornaIncassi()
+}
+
+// aggiornaIncassi ricalcola la situazione della fattura e l'elenco delle
+// entrate: prima quelle assegnate, poi le libere dalla più recente
+func (m *FattureModel) aggiornaIncassi() {
+	p := m.incassi
+	s, err := m.db.SituazioneIncassi(p.fattura.ID, time.Now())
+	if err != nil {
+		m.err = err
+		return
+	}
+	p.situazione = s
+
+	movimenti, _ := m.db.ListMovimentiPrimaNota(nil)
+	var assegnate, libere []database.MovimentoPrimaNota
+	for _, mov := range movimenti {
+		switch {
+		case mov.Tipo != database.TipoMovimentoEntrata:
+		case mov.FatturaID == p.fattura.ID:
+			assegnate = append(assegnate, mov)
+		case mov.FatturaID == 0:
+			libere = append(libere, mov)
+		}
+	}
+	for i, j := 0, len(libere)-1; i < j; i, j = i+1, j-1 {
+		libere[i], libere[j] = libere[j], libere[i]
+	}
+	p.entrate = append(assegnate, libere...)
+
+	rows := []table.Row{}
+	for _, mov := range p.entrate {
+		segno := ""
+		if mov.FatturaID == p.fattura.ID {
+			segno = "✓"
+		}
+		rows = append(rows, table.Row{
+			segno,
+			utils.FormatDate(mov.Data),
+			utils.Truncate(mov.Descrizione, 34),
+			mov.Metodo,
+			utils.FormatEuro(mov.Importo),
+		})
+	}
+	p.tabella.SetRows(rows)
+}
+
+// metodoIncasso propone il bonifico se l'officina ha un IBAN, altrimenti la cassa
+func (m *FattureModel) metodoIncasso() int {
+	metodo := database.MetodoPagamentoCassa
+	if m.profilo != nil && m.profilo.IBAN != "" {
+		metodo = database.MetodoPagamentoBonifico
+	}
+	for i, v := range MetodiPagamento {
+		if v == metodo {
+			return i
+		}
+	}
+	return 0
+}
+
+// registraIncasso crea l'entrata del nuovo incasso assegnata alla fattura
+func (m *FattureModel) registraIncasso() error {
+	p := m.incassi
+	importo, err := utils.ParseFloat(p.importo.Value())
+	if err != nil || importo <= 0 {
+		return fmt.Errorf("importo non valido")
+	}
+
+	f := p.fattura
+	mov := &database.MovimentoPrimaNota{
+		Data:          time.Now(),
+		Tipo:          database.TipoMovimentoEntrata,
+		Importo:       importo,
+		Metodo:        MetodiPagamento[p.metodo],
+		Descrizione:   "Incasso fattura " + f.Numero,
+		NumeroFattura: f.Numero,
+		DataFattura:   f.Data,
+		FatturaID:     f.ID,
+	}
+	if len(f.Commesse) == 1 {
+		mov.CommessaID = f.Commesse[0]
+	}
+	if err := m.db.CreateMovimentoPrimaNota(mov); err != nil {
+		return fmt.Errorf("errore registrazione incasso: %w", err)
+	}
+	m.msg = "✓ Incasso di " + utils.FormatEuro(importo) + " registrato"
+	return nil
+}
+
+// updateIncassi gestisce i tasti del pannello incassi
+func (m FattureModel) updateIncassi(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	p := m.incassi
+	k, ok := msg.(tea.KeyMsg)
+
+	if p.nuovo {
+		if ok {
+			switch k.String() {
+			case "esc":
+				p.nuovo = false
+				p.importo.Blur()
+				return m, nil
+			case "tab":
+				p.metodo = (p.metodo + 1) % len(MetodiPagamento)
+				return m, nil
+			case "enter":
+				if err := m.registraIncasso(); err != nil {
+					m.err = err
+					return m, nil
+				}
+				m.err = nil
+				p.nuovo = false
+				p.importo.Blur()
+				m.aggiornaIncassi()
+				m.Refresh()
+				return m, nil
+			}
+		}
+		p.importo, cmd = p.importo.Update(msg)
+		return m, cmd
+	}
+
+	if ok {
+		switch k.String() {
+		case "esc":
+			m.incassi = nil
+			m.Refresh()
+			return m, nil
+		case "n":
+			if p.situazione == nil || p.situazione.Residuo <= 0 {
+				m.err = fmt.Errorf("la fattura non ha importi da incassare")
+				return m, nil
+			}
+			p.nuovo = true
+			p.metodo = m.metodoIncasso()
+			p.importo.SetValue(fmt.Sprintf("%.2f", p.situazione.Residuo))
+			p.importo.Focus()
+			m.err = nil
+			m.msg = ""
+			return m, nil
+		case " ", "enter":
+			i := p.tabella.Cursor()
+			if i < 0 || i >= len(p.entrate) {
+				return m, nil
+			}
+			mov := p.entrate[i]
+			fatturaID := p.fattura.ID
+			m.msg = "✓ Entrata assegnata alla fattura " + p.fattura.Numero
+			if mov.FatturaID == fatturaID {
+				fatturaID = 0
+				m.msg = "✓ Entrata liberata dalla fattura " + p.fattura.Numero
+			}
+			if err := m.db.AssegnaIncasso(mov.ID, fatturaID); err != nil {
+				m.err = err
+				m.msg = ""
+				return m, nil
+			}
+			m.err = nil
+			m.aggiornaIncassi()
+			return m, nil
+		}
+	}
+	p.tabella, cmd = p.tabella.Update(msg)
+	return m, cmd
+}
+
+// viewIncassi mostra scadenze, situazione ed entrate della fattura
+func (m FattureModel) viewIncassi() string {
+	p := m.incassi
+	var b strings.Builder
+
+	if s := p.situazione; s != nil {
+		b.WriteString(LabelFocusedStyle.Render("Scadenze") + " " +
+			HelpStyle.Render(database.DescrizioneCondizionePagamento(p.fattura.Pagamento)) + "\n")
+		for _, r := range s.Scadenze {
+			riga := fmt.Sprintf("  %s  %12s", utils.FormatDate(r.Data), utils.FormatEuro(r.Importo))
+			if r.Residuo > 0 {
+				riga += "  da incassare " + utils.FormatEuro(r.Residuo)
+			} else {
+				riga += "  incassata"
+			}
+			b.WriteString(riga + "\n")
+		}
+		stato := s.Stato
+		if s.Ritardo > 0 {
+			stato += fmt.Sprintf(" da %d gg", s.Ritardo)
+		}
+		var voci []string
+		if s.Stornato > 0 {
+			voci = append(voci, "Stornato "+utils.FormatEuro(s.Stornato))
+		}
+		voci = append(voci,
+			"Totale "+utils.FormatEuro(s.Totale),
+			"Incassato "+utils.FormatEuro(s.Incassato),
+			"Residuo "+utils.FormatEuro(s.Residuo),
+			stato)
+		b.WriteString(lipgloss.NewStyle().Bold(true).Render("  "+strings.Join(voci, " • ")) + "\n\n")
+	}
+
+	b.WriteString(LabelFocusedStyle.Render("Entrate") + HelpStyle.Render(" ✓ = assegnata alla fattura") + "\n")
+	if len(p.entrate) == 0 {
+		b.WriteString(HelpStyle.Render("  Nessuna entrata da assegnare: [N] per registrare l'incasso") + "\n")
+	} else {
+		b.WriteString(p.tabella.View() + "\n")
+	}
+
+	b.WriteString("\n")
+	if p.nuovo {
+		b.WriteString(LabelFocusedStyle.Render("NUOVO INCASSO") + "\n")
+		b.WriteString(fmt.Sprintf("%s %s\n", LabelFocusedStyle.Render("Importo €:"), p.importo.View()))
+		b.WriteString(fmt.Sprintf("%s %s\n", LabelStyle.Render("Metodo:"), MetodiPagamento[p.metodo]))
+		b.WriteString(HelpStyle.Render("[Tab] Cambia metodo • [↵] Registra • [Esc] Annulla"))
+	} else {
+		b.WriteString(HelpStyle.Render("[N] Nuovo incasso • [Spazio/↵] Assegna/Libera entrata • [↑↓] Scorri • [Esc] Indietro"))
+	}
+	return b.String()
+}
+
+// apriScadenzario calcola lo scadenzario dei crediti a oggi
+func (m *FattureModel) apriScadenzario() {
+	if err := m.db.Autorizza(database.RisorsaFatture, database.PermessoVedi); err != nil {
+		m.err = err
+		return
+	}
+	r, err := m.db.ScadenzarioCrediti(time.Now())
+	if err != nil {
+		m.err = err
+		return
+	}
+	m.scadenzario = r
+	m.err = nil
+	m.msg = ""
+}
+
+// viewScadenzario mostra i crediti aperti per cliente e fascia di ritardo
+func (m FattureModel) viewScadenzario() string {
+	r := m.scadenzario
+	var b strings.Builder
+
+	b.WriteString(HelpStyle.Render("Crediti aperti al "+utils.FormatDate(r.Data)) + "\n\n")
+	if len(r.Clienti) == 0 {
+		b.WriteString(HelpStyle.Render("  Nessun credito da incassare") + "\n")
+	} else {
+		intestazione := fmt.Sprintf("%-22s", "Cliente")
+		for _, f := range r.Fasce {
+			intestazione += fmt.Sprintf(" %11s", f)
+		}
+		intestazione += fmt.Sprintf(" %12s", "Totale")
+		b.WriteString(LabelFocusedStyle.Render(intestazione) + "\n")
+
+		riga := func(nome string, fasce []float64, totale float64) string {
+			s := fmt.Sprintf("%-22s", utils.Truncate(nome, 22))
+			for _, v := range fasce {
+				s += fmt.Sprintf(" %11s", importoFascia(v))
+			}
+			return s + fmt.Sprintf(" %12s", utils.FormatEuro(totale))
+		}
+		for _, c := range r.Clienti {
+			b.WriteString(riga(c.Cliente, c.Fasce, c.Totale) + "\n")
+		}
+		b.WriteString(lipgloss.NewStyle().Bold(true).Render(riga("TOTALE", r.Totali, r.Totale)) + "\n")
+	}
+
+	b.WriteString("\n" + HelpStyle.Render("[Esc] Indietro"))
+	return b.String()
+}
+
+// importoFascia lascia vuote le fasce senza crediti
+func importoFascia(v float64) string {
+	if v == 0 {
+		return "—"
+	}
+	return utils.FormatEuro(v)
+}
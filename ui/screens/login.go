@@ -0,0 +1,231 @@
+package screens
+
+import (
+	"errors"
+	"fmt"
+	"officina/database"
+	"officina/logger"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Tentativi di accesso falliti consecutivi prima della pausa forzata
+const (
+	maxTentativiAccesso = 5
+	pausaTentativi      = 30 * time.Second
+)
+
+// LoginMsg notifica ad AppModel l'accesso riuscito di un operatore
+type LoginMsg struct {
+	Operatore *database.Operatore
+}
+
+// BloccaSessioneMsg chiede ad AppModel di bloccare la sessione ([L] dal menu)
+type BloccaSessioneMsg struct{}
+
+// loginEsitoMsg riporta l'esito della verifica, eseguita fuori dal ciclo
+// di Update perché bcrypt richiede qualche decina di millisecondi
+type loginEsitoMsg struct {
+	operatore *database.Operatore
+	err       error
+}
+
+// LoginModel gestisce la schermata di accesso e di sblocco della sessione
+type LoginModel struct {
+	db         *database.DB
+	inputs     []textinput.Model // matricola, password/PIN
+	focusIndex int
+	bloccata   *database.Operatore // operatore della sessione bloccata, nil al primo accesso
+	falliti    int
+	pausaFino  time.Time
+	verifica   bool
+	err        error
+	width      int
+	height     int
+}
+
+// NewLoginModel crea la schermata di accesso
+func NewLoginModel(db *database.DB) LoginModel {
+	inputs := make([]textinput.Model, 2)
+	inputs[0] = textinput.New()
+	inputs[0].Placeholder = "Matricola"
+	inputs[0].Width = 20
+	inputs[0].CharLimit = 20
+
+	inputs[1] = textinput.New()
+	inputs[1].Placeholder = "Password o PIN"
+	inputs[1].Width = 20
+	inputs[1].EchoMode = textinput.EchoPassword
+	inputs[1].EchoCharacter = '•'
+
+	m := LoginModel{db: db, inputs: inputs}
+	m.reset(nil)
+	return m
+}
+
+// Blocca prepara la schermata per sbloccare la sessione di o: la matricola
+// è già compilata, ma un altro operatore può accedere al suo posto
+func (m *LoginModel) Blocca(o *database.Operatore) {
+	m.reset(o)
+}
+
+func (m *LoginModel) reset(o *database.Operatore) {
+	m.bloccata = o
+	m.err = nil
+	m.verifica = false
+	m.inputs[1].SetValue("")
+	m.focusIndex = 0
+	if o != nil {
+		m.inputs[0].SetValue(o.Matricola)
+		m.focusIndex = 1
+	} else {
+		m.inputs[0].SetValue("")
+	}
+	m.updateFocus()
+}
+
+func (m *LoginModel) updateFocus() {
+	for i := range m.inputs {
+		if i == m.focusIndex {
+			m.inputs[i].Focus()
+		} else {
+			m.inputs[i].Blur()
+		}
+	}
+}
+
+// accedi verifica le credenziali in background
+func (m *LoginModel) accedi() tea.Cmd {
+	if attesa := time.Until(m.pausaFino); attesa > 0 {
+		m.err = fmt.Errorf("troppi tentativi falliti: riprova tra %d secondi", int(attesa.Seconds())+1)
+		return nil
+	}
+
+	matricola := strings.TrimSpace(m.inputs[0].Value())
+	credenziale := m.inputs[1].Value()
+	if matricola == "" || credenziale == "" {
+		m.err = fmt.Errorf("inserisci matricola e password")
+		return nil
+	}
+
+	m.verifica = true
+	m.err = nil
+	db := m.db
+	return func() tea.Msg {
+		o, err := db.Autentica(matricola, credenziale)
+		return loginEsitoMsg{operatore: o, err: err}
+	}
+}
+
+// Init implementa tea.Model
+func (m LoginModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+// Update implementa tea.Model
+func (m LoginModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case loginEsitoMsg:
+		m.verifica = false
+		m.inputs[1].SetValue("")
+		if msg.err != nil {
+			if errors.Is(msg.err, database.ErrCredenzialiNonValide) {
+				m.falliti++
+				logger.Warn("Accesso negato per matricola %s (%d tentativi)", strings.ToUpper(m.inputs[0].Value()), m.falliti)
+				if m.falliti >= maxTentativiAccesso {
+					m.falliti = 0
+					m.pausaFino = time.Now().Add(pausaTentativi)
+				}
+			}
+			m.err = msg.err
+			m.focusIndex = 1
+			m.updateFocus()
+			return m, nil
+		}
+		m.falliti = 0
+		o := msg.operatore
+		return m, func() tea.Msg { return LoginMsg{Operatore: o} }
+	}
+
+	if m.verifica {
+		return m, nil
+	}
+
+	if k, ok := msg.(tea.KeyMsg); ok {
+		switch k.String() {
+		case "ctrl+c":
+			return m, tea.Quit
+		case "esc":
+			// Ripulisce il form; dalla schermata di accesso non si esce
+			m.reset(m.bloccata)
+			return m, nil
+		case "enter":
+			if m.focusIndex == len(m.inputs)-1 {
+				return m, m.accedi()
+			}
+			m.focusIndex++
+			m.updateFocus()
+			return m, nil
+		case "tab", "down", "shift+tab", "up":
+			m.focusIndex = 1 - m.focusIndex
+			m.updateFocus()
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.inputs[m.focusIndex], cmd = m.inputs[m.focusIndex].Update(msg)
+	if m.focusIndex == 0 {
+		m.inputs[0].SetValue(strings.ToUpper(m.inputs[0].Value()))
+	}
+	return m, cmd
+}
+
+// View implementa tea.Model
+func (m LoginModel) View() string {
+	width := 50
+
+	title := "ACCESSO OPERATORE"
+	if m.bloccata != nil {
+		title = "SESSIONE BLOCCATA"
+	}
+
+	var b strings.Builder
+	b.WriteString(RenderHeader(title, width) + "\n\n")
+	if m.bloccata != nil {
+		b.WriteString(WarningStyle.Render(fmt.Sprintf("Sessione di %s bloccata.", m.bloccata.NomeCompleto())) + "\n")
+		b.WriteString(HelpStyle.Render("Un altro operatore può accedere con la propria matricola.") + "\n\n")
+	}
+
+	labels := []string{"Matricola", "Password"}
+	for i, inp := range m.inputs {
+		labelStyle := LabelStyle
+		if i == m.focusIndex {
+			labelStyle = LabelFocusedStyle
+		}
+		b.WriteString(fmt.Sprintf("%s %s\n", labelStyle.Render(labels[i]+":"), inp.View()))
+	}
+
+	b.WriteString("\n")
+	switch {
+	case m.verifica:
+		b.WriteString(HelpStyle.Render("Verifica in corso...") + "\n")
+	case m.err != nil:
+		b.WriteString(ErrorStyle.Render("✗ "+m.err.Error()) + "\n")
+	}
+	b.WriteString(HelpStyle.Render("[↵] Accedi • [Tab] Campo successivo • [Ctrl+C] Esci"))
+
+	box := MainBoxStyle.Copy().Width(width).Render(b.String())
+	if m.width > 0 && m.height > 0 {
+		return CenterContent(m.width, m.height, box)
+	}
+	return "\n" + box
+}
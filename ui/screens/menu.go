@@ -12,20 +12,26 @@ import (
 
 // MenuItem rappresenta una voce del menu
 type MenuItem struct {
-	Label string
-	Icon  string
-	State AppState
+	Label   string
+	Icon    string
+	State   AppState
+	Key     string // tasto rapido, diverso per ogni voce
+	Risorsa string // la voce è mostrata solo se il ruolo può vederla
 }
 
 // MenuModel gestisce il menu principale
 type MenuModel struct {
 	db                *database.DB
 	cursor            int
-	items             []MenuItem
+	tutte             []MenuItem
+	items             []MenuItem // voci visibili all'operatore corrente
 	width             int
 	height            int
 	todayAppointments int
 	openCommesse      int
+	operatore         *database.Operatore // operatore che ha eseguito l'accesso, nil senza login
+	bloccabile        bool                // la sessione si può bloccare e riprendere con la password
+	avviso            string              // errore di un'operazione in background, come la replica dei backup
 }
 
 // NewMenuModel crea una nuova istanza del menu
@@ -33,19 +39,26 @@ func NewMenuModel(db *database.DB) MenuModel {
 	m := MenuModel{
 		db:     db,
 		cursor: 0,
-		items: []MenuItem{
-			{Label: "Gestione Clienti", Icon: "👥", State: StateClienti},
-			{Label: "Gestione Veicoli", Icon: "🚗", State: StateVeicoli},
-			{Label: "Gestione Fornitori", Icon: "🏢", State: StateFornitori},
-			{Label: "Gestione Commesse", Icon: "🔧", State: StateCommesse},
-			{Label: "Agenda & Appuntamenti", Icon: "📅", State: StateAgenda},
-			{Label: "Prima Nota & Cassa", Icon: "💶", State: StatePrimaNota},
-			{Label: "Operatori", Icon: "👨‍🔧", State: StateOperatori},
-			{Label: "Preventivi", Icon: "💰", State: StatePreventivi},
-			{Label: "Fatture & Ricevute", Icon: "📄", State: StateFatture},
+		tutte: []MenuItem{
+			{Label: "Gestione Clienti", Icon: "👥", State: StateClienti, Key: "1", Risorsa: database.RisorsaClienti},
+			{Label: "Gestione Veicoli", Icon: "🚗", State: StateVeicoli, Key: "2", Risorsa: database.RisorsaVeicoli},
+			{Label: "Gestione Fornitori", Icon: "🏢", State: StateFornitori, Key: "3", Risorsa: database.RisorsaFornitori},
+			{Label: "Gestione Commesse", Icon: "🔧", State: StateCommesse, Key: "4", Risorsa: database.RisorsaCommesse},
+			{Label: "Agenda & Appuntamenti", Icon: "📅", State: StateAgenda, Key: "5", Risorsa: database.RisorsaAppuntamenti},
+			{Label: "Prima Nota & Cassa", Icon: "💶", State: StatePrimaNota, Key: "6", Risorsa: database.RisorsaMovimenti},
+			{Label: "Operatori", Icon: "👨‍🔧", State: StateOperatori, Key: "7", Risorsa: database.RisorsaOperatori},
+			{Label: "Preventivi", Icon: "💰", State: StatePreventivi, Key: "8", Risorsa: database.RisorsaPreventivi},
+			{Label: "Fatture & Ricevute", Icon: "📄", State: StateFatture, Key: "9", Risorsa: database.RisorsaFatture},
+			{Label: "Backup & Ripristino", Icon: "💾", State: StateBackup, Key: "0", Risorsa: database.RisorsaBackup},
+			{Label: "Dati Officina", Icon: "🏭", State: StateProfiloAzienda, Key: "A", Risorsa: database.RisorsaProfilo},
+			{Label: "Impostazioni", Icon: "⚙️", State: StateImpostazioni, Key: "I", Risorsa: database.RisorsaImpostazioni},
 		},
 	}
 
+	// I tasti rapidi sono fissi, così che non cambino quando un ruolo non
+	// vede alcune voci o se ne aggiungono di nuove
+	m.filtraVoci()
+
 	m.RefreshStats()
 	return m
 }
@@ -76,6 +89,44 @@ func (m *MenuModel) RefreshStats() {
 	m.openCommesse = openCount
 }
 
+// SetOperatore imposta l'operatore mostrato nel menu e nasconde le voci che
+// il suo ruolo non può usare; bloccabile abilita [L] Blocca
+func (m *MenuModel) SetOperatore(o *database.Operatore, bloccabile bool) {
+	m.operatore = o
+	m.bloccabile = bloccabile
+	m.filtraVoci()
+}
+
+// SetAvviso mostra nel menu l'errore di un'operazione in background; una
+// stringa vuota lo toglie
+func (m *MenuModel) SetAvviso(avviso string) {
+	m.avviso = avviso
+}
+
+// Nascondi toglie dal menu la voce della schermata, qualunque sia il ruolo
+func (m *MenuModel) Nascondi(state AppState) {
+	for i, item := range m.tutte {
+		if item.State == state {
+			m.tutte = append(m.tutte[:i:i], m.tutte[i+1:]...)
+			break
+		}
+	}
+	m.filtraVoci()
+}
+
+// filtraVoci aggiorna le voci visibili secondo i permessi della sessione
+func (m *MenuModel) filtraVoci() {
+	m.items = m.items[:0]
+	for _, item := range m.tutte {
+		if m.db == nil || m.db.Consentito(item.Risorsa, database.PermessoVedi) {
+			m.items = append(m.items, item)
+		}
+	}
+	if m.cursor >= len(m.items) {
+		m.cursor = 0
+	}
+}
+
 // Init implementa tea.Model
 func (m MenuModel) Init() tea.Cmd {
 	return nil
@@ -110,15 +161,21 @@ func (m MenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.cursor = 0
 			}
 
+		case "l", "L":
+			if m.bloccabile {
+				return m, func() tea.Msg { return BloccaSessioneMsg{} }
+			}
+
 		case "enter", " ":
 			target := m.items[m.cursor].State
 			return m, func() tea.Msg { return ChangeScreenMsg(target) }
 
-		case "1", "2", "3", "4", "5", "6", "7", "8", "9":
-			num := int(msg.String()[0]-'0') - 1
-			if num >= 0 && num < len(m.items) {
-				target := m.items[num].State
-				return m, func() tea.Msg { return ChangeScreenMsg(target) }
+		default:
+			for _, item := range m.items {
+				if item.Key != "" && strings.EqualFold(item.Key, msg.String()) {
+					target := item.State
+					return m, func() tea.Msg { return ChangeScreenMsg(target) }
+				}
 			}
 		}
 	}
@@ -136,6 +193,15 @@ func (m MenuModel) View() string {
 	header := RenderHeader("MENU PRINCIPALE", width)
 
 	var statsBuilder strings.Builder
+	if m.operatore != nil {
+		operatore := fmt.Sprintf("👤 %s (%s)", m.operatore.NomeCompleto(), m.operatore.Ruolo)
+		if m.bloccabile {
+			operatore += " • [L] Blocca sessione"
+		}
+		statsBuilder.WriteString(lipgloss.NewStyle().
+			Foreground(ColorSubText).
+			Render(operatore) + "\n\n")
+	}
 	if m.todayAppointments > 0 || m.openCommesse > 0 {
 		statsBuilder.WriteString(lipgloss.NewStyle().
 			Foreground(ColorSubText).
@@ -177,12 +243,12 @@ func (m MenuModel) View() string {
 				Foreground(ColorPrimary).
 				Background(ColorBgLight).
 				Bold(true).
-				Render(fmt.Sprintf("[%d]", i+1))
+				Render("[" + item.Key + "]")
 		} else {
 			numLabel = lipgloss.NewStyle().
 				Foreground(ColorSubText).
 				Bold(true).
-				Render(fmt.Sprintf("[%d]", i+1))
+				Render("[" + item.Key + "]")
 		}
 
 		cursor := "  "
@@ -203,6 +269,9 @@ func (m MenuModel) View() string {
 	}
 
 	footer := RenderFooter(width)
+	if m.avviso != "" {
+		footer = WarningStyle.Render("⚠ "+m.avviso+" (dettagli in [0] Backup & Ripristino)") + "\n" + footer
+	}
 
 	content := lipgloss.JoinVertical(
 		lipgloss.Left,
@@ -46,6 +46,7 @@ func NewOperatoriModel(db *database.DB) OperatoriModel {
 		{Title: "Matricola", Width: 10},
 		{Title: "Nome Completo", Width: 30},
 		{Title: "Ruolo", Width: 25},
+		{Title: "Accesso", Width: 8},
 	}
 
 	t := table.New(
@@ -57,7 +58,7 @@ func NewOperatoriModel(db *database.DB) OperatoriModel {
 	t.SetStyles(GetTableStyles())
 
 	// Configurazione inputs
-	inputs := make([]textinput.Model, 4)
+	inputs := make([]textinput.Model, 5)
 	inputs[0] = textinput.New()
 	inputs[0].Placeholder = "Matricola (es. OPR001)"
 	inputs[0].Width = 40
@@ -74,6 +75,12 @@ func NewOperatoriModel(db *database.DB) OperatoriModel {
 	inputs[3].Placeholder = "Ruolo (es. Meccanico, Carrozziere)"
 	inputs[3].Width = 40
 
+	inputs[4] = textinput.New()
+	inputs[4].Placeholder = "Password o PIN (facoltativo)"
+	inputs[4].Width = 40
+	inputs[4].EchoMode = textinput.EchoPassword
+	inputs[4].EchoCharacter = '•'
+
 	m := OperatoriModel{
 		db:     db,
 		table:  t,
@@ -92,11 +99,16 @@ func (m *OperatoriModel) Refresh() {
 
 	for _, o := range list {
 		nomeCompleto := fmt.Sprintf("%s %s", o.Nome, o.Cognome)
+		accesso := ""
+		if o.HaCredenziale() {
+			accesso = "✓"
+		}
 		rows = append(rows, table.Row{
 			fmt.Sprintf("%d", o.ID),
 			o.Matricola,
 			utils.Truncate(nomeCompleto, 30),
 			utils.Truncate(o.Ruolo, 25),
+			accesso,
 		})
 	}
 
@@ -128,6 +140,7 @@ func (m *OperatoriModel) loadIntoForm(id int) {
 	m.inputs[1].SetValue(o.Nome)
 	m.inputs[2].SetValue(o.Cognome)
 	m.inputs[3].SetValue(o.Ruolo)
+	m.inputs[4].SetValue("")
 
 	m.focusIndex = 0
 	m.err = nil
@@ -164,6 +177,10 @@ func (m *OperatoriModel) validate() error {
 		return err
 	}
 
+	if p := m.inputs[4].Value(); p != "" && len([]rune(p)) < database.LunghezzaMinimaCredenziale {
+		return fmt.Errorf("password o PIN devono avere almeno %d caratteri", database.LunghezzaMinimaCredenziale)
+	}
+
 	return nil
 }
 
@@ -193,6 +210,14 @@ func (m *OperatoriModel) save() error {
 		m.msg = "✓ Operatore aggiornato con successo"
 	}
 
+	// Un campo vuoto lascia invariata la credenziale esistente
+	if p := m.inputs[4].Value(); p != "" {
+		if err := m.db.ImpostaCredenziale(o.ID, p); err != nil {
+			return fmt.Errorf("errore salvataggio password: %w", err)
+		}
+		m.inputs[4].SetValue("")
+	}
+
 	m.mode = OpModeList
 	m.Refresh()
 	return nil
@@ -250,10 +275,18 @@ func (m OperatoriModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyMsg:
 			switch msg.String() {
 			case "n":
+				if err := m.db.Autorizza(database.RisorsaOperatori, database.PermessoCrea); err != nil {
+					m.err = err
+					return m, nil
+				}
 				m.mode = OpModeAdd
 				m.resetForm()
 				return m, nil
 			case "e", "enter":
+				if err := m.db.Autorizza(database.RisorsaOperatori, database.PermessoModifica); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.loadIntoForm(id)
@@ -261,6 +294,10 @@ func (m OperatoriModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			case "x", "d":
+				if err := m.db.Autorizza(database.RisorsaOperatori, database.PermessoElimina); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.deletingID = id
@@ -375,7 +412,7 @@ func (m OperatoriModel) View() string {
 	} else {
 		// Vista form
 		var form strings.Builder
-		labels := []string{"Matricola", "Nome", "Cognome", "Ruolo"}
+		labels := []string{"Matricola", "Nome", "Cognome", "Ruolo", "Password/PIN"}
 
 		for i, inp := range m.inputs {
 			labelStyle := LabelStyle
@@ -388,6 +425,9 @@ func (m OperatoriModel) View() string {
 				inp.View()))
 		}
 
+		if m.mode == OpModeEdit {
+			form.WriteString(HelpStyle.Render("Lascia vuota la password per mantenere quella attuale") + "\n")
+		}
 		form.WriteString("\n")
 		form.WriteString(HelpStyle.Render("[Tab/↑↓] Naviga • [↵] Conferma/Prossimo • [Esc] Annulla"))
 		body = form.String()
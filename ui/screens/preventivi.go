@@ -3,6 +3,7 @@ package screens
 import (
 	"fmt"
 	"officina/database"
+	"officina/stampa"
 	"officina/utils"
 	"strconv"
 	"strings"
@@ -36,6 +37,7 @@ type PreventiviModel struct {
 	height      int
 	showConfirm bool
 	deletingID  int
+	profilo     *database.ProfiloAzienda
 }
 
 // NewPreventiviModel crea una nuova istanza del model preventivi
@@ -83,6 +85,8 @@ func NewPreventiviModel(db *database.DB) PreventiviModel {
 
 // Refresh aggiorna la lista dei preventivi
 func (m *PreventiviModel) Refresh() {
+	m.RefreshProfilo()
+
 	list, _ := m.db.ListPreventivi()
 	rows := []table.Row{}
 
@@ -105,6 +109,13 @@ func (m *PreventiviModel) Refresh() {
 	m.table.SetRows(rows)
 }
 
+// RefreshProfilo ricarica i dati dell'officina che emette i preventivi
+func (m *PreventiviModel) RefreshProfilo() {
+	if p, err := m.db.GetProfiloAzienda(); err == nil {
+		m.profilo = p
+	}
+}
+
 // resetForm resetta il form
 func (m *PreventiviModel) resetForm() {
 	for i := range m.inputs {
@@ -212,9 +223,7 @@ func (m *PreventiviModel) toggleAccettato(id int) error {
 		return err
 	}
 
-	p.Accettato = !p.Accettato
-
-	if err := m.db.UpdatePreventivo(p); err != nil {
+	if p, err = m.db.AccettaPreventivo(id, !p.Accettato); err != nil {
 		return err
 	}
 
@@ -263,6 +272,11 @@ func (m PreventiviModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	if msg, ok := msg.(StampaEseguitaMsg); ok {
+		m.msg, m.err = esitoStampa(msg)
+		return m, nil
+	}
+
 	// Gestione ESC
 	if k, ok := msg.(tea.KeyMsg); ok && k.String() == "esc" {
 		if m.mode != PrevModeList {
@@ -280,16 +294,36 @@ func (m PreventiviModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyMsg:
 			switch msg.String() {
 			case "n":
+				if err := m.db.Autorizza(database.RisorsaPreventivi, database.PermessoCrea); err != nil {
+					m.err = err
+					return m, nil
+				}
 				m.mode = PrevModeAdd
 				m.resetForm()
 				return m, nil
 			case "e", "enter":
+				if err := m.db.Autorizza(database.RisorsaPreventivi, database.PermessoModifica); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.loadIntoForm(id)
 					m.mode = PrevModeEdit
 				}
 				return m, nil
+			case "P":
+				if err := m.db.Autorizza(database.RisorsaPreventivi, database.PermessoEsporta); err != nil {
+					m.err = err
+					return m, nil
+				}
+				if row := m.table.SelectedRow(); len(row) > 0 {
+					id, _ := strconv.Atoi(row[0])
+					m.err = nil
+					m.msg = ""
+					return m, func() tea.Msg { return StampaMsg{Modello: stampa.ModelloPreventivo, ID: id} }
+				}
+				return m, nil
 			case "a":
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
@@ -299,6 +333,10 @@ func (m PreventiviModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			case "x", "d":
+				if err := m.db.Autorizza(database.RisorsaPreventivi, database.PermessoElimina); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.deletingID = id
@@ -398,10 +436,11 @@ func (m PreventiviModel) View() string {
 		helpText := lipgloss.NewStyle().
 			MarginBottom(1).
 			Foreground(ColorSubText).
-			Render("[N] Nuovo • [E/↵] Modifica • [A] Toggle Accettato • [X/D] Elimina • [ESC] Menu")
+			Render("[N] Nuovo • [E/↵] Modifica • [A] Toggle Accettato • [X/D] Elimina • [⇧P] PDF • [ESC] Menu")
 
 		body = lipgloss.JoinVertical(
 			lipgloss.Left,
+			renderEmittente(m.profilo),
 			helpText,
 			m.table.View(),
 		)
@@ -421,6 +460,10 @@ func (m PreventiviModel) View() string {
 				inp.View()))
 		}
 
+		if riepilogo := renderScorporoIVA(m.profilo, m.inputs[1].Value()); riepilogo != "" {
+			form.WriteString(riepilogo + "\n")
+		}
+
 		form.WriteString("\n")
 		form.WriteString(HelpStyle.Render("[Tab/↑↓] Naviga • [↵] Conferma/Prossimo • [Esc] Annulla"))
 		body = form.String()
@@ -3,6 +3,7 @@ package screens
 import (
 	"fmt"
 	"officina/database"
+	"officina/export"
 	"officina/utils"
 	"sort"
 	"strconv"
@@ -55,13 +56,14 @@ type PrimaNotaModel struct {
 	selectedCommessaTarga  string
 	filterInputs           []textinput.Model
 	filterFocusIdx         int
-	filteredList           []database.MovimentoPrimaNota
+	filteredList           []database.MovimentoPrimaNota // movimenti mostrati, filtrati e ordinati
 	hasActiveFilter        bool
 	fornitoreSelectionMode bool
 	fornitoreTable         table.Model
 	fornitoreFilter        textinput.Model
 	selectedFornitoreID    int
 	selectedFornitoreNome  string
+	esporta                sceltaEsportazione
 }
 
 // NewPrimaNotaModel crea una nuova istanza del model prima nota
@@ -204,6 +206,7 @@ func (m *PrimaNotaModel) Refresh() {
 	sort.Slice(list, func(i, j int) bool {
 		return list[i].Data.After(list[j].Data)
 	})
+	m.filteredList = list
 
 	m.totaleEntrate = 0
 	m.totaleUscite = 0
@@ -319,6 +322,29 @@ func (m *PrimaNotaModel) matchImporto(importo float64, filter string) bool {
 	return err == nil && importo == val
 }
 
+// filtriAttivi descrive i filtri applicati alla lista, riportati nell'export
+func (m *PrimaNotaModel) filtriAttivi() []string {
+	if !m.hasActiveFilter {
+		return nil
+	}
+
+	labels := []string{"Data da", "Data a", "Descrizione", "Importo"}
+	var filtri []string
+	for i, inp := range m.filterInputs {
+		if v := strings.TrimSpace(inp.Value()); v != "" {
+			filtri = append(filtri, labels[i]+": "+v)
+		}
+	}
+	return filtri
+}
+
+// tabellaExport prepara i movimenti mostrati, con i filtri attivi
+func (m *PrimaNotaModel) tabellaExport() *export.Tabella {
+	commesse, _ := m.db.ListCommesse()
+	fornitori, _ := m.db.ListFornitori()
+	return export.PrimaNota(m.filteredList, commesse, fornitori, m.filtriAttivi())
+}
+
 // clearFilters pulisce tutti i filtri
 func (m *PrimaNotaModel) clearFilters() {
 	for i := range m.filterInputs {
@@ -698,6 +724,15 @@ func (m PrimaNotaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.handleDeleteConfirmation(msg)
 	}
 
+	if msg, ok := msg.(EsportazioneMsg); ok {
+		m.msg, m.err = esitoEsportazione(msg)
+		return m, nil
+	}
+
+	if k, ok := msg.(tea.KeyMsg); ok && m.esporta.attiva {
+		return m, m.esporta.update(k, m.tabellaExport)
+	}
+
 	if k, ok := msg.(tea.KeyMsg); ok && k.String() == "esc" {
 		if m.mode == PNModeFilter {
 			m.mode = PNModeList
@@ -856,10 +891,18 @@ func (m PrimaNotaModel) handleListMode(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "n":
+			if err := m.db.Autorizza(database.RisorsaMovimenti, database.PermessoCrea); err != nil {
+				m.err = err
+				return m, nil
+			}
 			m.mode = PNModeAdd
 			m.resetForm()
 			return m, nil
 		case "e", "enter":
+			if err := m.db.Autorizza(database.RisorsaMovimenti, database.PermessoModifica); err != nil {
+				m.err = err
+				return m, nil
+			}
 			if row := m.table.SelectedRow(); len(row) > 0 {
 				id, _ := strconv.Atoi(row[0])
 				m.loadIntoForm(id)
@@ -867,12 +910,25 @@ func (m PrimaNotaModel) handleListMode(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 		case "x", "d":
+			if err := m.db.Autorizza(database.RisorsaMovimenti, database.PermessoElimina); err != nil {
+				m.err = err
+				return m, nil
+			}
 			if row := m.table.SelectedRow(); len(row) > 0 {
 				id, _ := strconv.Atoi(row[0])
 				m.deletingID = id
 				m.showConfirm = true
 			}
 			return m, nil
+		case "E":
+			if err := m.db.Autorizza(database.RisorsaMovimenti, database.PermessoEsporta); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.esporta.attiva = true
+			m.err = nil
+			m.msg = ""
+			return m, nil
 		case "f":
 			m.mode = PNModeFilter
 			m.filterFocusIdx = 0
@@ -1057,7 +1113,7 @@ func (m PrimaNotaModel) View() string {
 		helpText := lipgloss.NewStyle().
 			MarginBottom(1).
 			Foreground(ColorSubText).
-			Render(filterStatus + "[N] Nuovo • [E/↵] Modifica • [X/D] Elimina • [F] Filtri • [Ctrl+R] Reset Filtri • [ESC] Menu")
+			Render(filterStatus + "[N] Nuovo • [E/↵] Modifica • [X/D] Elimina • [F] Filtri • [Ctrl+R] Reset Filtri • [⇧E] Esporta • [ESC] Menu")
 
 		statsLine := fmt.Sprintf("💰 Totale Entrate: %s | Totale Uscite: %s | Saldo: %s",
 			utils.FormatEuro(m.totaleEntrate),
@@ -1069,13 +1125,22 @@ func (m PrimaNotaModel) View() string {
 			saldoStyle = ErrorStyle
 		}
 
+		// Totali e saldo solo per i ruoli che possono vederli
+		stats := saldoStyle.Render(statsLine)
+		if !m.db.Consentito(database.RisorsaSaldo, database.PermessoVedi) {
+			stats = HelpStyle.Render(fmt.Sprintf("%d movimenti", len(m.table.Rows())))
+		}
+
 		body = lipgloss.JoinVertical(
 			lipgloss.Left,
 			helpText,
 			m.table.View(),
 			"",
-			saldoStyle.Render(statsLine),
+			stats,
 		)
+		if m.esporta.attiva {
+			body = lipgloss.JoinVertical(lipgloss.Left, body, "", m.esporta.View())
+		}
 	} else if m.mode == PNModeFilter {
 		var form strings.Builder
 		labels := []string{"Data DA", "Data A", "Descrizione", "Importo"}
@@ -0,0 +1,24 @@
+package screens
+
+import "fmt"
+
+// StampaMsg chiede ad AppModel di salvare il PDF del documento nella
+// cartella di export, con i modelli della cartella configurata
+type StampaMsg struct {
+	Modello string // stampa.ModelloFattura, ModelloPreventivo o ModelloOrdine
+	ID      int
+}
+
+// StampaEseguitaMsg riporta alla schermata attiva l'esito della stampa
+type StampaEseguitaMsg struct {
+	Path string
+	Err  error
+}
+
+// esitoStampa converte l'esito nel messaggio mostrato dalla schermata
+func esitoStampa(msg StampaEseguitaMsg) (string, error) {
+	if msg.Err != nil {
+		return "", fmt.Errorf("PDF non generato: %w", msg.Err)
+	}
+	return "✓ PDF salvato in " + msg.Path, nil
+}
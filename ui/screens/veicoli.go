@@ -3,6 +3,7 @@ package screens
 import (
 	"fmt"
 	"officina/database"
+	"officina/export"
 	"officina/utils"
 	"sort"
 	"strconv"
@@ -57,6 +58,8 @@ type VeicoliModel struct {
 	deleteWarningCommesse  int
 	deleteWarningMovimenti int
 	deleteWarningTotale    float64
+	vista                  []database.Veicolo // veicoli nell'ordine mostrato
+	esporta                sceltaEsportazione
 }
 
 // NewVeicoliModel crea una nuova istanza del model veicoli
@@ -178,9 +181,11 @@ func (m *VeicoliModel) Refresh() {
 		return viewItems[i].Veicolo.ID > viewItems[j].Veicolo.ID
 	})
 
+	m.vista = m.vista[:0]
 	rows := []table.Row{}
 	for _, item := range viewItems {
 		v := item.Veicolo
+		m.vista = append(m.vista, v)
 		prop := "N/D"
 		if v.ClienteID > 0 {
 			c, err := m.db.GetCliente(v.ClienteID)
@@ -201,6 +206,12 @@ func (m *VeicoliModel) Refresh() {
 	m.table.SetRows(rows)
 }
 
+// tabellaExport prepara i veicoli nell'ordine della lista per l'esportazione
+func (m *VeicoliModel) tabellaExport() *export.Tabella {
+	clienti, _ := m.db.ListClienti()
+	return export.Veicoli(m.vista, clienti)
+}
+
 // countDataForVeicolo conta commesse e movimenti associati a un veicolo
 func (m *VeicoliModel) countDataForVeicolo(veicoloID int) (int, int, float64) {
 	commesse, _ := m.db.ListCommesse()
@@ -533,6 +544,15 @@ func (m VeicoliModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	if msg, ok := msg.(EsportazioneMsg); ok {
+		m.msg, m.err = esitoEsportazione(msg)
+		return m, nil
+	}
+
+	if k, ok := msg.(tea.KeyMsg); ok && m.esporta.attiva {
+		return m, m.esporta.update(k, m.tabellaExport)
+	}
+
 	if k, ok := msg.(tea.KeyMsg); ok && k.String() == "esc" {
 		if m.mode != ModeList {
 			m.mode = ModeList
@@ -548,10 +568,27 @@ func (m VeicoliModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyMsg:
 			switch msg.String() {
 			case "n":
+				if err := m.db.Autorizza(database.RisorsaVeicoli, database.PermessoCrea); err != nil {
+					m.err = err
+					return m, nil
+				}
 				m.mode = ModeAdd
 				m.resetForm()
 				return m, nil
+			case "E":
+				if err := m.db.Autorizza(database.RisorsaVeicoli, database.PermessoEsporta); err != nil {
+					m.err = err
+					return m, nil
+				}
+				m.esporta.attiva = true
+				m.err = nil
+				m.msg = ""
+				return m, nil
 			case "e", "enter":
+				if err := m.db.Autorizza(database.RisorsaVeicoli, database.PermessoModifica); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.loadIntoForm(id)
@@ -565,6 +602,10 @@ func (m VeicoliModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			case "x", "d":
+				if err := m.db.Autorizza(database.RisorsaVeicoli, database.PermessoElimina); err != nil {
+					m.err = err
+					return m, nil
+				}
 				if row := m.table.SelectedRow(); len(row) > 0 {
 					id, _ := strconv.Atoi(row[0])
 					m.deletingID = id
@@ -721,13 +762,16 @@ func (m VeicoliModel) View() string {
 		helpText := lipgloss.NewStyle().
 			MarginBottom(1).
 			Foreground(ColorSubText).
-			Render("[N] Nuovo • [E/↵] Modifica • [H] Storico • [X/D] Elimina • [ESC] Menu")
+			Render("[N] Nuovo • [E/↵] Modifica • [H] Storico • [X/D] Elimina • [⇧E] Esporta • [ESC] Menu")
 
 		body = lipgloss.JoinVertical(
 			lipgloss.Left,
 			helpText,
 			m.table.View(),
 		)
+		if m.esporta.attiva {
+			body = lipgloss.JoinVertical(lipgloss.Left, body, "", m.esporta.View())
+		}
 	} else {
 		var form strings.Builder
 		labels := []string{"Targa", "Marca", "Modello", "Proprietario"}
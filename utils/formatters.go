@@ -76,3 +76,20 @@ func FormatInt(n int) string {
 
 	return result.String()
 }
+
+// FormatSize formatta una dimensione in byte in forma leggibile (es. "1,5 MB")
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	value := fmt.Sprintf("%.1f", float64(bytes)/float64(div))
+	return strings.ReplaceAll(value, ".", ",") + " " + string("KMGTPE"[exp]) + "B"
+}
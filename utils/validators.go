@@ -95,6 +95,45 @@ func ValidatePartitaIVA(piva string) error {
 	return nil
 }
 
+// ValidateIBAN valida un IBAN: formato e cifra di controllo (mod 97)
+func ValidateIBAN(iban string) error {
+	iban = strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+
+	if iban == "" {
+		return nil // IBAN opzionale
+	}
+
+	match, _ := regexp.MatchString(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`, iban)
+	if !match {
+		return fmt.Errorf("formato IBAN non valido")
+	}
+
+	if strings.HasPrefix(iban, "IT") && len(iban) != 27 {
+		return fmt.Errorf("IBAN italiano deve essere di 27 caratteri")
+	}
+
+	// Sposta i primi 4 caratteri in fondo, converte le lettere in numeri
+	// (A=10 ... Z=35) e calcola il resto della divisione per 97
+	rearranged := iban[4:] + iban[:4]
+	resto := 0
+	for _, c := range rearranged {
+		var v int
+		if c >= 'A' && c <= 'Z' {
+			v = int(c-'A') + 10
+			resto = (resto*100 + v) % 97
+		} else {
+			v = int(c - '0')
+			resto = (resto*10 + v) % 97
+		}
+	}
+
+	if resto != 1 {
+		return fmt.Errorf("IBAN non valido (cifra di controllo errata)")
+	}
+
+	return nil
+}
+
 // ValidateCAP valida un CAP italiano
 func ValidateCAP(cap string) error {
 	cap = strings.ReplaceAll(cap, " ", "")
@@ -0,0 +1,310 @@
+// Package webhook invia gli eventi di dominio del database (commessa
+// chiusa, fattura emessa, ...) agli indirizzi HTTP configurati in
+// [[webhooks]]: richieste POST JSON firmate con HMAC-SHA256, ripetute con
+// attesa crescente finché il destinatario non risponde 2xx, con ogni
+// tentativo annotato nel registro delle consegne.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"officina/config"
+	"officina/database"
+	"officina/logger"
+)
+
+// EventoProva è l'evento inviato da "officina webhook test", a qualunque
+// webhook indipendentemente dagli eventi scelti
+const EventoProva = "webhook.prova"
+
+// Header delle richieste
+const (
+	HeaderEvento    = "X-Officina-Evento"
+	HeaderConsegna  = "X-Officina-Consegna" // id dell'evento, uguale nei tentativi ripetuti
+	HeaderTentativo = "X-Officina-Tentativo"
+	HeaderTimestamp = "X-Officina-Timestamp"
+	HeaderFirma     = "X-Officina-Firma"
+)
+
+// TentativiPredefiniti vale quando max_tentativi non è indicato
+const TentativiPredefiniti = 5
+
+// Registro conserva l'esito dei tentativi di consegna
+type Registro interface {
+	RegistraConsegnaWebhook(c database.ConsegnaWebhook) error
+}
+
+// Dispatcher riceve gli eventi e li consegna ai webhook interessati.
+// Ogni consegna procede in una propria goroutine, quindi l'ordine di
+// arrivo al destinatario non è garantito.
+type Dispatcher struct {
+	hooks    []config.WebhookConfig
+	registro Registro
+	client   *http.Client
+
+	// Attesa prima del secondo tentativo, raddoppiata a ogni tentativo
+	// successivo fino ad AttesaMassima
+	Attesa        time.Duration
+	AttesaMassima time.Duration
+
+	ctx     context.Context
+	annulla context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewDispatcher prepara l'invio ai webhook configurati; registro può essere
+// nil se i tentativi non vanno annotati
+func NewDispatcher(hooks []config.WebhookConfig, registro Registro) (*Dispatcher, error) {
+	for i, h := range hooks {
+		for _, e := range h.Eventi {
+			if !database.IsValidTipoEvento(e) {
+				return nil, fmt.Errorf("webhook %s: evento sconosciuto %q", nomeWebhook(h, i), e)
+			}
+		}
+	}
+
+	ctx, annulla := context.WithCancel(context.Background())
+	return &Dispatcher{
+		hooks:         hooks,
+		registro:      registro,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		Attesa:        5 * time.Second,
+		AttesaMassima: 10 * time.Minute,
+		ctx:           ctx,
+		annulla:       annulla,
+	}, nil
+}
+
+// Invia accoda l'evento per i webhook che lo richiedono e torna subito;
+// può essere passato a database.DB.AscoltaEventi
+func (d *Dispatcher) Invia(e database.Evento) {
+	if d.ctx.Err() != nil {
+		return
+	}
+
+	var corpo []byte
+	for i, h := range d.hooks {
+		if !interessato(h, e.Tipo) {
+			continue
+		}
+		if corpo == nil {
+			var err error
+			if corpo, err = json.Marshal(e); err != nil {
+				logger.Error("Webhook: evento %s non serializzabile: %v", e.ID, err)
+				return
+			}
+		}
+
+		d.wg.Add(1)
+		go func(h config.WebhookConfig, nome string) {
+			defer d.wg.Done()
+			d.consegna(h, nome, e, corpo)
+		}(h, nomeWebhook(h, i))
+	}
+}
+
+// Chiudi attende fino a timeout le consegne in corso; quelle ancora in
+// attesa di un nuovo tentativo vengono abbandonate
+func (d *Dispatcher) Chiudi(timeout time.Duration) {
+	fatto := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(fatto)
+	}()
+
+	select {
+	case <-fatto:
+	case <-time.After(timeout):
+		d.annulla()
+		<-fatto
+	}
+	d.annulla()
+}
+
+// Prova invia l'evento di prova al webhook indicato con un solo tentativo,
+// senza filtri sugli eventi, e restituisce l'esito
+func (d *Dispatcher) Prova(ctx context.Context, nome string) (database.ConsegnaWebhook, error) {
+	for i, h := range d.hooks {
+		if nomeWebhook(h, i) != nome {
+			continue
+		}
+		e := database.Evento{
+			ID:      fmt.Sprintf("prova-%d", time.Now().UnixNano()),
+			Tipo:    EventoProva,
+			Data:    time.Now(),
+			Origine: database.OrigineSistema,
+		}
+		corpo, err := json.Marshal(e)
+		if err != nil {
+			return database.ConsegnaWebhook{}, err
+		}
+		c := d.tentativo(ctx, h, nome, e, corpo, 1)
+		c.Definitiva = true
+		d.registra(c)
+		return c, nil
+	}
+	return database.ConsegnaWebhook{}, fmt.Errorf("webhook %q non configurato", nome)
+}
+
+// Nomi restituisce i nomi dei webhook configurati
+func (d *Dispatcher) Nomi() []string {
+	nomi := make([]string, len(d.hooks))
+	for i, h := range d.hooks {
+		nomi[i] = nomeWebhook(h, i)
+	}
+	return nomi
+}
+
+// consegna ripete i tentativi finché uno riesce, l'errore è definitivo o
+// i tentativi sono esauriti
+func (d *Dispatcher) consegna(h config.WebhookConfig, nome string, e database.Evento, corpo []byte) {
+	max := h.MaxTentativi
+	if max <= 0 {
+		max = TentativiPredefiniti
+	}
+
+	for n := 1; ; n++ {
+		c := d.tentativo(d.ctx, h, nome, e, corpo, n)
+		ripetibile := !c.Riuscita && daRipetere(c.Stato) && n < max
+		c.Definitiva = !ripetibile
+		d.registra(c)
+
+		switch {
+		case c.Riuscita:
+			logger.Debug("Webhook %s: %s %s consegnato (tentativo %d)", nome, e.Tipo, e.ID, n)
+			return
+		case !ripetibile:
+			logger.Error("Webhook %s: consegna di %s %s fallita dopo %d tentativi: %s", nome, e.Tipo, e.ID, n, c.Errore)
+			return
+		}
+
+		attesa := d.attesa(n)
+		logger.Warn("Webhook %s: tentativo %d di %s fallito (%s), nuovo tentativo tra %s", nome, n, e.ID, c.Errore, attesa)
+		select {
+		case <-time.After(attesa):
+		case <-d.ctx.Done():
+			logger.Warn("Webhook %s: consegna di %s %s interrotta alla chiusura", nome, e.Tipo, e.ID)
+			return
+		}
+	}
+}
+
+// tentativo esegue una richiesta e ne descrive l'esito
+func (d *Dispatcher) tentativo(ctx context.Context, h config.WebhookConfig, nome string, e database.Evento, corpo []byte, n int) database.ConsegnaWebhook {
+	c := database.ConsegnaWebhook{
+		Data:      time.Now(),
+		Webhook:   nome,
+		URL:       h.URL,
+		Evento:    e.Tipo,
+		EventoID:  e.ID,
+		RecordID:  e.RecordID,
+		Tentativo: n,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(corpo))
+	if err != nil {
+		c.Errore = err.Error()
+		return c
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "officina-webhook")
+	req.Header.Set(HeaderEvento, e.Tipo)
+	req.Header.Set(HeaderConsegna, e.ID)
+	req.Header.Set(HeaderTentativo, strconv.Itoa(n))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderFirma, Firma(h.Secret, ts, corpo))
+
+	inizio := time.Now()
+	resp, err := d.client.Do(req)
+	c.Durata = time.Since(inizio)
+	if err != nil {
+		c.Errore = err.Error()
+		return c
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	c.Stato = resp.StatusCode
+	c.Riuscita = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !c.Riuscita {
+		c.Errore = resp.Status
+	}
+	return c
+}
+
+func (d *Dispatcher) registra(c database.ConsegnaWebhook) {
+	if d.registro == nil {
+		return
+	}
+	if err := d.registro.RegistraConsegnaWebhook(c); err != nil {
+		logger.Warn("Webhook %s: %v", c.Webhook, err)
+	}
+}
+
+// attesa restituisce il ritardo dopo l'n-esimo tentativo fallito
+func (d *Dispatcher) attesa(n int) time.Duration {
+	a := d.Attesa
+	for i := 1; i < n && a < d.AttesaMassima; i++ {
+		a *= 2
+	}
+	if a > d.AttesaMassima {
+		a = d.AttesaMassima
+	}
+	return a
+}
+
+// Firma calcola la firma di una richiesta: HMAC-SHA256 con il secret del
+// webhook di "timestamp.corpo", in esadecimale con prefisso "sha256=". Il
+// destinatario la ricalcola con il valore di X-Officina-Timestamp e il corpo
+// ricevuto, e scarta le richieste troppo vecchie.
+func Firma(secret string, timestamp int64, corpo []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(corpo)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// daRipetere indica se un tentativo fallito va ripetuto: errori di rete
+// (stato 0), timeout, troppe richieste ed errori del server. Gli altri 4xx
+// indicano una richiesta che il destinatario non accetterà mai.
+func daRipetere(stato int) bool {
+	return stato == 0 || stato == http.StatusRequestTimeout ||
+		stato == http.StatusTooManyRequests || stato >= 500
+}
+
+// interessato indica se il webhook riceve il tipo di evento
+func interessato(h config.WebhookConfig, tipo string) bool {
+	if len(h.Eventi) == 0 {
+		return true
+	}
+	for _, e := range h.Eventi {
+		if e == tipo {
+			return true
+		}
+	}
+	return false
+}
+
+// nomeWebhook restituisce il nome configurato o, se manca, l'URL
+func nomeWebhook(h config.WebhookConfig, i int) string {
+	if h.Nome != "" {
+		return h.Nome
+	}
+	if h.URL != "" {
+		return h.URL
+	}
+	return fmt.Sprintf("webhook %d", i+1)
+}
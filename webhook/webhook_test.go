@@ -0,0 +1,171 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"officina/config"
+	"officina/database"
+)
+
+// registroMemoria raccoglie le consegne al posto del database
+type registroMemoria struct {
+	mu       sync.Mutex
+	consegne []database.ConsegnaWebhook
+}
+
+func (r *registroMemoria) RegistraConsegnaWebhook(c database.ConsegnaWebhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.consegne = append(r.consegne, c)
+	return nil
+}
+
+// destinatario è un server di prova che risponde con gli stati indicati,
+// uno per richiesta (l'ultimo si ripete), e conserva le richieste ricevute
+type destinatario struct {
+	mu        sync.Mutex
+	stati     []int
+	richieste []*http.Request
+	corpi     [][]byte
+}
+
+func (d *destinatario) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	corpo, _ := io.ReadAll(req.Body)
+
+	d.mu.Lock()
+	n := len(d.richieste)
+	d.richieste = append(d.richieste, req)
+	d.corpi = append(d.corpi, corpo)
+	stato := d.stati[min(n, len(d.stati)-1)]
+	d.mu.Unlock()
+
+	w.WriteHeader(stato)
+}
+
+func TestConsegna(t *testing.T) {
+	tests := []struct {
+		name      string
+		stati     []int
+		max       int
+		eventi    []string
+		tentativi int  // richieste attese
+		riuscita  bool // esito dell'ultimo tentativo
+	}{
+		{"al primo tentativo", []int{http.StatusOK}, 0, nil, 1, true},
+		{"dopo errori del server", []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusNoContent}, 0, nil, 3, true},
+		{"troppe richieste", []int{http.StatusTooManyRequests, http.StatusOK}, 0, nil, 2, true},
+		{"tentativi esauriti", []int{http.StatusInternalServerError}, 3, nil, 3, false},
+		{"richiesta rifiutata", []int{http.StatusBadRequest}, 0, nil, 1, false},
+		{"evento filtrato", []int{http.StatusOK}, 0, []string{database.EventoCommessaChiusa}, 1, true},
+		{"evento non richiesto", []int{http.StatusOK}, 0, []string{database.EventoFatturaEmessa}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := &destinatario{stati: tt.stati}
+			srv := httptest.NewServer(dest)
+			defer srv.Close()
+
+			reg := &registroMemoria{}
+			hook := config.WebhookConfig{Nome: "SMS", URL: srv.URL, Secret: "segreto", Eventi: tt.eventi, MaxTentativi: tt.max}
+			d, err := NewDispatcher([]config.WebhookConfig{hook}, reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.Attesa = time.Millisecond
+			d.AttesaMassima = 5 * time.Millisecond
+
+			e := database.Evento{
+				ID: "abc123", Tipo: database.EventoCommessaChiusa, Data: time.Now(),
+				Origine: database.OrigineTUI, Operatore: "OPR001", Collezione: "commesse", RecordID: 7,
+				Dati: database.Commessa{ID: 7, Numero: "C-7", Stato: database.StatoCommessaChiusa},
+			}
+			d.Invia(e)
+			d.Chiudi(5 * time.Second)
+
+			if len(dest.richieste) != tt.tentativi || len(reg.consegne) != tt.tentativi {
+				t.Fatalf("richieste = %d, consegne registrate = %d, attese %d", len(dest.richieste), len(reg.consegne), tt.tentativi)
+			}
+			if tt.tentativi == 0 {
+				return
+			}
+
+			ultima := reg.consegne[len(reg.consegne)-1]
+			if ultima.Riuscita != tt.riuscita || !ultima.Definitiva || ultima.Tentativo != tt.tentativi {
+				t.Errorf("ultima consegna = %+v", ultima)
+			}
+			for _, c := range reg.consegne[:len(reg.consegne)-1] {
+				if c.Definitiva || c.Riuscita {
+					t.Errorf("tentativo intermedio = %+v", c)
+				}
+			}
+
+			// Ogni richiesta è firmata e porta lo stesso id di consegna
+			for i, req := range dest.richieste {
+				ts, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+				firma := Firma("segreto", ts, dest.corpi[i])
+				if !hmac.Equal([]byte(req.Header.Get(HeaderFirma)), []byte(firma)) {
+					t.Errorf("richiesta %d: firma %q, attesa %q", i+1, req.Header.Get(HeaderFirma), firma)
+				}
+				if req.Header.Get(HeaderConsegna) != "abc123" || req.Header.Get(HeaderTentativo) != strconv.Itoa(i+1) {
+					t.Errorf("richiesta %d: header %v", i+1, req.Header)
+				}
+			}
+
+			var ricevuto struct {
+				Evento   string `json:"evento"`
+				RecordID int    `json:"record_id"`
+				Dati     struct {
+					Numero string `json:"numero"`
+				} `json:"dati"`
+			}
+			if err := json.Unmarshal(dest.corpi[0], &ricevuto); err != nil {
+				t.Fatal(err)
+			}
+			if ricevuto.Evento != database.EventoCommessaChiusa || ricevuto.RecordID != 7 || ricevuto.Dati.Numero != "C-7" {
+				t.Errorf("corpo = %s", dest.corpi[0])
+			}
+		})
+	}
+}
+
+func TestProva(t *testing.T) {
+	dest := &destinatario{stati: []int{http.StatusAccepted}}
+	srv := httptest.NewServer(dest)
+	defer srv.Close()
+
+	// Il webhook di prova non riceve commesse, ma l'evento di prova sì
+	hook := config.WebhookConfig{Nome: "Bot", URL: srv.URL, Secret: "s", Eventi: []string{database.EventoFatturaEmessa}}
+	d, err := NewDispatcher([]config.WebhookConfig{hook}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := d.Prova(context.Background(), "Bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Riuscita || c.Stato != http.StatusAccepted || dest.richieste[0].Header.Get(HeaderEvento) != EventoProva {
+		t.Errorf("consegna = %+v", c)
+	}
+
+	if _, err := d.Prova(context.Background(), "Altro"); err == nil {
+		t.Error("webhook inesistente: atteso errore")
+	}
+}
+
+func TestEventoSconosciuto(t *testing.T) {
+	hook := config.WebhookConfig{Nome: "X", URL: "http://localhost", Secret: "s", Eventi: []string{"commessa.aperta"}}
+	if _, err := NewDispatcher([]config.WebhookConfig{hook}, nil); err == nil {
+		t.Error("atteso errore per evento sconosciuto")
+	}
+}
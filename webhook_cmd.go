@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"officina/database"
+	"officina/logger"
+	"officina/webhook"
+)
+
+// runWebhookCommand gestisce "officina webhook log|test"
+func runWebhookCommand(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "Uso: officina webhook log|test [opzioni]")
+		return exitUso
+	}
+
+	switch args[0] {
+	case "log":
+		return runWebhookLog(args[1:])
+	case "test":
+		return runWebhookTest(args[1:])
+	}
+
+	fmt.Fprintf(os.Stderr, "Comando sconosciuto: webhook %s\n", args[0])
+	return exitUso
+}
+
+// runWebhookLog mostra il registro delle consegne
+func runWebhookLog(args []string) int {
+	opts := newOpzioni("webhook log")
+	limite := opts.fs.Int("limite", 50, "numero massimo di tentativi (0 = tutti)")
+	falliti := opts.fs.Bool("falliti", false, "solo le consegne non riuscite")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	_, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	list, err := db.ListConsegneWebhook(*limite)
+	if err != nil {
+		opts.fail(err)
+		return exitErrore
+	}
+	out := []database.ConsegnaWebhook{}
+	for _, c := range list {
+		if !*falliti || (!c.Riuscita && c.Definitiva) {
+			out = append(out, c)
+		}
+	}
+
+	opts.output(out, func() {
+		for _, c := range out {
+			esito := "ok"
+			if !c.Riuscita {
+				esito = "ERRORE " + c.Errore
+				if !c.Definitiva {
+					esito += " (riprova)"
+				}
+			}
+			fmt.Printf("%s  %-12s %-22s #%-5d %d° %s\n",
+				c.Data.Format("2006-01-02 15:04:05"), c.Webhook, c.Evento, c.RecordID, c.Tentativo, esito)
+		}
+	})
+	return exitOK
+}
+
+// runWebhookTest invia un evento di prova ai webhook indicati, o a tutti
+func runWebhookTest(args []string) int {
+	opts := newOpzioni("webhook test")
+	if code, stop := opts.parse(args); stop {
+		return code
+	}
+
+	cfg, db, code, stop := opts.open()
+	if stop {
+		return code
+	}
+	defer logger.Close()
+	defer db.Close()
+
+	d, err := webhook.NewDispatcher(cfg.Webhooks, db)
+	if err != nil {
+		opts.fail(err)
+		return exitUso
+	}
+	nomi := opts.args
+	if len(nomi) == 0 {
+		nomi = d.Nomi()
+	}
+	if len(nomi) == 0 {
+		opts.fail(fmt.Errorf("nessun webhook configurato in [[webhooks]]"))
+		return exitUso
+	}
+
+	var esiti []database.ConsegnaWebhook
+	for _, nome := range nomi {
+		c, err := d.Prova(context.Background(), nome)
+		if err != nil {
+			opts.fail(err)
+			return exitUso
+		}
+		esiti = append(esiti, c)
+	}
+
+	code = exitOK
+	opts.output(esiti, func() {
+		for _, c := range esiti {
+			if c.Riuscita {
+				fmt.Printf("%-12s ok (%d, %s)\n", c.Webhook, c.Stato, c.Durata.Round(time.Millisecond))
+			} else {
+				fmt.Printf("%-12s ERRORE %s\n", c.Webhook, c.Errore)
+			}
+		}
+	})
+	for _, c := range esiti {
+		if !c.Riuscita {
+			code = exitProblemi
+		}
+	}
+	return code
+}